@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/driusan/dgit/git"
+)
+
+func Bisect(c *git.Client, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("Must provide a bisect subcommand")
+	}
+	switch args[0] {
+	case "start":
+		args = args[1:]
+		doubledash := false
+		for _, arg := range args {
+			if arg == "--" {
+				doubledash = true
+			}
+		}
+		// Everything before -- is a revision. Without a --, the
+		// paths start at the first thing which isn't a revision.
+		var revs, paths []string
+		for i, arg := range args {
+			if arg == "--" {
+				paths = args[i+1:]
+				break
+			}
+			if _, err := git.RevParseCommitish(c, &git.RevParseOptions{}, arg); err != nil {
+				if doubledash {
+					return fmt.Errorf("'%v' does not appear to be a valid revision", arg)
+				}
+				paths = args[i:]
+				break
+			}
+			revs = append(revs, arg)
+		}
+		return git.BisectStart(c, revs, paths)
+	case "bad", "new":
+		return git.BisectMark(c, "bad", args[1:])
+	case "good", "old":
+		return git.BisectMark(c, "good", args[1:])
+	case "skip":
+		return git.BisectMark(c, "skip", args[1:])
+	case "reset":
+		if len(args) > 2 {
+			return fmt.Errorf("'dgit bisect reset' requires either no argument or a commit")
+		}
+		commit := ""
+		if len(args) == 2 {
+			commit = args[1]
+		}
+		return git.BisectReset(c, commit)
+	case "log":
+		log, err := git.BisectLog(c)
+		if err != nil {
+			return err
+		}
+		fmt.Print(log)
+		return nil
+	case "replay":
+		if len(args) != 2 {
+			return fmt.Errorf("no logfile given")
+		}
+		return git.BisectReplay(c, git.File(args[1]))
+	case "visualize", "view":
+		commits, err := git.BisectVisualize(c)
+		if err != nil {
+			return err
+		}
+		for _, cmt := range commits {
+			output, err := cmt.FormatMedium(c)
+			if err != nil {
+				return err
+			}
+			fmt.Print(output)
+		}
+		return nil
+	case "run":
+		return git.BisectRun(c, args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown bisect subcommand: %v\n", args[0])
+		os.Exit(2)
+	}
+	return nil
+}
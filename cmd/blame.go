@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/driusan/dgit/git"
+)
+
+func Blame(c *git.Client, args []string) error {
+	return blame(c, "blame", args)
+}
+
+func Annotate(c *git.Client, args []string) error {
+	return blame(c, "annotate", args)
+}
+
+// blame handles both blame and annotate, which only differ in their
+// default output format.
+func blame(c *git.Client, name string, args []string) error {
+	flags := newFlagSet(name)
+	opts := git.BlameOptions{Annotate: name == "annotate"}
+
+	flags.Var(NewMultiStringValue(&opts.LineRanges), "L", "Only blame the lines in the range <start>,<end>")
+	flags.BoolVar(&opts.Porcelain, "porcelain", false, "Show the output in a format designed for machine consumption")
+	flags.BoolVar(&opts.Porcelain, "p", false, "Alias of --porcelain")
+	flags.BoolVar(&opts.LinePorcelain, "line-porcelain", false, "Show the porcelain format with the commit information on every line")
+	flags.BoolVar(&opts.Annotate, "c", opts.Annotate, "Use the same output format as git annotate")
+
+	flags.BoolVar(&opts.IgnoreWhitespace, "w", false, "Ignore whitespace when comparing lines")
+	flags.BoolVar(&opts.DetectMoves, "M", false, "Detect lines moved within the file")
+	flags.Var(newCountValue(&opts.DetectCopies), "C", "Detect lines copied from other files modified in the same commit. Given more than once, look in every file")
+	flags.BoolVar(&opts.Reverse, "reverse", false, "Walk history forwards instead of backwards")
+
+	var ignoreRevs, ignoreRevsFiles []string
+	flags.Var(NewMultiStringValue(&ignoreRevs), "ignore-rev", "Ignore the changes made by the revision when assigning blame")
+	flags.Var(NewMultiStringValue(&ignoreRevsFiles), "ignore-revs-file", "Ignore the revisions listed in the file")
+
+	flags.BoolVar(&opts.LongHash, "l", false, "Show the full commit hash")
+	flags.BoolVar(&opts.SuppressAuthor, "s", false, "Suppress the author name and timestamp")
+	flags.BoolVar(&opts.ShowEmail, "show-email", false, "Show the author email instead of the author name")
+	flags.BoolVar(&opts.ShowEmail, "e", false, "Alias of --show-email")
+	flags.BoolVar(&opts.ShowNumber, "show-number", false, "Show the line number in the original commit")
+	flags.BoolVar(&opts.ShowNumber, "n", false, "Alias of --show-number")
+	flags.BoolVar(&opts.ShowName, "show-name", false, "Show the filename in the original commit")
+	flags.BoolVar(&opts.ShowName, "f", false, "Alias of --show-name")
+	flags.Parse(args)
+
+	// Anything before a -- is a revision. Without a --, the file is the
+	// first argument and may be followed by a revision, or the last
+	// argument and preceded by one.
+	var revs []string
+	var file string
+	args = flags.Args()
+	for i, arg := range args {
+		if arg == "--" {
+			if i != len(args)-2 {
+				flags.Usage()
+				os.Exit(2)
+			}
+			revs, file = args[:i], args[i+1]
+			break
+		}
+	}
+	if file == "" {
+		switch len(args) {
+		case 1:
+			file = args[0]
+		case 2:
+			if git.File(args[0]).Exists() {
+				file, revs = args[0], args[1:]
+			} else {
+				file, revs = args[1], args[:1]
+			}
+		default:
+			flags.Usage()
+			os.Exit(2)
+		}
+	}
+
+	parse := func(rev string) (git.Commitish, error) {
+		if rev == "" {
+			rev = "HEAD"
+		}
+		return git.RevParseCommitish(c, &git.RevParseOptions{}, rev)
+	}
+	var includes, excludes []git.Commitish
+	for _, rev := range revs {
+		if pieces := strings.SplitN(rev, "..", 2); len(pieces) == 2 {
+			from, err := parse(pieces[0])
+			if err != nil {
+				return err
+			}
+			to, err := parse(pieces[1])
+			if err != nil {
+				return err
+			}
+			excludes = append(excludes, from)
+			includes = append(includes, to)
+			continue
+		}
+		if strings.HasPrefix(rev, "^") {
+			cmt, err := parse(rev[1:])
+			if err != nil {
+				return err
+			}
+			excludes = append(excludes, cmt)
+			continue
+		}
+		cmt, err := parse(rev)
+		if err != nil {
+			return err
+		}
+		includes = append(includes, cmt)
+	}
+	if opts.Reverse && len(excludes) == 0 {
+		// --reverse <rev> is short for --reverse <rev>..HEAD
+		if len(includes) != 1 {
+			return fmt.Errorf("--reverse requires a range of commits")
+		}
+		head, err := parse("HEAD")
+		if err != nil {
+			return err
+		}
+		excludes, includes = includes, []git.Commitish{head}
+	}
+
+	for _, rev := range ignoreRevs {
+		cmt, err := parse(rev)
+		if err != nil {
+			return err
+		}
+		opts.IgnoreRevs = append(opts.IgnoreRevs, cmt)
+	}
+	for _, f := range ignoreRevsFiles {
+		opts.IgnoreRevsFiles = append(opts.IgnoreRevsFiles, git.File(f))
+	}
+	return git.Blame(c, opts, os.Stdout, includes, excludes, git.File(file))
+}
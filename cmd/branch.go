@@ -20,10 +20,10 @@ func Branch(c *git.Client, args []string) error {
 	opts := git.BranchOptions{}
 
 	// These flags can be moved out of these lists and below as proper flags as they are implemented
-	for _, bf := range []string{"create-reflog", "M", "c", "copy", "C", "no-color", "i", "ignore-case", "no-column", "r", "remotes", "v", "vv", "verbose", "no-abbrev", "no-track", "unset-upstream", "edit-description"} {
+	for _, bf := range []string{"create-reflog", "no-color", "i", "ignore-case", "no-column", "no-abbrev", "no-track", "edit-description"} {
 		flags.Var(newNotimplBoolValue(), bf, "Not implemented")
 	}
-	for _, sf := range []string{"color", "abbrev", "column", "sort", "no-merged", "contains", "no-contains", "points-at", "format", "set-upstream-to", "u"} {
+	for _, sf := range []string{"color", "abbrev", "column", "format"} {
 		flags.Var(newNotimplStringValue(), sf, "Not implemented")
 	}
 
@@ -31,17 +31,73 @@ func Branch(c *git.Client, args []string) error {
 	flags.BoolVar(&opts.Force, "force", false, "Alias of -f")
 	flags.BoolVar(&opts.All, "all", false, "Show remote branches too")
 	flags.BoolVar(&opts.All, "a", false, "Alias of --all")
+	flags.BoolVar(&opts.Remotes, "remotes", false, "List or delete remote-tracking branches")
+	flags.BoolVar(&opts.Remotes, "r", false, "Alias of --remotes")
 	flags.BoolVar(&opts.Quiet, "quiet", false, "Do not print branches")
 	flags.BoolVar(&opts.Quiet, "q", false, "Alias of --quiet")
 	flags.BoolVar(&opts.Move, "m", false, "Move/rename a branch")
 	flags.BoolVar(&opts.Move, "move", false, "Alias of -m")
+	forceMove := flags.Bool("M", false, "Shortcut for --move --force")
+	flags.BoolVar(&opts.Copy, "c", false, "Copy a branch, including its reflog and config")
+	flags.BoolVar(&opts.Copy, "copy", false, "Alias of -c")
+	forceCopy := flags.Bool("C", false, "Shortcut for --copy --force")
 	flags.BoolVar(&opts.Delete, "d", false, "Delete a branch")
 	flags.BoolVar(&opts.Delete, "delete", false, "Alias of -d")
 	flags.BoolVar(&opts.Delete, "D", false, "Alias of -d") // This will no longer be a simple alias once we have --force
 	list := false
 	flags.BoolVar(&list, "l", false, "List branches")
 	flags.BoolVar(&list, "list", false, "Alias of -l")
-	flags.Parse(args)
+
+	verbose := flags.Bool("verbose", false, "Show sha1 and commit subject line for each head")
+	flags.BoolVar(verbose, "v", false, "Alias of --verbose")
+	vverbose := flags.Bool("vv", false, "Like --verbose, but also show the upstream branch")
+
+	var upstream string
+	flags.StringVar(&upstream, "set-upstream-to", "", "Set up the branch's tracking information")
+	flags.StringVar(&upstream, "u", "", "Alias of --set-upstream-to")
+	unsetUpstream := flags.Bool("unset-upstream", false, "Remove the upstream information for the branch")
+
+	var merged, noMerged, contains, noContains, pointsAt string
+	flags.StringVar(&merged, "merged", "", "Only list branches whose tips are reachable from the commit (default HEAD)")
+	flags.StringVar(&noMerged, "no-merged", "", "Only list branches whose tips are not reachable from the commit (default HEAD)")
+	flags.StringVar(&contains, "contains", "", "Only list branches which contain the commit (default HEAD)")
+	flags.StringVar(&noContains, "no-contains", "", "Only list branches which don't contain the commit (default HEAD)")
+	flags.StringVar(&pointsAt, "points-at", "", "Only list branches which point at the commit")
+	flags.StringVar(&opts.Sort, "sort", "", "Sort by key (refname, objectname, committerdate or authordate)")
+
+	flags.Parse(lastArgDefault(args, "HEAD", "merged", "no-merged", "contains", "no-contains"))
+
+	if *forceMove {
+		opts.Move, opts.Force = true, true
+	}
+	if *forceCopy {
+		opts.Copy, opts.Force = true, true
+	}
+	if *vverbose {
+		opts.Verbose = 2
+	} else if *verbose {
+		opts.Verbose = 1
+	}
+	for _, filter := range []struct {
+		val  string
+		dest *[]git.Commitish
+	}{
+		{merged, &opts.Merged},
+		{noMerged, &opts.NoMerged},
+		{contains, &opts.Contains},
+		{noContains, &opts.NoContains},
+		{pointsAt, &opts.PointsAt},
+	} {
+		if filter.val == "" {
+			continue
+		}
+		cmt, err := git.RevParseCommitish(c, &git.RevParseOptions{}, filter.val)
+		if err != nil {
+			return err
+		}
+		*filter.dest = append(*filter.dest, cmt)
+		list = true
+	}
 
 	if opts.Delete {
 		for idx := range flags.Args() {
@@ -56,8 +112,47 @@ func Branch(c *git.Client, args []string) error {
 		return nil
 	}
 
-	if list {
-		_, err := git.BranchList(c, os.Stdout, opts, nil)
+	if upstream != "" {
+		if flags.NArg() > 1 {
+			flags.Usage()
+		}
+		if err := git.BranchSetUpstream(c, flags.Arg(0), upstream); err != nil {
+			return err
+		}
+		if !opts.Quiet {
+			branch := flags.Arg(0)
+			if branch == "" {
+				branch = c.GetHeadBranch().BranchName()
+			}
+			fmt.Printf("branch '%v' set up to track '%v'.\n", branch, upstream)
+		}
+		return nil
+	}
+	if *unsetUpstream {
+		if flags.NArg() > 1 {
+			flags.Usage()
+		}
+		return git.BranchUnsetUpstream(c, flags.Arg(0))
+	}
+
+	if opts.Move || opts.Copy {
+		var oldname, newname string
+		switch flags.NArg() {
+		case 1:
+			newname = flags.Arg(0)
+		case 2:
+			oldname, newname = flags.Arg(0), flags.Arg(1)
+		default:
+			flags.Usage()
+		}
+		if opts.Copy {
+			return git.BranchCopy(c, opts, oldname, newname)
+		}
+		return git.BranchRename(c, opts, oldname, newname)
+	}
+
+	if list || opts.Verbose > 0 {
+		_, err := git.BranchList(c, os.Stdout, opts, flags.Args())
 		return err
 	}
 
@@ -75,23 +170,6 @@ func Branch(c *git.Client, args []string) error {
 			fmt.Fprintf(os.Stderr, "Could not create branch (%v): %v\n", flags.Arg(0), err)
 			return err
 		}
-		if opts.Move {
-			newbranch, err := git.GetBranch(c, flags.Arg(0))
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Could not get branch (%v): %v\n", flags.Arg(0), err)
-				return err
-			}
-			refmsg := fmt.Sprintf("Branch: renamed %s to %s", b.String(), flags.Arg(0))
-			if err = git.SymbolicRefUpdate(c, git.SymbolicRefOptions{}, "HEAD", git.RefSpec(newbranch), refmsg); err != nil {
-				fmt.Fprintf(os.Stderr, "Could not update symbolic ref to branch (%v): %v\n", flags.Arg(0), err)
-				return err
-			}
-			if err = b.DeleteBranch(c); err != nil {
-				fmt.Fprintf(os.Stderr, "Could not delete original branch (%v): %v\n", b, err)
-				return err
-			}
-			// TODO move the reflog
-		}
 	case 2:
 		startpoint, err := git.RevParseCommitish(c, &git.RevParseOptions{}, flags.Arg(1))
 		if err != nil {
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/driusan/dgit/git"
+)
+
+func CheckRefFormat(c *git.Client, args []string) error {
+	flags := newFlagSet("check-ref-format")
+	opts := git.CheckRefFormatOptions{}
+
+	flags.BoolVar(&opts.AllowOneLevel, "allow-onelevel", false, "Allow refnames with a single component")
+	noOneLevel := flags.Bool("no-allow-onelevel", false, "Require refnames to have at least two components (default)")
+	flags.BoolVar(&opts.RefspecPattern, "refspec-pattern", false, "Allow a single * in the refname")
+	flags.BoolVar(&opts.Normalize, "normalize", false, "Normalize the refname and print it if valid")
+	flags.BoolVar(&opts.Normalize, "print", false, "Alias of --normalize")
+	flags.BoolVar(&opts.Branch, "branch", false, "Expand @{-N} and check that the name is a valid branch name")
+
+	flags.Parse(args)
+	if *noOneLevel {
+		opts.AllowOneLevel = false
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	name, err := git.CheckRefFormat(c, opts, flags.Arg(0))
+	if err != nil {
+		if opts.Branch {
+			return err
+		}
+		// Invalid refnames are reported by the exit code alone.
+		os.Exit(1)
+	}
+	if opts.Normalize || opts.Branch {
+		fmt.Println(name)
+	}
+	return nil
+}
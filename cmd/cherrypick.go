@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/driusan/dgit/git"
+)
+
+// parseCommitList parses the commits for a sequencer command such as
+// cherry-pick or revert. Commits given on their own are returned in the
+// order given, but if there are any ranges (A..B or ^A B), all the commits
+// in the ranges are returned, oldest first unless newestFirst is set.
+func parseCommitList(c *git.Client, args []string, newestFirst bool) ([]git.Commitish, error) {
+	var includes, excludes []git.Commitish
+	parse := func(rev string) (git.Commitish, error) {
+		if rev == "" {
+			rev = "HEAD"
+		}
+		return git.RevParseCommitish(c, &git.RevParseOptions{}, rev)
+	}
+	for _, arg := range args {
+		if pieces := strings.SplitN(arg, "..", 2); len(pieces) == 2 {
+			from, err := parse(pieces[0])
+			if err != nil {
+				return nil, err
+			}
+			to, err := parse(pieces[1])
+			if err != nil {
+				return nil, err
+			}
+			excludes = append(excludes, from)
+			includes = append(includes, to)
+			continue
+		}
+		if strings.HasPrefix(arg, "^") {
+			cmt, err := parse(arg[1:])
+			if err != nil {
+				return nil, err
+			}
+			excludes = append(excludes, cmt)
+			continue
+		}
+		cmt, err := parse(arg)
+		if err != nil {
+			return nil, err
+		}
+		includes = append(includes, cmt)
+	}
+	if len(excludes) == 0 {
+		return includes, nil
+	}
+	revs, err := git.RevList(c, git.RevListOptions{Quiet: true}, nil, includes, excludes)
+	if err != nil {
+		return nil, err
+	}
+	commits := make([]git.Commitish, len(revs))
+	for i, rev := range revs {
+		if newestFirst {
+			commits[i] = git.CommitID(rev)
+		} else {
+			commits[len(revs)-i-1] = git.CommitID(rev)
+		}
+	}
+	return commits, nil
+}
+
+func CherryPick(c *git.Client, args []string) error {
+	flags := flag.NewFlagSet("cherry-pick", flag.ExitOnError)
+	flags.SetOutput(flag.CommandLine.Output())
+	flags.Usage = func() {
+		flag.Usage()
+		fmt.Fprintf(flag.CommandLine.Output(), "\n\nOptions:\n")
+		flags.PrintDefaults()
+	}
+
+	opts := git.CherryPickOptions{}
+
+	flags.BoolVar(&opts.Edit, "edit", false, "Edit the commit message prior to committing")
+	flags.BoolVar(&opts.Edit, "e", false, "Alias of --edit")
+	flags.BoolVar(&opts.RecordOrigin, "x", false, "Append a line saying which commit was cherry-picked to the commit message")
+
+	flags.IntVar(&opts.MergeParent, "mainline", 0, "Choose which parent of a merge commit to cherry-pick relative to (1 indexed)")
+	flags.IntVar(&opts.MergeParent, "m", 0, "Alias of --mainline")
+
+	flags.BoolVar(&opts.NoCommit, "no-commit", false, "Apply the changes to the index and work tree without committing")
+	flags.BoolVar(&opts.NoCommit, "n", false, "Alias of --no-commit")
+
+	flags.BoolVar(&opts.SignOff, "signoff", false, "Add a Signed-off-by line at the end of the commit message")
+	flags.BoolVar(&opts.SignOff, "s", false, "Alias of --signoff")
+
+	flags.BoolVar(&opts.AllowEmpty, "allow-empty", false, "Allow commits which were empty to begin with to be cherry-picked")
+
+	flags.Var(NewMultiStringValue(&opts.StrategyOptions), "strategy-option", "Pass the option to the merge strategy")
+	flags.Var(NewMultiStringValue(&opts.StrategyOptions), "X", "Alias of --strategy-option")
+
+	// Sequencer subcommands
+	flags.BoolVar(&opts.Continue, "continue", false, "Continue the operation in progress using the information in .git/sequencer")
+	flags.BoolVar(&opts.Skip, "skip", false, "Skip the current commit and continue with the rest of the sequence")
+	flags.BoolVar(&opts.Quit, "quit", false, "Forget the current operation in progress")
+	flags.BoolVar(&opts.Abort, "abort", false, "Cancel the operation and return to the pre-sequence state")
+
+	flags.Parse(args)
+
+	if opts.Continue || opts.Skip || opts.Quit || opts.Abort {
+		return git.CherryPick(c, opts, nil)
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	commits, err := parseCommitList(c, flags.Args(), false)
+	if err != nil {
+		return err
+	}
+	if len(commits) == 0 {
+		return fmt.Errorf("empty commit set passed")
+	}
+	return git.CherryPick(c, opts, commits)
+}
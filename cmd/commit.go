@@ -61,7 +61,7 @@ func Commit(c *git.Client, args []string) (string, error) {
 	flags.BoolVar(&edit, "edit", false, "")
 	flags.BoolVar(&edit, "e", false, "Alias for --edit")
 
-	_ = flags.Bool("no-edit", false, "")
+	noEdit := flags.Bool("no-edit", false, "Use the prepared message of an in progress merge without editing it")
 
 	flags.StringVar(&opts.CleanupMode, "cleanup", "", "")
 
@@ -94,6 +94,22 @@ func Commit(c *git.Client, args []string) (string, error) {
 		opts.NoEdit = false
 	}
 
+	// Default to the message prepared by merge if there is one.
+	if len(message) == 0 {
+		for _, prepared := range []git.File{"MERGE_MSG", "SQUASH_MSG"} {
+			if m, err := c.GitDir.File(prepared).ReadAll(); err == nil {
+				message = append(message, strings.TrimRight(m, "\n"))
+				opts.NoEdit = *noEdit
+				if opts.CleanupMode == "" {
+					// Don't include the commented conflict
+					// list when not editing.
+					opts.CleanupMode = "strip"
+				}
+				break
+			}
+		}
+	}
+
 	finalMessage := strings.Join(message, "\n\n") + "\n"
 
 	if !opts.NoEdit {
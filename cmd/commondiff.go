@@ -4,6 +4,9 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/driusan/dgit/git"
 )
@@ -14,27 +17,45 @@ import (
 // Any unique parameters must already be set up in flags before calling this,
 // because this will call flags.Parse
 func parseCommonDiffFlags(c *git.Client, options *git.DiffCommonOptions, defaultPatch bool, flags *flag.FlagSet, args []string) (newargs []string, err error) {
-	patch := flags.Bool("patch", defaultPatch, "Generate patch")
-	p := flags.Bool("p", defaultPatch, "Alias for --patch")
-	u := flags.Bool("u", defaultPatch, "Alias for --patch")
+	patch := flags.Bool("patch", false, "Generate patch")
+	p := flags.Bool("p", false, "Alias for --patch")
+	u := flags.Bool("u", false, "Alias for --patch")
 
 	nopatch := flags.Bool("no-patch", false, "Suppress patch generation")
 	s := flags.Bool("s", false, "Alias of --no-patch")
 	unified := flags.Int("unified", 3, "Generate <n> lines of context")
 	U := flags.Int("U", 3, "Alias of --unified")
 	U0 := flags.Bool("U0", false, "Alias of -U 0. (This is primarily for test compatibility)")
-	flags.BoolVar(&options.Raw, "raw", true, "Generate the diff in raw format")
+	flags.BoolVar(&options.Raw, "raw", false, "Generate the diff in raw format")
 	flags.BoolVar(&options.ExitCode, "exit-code", false, "Exit with an exit code of 1 if there are any diffs")
+	renames := addRenameFlags(flags, options)
+	addPickaxeFlags(flags, options)
+	abbrev := addAbbrevFlags(flags, options)
+	checkFormat := addDiffFormatFlags(flags, options)
+	patchStyle := addPatchStyleFlags(flags, options)
 
-	flags.Parse(args)
+	flags.Parse(adjustDiffArgs(args))
 	args = flags.Args()
+	// Only diff, which shows a patch by default, is a porcelain command.
+	renames(c, defaultPatch)
+	abbrev(defaultPatch)
+	if err := checkFormat(); err != nil {
+		return nil, err
+	}
+	if err := patchStyle(c); err != nil {
+		return nil, err
+	}
 
 	if *patch || *p || *u {
 		options.Patch = true
-		options.Raw = false
+	}
+	if !options.HasDiffOutput() {
+		options.Patch = defaultPatch
+		options.Raw = !defaultPatch
 	}
 	if *nopatch || *s {
 		options.Patch = false
+		options.Raw = false
 	}
 
 	if *unified != 3 && *U != 3 {
@@ -66,3 +87,482 @@ func printDiffs(c *git.Client, options git.DiffCommonOptions, diffs []git.HashDi
 	}
 	return nil
 }
+
+// A flag for options such as -M[<n>], which turn on detection and may
+// set the similarity score that's needed for a match.
+type scoreValue struct {
+	enabled *bool
+	score   *int
+
+	// If set, repeat is enabled when the flag is given more than once.
+	repeat *bool
+}
+
+func (s *scoreValue) IsBoolFlag() bool { return true }
+
+func (s *scoreValue) Set(val string) error {
+	if *s.enabled && s.repeat != nil {
+		*s.repeat = true
+	}
+	*s.enabled = true
+	if val == "true" {
+		return nil
+	}
+	score, err := parseScore(val)
+	if err != nil {
+		return err
+	}
+	*s.score = score
+	return nil
+}
+
+func (s *scoreValue) String() string { return "" }
+
+// A flag for -B[<n>][/<m>], where n is the break score and m is the
+// merge score.
+type breakValue git.DiffCommonOptions
+
+func (b *breakValue) IsBoolFlag() bool { return true }
+
+func (b *breakValue) Set(val string) error {
+	b.BreakRewrites = true
+	if val == "true" {
+		return nil
+	}
+	scores := strings.SplitN(val, "/", 2)
+	if scores[0] != "" {
+		score, err := parseScore(scores[0])
+		if err != nil {
+			return err
+		}
+		b.BreakScore = score
+	}
+	if len(scores) == 2 {
+		score, err := parseScore(scores[1])
+		if err != nil {
+			return err
+		}
+		b.MergeScore = score
+	}
+	return nil
+}
+
+func (b *breakValue) String() string { return "" }
+
+// parseScore parses a similarity score for -M, -C or -B. Like git, a
+// score ending in % is a percentage, and anything else is the fractional
+// part of a decimal, so that 5, 50 and 50% are all the same.
+func parseScore(val string) (int, error) {
+	if strings.HasSuffix(val, "%") {
+		score, err := strconv.Atoi(val[:len(val)-1])
+		if err != nil || score < 0 || score > 100 {
+			return 0, fmt.Errorf("invalid score: %v", val)
+		}
+		return score, nil
+	}
+	if _, err := strconv.ParseUint(val, 10, 64); err != nil {
+		return 0, fmt.Errorf("invalid score: %v", val)
+	}
+	score, _ := strconv.ParseFloat("0."+val, 64)
+	return int(score * 100), nil
+}
+
+// addRenameFlags adds the flags for rename, copy and rewrite detection to
+// flags. Since the scores are given without an "=", the arguments must be
+// passed through adjustRenameArgs before parsing them. It returns a function
+// to call after the flags are parsed, which turns on rename detection from
+// diff.renames for porcelain commands, unless --no-renames was given.
+func addRenameFlags(flags *flag.FlagSet, options *git.DiffCommonOptions) func(c *git.Client, porcelain bool) {
+	renames := &scoreValue{enabled: &options.DetectRenames, score: &options.RenameThreshold}
+	flags.Var(renames, "M", "Detect renames, with a similarity of at least <n>")
+	flags.Var(renames, "find-renames", "Alias of -M")
+	copies := &scoreValue{enabled: &options.DetectCopies, score: &options.RenameThreshold, repeat: &options.FindCopiesHarder}
+	flags.Var(copies, "C", "Detect copies as well as renames, with a similarity of at least <n>")
+	flags.Var(copies, "find-copies", "Alias of -C")
+	flags.BoolVar(&options.FindCopiesHarder, "find-copies-harder", false, "Use unmodified files as the source of copies")
+	flags.Var((*breakValue)(options), "B", "Break complete rewrites into a delete and an add")
+	flags.Var((*breakValue)(options), "break-rewrites", "Alias of -B")
+	flags.IntVar(&options.RenameLimit, "l", 0, "Skip inexact rename detection if there are more than <num> sources or destinations")
+	norenames := flags.Bool("no-renames", false, "Turn off rename detection, even if it's enabled in the config")
+	return func(c *git.Client, porcelain bool) {
+		switch {
+		case *norenames:
+			options.DetectRenames = false
+			options.DetectCopies = false
+			options.FindCopiesHarder = false
+		case !porcelain, options.DetectRenames, options.DetectCopies, options.FindCopiesHarder:
+		default:
+			// Like git, diff.renames defaults to true.
+			switch c.GetConfig("diff.renames") {
+			case "", "true", "yes", "on", "1":
+				options.DetectRenames = true
+			case "copy", "copies":
+				options.DetectCopies = true
+			}
+		}
+	}
+}
+
+// addPickaxeFlags adds the flags which limit the changes shown to those
+// which add or remove a string or lines matching a regex. Since the strings
+// are given without an "=", the arguments must be passed through
+// adjustDiffArgs before parsing them.
+func addPickaxeFlags(flags *flag.FlagSet, options *git.DiffCommonOptions) {
+	flags.StringVar(&options.PickaxeString, "S", "", "Look for changes in the number of occurrences of <string>")
+	flags.StringVar(&options.PickaxeGrep, "G", "", "Look for added or removed lines matching <regex>")
+	flags.BoolVar(&options.PickaxeRegex, "pickaxe-regex", false, "Treat the <string> given to -S as a regex")
+	flags.BoolVar(&options.PickaxeAll, "pickaxe-all", false, "Show all of the changes in a changeset if any of them are found by -S or -G")
+}
+
+// A flag for --abbrev[=<n>], or --no-abbrev if full is set.
+type abbrevValue struct {
+	abbrev *int
+	given  *bool
+	full   bool
+}
+
+func (v abbrevValue) IsBoolFlag() bool { return true }
+
+func (v abbrevValue) Set(val string) error {
+	*v.given = true
+	switch {
+	case v.full:
+		*v.abbrev = 0
+	case val == "true":
+		*v.abbrev = 7
+	default:
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			return fmt.Errorf("invalid --abbrev: %v", val)
+		}
+		// Like git, abbreviate to at least 4 digits.
+		if n < 4 {
+			n = 4
+		}
+		*v.abbrev = n
+	}
+	return nil
+}
+
+func (v abbrevValue) String() string { return "" }
+
+// addAbbrevFlags adds the flags which abbreviate the object names in raw
+// output to flags. It returns a function to call after the flags are
+// parsed, which abbreviates them by default for porcelain commands.
+func addAbbrevFlags(flags *flag.FlagSet, options *git.DiffCommonOptions) func(porcelain bool) {
+	var given bool
+	flags.Var(abbrevValue{abbrev: &options.Abbrev, given: &given}, "abbrev", "Abbreviate the object names in raw output to <n> digits")
+	flags.Var(abbrevValue{abbrev: &options.Abbrev, given: &given, full: true}, "no-abbrev", "Show the full object names in raw output")
+	return func(porcelain bool) {
+		if porcelain && !given {
+			options.Abbrev = 7
+		}
+	}
+}
+
+// adjustDiffArgs rewrites arguments such as -M90%, -X10, -U5 or -Sfoo to
+// -M=90%, -X=10, -U=5 and -S=foo, so that they can be parsed by the flag
+// package.
+func adjustDiffArgs(args []string) []string {
+	var newargs []string
+	for i, a := range args {
+		if a == "--" {
+			return append(newargs, args[i:]...)
+		}
+		if len(a) > 2 && a[2] != '=' && a[0] == '-' && strings.IndexByte("MCBlXUSG", a[1]) >= 0 {
+			a = a[:2] + "=" + a[2:]
+		}
+		newargs = append(newargs, a)
+	}
+	return newargs
+}
+
+// A flag for --stat[=<width>[,<name-width>[,<count>]]].
+type statValue git.DiffCommonOptions
+
+func (s *statValue) IsBoolFlag() bool { return true }
+
+func (s *statValue) Set(val string) error {
+	s.Stat = val != "false"
+	if val == "true" || val == "false" {
+		return nil
+	}
+	for i, v := range strings.SplitN(val, ",", 3) {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid --stat value: %v", val)
+		}
+		switch i {
+		case 0:
+			s.StatWidth = n
+		case 1:
+			s.StatNameWidth = n
+		case 2:
+			s.StatCount = n
+		}
+	}
+	return nil
+}
+
+func (s *statValue) String() string { return "" }
+
+// A flag for --dirstat[=<param1,param2,...>] and its aliases, which adds
+// its own params before any given with the flag.
+type dirStatValue struct {
+	options *git.DiffCommonOptions
+	params  string
+}
+
+func (d *dirStatValue) IsBoolFlag() bool { return true }
+
+func (d *dirStatValue) Set(val string) error {
+	d.options.DirStat = true
+	params := []string{d.options.DirStatParams, d.params}
+	if val != "true" {
+		params = append(params, val)
+	}
+	d.options.DirStatParams = strings.Trim(strings.Join(params, ","), ",")
+	return nil
+}
+
+func (d *dirStatValue) String() string { return "" }
+
+// addDiffFormatFlags adds the flags which select the summary formats of
+// diff output to flags, and returns a function to finish setting up
+// options and check that they're compatible after the flags are parsed. -X takes its parameters without
+// an "=", so the arguments must be passed through adjustDiffArgs.
+func addDiffFormatFlags(flags *flag.FlagSet, options *git.DiffCommonOptions) func() error {
+	flags.Var((*statValue)(options), "stat", "Generate a diffstat, optionally with the <width>,<name-width>,<count> given")
+	flags.IntVar(&options.StatWidth, "stat-width", 0, "Limit the diffstat to <width> columns")
+	flags.IntVar(&options.StatNameWidth, "stat-name-width", 0, "Limit the file names in the diffstat to <width> columns")
+	flags.IntVar(&options.StatGraphWidth, "stat-graph-width", 0, "Limit the graph in the diffstat to <width> columns")
+	flags.IntVar(&options.StatCount, "stat-count", 0, "Only show the first <count> files in the diffstat")
+	flags.BoolVar(&options.NumStat, "numstat", false, "Show the number of added and deleted lines in a machine friendly format")
+	flags.BoolVar(&options.ShortStat, "shortstat", false, "Only show the last line of the diffstat")
+	flags.Var(&dirStatValue{options: options}, "dirstat", "Show the distribution of changes between directories, with comma separated parameters")
+	flags.Var(&dirStatValue{options: options}, "X", "Alias of --dirstat")
+	flags.Var(&dirStatValue{options: options, params: "files"}, "dirstat-by-file", "Alias of --dirstat=files")
+	flags.Var(&dirStatValue{options: options, params: "cumulative"}, "cumulative", "Alias of --dirstat=cumulative")
+	flags.BoolVar(&options.NameOnly, "name-only", false, "Only show the names of changed files")
+	flags.BoolVar(&options.NameStatus, "name-status", false, "Only show the names and statuses of changed files")
+	flags.BoolVar(&options.NullTerminate, "z", false, "Separate fields and terminate lines with NULs")
+	return func() error {
+		// Like git, the diffstat options imply --stat.
+		flags.Visit(func(f *flag.Flag) {
+			if strings.HasPrefix(f.Name, "stat-") {
+				options.Stat = true
+			}
+		})
+		if options.NameOnly && options.NameStatus {
+			return fmt.Errorf("--name-only and --name-status are mutually exclusive")
+		}
+		return nil
+	}
+}
+
+// addPatchStyleFlags adds the flags which change how a patch is shown,
+// such as --color and --word-diff, to flags. It returns a function to
+// finish setting up options after the flags are parsed, which uses the
+// config for anything that wasn't given.
+func addPatchStyleFlags(flags *flag.FlagSet, options *git.DiffCommonOptions) func(c *git.Client) error {
+	var color, colorMoved, wordDiff, wordRegex, colorWords, wsHighlight string
+	flags.Var(newOptionalStringValue(&color, "always"), "color", "Colour the patch (always, never or auto)")
+	nocolor := flags.Bool("no-color", false, "Turn off colour")
+	flags.Var(newOptionalStringValue(&colorMoved, "default"), "color-moved", "Colour moved lines differently (no, default, plain, blocks, zebra or dimmed-zebra)")
+	nocolormoved := flags.Bool("no-color-moved", false, "Turn off detection of moved lines")
+	flags.Var(newOptionalStringValue(&wordDiff, "plain"), "word-diff", "Show a word diff (color, plain, porcelain or none)")
+	flags.StringVar(&wordRegex, "word-diff-regex", "", "Use <regex> to find words, implying --word-diff")
+	flags.Var(newOptionalStringValue(&colorWords, ""), "color-words", "Alias of --word-diff=color, optionally with --word-diff-regex=<regex>")
+	flags.StringVar(&wsHighlight, "ws-error-highlight", "", "Highlight whitespace errors in the comma separated kinds of lines (old, new, context, all, none or default)")
+	flags.BoolVar(&options.FullIndex, "full-index", false, "Show the full object names in the index line of a patch")
+	flags.BoolVar(&options.Binary, "binary", false, "Output a binary patch that can be applied, implying --patch")
+	return func(c *git.Client) error {
+		if options.Binary {
+			options.Patch = true
+		}
+		flags.Visit(func(f *flag.Flag) {
+			if f.Name == "color-words" {
+				wordDiff = "color"
+				if colorWords != "" {
+					wordRegex = colorWords
+				}
+			}
+		})
+		switch wordDiff {
+		case "", "none", "plain", "porcelain":
+		case "color":
+			// Like git, a coloured word diff turns on colour.
+			color = "always"
+		default:
+			return fmt.Errorf("bad --word-diff argument: %v", wordDiff)
+		}
+		if wordRegex != "" && wordDiff == "" {
+			wordDiff = "plain"
+		}
+		if wordRegex == "" {
+			wordRegex = c.GetConfig("diff.wordRegex")
+		}
+		if wordRegex != "" {
+			re, err := regexp.Compile("(?m)" + wordRegex)
+			if err != nil {
+				return fmt.Errorf("invalid regular expression: %v", wordRegex)
+			}
+			options.WordDiffRegex = re
+		}
+		options.WordDiff = wordDiff
+
+		if *nocolor {
+			color = "never"
+		}
+		useColor, err := git.WantColor(c, color, "color.diff")
+		if err != nil {
+			return err
+		}
+		options.Color = useColor
+
+		if *nocolormoved {
+			colorMoved = "no"
+		}
+		if colorMoved == "" {
+			switch cfg := c.GetConfig("diff.colorMoved"); cfg {
+			case "true":
+				colorMoved = "default"
+			case "false":
+				colorMoved = "no"
+			default:
+				colorMoved = cfg
+			}
+		}
+		switch colorMoved {
+		case "", "no", "default", "plain", "blocks", "zebra", "dimmed-zebra":
+			options.ColorMoved = colorMoved
+		default:
+			return fmt.Errorf("bad --color-moved argument: %v", colorMoved)
+		}
+
+		if wsHighlight == "" {
+			wsHighlight = c.GetConfig("diff.wsErrorHighlight")
+		}
+		if wsHighlight != "" {
+			options.WhitespaceErrorHighlight = strings.Split(wsHighlight, ",")
+			for _, kind := range options.WhitespaceErrorHighlight {
+				switch kind {
+				case "old", "new", "context", "all", "none", "default":
+				default:
+					return fmt.Errorf("unknown value after ws-error-highlight=%v", kind)
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// addCommitPatchFlags adds the flags which select the patch shown for each
+// commit by show and log, and how it's shown, to flags. It returns a
+// function to finish setting up options after the flags are parsed, which
+// shows a patch by default if defaultPatch is set and no other diff
+// output was selected.
+func addCommitPatchFlags(flags *flag.FlagSet, options *git.DiffCommonOptions) func(c *git.Client, defaultPatch bool) error {
+	patch := flags.Bool("patch", false, "Show the patch of each commit")
+	p := flags.Bool("p", false, "Alias of --patch")
+	u := flags.Bool("u", false, "Alias of --patch")
+	nopatch := flags.Bool("no-patch", false, "Suppress all diff output")
+	s := flags.Bool("s", false, "Alias of --no-patch")
+	flags.IntVar(&options.NumContextLines, "unified", 3, "Generate <n> lines of context, implying --patch")
+	flags.IntVar(&options.NumContextLines, "U", 3, "Alias of --unified")
+	patchStyle := addPatchStyleFlags(flags, options)
+	return func(c *git.Client, defaultPatch bool) error {
+		if err := patchStyle(c); err != nil {
+			return err
+		}
+		flags.Visit(func(f *flag.Flag) {
+			if f.Name == "unified" || f.Name == "U" {
+				options.Patch = true
+			}
+		})
+		if *patch || *p || *u || (defaultPatch && !options.HasDiffOutput()) {
+			options.Patch = true
+		}
+		if *nopatch || *s {
+			options.Patch, options.Raw, options.Stat, options.NumStat, options.ShortStat = false, false, false, false, false
+			options.DirStat, options.NameOnly, options.NameStatus = false, false, false
+		}
+		return nil
+	}
+}
+
+// The values of --diff-merges, and the way that each of them shows merges.
+var diffMergesModes = map[string]string{
+	"off":            "off",
+	"none":           "off",
+	"1":              "first-parent",
+	"first-parent":   "first-parent",
+	"separate":       "separate",
+	"m":              "separate",
+	"on":             "separate",
+	"c":              "combined",
+	"combined":       "combined",
+	"cc":             "dense-combined",
+	"dense-combined": "dense-combined",
+	"r":              "remerge",
+	"remerge":        "remerge",
+}
+
+// A flag which selects how merges are shown. They all set the same option,
+// so the last one wins. Mode is the mode of a boolean flag such as --cc,
+// or empty for --diff-merges=<mode>.
+type diffMergesValue struct {
+	options    *git.DiffCommonOptions
+	mode       string
+	implyPatch *bool
+	imply      bool
+}
+
+func (d *diffMergesValue) IsBoolFlag() bool { return d.mode != "" }
+
+func (d *diffMergesValue) Set(val string) error {
+	mode := d.mode
+	if mode == "" {
+		m, ok := diffMergesModes[val]
+		if !ok {
+			return fmt.Errorf("invalid value for '--diff-merges': '%v'", val)
+		}
+		mode = m
+	}
+	d.options.DiffMerges = mode
+	*d.implyPatch = d.imply
+	return nil
+}
+
+func (d *diffMergesValue) String() string { return "" }
+
+// addDiffMergesFlags adds the flags which select how the changes made by
+// merges are shown to flags. The function returned must be called after
+// parsing them, with the default way of showing merges. Like git, -c, --cc,
+// --remerge-diff and --diff-merges show a patch if no other format is
+// selected, but -m doesn't.
+func addDiffMergesFlags(flags *flag.FlagSet, options *git.DiffCommonOptions) func(defaultMode string) {
+	implyPatch := false
+	for _, f := range []struct {
+		name, mode string
+		imply      bool
+		usage      string
+	}{
+		{"c", "combined", true, "Show a combined diff of merges against all of their parents"},
+		{"cc", "dense-combined", true, "Show a combined diff of merges, without the hunks which only come from one parent"},
+		{"m", "separate", false, "Show the diffs of merges against each of their parents"},
+		{"remerge-diff", "remerge", true, "Show the diffs of merges against merging their parents again"},
+		{"no-diff-merges", "off", false, "Don't show the diffs of merges"},
+		{"diff-merges", "", true, "Show the diffs of merges as <mode>"},
+	} {
+		flags.Var(&diffMergesValue{options: options, mode: f.mode, implyPatch: &implyPatch, imply: f.imply}, f.name, f.usage)
+	}
+	return func(defaultMode string) {
+		if options.DiffMerges == "" {
+			options.DiffMerges = defaultMode
+		}
+		if implyPatch && !options.HasDiffOutput() {
+			options.Patch = true
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/driusan/dgit/git"
+)
+
+func Describe(c *git.Client, args []string) error {
+	flags := newFlagSet("describe")
+	opts := git.DescribeOptions{}
+
+	flags.BoolVar(&opts.All, "all", false, "Use any ref, not just tags")
+	flags.BoolVar(&opts.Tags, "tags", false, "Use lightweight tags in addition to annotated tags")
+	flags.Var(NewMultiStringValue(&opts.Match), "match", "Only consider tags matching the glob pattern")
+	flags.Var(NewMultiStringValue(&opts.Exclude), "exclude", "Do not consider tags matching the glob pattern")
+	flags.IntVar(&opts.Abbrev, "abbrev", 7, "Use at least n hex digits for the abbreviated commit")
+	flags.BoolVar(&opts.Long, "long", false, "Always use the long format, even for exact matches")
+	flags.IntVar(&opts.Candidates, "candidates", 10, "Consider up to n candidate tags")
+	exact := flags.Bool("exact-match", false, "Only output exact matches (alias of --candidates=0)")
+	flags.BoolVar(&opts.Always, "always", false, "Show an abbreviated commit as a fallback")
+	flags.BoolVar(&opts.FirstParent, "first-parent", false, "Only follow the first parent of merge commits")
+	flags.Var(newOptionalStringValue(&opts.Dirty, "-dirty"), "dirty", "Append mark (default \"-dirty\") if the working tree is modified")
+
+	flags.Parse(args)
+	if *exact {
+		opts.Candidates = 0
+	}
+
+	var commits []git.Commitish
+	for _, arg := range flags.Args() {
+		cmt, err := git.RevParseCommitish(c, &git.RevParseOptions{}, arg)
+		if err != nil {
+			return err
+		}
+		commits = append(commits, cmt)
+	}
+	names, err := git.Describe(c, opts, commits)
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		fmt.Println(n)
+	}
+	return nil
+}
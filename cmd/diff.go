@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
 
 	"github.com/driusan/dgit/git"
 )
@@ -25,12 +26,27 @@ func Diff(c *git.Client, args []string) error {
 	flags.BoolVar(&cached, "cached", false, "Display changes staged for commit")
 	flags.BoolVar(&options.NoIndex, "no-index", false, "Use diff to display difference between files on the filesystem")
 
+	rawargs := args
 	args, err := parseCommonDiffFlags(c, &options.DiffCommonOptions, true, flags, args)
+	if err != nil {
+		return err
+	}
 
 	if staged || cached {
 		options.Staged = true
 	}
 
+	if !options.NoIndex {
+		// The flag package strips a -- before any other argument.
+		doubledash := len(rawargs) > len(args) && rawargs[len(rawargs)-len(args)-1] == "--"
+		revs, paths, err := splitDiffArgs(c, args, doubledash)
+		if err != nil {
+			return err
+		}
+		options.Revisions = revs
+		args = paths
+	}
+
 	files := make([]git.File, len(args), len(args))
 	for i := range args {
 		files[i] = git.File(args[i])
@@ -54,3 +70,54 @@ func Diff(c *git.Client, args []string) error {
 	}
 	return printDiffs(c, options.DiffCommonOptions, diffs)
 }
+
+// splitDiffArgs splits args into the revisions and paths to diff. Anything
+// before a -- is a revision and anything after it is a path. Without a --,
+// the paths start at the first argument which isn't a revision, and must
+// exist.
+func splitDiffArgs(c *git.Client, args []string, doubledash bool) (revs, paths []string, err error) {
+	if doubledash {
+		return nil, args, nil
+	}
+	for i, arg := range args {
+		if arg == "--" {
+			return args[:i], args[i+1:], nil
+		}
+	}
+	for i, arg := range args {
+		if !isDiffRevision(c, arg) {
+			paths = args[i:]
+			break
+		}
+		if git.File(arg).Exists() {
+			return nil, nil, fmt.Errorf("ambiguous argument '%v': both revision and filename\nUse '--' to separate paths from revisions", arg)
+		}
+		revs = append(revs, arg)
+	}
+	for _, p := range paths {
+		if !git.File(p).Exists() {
+			return nil, nil, fmt.Errorf("ambiguous argument '%v': unknown revision or path not in the working tree.\nUse '--' to separate paths from revisions", p)
+		}
+	}
+	return revs, paths, nil
+}
+
+// isDiffRevision returns whether arg is a revision, range, or blob that
+// can be diffed.
+func isDiffRevision(c *git.Client, arg string) bool {
+	ends := []string{arg}
+	if pos := strings.Index(arg, "..."); pos >= 0 {
+		ends = []string{arg[:pos], arg[pos+3:]}
+	} else if pos := strings.Index(arg, ".."); pos >= 0 {
+		ends = []string{arg[:pos], arg[pos+2:]}
+	}
+	for _, end := range ends {
+		if end == "" {
+			end = "HEAD"
+		}
+		if _, err := git.RevParsePath(c, &git.RevParseOptions{}, end); err != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -17,6 +17,9 @@ func DiffFiles(c *git.Client, args []string) error {
 	}
 	options := git.DiffFilesOptions{}
 	args, err := parseCommonDiffFlags(c, &options.DiffCommonOptions, false, flags, args)
+	if err != nil {
+		return err
+	}
 	files := make([]git.File, len(args), len(args))
 	for i := range args {
 		files[i] = git.File(args[i])
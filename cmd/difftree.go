@@ -3,6 +3,7 @@ package cmd
 import (
 	"flag"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/driusan/dgit/git"
@@ -27,9 +28,15 @@ func DiffTree(c *git.Client, args []string) error {
 
 	unified := flags.Int("unified", 3, "Generate <n> lines of context")
 	U := flags.Int("U", 3, "Alias of --unified")
-	flags.BoolVar(&options.Raw, "raw", true, "Generate the diff in raw format")
+	flags.BoolVar(&options.Raw, "raw", false, "Generate the diff in raw format")
 	flags.BoolVar(&options.Recurse, "r", false, "Recurse into subtrees")
 	flags.BoolVar(&options.Root, "root", false, "Diff the initial commit against /dev/null")
+	renames := addRenameFlags(flags, &options.DiffCommonOptions)
+	addPickaxeFlags(flags, &options.DiffCommonOptions)
+	abbrev := addAbbrevFlags(flags, &options.DiffCommonOptions)
+	checkFormat := addDiffFormatFlags(flags, &options.DiffCommonOptions)
+	patchStyle := addPatchStyleFlags(flags, &options.DiffCommonOptions)
+	diffMerges := addDiffMergesFlags(flags, &options.DiffCommonOptions)
 
 	adjustedArgs := []string{}
 	for _, a := range args {
@@ -40,14 +47,32 @@ func DiffTree(c *git.Client, args []string) error {
 		adjustedArgs = append(adjustedArgs, a)
 	}
 
-	flags.Parse(adjustedArgs)
+	flags.Parse(adjustDiffArgs(adjustedArgs))
+	renames(c, false)
+	abbrev(false)
 	args = flags.Args()
+	if err := checkFormat(); err != nil {
+		return err
+	}
+	if err := patchStyle(c); err != nil {
+		return err
+	}
 
 	if *patch || *p || *u {
 		options.Patch = true
 	}
+	if !options.HasDiffOutput() {
+		// A dense combined diff is only shown as a patch.
+		if options.DiffMerges == "dense-combined" {
+			options.Patch = true
+		} else {
+			options.Raw = true
+		}
+	}
+	diffMerges("off")
 	if *nopatch || *s {
 		options.Patch = false
+		options.Raw = false
 	}
 
 	if unified != nil && U != nil && *unified != *U {
@@ -81,11 +106,34 @@ func DiffTree(c *git.Client, args []string) error {
 		args = args[1:]
 		onetree = true
 	}
+	if onetree {
+		if c1, ok := treeish.(git.Commitish); ok {
+			cmt, err := c1.CommitID(c)
+			if err != nil {
+				return err
+			}
+			parents, err := cmt.Parents(c)
+			if err != nil {
+				return err
+			}
+			if len(parents) > 1 {
+				// Merges are only shown if --diff-merges or
+				// one of its aliases was given.
+				_, err := git.WriteMergeDiff(c, options.DiffCommonOptions, cmt, args, os.Stdout, func(*git.CommitID) error {
+					printCommitID(cmt, options.NullTerminate)
+					return nil
+				})
+				return err
+			}
+		}
+	}
 	diffs, err := git.DiffTree(c, &options, treeish, treeish2, args)
 	if err != nil {
 		return err
 	}
-	if onetree {
+	// Like git, the commit isn't shown if it has no changes, such as
+	// when they're all filtered out by -S or -G.
+	if onetree && len(diffs) > 0 {
 		if c1, ok := treeish.(git.Commitish); ok {
 			cmt, err := c1.CommitID(c)
 			if err != nil {
@@ -95,12 +143,19 @@ func DiffTree(c *git.Client, args []string) error {
 				// so that we investigate
 				panic(err)
 			}
-			fmt.Println(cmt)
+			printCommitID(cmt, options.NullTerminate)
 		}
 	}
 
-	for _, diff := range diffs {
-		fmt.Printf("%v\n", diff)
+	return git.GeneratePatch(c, options.DiffCommonOptions, diffs, nil)
+}
+
+// printCommitID prints the id of the commit whose changes are shown, which
+// is terminated by a NUL with -z.
+func printCommitID(cmt git.CommitID, nul bool) {
+	if nul {
+		fmt.Printf("%v\x00", cmt)
+	} else {
+		fmt.Println(cmt)
 	}
-	return err
 }
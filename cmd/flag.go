@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
 )
 
 // A string value compatible with a flag var
@@ -47,6 +48,29 @@ func (s *multiStringValue) Get() interface{} { return []string(*s) }
 
 func (s *multiStringValue) String() string { return fmt.Sprintf("%v\n", *s) }
 
+// A boolean flag which counts the number of times that it was given, for
+//  options such as blame -C which mean more when repeated.
+type countValue int
+
+func newCountValue(p *int) *countValue {
+	return (*countValue)(p)
+}
+
+func (v *countValue) IsBoolFlag() bool { return true }
+
+func (v *countValue) Set(val string) error {
+	if val == "false" {
+		*v = 0
+	} else {
+		*v++
+	}
+	return nil
+}
+
+func (v *countValue) Get() interface{} { return int(*v) }
+
+func (v *countValue) String() string { return fmt.Sprintf("%d", int(*v)) }
+
 // A string value that indicates that it is not yet implemented if it's used.
 type notimplStringValue string
 
@@ -80,3 +104,74 @@ func (b *notimplBoolValue) Get() interface{} { return bool(*b) }
 func (b *notimplBoolValue) String() string { return "false" }
 
 func (b *notimplBoolValue) IsBoolFlag() bool { return true }
+
+// A string value which may be passed either as a boolean flag (--flag)
+//  or with an explicit value (--flag=value). When passed as a
+//  boolean, the value is set to the default.
+type optionalStringValue struct {
+	val *string
+	def string
+}
+
+func newOptionalStringValue(p *string, def string) *optionalStringValue {
+	return &optionalStringValue{p, def}
+}
+
+func (s *optionalStringValue) IsBoolFlag() bool { return true }
+
+func (s *optionalStringValue) Set(val string) error {
+	if val == "true" {
+		*s.val = s.def
+	} else if val == "false" {
+		*s.val = ""
+	} else {
+		*s.val = val
+	}
+	return nil
+}
+
+func (s *optionalStringValue) Get() interface{} {
+	if s.val == nil {
+		return ""
+	}
+	return *s.val
+}
+
+func (s *optionalStringValue) String() string {
+	if s.val == nil {
+		return ""
+	}
+	return *s.val
+}
+
+// lastArgDefault rewrites args so that any of the options in names which
+//  are given without an "=value" use the next argument as their value,
+//  or def if the option is the last argument or followed by another
+//  option. This mimics the way that
+//  git parses options such as --contains with an optional argument.
+func lastArgDefault(args []string, def string, names ...string) []string {
+	var newargs []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(newargs, args[i:]...)
+		}
+		matched := false
+		for _, name := range names {
+			if arg == "-"+name || arg == "--"+name {
+				matched = true
+				break
+			}
+		}
+		switch {
+		case !matched:
+			newargs = append(newargs, arg)
+		case i == len(args)-1 || strings.HasPrefix(args[i+1], "-"):
+			newargs = append(newargs, arg+"="+def)
+		default:
+			newargs = append(newargs, arg+"="+args[i+1])
+			i++
+		}
+	}
+	return newargs
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"flag"
+	"strings"
 	"testing"
 )
 
@@ -78,3 +79,41 @@ func TestNotImplBoolValue(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestOptionalStringValue(t *testing.T) {
+	flags := flag.NewFlagSet("test1", flag.ContinueOnError)
+	v := ""
+	flags.Var(newOptionalStringValue(&v, "-dirty"), "dirty", "")
+
+	if err := flags.Parse([]string{"--dirty"}); err != nil {
+		t.Fatal(err)
+	}
+	if v != "-dirty" {
+		t.Errorf("Unexpected value for --dirty: got %v want -dirty", v)
+	}
+
+	if err := flags.Parse([]string{"--dirty=-modified"}); err != nil {
+		t.Fatal(err)
+	}
+	if v != "-modified" {
+		t.Errorf("Unexpected value for --dirty: got %v want -modified", v)
+	}
+}
+
+func TestLastArgDefault(t *testing.T) {
+	tests := []struct {
+		args, want []string
+	}{
+		{[]string{"--merged"}, []string{"--merged=HEAD"}},
+		{[]string{"--merged", "foo"}, []string{"--merged=foo"}},
+		{[]string{"--merged", "-v"}, []string{"--merged=HEAD", "-v"}},
+		{[]string{"--merged=bar", "foo"}, []string{"--merged=bar", "foo"}},
+		{[]string{"-v", "--", "--merged"}, []string{"-v", "--", "--merged"}},
+	}
+	for i, tc := range tests {
+		got := lastArgDefault(tc.args, "HEAD", "merged")
+		if strings.Join(got, " ") != strings.Join(tc.want, " ") {
+			t.Errorf("Test %d: got %v want %v", i, got, tc.want)
+		}
+	}
+}
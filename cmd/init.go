@@ -23,6 +23,7 @@ func Init(c *git.Client, args []string) error {
 	flags.BoolVar(&opts.Bare, "bare", false, "Create bare repository")
 	flags.BoolVar(&opts.Quiet, "quiet", false, "Only print errors or warnings")
 	flags.BoolVar(&opts.Quiet, "q", false, "Alias of --quiet")
+	flags.StringVar(&opts.RefFormat, "ref-format", "files", "Specify the ref storage format (files or reftable)")
 	var template string
 	flags.StringVar(&template, "template", "", "Specify the template directory that will be used")
 
@@ -1,13 +1,16 @@
 package cmd
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
 
 	"github.com/driusan/dgit/git"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 func Log(c *git.Client, args []string) error {
@@ -19,21 +22,41 @@ func Log(c *git.Client, args []string) error {
 		flags.PrintDefaults()
 	}
 
-	flags.Var(newNotimplBoolValue(), "follow", "Not implemented")
-	flags.Var(newNotimplBoolValue(), "no-decorate", "Not implemented")
-	flags.Var(newNotimplStringValue(), "decorate", "Not implemented")
-	flags.Var(newNotimplStringValue(), "decorate-refs", "Not implemented")
-	flags.Var(newNotimplStringValue(), "decorate-refs-exclude", "Not implemented")
+	var follow, fullDiff, graph, reverse bool
+	flags.BoolVar(&follow, "follow", false, "Continue listing the history of a single file beyond renames")
+	flags.BoolVar(&graph, "graph", false, "Draw the history as a graph to the left of the commits")
+	flags.BoolVar(&reverse, "reverse", false, "Show the commits in reverse order")
+	var decorate string
+	var noDecorate bool
+	var decorateOpts git.DecorateOptions
+	flags.Var(newOptionalStringValue(&decorate, "short"), "decorate", "Show the names of the refs pointing to the commits (short, full, auto or no)")
+	flags.BoolVar(&noDecorate, "no-decorate", false, "Don't show the names of the refs pointing to the commits")
+	flags.Var(NewMultiStringValue(&decorateOpts.Refs), "decorate-refs", "Only decorate the commits with the refs matching <pattern>")
+	flags.Var(NewMultiStringValue(&decorateOpts.ExcludeRefs), "decorate-refs-exclude", "Don't decorate the commits with the refs matching <pattern>")
+	flags.BoolVar(&decorateOpts.ClearDecorations, "clear-decorations", false, "Decorate the commits with all refs, rather than only the branches, tags and HEAD")
 	flags.Var(newNotimplBoolValue(), "source", "Not implemented")
 	flags.Var(newNotimplBoolValue(), "use-mailmap", "Not implemented")
-	flags.Var(newNotimplBoolValue(), "full-diff", "Not implemented")
+	flags.BoolVar(&fullDiff, "full-diff", false, "Show the full diff of commits limited to paths")
 	flags.Var(newNotimplStringValue(), "log-size", "Not implemented")
 	flags.Var(newNotimplStringValue(), "L", "Not implemented")
 	maxCount := -1
 	flags.IntVar(&maxCount, "n", -1, "Limit the number of commits.")
 	flags.IntVar(&maxCount, "max-count", -1, "Alias for -n")
-	format := "medium" // The default
-	flags.StringVar(&format, "format", "medium", "Pretty print the commit logs")
+	var logOpts git.LogOptions
+	prettyGiven := addPrettyFlags(flags, &logOpts.PrettyOptions)
+	opts := git.RevListOptions{Quiet: true}
+	flags.BoolVar(&opts.All, "all", false, "Show the history of all of the refs and HEAD")
+	addRevWalkFlags(flags, &opts)
+	commitFilters := addCommitFilterFlags(flags, &opts)
+	notesRefs := addNotesFlags(flags)
+	diffOpts := &logOpts.DiffCommonOptions
+	flags.BoolVar(&diffOpts.Raw, "raw", false, "Show the changes made by each commit in raw format")
+	renames := addRenameFlags(flags, diffOpts)
+	addPickaxeFlags(flags, diffOpts)
+	abbrev := addAbbrevFlags(flags, diffOpts)
+	checkFormat := addDiffFormatFlags(flags, diffOpts)
+	patchFlags := addCommitPatchFlags(flags, diffOpts)
+	diffMerges := addDiffMergesFlags(flags, diffOpts)
 
 	adjustedArgs := []string{}
 	for i, a := range args {
@@ -55,54 +78,349 @@ func Log(c *git.Client, args []string) error {
 		adjustedArgs = append(adjustedArgs, a)
 	}
 
+	adjustedArgs = adjustDiffArgs(adjustedArgs)
 	flags.Parse(adjustedArgs)
-
-	if flags.NArg() > 1 {
-		fmt.Fprintf(flag.CommandLine.Output(), "Paths are not yet implemented, just the revision")
-		flags.Usage()
-		os.Exit(2)
+	commitFilters()
+	renames(c, true)
+	abbrev(true)
+	diffOpts.PickaxeIgnoreCase = opts.RegexpIgnoreCase
+	if err := checkFormat(); err != nil {
+		return err
 	}
-
-	var commit git.Commitish
-	var err error
-	if flags.NArg() == 0 {
-		commit, err = git.RevParseCommitish(c, &git.RevParseOptions{}, "HEAD")
+	// --first-parent shows the changes made by merges to their first
+	// parent.
+	if opts.FirstParent {
+		diffMerges("first-parent")
+		if diffOpts.DiffMerges == "separate" {
+			diffOpts.DiffMerges = "first-parent"
+		}
 	} else {
-		commit, err = git.RevParseCommitish(c, &git.RevParseOptions{}, flags.Arg(0))
+		diffMerges("off")
+	}
+	// Like git, showing the diffs of merges against their parents
+	// follows all of the parents when limiting to paths.
+	if diffOpts.DiffMerges == "separate" || diffOpts.DiffMerges == "first-parent" {
+		opts.FullHistory = true
+	}
+	if err := patchFlags(c, false); err != nil {
+		return err
+	}
+	if graph && reverse {
+		return fmt.Errorf("options '--reverse' and '--graph' cannot be used together")
+	}
+	if diffOpts.PickaxeGrep != "" && diffOpts.PickaxeRegex {
+		return fmt.Errorf("options '-G' and '--pickaxe-regex' cannot be used together")
+	}
+	logOpts.Graph = graph
+	// Like git, the notes are shown by default unless another format
+	// was given, or if it shows them.
+	logOpts.NotesRefs = notesRefs(c, !prettyGiven() || logOpts.UsesNotes(c))
+	if noDecorate {
+		decorate = "no"
+	}
+	if full, ok, err := decorationStyle(c, decorate); err != nil {
+		return err
+	} else if ok {
+		decorateOpts.Full = full
+		if logOpts.Decorations, err = git.LoadDecorations(c, decorateOpts); err != nil {
+			return err
+		}
 	}
+
+	includes, excludes, paths, err := parseRevWalkArgs(c, adjustedArgs, flags.Args())
 	if err != nil {
 		return err
 	}
+	if len(includes) == 0 && !opts.All {
+		head, err := git.RevParseCommitish(c, &git.RevParseOptions{}, "HEAD")
+		if err != nil {
+			return err
+		}
+		includes = []git.Commitish{head}
+	}
 
-	opts := git.RevListOptions{Quiet: true}
-	if maxCount >= 0 {
+	// The changes shown are limited to the paths, unless the full diff
+	// was requested.
+	var diffPaths []string
+	if !fullDiff {
+		for _, p := range paths {
+			diffPaths = append(diffPaths, p.String())
+		}
+	}
+
+	// --follow can't limit the walk to the path, since it changes
+	// when the file was renamed, so the commits which don't change
+	// it are skipped while they're printed instead, and counted here.
+	var followPath git.IndexPath
+	if follow {
+		if len(paths) != 1 {
+			return fmt.Errorf("--follow requires exactly one pathspec")
+		}
+		if followPath, err = paths[0].IndexPath(c); err != nil {
+			return err
+		}
+	} else {
+		opts.Paths = paths
+	}
+	if maxCount >= 0 && !follow && !diffOpts.HasPickaxe() {
 		mc := uint(maxCount)
 		opts.MaxCount = &mc
 	}
 
-	var commitPrinter func(s git.Sha1) error
+	lw, err := git.NewLogWriter(c, logOpts, os.Stdout)
+	if err != nil {
+		return err
+	}
+	// printHeader prints the header of a commit. If from is set, it's
+	// the header of a merge's diff against that parent. If diff is set,
+	// the diff is written to lw.DiffWriter() after it.
+	printHeader := func(s git.Sha1, from *git.CommitID, diff bool) error {
+		return lw.WriteCommit(git.CommitID(s), from, diff)
+	}
+	commitPrinter := func(s git.Sha1) error {
+		return printHeader(s, nil, false)
+	}
 
-	if format == "medium" {
+	if diffOpts.HasDiffOutput() {
+		// Show the changes made by each commit after it. Merges are
+		// shown as selected by --diff-merges.
 		commitPrinter = func(s git.Sha1) error {
-			output, err := git.CommitID(s).FormatMedium(c)
+			parents, err := git.CommitID(s).Parents(c)
 			if err != nil {
 				return err
 			}
-			fmt.Printf("%s", output)
-			return nil
+			if len(parents) > 1 {
+				shown, err := git.WriteMergeDiff(c, *diffOpts, git.CommitID(s), diffPaths, lw.DiffWriter(), func(from *git.CommitID) error {
+					return printHeader(s, from, true)
+				})
+				if err != nil || shown {
+					return err
+				}
+				return printHeader(s, nil, false)
+			}
+			diffs, err := git.CommitDiff(c, *diffOpts, git.CommitID(s), diffPaths)
+			if err != nil {
+				return err
+			}
+			// Like git, a commit without any changes is shown
+			// without a diff.
+			if err := printHeader(s, nil, len(diffs) > 0); err != nil || len(diffs) == 0 {
+				return err
+			}
+			return git.GeneratePatch(c, *diffOpts, diffs, lw.DiffWriter())
 		}
-	} else if strings.HasPrefix(format, "format:") {
+	}
+
+	if follow {
+		commitPrinter = followPrinter(c, *diffOpts, followPath, maxCount, printHeader, lw.DiffWriter())
+	} else if diffOpts.HasPickaxe() {
+		// The commits whose changes aren't found by -S or -G are
+		// skipped while they're printed, so they're counted here.
+		printer := commitPrinter
+		printed := 0
 		commitPrinter = func(s git.Sha1) error {
-			output, err := git.CommitID(s).Format(c, format[7:])
-			if err != nil {
+			if maxCount >= 0 && printed >= maxCount {
+				return errLogDone
+			}
+			found, err := pickaxeFound(c, *diffOpts, git.CommitID(s), diffPaths)
+			if err != nil || !found {
 				return err
 			}
-			fmt.Printf("%s\n", output)
+			printed++
+			return printer(s)
+		}
+	}
+	switch {
+	case graph:
+		// The graph is drawn from the parents of each commit which
+		// are shown, and it needs to know about each commit walked
+		// even if it isn't shown.
+		err = git.RevListParentsCallback(c, opts, includes, excludes, func(cmt git.CommitID, parents []git.CommitID) error {
+			lw.Update(cmt, parents)
+			return commitPrinter(git.Sha1(cmt))
+		})
+	case reverse:
+		var commits []git.Sha1
+		err = git.RevListCallback(c, opts, includes, excludes, func(s git.Sha1) error {
+			commits = append(commits, s)
 			return nil
+		})
+		for i := len(commits) - 1; i >= 0 && err == nil; i-- {
+			err = commitPrinter(commits[i])
 		}
-	} else {
-		return fmt.Errorf("Format %s is not supported\n", format)
+	default:
+		err = git.RevListCallback(c, opts, includes, excludes, commitPrinter)
+	}
+	if err == errLogDone {
+		return nil
 	}
+	return err
+}
 
-	return git.RevListCallback(c, opts, []git.Commitish{commit}, nil, commitPrinter)
+// decorationStyle returns whether the commits shown by log are decorated
+// and whether the decorations are the full names of the refs, from the
+// --decorate option or the log.decorate config. They're decorated by
+// default when the output is a terminal.
+func decorationStyle(c *git.Client, decorate string) (full bool, ok bool, err error) {
+	if decorate == "" {
+		decorate = c.GetConfig("log.decorate")
+	}
+	switch strings.ToLower(decorate) {
+	case "", "auto":
+		return false, terminal.IsTerminal(int(os.Stdout.Fd())), nil
+	case "short", "true", "yes", "on", "1":
+		return false, true, nil
+	case "full":
+		return true, true, nil
+	case "no", "false", "off", "0":
+		return false, false, nil
+	}
+	return false, false, fmt.Errorf("invalid --decorate option: %s", decorate)
+}
+
+// errLogDone stops walking the history once log has printed as many
+// commits as it was asked for.
+var errLogDone = errors.New("log done")
+
+// followPrinter returns a function to print the commits which change the
+// file path for log --follow, following it across renames, until
+// maxCount commits were printed if it isn't negative. Merges aren't
+// printed.
+func followPrinter(c *git.Client, opts git.DiffCommonOptions, path git.IndexPath, maxCount int, printHeader func(s git.Sha1, from *git.CommitID, diff bool) error, w io.Writer) func(git.Sha1) error {
+	printed := 0
+	return func(s git.Sha1) error {
+		if maxCount >= 0 && printed >= maxCount {
+			return errLogDone
+		}
+		parents, err := git.CommitID(s).Parents(c)
+		if err != nil || len(parents) > 1 {
+			return err
+		}
+		diffs, next, err := git.FollowDiff(c, opts, git.CommitID(s), path)
+		if err != nil || len(diffs) == 0 {
+			return err
+		}
+		path = next
+		printed++
+		if err := printHeader(s, nil, opts.HasDiffOutput()); err != nil {
+			return err
+		}
+		if !opts.HasDiffOutput() {
+			return nil
+		}
+		return git.GeneratePatch(c, opts, diffs, w)
+	}
+}
+
+// pickaxeFound returns whether any of the changes made by cmt to paths are
+// found by the -S or -G options in opts. Like git, the changes made by
+// merges are only searched when they're shown against their parents.
+func pickaxeFound(c *git.Client, opts git.DiffCommonOptions, cmt git.CommitID, paths []string) (bool, error) {
+	parents, err := cmt.Parents(c)
+	if err != nil {
+		return false, err
+	}
+	if len(parents) <= 1 {
+		diffs, err := git.CommitDiff(c, opts, cmt, paths)
+		return len(diffs) > 0, err
+	}
+	switch opts.DiffMerges {
+	case "first-parent":
+		parents = parents[:1]
+	case "separate":
+	default:
+		return false, nil
+	}
+	for _, p := range parents {
+		diffs, err := git.DiffTree(c, &git.DiffTreeOptions{DiffCommonOptions: opts, Recurse: true}, p, cmt, paths)
+		if err != nil || len(diffs) > 0 {
+			return len(diffs) > 0, err
+		}
+	}
+	return false, nil
+}
+
+// prettyValue is the value of --pretty, --format or --oneline, which select
+// the format that commits are shown in.
+type prettyValue struct {
+	opts  *git.PrettyOptions
+	given *bool
+
+	// The format when the flag is given without a value, if it can be.
+	def string
+
+	// Whether the flag abbreviates the commit ids, for --oneline.
+	abbrev bool
+}
+
+func (v prettyValue) IsBoolFlag() bool { return v.def != "" }
+
+func (v prettyValue) Set(s string) error {
+	switch {
+	case v.def != "" && s == "true":
+		s = v.def
+	case s == "":
+		// An empty --format shows nothing for each commit.
+		s = "tformat:"
+	}
+	v.opts.Format, *v.given = s, true
+	if v.abbrev {
+		v.opts.AbbrevCommit = true
+	}
+	return nil
+}
+
+func (v prettyValue) String() string {
+	if v.opts == nil {
+		return ""
+	}
+	return v.opts.Format
+}
+
+// abbrevCommitValue is the value of --abbrev-commit and --no-abbrev-commit.
+type abbrevCommitValue struct {
+	abbrev *bool
+	val    bool
+}
+
+func (v abbrevCommitValue) IsBoolFlag() bool { return true }
+
+func (v abbrevCommitValue) Set(s string) error {
+	*v.abbrev = v.val
+	return nil
+}
+
+func (v abbrevCommitValue) String() string { return "" }
+
+// relativeDateValue is the value of --relative-date, which is the same as
+// --date=relative.
+type relativeDateValue struct {
+	mode *string
+}
+
+func (v relativeDateValue) IsBoolFlag() bool { return true }
+
+func (v relativeDateValue) Set(s string) error {
+	*v.mode = "relative"
+	return nil
+}
+
+func (v relativeDateValue) String() string { return "" }
+
+// addPrettyFlags adds the flags which select the format that commits are
+// shown in by log, show and rev-list to flags. It returns a function to
+// call after the flags are parsed, which returns whether a format was
+// given.
+func addPrettyFlags(flags *flag.FlagSet, opts *git.PrettyOptions) func() bool {
+	var given bool
+	flags.Var(prettyValue{opts: opts, given: &given, def: "medium"}, "pretty", "Show the commits in the given format (oneline, short, medium, full, fuller, reference, email, raw, format:<string> or tformat:<string>)")
+	flags.Var(prettyValue{opts: opts, given: &given}, "format", "Show the commits in the given format, like --pretty")
+	flags.Var(prettyValue{opts: opts, given: &given, def: "oneline", abbrev: true}, "oneline", "Show each commit on one line, with its abbreviated id and title")
+	flags.Var(abbrevCommitValue{&opts.AbbrevCommit, true}, "abbrev-commit", "Show the abbreviated commit ids")
+	flags.Var(abbrevCommitValue{&opts.AbbrevCommit, false}, "no-abbrev-commit", "Show the full commit ids")
+	flags.StringVar(&opts.DateMode, "date", "", "Show the dates in the given format (relative, local, iso, iso-strict, rfc, short, raw, human, unix, format:<strftime>)")
+	flags.Var(relativeDateValue{&opts.DateMode}, "relative-date", "Show the dates relative to the current time, like --date=relative")
+	return func() bool {
+		return given
+	}
 }
@@ -17,3 +17,14 @@ func BenchmarkLogHead(b *testing.B) {
 		}
 	}
 }
+
+func TestLogPickaxeRegexWithG(t *testing.T) {
+	c, err := git.NewClient("../.git", ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Log(c, []string{"-G", "foo", "--pickaxe-regex"})
+	if err == nil || err.Error() != "options '-G' and '--pickaxe-regex' cannot be used together" {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
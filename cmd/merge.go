@@ -4,14 +4,28 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/driusan/dgit/git"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 // These are merge flags that can be shared with other subcommands, such as pull
 func addSharedMergeFlags(flags *flag.FlagSet, options *git.MergeOptions) {
 	flags.BoolVar(&options.FastForwardOnly, "ff-only", false, "Only allow fast-forward merges")
 	flags.BoolVar(&options.NoFastForward, "no-ff", false, "Create a merge commit even when it's a fast-forward merge.")
+	flags.BoolVar(&options.NoCommit, "no-commit", false, "Perform the merge but don't commit the result")
+	flags.BoolVar(&options.Squash, "squash", false, "Update the index and work tree without creating a merge commit")
+	flags.StringVar((*string)(&options.Strategy), "strategy", "", "Use the given merge strategy (recursive, ort, ours, octopus or subtree)")
+	flags.StringVar((*string)(&options.Strategy), "s", "", "Alias of --strategy")
+	flags.Var(NewMultiStringValue(&options.StrategyOptions), "strategy-option", "Pass the option to the merge strategy")
+	flags.Var(NewMultiStringValue(&options.StrategyOptions), "X", "Alias of --strategy-option")
+}
+
+// Returns true if the user can be expected to interact with an editor,
+// using the same rule as git (both stdin and stdout are terminals.)
+func isInteractive() bool {
+	return terminal.IsTerminal(int(os.Stdin.Fd())) && terminal.IsTerminal(int(os.Stdout.Fd()))
 }
 
 func Merge(c *git.Client, args []string) error {
@@ -27,12 +41,38 @@ func Merge(c *git.Client, args []string) error {
 
 	// Add flags here that should only work when merge is invoked directly and
 	//  not from another subcommand such as pull.
-	abort := flag.Bool("abort", false, "Abort an in-progress merge")
+	abort := flags.Bool("abort", false, "Abort an in-progress merge")
+	cont := flags.Bool("continue", false, "Conclude an in-progress merge after resolving conflicts")
+	commit := flags.Bool("commit", false, "Commit the result of the merge (overrides --no-commit)")
+
+	var messages []string
+	flags.Var(NewMultiStringValue(&messages), "m", "Use the given message for the merge commit")
+
+	edit := flags.Bool("edit", false, "Invoke an editor to edit the merge message")
+	flags.BoolVar(edit, "e", false, "Alias of --edit")
+	noEdit := flags.Bool("no-edit", false, "Accept the merge message without invoking an editor")
 	flags.Parse(args)
 
+	if *commit {
+		options.NoCommit = false
+	}
+	if len(messages) > 0 {
+		options.Message = strings.Join(messages, "\n\n")
+	}
+	// Only invoke the editor by default if there's a user to interact
+	// with it and the message wasn't given on the command line.
+	options.NoEdit = *noEdit || (!*edit && (len(messages) > 0 || !isInteractive()))
+
 	if *abort {
 		return git.MergeAbort(c, options)
 	}
+	if *cont {
+		_, err := git.MergeContinue(c, options)
+		if err == git.NoGlobalConfig {
+			return nil
+		}
+		return err
+	}
 	merges := flags.Args()
 	if len(merges) < 1 {
 		flags.Usage()
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/driusan/dgit/git"
+)
+
+// MergeConflict is returned by MergeTree when the merge had conflicts,
+// after the result has been printed.
+var MergeConflict error = errors.New("Merge had conflicts")
+
+func MergeTree(c *git.Client, args []string) error {
+	flags := flag.NewFlagSet("merge-tree", flag.ExitOnError)
+	flags.SetOutput(flag.CommandLine.Output())
+	flags.Usage = func() {
+		flag.Usage()
+		fmt.Fprintf(flag.CommandLine.Output(), "\n\nOptions:\n")
+		flags.PrintDefaults()
+	}
+	var options git.MergeTreeOptions
+
+	flags.Bool("write-tree", true, "Write the result of the merge as a tree (the only supported mode)")
+	nameOnly := flags.Bool("name-only", false, "Only list the names of conflicted files, not their stages")
+	messages := flags.Bool("messages", false, "Print informational messages even if the merge is clean")
+	noMessages := flags.Bool("no-messages", false, "Do not print informational messages")
+	nul := flags.Bool("z", false, "Separate paths with NUL instead of newlines")
+	mergeBase := flags.String("merge-base", "", "Use the given commit as the merge base instead of calculating it")
+	flags.BoolVar(&options.AllowUnrelatedHistories, "allow-unrelated-histories", false, "Allow merging commits with no common history")
+	flags.Var(NewMultiStringValue(&options.StrategyOptions), "strategy-option", "Pass the option to the merge strategy")
+	flags.Var(NewMultiStringValue(&options.StrategyOptions), "X", "Alias of --strategy-option")
+	flags.Parse(args)
+	args = flags.Args()
+
+	if len(args) != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	var commits [2]git.Commitish
+	for i, name := range args {
+		cmt, err := git.RevParseCommitish(c, &git.RevParseOptions{}, name)
+		if err != nil {
+			return err
+		}
+		commits[i] = cmt
+	}
+	if *mergeBase != "" {
+		base, err := git.RevParseCommitish(c, &git.RevParseOptions{}, *mergeBase)
+		if err != nil {
+			return err
+		}
+		options.MergeBase = base
+	}
+
+	result, err := git.MergeTree(c, options, commits[0], commits[1])
+	if err != nil {
+		return err
+	}
+
+	term := "\n"
+	if *nul {
+		term = "\x00"
+	}
+	fmt.Printf("%v%v", result.Tree, term)
+	var last git.IndexPath
+	for i, conflict := range result.Conflicts {
+		if *nameOnly {
+			if i == 0 || conflict.Path != last {
+				fmt.Printf("%v%v", conflict.Path, term)
+			}
+		} else {
+			fmt.Printf("%v%v", conflict, term)
+		}
+		last = conflict.Path
+	}
+	// Messages are only shown by default if there were conflicts.
+	if (*messages || !result.Clean()) && !*noMessages {
+		fmt.Print(term)
+		for _, msg := range result.Messages {
+			fmt.Print(msg, "\n")
+		}
+	}
+	if !result.Clean() {
+		return MergeConflict
+	}
+	return nil
+}
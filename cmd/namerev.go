@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/driusan/dgit/git"
+)
+
+func NameRev(c *git.Client, args []string) error {
+	flags := newFlagSet("name-rev")
+	opts := git.NameRevOptions{}
+
+	flags.BoolVar(&opts.Tags, "tags", false, "Only use tags to name the commits")
+	flags.Var(NewMultiStringValue(&opts.Refs), "refs", "Only use refs matching the glob pattern")
+	flags.Var(NewMultiStringValue(&opts.Exclude), "exclude", "Do not use refs matching the glob pattern")
+	flags.BoolVar(&opts.NameOnly, "name-only", false, "Only print the name, not the commit id")
+	flags.BoolVar(&opts.Always, "always", false, "Show an abbreviated commit for commits that can not be named")
+	flags.BoolVar(&opts.NoUndefined, "no-undefined", false, "Die with an error instead of printing undefined")
+	all := flags.Bool("all", false, "List all commits reachable from all refs")
+	stdin := flags.Bool("stdin", false, "Annotate commit ids read from stdin")
+
+	flags.Parse(args)
+	args = flags.Args()
+
+	if *stdin {
+		if len(args) > 0 {
+			return fmt.Errorf("Can not specify revisions with --stdin")
+		}
+		return git.NameRevStdin(c, opts, os.Stdin, os.Stdout)
+	}
+	if *all {
+		names, err := git.NameRevAll(c, opts)
+		if err != nil {
+			return err
+		}
+		for _, n := range names {
+			fmt.Println(n)
+		}
+		return nil
+	}
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	var commits []git.Commitish
+	for _, arg := range args {
+		cmt, err := git.RevParseCommitish(c, &git.RevParseOptions{}, arg)
+		if err != nil {
+			return err
+		}
+		commits = append(commits, cmt)
+	}
+	names, err := git.NameRev(c, opts, commits)
+	if err != nil {
+		return err
+	}
+	for i, n := range names {
+		if opts.NameOnly {
+			fmt.Println(n)
+		} else {
+			fmt.Println(args[i], n)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/driusan/dgit/git"
+)
+
+func Notes(c *git.Client, args []string) error {
+	var nopts git.NotesOptions
+	flags := newFlagSet("notes")
+	flags.StringVar(&nopts.Ref, "ref", "", "Use the notes ref instead of the default")
+	flags.Parse(args)
+	args = flags.Args()
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+
+	switch args[0] {
+	case "add", "append", "edit":
+		opts := git.NotesAddOptions{NotesOptions: nopts}
+		flags := newFlagSet("notes " + args[0])
+		var files []string
+		flags.Var(NewMultiStringValue(&opts.Messages), "m", "Use the given message as a paragraph of the note")
+		flags.Var(NewMultiStringValue(&opts.Messages), "message", "Alias of -m")
+		flags.Var(NewMultiStringValue(&files), "F", "Use the content of the file as a paragraph of the note")
+		flags.Var(NewMultiStringValue(&files), "file", "Alias of -F")
+		flags.StringVar(&opts.ReuseMessage, "C", "", "Use the content of the blob as the note")
+		flags.StringVar(&opts.ReuseMessage, "reuse-message", "", "Alias of -C")
+		flags.StringVar(&opts.ReeditMessage, "c", "", "Like -C, but open the editor to change the note")
+		flags.StringVar(&opts.ReeditMessage, "reedit-message", "", "Alias of -c")
+		flags.BoolVar(&opts.AllowEmpty, "allow-empty", false, "Keep the note even if it is empty")
+		if args[0] == "add" {
+			flags.BoolVar(&opts.Force, "force", false, "Overwrite existing notes")
+			flags.BoolVar(&opts.Force, "f", false, "Alias of --force")
+		}
+		flags.Parse(args[1:])
+		if flags.NArg() > 1 {
+			flags.Usage()
+			os.Exit(2)
+		}
+		for _, f := range files {
+			opts.Files = append(opts.Files, git.File(f))
+		}
+		switch args[0] {
+		case "add":
+			return git.NotesAdd(c, opts, flags.Arg(0))
+		case "append":
+			return git.NotesAppend(c, opts, flags.Arg(0))
+		default:
+			return git.NotesEdit(c, opts, flags.Arg(0))
+		}
+	case "show":
+		flags := newFlagSet("notes show")
+		flags.Parse(args[1:])
+		if flags.NArg() > 1 {
+			flags.Usage()
+			os.Exit(2)
+		}
+		note, err := git.NotesShow(c, nopts, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(note)
+		return nil
+	case "list":
+		flags := newFlagSet("notes list")
+		flags.Parse(args[1:])
+		if flags.NArg() > 1 {
+			flags.Usage()
+			os.Exit(2)
+		}
+		notes, err := git.NotesList(c, nopts, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		for _, n := range notes {
+			if flags.NArg() == 1 {
+				fmt.Println(n.Blob)
+			} else {
+				fmt.Println(n.Blob, n.Object)
+			}
+		}
+		return nil
+	case "remove":
+		opts := git.NotesRemoveOptions{NotesOptions: nopts}
+		flags := newFlagSet("notes remove")
+		flags.BoolVar(&opts.IgnoreMissing, "ignore-missing", false, "Do not fail if an object has no note")
+		flags.Parse(args[1:])
+		return git.NotesRemove(c, opts, flags.Args())
+	case "copy":
+		opts := git.NotesCopyOptions{NotesOptions: nopts}
+		flags := newFlagSet("notes copy")
+		flags.BoolVar(&opts.Force, "force", false, "Overwrite existing notes on the destination")
+		flags.BoolVar(&opts.Force, "f", false, "Alias of --force")
+		flags.Parse(args[1:])
+		switch flags.NArg() {
+		case 1:
+			return git.NotesCopy(c, opts, flags.Arg(0), "HEAD")
+		case 2:
+			return git.NotesCopy(c, opts, flags.Arg(0), flags.Arg(1))
+		default:
+			flags.Usage()
+			os.Exit(2)
+		}
+	case "merge":
+		opts := git.NotesMergeOptions{NotesOptions: nopts}
+		flags := newFlagSet("notes merge")
+		var commit, abort bool
+		flags.StringVar(&opts.Strategy, "strategy", "", "Resolve conflicting notes with the strategy (manual, ours, theirs, union or cat_sort_uniq)")
+		flags.StringVar(&opts.Strategy, "s", "", "Alias of --strategy")
+		flags.BoolVar(&commit, "commit", false, "Finish a notes merge with conflicts")
+		flags.BoolVar(&abort, "abort", false, "Abandon a notes merge with conflicts")
+		flags.BoolVar(&opts.Quiet, "quiet", false, "Do not print progress")
+		flags.BoolVar(&opts.Quiet, "q", false, "Alias of --quiet")
+		flags.Parse(args[1:])
+		switch {
+		case commit && abort:
+			return fmt.Errorf("--commit and --abort are mutually exclusive")
+		case commit:
+			return git.NotesMergeCommit(c)
+		case abort:
+			return git.NotesMergeAbort(c)
+		}
+		if flags.NArg() != 1 {
+			flags.Usage()
+			os.Exit(2)
+		}
+		return git.NotesMerge(c, opts, flags.Arg(0))
+	case "prune":
+		opts := git.NotesPruneOptions{NotesOptions: nopts}
+		flags := newFlagSet("notes prune")
+		flags.BoolVar(&opts.DryRun, "dry-run", false, "Only show the notes that would be removed")
+		flags.BoolVar(&opts.DryRun, "n", false, "Alias of --dry-run")
+		flags.BoolVar(&opts.Verbose, "verbose", false, "Show the objects whose notes are removed")
+		flags.BoolVar(&opts.Verbose, "v", false, "Alias of --verbose")
+		flags.Parse(args[1:])
+		pruned, err := git.NotesPrune(c, opts)
+		if err != nil {
+			return err
+		}
+		if opts.DryRun || opts.Verbose {
+			for _, obj := range pruned {
+				fmt.Println(obj)
+			}
+		}
+		return nil
+	case "get-ref":
+		fmt.Println(git.NotesGetRef(c, nopts))
+		return nil
+	default:
+		return fmt.Errorf("unknown subcommand: %v", args[0])
+	}
+	return nil
+}
+
+// notesValue is a flag for --notes[=<ref>] and --no-notes, which
+// select the notes refs to show. Like git, --notes=<ref> stops the
+// default notes from being shown unless --notes is also given.
+type notesValue struct {
+	refs        []string
+	set         bool
+	withDefault bool
+	disabled    bool
+}
+
+func (n *notesValue) String() string {
+	return ""
+}
+
+func (n *notesValue) IsBoolFlag() bool {
+	return true
+}
+
+func (n *notesValue) Set(s string) error {
+	n.set, n.disabled = true, false
+	if s == "true" {
+		n.withDefault = true
+		return nil
+	}
+	n.refs = append(n.refs, git.ExpandNotesRef(s))
+	return nil
+}
+
+// noNotesValue resets the notes refs for --no-notes.
+type noNotesValue struct {
+	*notesValue
+}
+
+func (n noNotesValue) Set(s string) error {
+	*n.notesValue = notesValue{disabled: true}
+	return nil
+}
+
+// addNotesFlags adds --notes and --no-notes to flags, and returns a
+// function to get the notes refs to show after the flags are parsed. If
+// neither of them was given, the default notes ref is shown if def is set.
+func addNotesFlags(flags *flag.FlagSet) func(c *git.Client, def bool) []string {
+	n := &notesValue{}
+	flags.Var(n, "notes", "Show the notes from the default notes ref, or the given notes ref")
+	flags.Var(noNotesValue{n}, "no-notes", "Do not show notes")
+	return func(c *git.Client, def bool) []string {
+		switch {
+		case n.disabled:
+			return nil
+		case !n.set && !def:
+			return nil
+		case !n.set:
+			return []string{git.DefaultNotesRef(c)}
+		case n.withDefault:
+			return append([]string{git.DefaultNotesRef(c)}, n.refs...)
+		default:
+			return n.refs
+		}
+	}
+}
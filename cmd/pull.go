@@ -22,6 +22,10 @@ func Pull(c *git.Client, args []string) error {
 	addSharedMergeFlags(flags, &opts.MergeOptions)
 	flags.Parse(args)
 
+	// Like merge, only edit the message of a merge commit if there's a
+	// user around to do it.
+	opts.NoEdit = !isInteractive()
+
 	var repository git.Remote
 	var remotebranches []string
 	config, err := git.LoadLocalConfig(c)
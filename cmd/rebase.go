@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/driusan/dgit/git"
+)
+
+func Rebase(c *git.Client, args []string) error {
+	flags := flag.NewFlagSet("rebase", flag.ExitOnError)
+	flags.SetOutput(flag.CommandLine.Output())
+	flags.Usage = func() {
+		flag.Usage()
+		fmt.Fprintf(flag.CommandLine.Output(), "\n\nOptions:\n")
+		flags.PrintDefaults()
+	}
+
+	opts := git.RebaseOptions{}
+
+	onto := flags.String("onto", "", "Starting point at which to create the new commits, instead of upstream")
+
+	flags.BoolVar(&opts.Interactive, "interactive", false, "Make a list of the commits which are about to be rebased and let the user edit it")
+	flags.BoolVar(&opts.Interactive, "i", false, "Alias of --interactive")
+
+	flags.BoolVar(&opts.Autosquash, "autosquash", c.GetConfig("rebase.autosquash") == "true", "Move commits starting with squash! or fixup! after the commit they modify")
+	noautosquash := flags.Bool("no-autosquash", false, "Negate --autosquash and rebase.autoSquash")
+
+	flags.BoolVar(&opts.Autostash, "autostash", c.GetConfig("rebase.autostash") == "true", "Stash local changes before starting and apply them after the rebase")
+	noautostash := flags.Bool("no-autostash", false, "Negate --autostash and rebase.autoStash")
+
+	flags.BoolVar(&opts.KeepEmpty, "keep-empty", false, "Keep commits that do not change anything")
+
+	flags.Var(NewMultiStringValue(&opts.StrategyOptions), "strategy-option", "Pass the option to the merge strategy")
+	flags.Var(NewMultiStringValue(&opts.StrategyOptions), "X", "Alias of --strategy-option")
+
+	flags.BoolVar(&opts.Continue, "continue", false, "Continue the rebase after resolving a merge conflict")
+	flags.BoolVar(&opts.Skip, "skip", false, "Skip the current commit and continue the rebase")
+	flags.BoolVar(&opts.Abort, "abort", false, "Abort the rebase and check out the original branch")
+	flags.BoolVar(&opts.Quit, "quit", false, "Abort the rebase without resetting HEAD to the original branch")
+
+	flags.Parse(args)
+
+	if *noautosquash {
+		opts.Autosquash = false
+	}
+	if *noautostash {
+		opts.Autostash = false
+	}
+	if opts.Continue || opts.Skip || opts.Abort || opts.Quit {
+		return git.Rebase(c, opts, nil, nil)
+	}
+
+	if *onto != "" {
+		cmt, err := git.RevParseCommitish(c, &git.RevParseOptions{}, *onto)
+		if err != nil {
+			return err
+		}
+		opts.Onto = cmt
+	}
+
+	var upstream, branch git.Commitish
+	switch flags.NArg() {
+	case 2:
+		cmt, err := git.RevParseCommitish(c, &git.RevParseOptions{}, flags.Arg(1))
+		if err != nil {
+			return err
+		}
+		branch = cmt
+		fallthrough
+	case 1:
+		cmt, err := git.RevParseCommitish(c, &git.RevParseOptions{}, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		upstream = cmt
+	case 0:
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+	return git.Rebase(c, opts, upstream, branch)
+}
@@ -4,6 +4,8 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/driusan/dgit/git"
 )
@@ -22,37 +24,172 @@ func RevList(c *git.Client, args []string) error {
 	flags.BoolVar(&opts.Quiet, "quiet", false, "prevent printing of revisions")
 	flags.BoolVar(&opts.VerifyObjects, "verify-objects", false, "verify objects instead of printing them")
 	flags.BoolVar(&opts.All, "all", false, "pretend as if all refs were passed on the command line")
+	addRevWalkFlags(flags, &opts)
+	commitFilters := addCommitFilterFlags(flags, &opts)
+	var pretty git.PrettyOptions
+	prettyGiven := addPrettyFlags(flags, &pretty)
+	flags.BoolVar(&opts.NoCommitHeader, "no-commit-header", false, "Don't show the header line with the commit id before user formats")
 
 	flags.Parse(args)
-	args = flags.Args()
+	commitFilters()
+	if prettyGiven() {
+		opts.Pretty = &pretty
+	}
 	if opts.VerifyObjects {
 		opts.Objects = true
 	}
-	// First get a map of excluded commitIDs
-	var excludes []git.Commitish
-	var includes []git.Commitish
-	for _, rev := range args {
-		if rev == "" {
-			continue
+	includes, excludes, paths, err := parseRevWalkArgs(c, args, flags.Args())
+	if err != nil {
+		return err
+	}
+	opts.Paths = paths
+	_, err = git.RevList(c, opts, os.Stdout, includes, excludes)
+	return err
+}
+
+// addRevWalkFlags adds the flags which select which of the commits in the
+// history are walked and listed, shared by rev-list and log.
+func addRevWalkFlags(flags *flag.FlagSet, opts *git.RevListOptions) {
+	flags.BoolVar(&opts.FullHistory, "full-history", false, "Follow all parents of merges when limiting to paths")
+	flags.BoolVar(&opts.SimplifyMerges, "simplify-merges", false, "Only keep the merges needed to connect the commits changing the paths")
+	flags.BoolVar(&opts.AncestryPath, "ancestry-path", false, "Only list commits which are descendants of the excluded commits")
+	flags.BoolVar(&opts.FirstParent, "first-parent", false, "Only follow the first parent of merges")
+	flags.BoolVar(&opts.TopoOrder, "topo-order", false, "Don't show parents before all of their children, keeping lines of history together")
+	flags.BoolVar(&opts.DateOrder, "date-order", false, "Don't show parents before all of their children, otherwise in commit date order")
+}
+
+// addCommitFilterFlags adds the flags which limit the commits listed by
+// their author, committer, message, date or parents, shared by rev-list
+// and log. The returned function must be called after parsing the flags
+// to finish setting them in opts.
+func addCommitFilterFlags(flags *flag.FlagSet, opts *git.RevListOptions) func() {
+	flags.Var(NewMultiStringValue(&opts.Authors), "author", "Only list commits whose author matches <pattern>")
+	flags.Var(NewMultiStringValue(&opts.Committers), "committer", "Only list commits whose committer matches <pattern>")
+	flags.Var(NewMultiStringValue(&opts.Grep), "grep", "Only list commits whose message matches <pattern>")
+	flags.BoolVar(&opts.AllMatch, "all-match", false, "Only list commits which match all of the --grep patterns")
+	flags.BoolVar(&opts.InvertGrep, "invert-grep", false, "Only list commits whose message doesn't match the --grep patterns")
+	flags.BoolVar(&opts.RegexpIgnoreCase, "regexp-ignore-case", false, "Match the patterns without regard to case")
+	flags.BoolVar(&opts.RegexpIgnoreCase, "i", false, "Alias of --regexp-ignore-case")
+	flags.BoolVar(&opts.ExtendedRegexp, "extended-regexp", false, "Treat the patterns as extended regular expressions")
+	flags.BoolVar(&opts.ExtendedRegexp, "E", false, "Alias of --extended-regexp")
+	flags.BoolVar(&opts.FixedStrings, "fixed-strings", false, "Treat the patterns as fixed strings")
+	flags.BoolVar(&opts.FixedStrings, "F", false, "Alias of --fixed-strings")
+
+	var since, until string
+	flags.StringVar(&since, "since", "", "Only list commits more recent than <date>")
+	flags.StringVar(&since, "after", "", "Alias of --since")
+	flags.StringVar(&until, "until", "", "Only list commits older than <date>")
+	flags.StringVar(&until, "before", "", "Alias of --until")
+
+	var merges, noMerges bool
+	minParents, maxParents := 0, -1
+	flags.BoolVar(&merges, "merges", false, "Only list merge commits")
+	flags.BoolVar(&noMerges, "no-merges", false, "Don't list merge commits")
+	flags.IntVar(&minParents, "min-parents", 0, "Only list commits with at least <n> parents")
+	flags.IntVar(&maxParents, "max-parents", -1, "Only list commits with at most <n> parents, or any number if negative")
+
+	return func() {
+		now := time.Now()
+		if since != "" {
+			opts.Since = git.Approxidate(since, now)
 		}
-		if rev[0] == '^' && len(rev) > 1 {
-			commits, _, err := RevParse(c, []string{rev[1:]})
-			if err != nil {
-				return fmt.Errorf("%s:%v", rev, err)
-			}
-			for _, cmt := range commits {
-				excludes = append(excludes, cmt)
+		if until != "" {
+			opts.Until = git.Approxidate(until, now)
+		}
+		if merges {
+			minParents = 2
+		}
+		if noMerges {
+			maxParents = 1
+		}
+		if minParents > 0 {
+			opts.MinParents = uint(minParents)
+		}
+		if maxParents >= 0 {
+			mp := uint(maxParents)
+			opts.MaxParents = &mp
+		}
+	}
+}
+
+// parseRevWalkArgs parses the revisions and paths left in args after the
+// flags in rawargs were parsed, into the commits to walk from, the commits
+// whose history is excluded, and the paths to limit the walk to. A range
+// A..B includes B and excludes A, and ^A excludes A. Anything after a -- is
+// a path, and without one the paths start at the first argument which isn't
+// a revision and must exist.
+func parseRevWalkArgs(c *git.Client, rawargs, args []string) (includes, excludes []git.Commitish, paths []git.File, err error) {
+	// The flag package strips a -- before any other argument.
+	var revs, files []string
+	if len(rawargs) > len(args) && rawargs[len(rawargs)-len(args)-1] == "--" {
+		files = args
+	} else {
+		revs = args
+		for i, arg := range args {
+			if arg == "--" {
+				revs, files = args[:i], args[i+1:]
+				break
 			}
-		} else {
-			commits, _, err := RevParse(c, []string{rev})
-			if err != nil {
-				return fmt.Errorf("%s:%v", rev, err)
+		}
+	}
+	if files == nil {
+		// The revisions and paths weren't separated, so the paths
+		// start at the first argument which isn't a revision.
+		for i, arg := range revs {
+			if _, _, err := parseRevWalkArg(c, arg); err != nil {
+				revs, files = revs[:i], revs[i:]
+				break
 			}
-			for _, cmt := range commits {
-				includes = append(includes, cmt)
+		}
+		for _, f := range files {
+			if !git.File(f).Exists() {
+				return nil, nil, nil, fmt.Errorf("ambiguous argument '%v': unknown revision or path not in the working tree.\nUse '--' to separate paths from revisions", f)
 			}
 		}
 	}
-	_, err := git.RevList(c, opts, os.Stdout, includes, excludes)
-	return err
+	for _, rev := range revs {
+		incl, excl, err := parseRevWalkArg(c, rev)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		includes = append(includes, incl...)
+		excludes = append(excludes, excl...)
+	}
+	for _, f := range files {
+		paths = append(paths, git.File(f))
+	}
+	return includes, excludes, paths, nil
+}
+
+// parseRevWalkArg parses a single revision or range for parseRevWalkArgs.
+func parseRevWalkArg(c *git.Client, rev string) (includes, excludes []git.Commitish, err error) {
+	parse := func(rev string) (git.Commitish, error) {
+		if rev == "" {
+			rev = "HEAD"
+		}
+		return git.RevParseCommitish(c, &git.RevParseOptions{}, rev)
+	}
+	if pieces := strings.SplitN(rev, "..", 2); len(pieces) == 2 {
+		from, err := parse(pieces[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		to, err := parse(pieces[1])
+		if err != nil {
+			return nil, nil, err
+		}
+		return []git.Commitish{to}, []git.Commitish{from}, nil
+	}
+	if rev != "" && rev[0] == '^' {
+		cmt, err := parse(rev[1:])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s:%v", rev, err)
+		}
+		return nil, []git.Commitish{cmt}, nil
+	}
+	cmt, err := git.RevParseCommitish(c, &git.RevParseOptions{}, rev)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s:%v", rev, err)
+	}
+	return []git.Commitish{cmt}, nil, nil
 }
@@ -17,9 +17,26 @@ func Show(c *git.Client, args []string) error {
 	}
 
 	opts := git.ShowOptions{}
-	flags.Var(newAliasedStringValue((*string)(&opts.Format), ""), "format", "Print the contents of commit logs in a specified format")
-	flags.Var(newAliasedStringValue((*string)(&opts.Format), ""), "pretty", "Alias for --format")
-	flags.Parse(args)
+	prettyGiven := addPrettyFlags(flags, &opts.PrettyOptions)
+	notesRefs := addNotesFlags(flags)
+	flags.BoolVar(&opts.Raw, "raw", false, "Show the changes in raw format")
+	renames := addRenameFlags(flags, &opts.DiffCommonOptions)
+	addPickaxeFlags(flags, &opts.DiffCommonOptions)
+	abbrev := addAbbrevFlags(flags, &opts.DiffCommonOptions)
+	checkFormat := addDiffFormatFlags(flags, &opts.DiffCommonOptions)
+	patchFlags := addCommitPatchFlags(flags, &opts.DiffCommonOptions)
+	diffMerges := addDiffMergesFlags(flags, &opts.DiffCommonOptions)
+	flags.Parse(adjustDiffArgs(args))
+	renames(c, true)
+	abbrev(true)
+	if err := checkFormat(); err != nil {
+		return err
+	}
+	diffMerges("dense-combined")
+	if err := patchFlags(c, true); err != nil {
+		return err
+	}
+	opts.NotesRefs = notesRefs(c, !prettyGiven() || opts.UsesNotes(c))
 
 	objects := flags.Args()
 	return git.Show(c, opts, objects)
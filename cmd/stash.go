@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/driusan/dgit/git"
+)
+
+func Stash(c *git.Client, args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return stashPush(c, "push", args)
+	}
+	switch args[0] {
+	case "push", "save":
+		return stashPush(c, args[0], args[1:])
+	case "list":
+		entries, err := git.StashList(c)
+		if err != nil {
+			return err
+		}
+		for i, e := range entries {
+			fmt.Printf("stash@{%d}: %v\n", i, e.Message)
+		}
+		return nil
+	case "show":
+		opts := git.StashShowOptions{}
+		flags := newFlagSet("stash show")
+		flags.BoolVar(&opts.Patch, "patch", false, "Show the changes as a patch instead of a diffstat")
+		flags.BoolVar(&opts.Patch, "p", false, "Alias of --patch")
+		flags.BoolVar(&opts.IncludeUntracked, "include-untracked", false, "Show the untracked files in the stash as well")
+		flags.BoolVar(&opts.IncludeUntracked, "u", false, "Alias of --include-untracked")
+		flags.Parse(args[1:])
+		if flags.NArg() > 1 {
+			flags.Usage()
+			os.Exit(2)
+		}
+		return git.StashShow(c, opts, flags.Arg(0))
+	case "apply", "pop":
+		opts := git.StashApplyOptions{}
+		flags := newFlagSet("stash " + args[0])
+		flags.BoolVar(&opts.Index, "index", false, "Try to restore the changes in the index as well as the work tree")
+		flags.BoolVar(&opts.Quiet, "quiet", false, "Do not print the status after applying the stash")
+		flags.BoolVar(&opts.Quiet, "q", false, "Alias of --quiet")
+		flags.Parse(args[1:])
+		if flags.NArg() > 1 {
+			flags.Usage()
+			os.Exit(2)
+		}
+		var err error
+		if args[0] == "pop" {
+			err = git.StashPop(c, opts, flags.Arg(0))
+		} else {
+			err = git.StashApply(c, opts, flags.Arg(0))
+		}
+		if err != nil {
+			return err
+		}
+		if !opts.Quiet {
+			status, err := git.Status(c, git.StatusOptions{Long: true, UntrackedMode: git.StatusUntrackedNormal}, nil)
+			if err != nil {
+				return err
+			}
+			fmt.Print(status)
+		}
+		return nil
+	case "drop":
+		opts := git.StashOptions{}
+		flags := newFlagSet("stash drop")
+		flags.BoolVar(&opts.Quiet, "quiet", false, "Do not print the dropped stash")
+		flags.BoolVar(&opts.Quiet, "q", false, "Alias of --quiet")
+		flags.Parse(args[1:])
+		if flags.NArg() > 1 {
+			flags.Usage()
+			os.Exit(2)
+		}
+		return git.StashDrop(c, opts, flags.Arg(0))
+	case "clear":
+		return git.StashClear(c)
+	default:
+		return fmt.Errorf("Unknown stash subcommand: %v", args[0])
+	}
+}
+
+// stashPush handles "stash push" and the older "stash save", which takes
+// a message instead of pathspecs.
+func stashPush(c *git.Client, subcommand string, args []string) error {
+	opts := git.StashPushOptions{}
+	flags := newFlagSet("stash " + subcommand)
+	flags.BoolVar(&opts.IncludeUntracked, "include-untracked", false, "Stash untracked files too, and remove them from the work tree")
+	flags.BoolVar(&opts.IncludeUntracked, "u", false, "Alias of --include-untracked")
+
+	flags.BoolVar(&opts.KeepIndex, "keep-index", false, "Leave the changes in the index intact")
+	flags.BoolVar(&opts.KeepIndex, "k", false, "Alias of --keep-index")
+	nokeepindex := flags.Bool("no-keep-index", false, "Negate --keep-index")
+
+	flags.BoolVar(&opts.Patch, "patch", false, "Interactively select the hunks to stash. Implies --keep-index")
+	flags.BoolVar(&opts.Patch, "p", false, "Alias of --patch")
+
+	flags.BoolVar(&opts.Quiet, "quiet", false, "Suppress feedback messages")
+	flags.BoolVar(&opts.Quiet, "q", false, "Alias of --quiet")
+
+	if subcommand == "push" {
+		flags.StringVar(&opts.Message, "message", "", "Use the given description for the stash")
+		flags.StringVar(&opts.Message, "m", "", "Alias of --message")
+	}
+	flags.Parse(args)
+
+	if opts.Patch {
+		opts.KeepIndex = true
+	}
+	if *nokeepindex {
+		opts.KeepIndex = false
+	}
+
+	var files []git.File
+	if subcommand == "save" {
+		opts.Message = strings.Join(flags.Args(), " ")
+	} else {
+		for _, f := range flags.Args() {
+			files = append(files, git.File(f))
+		}
+	}
+	return git.StashPush(c, opts, files)
+}
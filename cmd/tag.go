@@ -4,6 +4,8 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"strconv"
 	"strings"
 
 	"github.com/driusan/dgit/git"
@@ -46,7 +48,15 @@ func Tag(c *git.Client, args []string) error {
 	flags.Var(newAliasedStringValue(&messageFile, ""), "file", "Use the contents of file for the annotated tag message")
 	flags.Var(newAliasedStringValue(&messageFile, ""), "F", "Alias of --file")
 
-	flags.Parse(args)
+	flags.IntVar(&options.Lines, "n", 0, "Print the first <num> lines of the annotation when listing tags (-n<num>)")
+	var contains, noContains, pointsAt string
+	flags.StringVar(&contains, "contains", "", "Only list tags which contain the commit (default HEAD)")
+	flags.StringVar(&noContains, "no-contains", "", "Only list tags which don't contain the commit (default HEAD)")
+	flags.StringVar(&pointsAt, "points-at", "", "Only list tags of the given object (default HEAD)")
+	flags.StringVar(&options.Sort, "sort", "", "Sort by key (refname, version:refname, creatordate, taggerdate or objectname)")
+	flags.StringVar(&options.Format, "format", "", "A string that interpolates %(fieldname) from the tag ref being shown")
+
+	flags.Parse(lastArgDefault(tagLinesArgs(args), "HEAD", "contains", "no-contains", "points-at"))
 	tagnames := flags.Args()
 
 	if options.Delete {
@@ -56,8 +66,54 @@ func Tag(c *git.Client, args []string) error {
 		}
 		return git.TagDelete(c, options, tagrefs)
 	}
+
+	if contains != "" || noContains != "" || pointsAt != "" || options.Lines > 0 {
+		options.List = true
+	}
+	for _, filter := range []struct {
+		val  string
+		dest *[]git.Commitish
+	}{
+		{contains, &options.Contains},
+		{noContains, &options.NoContains},
+	} {
+		if filter.val == "" {
+			continue
+		}
+		cmt, err := git.RevParseCommitish(c, &git.RevParseOptions{}, filter.val)
+		if err != nil {
+			return err
+		}
+		*filter.dest = append(*filter.dest, cmt)
+	}
+	if pointsAt != "" {
+		obj, err := git.RevParse(c, git.RevParseOptions{}, []string{pointsAt})
+		if err != nil {
+			return err
+		}
+		if len(obj) != 1 {
+			return fmt.Errorf("malformed object name %v", pointsAt)
+		}
+		options.PointsAt = append(options.PointsAt, obj[0].Id)
+	}
+
+	if options.List || len(tagnames) == 0 {
+		tags, err := git.TagList(c, options, tagnames)
+		if err != nil {
+			return err
+		}
+		printTags(tags)
+		return nil
+	}
+
 	if messageFile != "" {
-		f, err := ioutil.ReadFile(messageFile)
+		var f []byte
+		var err error
+		if messageFile == "-" {
+			f, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			f, err = ioutil.ReadFile(messageFile)
+		}
 		if err != nil {
 			return err
 		}
@@ -68,28 +124,25 @@ func Tag(c *git.Client, args []string) error {
 	}
 	var finalMessage string
 	if options.Annotated {
-		finalMessage = strings.Join(message, "\n\n") + "\n"
-		// FIXME: spawn an editor if no message is provided
-		if finalMessage == "\n" || finalMessage == "" {
-			return fmt.Errorf("No message provided for annotated tag")
+		edited := false
+		finalMessage = strings.Join(message, "\n\n")
+		if len(message) == 0 {
+			msg, err := editTagMessage(c, tagnames[0])
+			if err != nil {
+				return err
+			}
+			finalMessage, edited = msg, true
 		}
-	}
-	if options.List {
-		tags, err := git.TagList(c, options, tagnames)
+		cleaned, err := git.CommitMessage(finalMessage).Cleanup("default", edited)
 		if err != nil {
 			return err
 		}
-		printTags(tags)
-		return nil
+		finalMessage = cleaned
+		if strings.TrimSpace(finalMessage) == "" {
+			return fmt.Errorf("No tag message?")
+		}
 	}
 	switch len(tagnames) {
-	case 0:
-		tags, err := git.TagList(c, options, tagnames)
-		if err != nil {
-			return err
-		}
-		printTags(tags)
-		return nil
 	case 1:
 		return git.TagCommit(c, options, tagnames[0], nil, finalMessage)
 	case 2:
@@ -102,3 +155,40 @@ func Tag(c *git.Client, args []string) error {
 		return fmt.Errorf("Invalid tag usage")
 	}
 }
+
+// tagLinesArgs converts the -n<num> argument to the -n=<num> format
+// understood by the flag package. A bare -n is the same as -n1.
+func tagLinesArgs(args []string) []string {
+	newargs := make([]string, 0, len(args))
+	for i, arg := range args {
+		if arg == "--" {
+			return append(newargs, args[i:]...)
+		}
+		if strings.HasPrefix(arg, "-n") && !strings.HasPrefix(arg, "-n=") {
+			if arg == "-n" {
+				arg = "-n=1"
+			} else if _, err := strconv.Atoi(arg[2:]); err == nil {
+				arg = "-n=" + arg[2:]
+			}
+		}
+		newargs = append(newargs, arg)
+	}
+	return newargs
+}
+
+// editTagMessage opens the editor for the user to write the message of
+// the annotated tag named tagname.
+func editTagMessage(c *git.Client, tagname string) (string, error) {
+	template := fmt.Sprintf("\n#\n# Write a message for tag:\n#   %s\n# Lines starting with '#' will be ignored.\n#\n", tagname)
+	if err := c.GitDir.WriteFile("TAG_EDITMSG", []byte(template), 0660); err != nil {
+		return "", err
+	}
+	if err := c.ExecEditor(c.GitDir.File("TAG_EDITMSG")); err != nil {
+		return "", err
+	}
+	msg, err := ioutil.ReadFile(c.GitDir.File("TAG_EDITMSG").String())
+	if err != nil {
+		return "", err
+	}
+	return string(msg), nil
+}
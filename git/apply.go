@@ -1,6 +1,7 @@
 package git
 
 import (
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
@@ -51,7 +52,8 @@ type ApplyOptions struct {
 func Apply(c *Client, opts ApplyOptions, patches []File) error {
 	// 1. Make a temporary directory to patch files in to ensure atomicity
 	// 2. Copy files to tempdir
-	// 3. Run an external patch tool
+	// 3. Apply binary patches natively and run an external patch tool
+	//    for the rest
 	// 4. If successful, copy the files back over WorkDir
 	patchdir, err := ioutil.TempDir("", "gitapply")
 	if err != nil {
@@ -65,19 +67,40 @@ func Apply(c *Client, opts ApplyOptions, patches []File) error {
 	}
 
 	// First pass, parse the patches to figure out which files are involved
+	// and separate the binary patches, which patch can't apply, from the
+	// rest.
 	files := make(map[IndexPath]bool)
+	var textPatches []File
+	var binaries []binaryFilePatch
 	for _, patch := range patches {
-		patch, err := ioutil.ReadFile(patch.String())
+		patchContent, err := ioutil.ReadFile(patch.String())
 		if err != nil {
 			return err
 		}
-		hunks, err := splitPatch(string(patch), true)
+		hunks, err := splitPatch(string(patchContent), true)
 		if err != nil {
 			return err
 		}
 		for _, hunk := range hunks {
 			files[hunk.File] = true
 		}
+
+		text, bins, err := splitBinaryPatches(string(patchContent))
+		if err != nil {
+			return err
+		}
+		if len(bins) == 0 {
+			textPatches = append(textPatches, patch)
+			continue
+		}
+		binaries = append(binaries, bins...)
+		if diffGitRE.MatchString(text) {
+			textPatch := File(filepath.Join(patchdir, fmt.Sprintf(".patch%d", len(textPatches))))
+			if err := ioutil.WriteFile(textPatch.String(), []byte(text), 0644); err != nil {
+				return err
+			}
+			textPatches = append(textPatches, textPatch)
+		}
 	}
 
 	// Copy all of the files. We do this in a second pass to avoid
@@ -90,19 +113,27 @@ func Apply(c *Client, opts ApplyOptions, patches []File) error {
 		}
 		idx = idx2
 	}
+	workdir := filepath.Join(patchdir, "work")
+	if err := os.Mkdir(workdir, 0755); err != nil {
+		return err
+	}
 	for file := range files {
 		f, err := file.FilePath(c)
 		if err != nil {
 			return err
 		}
 
-		dst := patchdir + "/" + file.String()
+		dst := workdir + "/" + file.String()
 		if opts.Cached {
+			if idx.GetSha1(file) == (Sha1{}) {
+				// It's added by the patch.
+				continue
+			}
 			if err := copyFromIndex(c, idx, file, dst); err != nil {
 				return err
 			}
 		} else {
-			if err := copyFile(f.String(), dst); err != nil {
+			if err := copyFile(f.String(), dst); err != nil && !os.IsNotExist(err) {
 				return err
 			}
 		}
@@ -114,24 +145,47 @@ func Apply(c *Client, opts ApplyOptions, patches []File) error {
 	} else {
 		patchDirection = "-N"
 	}
-	for _, patch := range patches {
-		patchcmd := exec.Command(posixPatch, "--directory", patchdir, "-i", patch.String(), patchDirection, "-p1", "-F", "0")
+	for _, patch := range textPatches {
+		patchcmd := exec.Command(posixPatch, "--directory", workdir, "-i", patch.String(), patchDirection, "-p1", "-F", "0")
 		patchcmd.Stderr = os.Stderr
 		_, err := patchcmd.Output()
 		if err != nil {
 			return err
 		}
 	}
-	if opts.Index {
-		if err := updateApplyIndex(c, idx, patchdir); err != nil {
+	var deleted []IndexPath
+	for _, patch := range binaries {
+		removed, err := patch.apply(workdir, opts.Reverse)
+		if err != nil {
 			return err
 		}
-		if opts.Cached {
-			return nil
+		if removed {
+			deleted = append(deleted, patch.Name)
 		}
 	}
-	return copyApplyDir(c, patchdir)
-
+	if !opts.Cached {
+		if err := copyApplyDir(c, workdir); err != nil {
+			return err
+		}
+		for _, file := range deleted {
+			f, err := file.FilePath(c)
+			if err != nil {
+				return err
+			}
+			if err := os.Remove(f.String()); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	if opts.Index {
+		// This is done after the work tree is updated so that the
+		// stat information in the index matches it.
+		for _, file := range deleted {
+			idx.RemoveFile(file)
+		}
+		return updateApplyIndex(c, idx, workdir)
+	}
+	return nil
 }
 
 // RestoreDir takes the directory dir, which is the directory that apply did
@@ -178,7 +232,8 @@ func updateApplyIndex(c *Client, idx *Index, dir string) error {
 			}
 			return nil
 		}
-		return nil
+		// It's a new file.
+		return idx.AddStage(c, ipath, ModeBlob, sha1, Stage0, uint32(len(contents)), 0, UpdateIndexOptions{Add: true})
 	})
 	// Write the index that the callback modified
 	f, err := c.GitDir.Create(File("index"))
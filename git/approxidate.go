@@ -0,0 +1,440 @@
+package git
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Approxidate parses date the same way as git's approxidate, which
+// accepts both absolute dates in most formats and relative ones such as
+// "2 weeks ago", "yesterday" or "last friday", relative to now. Any part
+// of the date or time which isn't given is taken from now, and a date
+// which can't be parsed at all is now.
+func Approxidate(date string, now time.Time) time.Time {
+	if t, ok := parseExactDate(date, now.Location()); ok {
+		return t
+	}
+	return approxidateStr(date, now)
+}
+
+// The absolute dates with a time and time zone, which don't need to be
+// approximated.
+var (
+	unixDateRE = regexp.MustCompile(`^@?([0-9]+)(?: [+-][0-9]{4})?$`)
+
+	exactDateLayouts = []string{
+		time.RFC1123Z,
+		"Mon, 2 Jan 2006 15:04:05 -0700",
+		time.RFC3339,
+		"2006-01-02T15:04:05-0700",
+		"2006-01-02 15:04:05 -0700",
+		"2006-01-02 15:04 -0700",
+		"2006-01-02T15:04:05Z07:00",
+	}
+	localDateLayouts = []string{
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05",
+		"2006-01-02 15:04",
+	}
+)
+
+// parseExactDate parses the absolute dates which git's parse_date_basic
+// accepts, which are the ones with a full date and time.
+func parseExactDate(date string, loc *time.Location) (time.Time, bool) {
+	date = strings.TrimSpace(date)
+	if m := unixDateRE.FindStringSubmatch(date); m != nil {
+		secs, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		// Like git, a bare number is only seconds since 1970 if it's
+		// too big to be a date such as 20200131.
+		if date[0] == '@' || len(m[0]) > len(m[1]) || secs >= 100000000 {
+			return time.Unix(secs, 0), true
+		}
+	}
+	for _, layout := range exactDateLayouts {
+		if t, err := time.Parse(layout, date); err == nil {
+			return t, true
+		}
+	}
+	for _, layout := range localDateLayouts {
+		if t, err := time.ParseInLocation(layout, date, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// approxTm is the broken down time that git's approxidate works on. The
+// year is relative to 1900 and the month starts at 0, like a C struct tm,
+// and the date fields are -1 until they're known.
+type approxTm struct {
+	year, mon, mday int
+	hour, min, sec  int
+	wday            int
+	loc             *time.Location
+}
+
+func newApproxTm(t time.Time) approxTm {
+	return approxTm{
+		year: t.Year() - 1900,
+		mon:  int(t.Month()) - 1,
+		mday: t.Day(),
+		hour: t.Hour(),
+		min:  t.Minute(),
+		sec:  t.Second(),
+		wday: int(t.Weekday()),
+		loc:  t.Location(),
+	}
+}
+
+func (tm approxTm) time() time.Time {
+	return time.Date(tm.year+1900, time.Month(tm.mon+1), tm.mday, tm.hour, tm.min, tm.sec, 0, tm.loc)
+}
+
+// update fills in the date fields which aren't known yet from now, and
+// then moves tm back by secs seconds.
+func (tm *approxTm) update(now approxTm, secs int64) time.Time {
+	if tm.mday < 0 {
+		tm.mday = now.mday
+	}
+	if tm.mon < 0 {
+		tm.mon = now.mon
+	}
+	if tm.year < 0 {
+		tm.year = now.year
+		if tm.mon > now.mon {
+			tm.year--
+		}
+	}
+	t := tm.time().Add(-time.Duration(secs) * time.Second)
+	*tm = newApproxTm(t)
+	return t
+}
+
+// pendingNumber uses a number which wasn't followed by a unit as the
+// first of the day, month or year that isn't known yet.
+func (tm *approxTm) pendingNumber(num *int) {
+	number := *num
+	if number == 0 {
+		return
+	}
+	*num = 0
+	switch {
+	case tm.mday < 0 && number < 32:
+		tm.mday = number
+	case tm.mon < 0 && number < 13:
+		tm.mon = number - 1
+	case tm.year < 0:
+		switch {
+		case number > 1969 && number < 2100:
+			tm.year = number - 1900
+		case number > 69 && number < 100:
+			tm.year = number
+		case number < 38:
+			tm.year = 100 + number
+		}
+	}
+}
+
+// setTime sets the time of day, going back to the day before if it's
+// earlier in the day than the time.
+func (tm *approxTm) setTime(now approxTm, hour int) {
+	if tm.hour < hour {
+		tm.update(now, 24*60*60)
+	}
+	tm.hour, tm.min, tm.sec = hour, 0, 0
+}
+
+var (
+	approxMonths   = []string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"}
+	approxWeekdays = []string{"Sundays", "Mondays", "Tuesdays", "Wednesdays", "Thursdays", "Fridays", "Saturdays"}
+	approxNumbers  = []string{"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine", "ten"}
+	approxUnits    = []struct {
+		name string
+		secs int64
+	}{
+		{"seconds", 1},
+		{"minutes", 60},
+		{"hours", 60 * 60},
+		{"days", 24 * 60 * 60},
+		{"weeks", 7 * 24 * 60 * 60},
+	}
+)
+
+// matchApproxString returns how many characters at the start of date
+// match str, ignoring case, up to the end of the word in date. It's 0 if
+// the word is different.
+func matchApproxString(date, str string) int {
+	i := 0
+	for ; i < len(date); i++ {
+		if i < len(str) && unicode.ToUpper(rune(date[i])) == unicode.ToUpper(rune(str[i])) {
+			continue
+		}
+		if !isAlnum(date[i]) {
+			break
+		}
+		return 0
+	}
+	return i
+}
+
+func isAlnum(c byte) bool {
+	return isDigit(c) || isAlpha(c)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// approxidateStr is git's approxidate_str, which goes through the words
+// and numbers in date, adjusting the time from now as it goes.
+func approxidateStr(date string, nowTime time.Time) time.Time {
+	now := newApproxTm(nowTime)
+	tm := now
+	tm.year, tm.mon, tm.mday = -1, -1, -1
+	number := 0
+	for i := 0; i < len(date); {
+		switch c := date[i]; {
+		case isDigit(c):
+			tm.pendingNumber(&number)
+			i += tm.approxDigit(date[i:], &number, nowTime)
+		case isAlpha(c):
+			i += tm.approxAlpha(date[i:], now, &number)
+		default:
+			i++
+		}
+	}
+	tm.pendingNumber(&number)
+	return tm.update(now, 0)
+}
+
+// approxDigit handles a number at the start of date, which may be a
+// time or date with separators, and returns its length.
+func (tm *approxTm) approxDigit(date string, num *int, now time.Time) int {
+	end := 0
+	for end < len(date) && isDigit(date[end]) {
+		end++
+	}
+	number, _ := strconv.Atoi(date[:end])
+	if end+1 < len(date) && strings.IndexByte(":./-", date[end]) >= 0 && isDigit(date[end+1]) {
+		if n := tm.matchMultiNumber(number, date[end], date, end, now); n > 0 {
+			return n
+		}
+	}
+	// Zero padding is only accepted for small numbers, like "Dec 02".
+	if date[0] != '0' || end <= 2 {
+		*num = number
+	}
+	return end
+}
+
+// matchMultiNumber handles a time or date made of numbers separated by
+// sep, the first of which is num and ends at end in date. It returns the
+// length of it, or 0 if it isn't a valid time or date.
+func (tm *approxTm) matchMultiNumber(num int, sep byte, date string, end int, now time.Time) int {
+	readNum := func() int {
+		start := end + 1
+		end = start
+		for end < len(date) && isDigit(date[end]) {
+			end++
+		}
+		n, _ := strconv.Atoi(date[start:end])
+		return n
+	}
+	num2 := readNum()
+	num3 := -1
+	if end+1 < len(date) && date[end] == sep && isDigit(date[end+1]) {
+		num3 = readNum()
+	}
+
+	switch sep {
+	case ':':
+		if num3 < 0 {
+			num3 = 0
+		}
+		if num < 25 && num2 >= 0 && num2 < 60 && num3 >= 0 && num3 <= 60 {
+			tm.hour, tm.min, tm.sec = num, num2, num3
+			return end
+		}
+		return 0
+	default:
+		if num > 70 {
+			// yyyy-mm-dd or yyyy-dd-mm
+			if tm.setDate(num, num2, num3, nil) || tm.setDate(num, num3, num2, nil) {
+				return end
+			}
+		}
+		nowTm := newApproxTm(now.UTC())
+		// mm/dd/yy[yy] takes precedence unless the separator is a
+		// '.', which is dd.mm.yy[yy] in eastern Europe.
+		if sep != '.' && tm.setDate(num3, num, num2, &nowTm) {
+			return end
+		}
+		if tm.setDate(num3, num2, num, &nowTm) {
+			return end
+		}
+		if sep == '.' && tm.setDate(num3, num, num2, &nowTm) {
+			return end
+		}
+		return 0
+	}
+}
+
+// setDate sets the date of tm if it's valid, and returns whether it was.
+// If now is set, the date is refused if it's more than ten days after it,
+// and the year may be left out as -1.
+func (tm *approxTm) setDate(year, month, day int, now *approxTm) bool {
+	if month <= 0 || month >= 13 || day <= 0 || day >= 32 {
+		return false
+	}
+	r := *tm
+	r.mon, r.mday = month-1, day
+	switch {
+	case year == -1:
+		if now == nil {
+			return false
+		}
+		r.year = now.year
+	case year >= 1970 && year < 2100:
+		r.year = year - 1900
+	case year > 70 && year < 100:
+		r.year = year
+	case year < 38:
+		r.year = year + 100
+	default:
+		return false
+	}
+	if now == nil {
+		*tm = r
+		return true
+	}
+	specified := time.Date(r.year+1900, time.Month(r.mon+1), r.mday, r.hour, r.min, r.sec, 0, time.UTC)
+	if specified.After(now.time().Add(10 * 24 * time.Hour)) {
+		return false
+	}
+	tm.mon, tm.mday = r.mon, r.mday
+	if year != -1 {
+		tm.year = r.year
+	}
+	return true
+}
+
+// approxAlpha handles a word at the start of date and returns its
+// length.
+func (tm *approxTm) approxAlpha(date string, now approxTm, num *int) int {
+	end := 1
+	for end < len(date) && isAlpha(date[end]) {
+		end++
+	}
+	for i, month := range approxMonths {
+		if matchApproxString(date, month) >= 3 {
+			tm.mon = i
+			return end
+		}
+	}
+
+	matchesAll := func(word string) bool {
+		return matchApproxString(date, word) == len(word)
+	}
+	switch {
+	case matchesAll("yesterday"):
+		*num = 0
+		tm.update(now, 24*60*60)
+		return end
+	case matchesAll("noon"):
+		tm.pendingNumber(num)
+		tm.setTime(now, 12)
+		return end
+	case matchesAll("midnight"):
+		tm.pendingNumber(num)
+		tm.setTime(now, 0)
+		return end
+	case matchesAll("tea"):
+		tm.pendingNumber(num)
+		tm.setTime(now, 17)
+		return end
+	case matchesAll("PM"), matchesAll("AM"):
+		hour := tm.hour
+		if *num != 0 {
+			hour, tm.min, tm.sec = *num, 0, 0
+		}
+		*num = 0
+		tm.hour = hour % 12
+		if matchesAll("PM") {
+			tm.hour += 12
+		}
+		return end
+	case matchesAll("never"):
+		*num = 0
+		*tm = newApproxTm(time.Unix(0, 0).In(tm.loc))
+		return end
+	case matchesAll("now"):
+		*num = 0
+		tm.update(now, 0)
+		return end
+	}
+
+	if *num == 0 {
+		for i := 1; i < len(approxNumbers); i++ {
+			if matchesAll(approxNumbers[i]) {
+				*num = i
+				return end
+			}
+		}
+		if matchesAll("last") {
+			*num = 1
+		}
+		return end
+	}
+
+	for _, unit := range approxUnits {
+		if matchApproxString(date, unit.name) >= len(unit.name)-1 {
+			tm.update(now, unit.secs*int64(*num))
+			*num = 0
+			return end
+		}
+	}
+
+	for i, weekday := range approxWeekdays {
+		if matchApproxString(date, weekday) >= 3 {
+			n := *num - 1
+			*num = 0
+			diff := tm.wday - i
+			if diff <= 0 {
+				n++
+			}
+			diff += 7 * n
+			tm.update(now, int64(diff)*24*60*60)
+			return end
+		}
+	}
+
+	if matchApproxString(date, "months") >= 5 {
+		tm.update(now, 0)
+		n := tm.mon - *num
+		*num = 0
+		for n < 0 {
+			n += 12
+			tm.year--
+		}
+		tm.mon = n
+		return end
+	}
+
+	if matchApproxString(date, "years") >= 4 {
+		tm.update(now, 0)
+		tm.year -= *num
+		*num = 0
+		return end
+	}
+	return end
+}
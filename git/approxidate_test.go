@@ -0,0 +1,49 @@
+package git
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApproxidate(t *testing.T) {
+	now := time.Date(2020, time.March, 11, 9, 30, 15, 0, time.UTC)
+	tests := []struct {
+		date string
+		want time.Time
+	}{
+		{"@1577836800", time.Unix(1577836800, 0)},
+		{"1577836800 +0100", time.Unix(1577836800, 0)},
+		// Numbers that are too big to be a date are seconds since 1970.
+		{"1577836800", time.Unix(1577836800, 0)},
+		{"2020-01-01 12:00:00 +0200", time.Date(2020, time.January, 1, 10, 0, 0, 0, time.UTC)},
+		{"Mon, 6 Jan 2020 10:00:00 +0000", time.Date(2020, time.January, 6, 10, 0, 0, 0, time.UTC)},
+		{"2020-01-01T12:00:00", time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)},
+		// The time of day that isn't given is now's.
+		{"2020-01-01", time.Date(2020, time.January, 1, 9, 30, 15, 0, time.UTC)},
+		{"01/02/2020", time.Date(2020, time.January, 2, 9, 30, 15, 0, time.UTC)},
+		{"02.01.2020", time.Date(2020, time.January, 2, 9, 30, 15, 0, time.UTC)},
+		{"5 Jan 2019", time.Date(2019, time.January, 5, 9, 30, 15, 0, time.UTC)},
+		// A month after now is in the previous year.
+		{"Dec 02", time.Date(2019, time.December, 2, 9, 30, 15, 0, time.UTC)},
+		{"10:45", time.Date(2020, time.March, 11, 10, 45, 0, 0, time.UTC)},
+		{"3pm", time.Date(2020, time.March, 11, 15, 0, 0, 0, time.UTC)},
+		{"yesterday", time.Date(2020, time.March, 10, 9, 30, 15, 0, time.UTC)},
+		{"midnight", time.Date(2020, time.March, 11, 0, 0, 0, 0, time.UTC)},
+		// It's before noon, so it's yesterday's.
+		{"noon", time.Date(2020, time.March, 10, 12, 0, 0, 0, time.UTC)},
+		{"2 weeks ago", time.Date(2020, time.February, 26, 9, 30, 15, 0, time.UTC)},
+		{"3.days.ago", time.Date(2020, time.March, 8, 9, 30, 15, 0, time.UTC)},
+		{"one hour ago", time.Date(2020, time.March, 11, 8, 30, 15, 0, time.UTC)},
+		{"last friday", time.Date(2020, time.March, 6, 9, 30, 15, 0, time.UTC)},
+		{"1 month ago", time.Date(2020, time.February, 11, 9, 30, 15, 0, time.UTC)},
+		{"2 years ago", time.Date(2018, time.March, 11, 9, 30, 15, 0, time.UTC)},
+		{"never", time.Unix(0, 0)},
+		{"now", now},
+		{"garbage", now},
+	}
+	for _, tc := range tests {
+		if got := Approxidate(tc.date, now); !got.Equal(tc.want) {
+			t.Errorf("%q: got %v want %v", tc.date, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package git
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// The states of an attribute that doesn't have a value.
+const (
+	attrSet         = "set"
+	attrUnset       = "unset"
+	attrUnspecified = "unspecified"
+)
+
+// An attrRule is a line of a gitattributes file, which gives the attributes
+// in Attrs to the paths which match Pattern in the directory Scope.
+type attrRule struct {
+	Pattern string
+	Scope   string
+	Attrs   map[string]string
+}
+
+// matches returns whether the rule applies to the file p.
+func (r attrRule) matches(p IndexPath) bool {
+	rel := p.String()
+	if r.Scope != "" {
+		if !strings.HasPrefix(rel, r.Scope+"/") {
+			return false
+		}
+		rel = rel[len(r.Scope)+1:]
+	}
+	if !strings.Contains(r.Pattern, "/") {
+		m, _ := filepath.Match(r.Pattern, path.Base(rel))
+		return m
+	}
+	// Patterns with a slash are relative to the directory that they're
+	// in, like gitignore patterns with one.
+	return matchesGlob("/"+rel, false, "/"+strings.TrimPrefix(r.Pattern, "/"))
+}
+
+// gitAttributes looks up the attributes of files from the .gitattributes
+// files in the work tree, $GIT_DIR/info/attributes and core.attributesFile.
+type gitAttributes struct {
+	c *Client
+
+	global, info []attrRule
+
+	// The rules from the .gitattributes in each directory, which are
+	// read the first time that they're needed.
+	dirs map[string][]attrRule
+}
+
+func loadAttributes(c *Client) (*gitAttributes, error) {
+	a := &gitAttributes{c: c, dirs: make(map[string][]attrRule)}
+	if global := c.GetConfig("core.attributesFile"); global != "" {
+		rules, err := parseAttributes(global, "")
+		if err != nil {
+			return nil, err
+		}
+		a.global = rules
+	}
+	info, err := parseAttributes(filepath.Join(c.GitDir.String(), "info/attributes"), "")
+	if err != nil {
+		return nil, err
+	}
+	a.info = info
+	return a, nil
+}
+
+// parseAttributes reads the rules for the directory scope from the
+// attributes file filename, which may not exist.
+func parseAttributes(filename, scope string) ([]attrRule, error) {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []attrRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "[attr]") {
+			// Macros other than the builtin binary macro aren't
+			// supported.
+			continue
+		}
+		rule := attrRule{Pattern: fields[0], Scope: scope, Attrs: make(map[string]string)}
+		for _, attr := range fields[1:] {
+			switch {
+			case attr == "binary":
+				rule.Attrs["binary"] = attrSet
+				rule.Attrs["diff"] = attrUnset
+				rule.Attrs["merge"] = attrUnset
+				rule.Attrs["text"] = attrUnset
+			case attr[0] == '-':
+				rule.Attrs[attr[1:]] = attrUnset
+			case attr[0] == '!':
+				rule.Attrs[attr[1:]] = attrUnspecified
+			case strings.Contains(attr, "="):
+				kv := strings.SplitN(attr, "=", 2)
+				rule.Attrs[kv[0]] = kv[1]
+			default:
+				rule.Attrs[attr] = attrSet
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+func (a *gitAttributes) dirRules(dir string) ([]attrRule, error) {
+	if rules, ok := a.dirs[dir]; ok {
+		return rules, nil
+	}
+	if a.c.WorkDir == "" {
+		return nil, nil
+	}
+	rules, err := parseAttributes(filepath.Join(a.c.WorkDir.String(), dir, ".gitattributes"), dir)
+	if err != nil {
+		return nil, err
+	}
+	a.dirs[dir] = rules
+	return rules, nil
+}
+
+// Get returns the value of the attribute name for the file p. It's one of
+// attrSet, attrUnset or attrUnspecified, unless it has a value.
+func (a *gitAttributes) Get(p IndexPath, name string) (string, error) {
+	// From the lowest precedence to the highest.
+	sources := [][]attrRule{a.global}
+	var dirs []string
+	for dir := path.Dir(p.String()); dir != "."; dir = path.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+	}
+	for _, dir := range append([]string{""}, dirs...) {
+		rules, err := a.dirRules(dir)
+		if err != nil {
+			return "", err
+		}
+		sources = append(sources, rules)
+	}
+	sources = append(sources, a.info)
+
+	val := attrUnspecified
+	for _, rules := range sources {
+		for _, rule := range rules {
+			if v, ok := rule.Attrs[name]; ok && rule.matches(p) {
+				val = v
+			}
+		}
+	}
+	return val, nil
+}
+
+// isBinaryDiff returns whether the change from src to dst of the file p
+// is shown as a binary diff. The diff attribute decides if it's set or
+// unset, and otherwise files with NULs are binary.
+func (a *gitAttributes) isBinaryDiff(p IndexPath, src, dst []byte) (bool, error) {
+	diff, err := a.Get(p, "diff")
+	if err != nil {
+		return false, err
+	}
+	switch diff {
+	case attrUnset:
+		return true, nil
+	case attrSet:
+		return false, nil
+	}
+	return isBinary(src) || isBinary(dst), nil
+}
@@ -0,0 +1,72 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestAttributes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitattributes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := Init(nil, InitOptions{Quiet: true}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir+"/sub/deeper", 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		".gitattributes":            "*.txt -diff\n# A comment\nsmall.bin diff\n/top.dat binary\n",
+		"sub/.gitattributes":        "*.txt diff\nsub.bin !diff foo=bar\n",
+		".git/info/attributes":      "override.txt -diff\n",
+		"sub/deeper/.gitattributes": "deeper/*.c binary\n",
+	} {
+		if err := ioutil.WriteFile(dir+"/"+name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	attrs, err := loadAttributes(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path, attr, want string
+	}{
+		{"a.txt", "diff", attrUnset},
+		{"sub/a.txt", "diff", attrSet},
+		{"sub/override.txt", "diff", attrUnset},
+		{"small.bin", "diff", attrSet},
+		{"sub/small.bin", "diff", attrSet},
+		{"top.dat", "binary", attrSet},
+		{"top.dat", "text", attrUnset},
+		{"sub/top.dat", "diff", attrUnspecified},
+		{"sub/sub.bin", "diff", attrUnspecified},
+		{"sub/sub.bin", "foo", "bar"},
+		{"sub/deeper/x.c", "diff", attrUnspecified},
+		{"a.go", "diff", attrUnspecified},
+	}
+	for _, tc := range tests {
+		got, err := attrs.Get(IndexPath(tc.path), tc.attr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("%v of %v: got %v want %v", tc.attr, tc.path, got, tc.want)
+		}
+	}
+
+	binary, err := attrs.isBinaryDiff("a.go", []byte("text"), []byte("text\x00"))
+	if err != nil || !binary {
+		t.Errorf("Expected file with NUL to be binary")
+	}
+	binary, err = attrs.isBinaryDiff("small.bin", []byte("text"), []byte("text\x00"))
+	if err != nil || binary {
+		t.Errorf("Expected diff attribute to make binary file text")
+	}
+}
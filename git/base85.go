@@ -0,0 +1,72 @@
+package git
+
+import (
+	"fmt"
+)
+
+// The alphabet of the base85 encoding used by git's binary patches.
+const base85Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz!#$%&()*+-;<=>?@^_`{|}~"
+
+var base85Values [256]int
+
+func init() {
+	for i := range base85Values {
+		base85Values[i] = -1
+	}
+	for i := 0; i < len(base85Alphabet); i++ {
+		base85Values[base85Alphabet[i]] = i
+	}
+}
+
+// encodeBase85 encodes data in groups of 4 bytes, with the last group
+// padded with zeros, as 5 characters each.
+func encodeBase85(data []byte) []byte {
+	ret := make([]byte, 0, (len(data)+3)/4*5)
+	for len(data) > 0 {
+		var acc uint32
+		for i := 0; i < 4; i++ {
+			acc <<= 8
+			if i < len(data) {
+				acc |= uint32(data[i])
+			}
+		}
+		var group [5]byte
+		for i := 4; i >= 0; i-- {
+			group[i] = base85Alphabet[acc%85]
+			acc /= 85
+		}
+		ret = append(ret, group[:]...)
+		if len(data) < 4 {
+			break
+		}
+		data = data[4:]
+	}
+	return ret
+}
+
+// decodeBase85 decodes the first n bytes encoded in text by encodeBase85.
+func decodeBase85(text []byte, n int) ([]byte, error) {
+	if len(text) != (n+3)/4*5 {
+		return nil, fmt.Errorf("Invalid base85 length")
+	}
+	ret := make([]byte, 0, n)
+	for ; n > 0; text = text[5:] {
+		var acc uint64
+		for i := 0; i < 5; i++ {
+			v := base85Values[text[i]]
+			if v < 0 {
+				return nil, fmt.Errorf("Invalid base85 character %q", text[i])
+			}
+			acc = acc*85 + uint64(v)
+		}
+		if acc > 0xffffffff {
+			return nil, fmt.Errorf("Invalid base85 sequence %s", text[:5])
+		}
+		for i := 0; i < 4 && n > 0; i++ {
+			ret = append(ret, byte(acc>>24))
+			acc <<= 8
+			n--
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,297 @@
+package git
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/driusan/dgit/git/delta"
+)
+
+// writeBinaryHunk writes a hunk of a "GIT binary patch" which changes src
+// to dst. Like git, it's a delta against src if that's smaller than the
+// literal contents of dst once it's compressed.
+func writeBinaryHunk(w io.Writer, src, dst []byte) error {
+	literal, err := deflateBinary(dst)
+	if err != nil {
+		return err
+	}
+	header, data := fmt.Sprintf("literal %d\n", len(dst)), literal
+	if len(src) > 0 && len(dst) > 0 {
+		var d bytes.Buffer
+		// An error means that the delta would be too big to be worth
+		// using.
+		if err := delta.Calculate(&d, src, dst, len(literal)); err == nil {
+			compressed, err := deflateBinary(d.Bytes())
+			if err != nil {
+				return err
+			}
+			if len(compressed) < len(literal) {
+				header, data = fmt.Sprintf("delta %d\n", d.Len()), compressed
+			}
+		}
+	}
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+	// Each line is the number of bytes encoded on it, as a letter, and up
+	// to 52 bytes encoded in base85.
+	for len(data) > 0 {
+		n := len(data)
+		if n > 52 {
+			n = 52
+		}
+		var length byte
+		if n <= 26 {
+			length = byte('A' + n - 1)
+		} else {
+			length = byte('a' + n - 27)
+		}
+		if _, err := fmt.Fprintf(w, "%c%s\n", length, encodeBase85(data[:n])); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func deflateBinary(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// A binaryHunk is one direction of a "GIT binary patch". Data is either the
+// new contents of the file or, if Delta is set, a delta against the old
+// contents.
+type binaryHunk struct {
+	Delta bool
+	Data  []byte
+}
+
+// parseBinaryHunk parses the binary hunk at the start of lines and returns
+// it and the lines after it.
+func parseBinaryHunk(lines []string) (*binaryHunk, []string, error) {
+	if len(lines) == 0 {
+		return nil, nil, fmt.Errorf("Missing binary patch data")
+	}
+	hunk := &binaryHunk{}
+	var sizeStr string
+	switch {
+	case strings.HasPrefix(lines[0], "literal "):
+		sizeStr = lines[0][8:]
+	case strings.HasPrefix(lines[0], "delta "):
+		hunk.Delta = true
+		sizeStr = lines[0][6:]
+	default:
+		return nil, nil, fmt.Errorf("Unrecognized binary patch line: %v", lines[0])
+	}
+	size, err := strconv.Atoi(sizeStr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Invalid binary patch size: %v", sizeStr)
+	}
+
+	var compressed []byte
+	lines = lines[1:]
+	for len(lines) > 0 && lines[0] != "" {
+		line := lines[0]
+		var n int
+		switch {
+		case line[0] >= 'A' && line[0] <= 'Z':
+			n = int(line[0]-'A') + 1
+		case line[0] >= 'a' && line[0] <= 'z':
+			n = int(line[0]-'a') + 27
+		default:
+			return nil, nil, fmt.Errorf("Corrupt binary patch line: %v", line)
+		}
+		data, err := decodeBase85([]byte(line[1:]), n)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Corrupt binary patch line: %v", line)
+		}
+		compressed = append(compressed, data...)
+		lines = lines[1:]
+	}
+	if len(lines) > 0 {
+		// Skip the blank line that ends the hunk.
+		lines = lines[1:]
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer zr.Close()
+	if hunk.Data, err = ioutil.ReadAll(zr); err != nil {
+		return nil, nil, err
+	}
+	if len(hunk.Data) != size {
+		return nil, nil, fmt.Errorf("Binary patch is %d bytes, not %d", len(hunk.Data), size)
+	}
+	return hunk, lines, nil
+}
+
+// apply returns the result of applying h to src.
+func (h *binaryHunk) apply(src []byte) ([]byte, error) {
+	if !h.Delta {
+		return h.Data, nil
+	}
+	r := delta.NewReader(bytes.NewReader(h.Data), bytes.NewReader(src))
+	return ioutil.ReadAll(&r)
+}
+
+// A binaryFilePatch is the "GIT binary patch" of a file, which changes it
+// from the object OldSha to NewSha. Reverse is nil if the patch can't be
+// applied in reverse.
+type binaryFilePatch struct {
+	Name             IndexPath
+	OldSha, NewSha   Sha1
+	Forward, Reverse *binaryHunk
+}
+
+var (
+	diffGitRE   = regexp.MustCompile(`(?m)^diff --git `)
+	binaryIdxRE = regexp.MustCompile(`^index ([[:xdigit:]]+)\.\.([[:xdigit:]]+)`)
+)
+
+// splitBinaryPatches separates the files with a "GIT binary patch" in
+// patch from the rest of it, which is returned as text.
+func splitBinaryPatches(patch string) (string, []binaryFilePatch, error) {
+	starts := diffGitRE.FindAllStringIndex(patch, -1)
+	if len(starts) == 0 {
+		return patch, nil, nil
+	}
+	text := patch[:starts[0][0]]
+	var binaries []binaryFilePatch
+	for i, start := range starts {
+		end := len(patch)
+		if i < len(starts)-1 {
+			end = starts[i+1][0]
+		}
+		chunk := patch[start[0]:end]
+		if !strings.Contains(chunk, "\nGIT binary patch\n") {
+			text += chunk
+			continue
+		}
+		p, err := parseBinaryFilePatch(chunk)
+		if err != nil {
+			return "", nil, err
+		}
+		binaries = append(binaries, p)
+	}
+	return text, binaries, nil
+}
+
+func parseBinaryFilePatch(chunk string) (binaryFilePatch, error) {
+	var p binaryFilePatch
+	lines := strings.Split(chunk, "\n")
+	fields := strings.Fields(lines[0])
+	if len(fields) != 4 || !strings.HasPrefix(fields[3], "b/") {
+		return p, fmt.Errorf("Invalid patch header: %v", lines[0])
+	}
+	p.Name = IndexPath(fields[3][2:])
+
+	fullIndex := false
+	for lines = lines[1:]; len(lines) > 0 && lines[0] != "GIT binary patch"; lines = lines[1:] {
+		if strings.HasPrefix(lines[0], "rename to ") || strings.HasPrefix(lines[0], "copy to ") {
+			return p, fmt.Errorf("Binary patches which rename or copy %v are not supported", p.Name)
+		}
+		m := binaryIdxRE.FindStringSubmatch(lines[0])
+		if m == nil || len(m[1]) != 40 || len(m[2]) != 40 {
+			continue
+		}
+		oldSha, err := Sha1FromString(m[1])
+		if err != nil {
+			return p, err
+		}
+		newSha, err := Sha1FromString(m[2])
+		if err != nil {
+			return p, err
+		}
+		p.OldSha, p.NewSha, fullIndex = oldSha, newSha, true
+	}
+	if !fullIndex {
+		return p, fmt.Errorf("cannot apply binary patch to '%v' without full index line", p.Name)
+	}
+
+	forward, lines, err := parseBinaryHunk(lines[1:])
+	if err != nil {
+		return p, err
+	}
+	p.Forward = forward
+	if len(lines) > 0 && lines[0] != "" {
+		reverse, _, err := parseBinaryHunk(lines)
+		if err != nil {
+			return p, err
+		}
+		p.Reverse = reverse
+	}
+	return p, nil
+}
+
+// apply applies p, or its reverse, to the copy of the work tree in dir.
+// It returns whether the file was deleted.
+func (p binaryFilePatch) apply(dir string, reverse bool) (bool, error) {
+	pre, post, hunk := p.OldSha, p.NewSha, p.Forward
+	if reverse {
+		pre, post, hunk = p.NewSha, p.OldSha, p.Reverse
+		if hunk == nil {
+			return false, fmt.Errorf("cannot reverse-apply a binary patch without the reverse hunk to '%v'", p.Name)
+		}
+	}
+	filename := filepath.Join(dir, p.Name.String())
+	src, err := ioutil.ReadFile(filename)
+	switch {
+	case os.IsNotExist(err):
+		if pre != (Sha1{}) {
+			return false, fmt.Errorf("%v: does not exist in working directory", p.Name)
+		}
+	case err != nil:
+		return false, err
+	case pre == (Sha1{}):
+		return false, fmt.Errorf("%v: already exists in working directory", p.Name)
+	default:
+		sha, _, err := HashSlice("blob", src)
+		if err != nil {
+			return false, err
+		}
+		if sha != pre {
+			return false, fmt.Errorf("the patch applies to '%v' (%v), which does not match the current contents.", p.Name, pre)
+		}
+	}
+
+	dst, err := hunk.apply(src)
+	if err != nil {
+		return false, err
+	}
+	if post == (Sha1{}) {
+		if len(dst) != 0 {
+			return false, fmt.Errorf("removal patch leaves file contents for %v", p.Name)
+		}
+		return true, os.Remove(filename)
+	}
+	sha, _, err := HashSlice("blob", dst)
+	if err != nil {
+		return false, err
+	}
+	if sha != post {
+		return false, fmt.Errorf("binary patch to '%v' creates incorrect result (expecting %v, got %v)", p.Name, post, sha)
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return false, err
+	}
+	return false, ioutil.WriteFile(filename, dst, 0644)
+}
@@ -0,0 +1,104 @@
+package git
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBase85(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want string
+	}{
+		{[]byte{0, 0, 0, 0}, "00000"},
+		{[]byte{0xff, 0xff, 0xff, 0xff}, "|NsC0"},
+		{[]byte("abc"), "VPazd"},
+		{[]byte("hello world"), "Xk~0{Zy<MXa%^M("},
+	}
+	for _, tc := range tests {
+		if got := string(encodeBase85(tc.data)); got != tc.want {
+			t.Errorf("Encoding %q: got %q want %q", tc.data, got, tc.want)
+		}
+		got, err := decodeBase85([]byte(tc.want), len(tc.data))
+		if err != nil {
+			t.Errorf("Decoding %q: %v", tc.want, err)
+		} else if !bytes.Equal(got, tc.data) {
+			t.Errorf("Decoding %q: got %q want %q", tc.want, got, tc.data)
+		}
+	}
+	for _, bad := range []string{"0000", "0000\"", "|NsC1"} {
+		if _, err := decodeBase85([]byte(bad), 4); err == nil {
+			t.Errorf("Expected %q to be invalid", bad)
+		}
+	}
+}
+
+// TestBinaryPatchRoundTrip tests that a binary patch generated by diff
+// --binary can be applied in either direction.
+func TestBinaryPatchRoundTrip(t *testing.T) {
+	var orig bytes.Buffer
+	for i := 0; i < 500; i++ {
+		orig.WriteString(string([]byte{byte(i), 0, byte(i * 7), byte(i / 3)}))
+	}
+	changed := strings.Replace(orig.String(), "\x10\x00\x70\x05", "changed", 1)
+	c, dir := testMergeSetup(t,
+		map[string]string{"bin": orig.String()},
+		map[string]string{"bin": changed, "new": "new\x00file"},
+		map[string]string{"other": "other\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	diffs, err := Diff(c, DiffOptions{Revisions: []string{"topic...master"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var patch bytes.Buffer
+	if err := GeneratePatch(c, DiffCommonOptions{Patch: true, Binary: true}, diffs, &patch); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"GIT binary patch\ndelta ", "GIT binary patch\nliteral 8\n", "\nliteral 0\n"} {
+		if !strings.Contains(patch.String(), want) {
+			t.Errorf("Expected patch to contain %q, got %q", want, patch.String())
+		}
+	}
+	if err := ioutil.WriteFile("binary.patch", patch.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Apply(c, ApplyOptions{Reverse: true}, []File{"binary.patch"}); err != nil {
+		t.Fatalf("Could not reverse binary patch: %v", err)
+	}
+	if content, err := ioutil.ReadFile("bin"); err != nil || string(content) != orig.String() {
+		t.Errorf("Unexpected content of bin after reversing patch: %q (%v)", content, err)
+	}
+	if _, err := os.Stat("new"); !os.IsNotExist(err) {
+		t.Errorf("Expected new to be deleted by reversing patch, got %v", err)
+	}
+
+	if err := Apply(c, ApplyOptions{}, []File{"binary.patch"}); err != nil {
+		t.Fatalf("Could not apply binary patch: %v", err)
+	}
+	if content, err := ioutil.ReadFile("bin"); err != nil || string(content) != changed {
+		t.Errorf("Unexpected content of bin after applying patch: %q (%v)", content, err)
+	}
+	if content, err := ioutil.ReadFile("new"); err != nil || string(content) != "new\x00file" {
+		t.Errorf("Unexpected content of new after applying patch: %q (%v)", content, err)
+	}
+
+	// The patch no longer applies, since it's already been applied.
+	if err := Apply(c, ApplyOptions{}, []File{"binary.patch"}); err == nil {
+		t.Error("Expected error applying binary patch twice")
+	}
+
+	// Without --binary, it's just a note that the files differ.
+	patch.Reset()
+	if err := GeneratePatch(c, DiffCommonOptions{Patch: true}, diffs, &patch); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(patch.String(), "Binary files a/bin and b/bin differ\n") || strings.Contains(patch.String(), "GIT binary patch") {
+		t.Errorf("Unexpected patch without --binary: %q", patch.String())
+	}
+}
@@ -0,0 +1,848 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"math/bits"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// The state of a bisection is kept in the same files as git uses, so that
+// either can be used to continue it. BISECT_START has the branch (or
+// commit, if HEAD was detached) which was checked out when it started,
+// BISECT_LOG has the commands which were run, BISECT_NAMES has the paths
+// that the bisection is limited to, and the commits that have been marked
+// are in refs/bisect/bad, refs/bisect/good-<sha> and
+// refs/bisect/skip-<sha>.
+
+// bisectResult is the state of a bisection after looking for the next
+// commit to test.
+type bisectResult int
+
+const (
+	// More commits need to be tested, and the next one has been checked
+	// out.
+	bisectContinue = bisectResult(iota)
+
+	// The bisection needs a good or bad commit before it can start.
+	bisectWaiting
+
+	// The first bad commit has been found.
+	bisectFound
+
+	// Only skipped commits are left to test, so the first bad commit
+	// can't be determined.
+	bisectOnlySkipped
+)
+
+// bisectState is the set of commits which have been marked in a
+// bisection.
+type bisectState struct {
+	Bad  CommitID
+	Good []CommitID
+	Skip []CommitID
+
+	// The paths that the bisection is limited to.
+	Paths []string
+}
+
+func (c *Client) bisectInProgress() bool {
+	return c.GitDir.File("BISECT_START").Exists()
+}
+
+// loadBisect reads the commits that have been marked from refs/bisect.
+func loadBisect(c *Client) (bisectState, error) {
+	var state bisectState
+	refs, err := c.Refs().ListRefs("refs/bisect/")
+	if err != nil {
+		return state, err
+	}
+	for _, name := range refs {
+		value, err := c.Refs().ReadRef(name)
+		if err != nil {
+			return state, err
+		}
+		sha, err := Sha1FromString(strings.TrimSpace(value))
+		if err != nil {
+			return state, err
+		}
+		switch term := strings.TrimPrefix(name, "refs/bisect/"); {
+		case term == "bad":
+			state.Bad = CommitID(sha)
+		case strings.HasPrefix(term, "good-"):
+			state.Good = append(state.Good, CommitID(sha))
+		case strings.HasPrefix(term, "skip-"):
+			state.Skip = append(state.Skip, CommitID(sha))
+		}
+	}
+	if names, err := c.GitDir.ReadFile("BISECT_NAMES"); err == nil {
+		if state.Paths, err = sqSplit(strings.TrimSpace(string(names))); err != nil {
+			return state, err
+		}
+	}
+	return state, nil
+}
+
+// removeBisectState removes all the state of the bisection in progress.
+func (c *Client) removeBisectState() error {
+	refs, err := c.Refs().ListRefs("refs/bisect/")
+	if err != nil {
+		return err
+	}
+	for _, name := range refs {
+		if err := c.Refs().DeleteRef(name); err != nil {
+			return err
+		}
+	}
+	for _, name := range []string{"BISECT_START", "BISECT_LOG", "BISECT_NAMES", "BISECT_TERMS", "BISECT_EXPECTED_REV", "BISECT_ANCESTORS_OK"} {
+		if err := os.RemoveAll(c.GitDir.File(File(name)).String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendBisectLog adds lines to BISECT_LOG.
+func appendBisectLog(c *Client, lines string) error {
+	f, err := os.OpenFile(c.GitDir.File("BISECT_LOG").String(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprint(f, lines)
+	return err
+}
+
+// sqQuote quotes s for the shell, the same way that git quotes the
+// arguments in BISECT_LOG.
+func sqQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// sqSplit splits s into words, undoing sqQuote.
+func sqSplit(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inword, quoted := false, false
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case ch == '\'':
+			quoted = !quoted
+			inword = true
+		case ch == '\\' && !quoted && i+1 < len(s):
+			i++
+			word.WriteByte(s[i])
+			inword = true
+		case (ch == ' ' || ch == '\t') && !quoted:
+			if inword {
+				words = append(words, word.String())
+				word.Reset()
+				inword = false
+			}
+		default:
+			word.WriteByte(ch)
+			inword = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("Unterminated quote in %v", s)
+	}
+	if inword {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// BisectStart starts a bisection. The first of revs is the bad commit, and
+// the rest are good. If paths are given, only commits which touch them
+// are tested.
+func BisectStart(c *Client, revs, paths []string) error {
+	_, err := bisectStart(c, revs, paths, true)
+	return err
+}
+
+func bisectStart(c *Client, revs, paths []string, next bool) (bisectResult, error) {
+	var marks []CommitID
+	for _, rev := range revs {
+		cmt, err := RevParseCommitish(c, &RevParseOptions{}, rev)
+		if err != nil {
+			return bisectWaiting, fmt.Errorf("'%v' does not appear to be a valid revision", rev)
+		}
+		id, err := cmt.CommitID(c)
+		if err != nil {
+			return bisectWaiting, err
+		}
+		marks = append(marks, id)
+	}
+
+	// Starting again keeps the original HEAD from the bisection in
+	// progress.
+	start, err := c.GitDir.ReadFile("BISECT_START")
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return bisectWaiting, err
+		}
+		if branch := c.GetHeadBranch(); branch != "" {
+			start = []byte(branch.BranchName())
+		} else {
+			head, err := c.GetHeadCommit()
+			if err != nil {
+				return bisectWaiting, err
+			}
+			start = []byte(head.String())
+		}
+	}
+	if err := c.removeBisectState(); err != nil {
+		return bisectWaiting, err
+	}
+	if err := c.GitDir.WriteFile("BISECT_START", append(start, '\n'), 0644); err != nil {
+		return bisectWaiting, err
+	}
+	if err := c.GitDir.WriteFile("BISECT_TERMS", []byte("bad\ngood\n"), 0644); err != nil {
+		return bisectWaiting, err
+	}
+	// The paths are relative to the current directory, but they're
+	// saved relative to the top of the work tree.
+	var names []string
+	for _, p := range paths {
+		ip, err := File(p).IndexPath(c)
+		if err != nil {
+			return bisectWaiting, err
+		}
+		names = append(names, sqQuote(ip.String()))
+	}
+	if err := c.GitDir.WriteFile("BISECT_NAMES", []byte(strings.Join(names, " ")+"\n"), 0644); err != nil {
+		return bisectWaiting, err
+	}
+
+	var log strings.Builder
+	for i, cmt := range marks {
+		term := "good"
+		if i == 0 {
+			term = "bad"
+		}
+		line, err := bisectMark(c, term, cmt)
+		if err != nil {
+			return bisectWaiting, err
+		}
+		log.WriteString(line)
+	}
+	log.WriteString("git bisect start")
+	for _, rev := range revs {
+		log.WriteString(" " + sqQuote(rev))
+	}
+	if len(names) > 0 {
+		log.WriteString(" " + sqQuote("--") + " " + strings.Join(names, " "))
+	}
+	log.WriteString("\n")
+	if err := appendBisectLog(c, log.String()); err != nil {
+		return bisectWaiting, err
+	}
+	if !next {
+		return bisectWaiting, nil
+	}
+	return bisectNext(c)
+}
+
+// bisectMark records that cmt is good, bad or skipped, and returns a
+// comment describing it for the log.
+func bisectMark(c *Client, term string, cmt CommitID) (string, error) {
+	ref := "refs/bisect/bad"
+	switch term {
+	case "bad":
+	case "good", "skip":
+		ref = "refs/bisect/" + term + "-" + cmt.String()
+	default:
+		return "", fmt.Errorf("Invalid command: you're currently in a bad/good bisect")
+	}
+	if err := UpdateRef(c, UpdateRefOptions{}, ref, cmt, ""); err != nil {
+		return "", err
+	}
+	msg, err := cmt.GetCommitMessage(c)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("# %v: [%v] %v\n", term, cmt, msg.Subject()), nil
+}
+
+// BisectMark marks revs as good, bad or skipped (according to term) in
+// the bisection in progress, and checks out the next commit to test. If
+// revs is empty, HEAD is marked.
+func BisectMark(c *Client, term string, revs []string) error {
+	_, err := bisectMarkRevs(c, term, revs)
+	return err
+}
+
+func bisectMarkRevs(c *Client, term string, revs []string) (bisectResult, error) {
+	if !c.bisectInProgress() {
+		return bisectWaiting, fmt.Errorf("You need to start by \"dgit bisect start\"")
+	}
+	if len(revs) == 0 {
+		revs = []string{"HEAD"}
+	}
+	if term == "bad" && len(revs) > 1 {
+		return bisectWaiting, fmt.Errorf("'dgit bisect bad' can take only one argument.")
+	}
+	var log strings.Builder
+	for _, rev := range revs {
+		cmt, err := RevParseCommitish(c, &RevParseOptions{}, rev)
+		if err != nil {
+			return bisectWaiting, fmt.Errorf("Bad rev input: %v", rev)
+		}
+		id, err := cmt.CommitID(c)
+		if err != nil {
+			return bisectWaiting, err
+		}
+		comment, err := bisectMark(c, term, id)
+		if err != nil {
+			return bisectWaiting, err
+		}
+		fmt.Fprintf(&log, "%vgit bisect %v %v\n", comment, term, id)
+	}
+	if err := appendBisectLog(c, log.String()); err != nil {
+		return bisectWaiting, err
+	}
+	return bisectNext(c)
+}
+
+// bisectRange returns the commits reachable from the bad commit but not
+// any good one, newest first.
+func bisectRange(c *Client, state bisectState) ([]CommitID, error) {
+	excludes := make([]Commitish, 0, len(state.Good))
+	for _, g := range state.Good {
+		excludes = append(excludes, g)
+	}
+	revs, err := RevList(c, RevListOptions{Quiet: true}, nil, []Commitish{state.Bad}, excludes)
+	if err != nil {
+		return nil, err
+	}
+	commits := make([]CommitID, len(revs))
+	for i, s := range revs {
+		commits[i] = CommitID(s)
+	}
+	return commits, nil
+}
+
+// bisectCandidates returns the commits in revs which could be the first
+// bad commit. If the bisection is limited to some paths, only commits
+// which touch them are candidates. The bad commit is always included.
+func bisectCandidates(c *Client, state bisectState, revs []CommitID) ([]CommitID, error) {
+	if len(state.Paths) == 0 {
+		return revs, nil
+	}
+	candidates := make([]CommitID, 0, len(revs))
+	for _, cmt := range revs {
+		if cmt != state.Bad {
+			touches, err := commitTouchesPaths(c, cmt, state.Paths)
+			if err != nil {
+				return nil, err
+			}
+			if !touches {
+				continue
+			}
+		}
+		candidates = append(candidates, cmt)
+	}
+	return candidates, nil
+}
+
+// commitTouchesPaths returns true if cmt changes any of paths relative to
+// every one of its parents.
+func commitTouchesPaths(c *Client, cmt CommitID, paths []string) (bool, error) {
+	touches := func(diffs []HashDiff) bool {
+		for _, d := range diffs {
+			for _, p := range paths {
+				if p == "" || p == "." || d.Name.String() == p || strings.HasPrefix(d.Name.String(), strings.TrimSuffix(p, "/")+"/") {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	parents, err := cmt.Parents(c)
+	if err != nil {
+		return false, err
+	}
+	if len(parents) == 0 {
+		diffs, err := DiffTree(c, &DiffTreeOptions{Recurse: true, Root: true}, cmt, nil, nil)
+		return touches(diffs), err
+	}
+	for _, p := range parents {
+		diffs, err := DiffTree(c, &DiffTreeOptions{Recurse: true}, p, cmt, nil)
+		if err != nil {
+			return false, err
+		}
+		if !touches(diffs) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// bisectWeights returns the number of candidates reachable from each
+// candidate, including itself, without leaving the range of commits
+// being bisected.
+func bisectWeights(c *Client, revs, candidates []CommitID) (map[CommitID]int, error) {
+	inRange := make(map[CommitID]bool)
+	for _, cmt := range revs {
+		inRange[cmt] = true
+	}
+	isCandidate := make(map[CommitID]bool)
+	for _, cmt := range candidates {
+		isCandidate[cmt] = true
+	}
+	parentCache := make(map[CommitID][]CommitID)
+	weights := make(map[CommitID]int)
+	for _, cmt := range candidates {
+		seen := map[CommitID]bool{cmt: true}
+		queue := []CommitID{cmt}
+		for len(queue) > 0 {
+			cur := queue[0]
+			queue = queue[1:]
+			if isCandidate[cur] {
+				weights[cmt]++
+			}
+			parents, ok := parentCache[cur]
+			if !ok {
+				var err error
+				if parents, err = cur.Parents(c); err != nil {
+					return nil, err
+				}
+				parentCache[cur] = parents
+			}
+			for _, p := range parents {
+				if inRange[p] && !seen[p] {
+					seen[p] = true
+					queue = append(queue, p)
+				}
+			}
+		}
+	}
+	return weights, nil
+}
+
+// bisectSteps estimates the number of steps left to bisect n commits, the
+// same way as git.
+func bisectSteps(n int) int {
+	if n < 3 {
+		return 0
+	}
+	log := bits.Len(uint(n)) - 1
+	e := 1 << uint(log)
+	if e < 3*(n-e) {
+		return log
+	}
+	return log - 1
+}
+
+// bisectNext checks out the next commit to test, or reports the first bad
+// commit if it's been found.
+func bisectNext(c *Client) (bisectResult, error) {
+	state, err := loadBisect(c)
+	if err != nil {
+		return bisectWaiting, err
+	}
+	switch {
+	case state.Bad == (CommitID{}) && len(state.Good) == 0:
+		fmt.Println("status: waiting for both good and bad commits")
+		return bisectWaiting, nil
+	case state.Bad == (CommitID{}):
+		fmt.Printf("status: waiting for bad commit, %d good commit%v known\n", len(state.Good), plural(len(state.Good)))
+		return bisectWaiting, nil
+	case len(state.Good) == 0:
+		fmt.Println("status: waiting for good commit(s), bad commit known")
+		return bisectWaiting, nil
+	}
+
+	skipped := make(map[CommitID]bool)
+	for _, s := range state.Skip {
+		skipped[s] = true
+	}
+
+	// The good commits need to be ancestors of the bad commit, so
+	// check the merge bases of any that aren't first.
+	if !c.GitDir.File("BISECT_ANCESTORS_OK").Exists() {
+		for _, good := range state.Good {
+			if good.IsAncestor(c, state.Bad) {
+				continue
+			}
+			base, err := MergeBase(c, MergeBaseOptions{}, []Commitish{state.Bad, good})
+			if err != nil {
+				return bisectWaiting, fmt.Errorf("Some good revs are not ancestors of the bad rev.\nThe bisection can not work properly in this case.")
+			}
+			if base == state.Bad {
+				return bisectWaiting, fmt.Errorf("The merge base %v is bad.\nThis means the bug has been fixed between %v and [%v].", base, base, good)
+			}
+			isGood := false
+			for _, g := range state.Good {
+				if g == base {
+					isGood = true
+				}
+			}
+			if isGood || skipped[base] {
+				continue
+			}
+			fmt.Println("Bisecting: a merge base must be tested")
+			return bisectContinue, bisectCheckout(c, base)
+		}
+		if err := c.GitDir.WriteFile("BISECT_ANCESTORS_OK", nil, 0644); err != nil {
+			return bisectWaiting, err
+		}
+	}
+
+	revs, err := bisectRange(c, state)
+	if err != nil {
+		return bisectWaiting, err
+	}
+	candidates, err := bisectCandidates(c, state, revs)
+	if err != nil {
+		return bisectWaiting, err
+	}
+	weights, err := bisectWeights(c, revs, candidates)
+	if err != nil {
+		return bisectWaiting, err
+	}
+	inRange := make(map[CommitID]bool)
+	for _, cmt := range revs {
+		inRange[cmt] = true
+	}
+	// Pick the commit that splits the candidates most evenly. Like
+	// git, go from the oldest commit and stop at the first one which
+	// is halfway, unless it's at the bottom of the range, and
+	// otherwise prefer the oldest of the equally good ones.
+	n := len(candidates)
+	var best CommitID
+	bestValue := -1
+	for i := n - 1; i >= 0; i-- {
+		cmt := candidates[i]
+		if cmt == state.Bad || skipped[cmt] {
+			continue
+		}
+		w := weights[cmt]
+		if d := 2*w - n; d >= -1 && d <= 1 {
+			parents, err := cmt.Parents(c)
+			if err != nil {
+				return bisectWaiting, err
+			}
+			bottom := true
+			for _, p := range parents {
+				if inRange[p] {
+					bottom = false
+				}
+			}
+			if !bottom {
+				best, bestValue = cmt, w
+				break
+			}
+		}
+		value := w
+		if n-value < value {
+			value = n - value
+		}
+		if value > bestValue {
+			best, bestValue = cmt, value
+		}
+	}
+
+	if bestValue < 0 {
+		var left []CommitID
+		for _, cmt := range candidates {
+			if skipped[cmt] {
+				left = append(left, cmt)
+			}
+		}
+		if len(left) == 0 {
+			return bisectFound, bisectFirstBad(c, state.Bad)
+		}
+		fmt.Println("There are only 'skipped' commits left to test.\nThe first bad commit could be any of:")
+		for _, cmt := range append(left, state.Bad) {
+			fmt.Println(cmt)
+		}
+		fmt.Println("We cannot bisect more!")
+		return bisectOnlySkipped, appendBisectLog(c, "# only skipped commits left to test\n")
+	}
+
+	left := n - weights[best] - 1
+	steps := bisectSteps(n)
+	fmt.Printf("Bisecting: %d revision%v left to test after this (roughly %d step%v)\n", left, plural(left), steps, plural(steps))
+	return bisectContinue, bisectCheckout(c, best)
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+// bisectCheckout checks out cmt to be tested.
+func bisectCheckout(c *Client, cmt CommitID) error {
+	if err := c.GitDir.WriteFile("BISECT_EXPECTED_REV", []byte(cmt.String()+"\n"), 0644); err != nil {
+		return err
+	}
+	if err := CheckoutCommit(c, CheckoutOptions{}, cmt); err != nil {
+		return err
+	}
+	msg, err := cmt.GetCommitMessage(c)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("[%v] %v\n", cmt, msg.Subject())
+	return nil
+}
+
+// bisectFirstBad reports that bad is the first bad commit.
+func bisectFirstBad(c *Client, bad CommitID) error {
+	fmt.Printf("%v is the first bad commit\n", bad)
+	output, err := bad.FormatMedium(c)
+	if err != nil {
+		return err
+	}
+	fmt.Print(output)
+
+	parents, err := bad.Parents(c)
+	if err != nil {
+		return err
+	}
+	var diffs []HashDiff
+	if len(parents) == 0 {
+		diffs, err = DiffTree(c, &DiffTreeOptions{Recurse: true, Root: true}, bad, nil, nil)
+	} else {
+		diffs, err = DiffTree(c, &DiffTreeOptions{Recurse: true}, parents[0], bad, nil)
+	}
+	if err != nil {
+		return err
+	}
+	stats, err := diffStats(c, diffs)
+	if err != nil {
+		return err
+	}
+	writeDiffStat(os.Stdout, stats, 80, 0, 0, 0)
+
+	msg, err := bad.GetCommitMessage(c)
+	if err != nil {
+		return err
+	}
+	return appendBisectLog(c, fmt.Sprintf("# first bad commit: [%v] %v\n", bad, msg.Subject()))
+}
+
+// BisectReset ends the bisection in progress, and checks out commit, or
+// the branch that was checked out when it started if commit is empty.
+func BisectReset(c *Client, commit string) error {
+	if !c.bisectInProgress() {
+		fmt.Println("We are not bisecting.")
+		return nil
+	}
+	if commit == "" {
+		start, err := c.GitDir.ReadFile("BISECT_START")
+		if err != nil {
+			return err
+		}
+		commit = strings.TrimSpace(string(start))
+	}
+	var target Commitish
+	if b := Branch("refs/heads/" + commit); b.Exists(c) {
+		target = b
+	} else {
+		cmt, err := RevParseCommitish(c, &RevParseOptions{}, commit)
+		if err != nil {
+			return fmt.Errorf("Could not check out original HEAD '%v'. Try 'dgit bisect reset <commit>'.", commit)
+		}
+		target = cmt
+	}
+	if err := CheckoutCommit(c, CheckoutOptions{}, target); err != nil {
+		return err
+	}
+	return c.removeBisectState()
+}
+
+// BisectLog returns the commands that have been run in the bisection in
+// progress.
+func BisectLog(c *Client) (string, error) {
+	if !c.bisectInProgress() {
+		return "", fmt.Errorf("We are not bisecting.")
+	}
+	log, err := c.GitDir.ReadFile("BISECT_LOG")
+	if err != nil {
+		return "", err
+	}
+	return string(log), nil
+}
+
+// BisectReplay restarts the bisection and replays the commands in the log
+// file, as produced by BisectLog.
+func BisectReplay(c *Client, logfile File) error {
+	f, err := os.Open(logfile.String())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if c.bisectInProgress() {
+		if err := BisectReset(c, ""); err != nil {
+			return err
+		}
+	}
+
+	started := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "git bisect "):
+			line = strings.TrimPrefix(line, "git bisect ")
+		case strings.HasPrefix(line, "git-bisect "):
+			line = strings.TrimPrefix(line, "git-bisect ")
+		default:
+			continue
+		}
+		words, err := sqSplit(line)
+		if err != nil {
+			return err
+		}
+		if len(words) == 0 {
+			continue
+		}
+		switch words[0] {
+		case "start":
+			var revs, paths []string
+			for i, w := range words[1:] {
+				if w == "--" {
+					paths = words[i+2:]
+					break
+				}
+				revs = append(revs, w)
+			}
+			if _, err := bisectStart(c, revs, paths, false); err != nil {
+				return err
+			}
+			started = true
+		case "good", "bad", "skip":
+			if !started {
+				return fmt.Errorf("Invalid bisect log: %v command before start", words[0])
+			}
+			var log strings.Builder
+			for _, rev := range words[1:] {
+				cmt, err := RevParseCommitish(c, &RevParseOptions{}, rev)
+				if err != nil {
+					return err
+				}
+				id, err := cmt.CommitID(c)
+				if err != nil {
+					return err
+				}
+				comment, err := bisectMark(c, words[0], id)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(&log, "%vgit bisect %v %v\n", comment, words[0], id)
+			}
+			if err := appendBisectLog(c, log.String()); err != nil {
+				return err
+			}
+		case "terms":
+		default:
+			return fmt.Errorf("Invalid bisect log: %v?", line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if !started {
+		return fmt.Errorf("No bisection in %v", logfile)
+	}
+	_, err = bisectNext(c)
+	return err
+}
+
+// BisectVisualize returns the commits which are left to test, newest
+// first.
+func BisectVisualize(c *Client) ([]CommitID, error) {
+	if !c.bisectInProgress() {
+		return nil, fmt.Errorf("We are not bisecting.")
+	}
+	state, err := loadBisect(c)
+	if err != nil {
+		return nil, err
+	}
+	if state.Bad == (CommitID{}) {
+		return nil, fmt.Errorf("No bad commit to visualize")
+	}
+	revs, err := bisectRange(c, state)
+	if err != nil {
+		return nil, err
+	}
+	return bisectCandidates(c, state, revs)
+}
+
+// BisectRun runs cmd to test each commit automatically until the first bad
+// commit is found. The commit is good if cmd exits with 0, bad if it
+// exits with 1 to 127, and skipped if it exits with 125.
+func BisectRun(c *Client, cmd []string) error {
+	if len(cmd) == 0 {
+		return fmt.Errorf("bisect run failed: no command provided.")
+	}
+	if !c.bisectInProgress() {
+		return fmt.Errorf("You need to start by \"dgit bisect start\"")
+	}
+	state, err := loadBisect(c)
+	if err != nil {
+		return err
+	}
+	if state.Bad == (CommitID{}) || len(state.Good) == 0 {
+		return fmt.Errorf("You need to give me at least one good and one bad revision.\n(You can use \"dgit bisect bad\" and \"dgit bisect good\" for that.)")
+	}
+
+	quoted := make([]string, len(cmd))
+	for i, arg := range cmd {
+		quoted[i] = sqQuote(arg)
+	}
+	for {
+		fmt.Printf("running  %v\n", strings.Join(quoted, " "))
+		// Like git, let the shell find the command, and pass any
+		// arguments through unchanged.
+		script := cmd[0]
+		if len(cmd) > 1 {
+			script += ` "$@"`
+		}
+		run := exec.Command(posixShell, append([]string{"-c", script}, cmd...)...)
+		run.Dir = c.WorkDir.String()
+		run.Stdin = os.Stdin
+		run.Stdout = os.Stdout
+		run.Stderr = os.Stderr
+		code := 0
+		if err := run.Run(); err != nil {
+			exiterr, ok := err.(*exec.ExitError)
+			if !ok {
+				return err
+			}
+			code = exiterr.ExitCode()
+		}
+
+		var term string
+		switch {
+		case code < 0 || code >= 128:
+			return fmt.Errorf("bisect run failed: exit code %d from '%v' is < 0 or >= 128", code, strings.Join(cmd, " "))
+		case code == 0:
+			term = "good"
+		case code == 125:
+			term = "skip"
+		default:
+			term = "bad"
+		}
+		result, err := bisectMarkRevs(c, term, nil)
+		if err != nil {
+			return fmt.Errorf("bisect run failed: %v", err)
+		}
+		switch result {
+		case bisectFound:
+			fmt.Println("bisect found first bad commit")
+			return nil
+		case bisectOnlySkipped:
+			return fmt.Errorf("bisect run cannot continue any more")
+		case bisectWaiting:
+			return fmt.Errorf("bisect run failed: bisection is waiting for more commits to be marked")
+		}
+	}
+}
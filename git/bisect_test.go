@@ -0,0 +1,143 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestBisect(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"n.txt": "0\n"},
+		map[string]string{"n.txt": "1\n"},
+		map[string]string{"other.txt": "other\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	// Make a history where the commit writing 6 introduced a bug.
+	var commits []CommitID
+	for i := 2; i <= 10; i++ {
+		if err := ioutil.WriteFile("n.txt", []byte(fmt.Sprintf("%d\n", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Add(c, AddOptions{}, []File{"n.txt"}); err != nil {
+			t.Fatal(err)
+		}
+		cmt, err := Commit(c, CommitOptions{}, CommitMessage(fmt.Sprintf("commit %d", i)), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commits = append(commits, cmt)
+	}
+	firstBad := commits[4]
+
+	if err := BisectStart(c, []string{"HEAD", commits[0].String()}, nil); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for i := 0; i < 10 && !found; i++ {
+		content, err := ioutil.ReadFile("n.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(string(content)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		term := "good"
+		if n >= 6 {
+			term = "bad"
+		}
+		result, err := bisectMarkRevs(c, term, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found = result == bisectFound
+	}
+	if !found {
+		t.Fatal("Bisect did not find the first bad commit")
+	}
+	state, err := loadBisect(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Bad != firstBad {
+		t.Errorf("Unexpected first bad commit: got %v want %v", state.Bad, firstBad)
+	}
+	log, err := BisectLog(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(log, "# first bad commit: ["+firstBad.String()+"] commit 6\n") {
+		t.Errorf("First bad commit not in log:\n%v", log)
+	}
+
+	if err := BisectReset(c, ""); err != nil {
+		t.Fatal(err)
+	}
+	if b := c.GetHeadBranch(); b != "refs/heads/master" {
+		t.Errorf("Unexpected branch after reset: got %v", b)
+	}
+	if c.bisectInProgress() {
+		t.Error("Bisect state left behind after reset")
+	}
+	if refs, _ := c.Refs().ListRefs("refs/bisect/"); len(refs) != 0 {
+		t.Errorf("Bisect refs left behind after reset: %v", refs)
+	}
+
+	// Replaying the log gets back to the same state.
+	logfile := File(dir + "/bisectlog")
+	if err := ioutil.WriteFile(logfile.String(), []byte(log), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := BisectReplay(c, logfile); err != nil {
+		t.Fatal(err)
+	}
+	if state, err := loadBisect(c); err != nil || state.Bad != firstBad {
+		t.Errorf("Unexpected bad commit after replay: got %v want %v", state.Bad, firstBad)
+	}
+	if err := BisectReset(c, ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBisectSteps(t *testing.T) {
+	for _, tc := range []struct {
+		n, want int
+	}{
+		{1, 0},
+		{2, 0},
+		{3, 1},
+		{8, 2},
+		{19, 3},
+		{24, 4},
+		{1000, 9},
+	} {
+		if got := bisectSteps(tc.n); got != tc.want {
+			t.Errorf("Unexpected steps for %d: got %d want %d", tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestSqSplit(t *testing.T) {
+	words := []string{"HEAD", "it's", "a b", ""}
+	var quoted []string
+	for _, w := range words {
+		quoted = append(quoted, sqQuote(w))
+	}
+	got, err := sqSplit(strings.Join(quoted, " "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(words) {
+		t.Fatalf("Unexpected words: got %q want %q", got, words)
+	}
+	for i := range words {
+		if got[i] != words[i] {
+			t.Errorf("Unexpected word %d: got %q want %q", i, got[i], words[i])
+		}
+	}
+}
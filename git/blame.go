@@ -0,0 +1,1115 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// BlameOptions are the options for blame and annotate.
+type BlameOptions struct {
+	// Only blame the lines in these ranges, in the format of
+	// git blame -L (ie. "n,m", "n,+k", "n,-k" or "/regex/").
+	LineRanges []string
+
+	// Print machine readable output, either with the commit information
+	// only the first time a commit is seen (Porcelain) or on every line
+	// (LinePorcelain).
+	Porcelain, LinePorcelain bool
+
+	// Print the output in the format of git annotate.
+	Annotate bool
+
+	// Ignore whitespace when comparing lines.
+	IgnoreWhitespace bool
+
+	// Detect lines which were moved within the file (DetectMoves) or
+	// copied from other files (DetectCopies). DetectCopies is the number
+	// of times -C was given: once looks in the files modified by the
+	// same commit, more than once looks in every file in the parent.
+	DetectMoves  bool
+	DetectCopies int
+
+	// Walk history forwards and show the last commit that each line
+	// existed in, instead of the commit which introduced it.
+	Reverse bool
+
+	// Commits to ignore. Lines changed by these commits are blamed on
+	// the most similar line they replaced in the commit's parent, and
+	// lines which aren't similar to any of them stay blamed on the
+	// ignored commit. Unlike git, lines are never matched outside of
+	// the lines that they replaced.
+	IgnoreRevs      []Commitish
+	IgnoreRevsFiles []File
+
+	// Options which affect the default output format.
+	LongHash       bool
+	SuppressAuthor bool
+	ShowEmail      bool
+	ShowNumber     bool
+	ShowName       bool
+}
+
+// The minimum number of alphanumeric characters in a block of lines for
+// it to be considered moved or copied, the same as git's defaults.
+const (
+	blameMoveScore = 20
+	blameCopyScore = 40
+)
+
+// blameLine is the origin of one line of the blamed file.
+type blameLine struct {
+	Commit CommitID
+	Path   IndexPath
+
+	// The line numbers, starting at 1, in the commit which introduced
+	// the line and in the blamed file.
+	OrigLine, FinalLine int
+
+	Content string
+
+	// Set if the commit is a root commit or at the edge of the range
+	// being blamed, so the line may be older.
+	Boundary bool
+}
+
+// blameOrigin is a file in a commit that lines are being blamed on. The
+// zero CommitID refers to the work tree.
+type blameOrigin struct {
+	Commit CommitID
+	Path   IndexPath
+}
+
+// blameEntry is a run of lines in the final file which are still being
+// blamed on an origin, and where they are in that origin. Line numbers
+// start at 0.
+type blameEntry struct {
+	Final, Suspect, Count int
+}
+
+type blameScoreboard struct {
+	c    *Client
+	opts BlameOptions
+	key  func(string) string
+	eq   func(x, y string) bool
+
+	// The commits to pass blame on to: the parents of each commit, or the
+	// children when walking in reverse.
+	neighbours map[CommitID][]CommitID
+	boundary   map[CommitID]bool
+	ignored    map[CommitID]bool
+
+	final   []string
+	pending map[CommitID]map[IndexPath][]blameEntry
+	lines   map[blameOrigin][]string
+	trees   map[CommitID]IndexMap
+
+	// The origin in the first neighbour that each origin was compared
+	// against, for the "previous" line of the porcelain output.
+	previous map[blameOrigin]blameOrigin
+
+	result []blameLine
+}
+
+// Blame writes the commit which last changed each line of path. If
+// includes is empty, the file in the work tree is blamed, with the
+// uncommitted lines shown as "Not Committed Yet". Excludes mark the
+// boundary of the history to look at. With opts.Reverse, excludes must
+// contain the single commit to start from.
+func Blame(c *Client, opts BlameOptions, w io.Writer, includes, excludes []Commitish, path File) error {
+	lines, previous, err := blame(c, opts, includes, excludes, path)
+	if err != nil {
+		return err
+	}
+	ipath, err := path.IndexPath(c)
+	if err != nil {
+		return err
+	}
+	switch {
+	case opts.Porcelain || opts.LinePorcelain:
+		return writeBlamePorcelain(c, opts, w, lines, previous)
+	default:
+		return writeBlame(c, opts, w, lines, ipath)
+	}
+}
+
+// blame does the work of Blame, returning the selected lines in order
+// along with the origins each origin was compared against.
+func blame(c *Client, opts BlameOptions, includes, excludes []Commitish, path File) ([]blameLine, map[blameOrigin]blameOrigin, error) {
+	ipath, err := path.IndexPath(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := lineKey(false, opts.IgnoreWhitespace)
+	sb := &blameScoreboard{
+		c:          c,
+		opts:       opts,
+		key:        key,
+		eq:         lineEqual(key),
+		neighbours: make(map[CommitID][]CommitID),
+		boundary:   make(map[CommitID]bool),
+		ignored:    make(map[CommitID]bool),
+		pending:    make(map[CommitID]map[IndexPath][]blameEntry),
+		lines:      make(map[blameOrigin][]string),
+		trees:      make(map[CommitID]IndexMap),
+		previous:   make(map[blameOrigin]blameOrigin),
+	}
+	if err := sb.loadIgnoreRevs(); err != nil {
+		return nil, nil, err
+	}
+
+	var order []CommitID
+	var start CommitID
+	if opts.Reverse {
+		if len(excludes) != 1 || len(includes) != 1 {
+			return nil, nil, fmt.Errorf("--reverse requires a range of commits")
+		}
+		order, start, err = sb.reverseGraph(includes[0], excludes[0])
+	} else {
+		if len(includes) > 1 {
+			return nil, nil, fmt.Errorf("More than one commit to dig from")
+		}
+		order, start, err = sb.graph(includes, excludes)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	origin := blameOrigin{start, ipath}
+	if start == (CommitID{}) {
+		head, err := c.GetHeadCommit()
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, ok, err := sb.treeEntry(head, ipath); err != nil {
+			return nil, nil, err
+		} else if !ok {
+			return nil, nil, fmt.Errorf("no such path '%v' in HEAD", ipath)
+		}
+	} else if _, ok, err := sb.treeEntry(start, ipath); err != nil {
+		return nil, nil, err
+	} else if !ok {
+		return nil, nil, fmt.Errorf("no such path %v in %v", ipath, start)
+	}
+	sb.final, err = sb.load(origin)
+	if err != nil {
+		return nil, nil, err
+	}
+	sb.result = make([]blameLine, len(sb.final))
+
+	selected, err := parseBlameRanges(opts.LineRanges, sb.final, ipath)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := 0; i < len(selected); {
+		if !selected[i] {
+			i++
+			continue
+		}
+		j := i
+		for j < len(selected) && selected[j] {
+			j++
+		}
+		sb.give(origin, blameEntry{i, i, j - i})
+		i = j
+	}
+
+	for _, cmt := range order {
+		paths := sb.pending[cmt]
+		delete(sb.pending, cmt)
+		names := make([]string, 0, len(paths))
+		for p := range paths {
+			names = append(names, string(p))
+		}
+		sort.Strings(names)
+		for _, p := range names {
+			o := blameOrigin{cmt, IndexPath(p)}
+			if err := sb.passBlame(o, paths[IndexPath(p)]); err != nil {
+				return nil, nil, err
+			}
+		}
+		// The contents of this commit won't be needed again.
+		for o := range sb.lines {
+			if o.Commit == cmt {
+				delete(sb.lines, o)
+			}
+		}
+		delete(sb.trees, cmt)
+	}
+
+	var lines []blameLine
+	for i, l := range sb.result {
+		if selected[i] {
+			lines = append(lines, l)
+		}
+	}
+	if opts.Reverse {
+		return lines, nil, nil
+	}
+	return lines, sb.previous, nil
+}
+
+// graph builds the history to walk for a normal blame and returns the
+// order to visit commits in, with children before their parents.
+func (sb *blameScoreboard) graph(includes, excludes []Commitish) ([]CommitID, CommitID, error) {
+	var tips []CommitID
+	var start CommitID
+	if len(includes) == 0 {
+		head, err := sb.c.GetHeadCommit()
+		if err != nil {
+			return nil, CommitID{}, err
+		}
+		// The work tree is a pretend commit whose parent is HEAD.
+		sb.neighbours[CommitID{}] = []CommitID{head}
+		tips = []CommitID{CommitID{}}
+		includes = []Commitish{head}
+	} else {
+		cmt, err := includes[0].CommitID(sb.c)
+		if err != nil {
+			return nil, CommitID{}, err
+		}
+		start = cmt
+		tips = []CommitID{cmt}
+	}
+
+	var commits []CommitID
+	inRange := make(map[CommitID]bool)
+	if err := RevListCallback(sb.c, RevListOptions{Quiet: true}, includes, excludes, func(s Sha1) error {
+		commits = append(commits, CommitID(s))
+		inRange[CommitID(s)] = true
+		return nil
+	}); err != nil {
+		return nil, CommitID{}, err
+	}
+	children := make(map[CommitID]int)
+	for _, cmt := range commits {
+		parents, err := cmt.Parents(sb.c)
+		if err != nil {
+			return nil, CommitID{}, err
+		}
+		if len(parents) == 0 {
+			sb.boundary[cmt] = true
+		}
+		for _, p := range parents {
+			if !inRange[p] {
+				sb.boundary[p] = true
+			}
+			sb.neighbours[cmt] = append(sb.neighbours[cmt], p)
+			children[p]++
+		}
+	}
+	if len(tips) == 1 && tips[0] == (CommitID{}) {
+		children[sb.neighbours[CommitID{}][0]]++
+	}
+	return sb.topoSort(tips, children), start, nil
+}
+
+// reverseGraph builds the history to walk for a reverse blame from
+// "from" to "to" and returns the order to visit commits in, with parents
+// before their children.
+func (sb *blameScoreboard) reverseGraph(to, from Commitish) ([]CommitID, CommitID, error) {
+	start, err := from.CommitID(sb.c)
+	if err != nil {
+		return nil, CommitID{}, err
+	}
+	var commits []CommitID
+	inRange := map[CommitID]bool{start: true}
+	if err := RevListCallback(sb.c, RevListOptions{Quiet: true}, []Commitish{to}, []Commitish{start}, func(s Sha1) error {
+		commits = append(commits, CommitID(s))
+		inRange[CommitID(s)] = true
+		return nil
+	}); err != nil {
+		return nil, CommitID{}, err
+	}
+	sb.boundary[start] = true
+	parentCount := make(map[CommitID]int)
+	for _, cmt := range commits {
+		parents, err := cmt.Parents(sb.c)
+		if err != nil {
+			return nil, CommitID{}, err
+		}
+		for _, p := range parents {
+			if inRange[p] {
+				sb.neighbours[p] = append(sb.neighbours[p], cmt)
+				parentCount[cmt]++
+			}
+		}
+	}
+	return sb.topoSort([]CommitID{start}, parentCount), start, nil
+}
+
+// topoSort orders the commits reachable from tips through neighbours so
+// that every commit comes after all of the commits which have it as a
+// neighbour. incoming is the number of commits which have each commit as
+// a neighbour.
+func (sb *blameScoreboard) topoSort(tips []CommitID, incoming map[CommitID]int) []CommitID {
+	var order []CommitID
+	queue := append([]CommitID{}, tips...)
+	for len(queue) > 0 {
+		cmt := queue[0]
+		queue = queue[1:]
+		order = append(order, cmt)
+		for _, n := range sb.neighbours[cmt] {
+			incoming[n]--
+			if incoming[n] == 0 {
+				queue = append(queue, n)
+			}
+		}
+	}
+	return order
+}
+
+// loadIgnoreRevs resolves the commits to ignore from the options.
+func (sb *blameScoreboard) loadIgnoreRevs() error {
+	for _, rev := range sb.opts.IgnoreRevs {
+		cmt, err := rev.CommitID(sb.c)
+		if err != nil {
+			return err
+		}
+		sb.ignored[cmt] = true
+	}
+	for _, f := range sb.opts.IgnoreRevsFiles {
+		file, err := os.Open(f.String())
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if i := strings.IndexByte(line, '#'); i >= 0 {
+				line = line[:i]
+			}
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			cmt, err := RevParseCommitish(sb.c, &RevParseOptions{}, line)
+			if err != nil {
+				file.Close()
+				return fmt.Errorf("invalid object name %v in %v", line, f)
+			}
+			id, err := cmt.CommitID(sb.c)
+			if err != nil {
+				file.Close()
+				return err
+			}
+			sb.ignored[id] = true
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// give passes responsibility for entries to the origin o.
+func (sb *blameScoreboard) give(o blameOrigin, entries ...blameEntry) {
+	paths, ok := sb.pending[o.Commit]
+	if !ok {
+		paths = make(map[IndexPath][]blameEntry)
+		sb.pending[o.Commit] = paths
+	}
+	paths[o.Path] = append(paths[o.Path], entries...)
+}
+
+// treeEntry returns the tree entry for path in cmt, if there is one.
+func (sb *blameScoreboard) treeEntry(cmt CommitID, path IndexPath) (TreeEntry, bool, error) {
+	tree, err := cmt.TreeID(sb.c)
+	if err != nil {
+		return TreeEntry{}, false, err
+	}
+	parts := strings.Split(string(path), "/")
+	for i, part := range parts {
+		objs, err := tree.GetAllObjects(sb.c, "", false, false)
+		if err != nil {
+			return TreeEntry{}, false, err
+		}
+		e, ok := objs[IndexPath(part)]
+		if !ok {
+			return TreeEntry{}, false, nil
+		}
+		if i == len(parts)-1 {
+			return e, e.FileMode.TreeType() == "blob", nil
+		}
+		if e.FileMode.TreeType() != "tree" {
+			return TreeEntry{}, false, nil
+		}
+		tree = TreeID(e.Sha1)
+	}
+	return TreeEntry{}, false, nil
+}
+
+// tree returns every file in cmt.
+func (sb *blameScoreboard) tree(cmt CommitID) (IndexMap, error) {
+	if m, ok := sb.trees[cmt]; ok {
+		return m, nil
+	}
+	m, err := GetIndexMap(sb.c, cmt)
+	if err != nil {
+		return nil, err
+	}
+	sb.trees[cmt] = m
+	return m, nil
+}
+
+// load returns the lines of the file for an origin.
+func (sb *blameScoreboard) load(o blameOrigin) ([]string, error) {
+	if lines, ok := sb.lines[o]; ok {
+		return lines, nil
+	}
+	var content []byte
+	if o.Commit == (CommitID{}) {
+		f, err := o.Path.FilePath(sb.c)
+		if err != nil {
+			return nil, err
+		}
+		content, err = ioutil.ReadFile(f.String())
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		e, ok, err := sb.treeEntry(o.Commit, o.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("no such path %v in %v", o.Path, o.Commit)
+		}
+		obj, err := sb.c.GetObject(e.Sha1)
+		if err != nil {
+			return nil, err
+		}
+		content = obj.GetContent()
+	}
+	lines := splitLines(content)
+	sb.lines[o] = lines
+	return lines, nil
+}
+
+// findPath returns the path in the neighbour n that the file for origin
+// o came from, following renames.
+func (sb *blameScoreboard) findPath(o blameOrigin, n CommitID) (IndexPath, bool, error) {
+	if _, ok, err := sb.treeEntry(n, o.Path); err != nil || ok {
+		return o.Path, ok, err
+	}
+	if o.Commit == (CommitID{}) {
+		return "", false, nil
+	}
+	ours, err := sb.tree(o.Commit)
+	if err != nil {
+		return "", false, err
+	}
+	theirs, err := sb.tree(n)
+	if err != nil {
+		return "", false, err
+	}
+	var removed []*IndexEntry
+	for name, e := range theirs {
+		if _, ok := ours[name]; !ok {
+			removed = append(removed, e)
+		}
+	}
+	sort.Slice(removed, func(i, j int) bool { return removed[i].PathName < removed[j].PathName })
+	pairs, err := detectRenames(sb.c, removed, []*IndexEntry{ours[o.Path]}, 0)
+	if err != nil || len(pairs) == 0 {
+		return "", false, err
+	}
+	return pairs[0].From.PathName, true, nil
+}
+
+// passBlame passes as much of the blame for entries as it can from the
+// origin o to its neighbours, and blames whatever is left on o.
+func (sb *blameScoreboard) passBlame(o blameOrigin, entries []blameEntry) error {
+	lines, err := sb.load(o)
+	if err != nil {
+		return err
+	}
+	var entry TreeEntry
+	if o.Commit != (CommitID{}) {
+		if entry, _, err = sb.treeEntry(o.Commit, o.Path); err != nil {
+			return err
+		}
+	}
+
+	var origins []blameOrigin
+	var hunks [][]diffHunk
+	for _, n := range sb.neighbours[o.Commit] {
+		if len(entries) == 0 {
+			break
+		}
+		npath, ok, err := sb.findPath(o, n)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		no := blameOrigin{n, npath}
+		if _, ok := sb.previous[o]; !ok {
+			sb.previous[o] = no
+		}
+		origins = append(origins, no)
+		if o.Commit != (CommitID{}) {
+			if ne, _, err := sb.treeEntry(n, npath); err != nil {
+				return err
+			} else if ne.Sha1 == entry.Sha1 {
+				sb.give(no, entries...)
+				return nil
+			}
+		}
+
+		nlines, err := sb.load(no)
+		if err != nil {
+			return err
+		}
+		// Like git, the changes are found with the indent heuristic.
+		h := xdiffLines(nlines, lines, sb.key, true)
+		hunks = append(hunks, h)
+		entries = sb.passMapped(no, entries, blameMapping(h, len(lines), nil))
+	}
+
+	// Like git, the lines changed by an ignored commit are then blamed
+	// on the lines they're most similar to in its parents, if there are
+	// any. Lines which aren't like any of the lines they replaced stay
+	// blamed on the ignored commit.
+	if sb.ignored[o.Commit] {
+		for i, no := range origins {
+			if len(entries) == 0 {
+				break
+			}
+			nlines, err := sb.load(no)
+			if err != nil {
+				return err
+			}
+			mapping := blameMapping(hunks[i], len(lines), func(h diffHunk) []int {
+				return fuzzyMatchLines(nlines[h.AStart:h.AEnd], lines[h.BStart:h.BEnd])
+			})
+			entries = sb.passMapped(no, entries, mapping)
+		}
+	}
+
+	if sb.opts.DetectMoves {
+		for _, no := range origins {
+			if len(entries) == 0 {
+				break
+			}
+			if entries, err = sb.passCopies(no, lines, entries, blameMoveScore); err != nil {
+				return err
+			}
+		}
+	}
+	if sb.opts.DetectCopies > 0 {
+		for _, n := range sb.neighbours[o.Commit] {
+			if len(entries) == 0 {
+				break
+			}
+			paths, err := sb.copySources(o, n)
+			if err != nil {
+				return err
+			}
+			for _, p := range paths {
+				if entries, err = sb.passCopies(blameOrigin{n, p}, lines, entries, blameCopyScore); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, e := range entries {
+		for k := 0; k < e.Count; k++ {
+			sb.result[e.Final+k] = blameLine{
+				Commit:    o.Commit,
+				Path:      o.Path,
+				OrigLine:  e.Suspect + k + 1,
+				FinalLine: e.Final + k + 1,
+				Content:   sb.final[e.Final+k],
+				Boundary:  sb.boundary[o.Commit],
+			}
+		}
+	}
+	return nil
+}
+
+// blameMapping returns the line in the neighbour that each of the n lines
+// of an origin is, from the hunks of the diff between them. The lines in
+// the hunks are -1, unless match is set, in which case they're the lines
+// in the hunk's lines in the neighbour that it returns, or -1.
+func blameMapping(hunks []diffHunk, n int, match func(diffHunk) []int) []int {
+	mapping := make([]int, n)
+	li, ni := 0, 0
+	for _, h := range hunks {
+		for ; li < h.BStart; li, ni = li+1, ni+1 {
+			mapping[li] = ni
+		}
+		var matches []int
+		if match != nil {
+			matches = match(h)
+		}
+		for k := h.BStart; k < h.BEnd; k++ {
+			mapping[k] = -1
+			if matches != nil && matches[k-h.BStart] >= 0 {
+				mapping[k] = h.AStart + matches[k-h.BStart]
+			}
+		}
+		li, ni = h.BEnd, h.AEnd
+	}
+	for ; li < n; li, ni = li+1, ni+1 {
+		mapping[li] = ni
+	}
+	return mapping
+}
+
+// passMapped passes the lines in entries which have a corresponding line
+// in mapping to the origin o, and returns the lines which don't. Lines
+// without a corresponding line are -1 in mapping.
+func (sb *blameScoreboard) passMapped(o blameOrigin, entries []blameEntry, mapping []int) []blameEntry {
+	var remaining []blameEntry
+	for _, e := range entries {
+		for k := 0; k < e.Count; {
+			start := k
+			if mapping[e.Suspect+k] < 0 {
+				for k < e.Count && mapping[e.Suspect+k] < 0 {
+					k++
+				}
+				remaining = append(remaining, blameEntry{e.Final + start, e.Suspect + start, k - start})
+				continue
+			}
+			k++
+			for k < e.Count && mapping[e.Suspect+k] == mapping[e.Suspect+k-1]+1 {
+				k++
+			}
+			sb.give(o, blameEntry{e.Final + start, mapping[e.Suspect+start], k - start})
+		}
+	}
+	return remaining
+}
+
+// copySources returns the files in the neighbour n which lines in the
+// origin o may have been copied from.
+func (sb *blameScoreboard) copySources(o blameOrigin, n CommitID) ([]IndexPath, error) {
+	theirs, err := sb.tree(n)
+	if err != nil {
+		return nil, err
+	}
+	var ours IndexMap
+	if sb.opts.DetectCopies < 2 {
+		if o.Commit == (CommitID{}) {
+			// Without a tree for the work tree, there's no
+			// cheap way to tell which files were modified.
+			return nil, nil
+		}
+		if ours, err = sb.tree(o.Commit); err != nil {
+			return nil, err
+		}
+	}
+	var paths []IndexPath
+	for name, e := range theirs {
+		if ours != nil {
+			if mine, ok := ours[name]; ok && sameEntry(mine, e) {
+				continue
+			}
+		}
+		if e.Mode.TreeType() == "blob" {
+			paths = append(paths, name)
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool { return paths[i] < paths[j] })
+	return paths, nil
+}
+
+// passCopies looks for blocks of lines in entries which also appear in
+// the origin o, and passes any which have at least minScore alphanumeric
+// characters to it. It returns the lines which weren't found.
+func (sb *blameScoreboard) passCopies(o blameOrigin, lines []string, entries []blameEntry, minScore int) ([]blameEntry, error) {
+	olines, err := sb.load(o)
+	if err != nil {
+		return nil, err
+	}
+	var remaining []blameEntry
+	for len(entries) > 0 {
+		e := entries[0]
+		entries = entries[1:]
+
+		bestStart, bestLen, bestOrig, bestScore := 0, 0, 0, 0
+		for i := 0; i < e.Count; i++ {
+			for j := range olines {
+				n := 0
+				for i+n < e.Count && j+n < len(olines) && sb.eq(lines[e.Suspect+i+n], olines[j+n]) {
+					n++
+				}
+				if n == 0 || n < bestLen {
+					continue
+				}
+				score := 0
+				for _, l := range lines[e.Suspect+i : e.Suspect+i+n] {
+					score += blameScore(l)
+				}
+				if score > bestScore {
+					bestStart, bestLen, bestOrig, bestScore = i, n, j, score
+				}
+			}
+		}
+		if bestScore < minScore {
+			remaining = append(remaining, e)
+			continue
+		}
+		sb.give(o, blameEntry{e.Final + bestStart, bestOrig, bestLen})
+		if bestStart > 0 {
+			entries = append(entries, blameEntry{e.Final, e.Suspect, bestStart})
+		}
+		if end := bestStart + bestLen; end < e.Count {
+			entries = append(entries, blameEntry{e.Final + end, e.Suspect + end, e.Count - end})
+		}
+	}
+	return remaining, nil
+}
+
+// blameScore is the number of alphanumeric characters in line.
+func blameScore(line string) int {
+	score := 0
+	for _, r := range line {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			score++
+		}
+	}
+	return score
+}
+
+// parseBlameRanges returns which lines of the file are selected by the
+// -L ranges. With no ranges, every line is selected.
+func parseBlameRanges(ranges []string, lines []string, path IndexPath) ([]bool, error) {
+	selected := make([]bool, len(lines))
+	if len(ranges) == 0 {
+		for i := range selected {
+			selected[i] = true
+		}
+		return selected, nil
+	}
+	// Regexes search from the end of the previous range, like git.
+	prevEnd := 0
+	for _, r := range ranges {
+		start, end, err := parseBlameRange(r, lines, prevEnd)
+		if err != nil {
+			return nil, err
+		}
+		if start >= len(lines) {
+			return nil, fmt.Errorf("file %v has only %d line%s", path, len(lines), plural(len(lines)))
+		}
+		if end > len(lines) {
+			end = len(lines)
+		}
+		for i := start; i < end; i++ {
+			selected[i] = true
+		}
+		prevEnd = end
+	}
+	return selected, nil
+}
+
+// parseBlameRange parses a single -L range into the 0 based start and
+// end (exclusive) lines.
+func parseBlameRange(r string, lines []string, searchFrom int) (int, int, error) {
+	invalid := fmt.Errorf("invalid -L range: %v", r)
+	if strings.HasPrefix(r, ":") {
+		return 0, 0, fmt.Errorf("-L :funcname is not supported")
+	}
+	startStr, endStr := r, ""
+	hasEnd := false
+	if strings.HasPrefix(r, "/") {
+		i := strings.IndexByte(r[1:], '/')
+		if i < 0 {
+			return 0, 0, invalid
+		}
+		startStr = r[:i+2]
+		if rest := r[i+2:]; rest != "" {
+			if rest[0] != ',' {
+				return 0, 0, invalid
+			}
+			endStr, hasEnd = rest[1:], true
+		}
+	} else if i := strings.IndexByte(r, ','); i >= 0 {
+		startStr, endStr, hasEnd = r[:i], r[i+1:], true
+	}
+
+	start := 0
+	switch {
+	case startStr == "":
+	case strings.HasPrefix(startStr, "/"):
+		line, err := blameSearch(startStr[1:len(startStr)-1], lines, searchFrom)
+		if err != nil {
+			return 0, 0, err
+		}
+		start = line
+	default:
+		n, err := strconv.Atoi(startStr)
+		if err != nil || n < 1 {
+			return 0, 0, invalid
+		}
+		start = n - 1
+	}
+	if !hasEnd || endStr == "" {
+		return start, len(lines), nil
+	}
+
+	switch {
+	case strings.HasPrefix(endStr, "+"):
+		n, err := strconv.Atoi(endStr[1:])
+		if err != nil || n < 0 {
+			return 0, 0, invalid
+		}
+		if n == 0 {
+			n = 1
+		}
+		return start, start + n, nil
+	case strings.HasPrefix(endStr, "-"):
+		n, err := strconv.Atoi(endStr[1:])
+		if err != nil || n < 0 {
+			return 0, 0, invalid
+		}
+		if n == 0 {
+			n = 1
+		}
+		from := start - n + 1
+		if from < 0 {
+			from = 0
+		}
+		return from, start + 1, nil
+	case strings.HasPrefix(endStr, "/"):
+		if len(endStr) < 2 || !strings.HasSuffix(endStr, "/") {
+			return 0, 0, invalid
+		}
+		line, err := blameSearch(endStr[1:len(endStr)-1], lines, start+1)
+		if err != nil {
+			return 0, 0, err
+		}
+		return start, line + 1, nil
+	default:
+		n, err := strconv.Atoi(endStr)
+		if err != nil || n < 1 {
+			return 0, 0, invalid
+		}
+		end := n
+		if end-1 < start {
+			start, end = end-1, start+1
+		}
+		return start, end, nil
+	}
+}
+
+// blameSearch returns the first line at or after from which matches the
+// regular expression re.
+func blameSearch(re string, lines []string, from int) (int, error) {
+	r, err := regexp.Compile(re)
+	if err != nil {
+		return 0, err
+	}
+	for i := from; i < len(lines); i++ {
+		if r.MatchString(lines[i]) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("-L parameter '%v': no match", re)
+}
+
+// blameCommitInfo is the information shown about a commit in blame
+// output.
+type blameCommitInfo struct {
+	Author, Committer Person
+	Summary           string
+}
+
+// blameInfo returns the information to show about the commit for line.
+func blameInfo(c *Client, cache map[CommitID]blameCommitInfo, line blameLine) (blameCommitInfo, error) {
+	if info, ok := cache[line.Commit]; ok {
+		return info, nil
+	}
+	var info blameCommitInfo
+	if line.Commit == (CommitID{}) {
+		now := time.Now()
+		info.Author = Person{Name: "Not Committed Yet", Email: "not.committed.yet", Time: &now}
+		info.Committer = info.Author
+		info.Summary = fmt.Sprintf("Version of %v from %v", line.Path, line.Path)
+	} else {
+		obj, err := c.GetCommitObject(line.Commit)
+		if err != nil {
+			return info, err
+		}
+		if info.Author, err = parsePerson(obj.GetHeader("author")); err != nil {
+			return info, err
+		}
+		if info.Committer, err = parsePerson(obj.GetHeader("committer")); err != nil {
+			return info, err
+		}
+		msg, err := line.Commit.GetCommitMessage(c)
+		if err != nil {
+			return info, err
+		}
+		info.Summary = msg.Subject()
+	}
+	cache[line.Commit] = info
+	return info, nil
+}
+
+// writeBlame writes lines in the default blame format, or the annotate
+// format.
+func writeBlame(c *Client, opts BlameOptions, w io.Writer, lines []blameLine, path IndexPath) error {
+	infos := make(map[CommitID]blameCommitInfo)
+	showName := opts.ShowName
+	nameWidth, authorWidth, origWidth, finalWidth := 0, 0, 0, 0
+	for _, l := range lines {
+		info, err := blameInfo(c, infos, l)
+		if err != nil {
+			return err
+		}
+		if l.Path != path {
+			showName = true
+		}
+		if n := utf8.RuneCountInString(string(l.Path)); n > nameWidth {
+			nameWidth = n
+		}
+		author := info.Author.Name
+		if opts.ShowEmail {
+			author = "<" + info.Author.Email + ">"
+		}
+		if n := utf8.RuneCountInString(author); n > authorWidth {
+			authorWidth = n
+		}
+		if n := len(strconv.Itoa(l.OrigLine)); n > origWidth {
+			origWidth = n
+		}
+		if n := len(strconv.Itoa(l.FinalLine)); n > finalWidth {
+			finalWidth = n
+		}
+	}
+
+	hexLen := 8
+	if opts.LongHash {
+		hexLen = 40
+	}
+	for _, l := range lines {
+		info := infos[l.Commit]
+		content := l.Content
+		if !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		date := info.Author.Time.Format("2006-01-02 15:04:05 -0700")
+		hex := l.Commit.String()
+		if opts.Annotate {
+			fmt.Fprintf(w, "%s\t(%10s\t%s\t%d)%s", hex[:hexLen], info.Author.Name, date, l.FinalLine, content)
+			continue
+		}
+		if l.Boundary {
+			hex = "^" + hex[:hexLen-1]
+		} else {
+			hex = hex[:hexLen]
+		}
+		fmt.Fprint(w, hex)
+		if showName {
+			fmt.Fprintf(w, " %-*s", nameWidth, l.Path)
+		}
+		if opts.ShowNumber {
+			fmt.Fprintf(w, " %*d", origWidth, l.OrigLine)
+		}
+		if !opts.SuppressAuthor {
+			author := info.Author.Name
+			if opts.ShowEmail {
+				author = "<" + info.Author.Email + ">"
+			}
+			pad := authorWidth - utf8.RuneCountInString(author)
+			fmt.Fprintf(w, " (%s%*s %s", author, pad, "", date)
+		}
+		fmt.Fprintf(w, " %*d) %s", finalWidth, l.FinalLine, content)
+	}
+	return nil
+}
+
+// writeBlamePorcelain writes lines in the machine readable porcelain
+// format. Lines from the same commit are grouped together when they're
+// consecutive in both the commit and the final file.
+func writeBlamePorcelain(c *Client, opts BlameOptions, w io.Writer, lines []blameLine, previous map[blameOrigin]blameOrigin) error {
+	infos := make(map[CommitID]blameCommitInfo)
+	commitPaths := make(map[CommitID]IndexPath)
+	multiplePaths := make(map[CommitID]bool)
+	for _, l := range lines {
+		if p, ok := commitPaths[l.Commit]; ok && p != l.Path {
+			multiplePaths[l.Commit] = true
+		}
+		commitPaths[l.Commit] = l.Path
+	}
+
+	shown := make(map[CommitID]bool)
+	details := func(l blameLine) error {
+		if !opts.LinePorcelain && shown[l.Commit] && !multiplePaths[l.Commit] {
+			return nil
+		}
+		if opts.LinePorcelain || !shown[l.Commit] {
+			info, err := blameInfo(c, infos, l)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "author %s\n", info.Author.Name)
+			fmt.Fprintf(w, "author-mail <%s>\n", info.Author.Email)
+			fmt.Fprintf(w, "author-time %d\n", info.Author.Time.Unix())
+			fmt.Fprintf(w, "author-tz %s\n", info.Author.Time.Format("-0700"))
+			fmt.Fprintf(w, "committer %s\n", info.Committer.Name)
+			fmt.Fprintf(w, "committer-mail <%s>\n", info.Committer.Email)
+			fmt.Fprintf(w, "committer-time %d\n", info.Committer.Time.Unix())
+			fmt.Fprintf(w, "committer-tz %s\n", info.Committer.Time.Format("-0700"))
+			fmt.Fprintf(w, "summary %s\n", info.Summary)
+			if l.Boundary {
+				fmt.Fprintf(w, "boundary\n")
+			}
+			shown[l.Commit] = true
+		}
+		if prev, ok := previous[blameOrigin{l.Commit, l.Path}]; ok {
+			fmt.Fprintf(w, "previous %v %v\n", prev.Commit, prev.Path)
+		}
+		fmt.Fprintf(w, "filename %v\n", l.Path)
+		return nil
+	}
+
+	for i, l := range lines {
+		content := l.Content
+		if !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		first := i == 0
+		if !first {
+			p := lines[i-1]
+			first = p.Commit != l.Commit || p.Path != l.Path || p.OrigLine+1 != l.OrigLine || p.FinalLine+1 != l.FinalLine
+		}
+		if first {
+			count := 1
+			for j := i + 1; j < len(lines); j++ {
+				n, p := lines[j], lines[j-1]
+				if n.Commit != l.Commit || n.Path != l.Path || p.OrigLine+1 != n.OrigLine || p.FinalLine+1 != n.FinalLine {
+					break
+				}
+				count++
+			}
+			fmt.Fprintf(w, "%v %d %d %d\n", l.Commit, l.OrigLine, l.FinalLine, count)
+			if err := details(l); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintf(w, "%v %d %d\n", l.Commit, l.OrigLine, l.FinalLine)
+			if opts.LinePorcelain {
+				if err := details(l); err != nil {
+					return err
+				}
+			}
+		}
+		fmt.Fprintf(w, "\t%s", content)
+	}
+	return nil
+}
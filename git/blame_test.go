@@ -0,0 +1,150 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestBlame(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo.txt": "a\nb\nc\nd\ne\n"},
+		map[string]string{"foo.txt": "A\nb\nc\nd\ne\n"},
+		map[string]string{"bar.txt": "bar\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	ours, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parents, err := ours.Parents(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := parents[0]
+
+	// Rename the file, then change it in the work tree.
+	if err := os.Rename("foo.txt", "renamed.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Add(c, AddOptions{}, []File{"foo.txt", "renamed.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	renamed, err := Commit(c, CommitOptions{}, "rename", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("renamed.txt", []byte("A\nb\nC\nd\ne\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lines, _, err := blame(c, BlameOptions{}, nil, nil, "renamed.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []blameLine{
+		{ours, "foo.txt", 1, 1, "A\n", false},
+		{base, "foo.txt", 2, 2, "b\n", true},
+		{CommitID{}, "renamed.txt", 3, 3, "C\n", false},
+		{base, "foo.txt", 4, 4, "d\n", true},
+		{base, "foo.txt", 5, 5, "e\n", true},
+	}
+	checkBlame(t, "work tree", lines, want)
+
+	// Only blame lines 2-3 of the commit, and ignore the commit that
+	// changed line 1.
+	lines, _, err = blame(c, BlameOptions{LineRanges: []string{"1,+2"}, IgnoreRevs: []Commitish{ours}}, []Commitish{renamed}, nil, "renamed.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBlame(t, "ignore-rev", lines, []blameLine{
+		{base, "foo.txt", 1, 1, "A\n", true},
+		{base, "foo.txt", 2, 2, "b\n", true},
+	})
+
+	// Walking forwards, the unchanged lines last existed in the rename
+	// and the changed line in the base.
+	lines, _, err = blame(c, BlameOptions{Reverse: true, LineRanges: []string{"1,2"}}, []Commitish{renamed}, []Commitish{base}, "foo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBlame(t, "reverse", lines, []blameLine{
+		{base, "foo.txt", 1, 1, "a\n", true},
+		{renamed, "renamed.txt", 2, 2, "b\n", false},
+	})
+}
+
+func TestBlameIgnoreRevSimilarity(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo.txt": "1\n2\n3\nint x = 1;\n"},
+		map[string]string{"foo.txt": "1\n2\nthree\nint x = 10;\n"},
+		map[string]string{"bar.txt": "bar\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	ours, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parents, err := ours.Parents(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := parents[0]
+
+	// Like git, the changed line that isn't like any line in the
+	// parent stays blamed on the ignored commit.
+	lines, _, err := blame(c, BlameOptions{IgnoreRevs: []Commitish{ours}}, []Commitish{ours}, nil, "foo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBlame(t, "ignore-rev", lines, []blameLine{
+		{base, "foo.txt", 1, 1, "1\n", true},
+		{base, "foo.txt", 2, 2, "2\n", true},
+		{ours, "foo.txt", 3, 3, "three\n", false},
+		{base, "foo.txt", 4, 4, "int x = 10;\n", true},
+	})
+}
+
+func checkBlame(t *testing.T, name string, got, want []blameLine) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%v: unexpected number of lines: got %v want %v", name, got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("%v: unexpected blame for line %d: got %v want %v", name, i+1, got[i], want[i])
+		}
+	}
+}
+
+func TestParseBlameRange(t *testing.T) {
+	lines := []string{"one\n", "two\n", "three\n", "four\n", "five\n"}
+	for _, tc := range []struct {
+		r          string
+		start, end int
+	}{
+		{"2,4", 1, 4},
+		{"4,2", 1, 4},
+		{"2,+2", 1, 3},
+		{"4,-2", 2, 4},
+		{"3", 2, 5},
+		{",2", 0, 2},
+		{"/th/", 2, 5},
+		{"/two/,/four/", 1, 4},
+		{"/f/,+1", 3, 4},
+	} {
+		start, end, err := parseBlameRange(tc.r, lines, 0)
+		if err != nil {
+			t.Errorf("%v: %v", tc.r, err)
+			continue
+		}
+		if start != tc.start || end != tc.end {
+			t.Errorf("%v: unexpected range: got %d-%d want %d-%d", tc.r, start, end, tc.start, tc.end)
+		}
+	}
+	if _, err := parseBlameRanges([]string{"7,8"}, lines, "file"); err == nil {
+		t.Error("Expected range past the end of the file to fail")
+	}
+}
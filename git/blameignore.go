@@ -0,0 +1,232 @@
+package git
+
+// This is a port of the fuzzy matching that git blame uses to find which
+// lines in the parent of an ignored commit the lines it changed came from.
+// Each line is fingerprinted by the pairs of adjacent characters in it, and
+// the lines in a hunk are matched to the most similar lines near the same
+// place in the parent, most certain match first, without reordering them.
+
+// A lineFingerprint counts the pairs of adjacent characters in a line,
+// ignoring case. Whitespace is treated as a 0, and the line starts and
+// ends with it.
+type lineFingerprint map[uint16]int
+
+// The maximum distance from where a line would be in the parent,
+// if the hunk's lines were spread evenly, for a line to match it.
+const fuzzyMaxSearchDistance = 10
+
+// The certainties of the matches for lines which weren't compared yet,
+// or which don't match anything.
+const (
+	certaintyNotCalculated = -1
+	certainNothingMatches  = -2
+)
+
+func fingerprintLine(line string) lineFingerprint {
+	f := make(lineFingerprint)
+	var c0 byte
+	for i := 0; i <= len(line); i++ {
+		var c1 byte
+		if i < len(line) && !isSpace(line[i]) {
+			c1 = line[i]
+			if c1 >= 'A' && c1 <= 'Z' {
+				c1 += 'a' - 'A'
+			}
+		}
+		// Pairs of whitespace are ignored.
+		if h := uint16(c0) | uint16(c1)<<8; h != 0 {
+			f[h]++
+		}
+		c0 = c1
+	}
+	return f
+}
+
+// similarity returns the number of pairs of characters that f and other
+// have in common.
+func (f lineFingerprint) similarity(other lineFingerprint) int {
+	n := 0
+	for h, count := range other {
+		if c, ok := f[h]; ok {
+			if c < count {
+				n += c
+			} else {
+				n += count
+			}
+		}
+	}
+	return n
+}
+
+// subtract removes the pairs of characters in other from f, so that they
+// can't be matched again.
+func (f lineFingerprint) subtract(other lineFingerprint) {
+	for h, count := range other {
+		if c, ok := f[h]; ok {
+			if c <= count {
+				delete(f, h)
+			} else {
+				f[h] = c - count
+			}
+		}
+	}
+}
+
+// fuzzyMatcher finds the lines in a which the lines in b are most like.
+// All of the line numbers are indexes into a and b, and the similarities
+// of each line in b are stored for the lines in a within maxA of where it
+// would be if b's lines were spread evenly over a.
+type fuzzyMatcher struct {
+	a, b       []lineFingerprint
+	maxA, maxB int
+
+	similarities []int
+	certainties  []int
+	result       []int
+	secondBest   []int
+}
+
+// fuzzyMatchLines returns the index of the line in a that each line in b
+// came from, or -1 if it doesn't match any of them, the same way as git's
+// fuzzy_find_matching_lines.
+func fuzzyMatchLines(a, b []string) []int {
+	if len(a) == 0 || len(b) == 0 {
+		return nil
+	}
+	m := &fuzzyMatcher{maxA: fuzzyMaxSearchDistance}
+	for _, l := range a {
+		m.a = append(m.a, fingerprintLine(l))
+	}
+	for _, l := range b {
+		m.b = append(m.b, fingerprintLine(l))
+	}
+	if m.maxA >= len(a) {
+		m.maxA = len(a) - 1
+	}
+	// The furthest apart two lines in b can be while they're still
+	// compared with the same line in a.
+	m.maxB = ((2*m.maxA+1)*len(b) - 1) / len(a)
+
+	m.similarities = make([]int, len(b)*(2*m.maxA+1))
+	for i := range m.similarities {
+		m.similarities[i] = -1
+	}
+	m.certainties = make([]int, len(b))
+	m.result = make([]int, len(b))
+	m.secondBest = make([]int, len(b))
+	for i := range b {
+		m.certainties[i] = certaintyNotCalculated
+		m.result[i] = -1
+		m.secondBest[i] = -1
+	}
+	m.match(0, 0, len(a), len(b))
+	return m.result
+}
+
+// closest returns the line in a which line lb of b would be if b's lines
+// were spread evenly over a.
+func (m *fuzzyMatcher) closest(lb int) int {
+	return (lb*2 + 1) * len(m.a) / (len(m.b) * 2)
+}
+
+// similarity returns where the similarity of line la in a and lb in b is
+// stored.
+func (m *fuzzyMatcher) similarity(la, lb int) *int {
+	return &m.similarities[la-m.closest(lb)+m.maxA+lb*(2*m.maxA+1)]
+}
+
+// findBest finds the lines in a[startA:startA+lengthA] that line lb in b is
+// most and second most like, unless that was already done since the lines
+// it could match last changed.
+func (m *fuzzyMatcher) findBest(startA, lengthA, lb int) {
+	if m.certainties[lb] != certaintyNotCalculated {
+		return
+	}
+	closest := m.closest(lb)
+	start, end := closest-m.maxA, closest+m.maxA+1
+	if start < startA {
+		start = startA
+	}
+	if end > startA+lengthA {
+		end = startA + lengthA
+	}
+	best, second := 0, 0
+	bestIdx, secondIdx := startA, startA
+	for la := start; la < end; la++ {
+		sim := m.similarity(la, lb)
+		if *sim == -1 {
+			// The distance from the closest line breaks ties
+			// between lines which are equally similar.
+			*sim = m.b[lb].similarity(m.a[la]) * (1000 - abs(la-closest))
+		}
+		if *sim > best {
+			second, secondIdx = best, bestIdx
+			best, bestIdx = *sim, la
+		} else if *sim > second {
+			second, secondIdx = *sim, la
+		}
+	}
+	if best == 0 {
+		m.certainties[lb] = certainNothingMatches
+		m.result[lb] = -1
+		return
+	}
+	// A line that matches two lines well is less certain than one
+	// that only matches one, but more than one that matches poorly.
+	m.certainties[lb] = best*2 - second
+	m.result[lb] = bestIdx
+	m.secondBest[lb] = secondIdx
+}
+
+// match matches the lines in b[startB:startB+lengthB] to the lines in
+// a[startA:startA+lengthA]. The most certain match splits the lines, and
+// the lines on either side of it are matched separately, so that the
+// matches stay in order.
+func (m *fuzzyMatcher) match(startA, startB, lengthA, lengthB int) {
+	mostB, mostCertainty := -1, -1
+	for lb := startB; lb < startB+lengthB; lb++ {
+		m.findBest(startA, lengthA, lb)
+		if m.certainties[lb] > mostCertainty {
+			mostB, mostCertainty = lb, m.certainties[lb]
+		}
+	}
+	if mostB < 0 {
+		return
+	}
+	mostA := m.result[mostB]
+
+	// The parts of the line in a that were matched can't be matched by
+	// any other lines, so the similarities to it have to be worked out
+	// again, along with the matches which are now out of order.
+	m.a[mostA].subtract(m.b[mostB])
+	invalidMin, invalidMax := mostB-m.maxB, mostB+m.maxB+1
+	if invalidMin < startB {
+		invalidMin = startB
+	}
+	if invalidMax > startB+lengthB {
+		invalidMax = startB + lengthB
+	}
+	for lb := invalidMin; lb < invalidMax; lb++ {
+		if abs(mostA-m.closest(lb)) > m.maxA {
+			continue
+		}
+		*m.similarity(mostA, lb) = -1
+	}
+	for lb := mostB - 1; lb >= invalidMin; lb-- {
+		if m.certainties[lb] >= 0 && (m.result[lb] >= mostA || m.secondBest[lb] >= mostA) {
+			m.certainties[lb] = certaintyNotCalculated
+		}
+	}
+	for lb := mostB + 1; lb < invalidMax; lb++ {
+		if m.certainties[lb] >= 0 && (m.result[lb] <= mostA || m.secondBest[lb] <= mostA) {
+			m.certainties[lb] = certaintyNotCalculated
+		}
+	}
+
+	if mostB > startB {
+		m.match(startA, startB, mostA+1-startA, mostB-startB)
+	}
+	if mostB+1 < startB+lengthB {
+		m.match(mostA, mostB+1, startA+lengthA-mostA, startB+lengthB-mostB-1)
+	}
+}
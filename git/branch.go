@@ -3,38 +3,516 @@ package git
 import (
 	"fmt"
 	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 )
 
 type BranchOptions struct {
-	All    bool
-	Quiet  bool
-	Move   bool
-	Delete bool
-	Force  bool
+	All     bool
+	Remotes bool
+	Quiet   bool
+	Move    bool
+	Copy    bool
+	Delete  bool
+	Force   bool
+
+	// 1 to show the commit for each branch, 2 to also show the
+	// upstream branch.
+	Verbose int
+
+	// Only list branches whose tips are reachable from all of Merged,
+	// and not reachable from any of NoMerged.
+	Merged, NoMerged []Commitish
+
+	// Only list branches which contain all of Contains, and none of
+	// NoContains.
+	Contains, NoContains []Commitish
+
+	// Only list branches whose tips are one of PointsAt.
+	PointsAt []Commitish
+
+	// The key to sort branches by. One of refname, objectname,
+	// committerdate or authordate, optionally prefixed with "-" to
+	// reverse the order.
+	Sort string
 }
 
 func BranchList(c *Client, stdout io.Writer, opts BranchOptions, patterns []string) ([]Branch, error) {
-	branches, err := c.GetBranches()
-	if err != nil {
-		return nil, err
+	var branches []Branch
+	if !opts.Remotes || opts.All {
+		b, err := c.GetBranches()
+		if err != nil {
+			return nil, err
+		}
+		branches = b
 	}
-	if opts.All {
+	if opts.Remotes || opts.All {
 		rb, err := c.GetRemoteBranches()
 		if err != nil {
 			return nil, err
 		}
 		branches = append(branches, rb...)
 	}
-	if !opts.Quiet {
-		head := c.GetHeadBranch()
-		for _, b := range branches {
-			if head == b {
-				fmt.Println(" *", b.BranchName())
+	branches, err := filterBranches(c, opts, branches, patterns)
+	if err != nil {
+		return nil, err
+	}
+	if err := sortBranches(c, opts.Sort, branches); err != nil {
+		return nil, err
+	}
+	if opts.Quiet {
+		return branches, nil
+	}
+
+	name := func(b Branch) string {
+		if opts.Remotes && !opts.All {
+			return strings.TrimPrefix(b.String(), "refs/remotes/")
+		}
+		return b.BranchName()
+	}
+	width := 0
+	for _, b := range branches {
+		if l := len(name(b)); l > width {
+			width = l
+		}
+	}
+	head := c.GetHeadBranch()
+	for _, b := range branches {
+		marker := "  "
+		if head == b {
+			marker = "* "
+		}
+		// Like git, symbolic refs such as origin/HEAD are shown with the
+		// branch they point to instead of a commit.
+		if target, ok := b.symrefTarget(c); ok {
+			short := strings.TrimPrefix(strings.TrimPrefix(target.String(), "refs/heads/"), "refs/remotes/")
+			if opts.Verbose == 0 {
+				fmt.Fprintf(stdout, "%s%s -> %s\n", marker, name(b), short)
 			} else {
-				fmt.Println("  ", b.BranchName())
+				fmt.Fprintf(stdout, "%s%-*s -> %s\n", marker, width, name(b), short)
 			}
-
+			continue
+		}
+		if opts.Verbose == 0 {
+			fmt.Fprintf(stdout, "%s%s\n", marker, name(b))
+			continue
+		}
+		cmt, err := b.CommitID(c)
+		if err != nil {
+			return nil, err
 		}
+		msg, err := cmt.GetCommitMessage(c)
+		if err != nil {
+			return nil, err
+		}
+		subject := strings.SplitN(strings.TrimSpace(msg.String()), "\n", 2)[0]
+		tracking := branchTrackingInfo(c, b, opts.Verbose > 1)
+		if tracking != "" {
+			tracking = "[" + tracking + "] "
+		}
+		fmt.Fprintf(stdout, "%s%-*s %s %s%s\n", marker, width, name(b), Sha1(cmt).Abbrev(c, 7), tracking, subject)
 	}
 	return branches, nil
 }
+
+// filterBranches returns the branches which match patterns and the
+// --merged/--contains style filters of opts.
+func filterBranches(c *Client, opts BranchOptions, branches []Branch, patterns []string) ([]Branch, error) {
+	resolve := func(cmts []Commitish) ([]CommitID, error) {
+		var ids []CommitID
+		for _, cmt := range cmts {
+			id, err := cmt.CommitID(c)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+		return ids, nil
+	}
+	merged, err := resolve(opts.Merged)
+	if err != nil {
+		return nil, err
+	}
+	noMerged, err := resolve(opts.NoMerged)
+	if err != nil {
+		return nil, err
+	}
+	contains, err := resolve(opts.Contains)
+	if err != nil {
+		return nil, err
+	}
+	noContains, err := resolve(opts.NoContains)
+	if err != nil {
+		return nil, err
+	}
+	pointsAt, err := resolve(opts.PointsAt)
+	if err != nil {
+		return nil, err
+	}
+	// The tips are only needed to filter by commit, so that branches
+	// which can't be resolved are still listed otherwise.
+	needTips := len(merged) > 0 || len(noMerged) > 0 || len(contains) > 0 || len(noContains) > 0 || len(pointsAt) > 0
+
+	var filtered []Branch
+branches:
+	for _, b := range branches {
+		if len(patterns) > 0 {
+			matched := false
+			for _, p := range patterns {
+				if m, _ := filepath.Match(p, strings.TrimPrefix(b.BranchName(), "remotes/")); m {
+					matched = true
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+		if !needTips {
+			filtered = append(filtered, b)
+			continue
+		}
+		tip, err := b.CommitID(c)
+		if err != nil {
+			return nil, err
+		}
+		if len(pointsAt) > 0 {
+			found := false
+			for _, cmt := range pointsAt {
+				if cmt == tip {
+					found = true
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+		for _, m := range merged {
+			if !tip.IsAncestor(c, m) {
+				continue branches
+			}
+		}
+		for _, m := range noMerged {
+			if tip.IsAncestor(c, m) {
+				continue branches
+			}
+		}
+		for _, cmt := range contains {
+			if !cmt.IsAncestor(c, tip) {
+				continue branches
+			}
+		}
+		for _, cmt := range noContains {
+			if cmt.IsAncestor(c, tip) {
+				continue branches
+			}
+		}
+		filtered = append(filtered, b)
+	}
+	return filtered, nil
+}
+
+// sortBranches sorts branches in place by key.
+func sortBranches(c *Client, key string, branches []Branch) error {
+	reverse := strings.HasPrefix(key, "-")
+	key = strings.TrimPrefix(key, "-")
+
+	sortkeys := make(map[Branch]string, len(branches))
+	for _, b := range branches {
+		switch key {
+		case "", "refname":
+			sortkeys[b] = b.String()
+		case "objectname":
+			cmt, err := b.CommitID(c)
+			if err != nil {
+				return err
+			}
+			sortkeys[b] = cmt.String()
+		case "committerdate", "authordate":
+			cmt, err := b.CommitID(c)
+			if err != nil {
+				return err
+			}
+			var date time.Time
+			if key == "committerdate" {
+				date, err = cmt.GetCommitterDate(c)
+			} else {
+				date, err = cmt.GetDate(c)
+			}
+			if err != nil {
+				return err
+			}
+			// Pad so that the dates sort lexically.
+			sortkeys[b] = fmt.Sprintf("%020d", date.Unix())
+		default:
+			return fmt.Errorf("unsupported sort key: %v", key)
+		}
+	}
+	sort.SliceStable(branches, func(i, j int) bool {
+		ki, kj := sortkeys[branches[i]], sortkeys[branches[j]]
+		if ki == kj {
+			return branches[i].String() < branches[j].String()
+		}
+		if reverse {
+			return ki > kj
+		}
+		return ki < kj
+	})
+	return nil
+}
+
+// branchTrackingInfo returns a description of b's relationship to its
+// upstream, such as "ahead 1, behind 2". If showUpstream is true, the
+// upstream's name is included.
+func branchTrackingInfo(c *Client, b Branch, showUpstream bool) string {
+	upstream, err := b.Upstream(c)
+	if err != nil || upstream == "" {
+		return ""
+	}
+	name := strings.TrimPrefix(upstream.BranchName(), "remotes/")
+	if !upstream.Exists(c) {
+		if showUpstream {
+			return name + ": gone"
+		}
+		return "gone"
+	}
+	ahead, behind, err := AheadBehind(c, b, upstream)
+	if err != nil {
+		return ""
+	}
+	var counts []string
+	if ahead > 0 {
+		counts = append(counts, fmt.Sprintf("ahead %d", ahead))
+	}
+	if behind > 0 {
+		counts = append(counts, fmt.Sprintf("behind %d", behind))
+	}
+	switch {
+	case !showUpstream:
+		return strings.Join(counts, ", ")
+	case len(counts) == 0:
+		return name
+	default:
+		return name + ": " + strings.Join(counts, ", ")
+	}
+}
+
+// AheadBehind returns the number of commits reachable from local but not
+// upstream, and the number reachable from upstream but not local.
+func AheadBehind(c *Client, local, upstream Commitish) (ahead, behind int, err error) {
+	lcmt, err := local.CommitID(c)
+	if err != nil {
+		return 0, 0, err
+	}
+	ucmt, err := upstream.CommitID(c)
+	if err != nil {
+		return 0, 0, err
+	}
+	lmap, err := lcmt.AncestorMap(c)
+	if err != nil {
+		return 0, 0, err
+	}
+	umap, err := ucmt.AncestorMap(c)
+	if err != nil {
+		return 0, 0, err
+	}
+	for cmt := range lmap {
+		if _, ok := umap[cmt]; !ok {
+			ahead++
+		}
+	}
+	for cmt := range umap {
+		if _, ok := lmap[cmt]; !ok {
+			behind++
+		}
+	}
+	return ahead, behind, nil
+}
+
+// Upstream returns the branch configured as the upstream of b with
+// branch.<name>.remote and branch.<name>.merge, or the empty string
+// if there is none.
+func (b Branch) Upstream(c *Client) (Branch, error) {
+	name := b.BranchName()
+	remote := c.GetConfig("branch." + name + ".remote")
+	merge := c.GetConfig("branch." + name + ".merge")
+	if remote == "" || merge == "" {
+		return "", nil
+	}
+	if remote == "." {
+		return Branch(merge), nil
+	}
+	if !strings.HasPrefix(merge, "refs/heads/") {
+		return "", fmt.Errorf("Can not determine upstream for %v", merge)
+	}
+	return Branch("refs/remotes/" + remote + "/" + strings.TrimPrefix(merge, "refs/heads/")), nil
+}
+
+// BranchRename renames the branch oldname to newname, including its
+// reflog and config. If oldname is the empty string, the current branch
+// is renamed.
+func BranchRename(c *Client, opts BranchOptions, oldname, newname string) error {
+	return moveBranch(c, opts, oldname, newname, false)
+}
+
+// BranchCopy copies the branch oldname to newname, including its reflog
+// and config. If oldname is the empty string, the current branch is
+// copied.
+func BranchCopy(c *Client, opts BranchOptions, oldname, newname string) error {
+	return moveBranch(c, opts, oldname, newname, true)
+}
+
+func moveBranch(c *Client, opts BranchOptions, oldname, newname string, copy bool) error {
+	head := c.GetHeadBranch()
+	if oldname == "" {
+		if head == "" {
+			return fmt.Errorf("cannot rename the current branch while not on any")
+		}
+		oldname = head.BranchName()
+	}
+	oldb := Branch("refs/heads/" + oldname)
+	newb := Branch("refs/heads/" + newname)
+	if _, err := checkBranchName(c, newname); err != nil {
+		return err
+	}
+	if !oldb.Exists(c) {
+		return fmt.Errorf("branch '%v' not found", oldname)
+	}
+	if newb.Exists(c) && oldb != newb {
+		if !opts.Force {
+			return fmt.Errorf("a branch named '%v' already exists", newname)
+		}
+		if head == newb {
+			return fmt.Errorf("cannot force update the current branch")
+		}
+	}
+
+	value, err := RefSpec(oldb).Value(c)
+	if err != nil {
+		return err
+	}
+	var reflog []ReflogEntry
+	haveReflog := c.Refs().ReflogExists(oldb.String())
+	if haveReflog {
+		reflog, err = c.Refs().ReadReflog(oldb.String())
+		if err != nil {
+			return err
+		}
+		verb := "renamed"
+		if copy {
+			verb = "copied"
+		}
+		entry, err := newReflogEntry(c, true, oldb.String(), oldb, oldb, fmt.Sprintf("Branch: %s %s to %s", verb, oldb, newb))
+		if err != nil {
+			return err
+		}
+		reflog = append(reflog, *entry)
+	}
+
+	if !copy && oldb != newb {
+		if err := c.Refs().DeleteRef(oldb.String()); err != nil {
+			return err
+		}
+	}
+	if err := c.Refs().WriteRef(newb.String(), value, nil); err != nil {
+		return err
+	}
+	if haveReflog {
+		if err := c.Refs().WriteReflog(newb.String(), reflog); err != nil {
+			return err
+		}
+	}
+	if !copy && head == oldb {
+		if err := SymbolicRefUpdate(c, SymbolicRefOptions{}, "HEAD", RefSpec(newb), ""); err != nil {
+			return err
+		}
+	}
+
+	config, err := LoadLocalConfig(c)
+	if err != nil {
+		return err
+	}
+	var changed bool
+	if copy {
+		changed = config.CopySection("branch", oldname, newname)
+	} else {
+		changed = config.RenameSection("branch", oldname, newname)
+	}
+	if changed {
+		if err := config.WriteConfig(); err != nil {
+			return err
+		}
+		c.invalidateConfig()
+	}
+	return nil
+}
+
+// BranchSetUpstream configures the branch named branch to track the
+// upstream branch upstream, which may be either a remote tracking branch
+// or a local branch. If branch is the empty string, the current branch
+// is used.
+func BranchSetUpstream(c *Client, branch, upstream string) error {
+	if branch == "" {
+		head := c.GetHeadBranch()
+		if head == "" {
+			return fmt.Errorf("could not set upstream of HEAD when it does not point to any branch")
+		}
+		branch = head.BranchName()
+	}
+	if !Branch("refs/heads/" + branch).Exists(c) {
+		return fmt.Errorf("branch '%v' does not exist", branch)
+	}
+
+	var remote, merge string
+	upstream = strings.TrimPrefix(upstream, "refs/")
+	upstream = strings.TrimPrefix(upstream, "remotes/")
+	if strings.HasPrefix(upstream, "heads/") {
+		upstream = strings.TrimPrefix(upstream, "heads/")
+	} else if r := strings.SplitN(upstream, "/", 2); len(r) == 2 && Branch("refs/remotes/"+upstream).Exists(c) {
+		remote, merge = r[0], "refs/heads/"+r[1]
+	}
+	if remote == "" {
+		if !Branch("refs/heads/" + upstream).Exists(c) {
+			return fmt.Errorf("the requested upstream branch '%v' does not exist", upstream)
+		}
+		remote, merge = ".", "refs/heads/"+upstream
+	}
+
+	config, err := LoadLocalConfig(c)
+	if err != nil {
+		return err
+	}
+	config.SetConfig("branch."+branch+".remote", remote)
+	config.SetConfig("branch."+branch+".merge", merge)
+	if err := config.WriteConfig(); err != nil {
+		return err
+	}
+	c.invalidateConfig()
+	return nil
+}
+
+// BranchUnsetUpstream removes the upstream information for the branch
+// named branch, or the current branch if branch is the empty string.
+func BranchUnsetUpstream(c *Client, branch string) error {
+	if branch == "" {
+		head := c.GetHeadBranch()
+		if head == "" {
+			return fmt.Errorf("could not unset upstream of HEAD when it does not point to any branch")
+		}
+		branch = head.BranchName()
+	}
+	config, err := LoadLocalConfig(c)
+	if err != nil {
+		return err
+	}
+	if config.Unset("branch."+branch+".remote") != 0 {
+		return fmt.Errorf("Branch '%v' has no upstream information", branch)
+	}
+	config.Unset("branch." + branch + ".merge")
+	if err := config.WriteConfig(); err != nil {
+		return err
+	}
+	c.invalidateConfig()
+	return nil
+}
@@ -0,0 +1,158 @@
+package git
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestBranchRenameAndUpstream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitbranch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := Init(nil, InitOptions{Quiet: true}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, env := range [][2]string{
+		{"GIT_COMMITTER_NAME", "John Smith"},
+		{"GIT_COMMITTER_EMAIL", "test@example.com"},
+		{"GIT_AUTHOR_NAME", "John Smith"},
+		{"GIT_AUTHOR_EMAIL", "test@example.com"},
+	} {
+		if err := os.Setenv(env[0], env[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var cmts []CommitID
+	for _, content := range []string{"foo\n", "bar\n"} {
+		if err := ioutil.WriteFile(dir+"/foo.txt", []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Add(c, AddOptions{}, []File{"foo.txt"}); err != nil {
+			t.Fatal(err)
+		}
+		cmt, err := Commit(c, CommitOptions{}, CommitMessage(content), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmts = append(cmts, cmt)
+	}
+	if err := c.CreateBranch("old", cmts[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := BranchSetUpstream(c, "", "old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := BranchRename(c, BranchOptions{}, "", "renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if head := c.GetHeadBranch(); head != "refs/heads/renamed" {
+		t.Errorf("HEAD not updated after rename: got %v", head)
+	}
+	if Branch("refs/heads/master").Exists(c) {
+		t.Error("Original branch still exists after rename")
+	}
+	if !c.Refs().ReflogExists("refs/heads/renamed") {
+		t.Error("Reflog not moved with branch")
+	}
+	upstream, err := Branch("refs/heads/renamed").Upstream(c)
+	if err != nil || upstream != "refs/heads/old" {
+		t.Errorf("Upstream config not moved with branch: got %v (%v)", upstream, err)
+	}
+	ahead, behind, err := AheadBehind(c, Branch("refs/heads/renamed"), upstream)
+	if err != nil || ahead != 1 || behind != 0 {
+		t.Errorf("Unexpected ahead/behind: got %d/%d (%v)", ahead, behind, err)
+	}
+
+	if err := BranchCopy(c, BranchOptions{}, "renamed", "old"); err == nil {
+		t.Error("Expected error copying over an existing branch")
+	}
+	if err := BranchCopy(c, BranchOptions{Force: true}, "old", "copy"); err != nil {
+		t.Fatal(err)
+	}
+	if !Branch("refs/heads/old").Exists(c) || !Branch("refs/heads/copy").Exists(c) {
+		t.Error("Copy did not keep both branches")
+	}
+
+	var out bytes.Buffer
+	if _, err := BranchList(c, &out, BranchOptions{Merged: []Commitish{cmts[0]}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := "  copy\n  old\n"; out.String() != want {
+		t.Errorf("Unexpected --merged output: got %q want %q", out.String(), want)
+	}
+	out.Reset()
+	if _, err := BranchList(c, &out, BranchOptions{Verbose: 2, Contains: []Commitish{cmts[1]}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := "* renamed " + cmts[1].String()[:7] + " [old: ahead 1] bar\n"; out.String() != want {
+		t.Errorf("Unexpected -vv output: got %q want %q", out.String(), want)
+	}
+	out.Reset()
+	if _, err := BranchList(c, &out, BranchOptions{Sort: "-refname"}, []string{"*e*"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "* renamed\n"; out.String() != want {
+		t.Errorf("Unexpected pattern output: got %q want %q", out.String(), want)
+	}
+
+	if err := BranchUnsetUpstream(c, "renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := BranchUnsetUpstream(c, "renamed"); err == nil {
+		t.Error("Expected error unsetting upstream twice")
+	}
+}
+
+func TestBranchListRemoteHEAD(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo.txt": "foo\n"},
+		map[string]string{"foo.txt": "bar\n"},
+		map[string]string{"baz.txt": "baz\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Set up the remote branches the way that cloning leaves them, with
+	// origin/HEAD pointing at the remote's default branch.
+	if err := c.Refs().WriteRef("refs/remotes/origin/master", head.String(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := SymbolicRefUpdate(c, SymbolicRefOptions{}, "refs/remotes/origin/HEAD", "refs/remotes/origin/master", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		opts BranchOptions
+		want string
+	}{
+		{BranchOptions{Remotes: true}, "  origin/HEAD -> origin/master\n  origin/master\n"},
+		{BranchOptions{All: true}, "* master\n  topic\n  remotes/origin/HEAD -> origin/master\n  remotes/origin/master\n"},
+		{BranchOptions{Remotes: true, Verbose: 1}, "  origin/HEAD   -> origin/master\n  origin/master " + head.String()[:7] + " ours\n"},
+		{BranchOptions{Remotes: true, Contains: []Commitish{head}}, "  origin/HEAD -> origin/master\n  origin/master\n"},
+		{BranchOptions{Remotes: true, PointsAt: []Commitish{head}}, "  origin/HEAD -> origin/master\n  origin/master\n"},
+	}
+	for i, tc := range tests {
+		var out bytes.Buffer
+		if _, err := BranchList(c, &out, tc.opts, nil); err != nil {
+			t.Errorf("Test %d: %v", i, err)
+			continue
+		}
+		if out.String() != tc.want {
+			t.Errorf("Test %d: got %q want %q", i, out.String(), tc.want)
+		}
+	}
+}
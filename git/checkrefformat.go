@@ -0,0 +1,176 @@
+package git
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CheckRefFormatOptions are the options that may be passed to
+// CheckRefFormat.
+type CheckRefFormatOptions struct {
+	// Allow refnames with only a single component (ie. no "/")
+	AllowOneLevel bool
+
+	// Allow a single "*" in the refname, for use in refspec
+	// patterns.
+	RefspecPattern bool
+
+	// Remove leading slashes and collapse consecutive slashes
+	// before checking the name, and return the normalized name.
+	Normalize bool
+
+	// Check that the name is a valid branch name rather than a
+	// full refname. @{-N} is expanded to the Nth last branch checked
+	// out.
+	Branch bool
+}
+
+// InvalidRefName is the error returned when a refname is not valid.
+type InvalidRefName string
+
+func (e InvalidRefName) Error() string {
+	return fmt.Sprintf("'%v' is not a valid ref name", string(e))
+}
+
+// CheckRefFormat checks if refname is acceptable as the name of a ref,
+// using the same rules as git. It returns the name, normalized according
+// to opts, or an InvalidRefName error if it's not valid.
+func CheckRefFormat(c *Client, opts CheckRefFormatOptions, refname string) (string, error) {
+	if opts.Branch {
+		return checkBranchName(c, refname)
+	}
+	if opts.Normalize {
+		refname = normalizeRefName(refname)
+	}
+	if err := checkRefName(refname, opts.AllowOneLevel, opts.RefspecPattern); err != nil {
+		return "", err
+	}
+	return refname, nil
+}
+
+// normalizeRefName removes leading slashes and collapses repeated
+// slashes in refname.
+func normalizeRefName(refname string) string {
+	var sb strings.Builder
+	last := byte('/')
+	for i := 0; i < len(refname); i++ {
+		if refname[i] == '/' && last == '/' {
+			continue
+		}
+		last = refname[i]
+		sb.WriteByte(last)
+	}
+	return sb.String()
+}
+
+// checkRefName checks refname against the rules from
+// git-check-ref-format(1).
+func checkRefName(refname string, allowOneLevel, pattern bool) error {
+	if refname == "" || refname == "@" {
+		return InvalidRefName(refname)
+	}
+	if !allowOneLevel && !strings.Contains(refname, "/") {
+		return InvalidRefName(refname)
+	}
+	if strings.HasSuffix(refname, ".") {
+		return InvalidRefName(refname)
+	}
+	if strings.Contains(refname, "..") || strings.Contains(refname, "@{") {
+		return InvalidRefName(refname)
+	}
+	stars := 0
+	for _, component := range strings.Split(refname, "/") {
+		// This also catches leading and trailing slashes, and
+		// consecutive slashes.
+		if component == "" || component[0] == '.' || strings.HasSuffix(component, ".lock") {
+			return InvalidRefName(refname)
+		}
+	}
+	for i := 0; i < len(refname); i++ {
+		switch ch := refname[i]; ch {
+		case ' ', '~', '^', ':', '?', '[', '\\', 0x7f:
+			return InvalidRefName(refname)
+		case '*':
+			stars++
+			if !pattern || stars > 1 {
+				return InvalidRefName(refname)
+			}
+		default:
+			if ch < 0x20 {
+				return InvalidRefName(refname)
+			}
+		}
+	}
+	return nil
+}
+
+// checkBranchName checks that name is valid as a branch name, and
+// returns the name of the branch after expanding @{-N}.
+func checkBranchName(c *Client, name string) (string, error) {
+	if strings.HasPrefix(name, "@{-") && strings.HasSuffix(name, "}") {
+		n, err := strconv.Atoi(name[3 : len(name)-1])
+		if err != nil || n <= 0 {
+			return "", fmt.Errorf("'%v' is not a valid branch name", name)
+		}
+		return previousBranch(c, n)
+	}
+	if name == "HEAD" || strings.HasPrefix(name, "-") {
+		return "", fmt.Errorf("'%v' is not a valid branch name", name)
+	}
+	if err := checkRefName("refs/heads/"+name, false, false); err != nil {
+		return "", fmt.Errorf("'%v' is not a valid branch name", name)
+	}
+	return name, nil
+}
+
+// previousBranch returns the nth last branch that was checked out, based
+// on the HEAD reflog.
+func previousBranch(c *Client, n int) (string, error) {
+	if c == nil {
+		return "", fmt.Errorf("Not a git repository")
+	}
+	entries, err := c.Refs().ReadReflog("HEAD")
+	if err != nil {
+		return "", err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		msg := entries[i].Message
+		if !strings.HasPrefix(msg, "checkout: moving from ") {
+			continue
+		}
+		n--
+		if n == 0 {
+			from := strings.TrimPrefix(msg, "checkout: moving from ")
+			if idx := strings.Index(from, " to "); idx >= 0 {
+				return from[:idx], nil
+			}
+			return "", fmt.Errorf("Invalid reflog message: %v", msg)
+		}
+	}
+	return "", fmt.Errorf("No previous branch checked out")
+}
+
+// validateRefName returns an error if refname is not a valid name for a
+// ref to be created. Pseudo refs such as HEAD or ORIG_HEAD are allowed in
+// addition to names under refs/.
+func validateRefName(refname string) error {
+	if isPseudoRef(refname) {
+		return nil
+	}
+	return checkRefName(refname, false, false)
+}
+
+// isPseudoRef returns true if refname is a top level ref such as HEAD,
+// which consists solely of uppercase letters and underscores.
+func isPseudoRef(refname string) bool {
+	if refname == "" {
+		return false
+	}
+	for _, ch := range refname {
+		if (ch < 'A' || ch > 'Z') && ch != '_' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCheckRefFormat(t *testing.T) {
+	tests := []struct {
+		opts  CheckRefFormatOptions
+		name  string
+		want  string
+		valid bool
+	}{
+		{CheckRefFormatOptions{}, "refs/heads/master", "refs/heads/master", true},
+		{CheckRefFormatOptions{}, "heads/foo/bar", "heads/foo/bar", true},
+		{CheckRefFormatOptions{}, "master", "", false},
+		{CheckRefFormatOptions{AllowOneLevel: true}, "master", "master", true},
+		{CheckRefFormatOptions{}, "refs/heads/a..b", "", false},
+		{CheckRefFormatOptions{}, "refs/heads/a b", "", false},
+		{CheckRefFormatOptions{}, "refs/heads/foo.lock", "", false},
+		{CheckRefFormatOptions{}, "refs/heads/.hidden", "", false},
+		{CheckRefFormatOptions{}, "refs/heads/foo.", "", false},
+		{CheckRefFormatOptions{}, "refs/heads/foo@{1}", "", false},
+		{CheckRefFormatOptions{}, "refs/heads/a~1", "", false},
+		{CheckRefFormatOptions{}, "refs/heads/a:b", "", false},
+		{CheckRefFormatOptions{}, "refs/heads/a\\b", "", false},
+		{CheckRefFormatOptions{}, "refs/heads/", "", false},
+		{CheckRefFormatOptions{}, "refs//heads/foo", "", false},
+		{CheckRefFormatOptions{Normalize: true}, "//refs//heads/foo", "refs/heads/foo", true},
+		{CheckRefFormatOptions{}, "refs/heads/*", "", false},
+		{CheckRefFormatOptions{RefspecPattern: true}, "refs/heads/*", "refs/heads/*", true},
+		{CheckRefFormatOptions{RefspecPattern: true}, "refs/*/*", "", false},
+		{CheckRefFormatOptions{AllowOneLevel: true}, "@", "", false},
+		{CheckRefFormatOptions{Branch: true}, "feature/foo", "feature/foo", true},
+		{CheckRefFormatOptions{Branch: true}, "HEAD", "", false},
+		{CheckRefFormatOptions{Branch: true}, "-foo", "", false},
+	}
+	for i, tc := range tests {
+		got, err := CheckRefFormat(nil, tc.opts, tc.name)
+		if tc.valid != (err == nil) {
+			t.Errorf("Test %d (%q): got error %v, want valid %v", i, tc.name, err, tc.valid)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("Test %d (%q): got %q want %q", i, tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestInvalidRefNamesRejected(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitcheckrefformat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := Init(nil, InitOptions{Quiet: true}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, env := range [][2]string{
+		{"GIT_COMMITTER_NAME", "John Smith"},
+		{"GIT_COMMITTER_EMAIL", "test@example.com"},
+		{"GIT_AUTHOR_NAME", "John Smith"},
+		{"GIT_AUTHOR_EMAIL", "test@example.com"},
+	} {
+		if err := os.Setenv(env[0], env[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(dir+"/foo.txt", []byte("foo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Add(c, AddOptions{}, []File{"foo.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	cmt, err := Commit(c, CommitOptions{}, "Initial commit\n", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.CreateBranch("bad..name", cmt); err == nil {
+		t.Error("Expected error creating branch with ..")
+	}
+	if err := c.CreateBranch("good/name", cmt); err != nil {
+		t.Errorf("Unexpected error creating valid branch: %v", err)
+	}
+	if err := TagCommit(c, TagOptions{}, "v1 beta", cmt, ""); err == nil {
+		t.Error("Expected error creating tag with a space")
+	}
+	if err := UpdateRef(c, UpdateRefOptions{}, "refs/heads/foo.lock", cmt, ""); err == nil {
+		t.Error("Expected error updating ref ending in .lock")
+	}
+	if err := UpdateRef(c, UpdateRefOptions{NoDeref: true}, "ORIG_HEAD", cmt, ""); err != nil {
+		t.Errorf("Unexpected error updating pseudo ref: %v", err)
+	}
+	if err := RemoteAdd(c, RemoteAddOptions{}, "bad:remote", "http://example.com"); err == nil {
+		t.Error("Expected error adding remote with invalid name")
+	}
+}
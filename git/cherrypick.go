@@ -0,0 +1,79 @@
+package git
+
+import (
+	"fmt"
+)
+
+// CherryPickOptions are the options that may be passed to CherryPick.
+type CherryPickOptions struct {
+	// Invoke an editor to edit the commit message before committing.
+	Edit bool
+
+	// Append a line saying which commit was cherry-picked to the
+	// commit message (-x)
+	RecordOrigin bool
+
+	// Apply the changes to the index and work tree without committing.
+	NoCommit bool
+
+	// Which parent of a merge commit to use as the base, 1 indexed.
+	MergeParent int
+
+	// Add a Signed-off-by trailer for the committer to the message.
+	SignOff bool
+
+	// Allow commits which don't change anything to be picked, instead
+	// of stopping.
+	AllowEmpty bool
+
+	// Options for the merge strategy, the same as
+	// MergeOptions.StrategyOptions.
+	StrategyOptions []string
+
+	// Sequencer subcommands. These continue, skip the current commit
+	// of, abort or forget about a cherry-pick that was stopped because
+	// of conflicts.
+	Continue, Skip, Quit, Abort bool
+}
+
+// CherryPick applies the changes introduced by each of commits on top of
+// HEAD, in order, creating a new commit for each one. If a commit can not
+// be applied cleanly, CherryPick stops and returns an error so that the
+// conflicts can be resolved and the cherry-pick continued with
+// opts.Continue.
+func CherryPick(c *Client, opts CherryPickOptions, commits []Commitish) error {
+	switch {
+	case opts.Continue:
+		return sequencerContinue(c)
+	case opts.Skip:
+		return sequencerSkip(c)
+	case opts.Abort:
+		return sequencerAbort(c)
+	case opts.Quit:
+		return c.removeSequencer()
+	case len(commits) == 0:
+		return fmt.Errorf("Must provide commit to cherry-pick")
+	}
+
+	todo := make([]sequencerStep, 0, len(commits))
+	for _, cmt := range commits {
+		cid, err := cmt.CommitID(c)
+		if err != nil {
+			return err
+		}
+		todo = append(todo, sequencerStep{Action: "pick", Commit: cid})
+	}
+	seqOpts := sequencerOptions{
+		Edit:            opts.Edit,
+		NoCommit:        opts.NoCommit,
+		SignOff:         opts.SignOff,
+		RecordOrigin:    opts.RecordOrigin,
+		AllowEmpty:      opts.AllowEmpty,
+		Mainline:        opts.MergeParent,
+		StrategyOptions: opts.StrategyOptions,
+	}
+	if err := startSequencer(c, seqOpts, todo); err != nil {
+		return err
+	}
+	return runSequencer(c, seqOpts, todo)
+}
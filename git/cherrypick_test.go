@@ -0,0 +1,147 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCherryPick(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo.txt": "a\nb\nc\nd\ne\n"},
+		map[string]string{"foo.txt": "A\nb\nc\nd\ne\n"},
+		map[string]string{"foo.txt": "a\nb\nc\nd\nE\n", "bar.txt": "bar\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic, err := RevParseCommitish(c, &RevParseOptions{}, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	topicid, err := topic.CommitID(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CherryPick(c, CherryPickOptions{RecordOrigin: true}, []Commitish{topic}); err != nil {
+		t.Fatal(err)
+	}
+	picked, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parents, _ := picked.Parents(c); len(parents) != 1 || parents[0] != head {
+		t.Errorf("Unexpected parents of cherry-picked commit: %v", parents)
+	}
+	want := "theirs\n\n(cherry picked from commit " + topicid.String() + ")\n"
+	if msg, _ := picked.GetCommitMessage(c); string(msg) != want {
+		t.Errorf("Unexpected message: got %q want %q", msg, want)
+	}
+	if content, _ := ioutil.ReadFile("foo.txt"); string(content) != "A\nb\nc\nd\nE\n" {
+		t.Errorf("Unexpected content after cherry-pick: got %q", content)
+	}
+	if c.sequencerInProgress() {
+		t.Error("Sequencer state left behind after cherry-pick")
+	}
+
+	// Picking it again is empty, and stops.
+	if err := CherryPick(c, CherryPickOptions{}, []Commitish{topic}); err == nil {
+		t.Error("Expected empty cherry-pick to fail")
+	}
+	if err := CherryPick(c, CherryPickOptions{Skip: true}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if cur, _ := c.GetHeadCommit(); cur != picked || c.sequencerInProgress() {
+		t.Errorf("Unexpected state after skip")
+	}
+}
+
+func TestCherryPickConflict(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo.txt": "foo\n"},
+		map[string]string{"foo.txt": "ours\n"},
+		map[string]string{"foo.txt": "theirs\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic, err := RevParseCommitish(c, &RevParseOptions{}, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CherryPick(c, CherryPickOptions{}, []Commitish{topic}); err == nil {
+		t.Fatal("Expected conflicting cherry-pick to fail")
+	}
+	if !c.GitDir.File("CHERRY_PICK_HEAD").Exists() || !c.sequencerInProgress() {
+		t.Fatal("Cherry-pick state not saved after conflict")
+	}
+	if err := CherryPick(c, CherryPickOptions{}, []Commitish{topic}); err == nil {
+		t.Error("Expected cherry-pick while one is in progress to fail")
+	}
+	if err := CherryPick(c, CherryPickOptions{Continue: true}, nil); err == nil {
+		t.Error("Expected continue with unresolved conflicts to fail")
+	}
+
+	// Abort and try again, then resolve the conflict.
+	if err := CherryPick(c, CherryPickOptions{Abort: true}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := ioutil.ReadFile("foo.txt"); string(content) != "ours\n" {
+		t.Errorf("Unexpected content after abort: got %q", content)
+	}
+	if c.sequencerInProgress() || c.GitDir.File("CHERRY_PICK_HEAD").Exists() {
+		t.Error("Cherry-pick state not removed by abort")
+	}
+
+	if err := CherryPick(c, CherryPickOptions{}, []Commitish{topic}); err == nil {
+		t.Fatal("Expected conflicting cherry-pick to fail")
+	}
+	if err := ioutil.WriteFile("foo.txt", []byte("resolved\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Add(c, AddOptions{}, []File{"foo.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CherryPick(c, CherryPickOptions{Continue: true}, nil); err != nil {
+		t.Fatal(err)
+	}
+	picked, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parents, _ := picked.Parents(c); len(parents) != 1 || parents[0] != head {
+		t.Errorf("Unexpected parents of cherry-picked commit: %v", parents)
+	}
+	if msg, _ := picked.GetCommitMessage(c); msg != "theirs\n" {
+		t.Errorf("Unexpected message: got %q", msg)
+	}
+	if c.sequencerInProgress() || c.GitDir.File("CHERRY_PICK_HEAD").Exists() {
+		t.Error("Cherry-pick state not removed after continuing")
+	}
+}
+
+func TestAppendTrailer(t *testing.T) {
+	tests := []struct {
+		msg, line, want string
+	}{
+		{"Subject\n", "Signed-off-by: A <a@b>", "Subject\n\nSigned-off-by: A <a@b>\n"},
+		{"Subject\n\nBody text.\n", "Signed-off-by: A <a@b>", "Subject\n\nBody text.\n\nSigned-off-by: A <a@b>\n"},
+		{"Subject\n\nAcked-by: B <b@c>\n", "Signed-off-by: A <a@b>", "Subject\n\nAcked-by: B <b@c>\nSigned-off-by: A <a@b>\n"},
+		{"Subject\n\nSigned-off-by: A <a@b>\n", "Signed-off-by: A <a@b>", "Subject\n\nSigned-off-by: A <a@b>\n"},
+	}
+	for _, tc := range tests {
+		if got := appendTrailer(tc.msg, tc.line); got != tc.want {
+			t.Errorf("appendTrailer(%q, %q): got %q want %q", tc.msg, tc.line, got, tc.want)
+		}
+	}
+	if !strings.HasSuffix(appendTrailer("Subject", "(cherry picked from commit abc)"), "\n\n(cherry picked from commit abc)\n") {
+		t.Error("Unexpected cherry picked line")
+	}
+}
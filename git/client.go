@@ -10,6 +10,7 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -123,9 +124,18 @@ type Client struct {
 
 	objcache map[shaRef]GitObject
 
+	// Cache of the Sha1 tables of the pack indexes, by file name, used
+	// to abbreviate object names.
+	packSha1Tables map[string]*packSha1Table
+
 	// Cache of previous config lookups to avoid re-parsing.
 	configCache               map[string]string
 	localConfig, globalConfig *GitConfig
+
+	// The backend used to store refs, and the GitDir that it was
+	// created for. Use Refs() to access it.
+	refs       RefBackend
+	refsGitDir GitDir
 }
 
 func (c *Client) Close() error {
@@ -237,7 +247,7 @@ func NewClient(gitDir, workDir string) (*Client, error) {
 		}
 	}
 	m := make(map[Sha1]objectLocation)
-	return &Client{GitDir(gitdir), WorkDir(workdir), objdir, "", m, make(map[shaRef]GitObject), nil, nil, nil}, nil
+	return &Client{GitDir(gitdir), WorkDir(workdir), objdir, "", m, make(map[shaRef]GitObject), nil, nil, nil, nil, nil, ""}, nil
 }
 
 // Returns the branchname of the HEAD branch, or the empty string if the
@@ -298,45 +308,25 @@ func (c *Client) ResetWorkTree() error {
 
 // Return valid branches that a Client knows about.
 func (c *Client) GetBranches() ([]Branch, error) {
-	files := []string{}
-
-	err := filepath.Walk(filepath.Join(c.GitDir.String(), "refs", "heads"),
-		func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-			if !info.IsDir() {
-				files = append(files, path)
-			}
-			return nil
-		})
+	refs, err := c.Refs().ListRefs("refs/heads/")
 	if err != nil {
 		return nil, err
 	}
-
 	branches := []Branch{}
-	for _, f := range files {
-		branches = append(branches, Branch(f[len(c.GitDir.String())+1:]))
+	for _, r := range refs {
+		branches = append(branches, Branch(r))
 	}
 	return branches, nil
 }
 
 // Return valid branches that a Client knows about.
 func (c *Client) GetRemoteBranches() (branches []Branch, err error) {
-	remotes, err := ioutil.ReadDir(c.GitDir.String() + "/refs/remotes")
+	refs, err := c.Refs().ListRefs("refs/remotes/")
 	if err != nil {
 		return nil, err
 	}
-	for _, d := range remotes {
-		if d.IsDir() {
-			brs, err := ioutil.ReadDir(c.GitDir.String() + "/refs/remotes/" + d.Name())
-			if err != nil {
-				continue
-			}
-			for _, b := range brs {
-				branches = append(branches, Branch("refs/remotes/"+d.Name()+"/"+b.Name()))
-			}
-		}
+	for _, r := range refs {
+		branches = append(branches, Branch(r))
 	}
 	return
 }
@@ -348,16 +338,10 @@ func (c *Client) CreateBranch(name string, commit Commitish) error {
 		return err
 	}
 
-	if name == "HEAD" {
-		return fmt.Errorf("fatal: 'HEAD' is not a valid branch name.")
+	if name == "HEAD" || strings.HasPrefix(name, "-") || checkRefName("refs/heads/"+name, false, false) != nil {
+		return fmt.Errorf("fatal: '%v' is not a valid branch name.", name)
 	}
-
-	// Create the file using File.Create first to ensure any parent directories are created.
-	if _, err := c.GitDir.File(File("refs/heads/" + name)).Create(); err != nil {
-		return err
-	}
-
-	return c.GitDir.WriteFile(File("refs/heads/"+name), []byte(id.String()), 0644)
+	return c.Refs().WriteRef("refs/heads/"+name, id.String(), nil)
 }
 
 // A Person is usually an Author, but might be a committer. It's someone
@@ -387,6 +371,36 @@ func timeToGitTime(t time.Time) string {
 	return val
 }
 
+// parsePerson parses a person in the format used by commit objects
+// (ie. "Name <email> unixtime timezone") into a Person.
+func parsePerson(s string) (Person, error) {
+	start := strings.IndexByte(s, '<')
+	end := strings.LastIndexByte(s, '>')
+	if start < 0 || end < start {
+		return Person{}, fmt.Errorf("Invalid person: %v", s)
+	}
+	p := Person{
+		Name:  strings.TrimSpace(s[:start]),
+		Email: s[start+1 : end],
+	}
+	pieces := strings.Fields(s[end+1:])
+	if len(pieces) != 2 {
+		return p, nil
+	}
+	unix, err := strconv.ParseInt(pieces[0], 10, 64)
+	if err != nil {
+		return Person{}, fmt.Errorf("Invalid time for person: %v", s)
+	}
+	tz, err := strconv.Atoi(pieces[1])
+	if err != nil {
+		return Person{}, fmt.Errorf("Invalid timezone for person: %v", s)
+	}
+	offset := (tz/100)*60*60 + (tz%100)*60
+	t := time.Unix(unix, 0).In(time.FixedZone(pieces[1], offset))
+	p.Time = &t
+	return p, nil
+}
+
 // Returns the author that should be used for a commit message.
 // If time t is provided,
 func (c *Client) GetAuthor(t *time.Time) Person {
@@ -544,8 +558,7 @@ func (c *Client) GetHeadCommit() (CommitID, error) {
 		return b.CommitID(c)
 	}
 	// Otherwise, try and parse the detached HEAD state.
-	f := c.GitDir.File("HEAD")
-	val, err := f.ReadFirstLine()
+	val, err := c.Refs().ReadRef("HEAD")
 	if err != nil {
 		return CommitID{}, InvalidHead
 	}
@@ -676,6 +689,13 @@ func (c *Client) GetConfig(varname string) string {
 	return ""
 }
 
+// invalidateConfig clears the cached config variables, so that changes
+// written to the config file are seen by GetConfig.
+func (c *Client) invalidateConfig() {
+	c.configCache = nil
+	c.localConfig = nil
+}
+
 // Returns the .git/objects directory.
 func (c *Client) GetObjectsDir() File {
 	if objdir := os.Getenv("GIT_OBJECT_DIRECTORY"); objdir != "" {
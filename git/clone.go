@@ -100,13 +100,7 @@ func Clone(opts CloneOptions, rmt Remote, dst File) error {
 			continue
 		}
 		refname := strings.Replace(ref.Name, "refs/heads/", "refs/remotes/"+org+"/", 1)
-		f := c.GitDir.File(File(refname))
-		cf, err := f.Create()
-		if err != nil {
-			return err
-		}
-		cf.Close()
-		if err := f.Append(fmt.Sprintf("%v\n", ref.Value)); err != nil {
+		if err := c.Refs().WriteRef(refname, ref.Value.String(), nil); err != nil {
 			return err
 		}
 	}
@@ -131,14 +125,14 @@ func Clone(opts CloneOptions, rmt Remote, dst File) error {
 		return err
 	}
 
-	reflog, err := c.GitDir.ReadFile("logs/refs/heads/master")
+	reflog, err := c.Refs().ReadReflog("refs/heads/master")
 	if err != nil {
 		return err
 	}
 	// HEAD is already pointing to refs/heads/master from init, but the
-	// logs/HEAD reflog isn't created yet. We cheat by just copying the
+	// HEAD reflog isn't created yet. We cheat by just copying the
 	// one created by UpdateRefSpec above.
-	if err := c.GitDir.WriteFile("logs/HEAD", reflog, 0755); err != nil {
+	if err := c.Refs().WriteReflog("HEAD", reflog); err != nil {
 		return err
 	}
 	if opts.Bare {
@@ -0,0 +1,226 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// The escape sequence which resets all colours and attributes.
+const colorReset = "\x1b[m"
+
+// WantColor returns whether output should be coloured. when is the value
+// given on the command line, which is "always", "never" or "auto". If it's
+// empty, the config variable (such as "color.diff") is used instead, or
+// color.ui if that isn't set either. auto colours the output when stdout
+// is a terminal, the same as git.
+func WantColor(c *Client, when, config string) (bool, error) {
+	fromConfig := when == ""
+	if fromConfig {
+		when = c.GetConfig(config)
+		if when == "" {
+			when = c.GetConfig("color.ui")
+		}
+		if when == "" {
+			when = "auto"
+		}
+	}
+	switch strings.ToLower(when) {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+	default:
+		if !fromConfig {
+			return false, fmt.Errorf(`option 'color' expects "always", "auto", or "never"`)
+		}
+		// Any other true value in the config means auto.
+		switch strings.ToLower(when) {
+		case "false", "no", "off", "0":
+			return false, nil
+		}
+	}
+	if term := os.Getenv("TERM"); term == "" || term == "dumb" {
+		return false, nil
+	}
+	return terminal.IsTerminal(int(os.Stdout.Fd())), nil
+}
+
+// The SGR codes of the attributes that may be given in a colour, and of
+// the attributes which turn them off again.
+var colorAttributes = map[string][2]int{
+	"bold":    {1, 22},
+	"dim":     {2, 22},
+	"italic":  {3, 23},
+	"ul":      {4, 24},
+	"blink":   {5, 25},
+	"reverse": {7, 27},
+	"strike":  {9, 29},
+}
+
+var colorNames = []string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+// parseColor converts a colour as it's written in the config, such as
+// "bold red" or "#ff0000 ul", into an ANSI escape sequence. It's empty
+// for "normal", which doesn't change anything.
+func parseColor(spec string) (string, error) {
+	words := strings.Fields(spec)
+	if len(words) == 1 && strings.ToLower(words[0]) == "reset" {
+		return colorReset, nil
+	}
+
+	// The codes for the foreground and background colours, where the
+	// background code is found by adding 10 to the foreground code.
+	var colors []string
+	var attrs []int
+	for _, word := range words {
+		word = strings.ToLower(word)
+		if code, ok := parseColorCode(word); ok {
+			if len(colors) == 2 {
+				return "", fmt.Errorf("invalid color value: %v", spec)
+			}
+			colors = append(colors, code)
+			continue
+		}
+		name, negate := word, false
+		if strings.HasPrefix(name, "no") {
+			name, negate = strings.TrimPrefix(strings.TrimPrefix(name, "no"), "-"), true
+		}
+		attr, ok := colorAttributes[name]
+		if !ok {
+			return "", fmt.Errorf("invalid color value: %v", spec)
+		}
+		if negate {
+			attrs = append(attrs, attr[1])
+		} else {
+			attrs = append(attrs, attr[0])
+		}
+	}
+
+	var codes []string
+	sort.Ints(attrs)
+	for i, attr := range attrs {
+		if i == 0 || attrs[i-1] != attr {
+			codes = append(codes, strconv.Itoa(attr))
+		}
+	}
+	for i, code := range colors {
+		if code == "" {
+			continue
+		}
+		if i == 1 {
+			// The background codes are the foreground codes plus
+			// 10, and 4 instead of 3 for the extended colours.
+			if code[0] == '3' && len(code) > 1 && code[1] == '8' {
+				code = "4" + code[1:]
+			} else {
+				n, _ := strconv.Atoi(code)
+				code = strconv.Itoa(n + 10)
+			}
+		}
+		codes = append(codes, code)
+	}
+	if len(codes) == 0 {
+		return "", nil
+	}
+	return "\x1b[" + strings.Join(codes, ";") + "m", nil
+}
+
+// parseColorCode parses a single colour name, number or #rrggbb value into
+// its foreground SGR code. "normal" is a colour without a code.
+func parseColorCode(word string) (string, bool) {
+	switch word {
+	case "normal":
+		return "", true
+	case "default":
+		return "39", true
+	}
+	for i, name := range colorNames {
+		if word == name {
+			return strconv.Itoa(30 + i), true
+		}
+		if word == "bright"+name {
+			return strconv.Itoa(90 + i), true
+		}
+	}
+	if n, err := strconv.Atoi(word); err == nil {
+		switch {
+		case n < -1 || n > 255:
+			return "", false
+		case n == -1:
+			return "", true
+		case n < 8:
+			return strconv.Itoa(30 + n), true
+		case n < 16:
+			return strconv.Itoa(90 + n - 8), true
+		default:
+			return fmt.Sprintf("38;5;%d", n), true
+		}
+	}
+	if len(word) == 7 && word[0] == '#' {
+		rgb, err := strconv.ParseUint(word[1:], 16, 32)
+		if err != nil {
+			return "", false
+		}
+		return fmt.Sprintf("38;2;%d;%d;%d", rgb>>16, (rgb>>8)&0xff, rgb&0xff), true
+	}
+	return "", false
+}
+
+// diffColors are the escape sequences used for each part of a diff. They
+// are all empty if the diff isn't coloured.
+type diffColors struct {
+	Reset, Context, Meta, Frag, Func, Old, New, Commit, Whitespace string
+
+	OldMoved, OldMovedAlternative, OldMovedDimmed, OldMovedAlternativeDimmed string
+	NewMoved, NewMovedAlternative, NewMovedDimmed, NewMovedAlternativeDimmed string
+}
+
+// loadDiffColors returns the colours for a diff, which are git's default
+// colours overridden by the color.diff.<slot> config. If color isn't set,
+// they're all empty.
+func loadDiffColors(c *Client, color bool) (diffColors, error) {
+	if !color {
+		return diffColors{}, nil
+	}
+	colors := diffColors{Reset: colorReset}
+	for _, slot := range []struct {
+		names []string
+		color *string
+		def   string
+	}{
+		{[]string{"context", "plain"}, &colors.Context, ""},
+		{[]string{"meta"}, &colors.Meta, "\x1b[1m"},
+		{[]string{"frag"}, &colors.Frag, "\x1b[36m"},
+		{[]string{"func"}, &colors.Func, ""},
+		{[]string{"old"}, &colors.Old, "\x1b[31m"},
+		{[]string{"new"}, &colors.New, "\x1b[32m"},
+		{[]string{"commit"}, &colors.Commit, "\x1b[33m"},
+		{[]string{"whitespace"}, &colors.Whitespace, "\x1b[41m"},
+		{[]string{"oldMoved"}, &colors.OldMoved, "\x1b[1;35m"},
+		{[]string{"oldMovedAlternative"}, &colors.OldMovedAlternative, "\x1b[1;34m"},
+		{[]string{"oldMovedDimmed"}, &colors.OldMovedDimmed, "\x1b[2m"},
+		{[]string{"oldMovedAlternativeDimmed"}, &colors.OldMovedAlternativeDimmed, "\x1b[2;3m"},
+		{[]string{"newMoved"}, &colors.NewMoved, "\x1b[1;36m"},
+		{[]string{"newMovedAlternative"}, &colors.NewMovedAlternative, "\x1b[1;33m"},
+		{[]string{"newMovedDimmed"}, &colors.NewMovedDimmed, "\x1b[2m"},
+		{[]string{"newMovedAlternativeDimmed"}, &colors.NewMovedAlternativeDimmed, "\x1b[2;3m"},
+	} {
+		*slot.color = slot.def
+		for _, name := range slot.names {
+			if spec := c.GetConfig("color.diff." + name); spec != "" {
+				color, err := parseColor(spec)
+				if err != nil {
+					return diffColors{}, err
+				}
+				*slot.color = color
+			}
+		}
+	}
+	return colors, nil
+}
@@ -0,0 +1,60 @@
+package git
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		spec, want string
+	}{
+		{"bold red", "\x1b[1;31m"},
+		{"red blue", "\x1b[31;44m"},
+		{"#ff0000 ul", "\x1b[4;38;2;255;0;0m"},
+		{"reset", "\x1b[m"},
+		{"normal", ""},
+		{"nobold ul", "\x1b[4;22m"},
+		{"no-italic", "\x1b[23m"},
+		{"brightgreen 208", "\x1b[92;48;5;208m"},
+		{"-1 black", "\x1b[40m"},
+		{"default", "\x1b[39m"},
+	}
+	for _, tc := range tests {
+		got, err := parseColor(tc.spec)
+		if err != nil {
+			t.Errorf("%q: %v", tc.spec, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%q: got %q want %q", tc.spec, got, tc.want)
+		}
+	}
+	for _, spec := range []string{"red green blue", "sparkly", "256"} {
+		if _, err := parseColor(spec); err == nil {
+			t.Errorf("Expected %q to be an invalid color", spec)
+		}
+	}
+}
+
+func TestWhitespaceErrors(t *testing.T) {
+	tests := []struct {
+		config, line, want string
+	}{
+		{"", "x\n", "SxR\n"},
+		{"", " \tx  \n", "W R\tSxRW  R\n"},
+		{"-space-before-tab", " \tx\n", " \tSxR\n"},
+		{"tab-in-indent", "\tx\n", "W\tRSxR\n"},
+		{"indent-with-non-tab,tabwidth=4", "        x\n", "W        RSxR\n"},
+		{"indent-with-non-tab", "    x\n", "S    xR\n"},
+		{"cr-at-eol", "x\r\n", "SxR\r\n"},
+		{"", "x\r\n", "SxRW\rR\n"},
+	}
+	for _, tc := range tests {
+		var buf bytes.Buffer
+		parseWhitespaceRule(tc.config).writeChecked(&buf, tc.line, "S", "R", "W")
+		if got := buf.String(); got != tc.want {
+			t.Errorf("%q with %q: got %q want %q", tc.line, tc.config, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package git
+
+import (
+	"fmt"
+)
+
+// markMovedLines marks the lines in patches which were moved rather than
+// added or removed, for --color-moved. mode is one of "no", "default",
+// "plain", "blocks", "zebra" or "dimmed-zebra", and it follows git's
+// mark_color_as_moved.
+func markMovedLines(patches []*filePatch, mode string) error {
+	switch mode {
+	case "", "no":
+		return nil
+	case "default":
+		mode = "zebra"
+	case "plain", "blocks", "zebra", "dimmed-zebra":
+	default:
+		return fmt.Errorf("color moved setting must be one of 'no', 'default', 'blocks', 'zebra', 'dimmed-zebra', 'plain'")
+	}
+
+	// All of the lines are treated as a single sequence, in the order
+	// they are written, with nil wherever something else separates
+	// them.
+	var lines []*patchLine
+	removed := make(map[string][]int)
+	added := make(map[string][]int)
+	for _, p := range patches {
+		lines = append(lines, nil)
+		for i := range p.Hunks {
+			lines = append(lines, nil)
+			for j := range p.Hunks[i].Lines {
+				l := &p.Hunks[i].Lines[j]
+				switch l.Op {
+				case '-':
+					removed[l.Text] = append(removed[l.Text], len(lines))
+				case '+':
+					added[l.Text] = append(added[l.Text], len(lines))
+				}
+				lines = append(lines, l)
+				if l.NoEOL {
+					lines = append(lines, nil)
+				}
+			}
+		}
+	}
+
+	// The lines on the other side which the current block of moved
+	// lines may have come from.
+	var candidates []int
+	flipped := false
+	blockLength := 0
+	var blockOp byte
+	for n := 0; n < len(lines); n++ {
+		l := lines[n]
+		var matches []int
+		if l == nil || l.Op == ' ' {
+			flipped = false
+		} else if l.Op == '+' {
+			matches = removed[l.Text]
+		} else {
+			matches = added[l.Text]
+		}
+
+		if len(candidates) > 0 && (matches == nil || l.Op != blockOp) {
+			if !adjustMovedBlock(lines, n, blockLength, mode) && blockLength > 1 {
+				// Start again from the second line of the block,
+				// since it may be the start of a longer one.
+				matches = nil
+				n -= blockLength
+			}
+			candidates = nil
+			blockLength = 0
+			flipped = false
+		}
+		if matches == nil {
+			blockOp = 0
+			continue
+		}
+		if mode == "plain" {
+			l.Moved |= movedLine
+			continue
+		}
+
+		var next []int
+		for _, p := range candidates {
+			if q := p + 1; q < len(lines) && lines[q] != nil && lines[q].Op == lines[p].Op && lines[q].Text == l.Text {
+				next = append(next, q)
+			}
+		}
+		candidates = next
+		if len(candidates) == 0 {
+			contiguous := adjustMovedBlock(lines, n, blockLength, mode)
+			if !contiguous && blockLength > 1 {
+				n -= blockLength
+			} else {
+				candidates = append([]int(nil), matches...)
+			}
+			flipped = contiguous && len(candidates) > 0 && blockOp == l.Op && !flipped
+			if len(candidates) > 0 {
+				blockOp = l.Op
+			} else {
+				blockOp = 0
+			}
+			blockLength = 0
+		}
+		if len(candidates) > 0 {
+			blockLength++
+			l.Moved |= movedLine
+			if flipped && mode != "blocks" {
+				l.Moved |= movedAlternative
+			}
+		}
+	}
+	adjustMovedBlock(lines, len(lines), blockLength, mode)
+
+	if mode == "dimmed-zebra" {
+		dimMovedLines(lines)
+	}
+	return nil
+}
+
+// adjustMovedBlock unmarks the block of blockLength lines before n if it's
+// too short to be considered moved, which is when it has fewer than 20
+// alphanumeric characters. It returns whether the block is still moved.
+func adjustMovedBlock(lines []*patchLine, n, blockLength int, mode string) bool {
+	if mode == "plain" {
+		return blockLength > 0
+	}
+	alnum := 0
+	for i := 1; i <= blockLength; i++ {
+		text := lines[n-i].Text
+		for j := 0; j < len(text); j++ {
+			if ch := text[j]; ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' {
+				if alnum++; alnum >= 20 {
+					return true
+				}
+			}
+		}
+	}
+	for i := 1; i <= blockLength; i++ {
+		lines[n-i].Moved &^= movedLine
+	}
+	return false
+}
+
+// dimMovedLines dims the moved lines which aren't at the edge of a block,
+// for dimmed-zebra.
+func dimMovedLines(lines []*patchLine) {
+	const zebra = movedLine | movedAlternative
+	for n, l := range lines {
+		if l == nil || l.Op == ' ' || l.Moved&movedLine == 0 {
+			continue
+		}
+		var prev, next *patchLine
+		if n > 0 && lines[n-1] != nil && lines[n-1].Op != ' ' {
+			prev = lines[n-1]
+		}
+		if n+1 < len(lines) && lines[n+1] != nil && lines[n+1].Op != ' ' {
+			next = lines[n+1]
+		}
+		if prev != nil && prev.Moved&zebra == l.Moved&zebra && next != nil && next.Moved&zebra == l.Moved&zebra {
+			l.Moved |= movedDimmed
+			continue
+		}
+		// The edges of a block are interesting if they're next to a
+		// different block.
+		if prev != nil && prev.Moved&movedLine != 0 && prev.Moved&movedAlternative != l.Moved&movedAlternative {
+			continue
+		}
+		if next != nil && next.Moved&movedLine != 0 && next.Moved&movedAlternative != l.Moved&movedAlternative {
+			continue
+		}
+		l.Moved |= movedDimmed
+	}
+}
@@ -0,0 +1,753 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// A CombinedDiff is a file in a merge commit which is different from the
+// file at the same path in every one of the merge's parents. A missing
+// file has an empty TreeEntry.
+type CombinedDiff struct {
+	Name    IndexPath
+	Parents []TreeEntry
+	Result  TreeEntry
+}
+
+// status returns the status of the file compared to parent n, the same as
+// in raw output.
+func (d CombinedDiff) status(n int) byte {
+	switch {
+	case d.Result.FileMode == 0:
+		return 'D'
+	case d.Parents[n].FileMode == 0:
+		return 'A'
+	default:
+		return 'M'
+	}
+}
+
+// writeRaw writes d in the raw or name formats selected by opts.
+func (d CombinedDiff) writeRaw(c *Client, w io.Writer, opts DiffCommonOptions) {
+	sep, term := "\t", "\n"
+	if opts.NullTerminate {
+		sep, term = "\x00", "\x00"
+	}
+	if opts.Raw && !opts.NameOnly && !opts.NameStatus {
+		// There's a colon for each parent.
+		io.WriteString(w, strings.Repeat(":", len(d.Parents)))
+		for _, p := range d.Parents {
+			fmt.Fprintf(w, "%06o ", p.FileMode)
+		}
+		fmt.Fprintf(w, "%06o", d.Result.FileMode)
+		for _, p := range d.Parents {
+			fmt.Fprintf(w, " %v", opts.rawSha1(c, p.Sha1))
+		}
+		fmt.Fprintf(w, " %v ", opts.rawSha1(c, d.Result.Sha1))
+	}
+	if !opts.NameOnly {
+		for i := range d.Parents {
+			fmt.Fprintf(w, "%c", d.status(i))
+		}
+		io.WriteString(w, sep)
+	}
+	fmt.Fprintf(w, "%v%s", d.Name, term)
+}
+
+// DiffCombined returns the files in the merge commit cmt which differ from
+// every one of its parents, sorted by name. Only the files which match
+// paths are compared, or every file if there are none.
+func DiffCombined(c *Client, cmt CommitID, paths []string) ([]CombinedDiff, error) {
+	parents, err := cmt.Parents(c)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]File, len(paths))
+	for i, p := range paths {
+		files[i] = File(p)
+	}
+	spec, err := newPathspec(c, files)
+	if err != nil {
+		return nil, err
+	}
+	getObjects := func(cmt CommitID) (map[IndexPath]TreeEntry, error) {
+		tree, err := cmt.TreeID(c)
+		if err != nil {
+			return nil, err
+		}
+		objects, err := tree.GetAllObjects(c, "", true, true)
+		if err != nil {
+			return nil, err
+		}
+		for name, e := range objects {
+			if e.FileMode == ModeTree || !spec.Matches(name, false) {
+				delete(objects, name)
+			}
+		}
+		return objects, nil
+	}
+
+	result, err := getObjects(cmt)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[IndexPath]struct{})
+	for name := range result {
+		names[name] = struct{}{}
+	}
+	parentObjects := make([]map[IndexPath]TreeEntry, len(parents))
+	for i, p := range parents {
+		if parentObjects[i], err = getObjects(p); err != nil {
+			return nil, err
+		}
+		for name := range parentObjects[i] {
+			names[name] = struct{}{}
+		}
+	}
+
+	var diffs []CombinedDiff
+	for name := range names {
+		d := CombinedDiff{Name: name, Result: result[name], Parents: make([]TreeEntry, len(parents))}
+		changed := true
+		for i, objects := range parentObjects {
+			d.Parents[i] = objects[name]
+			if d.Parents[i] == d.Result {
+				changed = false
+				break
+			}
+		}
+		if changed {
+			diffs = append(diffs, d)
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Name < diffs[j].Name })
+	return diffs, nil
+}
+
+// GenerateCombinedDiff writes diffs, which were returned by DiffCombined,
+// to w in the formats selected by opts. The patch is a dense combined diff
+// (--cc) unless opts.DiffMerges is "combined". Like git, the diffstat
+// formats show stats, the changes against the merge's first parent.
+func GenerateCombinedDiff(c *Client, opts DiffCommonOptions, diffs []CombinedDiff, stats []HashDiff, w io.Writer) error {
+	if len(diffs) == 0 {
+		return nil
+	}
+	if opts.NameOnly || opts.NameStatus {
+		for _, d := range diffs {
+			d.writeRaw(c, w, opts)
+		}
+		return nil
+	}
+
+	separator := false
+	if opts.Stat || opts.NumStat || opts.ShortStat || opts.DirStat {
+		statOpts := opts
+		statOpts.Patch, statOpts.Raw = false, false
+		if err := GeneratePatch(c, statOpts, stats, w); err != nil {
+			return err
+		}
+		separator = true
+	}
+	if opts.Raw {
+		for _, d := range diffs {
+			d.writeRaw(c, w, opts)
+		}
+		separator = true
+	}
+	if !opts.Patch {
+		return nil
+	}
+	if separator {
+		if opts.NullTerminate {
+			io.WriteString(w, "\x00")
+		} else {
+			io.WriteString(w, "\n")
+		}
+	}
+
+	colors, err := loadDiffColors(c, opts.Color)
+	if err != nil {
+		return err
+	}
+	attrs, err := loadAttributes(c)
+	if err != nil {
+		return err
+	}
+	for _, d := range diffs {
+		if err := writeCombinedPatch(c, w, opts, colors, attrs, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A lostLine is a line which is in some of a merge's parents, but which
+// isn't in the result. Bit n of Parents is set if it's from parent n.
+type lostLine struct {
+	Text    string
+	Parents uint64
+}
+
+// A combinedLine is a line of the result of a merge, and the lines lost
+// from the parents just before it. Bit n of Flag is set if the line was
+// added compared to parent n, and the bits after the parents mark the
+// lines which are shown.
+//
+// Like git's combine-diff.c, there's an extra line after the end of the
+// file to hang the lines lost from the end of it on, and one after that
+// which only has the line numbers of the ends of the parents.
+type combinedLine struct {
+	Text string
+	Flag uint64
+	Lost []lostLine
+
+	// The lines lost from the parent that's being compared.
+	plost []lostLine
+
+	// The line number in each parent of the first line shown if a hunk
+	// starts with this line.
+	PLno []int
+}
+
+// writeCombinedPatch writes the combined patch of d to w.
+func writeCombinedPatch(c *Client, w io.Writer, opts DiffCommonOptions, colors diffColors, attrs *gitAttributes, d CombinedDiff) error {
+	dense := opts.DiffMerges != "combined"
+	result, err := diffContent(c, d.Name, d.Result)
+	if err != nil {
+		return err
+	}
+	parents := make([][]byte, len(d.Parents))
+	binary := false
+	modeDiffers := false
+	for i, p := range d.Parents {
+		if parents[i], err = diffContent(c, d.Name, p); err != nil {
+			return err
+		}
+		b, err := attrs.isBinaryDiff(d.Name, parents[i], result)
+		if err != nil {
+			return err
+		}
+		binary = binary || b
+		modeDiffers = modeDiffers || p.FileMode != d.Result.FileMode
+	}
+	if binary {
+		writeCombinedHeader(c, w, opts, colors, d, dense, modeDiffers, false)
+		io.WriteString(w, "Binary files differ\n")
+		return nil
+	}
+
+	lines := newCombinedLines(c, d, result, parents)
+	show := makeCombinedHunks(lines, len(parents), opts.NumContextLines, dense)
+	if !show && !modeDiffers {
+		return nil
+	}
+	writeCombinedHeader(c, w, opts, colors, d, dense, modeDiffers, true)
+	writeCombinedLines(w, colors, lines, len(parents), opts.NumContextLines)
+	return nil
+}
+
+func writeCombinedHeader(c *Client, w io.Writer, opts DiffCommonOptions, colors diffColors, d CombinedDiff, dense, modeDiffers, fileHeader bool) {
+	meta, reset := colors.Meta, colors.Reset
+	if dense {
+		fmt.Fprintf(w, "%sdiff --cc %v%s\n", meta, d.Name, reset)
+	} else {
+		fmt.Fprintf(w, "%sdiff --combined %v%s\n", meta, d.Name, reset)
+	}
+	abbrev := func(s Sha1) string {
+		if opts.FullIndex {
+			return s.String()
+		}
+		return s.Abbrev(c, 7)
+	}
+	shas := make([]string, len(d.Parents))
+	modes := make([]string, len(d.Parents))
+	for i, p := range d.Parents {
+		shas[i] = abbrev(p.Sha1)
+		modes[i] = fmt.Sprintf("%06o", p.FileMode)
+	}
+	fmt.Fprintf(w, "%sindex %s..%s%s\n", meta, strings.Join(shas, ","), abbrev(d.Result.Sha1), reset)
+
+	added, deleted := false, false
+	if modeDiffers {
+		// It was added if none of the parents had it.
+		deleted = d.Result.FileMode == 0
+		added = !deleted
+		for _, p := range d.Parents {
+			added = added && p.FileMode == 0
+		}
+		switch {
+		case added:
+			fmt.Fprintf(w, "%snew file mode %06o", meta, d.Result.FileMode)
+		case deleted:
+			fmt.Fprintf(w, "%sdeleted file mode %s", meta, strings.Join(modes, ","))
+		default:
+			// Like git, a changed mode isn't coloured.
+			fmt.Fprintf(w, "mode %s..%06o", strings.Join(modes, ","), d.Result.FileMode)
+		}
+		fmt.Fprintf(w, "%s\n", reset)
+	}
+	if !fileHeader {
+		return
+	}
+	src, dst := "a/"+d.Name.String(), "b/"+d.Name.String()
+	if added {
+		src = "/dev/null"
+	}
+	if deleted {
+		dst = "/dev/null"
+	}
+	fmt.Fprintf(w, "%s--- %s%s\n%s+++ %s%s\n", meta, src, reset, meta, dst, reset)
+}
+
+// newCombinedLines returns the lines of result, marked with the lines
+// added and lost compared to each of the parents, whose contents are in
+// parents.
+func newCombinedLines(c *Client, d CombinedDiff, result []byte, parents [][]byte) []combinedLine {
+	indentHeuristic := c.GetConfig("diff.indentHeuristic") != "false"
+	resultLines := splitLines(result)
+	cnt := len(resultLines)
+	lines := make([]combinedLine, cnt+2)
+	for i := range lines {
+		if i < cnt {
+			lines[i].Text = strings.TrimSuffix(resultLines[i], "\n")
+		}
+		lines[i].PLno = make([]int, len(parents))
+	}
+	for n := range parents {
+		reused := false
+		for j := 0; j < n; j++ {
+			if d.Parents[n].Sha1 == d.Parents[j].Sha1 {
+				// It's the same as a parent that's already
+				// been compared.
+				reuseCombinedParent(lines, n, j)
+				reused = true
+				break
+			}
+		}
+		if !reused {
+			combineParent(lines, n, parents[n], resultLines, indentHeuristic)
+		}
+	}
+	return lines
+}
+
+// combineParent marks the lines added and lost compared to parent n, whose
+// contents are parent, and coalesces the lost lines with the lines lost
+// from the previous parents.
+func combineParent(lines []combinedLine, n int, parent []byte, result []string, indentHeuristic bool) {
+	cnt := len(lines) - 2
+	mask := uint64(1) << uint(n)
+	a := splitLines(parent)
+	for _, h := range xdiffLines(a, result, nil, indentHeuristic) {
+		// The lost lines hang on the line after them, which is the
+		// first line added in their place if there are any.
+		for i := h.AStart; i < h.AEnd; i++ {
+			lines[h.BStart].plost = append(lines[h.BStart].plost, lostLine{strings.TrimSuffix(a[i], "\n"), mask})
+		}
+		for i := h.BStart; i < h.BEnd; i++ {
+			lines[i].Flag |= mask
+		}
+	}
+
+	pLno := 1
+	for lno := 0; lno <= cnt; lno++ {
+		l := &lines[lno]
+		l.PLno[n] = pLno
+		if len(l.plost) > 0 {
+			l.Lost = coalesceLostLines(l.Lost, l.plost, mask)
+			l.plost = nil
+		}
+		// The parent had each line lost from it, and each line that
+		// wasn't added.
+		for _, ll := range l.Lost {
+			if ll.Parents&mask != 0 {
+				pLno++
+			}
+		}
+		if lno < cnt && l.Flag&mask == 0 {
+			pLno++
+		}
+	}
+	lines[cnt+1].PLno[n] = pLno
+}
+
+// reuseCombinedParent marks the lines of parent n the same as parent j,
+// which has the same contents.
+func reuseCombinedParent(lines []combinedLine, n, j int) {
+	nmask, jmask := uint64(1)<<uint(n), uint64(1)<<uint(j)
+	for i := range lines {
+		l := &lines[i]
+		l.PLno[n] = l.PLno[j]
+		for k := range l.Lost {
+			if l.Lost[k].Parents&jmask != 0 {
+				l.Lost[k].Parents |= nmask
+			}
+		}
+		if l.Flag&jmask != 0 {
+			l.Flag |= nmask
+		}
+	}
+}
+
+// coalesceLostLines merges the lines lost from a parent, whose bit is mask,
+// into the lines lost from the previous parents in base. The lines in their
+// longest common subsequence are only shown once.
+func coalesceLostLines(base, lost []lostLine, mask uint64) []lostLine {
+	if len(base) == 0 {
+		return lost
+	}
+	const (
+		match = iota
+		fromBase
+		fromLost
+	)
+	lcs := make([][]int, len(base)+1)
+	directions := make([][]int, len(base)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(lost)+1)
+		directions[i] = make([]int, len(lost)+1)
+		directions[i][0] = fromBase
+	}
+	for j := 1; j <= len(lost); j++ {
+		directions[0][j] = fromLost
+	}
+	for i := 1; i <= len(base); i++ {
+		for j := 1; j <= len(lost); j++ {
+			switch {
+			case base[i-1].Text == lost[j-1].Text:
+				lcs[i][j] = lcs[i-1][j-1] + 1
+				directions[i][j] = match
+			case lcs[i][j-1] >= lcs[i-1][j]:
+				lcs[i][j] = lcs[i][j-1]
+				directions[i][j] = fromLost
+			default:
+				lcs[i][j] = lcs[i-1][j]
+				directions[i][j] = fromBase
+			}
+		}
+	}
+
+	// Walk back from the ends, and then reverse the result.
+	var merged []lostLine
+	for i, j := len(base), len(lost); i != 0 || j != 0; {
+		switch directions[i][j] {
+		case match:
+			l := base[i-1]
+			l.Parents |= mask
+			merged = append(merged, l)
+			i--
+			j--
+		case fromLost:
+			merged = append(merged, lost[j-1])
+			j--
+		default:
+			merged = append(merged, base[i-1])
+			i--
+		}
+	}
+	for i, j := 0, len(merged)-1; i < j; i, j = i+1, j-1 {
+		merged[i], merged[j] = merged[j], merged[i]
+	}
+	return merged
+}
+
+// interesting returns whether l was added compared to any of the parents,
+// or has lines lost from them before it.
+func (l combinedLine) interesting(all uint64) bool {
+	return l.Flag&all != 0 || len(l.Lost) > 0
+}
+
+// makeCombinedHunks marks the lines that are shown in the hunks of the
+// combined diff, and returns whether there are any. Hunks in a dense diff
+// which only take the changes from one of the parents aren't shown.
+func makeCombinedHunks(lines []combinedLine, numParents, context int, dense bool) bool {
+	cnt := len(lines) - 2
+	all := uint64(1)<<uint(numParents) - 1
+	mark := uint64(1) << uint(numParents)
+	for i := 0; i <= cnt; i++ {
+		if lines[i].interesting(all) {
+			lines[i].Flag |= mark
+		} else {
+			lines[i].Flag &^= mark
+		}
+	}
+	if !dense {
+		return giveCombinedContext(lines, numParents, context)
+	}
+
+	for i := 0; i <= cnt; {
+		for i <= cnt && lines[i].Flag&mark == 0 {
+			i++
+		}
+		if cnt < i {
+			break
+		}
+		hunkBegin := i
+		j := i + 1
+		for ; j <= cnt; j++ {
+			if lines[j].Flag&mark != 0 {
+				continue
+			}
+			// Look past the end for an interesting line within
+			// the context, which joins the next hunk to this one.
+			la := adjustCombinedHunkTail(lines, all, hunkBegin, j) + context
+			if la > cnt+1 {
+				la = cnt + 1
+			}
+			contin := false
+			for la > 0 {
+				la--
+				if la < j {
+					break
+				}
+				if lines[la].Flag&mark != 0 {
+					contin = true
+					break
+				}
+			}
+			if !contin {
+				break
+			}
+			j = la
+		}
+		hunkEnd := j
+
+		// The hunk is only interesting if there are more than two
+		// versions of it, which means that the lines were added
+		// and lost from different sets of parents, or if the result
+		// is different from all of the parents.
+		var sameDiff uint64
+		interesting := false
+		for j := i; j < hunkEnd && !interesting; j++ {
+			if diff := lines[j].Flag & all; diff != 0 {
+				if sameDiff == 0 {
+					sameDiff = diff
+				} else if sameDiff != diff {
+					interesting = true
+					break
+				}
+			}
+			for _, ll := range lines[j].Lost {
+				if sameDiff == 0 {
+					sameDiff = ll.Parents
+				} else if sameDiff != ll.Parents {
+					interesting = true
+					break
+				}
+			}
+		}
+		if !interesting && sameDiff != all {
+			for j := hunkBegin; j < hunkEnd; j++ {
+				lines[j].Flag &^= mark
+			}
+		}
+		i = hunkEnd
+	}
+	return giveCombinedContext(lines, numParents, context)
+}
+
+// adjustCombinedHunkTail returns the end of the hunk from hunkBegin to i
+// for the purpose of adding context after it. If the last line was only
+// interesting because of the lines lost before it, it's shown anyway, so
+// it's already a line of context.
+func adjustCombinedHunkTail(lines []combinedLine, all uint64, hunkBegin, i int) int {
+	if hunkBegin+1 <= i && lines[i-1].Flag&all == 0 {
+		i--
+	}
+	return i
+}
+
+// findNextCombined returns the first line from i which is marked, or
+// which isn't marked if uninteresting is set.
+func findNextCombined(lines []combinedLine, mark uint64, i int, uninteresting bool) int {
+	cnt := len(lines) - 2
+	for ; i <= cnt; i++ {
+		if (lines[i].Flag&mark == 0) == uninteresting {
+			return i
+		}
+	}
+	return i
+}
+
+// giveCombinedContext marks the context lines around the marked lines, and
+// joins hunks which are close together. It returns whether there are any
+// hunks.
+func giveCombinedContext(lines []combinedLine, numParents, context int) bool {
+	cnt := len(lines) - 2
+	all := uint64(1)<<uint(numParents) - 1
+	mark := uint64(1) << uint(numParents)
+	noPreDelete := mark << 1
+
+	i := findNextCombined(lines, mark, 0, false)
+	if cnt < i {
+		return false
+	}
+	for i <= cnt {
+		// Mark a few lines before the first interesting line. The
+		// lines lost before them aren't shown.
+		j := 0
+		if context < i {
+			j = i - context
+		}
+		for ; j < i; j++ {
+			if lines[j].Flag&mark == 0 {
+				lines[j].Flag |= noPreDelete
+			}
+			lines[j].Flag |= mark
+		}
+
+		for {
+			j = findNextCombined(lines, mark, i, true)
+			if cnt < j {
+				// The rest are all interesting.
+				return true
+			}
+			k := findNextCombined(lines, mark, j, false)
+			j = adjustCombinedHunkTail(lines, all, i, j)
+			if k < j+context {
+				// The gap before the next interesting line is
+				// small, so it's joined to this hunk.
+				for ; j < k; j++ {
+					lines[j].Flag |= mark
+				}
+				i = k
+				continue
+			}
+
+			// Mark the trailing context.
+			i = k
+			end := j + context
+			if end > cnt+1 {
+				end = cnt + 1
+			}
+			for ; j < end; j++ {
+				lines[j].Flag |= mark
+			}
+			break
+		}
+	}
+	return true
+}
+
+// isCombinedHunkComment returns whether line is used as the function name
+// in the header of a later hunk of a combined diff.
+func isCombinedHunkComment(line string) bool {
+	if line == "" {
+		return false
+	}
+	ch := line[0]
+	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || ch == '_' || ch == '$'
+}
+
+// writeCombinedLines writes the hunks of lines which were marked by
+// makeCombinedHunks.
+func writeCombinedLines(w io.Writer, colors diffColors, lines []combinedLine, numParents, context int) {
+	cnt := len(lines) - 2
+	all := uint64(1)<<uint(numParents) - 1
+	mark := uint64(1) << uint(numParents)
+	noPreDelete := mark << 1
+	markers := strings.Repeat("@", numParents+1)
+
+	for lno := 0; ; {
+		comment := ""
+		for lno <= cnt && lines[lno].Flag&mark == 0 {
+			if isCombinedHunkComment(lines[lno].Text) {
+				comment = lines[lno].Text
+			}
+			lno++
+		}
+		if cnt < lno {
+			return
+		}
+		hunkEnd := lno + 1
+		for hunkEnd <= cnt && lines[hunkEnd].Flag&mark != 0 {
+			hunkEnd++
+		}
+		rlines := hunkEnd - lno
+		if cnt < hunkEnd {
+			// The last line only has lines lost from the end.
+			rlines--
+		}
+		nullContext := 0
+		if context == 0 {
+			// The lines which only have lost lines before them
+			// aren't shown without context.
+			for j := lno; j < hunkEnd; j++ {
+				if lines[j].Flag&all == 0 {
+					nullContext++
+				}
+			}
+			rlines -= nullContext
+		}
+
+		fmt.Fprintf(w, "%s%s", colors.Frag, markers)
+		for n := 0; n < numParents; n++ {
+			l0, l1 := lines[lno].PLno[n], lines[hunkEnd].PLno[n]
+			fmt.Fprintf(w, " -%d,%d", l0, l1-l0-nullContext)
+		}
+		fmt.Fprintf(w, " +%d,%d %s", lno+1, rlines, markers)
+		// Like git, the comment is cut off before its last
+		// non-space character, and is at most 40 characters.
+		commentEnd := 0
+		for i := 0; i < 40 && i < len(comment); i++ {
+			if !strings.ContainsRune(" \t\v\f\r", rune(comment[i])) {
+				commentEnd = i
+			}
+		}
+		if commentEnd > 0 {
+			fmt.Fprintf(w, "%s%s %s%s%s", colors.Reset, colors.Context, colors.Reset, colors.Func, comment[:commentEnd])
+		}
+		fmt.Fprintf(w, "%s\n", colors.Reset)
+
+		for lno < hunkEnd {
+			l := lines[lno]
+			lno++
+			if l.Flag&noPreDelete == 0 {
+				for _, ll := range l.Lost {
+					io.WriteString(w, colors.Old)
+					for n := 0; n < numParents; n++ {
+						if ll.Parents&(1<<uint(n)) != 0 {
+							io.WriteString(w, "-")
+						} else {
+							io.WriteString(w, " ")
+						}
+					}
+					writeCombinedLine(w, ll.Text, colors.Reset)
+				}
+			}
+			if cnt < lno {
+				break
+			}
+			if l.Flag&all == 0 {
+				// The line is only here for the lines lost
+				// before it.
+				if context == 0 {
+					continue
+				}
+				io.WriteString(w, colors.Context)
+			} else {
+				io.WriteString(w, colors.New)
+			}
+			for n := 0; n < numParents; n++ {
+				if l.Flag&(1<<uint(n)) != 0 {
+					io.WriteString(w, "+")
+				} else {
+					io.WriteString(w, " ")
+				}
+			}
+			writeCombinedLine(w, l.Text, colors.Reset)
+		}
+	}
+}
+
+// writeCombinedLine writes line, with a carriage return at the end of it
+// kept after the colour is reset.
+func writeCombinedLine(w io.Writer, line, reset string) {
+	cr := ""
+	if strings.HasSuffix(line, "\r") {
+		line, cr = line[:len(line)-1], "\r"
+	}
+	fmt.Fprintf(w, "%s%s%s\n", line, reset, cr)
+}
@@ -0,0 +1,200 @@
+package git
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testMergeCommit creates a merge of master and topic in a repository set
+// up by testMergeSetup, with the conflicts resolved by the files in
+// resolved.
+func testMergeCommit(t *testing.T, c *Client, resolved map[string]string) CommitID {
+	t.Helper()
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic, err := RevParseCommit(c, &RevParseOptions{}, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Merge(c, MergeOptions{}, []Commitish{topic}); err == nil {
+		t.Fatal("Expected merge to have conflicts")
+	}
+	var names []File
+	for name, content := range resolved {
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, File(name))
+	}
+	if _, err := Add(c, AddOptions{}, names); err != nil {
+		t.Fatal(err)
+	}
+	tree, err := WriteTree(c, WriteTreeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	merge, err := CommitTree(c, CommitTreeOptions{}, tree, []CommitID{head, topic}, "merge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return merge
+}
+
+func TestCombinedDiff(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo.txt": "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n", "bar.txt": "bar\n"},
+		map[string]string{"foo.txt": "a\nB ours\nc\nd\ne\nf\ng\nh\nI\nj\n"},
+		map[string]string{"foo.txt": "a\nb theirs\nc\nd\ne\nf\ng\nh\ni\nj\n", "bar.txt": "baz\n"},
+	)
+	defer os.RemoveAll(dir)
+	merge := testMergeCommit(t, c, map[string]string{"foo.txt": "a\nb resolved\nc\nd\ne\nf\ng\nh\nI\nj\n"})
+
+	// bar.txt is the same as it is in topic, so it's not in the
+	// combined diff.
+	diffs, err := DiffCombined(c, merge, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].Name != "foo.txt" {
+		t.Fatalf("Unexpected combined diff: %v", diffs)
+	}
+
+	tests := []struct {
+		opts DiffCommonOptions
+		want string
+	}{
+		{
+			DiffCommonOptions{Raw: true},
+			"::100644 100644 100644 a76d89e692f7fa77594a0f5aa640f58ee61028d0 9ad74e4266863be22f9407eee5fe5789739b2807 54f6e458d551f25acc770b56e4fd0624dfa3f3c4 MM\tfoo.txt\n",
+		},
+		{
+			DiffCommonOptions{Raw: true, Abbrev: 7},
+			"::100644 100644 100644 a76d89e 9ad74e4 54f6e45 MM\tfoo.txt\n",
+		},
+		{
+			DiffCommonOptions{NameStatus: true},
+			"MM\tfoo.txt\n",
+		},
+		{
+			// The change to line 9 only comes from master, so it's
+			// left out of a dense combined diff.
+			DiffCommonOptions{Patch: true, NumContextLines: 3, DiffMerges: "dense-combined"},
+			`diff --cc foo.txt
+index a76d89e,9ad74e4..54f6e45
+--- a/foo.txt
++++ b/foo.txt
+@@@ -1,5 -1,5 +1,5 @@@
+  a
+- B ours
+ -b theirs
+++b resolved
+  c
+  d
+  e
+`,
+		},
+		{
+			DiffCommonOptions{Patch: true, NumContextLines: 3, DiffMerges: "combined"},
+			`diff --combined foo.txt
+index a76d89e,9ad74e4..54f6e45
+--- a/foo.txt
++++ b/foo.txt
+@@@ -1,10 -1,10 +1,10 @@@
+  a
+- B ours
+ -b theirs
+++b resolved
+  c
+  d
+  e
+  f
+  g
+  h
+ -i
+ +I
+  j
+`,
+		},
+		{
+			DiffCommonOptions{Patch: true, NumContextLines: 0, DiffMerges: "combined"},
+			`diff --combined foo.txt
+index a76d89e,9ad74e4..54f6e45
+--- a/foo.txt
++++ b/foo.txt
+@@@ -2,1 -2,1 +2,1 @@@
+- B ours
+ -b theirs
+++b resolved
+@@@ -9,1 -9,1 +9,1 @@@
+ -i
+ +I
+`,
+		},
+	}
+	for _, tc := range tests {
+		var buf bytes.Buffer
+		if err := GenerateCombinedDiff(c, tc.opts, diffs, nil, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("Unexpected combined diff with %+v: got %q want %q", tc.opts, got, tc.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	shown, err := WriteMergeDiff(c, DiffCommonOptions{Patch: true, NumContextLines: 3, DiffMerges: "remerge"}, merge, nil, &buf, func(from *CommitID) error {
+		if from != nil {
+			t.Errorf("Unexpected parent %v for remerge diff", from)
+		}
+		buf.WriteString("header\n")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The conflict markers are labelled with the parents, so the sha of
+	// the re-merged file depends on them.
+	for _, want := range []string{
+		"header\ndiff --git a/foo.txt b/foo.txt\nremerge CONFLICT (content): Merge conflict in foo.txt\nindex ",
+		"..54f6e45 100644\n",
+		"\n-<<<<<<< ",
+		"\n+b resolved\n",
+	} {
+		if !shown || !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected remerge diff to contain %q, got %q", want, buf.String())
+		}
+	}
+
+	// Each of the separate diffs has its own header.
+	var froms []CommitID
+	if _, err := WriteMergeDiff(c, DiffCommonOptions{Raw: true, DiffMerges: "separate"}, merge, nil, ioutil.Discard, func(from *CommitID) error {
+		froms = append(froms, *from)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if parents, err := merge.Parents(c); err != nil || len(froms) != 2 || froms[0] != parents[0] || froms[1] != parents[1] {
+		t.Errorf("Unexpected parents of separate diffs: %v (%v)", froms, err)
+	}
+}
+
+func TestCoalesceLostLines(t *testing.T) {
+	base := []lostLine{{"a", 1}, {"b", 1}, {"c", 1}}
+	lost := []lostLine{{"b", 2}, {"x", 2}, {"c", 2}}
+	got := coalesceLostLines(base, lost, 2)
+	want := []lostLine{{"a", 1}, {"b", 3}, {"x", 2}, {"c", 3}}
+	if len(got) != len(want) {
+		t.Fatalf("got %v want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %v want %v", got, want)
+			break
+		}
+	}
+}
@@ -108,6 +108,17 @@ func Commit(c *Client, opts CommitOptions, message CommitMessage, files []File)
 		}
 		idx = idx1
 	}
+	if len(idx.GetUnmerged()) > 0 {
+		return CommitID{}, fmt.Errorf("Committing is not possible because you have unmerged files.")
+	}
+	merging, err := c.mergeHeads()
+	if err != nil {
+		return CommitID{}, err
+	}
+	if len(merging) > 0 && opts.Amend {
+		return CommitID{}, fmt.Errorf("You are in the middle of a merge -- cannot amend.")
+	}
+
 	// Happy path: write the tree
 	treeid, err := WriteTreeFromIndex(c, idx, WriteTreeOptions{})
 	if err != nil {
@@ -121,38 +132,30 @@ func Commit(c *Client, opts CommitOptions, message CommitMessage, files []File)
 		if err != nil {
 			return CommitID{}, err
 		}
-		author, err := oldHead.GetAuthor(c)
-		if err != nil {
-			return CommitID{}, err
-		}
 		if !opts.ResetAuthor {
-			// Back up the environment variables that commit uses to
-			// communicate with commit-tree, so that nothing external
-			// changes to the caller of this script.
-			defer func(oldauthorname, oldauthoremail, oldauthordate string) {
-				os.Setenv("GIT_AUTHOR_NAME", oldauthorname)
-				os.Setenv("GIT_AUTHOR_EMAIL", oldauthoremail)
-				os.Setenv("GIT_AUTHOR_DATE", oldauthordate)
-
-			}(
-				os.Getenv("GIT_AUTHOR_NAME"),
-				os.Getenv("GIT_AUTHOR_EMAIL"),
-				os.Getenv("GIT_AUTHOR_DATE"),
-			)
-			os.Setenv("GIT_AUTHOR_NAME", author.Name)
-			os.Setenv("GIT_AUTHOR_EMAIL", author.Email)
-			date, err := oldHead.GetDate(c)
+			restore, err := useAuthorOf(c, oldHead)
 			if err != nil {
 				return CommitID{}, err
 			}
-			os.Setenv("GIT_AUTHOR_DATE", date.Format("Mon, 02 Jan 2006 15:04:05 -0700"))
+			defer restore()
 		}
 		goto skipemptycheck
 	} else if err == nil || err == DetachedHead {
 		parents = append(parents, oldHead)
 	}
+	if picked, err := c.GitDir.File("CHERRY_PICK_HEAD").ReadFirstLine(); err == nil && !opts.ResetAuthor {
+		// Concluding a cherry-pick keeps the original author.
+		if s, err := Sha1FromString(picked); err == nil {
+			restore, err := useAuthorOf(c, CommitID(s))
+			if err != nil {
+				return CommitID{}, err
+			}
+			defer restore()
+		}
+	}
+	parents = append(parents, merging...)
 
-	if !opts.AllowEmpty {
+	if !opts.AllowEmpty && len(merging) == 0 {
 		if oldtree, err := oldHead.TreeID(c); err == nil {
 			if oldtree == treeid {
 				return CommitID{}, fmt.Errorf("No changes staged for commit.")
@@ -164,6 +167,9 @@ skipemptycheck:
 	if err != nil {
 		return CommitID{}, err
 	}
+	if !opts.AllowEmptyMessage && strings.TrimSpace(cleanMessage) == "" {
+		return CommitID{}, fmt.Errorf("Aborting commit due to empty commit message.")
+	}
 	var noConfig error
 	cid, err := CommitTree(c, CommitTreeOptions{}, TreeID(treeid), parents, cleanMessage)
 	switch err {
@@ -182,14 +188,51 @@ skipemptycheck:
 	} else {
 		refmsg = cleanMessage[:50]
 	}
-	refmsg = fmt.Sprintf("commit: %s (dgit)", refmsg)
+	if len(merging) > 0 {
+		refmsg = fmt.Sprintf("commit (merge): %s (dgit)", refmsg)
+	} else {
+		refmsg = fmt.Sprintf("commit: %s (dgit)", refmsg)
+	}
 
 	if err := UpdateRef(c, UpdateRefOptions{OldValue: oldHead, CreateReflog: true}, "HEAD", cid, refmsg); err != nil {
 		return CommitID{}, err
 	}
+	if err := c.removeMergeState(); err != nil {
+		return CommitID{}, err
+	}
 	return cid, noConfig
 }
 
+// useAuthorOf sets the environment variables that commit uses to
+// communicate with commit-tree so that new commits have the same author
+// and author date as cmt. The returned function restores the old values,
+// so that nothing external changes to the caller.
+func useAuthorOf(c *Client, cmt CommitID) (func(), error) {
+	author, err := cmt.GetAuthor(c)
+	if err != nil {
+		return nil, err
+	}
+	date, err := cmt.GetDate(c)
+	if err != nil {
+		return nil, err
+	}
+	restore := func(oldauthorname, oldauthoremail, oldauthordate string) func() {
+		return func() {
+			os.Setenv("GIT_AUTHOR_NAME", oldauthorname)
+			os.Setenv("GIT_AUTHOR_EMAIL", oldauthoremail)
+			os.Setenv("GIT_AUTHOR_DATE", oldauthordate)
+		}
+	}(
+		os.Getenv("GIT_AUTHOR_NAME"),
+		os.Getenv("GIT_AUTHOR_EMAIL"),
+		os.Getenv("GIT_AUTHOR_DATE"),
+	)
+	os.Setenv("GIT_AUTHOR_NAME", author.Name)
+	os.Setenv("GIT_AUTHOR_EMAIL", author.Email)
+	os.Setenv("GIT_AUTHOR_DATE", date.Format("Mon, 02 Jan 2006 15:04:05 -0700"))
+	return restore, nil
+}
+
 type CommitMessage string
 
 func (cm CommitMessage) String() string {
@@ -223,7 +266,7 @@ func (cm CommitMessage) whitespace() string {
 }
 
 func (cm CommitMessage) strip() string {
-	lines := strings.Split(cm.whitespace(), "\n")
+	lines := strings.Split(string(cm), "\n")
 	filtered := make([]string, 0, len(lines))
 	for _, line := range lines {
 		if len(line) >= 1 && line[0] == '#' {
@@ -231,11 +274,13 @@ func (cm CommitMessage) strip() string {
 		}
 		filtered = append(filtered, line)
 	}
-	return strings.Join(filtered, "\n")
+	// Removing comments may have left extra blank lines behind, so
+	// clean up the whitespace after filtering.
+	return CommitMessage(strings.Join(filtered, "\n")).whitespace()
 }
 
 func (cm CommitMessage) Subject() string {
-	lines := strings.SplitN(cm.whitespace(), "\n", 1)
+	lines := strings.SplitN(cm.whitespace(), "\n", 2)
 	if len(lines) > 0 {
 		return strings.TrimSpace(lines[0])
 	}
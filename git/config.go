@@ -167,6 +167,58 @@ func (g *GitConfig) GetConfigSections(name, subsection string) []GitConfigSectio
 	return matches
 }
 
+// RenameSection renames the subsection oldsub of the section name to
+// newsub, replacing any existing section named newsub. It returns false
+// if there was no section to rename.
+func (g *GitConfig) RenameSection(name, oldsub, newsub string) bool {
+	if !g.CopySection(name, oldsub, newsub) {
+		return false
+	}
+	g.RemoveSection(name, oldsub)
+	return true
+}
+
+// CopySection copies the values of the subsection oldsub of the section
+// name to newsub, replacing any existing section named newsub. It returns
+// false if there was no section to copy.
+func (g *GitConfig) CopySection(name, oldsub, newsub string) bool {
+	var values GitConfigValues
+	for _, section := range g.sections {
+		if section.name == name && section.subsection == oldsub {
+			values = section.values
+		}
+	}
+	if values == nil {
+		return false
+	}
+	if oldsub == newsub {
+		return true
+	}
+	g.RemoveSection(name, newsub)
+	section := GitConfigSection{name, newsub, make(GitConfigValues, len(values))}
+	for k, v := range values {
+		section.values[k] = v
+	}
+	g.sections = append(g.sections, section)
+	return true
+}
+
+// RemoveSection removes the subsection subsection of the section name
+// from the config. It returns false if there was no such section.
+func (g *GitConfig) RemoveSection(name, subsection string) bool {
+	found := false
+	sections := g.sections[:0]
+	for _, section := range g.sections {
+		if section.name == name && section.subsection == subsection {
+			found = true
+			continue
+		}
+		sections = append(sections, section)
+	}
+	g.sections = sections
+	return found
+}
+
 func (g GitConfig) WriteFile(w io.Writer) {
 	for _, section := range g.sections {
 		if section.subsection == "" {
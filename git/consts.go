@@ -9,4 +9,7 @@ const (
 	posixDiff3 = "diff3"
 
 	posixPatch = "patch"
+
+	// the shell used to run commands such as "rebase --exec".
+	posixShell = "sh"
 )
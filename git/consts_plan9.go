@@ -6,4 +6,7 @@ const (
 	posixDiff3 = "/bin/ape/diff3"
 
 	posixPatch = "/bin/ape/patch"
+
+	// the shell used to run commands such as "rebase --exec".
+	posixShell = "/bin/ape/sh"
 )
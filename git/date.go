@@ -0,0 +1,244 @@
+package git
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// now returns the current time, which relative dates are shown against.
+var now = time.Now
+
+// FormatDate formats t in the date format mode, which is one of git's
+// --date formats: "default", "relative", "human", "iso" (or "iso8601"),
+// "iso-strict" (or "iso8601-strict"), "rfc" (or "rfc2822"), "short",
+// "raw", "unix" or "format:<strftime format>". Each of them can have a
+// "-local" suffix to show the date in the local time zone, and "local" is
+// "default-local". An empty mode is "default".
+func FormatDate(t time.Time, mode string) (string, error) {
+	local := false
+	if mode == "local" {
+		mode, local = "default", true
+	} else if strings.HasSuffix(mode, "-local") {
+		mode, local = strings.TrimSuffix(mode, "-local"), true
+	}
+	if local {
+		t = t.In(time.Local)
+	}
+	if strings.HasPrefix(mode, "format:") {
+		return strftime(t, mode[7:], !local), nil
+	}
+	switch mode {
+	case "", "default":
+		if local {
+			return t.Format("Mon Jan 2 15:04:05 2006"), nil
+		}
+		return t.Format("Mon Jan 2 15:04:05 2006 -0700"), nil
+	case "relative":
+		return relativeDate(t, now()), nil
+	case "human":
+		return humanDate(t, now(), local), nil
+	case "iso", "iso8601":
+		return t.Format("2006-01-02 15:04:05 -0700"), nil
+	case "iso-strict", "iso8601-strict":
+		return t.Format("2006-01-02T15:04:05-07:00"), nil
+	case "rfc", "rfc2822":
+		return t.Format("Mon, 2 Jan 2006 15:04:05 -0700"), nil
+	case "short":
+		return t.Format("2006-01-02"), nil
+	case "raw":
+		return strconv.FormatInt(t.Unix(), 10) + t.Format(" -0700"), nil
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10), nil
+	}
+	return "", fmt.Errorf("unknown date format %v", mode)
+}
+
+// timeUnits returns n followed by unit, pluralised if n isn't 1.
+func timeUnits(n int64, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %v", n, unit)
+	}
+	return fmt.Sprintf("%d %vs", n, unit)
+}
+
+// relativeDate returns how long before now t was, such as "3 days ago",
+// rounded the same way as git.
+func relativeDate(t, now time.Time) string {
+	if now.Before(t) {
+		return "in the future"
+	}
+	diff := now.Unix() - t.Unix()
+	if diff < 90 {
+		return timeUnits(diff, "second") + " ago"
+	}
+	// Minutes
+	diff = (diff + 30) / 60
+	if diff < 90 {
+		return timeUnits(diff, "minute") + " ago"
+	}
+	// Hours
+	diff = (diff + 30) / 60
+	if diff < 36 {
+		return timeUnits(diff, "hour") + " ago"
+	}
+	// Days from here on
+	diff = (diff + 12) / 24
+	switch {
+	case diff < 14:
+		return timeUnits(diff, "day") + " ago"
+	case diff < 70:
+		return timeUnits((diff+3)/7, "week") + " ago"
+	case diff < 365:
+		return timeUnits((diff+15)/30, "month") + " ago"
+	case diff < 1825:
+		// Years and months for the last 5 years or so.
+		totalMonths := (diff*12*2 + 365) / (365 * 2)
+		years, months := totalMonths/12, totalMonths%12
+		if months != 0 {
+			return timeUnits(years, "year") + ", " + timeUnits(months, "month") + " ago"
+		}
+		return timeUnits(years, "year") + " ago"
+	}
+	return timeUnits((diff+183)/365, "year") + " ago"
+}
+
+// humanDate returns t in git's "human" format, which leaves out the parts
+// of the date that are the same as now, and is relative for today.
+func humanDate(t, now time.Time, local bool) string {
+	now = now.In(time.Local)
+	_, tz := t.Zone()
+	_, nowTz := now.Zone()
+	hideTz := local || tz == nowTz
+	hideYear := t.Year() == now.Year()
+	hideDate, hideWday := false, false
+	if hideYear && t.Month() == now.Month() {
+		switch {
+		case t.Day() > now.Day():
+			// Dates in the future are shown in full.
+		case t.Day() == now.Day():
+			hideDate, hideWday = true, true
+		case t.Day()+5 > now.Day():
+			// Only the day of the week a few days ago.
+			hideDate = true
+		}
+	}
+	if hideWday {
+		return relativeDate(t, now)
+	}
+	// The seconds are always left out, the time zone is left out if
+	// the date is shown, and the day of the week and time are left out
+	// if the year is shown.
+	hideTz = hideTz || !hideDate
+	hideWday = !hideYear
+	hideTime := !hideYear
+
+	var parts []string
+	if !hideWday {
+		parts = append(parts, t.Format("Mon"))
+	}
+	if !hideDate {
+		parts = append(parts, t.Format("Jan 2"))
+	}
+	if !hideTime {
+		parts = append(parts, t.Format("15:04"))
+	}
+	if !hideYear {
+		parts = append(parts, t.Format("2006"))
+	}
+	if !hideTz {
+		parts = append(parts, t.Format("-0700"))
+	}
+	return strings.Join(parts, " ")
+}
+
+// strftime formats t with the C library's strftime conversions in the C
+// locale. Like git, %s is the Unix time, and %Z is empty if hideZone is
+// set since the name of a commit's time zone isn't known.
+func strftime(t time.Time, format string, hideZone bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i == len(format)-1 {
+			sb.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch format[i] {
+		case 'a':
+			sb.WriteString(t.Format("Mon"))
+		case 'A':
+			sb.WriteString(t.Format("Monday"))
+		case 'b', 'h':
+			sb.WriteString(t.Format("Jan"))
+		case 'B':
+			sb.WriteString(t.Format("January"))
+		case 'c':
+			sb.WriteString(t.Format("Mon Jan _2 15:04:05 2006"))
+		case 'C':
+			fmt.Fprintf(&sb, "%02d", t.Year()/100)
+		case 'd':
+			sb.WriteString(t.Format("02"))
+		case 'D', 'x':
+			sb.WriteString(t.Format("01/02/06"))
+		case 'e':
+			sb.WriteString(t.Format("_2"))
+		case 'F':
+			sb.WriteString(t.Format("2006-01-02"))
+		case 'H':
+			sb.WriteString(t.Format("15"))
+		case 'I':
+			sb.WriteString(t.Format("03"))
+		case 'j':
+			fmt.Fprintf(&sb, "%03d", t.YearDay())
+		case 'k':
+			fmt.Fprintf(&sb, "%2d", t.Hour())
+		case 'l':
+			sb.WriteString(t.Format("_3"))
+		case 'm':
+			sb.WriteString(t.Format("01"))
+		case 'M':
+			sb.WriteString(t.Format("04"))
+		case 'n':
+			sb.WriteByte('\n')
+		case 'p':
+			sb.WriteString(t.Format("PM"))
+		case 'r':
+			sb.WriteString(t.Format("03:04:05 PM"))
+		case 'R':
+			sb.WriteString(t.Format("15:04"))
+		case 's':
+			fmt.Fprintf(&sb, "%d", t.Unix())
+		case 'S':
+			sb.WriteString(t.Format("05"))
+		case 't':
+			sb.WriteByte('\t')
+		case 'T', 'X':
+			sb.WriteString(t.Format("15:04:05"))
+		case 'u':
+			wd := int(t.Weekday())
+			if wd == 0 {
+				wd = 7
+			}
+			fmt.Fprintf(&sb, "%d", wd)
+		case 'w':
+			fmt.Fprintf(&sb, "%d", int(t.Weekday()))
+		case 'y':
+			sb.WriteString(t.Format("06"))
+		case 'Y':
+			fmt.Fprintf(&sb, "%d", t.Year())
+		case 'z':
+			sb.WriteString(t.Format("-0700"))
+		case 'Z':
+			if !hideZone {
+				sb.WriteString(t.Format("MST"))
+			}
+		case '%':
+			sb.WriteByte('%')
+		default:
+			sb.WriteByte('%')
+			sb.WriteByte(format[i])
+		}
+	}
+	return sb.String()
+}
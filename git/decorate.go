@@ -0,0 +1,255 @@
+package git
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// The kinds of refs which decorate a commit, which decide how they're
+// shown and coloured.
+type decorationType int
+
+const (
+	decorationNone decorationType = iota
+	decorationBranch
+	decorationRemoteBranch
+	decorationTag
+	decorationStash
+	decorationHEAD
+)
+
+// The refs which decorate commits by default. The others, such as notes,
+// are only shown if they're selected by the DecorateOptions.
+var defaultDecorationRefs = []string{"HEAD", "refs/heads/", "refs/tags/", "refs/remotes/", "refs/stash", "refs/replace/"}
+
+// DecorateOptions select which refs decorate the commits shown by log, and
+// how they're shown.
+type DecorateOptions struct {
+	// Show the full names of the refs, rather than leaving out
+	// refs/heads/, refs/tags/ and refs/remotes/.
+	Full bool
+
+	// Only use the refs which match one of Refs, and none of
+	// ExcludeRefs. The patterns are globs, or prefixes of the ref
+	// names if they don't contain any glob characters, and refs/ is
+	// implied if they don't start with it. If neither are given, only
+	// HEAD, the branches, tags, remote branches and the stash are used
+	// unless ClearDecorations is set.
+	Refs, ExcludeRefs []string
+	ClearDecorations  bool
+}
+
+// A decoration is a ref which points to a commit.
+type decoration struct {
+	name string
+	typ  decorationType
+}
+
+// Decorations are the refs pointing to each commit, for decorating the
+// commits shown by log.
+type Decorations struct {
+	opts  DecorateOptions
+	names map[CommitID][]decoration
+
+	// The branch that HEAD points to, which is shown as "HEAD -> branch"
+	// when they point to the same commit.
+	head string
+
+	colors     map[decorationType]string
+	commit     string
+	colorReset string
+}
+
+// LoadDecorations finds the refs selected by opts which point to commits,
+// directly or through tags.
+func LoadDecorations(c *Client, opts DecorateOptions) (*Decorations, error) {
+	d := &Decorations{opts: opts, names: make(map[CommitID][]decoration)}
+	if err := d.loadColors(c); err != nil {
+		return nil, err
+	}
+	include, exclude := normalizeDecorationRefs(opts.Refs), normalizeDecorationRefs(opts.ExcludeRefs)
+	if len(include) == 0 && len(exclude) == 0 && !opts.ClearDecorations {
+		include = defaultDecorationRefs
+	}
+	matches := func(name string) bool {
+		for _, p := range exclude {
+			if matchDecorationRef(p, name) {
+				return false
+			}
+		}
+		if len(include) == 0 {
+			return true
+		}
+		for _, p := range include {
+			if matchDecorationRef(p, name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	refs, err := ShowRef(c, ShowRefOptions{Dereference: true}, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Like git, each decoration goes in front of the previous ones for
+	// the same commit, and HEAD is added last so it comes first.
+	add := func(name string, value Sha1) {
+		if !matches(name) {
+			return
+		}
+		typ := decorationNone
+		switch {
+		case name == "HEAD":
+			typ = decorationHEAD
+		case strings.HasPrefix(name, "refs/heads/"):
+			typ = decorationBranch
+		case strings.HasPrefix(name, "refs/remotes/"):
+			typ = decorationRemoteBranch
+		case strings.HasPrefix(name, "refs/tags/"):
+			typ = decorationTag
+		case name == "refs/stash":
+			typ = decorationStash
+		}
+		cmt := CommitID(value)
+		d.names[cmt] = append([]decoration{{name, typ}}, d.names[cmt]...)
+	}
+	for _, ref := range refs {
+		if strings.HasSuffix(ref.Name, "^{}") {
+			// A tag decorates the commit it points to.
+			add(strings.TrimSuffix(ref.Name, "^{}"), ref.Value)
+			continue
+		}
+		if ref.Value.Type(c) == "commit" {
+			add(ref.Name, ref.Value)
+		}
+	}
+	if head, err := c.GetHeadCommit(); err == nil {
+		add("HEAD", Sha1(head))
+	}
+	if branch, err := SymbolicRefGet(c, SymbolicRefOptions{}, "HEAD"); err == nil {
+		d.head = branch.String()
+	}
+	return d, nil
+}
+
+// normalizeDecorationRefs adds the implied refs/ to patterns, and removes
+// any trailing /.
+func normalizeDecorationRefs(patterns []string) []string {
+	normalized := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		if !strings.HasPrefix(p, "refs/") && p != "HEAD" {
+			p = "refs/" + p
+		}
+		normalized = append(normalized, strings.TrimSuffix(p, "/"))
+	}
+	return normalized
+}
+
+// matchDecorationRef returns whether the ref name matches pattern, which
+// is a glob, or a prefix of the name's path if it doesn't have any glob
+// characters.
+func matchDecorationRef(pattern, name string) bool {
+	if strings.ContainsAny(pattern, "*?[\\") {
+		m, _ := filepath.Match(pattern, name)
+		return m
+	}
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(name, pattern)
+	}
+	return name == pattern || strings.HasPrefix(name, pattern+"/")
+}
+
+// loadColors loads the colours of the decorations, which are git's
+// defaults overridden by the color.decorate.<slot> config.
+func (d *Decorations) loadColors(c *Client) error {
+	d.colors = make(map[decorationType]string)
+	colors, err := loadDiffColors(c, true)
+	if err != nil {
+		return err
+	}
+	d.commit, d.colorReset = colors.Commit, colorReset
+	for _, slot := range []struct {
+		name string
+		typ  decorationType
+		def  string
+	}{
+		{"branch", decorationBranch, "\x1b[1;32m"},
+		{"remoteBranch", decorationRemoteBranch, "\x1b[1;31m"},
+		{"tag", decorationTag, "\x1b[1;33m"},
+		{"stash", decorationStash, "\x1b[1;35m"},
+		{"HEAD", decorationHEAD, "\x1b[1;36m"},
+	} {
+		d.colors[slot.typ] = slot.def
+		if spec := c.GetConfig("color.decorate." + slot.name); spec != "" {
+			color, err := parseColor(spec)
+			if err != nil {
+				return err
+			}
+			d.colors[slot.typ] = color
+		}
+	}
+	d.colors[decorationNone] = colorReset
+	return nil
+}
+
+// name returns the name of dec as it's shown.
+func (d *Decorations) name(dec decoration) string {
+	if d.opts.Full {
+		return dec.name
+	}
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/"} {
+		if strings.HasPrefix(dec.name, prefix) {
+			return dec.name[len(prefix):]
+		}
+	}
+	return dec.name
+}
+
+// Format returns the decorations of cmt as they're shown after the commit
+// by log, such as " (HEAD -> master, tag: v1.0)", or an empty string if
+// there aren't any. prefix, separator and suffix go around and between
+// the names of the refs. If color is set, they're coloured with the
+// colours from color.decorate.<slot>.
+func (d *Decorations) Format(cmt CommitID, prefix, separator, suffix string, color bool) string {
+	decs := d.names[cmt]
+	if len(decs) == 0 {
+		return ""
+	}
+	// When HEAD points to the branch, the branch is shown after it as
+	// "HEAD -> branch" instead of on its own.
+	var current *decoration
+	for _, dec := range decs {
+		if dec.typ == decorationHEAD {
+			for i := range decs {
+				if decs[i].typ == decorationBranch && decs[i].name == d.head {
+					current = &decs[i]
+				}
+			}
+			break
+		}
+	}
+
+	colors, commit, reset := d.colors, d.commit, d.colorReset
+	if !color {
+		colors, commit, reset = nil, "", ""
+	}
+	var sb strings.Builder
+	for i, dec := range decs {
+		if current == &decs[i] {
+			continue
+		}
+		sb.WriteString(commit + prefix + reset + colors[dec.typ])
+		if dec.typ == decorationTag {
+			sb.WriteString("tag: ")
+		}
+		sb.WriteString(d.name(dec))
+		if current != nil && dec.typ == decorationHEAD {
+			sb.WriteString(" -> " + reset + colors[current.typ] + d.name(*current))
+		}
+		sb.WriteString(reset)
+		prefix = separator
+	}
+	sb.WriteString(commit + suffix + reset)
+	return sb.String()
+}
@@ -0,0 +1,66 @@
+package git
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDecorations(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo": "a\n"},
+		map[string]string{"foo": "b\n"},
+		map[string]string{"bar": "c\n"},
+	)
+	defer os.RemoveAll(dir)
+	base, err := RevParseCommit(c, &RevParseOptions{}, "master^")
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic, err := RevParseCommit(c, &RevParseOptions{}, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := TagCommit(c, TagOptions{}, "v1", base, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := TagCommit(c, TagOptions{Annotated: true}, "v2", base, "Version 2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateRefSpec(c, UpdateRefOptions{}, "refs/notes/other", base, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		label string
+		opts  DecorateOptions
+		cmt   CommitID
+		want  string
+	}{
+		{"head", DecorateOptions{}, head, " (HEAD -> master)"},
+		{"branch", DecorateOptions{}, topic, " (topic)"},
+		// The annotated tag decorates the commit it points to, and
+		// other refs are left out by default.
+		{"tags", DecorateOptions{}, base, " (tag: v2, tag: v1)"},
+		{"full", DecorateOptions{Full: true}, head, " (HEAD -> refs/heads/master)"},
+		{"include", DecorateOptions{Refs: []string{"tags/v1"}}, base, " (tag: v1)"},
+		{"include glob", DecorateOptions{Refs: []string{"refs/tags/v*"}}, base, " (tag: v2, tag: v1)"},
+		{"exclude", DecorateOptions{ExcludeRefs: []string{"tags"}}, base, " (refs/notes/other)"},
+		{"exclude head", DecorateOptions{ExcludeRefs: []string{"HEAD"}}, head, " (master)"},
+		{"clear", DecorateOptions{ClearDecorations: true}, base, " (tag: v2, tag: v1, refs/notes/other)"},
+		{"none", DecorateOptions{Refs: []string{"heads/topic"}}, head, ""},
+	}
+	for _, tc := range tests {
+		d, err := LoadDecorations(c, tc.opts)
+		if err != nil {
+			t.Errorf("%v: %v", tc.label, err)
+			continue
+		}
+		if got := d.Format(tc.cmt, " (", ", ", ")", false); got != tc.want {
+			t.Errorf("%v: got %q want %q", tc.label, got, tc.want)
+		}
+	}
+}
@@ -101,9 +101,9 @@ func calculate(index *suffixarray.Index, src, dst []byte, maxsz int) (*list.List
 			continue
 		}
 
-		nextOffset := nextPrefixStart(index, dst)
+		nextOffset := nextPrefixStart(index, remaining)
 		if nextOffset >= 0 {
-			estsz += 1 + len(remaining) - nextOffset
+			estsz += 1 + nextOffset
 			instructions.PushBack(insert(remaining[:nextOffset]))
 			remaining = remaining[nextOffset:]
 		} else {
@@ -0,0 +1,310 @@
+package git
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DescribeOptions are the options that may be passed to Describe.
+type DescribeOptions struct {
+	// Use any ref, not just tags
+	All bool
+	// Use lightweight tags in addition to annotated tags
+	Tags bool
+
+	// Only consider tags matching one of the Match glob patterns,
+	// and not matching any of the Exclude patterns
+	Match, Exclude []string
+
+	// The minimum number of hex digits to use when abbreviating the
+	// commit. 0 means only print the tag name.
+	Abbrev int
+
+	// Always output the long format, even for exact matches.
+	Long bool
+
+	// The number of candidate tags to consider. 0 means only exact
+	// matches are considered.
+	Candidates int
+
+	// Show an abbreviated commit if no tag can describe the commit.
+	Always bool
+
+	// Only follow the first parent of merge commits.
+	FirstParent bool
+
+	// If non-empty, append Dirty to the description of HEAD if the
+	// working tree has local modifications.
+	Dirty string
+}
+
+// A describeName is a possible name that describe can use for a commit.
+type describeName struct {
+	name string
+	// 2 for annotated tags, 1 for lightweight tags, 0 for other refs.
+	prio int
+	// The tagger date for annotated tags
+	date int64
+}
+
+// Describe gives commits a human readable name based on the tags that can
+// be reached from them. If no commits are given, HEAD is described.
+func Describe(c *Client, opts DescribeOptions, commits []Commitish) ([]string, error) {
+	names, err := describeNames(c, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	isHead := false
+	if len(commits) == 0 {
+		head, err := c.GetHeadCommit()
+		if err != nil {
+			return nil, err
+		}
+		commits = []Commitish{head}
+		isHead = true
+	} else if opts.Dirty != "" {
+		return nil, fmt.Errorf("--dirty is incompatible with commit-ishes")
+	}
+
+	suffix := ""
+	if isHead && opts.Dirty != "" {
+		s, err := Status(c, StatusOptions{Short: true, UntrackedMode: StatusUntrackedNo}, nil)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(s) != "" {
+			suffix = opts.Dirty
+		}
+	}
+
+	var vals []string
+	for _, cmt := range commits {
+		cid, err := cmt.CommitID(c)
+		if err != nil {
+			return nil, err
+		}
+		d, err := describeCommit(c, opts, names, cid)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, d+suffix)
+	}
+	return vals, nil
+}
+
+// describeNames returns a map of commits to the best name that describe
+// could use to name them.
+func describeNames(c *Client, opts DescribeOptions) (map[CommitID]describeName, error) {
+	refs, err := ShowRef(c, ShowRefOptions{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[CommitID]describeName)
+	for _, ref := range refs {
+		var dn describeName
+		switch {
+		case strings.HasPrefix(ref.Name, "refs/tags/"):
+			dn.name = strings.TrimPrefix(ref.Name, "refs/tags/")
+			if opts.All {
+				dn.name = "tags/" + dn.name
+			}
+			if ref.Value.Type(c) == "tag" {
+				dn.prio = 2
+				dn.date = tagDate(c, ref.Value)
+			} else if opts.Tags || opts.All {
+				dn.prio = 1
+			} else {
+				continue
+			}
+		case opts.All:
+			dn.name = strings.TrimPrefix(ref.Name, "refs/")
+		default:
+			continue
+		}
+		if !refMatchesPatterns(ref.Name, opts.Match, opts.Exclude) {
+			continue
+		}
+		cid, err := RefSpec(ref.Name).CommitID(c)
+		if err != nil {
+			// Refs that don't point to commits can't be used
+			// to describe anything.
+			continue
+		}
+
+		if old, ok := names[cid]; ok {
+			if old.prio > dn.prio {
+				continue
+			}
+			if old.prio == dn.prio && old.date >= dn.date {
+				continue
+			}
+		}
+		names[cid] = dn
+	}
+	return names, nil
+}
+
+// refMatchesPatterns returns whether refname matches one of the glob
+// patterns in match (or match is empty) and does not match any of the
+// patterns in exclude. Patterns may match either the full refname or
+// the name with the refs/tags/, refs/heads/ or refs/remotes/ prefix
+// removed.
+func refMatchesPatterns(refname string, match, exclude []string) bool {
+	short := refname
+	for _, prefix := range []string{"refs/tags/", "refs/heads/", "refs/remotes/"} {
+		short = strings.TrimPrefix(short, prefix)
+	}
+	matches := func(p string) bool {
+		if m, _ := filepath.Match(p, short); m {
+			return true
+		}
+		m, _ := filepath.Match(p, refname)
+		return m
+	}
+	for _, p := range exclude {
+		if matches(p) {
+			return false
+		}
+	}
+	if len(match) == 0 {
+		return true
+	}
+	for _, p := range match {
+		if matches(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// tagDate returns the unix timestamp from the tagger line of the
+// annotated tag s, or 0 if it could not be determined.
+func tagDate(c *Client, s Sha1) int64 {
+	tag, err := c.GetTagObject(s)
+	if err != nil {
+		return 0
+	}
+	pieces := strings.Fields(tag.GetHeader("tagger"))
+	if len(pieces) < 2 {
+		return 0
+	}
+	t, err := strconv.ParseInt(pieces[len(pieces)-2], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return t
+}
+
+func describeCommit(c *Client, opts DescribeOptions, names map[CommitID]describeName, cmt CommitID) (string, error) {
+	abbrev := func() string {
+		return Sha1(cmt).Abbrev(c, opts.Abbrev)
+	}
+	long := func(name string, depth int) string {
+		if opts.Abbrev == 0 {
+			return name
+		}
+		return fmt.Sprintf("%s-%d-g%s", name, depth, abbrev())
+	}
+
+	if n, ok := names[cmt]; ok {
+		if opts.Long {
+			return long(n.name, 0), nil
+		}
+		return n.name, nil
+	}
+	if opts.Candidates == 0 {
+		if opts.Always {
+			return abbrev(), nil
+		}
+		return "", fmt.Errorf("no tag exactly matches '%v'", cmt)
+	}
+	if len(names) == 0 {
+		if opts.Always {
+			return abbrev(), nil
+		}
+		return "", fmt.Errorf("No names found, cannot describe anything.")
+	}
+
+	type candidate struct {
+		name  describeName
+		depth int
+	}
+	var candidates []candidate
+
+	if opts.FirstParent {
+		for depth, cur := 0, cmt; ; depth++ {
+			if n, ok := names[cur]; ok {
+				candidates = append(candidates, candidate{n, depth})
+				break
+			}
+			parents, err := cur.Parents(c)
+			if err != nil {
+				return "", err
+			}
+			if len(parents) == 0 {
+				break
+			}
+			cur = parents[0]
+		}
+	} else {
+		ancestors, err := cmt.AncestorMap(c)
+		if err != nil {
+			return "", err
+		}
+		// Walk the history in date order, the same way that git does,
+		// so that more recent tags are found first.
+		queue := []CommitID{cmt}
+		seen := map[CommitID]struct{}{cmt: struct{}{}}
+		for len(queue) > 0 && len(candidates) < opts.Candidates {
+			cur := queue[0]
+			queue = queue[1:]
+			if n, ok := names[cur]; ok {
+				tagAncestors, err := cur.AncestorMap(c)
+				if err != nil {
+					return "", err
+				}
+				depth := 0
+				for a := range ancestors {
+					if _, ok := tagAncestors[a]; !ok {
+						depth++
+					}
+				}
+				candidates = append(candidates, candidate{n, depth})
+			}
+			parents, err := cur.Parents(c)
+			if err != nil {
+				return "", err
+			}
+			for _, p := range parents {
+				if _, ok := seen[p]; ok {
+					continue
+				}
+				seen[p] = struct{}{}
+				queue = append(queue, p)
+			}
+			sort.SliceStable(queue, func(i, j int) bool {
+				di, _ := queue[i].GetCommitterDate(c)
+				dj, _ := queue[j].GetCommitterDate(c)
+				return di.After(dj)
+			})
+		}
+	}
+
+	if len(candidates) == 0 {
+		if opts.Always {
+			return abbrev(), nil
+		}
+		return "", fmt.Errorf("No tags can describe '%v'.\nTry --always, or create some tags.", cmt)
+	}
+	best := candidates[0]
+	for _, cand := range candidates[1:] {
+		if cand.depth < best.depth {
+			best = cand
+		}
+	}
+	return long(best.name.name, best.depth), nil
+}
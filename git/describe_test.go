@@ -0,0 +1,148 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testDescribeSetup creates a repository with three commits on master,
+// an annotated tag "v1" on the first commit and a lightweight tag "light"
+// on the second.
+// The caller must cleanup tmpdir when done.
+func testDescribeSetup(t *testing.T) (c *Client, tmpdir string, cmts [3]CommitID) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "gitdescribe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpdir = dir
+
+	c, err = Init(nil, InitOptions{Quiet: true}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, env := range [][2]string{
+		{"GIT_COMMITTER_NAME", "John Smith"},
+		{"GIT_COMMITTER_EMAIL", "test@example.com"},
+		{"GIT_AUTHOR_NAME", "John Smith"},
+		{"GIT_AUTHOR_EMAIL", "test@example.com"},
+	} {
+		if err := os.Setenv(env[0], env[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, content := range []string{"foo\n", "bar\n", "baz\n"} {
+		if err := ioutil.WriteFile(dir+"/foo.txt", []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Add(c, AddOptions{}, []File{"foo.txt"}); err != nil {
+			t.Fatal(err)
+		}
+		cmt, err := Commit(c, CommitOptions{}, CommitMessage(content), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmts[i] = cmt
+	}
+	if err := TagCommit(c, TagOptions{Annotated: true}, "v1", cmts[0], "Version 1\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := TagCommit(c, TagOptions{}, "light", cmts[1], ""); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestDescribe(t *testing.T) {
+	c, dir, cmts := testDescribeSetup(t)
+	defer os.RemoveAll(dir)
+
+	short := cmts[2].String()[:7]
+	tests := []struct {
+		opts    DescribeOptions
+		commits []Commitish
+		want    string
+	}{
+		{DescribeOptions{Abbrev: 7, Candidates: 10}, nil, "v1-2-g" + short},
+		{DescribeOptions{Abbrev: 7, Candidates: 10, Tags: true}, nil, "light-1-g" + short},
+		{DescribeOptions{Abbrev: 0, Candidates: 10}, nil, "v1"},
+		{DescribeOptions{Abbrev: 7, Candidates: 10}, []Commitish{cmts[0]}, "v1"},
+		{DescribeOptions{Abbrev: 7, Candidates: 10, Long: true}, []Commitish{cmts[0]}, "v1-0-g" + cmts[0].String()[:7]},
+		{DescribeOptions{Abbrev: 7, Candidates: 10, Tags: true, Exclude: []string{"l*"}}, nil, "v1-2-g" + short},
+		{DescribeOptions{Abbrev: 7, Candidates: 10, Match: []string{"x*"}, Always: true}, nil, short},
+		{DescribeOptions{Abbrev: 7, Candidates: 10, All: true}, nil, "heads/master"},
+	}
+	for i, tc := range tests {
+		got, err := Describe(c, tc.opts, tc.commits)
+		if err != nil {
+			t.Errorf("Test %d: %v", i, err)
+			continue
+		}
+		if len(got) != 1 || got[0] != tc.want {
+			t.Errorf("Test %d: got %v want %v", i, got, tc.want)
+		}
+	}
+
+	if _, err := Describe(c, DescribeOptions{Abbrev: 7, Candidates: 0}, nil); err == nil {
+		t.Error("Expected error for exact match of untagged commit")
+	}
+
+	// Make the working tree dirty and ensure it gets detected.
+	if err := ioutil.WriteFile(dir+"/foo.txt", []byte("dirty\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Describe(c, DescribeOptions{Abbrev: 7, Candidates: 10, Dirty: "-dirty"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "v1-2-g" + short + "-dirty"; len(got) != 1 || got[0] != want {
+		t.Errorf("Unexpected dirty description: got %v want %v", got, want)
+	}
+}
+
+func TestNameRev(t *testing.T) {
+	c, dir, cmts := testDescribeSetup(t)
+	defer os.RemoveAll(dir)
+
+	got, err := NameRev(c, NameRevOptions{}, []Commitish{cmts[1], cmts[2]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"tags/light", "master"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Unexpected names: got %v want %v", got, want)
+	}
+
+	got, err = NameRev(c, NameRevOptions{Refs: []string{"v1"}}, []Commitish{cmts[0], cmts[1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"tags/v1^0", "undefined"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Unexpected names with --refs: got %v want %v", got, want)
+	}
+
+	got, err = NameRev(c, NameRevOptions{Tags: true, NameOnly: true}, []Commitish{cmts[2]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != "undefined" {
+		t.Errorf("Unexpected name for untagged commit: got %v", got)
+	}
+
+	var out strings.Builder
+	in := "commit " + cmts[1].String() + "\n"
+	if err := NameRevStdin(c, NameRevOptions{}, strings.NewReader(in), &out); err != nil {
+		t.Fatal(err)
+	}
+	if want := "commit " + cmts[1].String() + " (tags/light)\n"; out.String() != want {
+		t.Errorf("Unexpected stdin annotation: got %q want %q", out.String(), want)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/exec"
 	"strconv"
+	"strings"
 )
 
 // Describes the options that may be specified on the command line for
@@ -15,6 +16,13 @@ type DiffOptions struct {
 	Staged bool
 
 	NoIndex bool
+
+	// The revisions to compare. With none, the index is compared to
+	// the work tree. With one, the revision is compared to the work
+	// tree or, with Staged, the index, unless it's a range of the form
+	// "a..b" or "a...b". With two, the trees or blobs are compared to
+	// each other.
+	Revisions []string
 }
 
 // DiffFiles implements the git diff-files command.
@@ -40,6 +48,15 @@ func Diff(c *Client, opt DiffOptions, paths []File) ([]HashDiff, error) {
 	if err := refreshIndex(c); err != nil {
 		return nil, err
 	}
+	switch len(opt.Revisions) {
+	case 0:
+	case 1:
+		return diffRevision(c, opt, opt.Revisions[0], paths)
+	case 2:
+		return diffRevisions(c, opt, opt.Revisions[0], opt.Revisions[1], paths)
+	default:
+		return nil, fmt.Errorf("Too many revisions to diff")
+	}
 	if opt.Staged {
 		head, err := c.GetHeadCommit()
 		if err != nil {
@@ -61,3 +78,134 @@ func Diff(c *Client, opt DiffOptions, paths []File) ([]HashDiff, error) {
 		},
 		paths)
 }
+
+// diffRevision compares a single revision to the index or the work tree,
+// or the two ends of a range to each other.
+func diffRevision(c *Client, opt DiffOptions, rev string, paths []File) ([]HashDiff, error) {
+	if pos := strings.Index(rev, "..."); pos >= 0 {
+		a, err := diffRangeEnd(c, rev[:pos])
+		if err != nil {
+			return nil, err
+		}
+		b, err := diffRangeEnd(c, rev[pos+3:])
+		if err != nil {
+			return nil, err
+		}
+		base, err := MergeBase(c, MergeBaseOptions{}, []Commitish{a, b})
+		if err != nil {
+			return nil, err
+		}
+		return diffTrees(c, opt, base, b, paths)
+	}
+	if pos := strings.Index(rev, ".."); pos >= 0 {
+		a, err := diffRangeEnd(c, rev[:pos])
+		if err != nil {
+			return nil, err
+		}
+		b, err := diffRangeEnd(c, rev[pos+2:])
+		if err != nil {
+			return nil, err
+		}
+		return diffTrees(c, opt, a, b, paths)
+	}
+
+	tree, err := RevParseTreeish(c, &RevParseOptions{}, rev)
+	if err != nil {
+		return nil, err
+	}
+	index, err := c.GitDir.ReadIndex()
+	if err != nil {
+		return nil, err
+	}
+	return DiffIndex(c,
+		DiffIndexOptions{
+			DiffCommonOptions: opt.DiffCommonOptions,
+			Cached:            opt.Staged,
+		},
+		index,
+		tree,
+		paths)
+}
+
+// diffRangeEnd resolves one end of a range to a commit, where an empty
+// end means HEAD.
+func diffRangeEnd(c *Client, rev string) (CommitID, error) {
+	if rev == "" {
+		rev = "HEAD"
+	}
+	cmt, err := RevParseCommitish(c, &RevParseOptions{}, rev)
+	if err != nil {
+		return CommitID{}, err
+	}
+	return cmt.CommitID(c)
+}
+
+// diffTrees compares the trees of a and b.
+func diffTrees(c *Client, opt DiffOptions, a, b Treeish, paths []File) ([]HashDiff, error) {
+	strpaths := make([]string, len(paths))
+	for i, p := range paths {
+		strpaths[i] = p.String()
+	}
+	return DiffTree(c, &DiffTreeOptions{DiffCommonOptions: opt.DiffCommonOptions, Recurse: true}, a, b, strpaths)
+}
+
+// diffRevisions compares two revisions, which must either both be trees
+// or both be blobs.
+func diffRevisions(c *Client, opt DiffOptions, rev1, rev2 string, paths []File) ([]HashDiff, error) {
+	t1, err1 := RevParseTreeish(c, &RevParseOptions{}, rev1)
+	t2, err2 := RevParseTreeish(c, &RevParseOptions{}, rev2)
+	if err1 == nil && err2 == nil {
+		return diffTrees(c, opt, t1, t2, paths)
+	}
+
+	b1, err := diffBlob(c, rev1)
+	if err != nil {
+		return nil, err
+	}
+	b2, err := diffBlob(c, rev2)
+	if err != nil {
+		return nil, err
+	}
+	if b1.Sha1 == b2.Sha1 {
+		return nil, nil
+	}
+	diff := HashDiff{
+		Name: b2.Name,
+		Src:  TreeEntry{b1.Sha1, ModeBlob},
+		Dst:  TreeEntry{b2.Sha1, ModeBlob},
+	}
+	if b1.Name != b2.Name {
+		diff.SrcName = b1.Name
+	}
+	if obj, err := c.GetObject(b1.Sha1); err == nil {
+		diff.SrcSize = uint(len(obj.GetContent()))
+	}
+	if obj, err := c.GetObject(b2.Sha1); err == nil {
+		diff.DstSize = uint(len(obj.GetContent()))
+	}
+	return []HashDiff{diff}, nil
+}
+
+// A revisionBlob is a blob given as a revision, and the name that it's
+// shown with in the diff.
+type revisionBlob struct {
+	Name IndexPath
+	Sha1 Sha1
+}
+
+// diffBlob resolves rev, which is either a blob's sha or a path in a tree
+// like "HEAD:README.md", to a blob.
+func diffBlob(c *Client, rev string) (revisionBlob, error) {
+	sha, err := RevParsePath(c, &RevParseOptions{}, rev)
+	if err != nil {
+		return revisionBlob{}, err
+	}
+	if t := sha.Type(c); t != "blob" {
+		return revisionBlob{}, fmt.Errorf("Can not diff %v against a %v", rev, t)
+	}
+	name := rev
+	if pos := strings.Index(rev, ":"); pos >= 0 {
+		name = rev[pos+1:]
+	}
+	return revisionBlob{IndexPath(name), sha}, nil
+}
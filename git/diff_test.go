@@ -0,0 +1,54 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDiffRevisions(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"a": "a\n", "b": "b\n"},
+		map[string]string{"a": "ours\n"},
+		map[string]string{"b": "theirs\n", "c": "c\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		revs  []string
+		paths []File
+		want  []string
+	}{
+		{[]string{"topic"}, nil, []string{"M a", "M b", "D c"}},
+		{[]string{"topic"}, []File{"b"}, []string{"M b"}},
+		{[]string{"master..topic"}, nil, []string{"M a", "M b", "A c"}},
+		{[]string{"..topic"}, []File{"c*"}, []string{"A c"}},
+		{[]string{"master...topic"}, nil, []string{"M b", "A c"}},
+		{[]string{"topic...master"}, nil, []string{"M a"}},
+		{[]string{"master", "topic"}, []File{"a", "c"}, []string{"M a", "A c"}},
+		{[]string{"master:a", "topic:c"}, nil, []string{"M a c"}},
+		{[]string{"master:a", "master:a"}, nil, nil},
+	}
+	for i, tc := range tests {
+		diffs, err := Diff(c, DiffOptions{Revisions: tc.revs}, tc.paths)
+		if err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		var got []string
+		for _, d := range diffs {
+			if d.SrcName != "" {
+				got = append(got, fmt.Sprintf("%v %v %v", d.StatusString(), d.SrcName, d.Name))
+			} else {
+				got = append(got, fmt.Sprintf("%v %v", d.StatusString(), d.Name))
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("Test %d: unexpected diff: got %v want %v", i, got, tc.want)
+		}
+	}
+
+	if _, err := Diff(c, DiffOptions{Revisions: []string{"master", "master:a"}}, nil); err == nil {
+		t.Error("Expected diffing a tree against a blob to fail")
+	}
+}
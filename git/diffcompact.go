@@ -0,0 +1,293 @@
+package git
+
+// The constants of git's indent heuristic, which scores the places that a
+// hunk can be slid to.
+const (
+	maxIndent                       = 200
+	maxBlanks                       = 20
+	indentHeuristicMaxSliding       = 100
+	startOfFilePenalty              = 1
+	endOfFilePenalty                = 21
+	totalBlankWeight                = -30
+	postBlankWeight                 = 6
+	relativeIndentPenalty           = -4
+	relativeIndentWithBlankPenalty  = 10
+	relativeOutdentPenalty          = 24
+	relativeOutdentWithBlankPenalty = 17
+	relativeDedentPenalty           = 23
+	relativeDedentWithBlankPenalty  = 17
+	indentWeight                    = 60
+)
+
+// changeFile is one side of a diff, with the lines that were changed on
+// that side marked.
+type changeFile struct {
+	lines   []string
+	changed []bool
+	eq      func(x, y string) bool
+}
+
+// A changeGroup is a run of changed lines, which may be empty. Each group
+// on one side of a diff corresponds to a group on the other side.
+type changeGroup struct {
+	start, end int
+}
+
+func (f *changeFile) isChanged(i int) bool {
+	return i >= 0 && i < len(f.changed) && f.changed[i]
+}
+
+func (f *changeFile) firstGroup() changeGroup {
+	var g changeGroup
+	for f.isChanged(g.end) {
+		g.end++
+	}
+	return g
+}
+
+func (f *changeFile) nextGroup(g *changeGroup) bool {
+	if g.end == len(f.changed) {
+		return false
+	}
+	g.start = g.end + 1
+	for g.end = g.start; f.isChanged(g.end); g.end++ {
+	}
+	return true
+}
+
+func (f *changeFile) previousGroup(g *changeGroup) bool {
+	if g.start == 0 {
+		return false
+	}
+	g.end = g.start - 1
+	for g.start = g.end; f.isChanged(g.start - 1); g.start-- {
+	}
+	return true
+}
+
+// slideDown moves g down by a line if the line after it is the same as
+// its first line, merging it with the group after it if they touch.
+func (f *changeFile) slideDown(g *changeGroup) bool {
+	if g.end >= len(f.lines) || !f.eq(f.lines[g.start], f.lines[g.end]) {
+		return false
+	}
+	f.changed[g.start] = false
+	f.changed[g.end] = true
+	g.start++
+	g.end++
+	for f.isChanged(g.end) {
+		g.end++
+	}
+	return true
+}
+
+// slideUp moves g up by a line if the line before it is the same as its
+// last line, merging it with the group before it if they touch.
+func (f *changeFile) slideUp(g *changeGroup) bool {
+	if g.start == 0 || !f.eq(f.lines[g.start-1], f.lines[g.end-1]) {
+		return false
+	}
+	g.start--
+	g.end--
+	f.changed[g.start] = true
+	f.changed[g.end] = false
+	for f.isChanged(g.start - 1) {
+		g.start--
+	}
+	return true
+}
+
+// compactChanges slides the groups of changed lines in lines, which are
+// marked in changed, through identical lines the same way as git's
+// xdl_change_compact. A group which can move is lined up with the last
+// group of changes in the other side of the diff, whose changed lines are
+// other, that it can be. Otherwise, it's moved as far down as possible
+// or, with indentHeuristic, to where it looks best.
+func compactChanges(lines []string, changed, other []bool, eq func(x, y string) bool, indentHeuristic bool) {
+	f := &changeFile{lines: lines, changed: changed, eq: eq}
+	o := &changeFile{changed: other}
+	g, og := f.firstGroup(), o.firstGroup()
+	for {
+		if g.end != g.start {
+			var groupSize, earliestEnd, endMatchingOther int
+			for {
+				groupSize = g.end - g.start
+				endMatchingOther = -1
+				for f.slideUp(&g) {
+					o.previousGroup(&og)
+				}
+				earliestEnd = g.end
+				if og.end > og.start {
+					endMatchingOther = g.end
+				}
+				for f.slideDown(&g) {
+					o.nextGroup(&og)
+					if og.end > og.start {
+						endMatchingOther = g.end
+					}
+				}
+				if groupSize == g.end-g.start {
+					break
+				}
+			}
+
+			switch {
+			case g.end == earliestEnd:
+				// It can't be moved.
+			case endMatchingOther != -1:
+				for og.end == og.start {
+					f.slideUp(&g)
+					o.previousGroup(&og)
+				}
+			case indentHeuristic:
+				shift := earliestEnd
+				if g.end-groupSize-1 > shift {
+					shift = g.end - groupSize - 1
+				}
+				if g.end-indentHeuristicMaxSliding > shift {
+					shift = g.end - indentHeuristicMaxSliding
+				}
+				bestShift := -1
+				var best splitScore
+				for ; shift <= g.end; shift++ {
+					var score splitScore
+					score.add(measureSplit(lines, shift))
+					score.add(measureSplit(lines, shift-groupSize))
+					if bestShift == -1 || score.cmp(best) <= 0 {
+						best, bestShift = score, shift
+					}
+				}
+				for g.end > bestShift {
+					f.slideUp(&g)
+					o.previousGroup(&og)
+				}
+			}
+		}
+		if !f.nextGroup(&g) {
+			break
+		}
+		o.nextGroup(&og)
+	}
+}
+
+// lineIndent returns the indentation of line, with tabs to multiples of
+// 8, or -1 if it's blank.
+func lineIndent(line string) int {
+	indent := 0
+	for i := 0; i < len(line); i++ {
+		switch ch := line[i]; {
+		case !isSpace(ch):
+			return indent
+		case ch == ' ':
+			indent++
+		case ch == '\t':
+			indent += 8 - indent%8
+		}
+		if indent >= maxIndent {
+			return maxIndent
+		}
+	}
+	return -1
+}
+
+// A splitMeasurement describes the lines around a split between a hunk
+// and its context.
+type splitMeasurement struct {
+	endOfFile bool
+
+	// The indentation of the line after the split, and the number of
+	// blank lines and the indentation of the first non-blank line
+	// before and after it.
+	indent                int
+	preBlank, preIndent   int
+	postBlank, postIndent int
+}
+
+// measureSplit measures the split before the line at split.
+func measureSplit(lines []string, split int) splitMeasurement {
+	m := splitMeasurement{indent: -1, preIndent: -1, postIndent: -1}
+	if split >= len(lines) {
+		m.endOfFile = true
+	} else {
+		m.indent = lineIndent(lines[split])
+	}
+	for i := split - 1; i >= 0; i-- {
+		if m.preIndent = lineIndent(lines[i]); m.preIndent != -1 {
+			break
+		}
+		if m.preBlank++; m.preBlank == maxBlanks {
+			m.preIndent = 0
+			break
+		}
+	}
+	for i := split + 1; i < len(lines); i++ {
+		if m.postIndent = lineIndent(lines[i]); m.postIndent != -1 {
+			break
+		}
+		if m.postBlank++; m.postBlank == maxBlanks {
+			m.postIndent = 0
+			break
+		}
+	}
+	return m
+}
+
+// A splitScore is how bad the splits for a position of a hunk are. Lower
+// is better.
+type splitScore struct {
+	effectiveIndent, penalty int
+}
+
+func (s *splitScore) add(m splitMeasurement) {
+	if m.preIndent == -1 && m.preBlank == 0 {
+		s.penalty += startOfFilePenalty
+	}
+	if m.endOfFile {
+		s.penalty += endOfFilePenalty
+	}
+	postBlank := 0
+	if m.indent == -1 {
+		postBlank = 1 + m.postBlank
+	}
+	totalBlank := m.preBlank + postBlank
+	s.penalty += totalBlankWeight*totalBlank + postBlankWeight*postBlank
+
+	indent := m.indent
+	if indent == -1 {
+		indent = m.postIndent
+	}
+	anyBlanks := totalBlank != 0
+	s.effectiveIndent += indent
+
+	switch {
+	case indent == -1, m.preIndent == -1, indent == m.preIndent:
+	case indent > m.preIndent:
+		if anyBlanks {
+			s.penalty += relativeIndentWithBlankPenalty
+		} else {
+			s.penalty += relativeIndentPenalty
+		}
+	case m.postIndent != -1 && m.postIndent > indent:
+		if anyBlanks {
+			s.penalty += relativeOutdentWithBlankPenalty
+		} else {
+			s.penalty += relativeOutdentPenalty
+		}
+	default:
+		if anyBlanks {
+			s.penalty += relativeDedentWithBlankPenalty
+		} else {
+			s.penalty += relativeDedentPenalty
+		}
+	}
+}
+
+func (s splitScore) cmp(o splitScore) int {
+	indents := 0
+	if s.effectiveIndent > o.effectiveIndent {
+		indents = 1
+	} else if s.effectiveIndent < o.effectiveIndent {
+		indents = -1
+	}
+	return indentWeight*indents + s.penalty - o.penalty
+}
@@ -2,6 +2,7 @@ package git
 
 import (
 	"log"
+	"regexp"
 	"sort"
 )
 
@@ -19,6 +20,106 @@ type DiffCommonOptions struct {
 
 	// Exit with a exit code of 1 if there are any diffs
 	ExitCode bool
+
+	// Detect renames (-M), pairing deleted and added files which are at
+	// least RenameThreshold percent similar. The 0 threshold implies 50.
+	DetectRenames   bool
+	RenameThreshold int
+
+	// Also detect copies from modified files (-C), or from every file
+	// on the source side with FindCopiesHarder. Both imply DetectRenames.
+	DetectCopies, FindCopiesHarder bool
+
+	// Break modifications which change at least BreakScore percent of a
+	// file into a delete and an add before detecting renames (-B).
+	// Broken pairs which aren't used for a rename are shown as rewrites
+	// if they're at least MergeScore percent dissimilar. The 0 scores
+	// imply 50 and 60.
+	BreakRewrites          bool
+	BreakScore, MergeScore int
+
+	// The maximum number of sources and destinations to compare for
+	// inexact rename detection (-l). The 0 value implies 1000.
+	RenameLimit int
+
+	// Show a diffstat (--stat) at most StatWidth columns wide, with the
+	// names limited to StatNameWidth columns and the graph limited to
+	// StatGraphWidth columns. Only the first StatCount files are listed.
+	// A StatWidth of 0 implies 80, and the other 0 values imply no limit.
+	Stat                                                bool
+	StatWidth, StatNameWidth, StatGraphWidth, StatCount int
+
+	// Show the number of added and deleted lines of each file in a
+	// machine readable format (--numstat), or only the last line of the
+	// diffstat (--shortstat).
+	NumStat, ShortStat bool
+
+	// Show the distribution of changes between directories (--dirstat),
+	// using the comma separated parameters in DirStatParams.
+	DirStat       bool
+	DirStatParams string
+
+	// Show only the names (--name-only) or the names and statuses
+	// (--name-status) of the changed files instead of any other output.
+	NameOnly, NameStatus bool
+
+	// Separate fields and terminate lines in the raw, numstat and name
+	// output with NULs (-z).
+	NullTerminate bool
+
+	// Colour the patch, with the colours from color.diff.<slot>.
+	Color bool
+
+	// How moved lines are coloured in a coloured patch. One of "no",
+	// "default", "plain", "blocks", "zebra" or "dimmed-zebra". The empty
+	// value is the same as "no".
+	ColorMoved string
+
+	// Show the patch as a word diff, which is one of "color", "plain",
+	// "porcelain" or "none". Words are matched by WordDiffRegex, or are
+	// separated by whitespace if it's nil.
+	WordDiff      string
+	WordDiffRegex *regexp.Regexp
+
+	// The kinds of lines whose whitespace errors are highlighted in a
+	// coloured patch: "old", "new", "context", "all", "none" or
+	// "default". nil is the same as "new".
+	WhitespaceErrorHighlight []string
+
+	// Show the full object names in the index line of a patch. Binary
+	// shows a "GIT binary patch", with the full object names, which can
+	// be applied instead of saying that binary files differ.
+	FullIndex, Binary bool
+
+	// Abbreviate the object names in raw output to at least Abbrev
+	// hexadecimal digits, or as many as are needed to be unique. 0
+	// shows the full names.
+	Abbrev int
+
+	// How the changes made by merge commits are shown: "off",
+	// "first-parent", "separate" for a diff against each parent,
+	// "combined", "dense-combined" or "remerge". The empty value is the
+	// command's default.
+	DiffMerges string
+
+	// Only show the changes to files which change the number of
+	// occurrences of PickaxeString (-S), or which add or remove lines
+	// matching the extended regular expression PickaxeGrep (-G).
+	// PickaxeRegex treats PickaxeString as a regular expression too, and
+	// PickaxeIgnoreCase ignores case in either of them. With PickaxeAll,
+	// all of the changes are shown if any of them match.
+	PickaxeString, PickaxeGrep                  string
+	PickaxeRegex, PickaxeIgnoreCase, PickaxeAll bool
+}
+
+// HasDiffOutput returns whether any output format is selected in o.
+func (o DiffCommonOptions) HasDiffOutput() bool {
+	return o.Patch || o.Raw || o.Stat || o.NumStat || o.ShortStat || o.DirStat || o.NameOnly || o.NameStatus
+}
+
+// HasPickaxe returns whether the changes are filtered by -S or -G.
+func (o DiffCommonOptions) HasPickaxe() bool {
+	return o.PickaxeString != "" || o.PickaxeGrep != ""
 }
 
 // Describes the options that may be specified on the command line for
@@ -52,12 +153,12 @@ func DiffFiles(c *Client, opt DiffFilesOptions, paths []File) ([]HashDiff, error
 		if err != nil || !f.Exists() {
 			// If there was an error, treat it as a non-existant file
 			// and just use the empty Sha1
-			val = append(val, HashDiff{idx.PathName, idxtree, fs, uint(idx.Fsize), 0})
+			val = append(val, HashDiff{Name: idx.PathName, Src: idxtree, Dst: fs, SrcSize: uint(idx.Fsize)})
 			continue
 		}
 		stat, err := f.Lstat()
 		if err != nil {
-			val = append(val, HashDiff{idx.PathName, idxtree, fs, uint(idx.Fsize), 0})
+			val = append(val, HashDiff{Name: idx.PathName, Src: idxtree, Dst: fs, SrcSize: uint(idx.Fsize)})
 			continue
 		}
 
@@ -66,7 +167,7 @@ func DiffFiles(c *Client, opt DiffFilesOptions, paths []File) ([]HashDiff, error
 			// Since we're diffing files in the index (which only holds files)
 			// against a directory, it means that the file was deleted and
 			// replaced by a directory.
-			val = append(val, HashDiff{idx.PathName, idxtree, fs, uint(idx.Fsize), 0})
+			val = append(val, HashDiff{Name: idx.PathName, Src: idxtree, Dst: fs, SrcSize: uint(idx.Fsize)})
 			continue
 		case !stat.Mode().IsRegular():
 			// FIXME: This doesn't take into account that the file
@@ -80,7 +181,7 @@ func DiffFiles(c *Client, opt DiffFilesOptions, paths []File) ([]HashDiff, error
 		size := stat.Size()
 		if err := idx.CompareStat(f); err != nil {
 			log.Printf("Stat information does not match for %v: %v\n", f, err)
-			val = append(val, HashDiff{idx.PathName, idxtree, fs, uint(idx.Fsize), uint(size)})
+			val = append(val, HashDiff{Name: idx.PathName, Src: idxtree, Dst: fs, SrcSize: uint(idx.Fsize), DstSize: uint(size)})
 			continue
 		}
 
@@ -89,11 +190,19 @@ func DiffFiles(c *Client, opt DiffFilesOptions, paths []File) ([]HashDiff, error
 		hash, _, err := HashFile("blob", f.String())
 
 		if err != nil || hash != idx.Sha1 {
-			val = append(val, HashDiff{idx.PathName, idxtree, fs, uint(idx.Fsize), uint(size)})
+			val = append(val, HashDiff{Name: idx.PathName, Src: idxtree, Dst: fs, SrcSize: uint(idx.Fsize), DstSize: uint(size)})
 		}
 	}
 
 	sort.Sort(ByName(val))
 
-	return val, nil
+	sources := make(map[IndexPath]TreeEntry, len(indexentries))
+	for _, idx := range indexentries {
+		sources[idx.PathName] = TreeEntry{idx.Sha1, idx.Mode}
+	}
+	val, err = diffRenames(c, opt.DiffCommonOptions, val, sources)
+	if err != nil {
+		return nil, err
+	}
+	return diffPickaxe(c, opt.DiffCommonOptions, val)
 }
@@ -1,7 +1,7 @@
 package git
 
 import (
-//	"fmt"
+	"sort"
 )
 
 // Describes the options that may be specified on the command line for
@@ -49,9 +49,17 @@ func DiffIndex(c *Client, opt DiffIndexOptions, index *Index, tree Treeish, path
 		}{TreeEntry{path.Sha1, path.Mode}, uint(path.Fsize)}
 	}
 
+	spec, err := newPathspec(c, paths)
+	if err != nil {
+		return nil, err
+	}
+
 	var val []HashDiff
 
 	for _, entry := range index.Objects {
+		if !spec.Matches(entry.PathName, false) {
+			continue
+		}
 		f, err := entry.PathName.FilePath(c)
 		if err != nil {
 			return nil, err
@@ -77,16 +85,42 @@ func DiffIndex(c *Client, opt DiffIndexOptions, index *Index, tree Treeish, path
 		}
 
 		if entry.Sha1 != fssha {
-			val = append(val, HashDiff{entry.PathName, treeObjects[entry.PathName].Tree, TreeEntry{Sha1: Sha1{}, FileMode: mode}, treeObjects[entry.PathName].Size, 0})
+			if !ok && mode == 0 {
+				// It was added to the index and then deleted, so
+				// it's not in either side.
+				continue
+			}
+			val = append(val, HashDiff{Name: entry.PathName, Src: treeObjects[entry.PathName].Tree, Dst: TreeEntry{Sha1: Sha1{}, FileMode: mode}, SrcSize: treeObjects[entry.PathName].Size})
 		} else if !ok {
-			val = append(val, HashDiff{entry.PathName, TreeEntry{}, TreeEntry{Sha1: entry.Sha1, FileMode: entry.Mode}, 0, fsize})
+			val = append(val, HashDiff{Name: entry.PathName, Src: TreeEntry{}, Dst: TreeEntry{Sha1: entry.Sha1, FileMode: entry.Mode}, DstSize: fsize})
 		} else if entry.Sha1 != treeSha.Tree.Sha1 {
-			val = append(val, HashDiff{entry.PathName, treeSha.Tree, TreeEntry{Sha1: entry.Sha1, FileMode: entry.Mode}, treeSha.Size, fsize})
+			val = append(val, HashDiff{Name: entry.PathName, Src: treeSha.Tree, Dst: TreeEntry{Sha1: entry.Sha1, FileMode: entry.Mode}, SrcSize: treeSha.Size, DstSize: fsize})
 		} else {
 			if err != nil {
 				return nil, err
 			}
 		}
 	}
-	return val, nil
+
+	// Files in the tree which were removed from the index are deleted.
+	inIndex := make(map[IndexPath]bool, len(index.Objects))
+	for _, entry := range index.Objects {
+		inIndex[entry.PathName] = true
+	}
+	for name, t := range treeObjects {
+		if !inIndex[name] && spec.Matches(name, false) {
+			val = append(val, HashDiff{Name: name, Src: t.Tree, SrcSize: t.Size})
+		}
+	}
+	sort.Sort(ByName(val))
+
+	sources := make(map[IndexPath]TreeEntry, len(treeObjects))
+	for name, t := range treeObjects {
+		sources[name] = t.Tree
+	}
+	val, err = diffRenames(c, opt.DiffCommonOptions, val, sources)
+	if err != nil {
+		return nil, err
+	}
+	return diffPickaxe(c, opt.DiffCommonOptions, val)
 }
@@ -0,0 +1,378 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+)
+
+// Files smaller than this are never broken into a delete and an add, the
+// same as git's MINIMUM_BREAK_SIZE.
+const minimumBreakSize = 400
+
+// The default scores for -B, as percentages.
+const (
+	defaultBreakScore = 50
+	defaultMergeScore = 60
+)
+
+// breakDissimilarity returns how much of src was removed to make dst, as
+// a percentage, and whether the change is big enough to be considered a
+// rewrite with the given break score. It follows git's should_break.
+func breakDissimilarity(src, dst []byte, breakScore int) (int, bool) {
+	if len(src) == 0 {
+		return 0, false
+	}
+	maxSize, baseSize := len(src), len(dst)
+	if baseSize > maxSize {
+		maxSize, baseSize = baseSize, maxSize
+	}
+	if maxSize < minimumBreakSize {
+		return 0, false
+	}
+	copied := sharedBytes(dst, src)
+	removed := len(src) - copied
+	added := len(dst) - copied
+
+	score := removed * 100 / len(src)
+	if score > breakScore {
+		return score, true
+	}
+	if baseSize == 0 || (removed+added)*100/baseSize < breakScore {
+		return score, false
+	}
+	// Removing a lot without adding anything isn't really a rewrite.
+	if len(src)*breakScore < removed*100 && added*20 < removed && added*20 < copied {
+		return score, false
+	}
+	return score, true
+}
+
+// renameSource is a file that may be the source of a rename or copy.
+type renameSource struct {
+	Name  IndexPath
+	Entry TreeEntry
+	Size  uint
+
+	// Whether the file is still there after the diff, in which case
+	// it can only be copied.
+	Stays bool
+
+	// The number of destinations using the source.
+	Uses int
+}
+
+// renamed returns whether src can still be renamed, which it can only be
+// once, and only if it was deleted.
+func (src *renameSource) renamed() bool {
+	return src.Stays || src.Uses > 0
+}
+
+// renameMatch is the source of an added file.
+type renameMatch struct {
+	Src   *renameSource
+	Score int
+}
+
+// diffRenames detects renames, copies and rewrites in diffs as configured
+// in opts. sources are all the files on the source side of the diff,
+// which are used as copy sources with FindCopiesHarder.
+func diffRenames(c *Client, opts DiffCommonOptions, diffs []HashDiff, sources map[IndexPath]TreeEntry) ([]HashDiff, error) {
+	copies := opts.DetectCopies || opts.FindCopiesHarder
+	renames := opts.DetectRenames || copies
+	if !renames && !opts.BreakRewrites {
+		return diffs, nil
+	}
+	breakScore, mergeScore := opts.BreakScore, opts.MergeScore
+	if breakScore <= 0 {
+		breakScore = defaultBreakScore
+	}
+	if mergeScore <= 0 {
+		mergeScore = defaultMergeScore
+	}
+
+	isBlob := func(e TreeEntry) bool {
+		return e.FileMode != 0 && e.FileMode.TreeType() == "blob"
+	}
+
+	// Sort the diffs into additions, deletions and modifications, and
+	// break any modifications which are really rewrites.
+	var added, deleted, modified []HashDiff
+	broken := make(map[IndexPath]HashDiff)
+	dissimilarity := make(map[IndexPath]int)
+	for _, d := range diffs {
+		switch {
+		case d.Src.FileMode == 0 && d.Src.Sha1 == (Sha1{}):
+			added = append(added, d)
+			continue
+		case d.Dst.FileMode == 0 && d.Dst.Sha1 == (Sha1{}):
+			deleted = append(deleted, d)
+			continue
+		}
+		if opts.BreakRewrites && isBlob(d.Src) && isBlob(d.Dst) {
+			src, err := diffContent(c, d.Name, d.Src)
+			if err != nil {
+				return nil, err
+			}
+			dst, err := diffContent(c, d.Name, d.Dst)
+			if err != nil {
+				return nil, err
+			}
+			if score, ok := breakDissimilarity(src, dst, breakScore); ok {
+				broken[d.Name] = d
+				dissimilarity[d.Name] = score
+				deleted = append(deleted, HashDiff{Name: d.Name, Src: d.Src, SrcSize: d.SrcSize})
+				added = append(added, HashDiff{Name: d.Name, Dst: d.Dst, DstSize: d.DstSize})
+				continue
+			}
+		}
+		modified = append(modified, d)
+	}
+
+	matches := make(map[IndexPath]renameMatch)
+	var srcs []*renameSource
+	if renames {
+		for _, d := range deleted {
+			if isBlob(d.Src) {
+				srcs = append(srcs, &renameSource{Name: d.Name, Entry: d.Src, Size: d.SrcSize})
+			}
+		}
+		if copies {
+			inDiff := make(map[IndexPath]bool)
+			for _, d := range modified {
+				inDiff[d.Name] = true
+				if isBlob(d.Src) {
+					srcs = append(srcs, &renameSource{Name: d.Name, Entry: d.Src, Size: d.SrcSize, Stays: true})
+				}
+			}
+			if opts.FindCopiesHarder {
+				for _, d := range diffs {
+					inDiff[d.Name] = true
+				}
+				for name, e := range sources {
+					if !inDiff[name] && isBlob(e) {
+						srcs = append(srcs, &renameSource{Name: name, Entry: e, Stays: true})
+					}
+				}
+			}
+		}
+		sort.SliceStable(srcs, func(i, j int) bool { return srcs[i].Name < srcs[j].Name })
+		if err := findRenames(c, opts, srcs, added, copies, matches); err != nil {
+			return nil, err
+		}
+	}
+
+	// A broken file can only be a copy source if the other half wasn't
+	// replaced by a rename.
+	for _, src := range srcs {
+		if _, ok := broken[src.Name]; ok {
+			_, replaced := matches[src.Name]
+			src.Stays = !replaced
+		}
+	}
+
+	used := make(map[IndexPath]bool)
+	for _, src := range srcs {
+		used[src.Name] = matchedSource(matches, src)
+	}
+	// The best match of a deleted file is the rename, and any others
+	// are copies. Ties go to the destination that sorts first.
+	renamed := make(map[*renameSource]IndexPath)
+	for dst, m := range matches {
+		if m.Src.Stays {
+			continue
+		}
+		best, ok := renamed[m.Src]
+		if !ok || m.Score > matches[best].Score || (m.Score == matches[best].Score && dst < best) {
+			renamed[m.Src] = dst
+		}
+	}
+
+	var val []HashDiff
+	val = append(val, modified...)
+	for _, d := range added {
+		m, ok := matches[d.Name]
+		if !ok {
+			if _, ok := broken[d.Name]; !ok {
+				val = append(val, d)
+			}
+			continue
+		}
+		d.SrcName = m.Src.Name
+		d.Src = m.Src.Entry
+		d.SrcSize = m.Src.Size
+		d.Score = m.Score
+		d.Status = 'C'
+		if renamed[m.Src] == d.Name {
+			d.Status = 'R'
+		}
+		val = append(val, d)
+	}
+	for _, d := range deleted {
+		if _, ok := broken[d.Name]; ok || used[d.Name] {
+			continue
+		}
+		val = append(val, d)
+	}
+
+	// Put broken pairs back together unless one half was renamed.
+	for name, d := range broken {
+		_, replaced := matches[name]
+		switch {
+		case replaced && !used[name]:
+			val = append(val, HashDiff{Name: name, Src: d.Src, SrcSize: d.SrcSize})
+		case replaced:
+		case used[name] || dissimilarity[name] >= mergeScore:
+			d.Status = 'M'
+			d.Score = dissimilarity[name]
+			val = append(val, d)
+		default:
+			val = append(val, d)
+		}
+	}
+	sort.SliceStable(val, func(i, j int) bool { return val[i].Name < val[j].Name })
+	return val, nil
+}
+
+// matchedSource returns whether src is the source of any match.
+func matchedSource(matches map[IndexPath]renameMatch, src *renameSource) bool {
+	for _, m := range matches {
+		if m.Src == src {
+			return true
+		}
+	}
+	return false
+}
+
+// findRenames finds the source of each of the added files in srcs, and
+// adds them to matches. Like git, each deleted file is first used as the
+// source of at most one rename, and then if copies is set, the files
+// which are left are matched with any source as copies.
+func findRenames(c *Client, opts DiffCommonOptions, srcs []*renameSource, added []HashDiff, copies bool, matches map[IndexPath]renameMatch) error {
+	threshold := opts.RenameThreshold
+	if threshold <= 0 {
+		threshold = defaultRenameThreshold
+	}
+	limit := opts.RenameLimit
+	if limit <= 0 {
+		limit = renameLimit
+	}
+	use := func(dst IndexPath, src *renameSource, score int) {
+		matches[dst] = renameMatch{src, score}
+		src.Uses++
+	}
+	available := func(src *renameSource) bool {
+		return copies || !src.renamed()
+	}
+
+	// Exact renames first, preferring a source which can still be
+	// renamed, and then one with the same name.
+	var dsts []HashDiff
+	for _, d := range added {
+		if d.Dst.FileMode == 0 || d.Dst.FileMode.TreeType() != "blob" {
+			continue
+		}
+		var best *renameSource
+		bestScore := -1
+		if d.Dst.Sha1 != (Sha1{}) {
+			for _, src := range srcs {
+				if src.Entry.Sha1 != d.Dst.Sha1 || !available(src) {
+					continue
+				}
+				score := 0
+				if !src.renamed() {
+					score++
+				}
+				if path.Base(string(src.Name)) == path.Base(string(d.Name)) {
+					score++
+				}
+				if score > bestScore {
+					best, bestScore = src, score
+				}
+			}
+		}
+		if best != nil {
+			use(d.Name, best, 100)
+			continue
+		}
+		dsts = append(dsts, d)
+	}
+
+	var remaining []*renameSource
+	for _, src := range srcs {
+		if available(src) {
+			remaining = append(remaining, src)
+		}
+	}
+	if len(dsts) == 0 || len(remaining) == 0 {
+		return nil
+	}
+	if len(dsts)*len(remaining) > limit*limit {
+		needed := len(dsts)
+		if len(remaining) > needed {
+			needed = len(remaining)
+		}
+		fmt.Fprintf(os.Stderr, "warning: exhaustive rename detection was skipped due to too many files.\n")
+		fmt.Fprintf(os.Stderr, "warning: you may want to set your diff.renameLimit variable to at least %d and retry the command.\n", needed)
+		return nil
+	}
+
+	srcContent := make([][]byte, len(remaining))
+	for i, src := range remaining {
+		content, err := diffContent(c, src.Name, src.Entry)
+		if err != nil {
+			return err
+		}
+		srcContent[i] = content
+	}
+	type candidate struct {
+		Dst   IndexPath
+		Src   *renameSource
+		Score int
+	}
+	var candidates []candidate
+	for _, d := range dsts {
+		content, err := diffContent(c, d.Name, d.Dst)
+		if err != nil {
+			return err
+		}
+		for i, src := range remaining {
+			small, large := len(srcContent[i]), len(content)
+			if small > large {
+				small, large = large, small
+			}
+			if large > 0 && small*100/large < threshold {
+				continue
+			}
+			if score := similarityIndex(srcContent[i], content); score >= threshold {
+				candidates = append(candidates, candidate{d.Name, src, score})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		if candidates[i].Dst != candidates[j].Dst {
+			return candidates[i].Dst < candidates[j].Dst
+		}
+		return candidates[i].Src.Name < candidates[j].Src.Name
+	})
+	for _, cand := range candidates {
+		if _, ok := matches[cand.Dst]; ok || cand.Src.renamed() {
+			continue
+		}
+		use(cand.Dst, cand.Src, cand.Score)
+	}
+	if !copies {
+		return nil
+	}
+	for _, cand := range candidates {
+		if _, ok := matches[cand.Dst]; ok {
+			continue
+		}
+		use(cand.Dst, cand.Src, cand.Score)
+	}
+	return nil
+}
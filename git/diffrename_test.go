@@ -0,0 +1,193 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDiffRenames(t *testing.T) {
+	var lines, rewritten []string
+	for i := 0; i < 100; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+		rewritten = append(rewritten, fmt.Sprintf("new line %d", i))
+	}
+	orig := strings.Join(lines[:20], "\n") + "\n"
+	rewrite := strings.Join(lines, "\n") + "\n"
+
+	c, dir := testMergeSetup(t,
+		map[string]string{"a": orig, "e": rewrite, "small": "small\n"},
+		map[string]string{"small": "changed\n"},
+		map[string]string{"other": "other\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	base, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a is renamed with one line changed, e is rewritten and its old
+	// content copied to e2.
+	if err := Rm(c, RmOptions{Quiet: true}, []File{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"a2": strings.Replace(orig, "line 5\n", "line five\n", 1),
+		"e":  strings.Join(rewritten, "\n") + "\n",
+		"e2": rewrite,
+	} {
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := Add(c, AddOptions{}, []File{"a2", "e", "e2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Commit(c, CommitOptions{}, CommitMessage("rename"), nil); err != nil {
+		t.Fatal(err)
+	}
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		opts DiffCommonOptions
+		want []string
+	}{
+		{
+			DiffCommonOptions{},
+			[]string{"D a", "A a2", "M e", "A e2"},
+		},
+		{
+			DiffCommonOptions{DetectRenames: true},
+			[]string{"R093 a a2", "M e", "A e2"},
+		},
+		{
+			DiffCommonOptions{DetectRenames: true, RenameThreshold: 96},
+			[]string{"D a", "A a2", "M e", "A e2"},
+		},
+		{
+			DiffCommonOptions{DetectCopies: true},
+			[]string{"R093 a a2", "M e", "C100 e e2"},
+		},
+		{
+			DiffCommonOptions{BreakRewrites: true},
+			[]string{"D a", "A a2", "M100 e", "A e2"},
+		},
+		{
+			DiffCommonOptions{BreakRewrites: true, DetectRenames: true},
+			[]string{"R093 a a2", "M100 e", "C100 e e2"},
+		},
+		{
+			DiffCommonOptions{FindCopiesHarder: true, RenameLimit: 1},
+			[]string{"D a", "A a2", "M e", "C100 e e2"},
+		},
+	}
+	for i, tc := range tests {
+		diffs, err := DiffTree(c, &DiffTreeOptions{DiffCommonOptions: tc.opts}, base, head, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, d := range diffs {
+			if d.Name == "small" {
+				continue
+			}
+			if d.SrcName != "" {
+				got = append(got, fmt.Sprintf("%v %v %v", d.StatusString(), d.SrcName, d.Name))
+			} else {
+				got = append(got, fmt.Sprintf("%v %v", d.StatusString(), d.Name))
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("Test %d: unexpected diff: got %v want %v", i, got, tc.want)
+		}
+	}
+}
+
+func TestDiffRenamesOncePerSource(t *testing.T) {
+	block := func(prefix string, n int) string {
+		var lines []string
+		for i := 0; i < n; i++ {
+			lines = append(lines, fmt.Sprintf("%v line %d\n", prefix, i))
+		}
+		return strings.Join(lines, "")
+	}
+	common, aOnly, dOnly := block("common", 10), block("a", 10), block("d", 10)
+	c, dir := testMergeSetup(t,
+		map[string]string{"a.txt": common + aOnly, "d.txt": common + dOnly, "e.txt": block("e", 20)},
+		map[string]string{"other": "ours\n"},
+		map[string]string{"other": "theirs\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	base, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// new.txt is more like a.txt than d.txt, but a.txt was moved, so it
+	// can only be a rename of d.txt. e.txt is renamed to e2.txt and
+	// copied to e1.txt with a change.
+	for _, name := range []File{"a.txt", "d.txt", "e.txt"} {
+		if err := Rm(c, RmOptions{Quiet: true}, []File{name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range map[string]string{
+		"moved.txt": strings.Replace(common+aOnly, "a line 5\n", "a line five\n", 1),
+		"new.txt":   common + block("a", 6) + block("d", 4),
+		"e1.txt":    strings.Replace(block("e", 20), "e line 5\n", "e line five\n", 1),
+		"e2.txt":    block("e", 20),
+	} {
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := Add(c, AddOptions{}, []File{"moved.txt", "new.txt", "e1.txt", "e2.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Commit(c, CommitOptions{}, CommitMessage("move"), nil); err != nil {
+		t.Fatal(err)
+	}
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		opts DiffCommonOptions
+		want []string
+	}{
+		{
+			DiffCommonOptions{DetectRenames: true},
+			[]string{"A e1.txt", "R100 e.txt e2.txt", "R094 a.txt moved.txt", "R076 d.txt new.txt"},
+		},
+		{
+			// The best match of a deleted file is the rename, and the
+			// others are copies.
+			DiffCommonOptions{DetectCopies: true},
+			[]string{"C093 e.txt e1.txt", "R100 e.txt e2.txt", "R094 a.txt moved.txt", "R076 d.txt new.txt"},
+		},
+	}
+	for i, tc := range tests {
+		diffs, err := DiffTree(c, &DiffTreeOptions{DiffCommonOptions: tc.opts}, base, head, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, d := range diffs {
+			if d.SrcName != "" {
+				got = append(got, fmt.Sprintf("%v %v %v", d.StatusString(), d.SrcName, d.Name))
+			} else {
+				got = append(got, fmt.Sprintf("%v %v", d.StatusString(), d.Name))
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("Test %d: unexpected diff: got %v want %v", i, got, tc.want)
+		}
+	}
+}
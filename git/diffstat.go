@@ -0,0 +1,425 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// diffStat is the number of lines added and removed from a file by a
+// HashDiff. For binary files, it's the size of the file before and after
+// instead.
+type diffStat struct {
+	Name           IndexPath
+	Added, Deleted uint
+	Binary         bool
+
+	// The name of the file that Name was renamed or copied from.
+	SrcName IndexPath
+}
+
+// DisplayName returns the name of the file for a diffstat, which shows
+// both names of a rename with the common parts factored out.
+func (s diffStat) DisplayName() string {
+	if s.SrcName == "" || s.SrcName == s.Name {
+		return s.Name.String()
+	}
+	return renameDisplayName(s.SrcName.String(), s.Name.String())
+}
+
+// renameDisplayName returns a rename from a to b in the same form as git,
+// such as "dir/{a => b}/file".
+func renameDisplayName(a, b string) string {
+	pfx := 0
+	for i := 0; i < len(a) && i < len(b) && a[i] == b[i]; i++ {
+		if a[i] == '/' {
+			pfx = i + 1
+		}
+	}
+
+	// The common suffix starts at a slash, and may overlap the slash
+	// at the end of the prefix.
+	at := func(s string, i int) byte {
+		if i == len(s) {
+			return 0
+		}
+		return s[i]
+	}
+	start := pfx
+	if pfx > 0 {
+		start--
+	}
+	sfx := 0
+	for i, j := len(a), len(b); start <= i && start <= j && at(a, i) == at(b, j); i, j = i-1, j-1 {
+		if at(a, i) == '/' {
+			sfx = len(a) - i
+		}
+	}
+
+	aMid, bMid := len(a)-pfx-sfx, len(b)-pfx-sfx
+	if aMid < 0 {
+		aMid = 0
+	}
+	if bMid < 0 {
+		bMid = 0
+	}
+	name := a[pfx:pfx+aMid] + " => " + b[pfx:pfx+bMid]
+	if pfx+sfx > 0 {
+		name = a[:pfx] + "{" + name + "}" + a[len(a)-sfx:]
+	}
+	return name
+}
+
+// diffContent returns the content of one side of a HashDiff. A zero sha
+// with a non-zero mode refers to the file in the work tree, the same as
+// for DiffFiles.
+func diffContent(c *Client, name IndexPath, e TreeEntry) ([]byte, error) {
+	if e.Sha1 != (Sha1{}) {
+		obj, err := c.GetObject(e.Sha1)
+		if err != nil {
+			return nil, err
+		}
+		return obj.GetContent(), nil
+	}
+	if e.FileMode == 0 {
+		return nil, nil
+	}
+	f, err := name.FilePath(c)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(f.String())
+}
+
+// diffStats counts the lines changed by each diff in diffs.
+func diffStats(c *Client, diffs []HashDiff) ([]diffStat, error) {
+	attrs, err := loadAttributes(c)
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]diffStat, 0, len(diffs))
+	for _, d := range diffs {
+		src, err := diffContent(c, d.SrcPath(), d.Src)
+		if err != nil {
+			return nil, err
+		}
+		dst, err := diffContent(c, d.Name, d.Dst)
+		if err != nil {
+			return nil, err
+		}
+		stat := diffStat{Name: d.Name, SrcName: d.SrcName}
+		binary, err := attrs.isBinaryDiff(d.Name, src, dst)
+		if err != nil {
+			return nil, err
+		}
+		if binary {
+			stat.Binary = true
+			stat.Deleted = uint(len(src))
+			stat.Added = uint(len(dst))
+			stats = append(stats, stat)
+			continue
+		}
+		for _, h := range xdiffLines(splitLines(src), splitLines(dst), nil, false) {
+			stat.Deleted += uint(h.AEnd - h.AStart)
+			stat.Added += uint(h.BEnd - h.BStart)
+		}
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+// writeDiffStat writes stats in the format of git's --stat, with a graph
+// scaled to fit into width columns, followed by a summary line. The names
+// and graph are limited to nameWidth and graphWidth columns, and only the
+// first count files are listed, unless they're 0.
+func writeDiffStat(w io.Writer, stats []diffStat, width, nameWidth, graphWidth, count int) {
+	if width <= 0 {
+		width = 80
+	}
+	shown := stats
+	if count > 0 && count < len(stats) {
+		shown = stats[:count]
+	}
+
+	var maxLen, binWidth, numberWidth int
+	var maxChange uint
+	for _, s := range shown {
+		if l := len(s.DisplayName()); l > maxLen {
+			maxLen = l
+		}
+		if s.Binary {
+			if l := len(fmt.Sprintf("Bin %d -> %d bytes", s.Deleted, s.Added)); l > binWidth {
+				binWidth = l
+			}
+			numberWidth = 3
+			continue
+		}
+		if s.Added+s.Deleted > maxChange {
+			maxChange = s.Added + s.Deleted
+		}
+	}
+	if l := len(fmt.Sprint(maxChange)); l > numberWidth {
+		numberWidth = l
+	}
+	if width < 16+6+numberWidth {
+		width = 16 + 6 + numberWidth
+	}
+
+	maxGraphWidth := graphWidth
+	graphWidth = int(maxChange)
+	if int(maxChange)+4 <= binWidth {
+		graphWidth = binWidth - 4
+	}
+	if maxGraphWidth > 0 && maxGraphWidth < graphWidth {
+		graphWidth = maxGraphWidth
+	}
+	if nameWidth <= 0 || nameWidth > maxLen {
+		nameWidth = maxLen
+	}
+	if nameWidth+numberWidth+6+graphWidth > width {
+		if graphWidth > width*3/8-numberWidth-6 {
+			graphWidth = width*3/8 - numberWidth - 6
+			if graphWidth < 6 {
+				graphWidth = 6
+			}
+		}
+		if maxGraphWidth > 0 && graphWidth > maxGraphWidth {
+			graphWidth = maxGraphWidth
+		}
+		if nameWidth > width-numberWidth-6-graphWidth {
+			nameWidth = width - numberWidth - 6 - graphWidth
+		} else {
+			graphWidth = width - numberWidth - 6 - nameWidth
+		}
+	}
+
+	// scale scales n changes to the width of the graph, the same way as
+	// git, so that any change gets at least one column.
+	scale := func(n uint) int {
+		if n == 0 {
+			return 0
+		}
+		return 1 + int(n)*(graphWidth-1)/int(maxChange)
+	}
+
+	for _, s := range shown {
+		name := s.DisplayName()
+		prefix := ""
+		l := nameWidth
+		if nameWidth < len(name) {
+			prefix = "..."
+			l -= 3
+			name = name[len(name)-l:]
+			if slash := strings.IndexByte(name, '/'); slash >= 0 {
+				name = name[slash:]
+			}
+		}
+		if s.Binary {
+			fmt.Fprintf(w, " %s%-*s | %*s", prefix, l, name, numberWidth, "Bin")
+			if s.Added != 0 || s.Deleted != 0 {
+				fmt.Fprintf(w, " %d -> %d bytes", s.Deleted, s.Added)
+			}
+			fmt.Fprintln(w)
+			continue
+		}
+
+		add, del := int(s.Added), int(s.Deleted)
+		if graphWidth <= int(maxChange) {
+			total := scale(s.Added + s.Deleted)
+			if total < 2 && s.Added != 0 && s.Deleted != 0 {
+				total = 2
+			}
+			if s.Added < s.Deleted {
+				add = scale(s.Added)
+				del = total - add
+			} else {
+				del = scale(s.Deleted)
+				add = total - del
+			}
+		}
+		fmt.Fprintf(w, " %s%-*s | %*d", prefix, l, name, numberWidth, s.Added+s.Deleted)
+		if s.Added+s.Deleted != 0 {
+			fmt.Fprint(w, " ")
+		}
+		fmt.Fprintf(w, "%s%s\n", strings.Repeat("+", add), strings.Repeat("-", del))
+	}
+	if len(shown) < len(stats) {
+		fmt.Fprintln(w, " ...")
+	}
+	writeShortStat(w, stats)
+}
+
+// writeShortStat writes the summary line of the diffstat for stats, the
+// same as git's --shortstat.
+func writeShortStat(w io.Writer, stats []diffStat) {
+	var insertions, deletions uint
+	for _, s := range stats {
+		if !s.Binary {
+			insertions += s.Added
+			deletions += s.Deleted
+		}
+	}
+	writeDiffStatSummary(w, len(stats), insertions, deletions)
+}
+
+// writeNumStat writes stats in the format of git's --numstat. Binary files
+// are shown with a "-" instead of the number of lines, and the names of
+// renames are NUL separated if nul is set.
+func writeNumStat(w io.Writer, stats []diffStat, nul bool) {
+	for _, s := range stats {
+		if s.Binary {
+			fmt.Fprint(w, "-\t-\t")
+		} else {
+			fmt.Fprintf(w, "%d\t%d\t", s.Added, s.Deleted)
+		}
+		switch {
+		case nul && s.SrcName != "":
+			fmt.Fprintf(w, "\x00%v\x00%v\x00", s.SrcName, s.Name)
+		case nul:
+			fmt.Fprintf(w, "%v\x00", s.Name)
+		default:
+			fmt.Fprintf(w, "%v\n", s.DisplayName())
+		}
+	}
+}
+
+// dirStatFile is the amount that a file was changed for --dirstat.
+type dirStatFile struct {
+	Name    string
+	Changed uint
+}
+
+// writeDirStat writes the percentage of changes in diffs made to each
+// directory, in the format of git's --dirstat. params is a comma separated
+// list of the way to count changes (changes, lines or files), whether the
+// changes in subdirectories are counted in their parents (cumulative or
+// noncumulative), and the minimum percentage to show.
+func writeDirStat(c *Client, w io.Writer, diffs []HashDiff, stats []diffStat, params string) error {
+	mode := "changes"
+	cumulative := false
+	permille := uint(30)
+	for _, p := range strings.Split(params, ",") {
+		switch p {
+		case "":
+		case "changes", "lines", "files":
+			mode = p
+		case "cumulative":
+			cumulative = true
+		case "noncumulative":
+			cumulative = false
+		default:
+			// A percentage, with at most one decimal place.
+			whole, frac := p, ""
+			if dot := strings.IndexByte(p, '.'); dot >= 0 {
+				whole, frac = p[:dot], p[dot+1:]
+			}
+			n, err := strconv.ParseUint(whole, 10, 32)
+			if err != nil || strings.Trim(frac, "0123456789") != "" {
+				return fmt.Errorf("Failed to parse --dirstat/-X option parameter:\n  Unknown dirstat parameter '%v'", p)
+			}
+			permille = uint(n) * 10
+			if frac != "" {
+				permille += uint(frac[0] - '0')
+			}
+		}
+	}
+
+	var files []dirStatFile
+	var changed uint
+	for i, d := range diffs {
+		var damage uint
+		switch {
+		case mode == "lines":
+			damage = stats[i].Added + stats[i].Deleted
+			if stats[i].Binary {
+				damage = (damage + 63) / 64
+			}
+		case d.Src.Sha1 == d.Dst.Sha1 && d.Src.Sha1 != (Sha1{}):
+			// A pure rename or mode change doesn't change the content.
+		case mode == "files":
+			damage = 1
+		default:
+			src, err := diffContent(c, d.SrcPath(), d.Src)
+			if err != nil {
+				return err
+			}
+			dst, err := diffContent(c, d.Name, d.Dst)
+			if err != nil {
+				return err
+			}
+			// Like git, the damage is what was removed from src and
+			// what was added to make dst.
+			copied, added := countChanges(src, dst)
+			damage = uint(len(src) - copied + added)
+			if damage == 0 {
+				damage = 1
+			}
+		}
+		files = append(files, dirStatFile{d.Name.String(), damage})
+		changed += damage
+	}
+	if changed == 0 {
+		return nil
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	gatherDirStat(w, &files, changed, "", permille, cumulative)
+	return nil
+}
+
+// gatherDirStat writes the dirstat for the directory base, consuming the
+// files in it from the front of files, and returns the amount of changes
+// in the directory. Like git, the top level directory and directories with
+// changes in only a single subdirectory aren't shown.
+func gatherDirStat(w io.Writer, files *[]dirStatFile, changed uint, base string, permille uint, cumulative bool) uint {
+	var sum uint
+	sources := 0
+	for len(*files) > 0 {
+		f := (*files)[0]
+		if !strings.HasPrefix(f.Name, base) {
+			break
+		}
+		if slash := strings.IndexByte(f.Name[len(base):], '/'); slash >= 0 {
+			sum += gatherDirStat(w, files, changed, f.Name[:len(base)+slash+1], permille, cumulative)
+			sources++
+		} else {
+			sum += f.Changed
+			*files = (*files)[1:]
+			sources += 2
+		}
+	}
+	if base == "" || sources == 1 || sum == 0 {
+		return sum
+	}
+	if p := sum * 1000 / changed; p >= permille {
+		fmt.Fprintf(w, "%4d.%01d%% %s\n", p/10, p%10, base)
+		if !cumulative {
+			return 0
+		}
+	}
+	return sum
+}
+
+// writeDiffStatSummary writes the summary line at the end of a diffstat.
+func writeDiffStatSummary(w io.Writer, files int, insertions, deletions uint) {
+	plural := func(n uint, s string) string {
+		if n == 1 {
+			return s
+		}
+		return s + "s"
+	}
+	if files == 0 {
+		fmt.Fprintln(w, " 0 files changed")
+		return
+	}
+	fmt.Fprintf(w, " %d %s changed", files, plural(uint(files), "file"))
+	if insertions != 0 || deletions == 0 {
+		fmt.Fprintf(w, ", %d %s(+)", insertions, plural(insertions, "insertion"))
+	}
+	if deletions != 0 || insertions == 0 {
+		fmt.Fprintf(w, ", %d %s(-)", deletions, plural(deletions, "deletion"))
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,198 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenameDisplayName(t *testing.T) {
+	tests := []struct {
+		a, b, want string
+	}{
+		{"a", "a2", "a => a2"},
+		{"dir/a", "dir/b", "dir/{a => b}"},
+		{"a/file", "b/file", "{a => b}/file"},
+		{"src/x/f.go", "src/y/f.go", "src/{x => y}/f.go"},
+		{"top", "src/y/top", "top => src/y/top"},
+	}
+	for _, tc := range tests {
+		if got := renameDisplayName(tc.a, tc.b); got != tc.want {
+			t.Errorf("renameDisplayName(%q, %q): got %q want %q", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestDiffFormats(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"top": "1\n2\n3\n"},
+		map[string]string{"top": "1\n2\n3\n4\n"},
+		map[string]string{"other": "other\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	base, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll("src/lib", 0755); err != nil {
+		t.Fatal(err)
+	}
+	var files []File
+	for name, content := range map[string]string{
+		"src/lib/a": strings.Repeat("a\n", 10),
+		"src/lib/b": strings.Repeat("b\n", 10),
+		"doc":       strings.Repeat("doc\n", 20),
+	} {
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, File(name))
+	}
+	if _, err := Add(c, AddOptions{}, files); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Commit(c, CommitOptions{}, CommitMessage("more"), nil); err != nil {
+		t.Fatal(err)
+	}
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffs, err := DiffTree(c, &DiffTreeOptions{Recurse: true}, base, head, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		opts DiffCommonOptions
+		want string
+	}{
+		{
+			DiffCommonOptions{NumStat: true},
+			"20\t0\tdoc\n10\t0\tsrc/lib/a\n10\t0\tsrc/lib/b\n",
+		},
+		{
+			DiffCommonOptions{NameStatus: true, NullTerminate: true, Raw: true},
+			"A\x00doc\x00A\x00src/lib/a\x00A\x00src/lib/b\x00",
+		},
+		{
+			DiffCommonOptions{NameOnly: true},
+			"doc\nsrc/lib/a\nsrc/lib/b\n",
+		},
+		{
+			DiffCommonOptions{Raw: true, Abbrev: 7},
+			":000000 100644 0000000 1cd72ce A\tdoc\n:000000 100644 0000000 d15112c A\tsrc/lib/a\n:000000 100644 0000000 ebb8ab7 A\tsrc/lib/b\n",
+		},
+		{
+			DiffCommonOptions{ShortStat: true},
+			" 3 files changed, 40 insertions(+)\n",
+		},
+		{
+			DiffCommonOptions{Stat: true, StatCount: 1},
+			" doc | 20 ++++++++++++++++++++\n ...\n 3 files changed, 40 insertions(+)\n",
+		},
+		{
+			DiffCommonOptions{DirStat: true, DirStatParams: "files,cumulative"},
+			"  66.6% src/lib/\n",
+		},
+		{
+			DiffCommonOptions{DirStat: true, DirStatParams: "lines,60"},
+			"",
+		},
+	}
+	for i, tc := range tests {
+		var buf bytes.Buffer
+		if err := GeneratePatch(c, tc.opts, diffs, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("Test %d: unexpected output: got %q want %q", i, got, tc.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := GeneratePatch(c, DiffCommonOptions{DirStat: true, DirStatParams: "bogus"}, diffs, &buf); err == nil {
+		t.Error("Expected an invalid dirstat parameter to fail")
+	}
+}
+
+func TestDirStatDamage(t *testing.T) {
+	long := func(changed int) string {
+		var lines []string
+		for i := 0; i < 4; i++ {
+			last := "x"
+			if i == changed {
+				last = "y"
+			}
+			lines = append(lines, fmt.Sprintf("%02d%v%v\n", i, strings.Repeat("x", 96), last))
+		}
+		return strings.Join(lines, "")
+	}
+	notes := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	c, dir := testMergeSetup(t,
+		map[string]string{"top": "top\n"},
+		map[string]string{"top": "ours\n"},
+		map[string]string{"other": "other\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	commit := func(files map[string]string) CommitID {
+		t.Helper()
+		var names []File
+		for name, content := range files {
+			if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, File(name))
+		}
+		if _, err := Add(c, AddOptions{}, names); err != nil {
+			t.Fatal(err)
+		}
+		cmt, err := Commit(c, CommitOptions{}, "commit", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cmt
+	}
+	base := commit(map[string]string{"src/long": long(-1), "doc/notes": notes})
+	head := commit(map[string]string{"src/long": long(1), "doc/notes": strings.Replace(notes, "5\n", "five\n", 1)})
+
+	tests := []struct {
+		opts DiffCommonOptions
+		want string
+	}{
+		// Like git, only the 36 byte span at the end of the long line
+		// is changed, rather than the whole line.
+		{
+			DiffCommonOptions{DirStat: true, DirStatParams: "0"},
+			"   8.8% doc/\n  91.1% src/\n",
+		},
+		{
+			DiffCommonOptions{ShortStat: true},
+			" 2 files changed, 2 insertions(+), 2 deletions(-)\n",
+		},
+	}
+	for i, tc := range tests {
+		// The stat formats look at the files in the trees, even without
+		// recursing.
+		diffs, err := DiffTree(c, &DiffTreeOptions{DiffCommonOptions: tc.opts}, base, head, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := GeneratePatch(c, tc.opts, diffs, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("Test %d: unexpected output: got %q want %q", i, got, tc.want)
+		}
+	}
+}
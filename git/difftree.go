@@ -2,7 +2,6 @@ package git
 
 import (
 	"fmt"
-	"regexp"
 	"sort"
 )
 
@@ -10,12 +9,7 @@ import (
 // "git diff-index". Note that only raw mode is currently supported, even
 // though all the other options are parsed/set in this struct.
 type DiffTreeOptions struct {
-	Patch bool
-
-	// The 0 value implies 3.
-	NumContextLines int
-
-	Raw bool
+	DiffCommonOptions
 
 	// Unimplemented. Probably never will be.
 	CompactionHeuristic bool
@@ -23,42 +17,17 @@ type DiffTreeOptions struct {
 	// Can be "default", "myers", "minimal", "patience", or "histogram"
 	DiffAlgorithm string
 
-	StatWidth, StatNameWidth, StatCount int
-	NumStat                             bool
-	ShortStat                           bool
-
-	DirStat string
-
 	Summary bool
 
-	NullTerminate bool
-
-	NameOnly, NameStatus bool
-
 	Submodule string
 
-	// Colour can have three states: "always" (true), "never" (false), or "auto" (nil)
-	Color *bool
-
-	// "color", "plain", "porcelain", or "none"
-	WordDiff string
-
-	WordDiffRegex *regexp.Regexp
-
 	NoRenames bool
 
 	// Warn if changes introduce conflict markers or whitespace errors.
 	Check bool
 
-	// Valid options in the []string are "old", "new", or "context"
-	WhitespaceErrorHighlight []string
-
-	FullIndex, Binary bool
-
-	// Number of characters to abbreviate the hexadecimal object name to.
-	Abbrev int
-
-	// Recurse into subtrees.
+	// Recurse into subtrees. Unlike git's -r, this doesn't show the
+	// subtrees themselves.
 	Recurse bool
 
 	// Diff the initial commit against the empty tree
@@ -82,7 +51,7 @@ func DiffTree(c *Client, opt *DiffTreeOptions, tree1, tree2 Treeish, paths []str
 		}
 		t2 = t
 	} else {
-		// No tree, use tree 1's parent
+		// No tree, so compare tree 1's parent to it.
 		if c1, ok := tree1.(Commitish); ok {
 			c1a, err := c1.CommitID(c)
 			if err != nil {
@@ -110,24 +79,51 @@ func DiffTree(c *Client, opt *DiffTreeOptions, tree1, tree2 Treeish, paths []str
 		} else {
 			return nil, fmt.Errorf("Can not determine parent of tree")
 		}
+		t1, t2 = t2, t1
 	}
 
-	tree1Objects, err := t1.GetAllObjects(c, "", opt.Recurse, opt.Recurse)
+	files := make([]File, len(paths))
+	for i, p := range paths {
+		files[i] = File(p)
+	}
+	spec, err := newPathspec(c, files)
 	if err != nil {
 		return nil, err
 	}
-	if opt.Root && t2 == (TreeID{}) {
+
+	// Like git, the formats which look at the content of the files
+	// imply -r, since trees have none.
+	recurse := opt.Recurse || opt.Patch || opt.Stat || opt.NumStat || opt.ShortStat || opt.DirStat || opt.Check
+
+	// When recursing, only the files in the trees are compared.
+	getObjects := func(t TreeID) (map[IndexPath]TreeEntry, error) {
+		objects, err := t.GetAllObjects(c, "", recurse, recurse)
+		if err != nil {
+			return nil, err
+		}
+		for name, e := range objects {
+			if (recurse && e.FileMode == ModeTree) || !spec.Matches(name, e.FileMode == ModeTree) {
+				delete(objects, name)
+			}
+		}
+		return objects, nil
+	}
+	tree2Objects, err := getObjects(t2)
+	if err != nil {
+		return nil, err
+	}
+	if opt.Root && t1 == (TreeID{}) {
 		// There is no parent to check against and we --root was
-		// passed, so just include everything from tree1
-		var val []HashDiff = make([]HashDiff, 0, len(tree1Objects))
-		for name, sha := range tree1Objects {
-			val = append(val, HashDiff{name, TreeEntry{}, sha, 0, 0})
+		// passed, so just include everything from the commit
+		var val []HashDiff = make([]HashDiff, 0, len(tree2Objects))
+		for name, sha := range tree2Objects {
+			val = append(val, HashDiff{Name: name, Src: TreeEntry{}, Dst: sha})
 		}
 		sort.Sort(ByName(val))
 
-		return val, nil
+		return diffPickaxe(c, opt.DiffCommonOptions, val)
 	}
-	tree2Objects, err := t2.GetAllObjects(c, "", opt.Recurse, opt.Recurse)
+	tree1Objects, err := getObjects(t1)
 	if err != nil {
 		return nil, err
 	}
@@ -136,7 +132,7 @@ func DiffTree(c *Client, opt *DiffTreeOptions, tree1, tree2 Treeish, paths []str
 
 	for name, sha := range tree1Objects {
 		if osha := tree2Objects[name]; sha != osha {
-			val = append(val, HashDiff{name, sha, osha, 0, 0})
+			val = append(val, HashDiff{Name: name, Src: sha, Dst: osha})
 		}
 	}
 
@@ -144,11 +140,15 @@ func DiffTree(c *Client, opt *DiffTreeOptions, tree1, tree2 Treeish, paths []str
 	// would have gotten caught by the above ranging.
 	for name, sha := range tree2Objects {
 		if _, ok := tree1Objects[name]; !ok {
-			val = append(val, HashDiff{name, TreeEntry{Sha1{}, 0}, sha, 0, 0})
+			val = append(val, HashDiff{Name: name, Src: TreeEntry{Sha1{}, 0}, Dst: sha})
 		}
 	}
 
 	sort.Sort(ByName(val))
 
-	return val, nil
+	val, err = diffRenames(c, opt.DiffCommonOptions, val, tree1Objects)
+	if err != nil {
+		return nil, err
+	}
+	return diffPickaxe(c, opt.DiffCommonOptions, val)
 }
@@ -52,9 +52,9 @@ func Fetch(c *Client, opts FetchOptions, rmt Remote, refs []RefSpec) error {
 			for _, spec := range refs {
 				if match, dst := ref.MatchesRefSpecSrc(spec); match {
 					if !dst.Exists(c) {
-						fmt.Printf("[new branch] %v", dst)
+						fmt.Printf("[new branch] %v\n", dst)
 					} else {
-						fmt.Printf("%v %v", ref.Value, dst)
+						fmt.Printf("%v %v\n", ref.Value, dst)
 					}
 					err := UpdateRef(
 						c,
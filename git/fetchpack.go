@@ -14,7 +14,8 @@ type Refname string
 
 // returns true if the reference name exists under the client's GitDir.
 func (rn Refname) Exists(c *Client) bool {
-	return c.GitDir.File(File(rn)).Exists()
+	_, err := c.Refs().ReadRef(rn.String())
+	return err == nil
 }
 
 func (rn Refname) String() string {
@@ -176,7 +177,9 @@ func fetchPackDone(c *Client, opts FetchPackOptions, conn RemoteConn, wants []Re
 			}
 		}
 		if !wanted {
-			return nil, fmt.Errorf("Already up to date.")
+			// Nothing wanted, but the refs may still need to be
+			// updated if they're fetched to a new destination.
+			return refs, nil
 		}
 		for ref := range haves {
 			fmt.Fprintf(conn, "have %v\n", ref)
@@ -203,7 +206,13 @@ func fetchPackDone(c *Client, opts FetchPackOptions, conn RemoteConn, wants []Re
 		// protocol v1
 		log.Printf("Using protocol was %d: using version 1 for fetch-pack\n", v)
 		sideband := false
-		rmtrefs, err := conn.GetRefs(LsRemoteOptions{Heads: true, Tags: true, RefsOnly: true}, rs)
+		// Explicitly requested refs, such as refs/notes/*, may be
+		// neither heads nor tags.
+		lsopts := LsRemoteOptions{RefsOnly: true}
+		if len(rs) == 0 {
+			lsopts.Heads, lsopts.Tags = true, true
+		}
+		rmtrefs, err := conn.GetRefs(lsopts, rs)
 		if err != nil {
 			return nil, err
 		}
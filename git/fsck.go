@@ -195,15 +195,9 @@ func verifyHead(c *Client, stderr io.Writer, opts FsckOptions) error {
 		fmt.Fprintln(stderr, "Checking HEAD link")
 	}
 
-	hfile := c.GitDir.File("HEAD")
-	if !hfile.Exists() {
-		return fmt.Errorf("Missing head link")
-	}
-
-	line, err := hfile.ReadFirstLine()
+	line, err := c.Refs().ReadRef("HEAD")
 	if err != nil {
-		// this shouldn't happen since we already verified it exists
-		return err
+		return fmt.Errorf("Missing head link")
 	}
 
 	sha1, err := Sha1FromString(line)
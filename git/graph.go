@@ -0,0 +1,751 @@
+package git
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// The states a Graph goes through while drawing the lines for a commit.
+type graphState int
+
+const (
+	// Padding lines leave the branch lines unchanged, once all of the
+	// lines for the commit have been drawn.
+	graphPadding graphState = iota
+	// A skip line of "..." shows that some of the history is missing.
+	graphSkip
+	// Pre-commit lines make room for the parents of an octopus merge.
+	graphPreCommit
+	// The commit line, with the commit's mark.
+	graphCommit
+	// The line after a merge, which branches out to its parents.
+	graphPostMerge
+	// The lines which move the branch lines to where they belong
+	// for the next commit.
+	graphCollapsing
+)
+
+// The default colours of the branch lines, which are used in turn.
+var defaultGraphColors = []string{
+	"\x1b[31m", "\x1b[32m", "\x1b[33m", "\x1b[34m", "\x1b[35m", "\x1b[36m",
+	"\x1b[1;31m", "\x1b[1;32m", "\x1b[1;33m", "\x1b[1;34m", "\x1b[1;35m", "\x1b[1;36m",
+}
+
+// A graphColumn is a branch line in a Graph, which leads to the commit.
+// color is its index in the Graph's colors, or len(colors) if it isn't
+// coloured.
+type graphColumn struct {
+	commit CommitID
+	color  int
+}
+
+// A graphLine is a line of a Graph being drawn. width is the number of
+// characters in it, leaving out the colours.
+type graphLine struct {
+	buf   strings.Builder
+	width int
+}
+
+func (l *graphLine) addChars(c byte, n int) {
+	for i := 0; i < n; i++ {
+		l.buf.WriteByte(c)
+	}
+	l.width += n
+}
+
+func (l *graphLine) addString(s string) {
+	l.buf.WriteString(s)
+	l.width += len(s)
+}
+
+// A Graph draws the history of the commits shown by log --graph as ASCII
+// art to the left of them. It's a port of git's graph.c, so that it looks
+// the same.
+//
+// Update must be called for each commit in topological order, with the
+// parents of it that are shown, before drawing its lines.
+type Graph struct {
+	commit     CommitID
+	hasCommit  bool
+	parents    []CommitID
+	width      int
+	expansion  int
+	state      graphState
+	prevState  graphState
+	commitIdx  int
+	prevCommit int
+
+	// Where the first parent of a merge goes relative to the merge, and
+	// how many more columns the merge adds.
+	mergeLayout    int
+	edgesAdded     int
+	prevEdgesAdded int
+
+	// The branch lines before and after the current commit, and which
+	// column each character of the line maps to.
+	columns, newColumns []graphColumn
+	mapping, oldMapping []int
+	mappingSize         int
+
+	colors       []string
+	defaultColor int
+}
+
+// NewGraph returns a Graph for drawing the history, which is coloured if
+// color is set. The colours of the branch lines can be changed with the
+// log.graphColors config.
+func NewGraph(c *Client, color bool) (*Graph, error) {
+	g := &Graph{}
+	if color {
+		g.colors = defaultGraphColors
+		if spec := c.GetConfig("log.graphcolors"); spec != "" {
+			var colors []string
+			for _, s := range strings.Split(spec, ",") {
+				col, err := parseColor(strings.TrimSpace(s))
+				if err != nil {
+					return nil, err
+				}
+				if col != "" {
+					colors = append(colors, col)
+				}
+			}
+			if len(colors) > 0 {
+				g.colors = colors
+			}
+		}
+	}
+	// The first commit gets the first colour when it's incremented.
+	g.defaultColor = len(g.colors) - 1
+	return g, nil
+}
+
+func (g *Graph) currentColor() int {
+	if len(g.colors) == 0 {
+		return 0
+	}
+	return g.defaultColor
+}
+
+func (g *Graph) incrementColor() {
+	if len(g.colors) > 0 {
+		g.defaultColor = (g.defaultColor + 1) % len(g.colors)
+	}
+}
+
+func (g *Graph) findCommitColor(cmt CommitID) int {
+	for _, col := range g.columns {
+		if col.commit == cmt {
+			return col.color
+		}
+	}
+	return g.currentColor()
+}
+
+func (g *Graph) writeColumn(l *graphLine, col graphColumn, c byte) {
+	colored := col.color < len(g.colors)
+	if colored {
+		l.buf.WriteString(g.colors[col.color])
+	}
+	l.addChars(c, 1)
+	if colored {
+		l.buf.WriteString(colorReset)
+	}
+}
+
+func (g *Graph) findNewColumn(cmt CommitID) int {
+	for i, col := range g.newColumns {
+		if col.commit == cmt {
+			return i
+		}
+	}
+	return -1
+}
+
+func (g *Graph) insertIntoNewColumns(cmt CommitID, idx int) {
+	i := g.findNewColumn(cmt)
+	if i < 0 {
+		i = len(g.newColumns)
+		g.newColumns = append(g.newColumns, graphColumn{cmt, g.findCommitColor(cmt)})
+	}
+
+	var mappingIdx int
+	if len(g.parents) > 1 && idx > -1 && g.mergeLayout == -1 {
+		// This is the first parent of a merge, so the layout of the
+		// merge depends on whether the parent is in a column to the
+		// left of it.
+		dist := idx - i
+		shift := 1
+		if dist > 1 {
+			shift = 2*dist - 3
+		}
+		if dist > 0 {
+			g.mergeLayout = 0
+		} else {
+			g.mergeLayout = 1
+		}
+		g.edgesAdded = len(g.parents) + g.mergeLayout - 2
+		mappingIdx = g.width + (g.mergeLayout-1)*shift
+		g.width += 2 * g.mergeLayout
+	} else if g.edgesAdded > 0 && g.width >= 2 && i == g.mapping[g.width-2] {
+		// The merge added columns, but this commit was found in the
+		// last existing column, so the edges join up straight away.
+		mappingIdx = g.width - 2
+		g.edgesAdded = -1
+	} else {
+		mappingIdx = g.width
+		g.width += 2
+	}
+	g.mapping[mappingIdx] = i
+}
+
+func (g *Graph) updateColumns() {
+	// The new columns of the last commit are the columns for this one,
+	// and the new columns for the next commit are worked out below.
+	g.columns, g.newColumns = g.newColumns, g.columns[:0]
+
+	maxColumns := len(g.columns) + len(g.parents)
+	if len(g.mapping) < 2*maxColumns {
+		grow := func(m []int) []int {
+			grown := make([]int, 2*maxColumns)
+			copy(grown, m)
+			return grown
+		}
+		g.mapping, g.oldMapping = grow(g.mapping), grow(g.oldMapping)
+	}
+	g.mappingSize = 2 * maxColumns
+	for i := 0; i < g.mappingSize; i++ {
+		g.mapping[i] = -1
+	}
+
+	g.width = 0
+	g.prevEdgesAdded = g.edgesAdded
+	g.edgesAdded = 0
+
+	// Each of the commits that the branch lines lead to only gets one
+	// of the new columns, and mapping says where each line ends up.
+	seen, inColumns := false, true
+	for i := 0; i <= len(g.columns); i++ {
+		var cmt CommitID
+		if i == len(g.columns) {
+			if seen {
+				break
+			}
+			inColumns = false
+			cmt = g.commit
+		} else {
+			cmt = g.columns[i].commit
+		}
+
+		if cmt != g.commit {
+			g.insertIntoNewColumns(cmt, -1)
+			continue
+		}
+		seen = true
+		g.commitIdx = i
+		g.mergeLayout = -1
+		for _, p := range g.parents {
+			// Merges and the start of new branch lines get the
+			// next colour.
+			if len(g.parents) > 1 || !inColumns {
+				g.incrementColor()
+			}
+			g.insertIntoNewColumns(p, i)
+		}
+		// The commit always takes up at least 2 characters.
+		if len(g.parents) == 0 {
+			g.width += 2
+		}
+	}
+
+	for g.mappingSize > 1 && g.mapping[g.mappingSize-1] < 0 {
+		g.mappingSize--
+	}
+}
+
+func (g *Graph) numDashedParents() int {
+	return len(g.parents) + g.mergeLayout - 3
+}
+
+func (g *Graph) numExpansionRows() int {
+	return g.numDashedParents() * 2
+}
+
+func (g *Graph) needsPreCommitLine() bool {
+	return len(g.parents) >= 3 && g.commitIdx < len(g.columns)-1 && g.expansion < g.numExpansionRows()
+}
+
+// Update moves the graph on to cmt, whose parents are the ones which are
+// shown, after the lines for the previous commit have been drawn.
+func (g *Graph) Update(cmt CommitID, parents []CommitID) {
+	g.commit, g.hasCommit = cmt, true
+	g.parents = parents
+	g.prevCommit = g.commitIdx
+	g.updateColumns()
+	g.expansion = 0
+
+	// If the previous commit didn't finish drawing its lines, some of
+	// the graph is skipped.
+	switch {
+	case g.state != graphPadding:
+		g.state = graphSkip
+	case g.needsPreCommitLine():
+		g.state = graphPreCommit
+	default:
+		g.state = graphCommit
+	}
+}
+
+func (g *Graph) updateState(s graphState) {
+	g.prevState = g.state
+	g.state = s
+}
+
+// isMappingCorrect returns whether each branch line is where it belongs,
+// or one to the right of it, which draws a / that gets it there.
+func (g *Graph) isMappingCorrect() bool {
+	for i := 0; i < g.mappingSize; i++ {
+		if target := g.mapping[i]; target >= 0 && target != i/2 {
+			return false
+		}
+	}
+	return true
+}
+
+// padHorizontally pads l with spaces, so that everything to the right of
+// the graph lines up.
+func (g *Graph) padHorizontally(l *graphLine) {
+	if l.width < g.width {
+		l.addChars(' ', g.width-l.width)
+	}
+}
+
+func (g *Graph) outputPaddingLine(l *graphLine) {
+	for _, col := range g.newColumns {
+		g.writeColumn(l, col, '|')
+		l.addChars(' ', 1)
+	}
+}
+
+func (g *Graph) outputSkipLine(l *graphLine) {
+	l.addString("...")
+	if g.needsPreCommitLine() {
+		g.updateState(graphPreCommit)
+	} else {
+		g.updateState(graphCommit)
+	}
+}
+
+func (g *Graph) outputPreCommitLine(l *graphLine) {
+	// Two rows are needed for each parent of an octopus merge after the
+	// second to make room for it.
+	seen := false
+	for i, col := range g.columns {
+		switch {
+		case col.commit == g.commit:
+			seen = true
+			g.writeColumn(l, col, '|')
+			l.addChars(' ', g.expansion)
+		case seen && g.expansion == 0:
+			// The lines after a merge on the previous line
+			// carry on as \ rather than |.
+			if g.prevState == graphPostMerge && g.prevCommit < i {
+				g.writeColumn(l, col, '\\')
+			} else {
+				g.writeColumn(l, col, '|')
+			}
+		case seen && g.expansion > 0:
+			g.writeColumn(l, col, '\\')
+		default:
+			g.writeColumn(l, col, '|')
+		}
+		l.addChars(' ', 1)
+	}
+
+	g.expansion++
+	if !g.needsPreCommitLine() {
+		g.updateState(graphCommit)
+	}
+}
+
+// drawOctopusMerge draws the dashes to the parents of an octopus merge,
+// in the colours of the columns they lead to.
+func (g *Graph) drawOctopusMerge(l *graphLine) {
+	dashed := g.numDashedParents()
+	for i := 0; i < dashed; i++ {
+		col := g.newColumns[g.mapping[(g.commitIdx+i+2)*2]]
+		g.writeColumn(l, col, '-')
+		if i == dashed-1 {
+			g.writeColumn(l, col, '.')
+		} else {
+			g.writeColumn(l, col, '-')
+		}
+	}
+}
+
+func (g *Graph) outputCommitLine(l *graphLine) {
+	// The commit may not be in any of the columns if none of its
+	// children were shown, so it goes after them.
+	seen := false
+	for i := 0; i <= len(g.columns); i++ {
+		var col graphColumn
+		if i == len(g.columns) {
+			if seen {
+				break
+			}
+			col.commit = g.commit
+		} else {
+			col = g.columns[i]
+		}
+
+		switch {
+		case col.commit == g.commit:
+			seen = true
+			l.addString("*")
+			if len(g.parents) > 2 {
+				g.drawOctopusMerge(l)
+			}
+		case seen && g.edgesAdded > 1:
+			g.writeColumn(l, col, '\\')
+		case seen && g.edgesAdded == 1:
+			// A right-skewed merge is drawn straight away, so the
+			// lines to the right of a merge on the previous line
+			// carry on as \.
+			if g.prevState == graphPostMerge && g.prevEdgesAdded > 0 && g.prevCommit < i {
+				g.writeColumn(l, col, '\\')
+			} else {
+				g.writeColumn(l, col, '|')
+			}
+		case g.prevState == graphCollapsing && g.oldMapping[2*i+1] == i && g.mapping[2*i] < i:
+			g.writeColumn(l, col, '/')
+		default:
+			g.writeColumn(l, col, '|')
+		}
+		l.addChars(' ', 1)
+	}
+
+	switch {
+	case len(g.parents) > 1:
+		g.updateState(graphPostMerge)
+	case g.isMappingCorrect():
+		g.updateState(graphPadding)
+	default:
+		g.updateState(graphCollapsing)
+	}
+}
+
+var graphMergeChars = []byte{'/', '|', '\\'}
+
+func (g *Graph) outputPostMergeLine(l *graphLine) {
+	seen := false
+	var parentCol *graphColumn
+	for i := 0; i <= len(g.columns); i++ {
+		var col graphColumn
+		if i == len(g.columns) {
+			if seen {
+				break
+			}
+			col.commit = g.commit
+		} else {
+			col = g.columns[i]
+		}
+
+		switch {
+		case col.commit == g.commit:
+			// The edges of the merge go to the columns of its
+			// parents.
+			seen = true
+			idx := g.mergeLayout
+			for j, p := range g.parents {
+				g.writeColumn(l, g.newColumns[g.findNewColumn(p)], graphMergeChars[idx])
+				if idx == 2 {
+					if g.edgesAdded > 0 || j < len(g.parents)-1 {
+						l.addChars(' ', 1)
+					}
+				} else {
+					idx++
+				}
+			}
+			if g.edgesAdded == 0 {
+				l.addChars(' ', 1)
+			}
+		case seen:
+			if g.edgesAdded > 0 {
+				g.writeColumn(l, col, '\\')
+			} else {
+				g.writeColumn(l, col, '|')
+			}
+			l.addChars(' ', 1)
+		default:
+			g.writeColumn(l, col, '|')
+			if g.mergeLayout != 0 || i != g.commitIdx-1 {
+				if parentCol != nil {
+					g.writeColumn(l, *parentCol, '_')
+				} else {
+					l.addChars(' ', 1)
+				}
+			}
+		}
+
+		if col.commit == g.parents[0] {
+			c := col
+			parentCol = &c
+		}
+	}
+
+	if g.isMappingCorrect() {
+		g.updateState(graphPadding)
+	} else {
+		g.updateState(graphCollapsing)
+	}
+}
+
+func (g *Graph) outputCollapsingLine(l *graphLine) {
+	usedHorizontal := false
+	horizontalEdge, horizontalTarget := -1, -1
+
+	g.mapping, g.oldMapping = g.oldMapping, g.mapping
+	for i := 0; i < g.mappingSize; i++ {
+		g.mapping[i] = -1
+	}
+
+	for i := 0; i < g.mappingSize; i++ {
+		target := g.oldMapping[i]
+		if target < 0 {
+			continue
+		}
+		// The columns are always inserted leftmost first, so each
+		// branch line only ever moves to the left.
+		switch {
+		case target*2 == i:
+			// It's already in the right place.
+			g.mapping[i] = target
+		case g.mapping[i-1] < 0:
+			// There's nothing to the left, so move one to the
+			// left, horizontally if it's the first to move.
+			g.mapping[i-1] = target
+			if horizontalEdge == -1 {
+				horizontalEdge, horizontalTarget = i, target
+				for j := target*2 + 3; j < i-2; j += 2 {
+					g.mapping[j] = target
+				}
+			}
+		case g.mapping[i-1] == target:
+			// The line to the left goes to the same commit, so
+			// they merge.
+		default:
+			// The line to the left goes somewhere else, so this
+			// one crosses over it.
+			g.mapping[i-2] = target
+			if horizontalEdge == -1 {
+				horizontalEdge, horizontalTarget = i-1, target
+				for j := target*2 + 3; j < i-2; j += 2 {
+					g.mapping[j] = target
+				}
+			}
+		}
+	}
+
+	copy(g.oldMapping, g.mapping[:g.mappingSize])
+	if g.mapping[g.mappingSize-1] < 0 {
+		g.mappingSize--
+	}
+
+	for i := 0; i < g.mappingSize; i++ {
+		target := g.mapping[i]
+		switch {
+		case target < 0:
+			l.addChars(' ', 1)
+		case target*2 == i:
+			g.writeColumn(l, g.newColumns[target], '|')
+		case target == horizontalTarget && i != horizontalEdge-1:
+			// Only the first segment of the horizontal line
+			// carries on into the next line.
+			if i != target*2+3 {
+				g.mapping[i] = -1
+			}
+			usedHorizontal = true
+			g.writeColumn(l, g.newColumns[target], '_')
+		default:
+			if usedHorizontal && i < horizontalEdge {
+				g.mapping[i] = -1
+			}
+			g.writeColumn(l, g.newColumns[target], '/')
+		}
+	}
+
+	if g.isMappingCorrect() {
+		g.updateState(graphPadding)
+	}
+}
+
+// nextLine returns the next line of the graph, and whether it's the line
+// with the commit on it.
+func (g *Graph) nextLine() (string, bool) {
+	if !g.hasCommit {
+		return "", false
+	}
+	var l graphLine
+	commitLine := false
+	switch g.state {
+	case graphPadding:
+		g.outputPaddingLine(&l)
+	case graphSkip:
+		g.outputSkipLine(&l)
+	case graphPreCommit:
+		g.outputPreCommitLine(&l)
+	case graphCommit:
+		g.outputCommitLine(&l)
+		commitLine = true
+	case graphPostMerge:
+		g.outputPostMergeLine(&l)
+	case graphCollapsing:
+		g.outputCollapsingLine(&l)
+	}
+	g.padHorizontally(&l)
+	return l.buf.String(), commitLine
+}
+
+// PaddingLine returns the graph to go before a line of output which isn't
+// the commit line, such as the lines of the message or diff. Unless the
+// commit line hasn't been drawn yet, it's the next line of the graph.
+func (g *Graph) PaddingLine() string {
+	if g.state != graphCommit {
+		line, _ := g.nextLine()
+		return line
+	}
+	// The commit line is still to come, so draw the columns as they
+	// are.
+	var l graphLine
+	for _, col := range g.columns {
+		g.writeColumn(&l, col, '|')
+		if col.commit == g.commit && len(g.parents) > 2 {
+			l.addChars(' ', (len(g.parents)-2)*2)
+		} else {
+			l.addChars(' ', 1)
+		}
+	}
+	g.padHorizontally(&l)
+	g.prevState = graphPadding
+	return l.buf.String()
+}
+
+// IsCommitFinished returns whether all of the lines for the commit have
+// been drawn.
+func (g *Graph) IsCommitFinished() bool {
+	return g.state == graphPadding
+}
+
+// ShowCommit writes the lines of the graph up to and including the
+// commit's line, without the newline after it.
+func (g *Graph) ShowCommit(w io.Writer) {
+	// A merge shown against each of its parents is shown again without
+	// an Update, which just needs a padding line.
+	if g.IsCommitFinished() {
+		io.WriteString(w, g.PaddingLine())
+		return
+	}
+	for !g.IsCommitFinished() {
+		line, commitLine := g.nextLine()
+		io.WriteString(w, line)
+		if commitLine {
+			return
+		}
+		io.WriteString(w, "\n")
+	}
+}
+
+// ShowOneline writes the next line of the graph, without a newline.
+func (g *Graph) ShowOneline(w io.Writer) {
+	line, _ := g.nextLine()
+	io.WriteString(w, line)
+}
+
+// ShowPadding writes a padding line of the graph, without a newline.
+func (g *Graph) ShowPadding(w io.Writer) {
+	io.WriteString(w, g.PaddingLine())
+}
+
+// ShowRemainder writes the rest of the lines for the commit, without a
+// newline after the last one, and returns whether there were any.
+func (g *Graph) ShowRemainder(w io.Writer) bool {
+	if g.IsCommitFinished() {
+		return false
+	}
+	for {
+		line, _ := g.nextLine()
+		io.WriteString(w, line)
+		if g.IsCommitFinished() {
+			return true
+		}
+		io.WriteString(w, "\n")
+	}
+}
+
+// ShowCommitMsg writes msg, which is shown after the commit line, with
+// the graph before each of its lines after the first, followed by the
+// rest of the lines for the commit.
+func (g *Graph) ShowCommitMsg(w io.Writer, msg string) {
+	for rest := msg; rest != ""; {
+		i := strings.IndexByte(rest, '\n')
+		if i < 0 {
+			io.WriteString(w, rest)
+			break
+		}
+		io.WriteString(w, rest[:i+1])
+		if rest = rest[i+1:]; rest != "" {
+			g.ShowOneline(w)
+		}
+	}
+	if g.IsCommitFinished() {
+		return
+	}
+	// The rest of the graph goes on the lines after the message, which
+	// ends the same way as the message did.
+	terminated := strings.HasSuffix(msg, "\n")
+	if !terminated {
+		io.WriteString(w, "\n")
+	}
+	g.ShowRemainder(w)
+	if terminated {
+		io.WriteString(w, "\n")
+	}
+}
+
+// A graphWriter writes the output for a commit after its message, such as
+// its diff, with the graph before each line.
+type graphWriter struct {
+	w         io.Writer
+	g         *Graph
+	lineStart bool
+}
+
+// NewGraphWriter returns an io.Writer which writes to w with the padding
+// lines of g before each line, for the output after a commit's message.
+func NewGraphWriter(w io.Writer, g *Graph) io.Writer {
+	return &graphWriter{w: w, g: g, lineStart: true}
+}
+
+func (gw *graphWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		if gw.lineStart {
+			if _, err := io.WriteString(gw.w, gw.g.PaddingLine()); err != nil {
+				return n, err
+			}
+			gw.lineStart = false
+		}
+		line := p
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			line = p[:i+1]
+			gw.lineStart = true
+		}
+		m, err := gw.w.Write(line)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		p = p[len(line):]
+	}
+	return n, nil
+}
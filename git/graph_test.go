@@ -0,0 +1,70 @@
+package git
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGraph(t *testing.T) {
+	ids := make(map[string]CommitID)
+	id := func(name string) CommitID {
+		if cmt, ok := ids[name]; ok {
+			return cmt
+		}
+		var cmt CommitID
+		cmt[0] = byte(len(ids) + 1)
+		ids[name] = cmt
+		return cmt
+	}
+	type commit struct {
+		name    string
+		parents []string
+	}
+	tests := []struct {
+		label   string
+		commits []commit
+		want    string
+	}{
+		{
+			"linear",
+			[]commit{{"B", []string{"A"}}, {"A", nil}},
+			"* B\n* A\n",
+		},
+		{
+			"merge",
+			[]commit{{"M", []string{"A", "B"}}, {"B", []string{"base"}}, {"A", []string{"base"}}, {"base", nil}},
+			"*   M\n|\\  \n| * B\n* | A\n|/  \n* base\n",
+		},
+		{
+			"octopus",
+			[]commit{{"O", []string{"A", "B", "C"}}, {"C", []string{"base"}}, {"B", []string{"base"}}, {"A", []string{"base"}}, {"base", nil}},
+			"*-.   O\n|\\ \\  \n| | * C\n| * | B\n| |/  \n* / A\n|/  \n* base\n",
+		},
+		{
+			"disconnected",
+			[]commit{{"B", nil}, {"A", nil}},
+			"* B\n* A\n",
+		},
+	}
+	for _, tc := range tests {
+		g, err := NewGraph(nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sb strings.Builder
+		for _, cmt := range tc.commits {
+			var parents []CommitID
+			for _, p := range cmt.parents {
+				parents = append(parents, id(p))
+			}
+			g.Update(id(cmt.name), parents)
+			// The commit line is padded to the width of the graph.
+			g.ShowCommit(&sb)
+			g.ShowCommitMsg(&sb, cmt.name)
+			sb.WriteString("\n")
+		}
+		if got := sb.String(); got != tc.want {
+			t.Errorf("%v: got\n%v\nwant\n%v", tc.label, got, tc.want)
+		}
+	}
+}
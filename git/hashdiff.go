@@ -14,30 +14,78 @@ type HashDiff struct {
 	Name             IndexPath
 	Src, Dst         TreeEntry
 	SrcSize, DstSize uint
+
+	// The path that Src came from for a rename or copy. It's empty if
+	// it's the same as Name.
+	SrcName IndexPath
+
+	// 'R' for a rename or 'C' for a copy, with the similarity in
+	// Score. For a rewrite, Status is 'M' and Score is the
+	// dissimilarity. If Status is 0, it's determined from Src and Dst.
+	Status byte
+	Score  int
+
+	// Extra lines for the header of the patch after the "diff --git"
+	// line, such as the conflicts from re-merging a merge.
+	ExtraHeaders []string
 }
 
-func (h HashDiff) String() string {
-	var status string = "?"
+// SrcPath returns the path of the source of h.
+func (h HashDiff) SrcPath() IndexPath {
+	if h.SrcName != "" {
+		return h.SrcName
+	}
+	return h.Name
+}
 
+// StatusString returns the status letter of h with its score, if any, the
+// same as in raw diff output.
+func (h HashDiff) StatusString() string {
+	if h.Status != 0 {
+		if h.Score > 0 || h.Status != 'M' {
+			return fmt.Sprintf("%c%03d", h.Status, h.Score)
+		}
+		return string(h.Status)
+	}
 	empty := Sha1{}
 	if h.Src.Sha1 == empty && h.Dst.Sha1 != empty {
-		status = "A"
-	} else if h.Src.Sha1 != empty && h.Dst.Sha1 == empty {
-		if h.Dst.FileMode == 0 {
-			status = "D"
-		} else {
-			status = "M"
-		}
-	} else {
-		status = "M"
+		return "A"
+	} else if h.Src.Sha1 != empty && h.Dst.Sha1 == empty && h.Dst.FileMode == 0 {
+		return "D"
+	}
+	return "M"
+}
+
+// hasBothNames returns whether both paths are shown in raw and name-status
+// output, which is only the case for renames and copies. A diff between
+// two differently named blobs only shows the source.
+func (h HashDiff) hasBothNames() bool {
+	return h.SrcName != "" && (h.Status == 'R' || h.Status == 'C')
+}
+
+func (h HashDiff) String() string {
+	status := h.StatusString()
+	if h.hasBothNames() {
+		return fmt.Sprintf(":%0.6o %0.6o %v %v %v	%v	%v", h.Src.FileMode, h.Dst.FileMode, h.Src.Sha1, h.Dst.Sha1, status, h.SrcName, h.Name)
 	}
-	return fmt.Sprintf(":%0.6o %0.6o %v %v %v	%v", h.Src.FileMode, h.Dst.FileMode, h.Src.Sha1, h.Dst.Sha1, status, h.Name)
+	return fmt.Sprintf(":%0.6o %0.6o %v %v %v	%v", h.Src.FileMode, h.Dst.FileMode, h.Src.Sha1, h.Dst.Sha1, status, h.SrcPath())
 }
 
 // Returns a diff in the format of the command "diff". Note: this invokes
 // an external diff tool. It should be rewritten in Go to avoid the overhead
 // (and the possibility that diff isn't installed.)
 func (h HashDiff) ExternalDiff(c *Client, s1, s2 TreeEntry, f File, opts DiffCommonOptions) (string, error) {
+	indexPath, err := f.IndexPath(c)
+	if err != nil {
+		// If it couldn't be converted, fall back on the file name.
+		indexPath = IndexPath(f)
+	}
+	return externalDiff(c, s1, s2, f, "a/"+indexPath.String(), "b/"+indexPath.String(), opts)
+}
+
+// externalDiff is like ExternalDiff, but labels the two sides of the diff
+// with srcLabel and dstLabel, which differ for renames and copies.
+func externalDiff(c *Client, s1, s2 TreeEntry, f File, srcLabel, dstLabel string, opts DiffCommonOptions) (string, error) {
 	tmpfile1, err := ioutil.TempFile("", "gitdiff")
 	if err != nil {
 		return "", err
@@ -73,12 +121,7 @@ func (h HashDiff) ExternalDiff(c *Client, s1, s2 TreeEntry, f File, opts DiffCom
 	}
 	tmpfile2.Close()
 
-	indexPath, err := f.IndexPath(c)
-	if err != nil {
-		// If it couldn't be converted, fall back on the file name.
-		indexPath = IndexPath(f)
-	}
-	diffcmd := exec.Command(posixDiff, "-u", "-U", strconv.Itoa(opts.NumContextLines), "-L", ("a/" + indexPath).String(), "-L", ("b/" + indexPath).String(), tmpfile1.Name(), file2)
+	diffcmd := exec.Command(posixDiff, "-u", "-U", strconv.Itoa(opts.NumContextLines), "-L", srcLabel, "-L", dstLabel, tmpfile1.Name(), file2)
 	// diff returns an error code if there's any differences, so just throw
 	// away the error.
 	diffcmd.Stderr = os.Stderr
@@ -105,28 +148,108 @@ func printDiffHeader(w io.Writer, name IndexPath, full bool) {
 	}
 }
 
+// writeRaw writes h in the raw diff format, with the object names
+// abbreviated and NUL separated names if selected by opts.
+func (h HashDiff) writeRaw(c *Client, w io.Writer, opts DiffCommonOptions) {
+	sep := "\t"
+	if opts.NullTerminate {
+		sep = "\x00"
+	}
+	fmt.Fprintf(w, ":%0.6o %0.6o %v %v %v%s", h.Src.FileMode, h.Dst.FileMode, opts.rawSha1(c, h.Src.Sha1), opts.rawSha1(c, h.Dst.Sha1), h.StatusString(), sep)
+	h.writeNames(w, opts.NullTerminate)
+}
+
+// rawSha1 returns s the way that it's shown in raw output, which is
+// abbreviated if opts.Abbrev is set.
+func (opts DiffCommonOptions) rawSha1(c *Client, s Sha1) string {
+	if opts.Abbrev == 0 {
+		return s.String()
+	}
+	return s.Abbrev(c, opts.Abbrev)
+}
+
+// writeNames writes the names of h, separated and terminated by tabs and
+// a newline, or NULs if nul is set.
+func (h HashDiff) writeNames(w io.Writer, nul bool) {
+	sep, term := "\t", "\n"
+	if nul {
+		sep, term = "\x00", "\x00"
+	}
+	if h.hasBothNames() {
+		fmt.Fprintf(w, "%v%s%v%s", h.SrcName, sep, h.Name, term)
+		return
+	}
+	fmt.Fprintf(w, "%v%s", h.SrcPath(), term)
+}
+
 func GeneratePatch(c *Client, options DiffCommonOptions, diffs []HashDiff, dst io.Writer) error {
 	if dst == nil {
 		dst = os.Stdout
 	}
-	for _, diff := range diffs {
-		if options.Raw {
-			fmt.Fprintf(dst, "%v\n", diff)
-		}
-		if options.Patch {
-			f, err := diff.Name.FilePath(c)
-			if err != nil {
-				return err
+	if len(diffs) == 0 {
+		return nil
+	}
+	nul := options.NullTerminate
+
+	// The name formats replace every other format.
+	if options.NameOnly || options.NameStatus {
+		for _, diff := range diffs {
+			switch {
+			case options.NameStatus && nul:
+				fmt.Fprintf(dst, "%v\x00", diff.StatusString())
+				diff.writeNames(dst, nul)
+			case options.NameStatus:
+				fmt.Fprintf(dst, "%v\t", diff.StatusString())
+				diff.writeNames(dst, nul)
+			case nul:
+				fmt.Fprintf(dst, "%v\x00", diff.Name)
+			default:
+				fmt.Fprintf(dst, "%v\n", diff.Name)
 			}
+		}
+		return nil
+	}
 
-			patch, err := diff.ExternalDiff(c, diff.Src, diff.Dst, f, options)
-			if err != nil {
+	// Each format is in its own section, in the same order as git, and
+	// the patch is separated from the other sections by an empty line.
+	separator := false
+	if options.Raw {
+		for _, diff := range diffs {
+			diff.writeRaw(c, dst, options)
+		}
+		separator = true
+	}
+	if options.NumStat || options.Stat || options.ShortStat || options.DirStat {
+		stats, err := diffStats(c, diffs)
+		if err != nil {
+			return err
+		}
+		if options.NumStat {
+			writeNumStat(dst, stats, nul)
+		}
+		if options.Stat {
+			writeDiffStat(dst, stats, options.StatWidth, options.StatNameWidth, options.StatGraphWidth, options.StatCount)
+		}
+		if options.ShortStat {
+			writeShortStat(dst, stats)
+		}
+		if options.DirStat {
+			if err := writeDirStat(c, dst, diffs, stats, options.DirStatParams); err != nil {
 				return err
-			} else {
-				printDiffHeader(dst, diff.Name, false)
-				fmt.Fprintf(dst, "%v\n", patch)
 			}
 		}
+		separator = true
+	}
+
+	if !options.Patch {
+		return nil
+	}
+	if separator {
+		if nul {
+			fmt.Fprint(dst, "\x00")
+		} else {
+			fmt.Fprintln(dst)
+		}
 	}
-	return nil
+	return writePatches(c, options, diffs, dst)
 }
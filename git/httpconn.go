@@ -452,6 +452,10 @@ refs:
 				vals = append(vals, r)
 				continue refs
 			}
+			if strings.HasSuffix(p, "/*") && strings.HasPrefix(r.Name, strings.TrimSuffix(p, "*")) {
+				vals = append(vals, r)
+				continue refs
+			}
 		}
 	}
 	return vals, nil
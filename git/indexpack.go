@@ -107,6 +107,73 @@ func v2PackObjectListFromIndex(idx io.Reader) []Sha1 {
 	return pack.Sha1Table
 }
 
+// A packSha1Table is the fanout and sorted Sha1 table of a v2 pack index,
+// without the tables after them.
+type packSha1Table struct {
+	fanout PackIndexFanout
+	sha1s  []Sha1
+}
+
+// readPackSha1Table reads the fanout and Sha1 table of the v2 pack index
+// in r.
+func readPackSha1Table(r io.Reader) (*packSha1Table, error) {
+	var magic [4]byte
+	var version uint32
+	var t packSha1Table
+	if err := binary.Read(r, binary.BigEndian, &magic); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return nil, err
+	}
+	if magic != [4]byte{0377, 't', 'O', 'c'} || version != 2 {
+		return nil, fmt.Errorf("Unsupported pack index format")
+	}
+	if err := binary.Read(r, binary.BigEndian, &t.fanout); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 20*int(t.fanout[255]))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	t.sha1s = make([]Sha1, t.fanout[255])
+	for i := range t.sha1s {
+		copy(t.sha1s[i][:], buf[20*i:])
+	}
+	return &t, nil
+}
+
+// neighbours returns the objects in the table which sort immediately
+// before and after s, other than s itself. They're the objects which share
+// the longest prefix with s.
+func (t *packSha1Table) neighbours(s Sha1) []Sha1 {
+	// The fanout narrows the search down to the objects starting with
+	// the same byte as s, which are the only ones with a common prefix.
+	lo := uint32(0)
+	if s[0] > 0 {
+		lo = t.fanout[s[0]-1]
+	}
+	hi := t.fanout[s[0]]
+	if lo > hi || hi > uint32(len(t.sha1s)) {
+		return nil
+	}
+	bucket := t.sha1s[lo:hi]
+	i := sort.Search(len(bucket), func(i int) bool {
+		return bytes.Compare(bucket[i][:], s[:]) >= 0
+	})
+	var rv []Sha1
+	if i > 0 {
+		rv = append(rv, bucket[i-1])
+	}
+	if i < len(bucket) && bucket[i] == s {
+		i++
+	}
+	if i < len(bucket) {
+		rv = append(rv, bucket[i])
+	}
+	return rv
+}
+
 // reads a v2 pack file from r and tells if it has object inside it.
 func v2PackIndexHasSha1(c *Client, pfile File, r io.Reader, obj Sha1) bool {
 	var pack PackfileIndexV2
@@ -13,6 +13,10 @@ type InitOptions struct {
 
 	Template File
 
+	// The format to use for storing refs. Either "files" (the
+	// default) or "reftable".
+	RefFormat string
+
 	// Not implemented
 	SeparateGitDir File
 
@@ -21,6 +25,11 @@ type InitOptions struct {
 }
 
 func Init(c *Client, opts InitOptions, dir string) (*Client, error) {
+	switch opts.RefFormat {
+	case "", "files", "reftable":
+	default:
+		return nil, fmt.Errorf("unknown ref storage format '%v'", opts.RefFormat)
+	}
 	if dir == "" {
 		dir2, err := os.Getwd()
 		if err != nil {
@@ -103,8 +112,13 @@ func Init(c *Client, opts InitOptions, dir string) (*Client, error) {
 	if err := os.MkdirAll(c.GitDir.String()+"/branches", 0755); err != nil {
 		return nil, err
 	}
-	if err := os.MkdirAll(c.GitDir.String()+"/refs/heads", 0755); err != nil {
-		return nil, err
+	// In a reftable repository, refs/heads is a file to prevent older
+	// versions of git from using the repo, so don't try and make it a
+	// directory when reinitializing.
+	if refsHeads := c.GitDir.File("refs/heads"); !refsHeads.Exists() {
+		if err := os.MkdirAll(refsHeads.String(), 0755); err != nil {
+			return nil, err
+		}
 	}
 	if err := os.MkdirAll(c.GitDir.String()+"/refs/tags", 0755); err != nil {
 		return nil, err
@@ -123,6 +137,16 @@ func Init(c *Client, opts InitOptions, dir string) (*Client, error) {
 
 	if c.GitDir.File("config").Exists() {
 		reinit = true
+	} else if opts.RefFormat == "reftable" {
+		// Reftables require a repository format version of 1 so that
+		// older versions of git don't try and use the repo.
+		config := "[core]\n\trepositoryformatversion = 1\n\t" + bareConf + "\n[extensions]\n\trefStorage = reftable\n"
+		if err := c.GitDir.WriteFile("config", []byte(config), 0644); err != nil {
+			return nil, err
+		}
+		if err := initReftable(c.GitDir, "refs/heads/master"); err != nil {
+			return nil, err
+		}
 	} else if err := c.GitDir.WriteFile("config", []byte("[core]\n\trepositoryformatversion = 0\n\t"+bareConf+"\n"), 0644); err != nil {
 		return nil, err
 	}
@@ -0,0 +1,93 @@
+package git
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+)
+
+// diffHunk is a region that differs between two sequences of lines.
+// The lines a[AStart:AEnd] were replaced by b[BStart:BEnd].
+type diffHunk struct {
+	AStart, AEnd int
+	BStart, BEnd int
+}
+
+// splitLines splits content into lines. The line terminators are kept,
+// so joining the lines gives back the original content.
+func splitLines(content []byte) []string {
+	var lines []string
+	for len(content) > 0 {
+		idx := bytes.IndexByte(content, '\n')
+		if idx < 0 {
+			lines = append(lines, string(content))
+			break
+		}
+		lines = append(lines, string(content[:idx+1]))
+		content = content[idx+1:]
+	}
+	return lines
+}
+
+// isBinary uses the same heuristic as git to decide if content is binary:
+// it's binary if there's a NUL byte in the first 8000 bytes.
+func isBinary(content []byte) bool {
+	if len(content) > 8000 {
+		content = content[:8000]
+	}
+	return bytes.IndexByte(content, 0) >= 0
+}
+
+// lineKey returns a function which normalizes lines so that lines which
+// should be treated as equal have the same key, optionally ignoring
+// changes in the amount of whitespace or all whitespace. It returns nil
+// if lines are only equal when they're identical.
+func lineKey(ignoreSpaceChange, ignoreAllSpace bool) func(string) string {
+	switch {
+	case ignoreAllSpace:
+		return func(s string) string {
+			return strings.Map(func(r rune) rune {
+				if unicode.IsSpace(r) {
+					return -1
+				}
+				return r
+			}, s)
+		}
+	case ignoreSpaceChange:
+		return func(s string) string { return strings.Join(strings.Fields(s), " ") }
+	default:
+		return nil
+	}
+}
+
+// lineEqual returns a function which compares lines by their key.
+func lineEqual(key func(string) string) func(x, y string) bool {
+	if key == nil {
+		return func(x, y string) bool { return x == y }
+	}
+	return func(x, y string) bool { return x == y || key(x) == key(y) }
+}
+
+// changedHunks returns the hunks of the lines marked as deleted from a in
+// delA and inserted in b in insB.
+func changedHunks(delA, insB []bool) []diffHunk {
+	var hunks []diffHunk
+	i, j := 0, 0
+	for i < len(delA) || j < len(insB) {
+		if (i < len(delA) && delA[i]) || (j < len(insB) && insB[j]) {
+			h := diffHunk{AStart: i, BStart: j}
+			for i < len(delA) && delA[i] {
+				i++
+			}
+			for j < len(insB) && insB[j] {
+				j++
+			}
+			h.AEnd, h.BEnd = i, j
+			hunks = append(hunks, h)
+			continue
+		}
+		i++
+		j++
+	}
+	return hunks
+}
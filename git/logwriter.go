@@ -0,0 +1,203 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// LogOptions are the options for how log shows each of the commits.
+type LogOptions struct {
+	DiffCommonOptions
+	PrettyOptions
+
+	// Draw the graph of the history to the left of the commits.
+	Graph bool
+}
+
+// A LogWriter writes the commits shown by log, and the graph of the history
+// if there is one. It's git's show_log.
+type LogWriter struct {
+	c    *Client
+	opts LogOptions
+	w    io.Writer
+
+	pretty     *PrettyPrinter
+	graph      *Graph
+	diffWriter io.Writer
+
+	commitColor, colorReset string
+
+	// Whether a commit was shown, and whether its message didn't end in
+	// a newline, for separating it from the next one.
+	shownOne, missingNewline bool
+}
+
+// NewLogWriter returns a LogWriter which writes the commits to w in the
+// format selected by opts.
+func NewLogWriter(c *Client, opts LogOptions, w io.Writer) (*LogWriter, error) {
+	pretty, err := NewPrettyPrinter(c, opts.PrettyOptions, opts.Color)
+	if err != nil {
+		return nil, err
+	}
+	lw := &LogWriter{c: c, opts: opts, w: w, pretty: pretty, diffWriter: w}
+	if opts.Color {
+		colors, err := loadDiffColors(c, true)
+		if err != nil {
+			return nil, err
+		}
+		lw.commitColor, lw.colorReset = colors.Commit, colors.Reset
+	}
+	if opts.Graph {
+		g, err := NewGraph(c, opts.Color)
+		if err != nil {
+			return nil, err
+		}
+		lw.graph = g
+		lw.diffWriter = NewGraphWriter(w, g)
+	}
+	return lw, nil
+}
+
+// Update moves the graph on to cmt, whose listed parents are parents. It
+// needs to be called for each commit walked in the order that they're
+// walked, including the ones which aren't shown.
+func (lw *LogWriter) Update(cmt CommitID, parents []CommitID) {
+	if lw.graph != nil {
+		lw.graph.Update(cmt, parents)
+	}
+}
+
+// DiffWriter returns the writer that the changes made by a commit are
+// written to after WriteCommit, which puts the graph before each line.
+func (lw *LogWriter) DiffWriter() io.Writer {
+	return lw.diffWriter
+}
+
+// lineTermination returns what separates or terminates the commits.
+func (lw *LogWriter) lineTermination() string {
+	if lw.opts.NullTerminate {
+		return "\x00"
+	}
+	return "\n"
+}
+
+// useTerminator returns whether each commit is terminated by a newline,
+// rather than separated from the next one by an empty line.
+func (lw *LogWriter) useTerminator() bool {
+	return lw.pretty.format.terminator
+}
+
+// WriteCommit writes the header and message of cmt. If from is set, it's
+// the header of a merge's diff against that parent. If diff is set, the
+// changes made by cmt are written to DiffWriter after it.
+func (lw *LogWriter) WriteCommit(cmt CommitID, from *CommitID, diff bool) error {
+	msg, err := lw.message(cmt)
+	if err != nil {
+		return err
+	}
+
+	// Unless each commit is terminated, they're separated by an empty
+	// line, which gets the graph unless the message didn't end in a
+	// newline.
+	if lw.shownOne && !lw.useTerminator() {
+		if lw.graph != nil && !lw.opts.NullTerminate && !lw.missingNewline {
+			lw.graph.ShowPadding(lw.w)
+		}
+		io.WriteString(lw.w, lw.lineTermination())
+	}
+	lw.shownOne = true
+
+	if lw.graph != nil {
+		lw.graph.ShowCommit(lw.w)
+	}
+	format := lw.pretty.format
+	if !format.isUser() {
+		io.WriteString(lw.w, lw.header(cmt, from))
+		if format.name == "oneline" {
+			io.WriteString(lw.w, " ")
+		} else {
+			io.WriteString(lw.w, "\n")
+			if lw.graph != nil {
+				lw.graph.ShowOneline(lw.w)
+			}
+		}
+	}
+
+	lw.missingNewline = !strings.HasSuffix(msg, "\n")
+	if lw.graph != nil {
+		lw.graph.ShowCommitMsg(lw.w, msg)
+	} else {
+		io.WriteString(lw.w, msg)
+	}
+	// An empty user format isn't terminated.
+	if lw.useTerminator() && !format.isEmpty() {
+		if lw.graph != nil && !lw.missingNewline {
+			lw.graph.ShowPadding(lw.w)
+		}
+		io.WriteString(lw.w, lw.lineTermination())
+	}
+
+	if !diff || format.isEmpty() {
+		return nil
+	}
+	parents, err := cmt.Parents(lw.c)
+	if err != nil {
+		return err
+	}
+	combined := len(parents) > 1 && from == nil && lw.opts.DiffMerges != "first-parent" && lw.opts.DiffMerges != "remerge"
+	if format.name == "oneline" && !combined {
+		return nil
+	}
+	// The message is separated from the diff by an empty line, or by
+	// "---" if it's a diffstat followed by a patch, except in the
+	// combined diff of a merge. An email's notes already end in "---".
+	sep := "\n"
+	switch {
+	case combined:
+	case !lw.opts.Stat || !lw.opts.Patch:
+	case format.isMail():
+		notes, err := formatNotes(lw.c, lw.opts.NotesRefs, Sha1(cmt), false)
+		if err != nil {
+			return err
+		}
+		if notes == "" {
+			sep = "---\n"
+		}
+	default:
+		sep = "---\n"
+	}
+	_, err = io.WriteString(lw.diffWriter, sep)
+	return err
+}
+
+// header returns the line with cmt's id on it, with its decorations.
+func (lw *LogWriter) header(cmt CommitID, from *CommitID) string {
+	id := func(s CommitID) string {
+		if lw.opts.AbbrevCommit {
+			return Sha1(s).Abbrev(lw.c, 7)
+		}
+		return s.String()
+	}
+	if lw.pretty.format.isMail() {
+		return fmt.Sprintf("From %v Mon Sep 17 00:00:00 2001", cmt)
+	}
+	header := lw.commitColor
+	if lw.pretty.format.name != "oneline" {
+		header += "commit "
+	}
+	header += id(cmt)
+	if from != nil {
+		header += fmt.Sprintf(" (from %v)", id(*from))
+	}
+	header += lw.colorReset
+	if lw.opts.Decorations != nil {
+		header += lw.opts.Decorations.Format(cmt, " (", ", ", ")", lw.opts.Color)
+	}
+	return header
+}
+
+// message returns what's shown after the header of cmt.
+func (lw *LogWriter) message(cmt CommitID) (string, error) {
+	return lw.pretty.Message(cmt)
+}
@@ -2,8 +2,12 @@ package git
 
 import (
 	"fmt"
-	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 type MergeStrategy string
@@ -17,7 +21,10 @@ func commitishName(c Commitish) string {
 
 const (
 	MergeRecursive = MergeStrategy("recursive")
+	MergeOrt       = MergeStrategy("ort")
 	MergeOctopus   = MergeStrategy("octopus")
+	MergeOurs      = MergeStrategy("ours")
+	MergeSubtree   = MergeStrategy("subtree")
 )
 
 var AlreadyUpToDate = fmt.Errorf("Already up-to-date.")
@@ -25,10 +32,11 @@ var AlreadyUpToDate = fmt.Errorf("Already up-to-date.")
 // Merge options represent the options that may be passed on
 // the command line to "git merge"
 type MergeOptions struct {
-	// Not implemented
+	// Perform the merge, but stop before creating the merge commit.
 	NoCommit bool
 
-	// Not implemented
+	// Use the message as-is instead of invoking an editor to
+	// edit it before committing.
 	NoEdit bool
 
 	NoFastForward   bool
@@ -39,12 +47,21 @@ type MergeOptions struct {
 	// Not implemented
 	Stat bool
 
-	// Not implemented
+	// Update the index and work tree as if a real merge happened,
+	// but do not create a commit or move HEAD.
 	Squash bool
 
-	// Not implemented
+	// The merge strategy to use. The default is MergeRecursive, or
+	// MergeOctopus when merging more than one commit. MergeRecursive
+	// and MergeOrt are the same.
 	Strategy MergeStrategy
 
+	// Options for the merge strategy, as passed with -X. The
+	// supported options are ours, theirs, ignore-space-change,
+	// ignore-all-space, no-renames, find-renames[=<n>] and
+	// subtree[=<path>].
+	StrategyOptions []string
+
 	// Not implemented
 	VerifySignatures bool
 
@@ -56,14 +73,221 @@ type MergeOptions struct {
 	// Not implemented
 	NoProgress bool
 
-	// Not implemented
+	// The message to use for the merge commit. If empty,
+	// a message is generated from the names of the commits being
+	// merged.
 	Message string
 }
 
-// Aborts an in progress merge as "git merge --abort"
-// (Not implemented)
+const mergeEditComment = `
+# Please enter a commit message to explain why this merge is necessary,
+# especially if it merges an updated upstream into a topic branch.
+#
+# Lines starting with '#' will be ignored, and an empty message aborts
+# the commit.
+`
+
+// Aborts an in progress merge as "git merge --abort", resetting the
+// index and work tree to HEAD.
 func MergeAbort(c *Client, opt MergeOptions) error {
-	return fmt.Errorf("MergeAbort not yet implemented")
+	if !c.GitDir.File("MERGE_HEAD").Exists() {
+		return fmt.Errorf("There is no merge to abort (MERGE_HEAD missing).")
+	}
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		return err
+	}
+	if err := ResetMode(c, ResetOptions{Hard: true}, head); err != nil {
+		return err
+	}
+	return c.removeMergeState()
+}
+
+// MergeContinue concludes an in progress merge after conflicts have been
+// resolved, as "git merge --continue".
+func MergeContinue(c *Client, opt MergeOptions) (CommitID, error) {
+	if !c.GitDir.File("MERGE_HEAD").Exists() {
+		return CommitID{}, fmt.Errorf("There is no merge in progress (MERGE_HEAD missing).")
+	}
+	msg, err := c.GitDir.File("MERGE_MSG").ReadAll()
+	if err != nil {
+		return CommitID{}, err
+	}
+	if !opt.NoEdit {
+		if msg, err = editMergeMessage(c, msg); err != nil {
+			return CommitID{}, err
+		}
+	}
+	return Commit(c, CommitOptions{NoEdit: opt.NoEdit, CleanupMode: "strip"}, CommitMessage(msg), nil)
+}
+
+// mergeHeads returns the commits which are being merged into HEAD
+// by an in progress merge, or nil if there is no merge in progress.
+func (c *Client) mergeHeads() ([]CommitID, error) {
+	f := c.GitDir.File("MERGE_HEAD")
+	if !f.Exists() {
+		return nil, nil
+	}
+	content, err := f.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var heads []CommitID
+	for _, line := range strings.Fields(content) {
+		s, err := Sha1FromString(line)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid MERGE_HEAD: %v", err)
+		}
+		heads = append(heads, CommitID(s))
+	}
+	return heads, nil
+}
+
+// removeMergeState removes the files which record the state of an in
+// progress merge, cherry-pick or revert from the GitDir.
+func (c *Client) removeMergeState() error {
+	for _, name := range []File{"MERGE_HEAD", "MERGE_MSG", "MERGE_MODE", "SQUASH_MSG", "CHERRY_PICK_HEAD", "REVERT_HEAD"} {
+		if err := os.Remove(c.GitDir.File(name).String()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// editMergeMessage invokes the user's editor on msg in MERGE_MSG and
+// returns the result with comments stripped.
+func editMergeMessage(c *Client, msg string) (string, error) {
+	if err := c.GitDir.WriteFile("MERGE_MSG", []byte(msg+mergeEditComment), 0644); err != nil {
+		return "", err
+	}
+	if err := c.ExecEditor(c.GitDir.File("MERGE_MSG")); err != nil {
+		return "", err
+	}
+	edited, err := c.GitDir.File("MERGE_MSG").ReadAll()
+	if err != nil {
+		return "", err
+	}
+	return CommitMessage(edited).Cleanup("strip", true)
+}
+
+// mergeMessage returns the default message for merging others into
+// HEAD.
+func mergeMessage(c *Client, others []Commitish) string {
+	var branches, commits []string
+	for _, other := range others {
+		if name := commitishName(other); name != "" {
+			branches = append(branches, "'"+name+"'")
+		} else if cid, err := other.CommitID(c); err == nil {
+			commits = append(commits, "'"+cid.String()+"'")
+		}
+	}
+	var pieces []string
+	if len(branches) == 1 {
+		pieces = append(pieces, "branch "+branches[0])
+	} else if len(branches) > 1 {
+		pieces = append(pieces, "branches "+strings.Join(branches, ", "))
+	}
+	if len(commits) == 1 {
+		pieces = append(pieces, "commit "+commits[0])
+	} else if len(commits) > 1 {
+		pieces = append(pieces, "commits "+strings.Join(commits, ", "))
+	}
+	msg := "Merge " + strings.Join(pieces, " and ")
+	if head := c.GetHeadBranch().BranchName(); head != "" && head != "master" {
+		msg += " into " + head
+	}
+	return msg + "\n"
+}
+
+// squashMessage returns the message written to SQUASH_MSG by a squash
+// merge of others into head.
+func squashMessage(c *Client, head CommitID, others []Commitish) (string, error) {
+	cmts, err := RevList(c, RevListOptions{Quiet: true}, nil, others, []Commitish{head})
+	if err != nil {
+		return "", err
+	}
+	msg := "Squashed commit of the following:\n\n"
+	// Like git, the commits aren't decorated with the refs pointing to
+	// them, and they're separated by blank lines.
+	for i, s := range cmts {
+		log, err := CommitID(s).formatMediumMessage(c)
+		if err != nil {
+			return "", err
+		}
+		if i > 0 {
+			msg += "\n"
+		}
+		msg += fmt.Sprintf("commit %v\n%v", s, log)
+	}
+	return msg, nil
+}
+
+// mergeStrategyOptions returns the options to use for merging trees
+// with the strategy options from opts.
+func mergeStrategyOptions(c *Client, opts MergeOptions, others []Commitish) (mergeTreeOptions, error) {
+	treeOpts := mergeTreeOptions{
+		contentMergeOptions: contentMergeOptions{
+			OursLabel:   "HEAD",
+			BaseLabel:   "merged common ancestors",
+			TheirsLabel: mergeLabel(c, others[0]),
+			Diff3:       c.GetConfig("merge.conflictstyle") == "diff3",
+		},
+	}
+	if opts.Strategy == MergeSubtree {
+		treeOpts.subtree = true
+	}
+	err := treeOpts.parseStrategyOptions(opts.StrategyOptions)
+	return treeOpts, err
+}
+
+// mergeLabel returns the name to use for other in conflict markers and
+// messages: the name it was given by, or its commit ID if it has none.
+func mergeLabel(c *Client, other Commitish) string {
+	if label := commitishName(other); label != "" {
+		return label
+	}
+	if cid, err := other.CommitID(c); err == nil {
+		return cid.String()
+	}
+	return ""
+}
+
+// parseStrategyOptions sets the options from the merge strategy options
+// given with -X.
+func (opts *mergeTreeOptions) parseStrategyOptions(options []string) error {
+	for _, opt := range options {
+		switch {
+		case opt == "ours" || opt == "theirs":
+			opts.Favor = opt
+		case opt == "ignore-space-change" || opt == "ignore-space-at-eol":
+			opts.IgnoreSpaceChange = true
+		case opt == "ignore-all-space":
+			opts.IgnoreAllSpace = true
+		case opt == "no-renames":
+			opts.NoRenames = true
+		case opt == "find-renames":
+			opts.NoRenames = false
+		case strings.HasPrefix(opt, "find-renames=") || strings.HasPrefix(opt, "rename-threshold="):
+			val := strings.TrimSuffix(opt[strings.Index(opt, "=")+1:], "%")
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 0 || n > 100 {
+				return fmt.Errorf("Invalid rename threshold %v", val)
+			}
+			opts.NoRenames, opts.RenameThreshold = false, n
+		case opt == "subtree":
+			opts.subtree = true
+		case strings.HasPrefix(opt, "subtree="):
+			opts.subtree = true
+			opts.subtreePrefix = IndexPath(strings.Trim(strings.TrimPrefix(opt, "subtree="), "/"))
+		case opt == "patience" || opt == "histogram" || strings.HasPrefix(opt, "diff-algorithm="):
+			// The diff algorithm doesn't change the result enough
+			// to be worth supporting, so these are accepted but
+			// ignored.
+		default:
+			return fmt.Errorf("Unknown option for merge strategy: %v", opt)
+		}
+	}
+	return nil
 }
 
 // Implements the "git merge" porcelain command to merge other commits
@@ -72,6 +296,33 @@ func Merge(c *Client, opts MergeOptions, others []Commitish) error {
 	if len(others) < 1 {
 		return fmt.Errorf("Can't merge nothing.")
 	}
+	if opts.Squash && opts.NoFastForward {
+		return fmt.Errorf("You cannot combine --squash with --no-ff.")
+	}
+	strategy := opts.Strategy
+	if strategy == "" {
+		if len(others) > 1 {
+			strategy = MergeOctopus
+		} else {
+			strategy = MergeRecursive
+		}
+	}
+	switch strategy {
+	case MergeRecursive, MergeOrt, MergeSubtree:
+		if len(others) != 1 {
+			return fmt.Errorf("Can only merge one branch at a time with the %v strategy.", strategy)
+		}
+	case MergeOctopus, MergeOurs:
+	default:
+		return fmt.Errorf("Could not find merge strategy '%v'.", strategy)
+	}
+	if c.GitDir.File("MERGE_HEAD").Exists() {
+		return fmt.Errorf("You have not concluded your merge (MERGE_HEAD exists).")
+	}
+	treeOpts, err := mergeStrategyOptions(c, opts, others)
+	if err != nil {
+		return err
+	}
 
 	head, err := c.GetHeadCommit()
 	if err != nil {
@@ -80,6 +331,7 @@ func Merge(c *Client, opts MergeOptions, others []Commitish) error {
 
 	// Check if all commits are already in head
 	needsMerge := false
+	otherIDs := make([]CommitID, 0, len(others))
 	for _, commit := range others {
 		cid, err := commit.CommitID(c)
 		if err != nil {
@@ -87,36 +339,18 @@ func Merge(c *Client, opts MergeOptions, others []Commitish) error {
 		}
 		if !cid.IsAncestor(c, head) {
 			needsMerge = true
-			break
 		}
+		otherIDs = append(otherIDs, cid)
 	}
 	if !needsMerge {
 		return AlreadyUpToDate
 
 	}
 
-	// RevParse returns ParsedRevisions, which are Commitish, but slices
-	// can't be passed in terms of interfaces without converting them
-	// first.
-	commitsWithHead := []Commitish{head}
-	commitsWithHead = append(commitsWithHead, others...)
-
-	// Find the mergebase. Use --octopus if there's more than 2 commits.
-	base, err := MergeBase(c, MergeBaseOptions{Octopus: len(commitsWithHead) > 2}, commitsWithHead)
-	if err != nil {
-		return err
-	}
-
-	// Check if it's a fast-forward commit. If the merge base is HEAD,
-	// it's a fast-forward
-	if base == head && !opts.NoFastForward {
-		dst := others[0]
-
-		// Resolve to a CommitID to implement Treeish for ReadTree
-		dstc, err := dst.CommitID(c)
-		if err != nil {
-			return err
-		}
+	// Check if it's a fast-forward commit. If HEAD is an ancestor of
+	// the commit being merged, it's a fast-forward.
+	if len(others) == 1 && head.IsAncestor(c, otherIDs[0]) && !opts.NoFastForward && strategy != MergeOurs {
+		dstc := otherIDs[0]
 		_, err = ReadTreeFastForward(
 			c,
 			ReadTreeOptions{Merge: true, Update: true},
@@ -126,6 +360,9 @@ func Merge(c *Client, opts MergeOptions, others []Commitish) error {
 		if err != nil {
 			return err
 		}
+		if opts.Squash {
+			return writeSquashMessage(c, head, others)
+		}
 		var refmsg string
 		if b, ok := others[0].(Branch); ok && b.BranchName() != "" {
 			refmsg = fmt.Sprintf("merge %s into %s: Fast-forward (dgit)", b.BranchName(), c.GetHeadBranch().BranchName())
@@ -140,92 +377,347 @@ func Merge(c *Client, opts MergeOptions, others []Commitish) error {
 		return fmt.Errorf("Not a fast-forward commit.")
 	}
 
-	if len(others) != 1 {
-		return fmt.Errorf("Can only merge one branch at a time (for now.)")
+	// Merge the trees and update the index and work tree with the
+	// result. The "ours" strategy ignores the other trees entirely.
+	var result *treeMergeResult
+	switch strategy {
+	case MergeOurs:
+	case MergeOctopus:
+		result, err = mergeOctopus(c, treeOpts, head, others)
+	default:
+		result, err = mergeCommits(c, treeOpts, head, otherIDs[0])
+	}
+	if err == errOctopusFailed {
+		// Like git, the conflicts are only left to be resolved if
+		// it was the last head that conflicted. Otherwise nothing is
+		// changed, so the state from before the merge is kept.
+		for _, msg := range result.Messages {
+			fmt.Println(msg)
+		}
+		if err := UpdateRef(c, UpdateRefOptions{NoDeref: true}, "ORIG_HEAD", head, ""); err != nil {
+			return err
+		}
+		return fmt.Errorf("Automated merge did not work.\nShould not be doing an octopus.\nMerge with strategy octopus failed.")
+	}
+	if err != nil {
+		return err
+	}
+	if result != nil {
+		if err := applyMergeResult(c, head, result, "merge"); err != nil {
+			return err
+		}
+		for _, msg := range result.Messages {
+			fmt.Println(msg)
+		}
+	}
+
+	if err := UpdateRef(c, UpdateRefOptions{NoDeref: true}, "ORIG_HEAD", head, ""); err != nil {
+		return err
+	}
+
+	var conflicts []IndexPath
+	if result != nil {
+		conflicts = result.Conflicts
+	}
+	msg := opts.Message
+	if msg == "" {
+		msg = mergeMessage(c, others)
+	} else if !strings.HasSuffix(msg, "\n") {
+		msg += "\n"
+	}
+	if opts.Squash {
+		if err := writeSquashMessage(c, head, others); err != nil {
+			return err
+		}
+	} else {
+		mergeMsg := msg
+		if len(conflicts) > 0 {
+			mergeMsg += "\n# Conflicts:\n"
+			for _, path := range conflicts {
+				mergeMsg += "#\t" + path.String() + "\n"
+			}
+		}
+		mode := ""
+		if opts.NoFastForward {
+			mode = "no-ff"
+		}
+		var mergeHeads string
+		for _, cid := range otherIDs {
+			mergeHeads += cid.String() + "\n"
+		}
+		if err := c.GitDir.WriteFile("MERGE_HEAD", []byte(mergeHeads), 0644); err != nil {
+			return err
+		}
+		if err := c.GitDir.WriteFile("MERGE_MSG", []byte(mergeMsg), 0644); err != nil {
+			return err
+		}
+		if err := c.GitDir.WriteFile("MERGE_MODE", []byte(mode), 0644); err != nil {
+			return err
+		}
 	}
 
-	// Perform a three-way merge with mergebase, head, and tree.
-	tree, err := others[0].CommitID(c)
+	if len(conflicts) > 0 {
+		return fmt.Errorf("Automatic merge failed; fix conflicts and then commit the result.")
+	}
+	if opts.Squash || opts.NoCommit {
+		if opts.NoCommit && !opts.Squash {
+			fmt.Println("Automatic merge went well; stopped before committing as requested")
+		}
+		return nil
+	}
+
+	if !opts.NoEdit {
+		if msg, err = editMergeMessage(c, msg); err != nil {
+			return err
+		}
+	}
+	cleanMessage, err := CommitMessage(msg).Cleanup("default", !opts.NoEdit)
 	if err != nil {
 		return err
 	}
+	if strings.TrimSpace(cleanMessage) == "" {
+		return fmt.Errorf("Not committing merge; use 'dgit commit' to complete the merge.")
+	}
 
-	idx, err := ReadTreeThreeWay(c,
-		ReadTreeOptions{
-			Merge:  true,
-			Update: true,
-		},
-		base,
-		head,
-		tree,
-	)
+	var tree TreeID
+	if result != nil {
+		tree, err = result.WriteTree(c)
+	} else {
+		tree, err = head.TreeID(c)
+	}
+	if err != nil {
+		return err
+	}
+	parents := append([]CommitID{head}, otherIDs...)
+	cid, err := CommitTree(c, CommitTreeOptions{}, tree, parents, cleanMessage)
+	if err != nil && err != NoGlobalConfig {
+		return err
+	}
+	refmsg := fmt.Sprintf("merge %v: Merge made by the '%v' strategy. (dgit)", treeOpts.TheirsLabel, strategy)
+	if err := UpdateRef(c, UpdateRefOptions{OldValue: head, CreateReflog: true}, "HEAD", cid, refmsg); err != nil {
+		return err
+	}
+	fmt.Printf("Merge made by the '%v' strategy.\n", strategy)
+	return c.removeMergeState()
+}
+
+// writeSquashMessage writes the SQUASH_MSG file for a squash merge of
+// others into head.
+func writeSquashMessage(c *Client, head CommitID, others []Commitish) error {
+	msg, err := squashMessage(c, head, others)
 	if err != nil {
 		return err
 	}
+	fmt.Println("Squash commit -- not updating HEAD")
+	return c.GitDir.WriteFile("SQUASH_MSG", []byte(msg), 0644)
+}
+
+// errOctopusFailed is returned by mergeOctopus when a head other than the
+// last one conflicts.
+var errOctopusFailed = fmt.Errorf("octopus merge failed")
 
-	// run MergeFile on any unmerged entries.
-	unmerged := idx.GetUnmerged()
-	if len(unmerged) != 0 {
-		// Flag conflicts in the tree if necessary.
-		conflictLabel := commitishName(others[0])
-		if conflictLabel == "" {
-			conflictLabel = tree.String()
+// mergeOctopus merges each of others into head in turn. It stops at the
+// first head which doesn't merge cleanly, and returns the result of the
+// merges so far along with errOctopusFailed if it wasn't the last one.
+func mergeOctopus(c *Client, opts mergeTreeOptions, head CommitID, others []Commitish) (*treeMergeResult, error) {
+	current, err := GetIndexMap(c, head)
+	if err != nil {
+		return nil, err
+	}
+	mrc := []Commitish{head}
+	var result *treeMergeResult
+	var messages []string
+	for i, other := range others {
+		id, err := other.CommitID(c)
+		if err != nil {
+			return nil, err
 		}
-		var errStr string
-		for path, file := range unmerged {
-			fp, err := path.FilePath(c)
-			if err != nil {
-				return err
+		base, err := MergeBase(c, MergeBaseOptions{Octopus: true}, append(mrc, id))
+		if err != nil {
+			return nil, err
+		}
+		baseMap, err := GetIndexMap(c, base)
+		if err != nil {
+			return nil, err
+		}
+		otherMap, err := GetIndexMap(c, id)
+		if err != nil {
+			return nil, err
+		}
+		label := mergeLabel(c, other)
+		messages = append(messages, "Trying simple merge with "+label)
+		opts.TheirsLabel = label
+		if result, err = mergeTreeMaps(c, opts, baseMap, current, otherMap); err != nil {
+			return nil, err
+		}
+		messages = append(messages, result.Messages...)
+		if !result.Clean() {
+			result.Messages = messages
+			if i != len(others)-1 {
+				return result, errOctopusFailed
 			}
+			return result, nil
+		}
+		current = result.Index.GetMap()
+		mrc = append(mrc, id)
+	}
+	result.Messages = messages
+	return result, nil
+}
 
-			fmt.Fprintf(os.Stderr, "Auto-merging %v\n", fp)
-
-			// Check out the stages to temporary files for MergeFile
-			stage1tmp, _ := checkoutTemp(c, file.Stage1, CheckoutIndexOptions{})
-			defer os.Remove(stage1tmp)
-			stage2tmp, _ := checkoutTemp(c, file.Stage2, CheckoutIndexOptions{})
-			defer os.Remove(stage2tmp)
-			stage3tmp, _ := checkoutTemp(c, file.Stage3, CheckoutIndexOptions{})
-			defer os.Remove(stage3tmp)
-
-			// run git merge-file with the appropriate parameters.
-			r, err := MergeFile(c,
-				MergeFileOptions{
-					Current: MergeFileFile{
-						Filename: File(stage2tmp),
-						Label:    "HEAD",
-					},
-					Base: MergeFileFile{
-						Filename: File(stage1tmp),
-						Label:    "merged common ancestors",
-					},
-					Other: MergeFileFile{
-						Filename: File(stage3tmp),
-						Label:    conflictLabel,
-					},
-				},
-			)
-			if err != nil {
-				errStr += "CONFLICT (content): Merge conflict in " + fp.String() + "\n"
-			}
+// applyMergeResult updates the index and work tree from ours to the
+// result of a merge. It refuses to do so if the index does not match
+// ours, or if the merge would overwrite local modifications or untracked
+// files in the work tree. action is the name of the operation to use in
+// error messages.
+func applyMergeResult(c *Client, ours Treeish, result *treeMergeResult, action string) error {
+	idx, err := c.GitDir.ReadIndex()
+	if err != nil {
+		return err
+	}
+	if len(idx.GetUnmerged()) > 0 {
+		gerund := strings.TrimSuffix(action, "e") + "ing"
+		return fmt.Errorf("%v%v is not possible because you have unmerged files.", strings.ToUpper(gerund[:1]), gerund[1:])
+	}
+	headMap, err := GetIndexMap(c, ours)
+	if err != nil {
+		return err
+	}
+	old := idx.GetMap()
+	var staged []string
+	for path, e := range old {
+		if !sameEntry(headMap[path], e) {
+			staged = append(staged, path.String())
+		}
+	}
+	for path := range headMap {
+		if _, ok := old[path]; !ok {
+			staged = append(staged, path.String())
+		}
+	}
+	if len(staged) > 0 {
+		sort.Strings(staged)
+		return fmt.Errorf("Your local changes to the following files would be overwritten by %v:\n\t%v\nPlease commit your changes or stash them before you %v.", action, strings.Join(staged, "\n\t"), action)
+	}
 
-			// Write the output with conflict markers into the file.
-			f2, err := os.Create(fp.String())
-			if err != nil {
+	// Group the result by path, and find the paths which change.
+	newEntries := make(map[IndexPath][]*IndexEntry)
+	var paths []IndexPath
+	for _, e := range result.Index.Objects {
+		if _, ok := newEntries[e.PathName]; !ok {
+			paths = append(paths, e.PathName)
+		}
+		newEntries[e.PathName] = append(newEntries[e.PathName], e)
+	}
+	changed := func(path IndexPath) bool {
+		entries := newEntries[path]
+		return len(entries) != 1 || entries[0].Stage() != Stage0 || !sameEntry(entries[0], old[path])
+	}
+
+	var dirty, untracked []string
+	for path, e := range old {
+		if changed(path) && !path.IsClean(c, e.Sha1) {
+			dirty = append(dirty, path.String())
+		}
+	}
+	for _, path := range paths {
+		if _, ok := old[path]; ok {
+			continue
+		}
+		f, err := path.FilePath(c)
+		if err != nil {
+			return err
+		}
+		if f.Exists() && !f.IsDir() {
+			untracked = append(untracked, path.String())
+		}
+	}
+	if len(dirty) > 0 {
+		sort.Strings(dirty)
+		return fmt.Errorf("Your local changes to the following files would be overwritten by %v:\n\t%v\nPlease commit your changes or stash them before you %v.", action, strings.Join(dirty, "\n\t"), action)
+	}
+	if len(untracked) > 0 {
+		return fmt.Errorf("The following untracked working tree files would be overwritten by %v:\n\t%v\nPlease move or remove them before you %v.", action, strings.Join(untracked, "\n\t"), action)
+	}
+
+	// Remove files which are no longer there first, in case
+	// directories need to be created in their place.
+	for path := range old {
+		if _, ok := newEntries[path]; ok {
+			continue
+		}
+		f, err := path.FilePath(c)
+		if err != nil {
+			return err
+		}
+		if f.Exists() {
+			if err := removeFileClean(f); err != nil {
 				return err
 			}
+		}
+	}
 
-			io.Copy(f2, r)
-			f2.Close()
+	newIdx := NewIndex()
+	for _, path := range paths {
+		entries := newEntries[path]
+		if !changed(path) {
+			// Keep the existing entry so that the stat info
+			// is still valid.
+			newIdx.Objects = append(newIdx.Objects, old[path])
+			continue
+		}
+		newIdx.Objects = append(newIdx.Objects, entries...)
+		if len(entries) == 1 && entries[0].Stage() == Stage0 {
+			if err := checkoutFile(c, entries[0], CheckoutIndexOptions{Force: true, UpdateStat: true}); err != nil {
+				return err
+			}
+			continue
 		}
 
-		// Only error out if there was at least 1 conflict, otherwise it was
-		// a success.
-		if errStr != "" {
-			return fmt.Errorf("%vAutomatic merge failed; fix conflicts and then commit the result.", errStr)
+		// It's a conflict. Write the content with conflict markers
+		// if there is any, otherwise our version if we have one.
+		var ours, theirs *IndexEntry
+		for _, e := range entries {
+			switch e.Stage() {
+			case Stage2:
+				ours = e
+			case Stage3:
+				theirs = e
+			}
+		}
+		if content, ok := result.Worktree[path]; ok {
+			f, err := path.FilePath(c)
+			if err != nil {
+				return err
+			}
+			mode := ModeBlob
+			if ours != nil {
+				mode = ours.Mode
+			}
+			if err := os.MkdirAll(filepath.Dir(f.String()), 0777); err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(f.String(), content, os.FileMode(mode)); err != nil {
+				return err
+			}
+		} else if ours != nil {
+			if !sameEntry(ours, old[path]) {
+				if err := checkoutFile(c, ours, CheckoutIndexOptions{Force: true}); err != nil {
+					return err
+				}
+			}
+		} else if theirs != nil {
+			if err := checkoutFile(c, theirs, CheckoutIndexOptions{Force: true}); err != nil {
+				return err
+			}
 		}
 	}
+	newIdx.NumberIndexEntries = uint32(len(newIdx.Objects))
 
-	// TODO: Finally, create the new commit.
-	return nil
+	f, err := c.GitDir.Create(File("index"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return newIdx.WriteIndex(f)
 }
@@ -0,0 +1,462 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testMergeSetup creates a repository with a base commit containing the
+// files in base, a branch "topic" with a commit that changes the files in
+// theirs, and a commit on master that changes the files in ours. HEAD is
+// left on master.
+// The caller must cleanup tmpdir when done.
+func testMergeSetup(t *testing.T, base, ours, theirs map[string]string) (c *Client, tmpdir string) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "gitmerge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpdir = dir
+
+	c, err = Init(nil, InitOptions{Quiet: true}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, env := range [][2]string{
+		{"GIT_COMMITTER_NAME", "John Smith"},
+		{"GIT_COMMITTER_EMAIL", "test@example.com"},
+		{"GIT_AUTHOR_NAME", "John Smith"},
+		{"GIT_AUTHOR_EMAIL", "test@example.com"},
+	} {
+		if err := os.Setenv(env[0], env[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	commitFiles := func(files map[string]string, msg string) {
+		var names []File
+		for name, content := range files {
+			if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, File(name))
+		}
+		if _, err := Add(c, AddOptions{}, names); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Commit(c, CommitOptions{}, CommitMessage(msg), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commitFiles(base, "base")
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CreateBranch("topic", head); err != nil {
+		t.Fatal(err)
+	}
+	if err := Checkout(c, CheckoutOptions{}, "topic", nil); err != nil {
+		t.Fatal(err)
+	}
+	commitFiles(theirs, "theirs")
+	if err := Checkout(c, CheckoutOptions{}, "master", nil); err != nil {
+		t.Fatal(err)
+	}
+	commitFiles(ours, "ours")
+	return
+}
+
+func TestMergeClean(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo.txt": "a\nb\nc\nd\ne\n", "bar.txt": "bar\n"},
+		map[string]string{"foo.txt": "A\nb\nc\nd\ne\n"},
+		map[string]string{"foo.txt": "a\nb\nc\nd\nE\n", "baz.txt": "baz\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic, err := RevParseCommitish(c, &RevParseOptions{}, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Merge(c, MergeOptions{NoEdit: true}, []Commitish{topic}); err != nil {
+		t.Fatal(err)
+	}
+
+	merge, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parents, err := merge.Parents(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topicid, _ := topic.CommitID(c)
+	if len(parents) != 2 || parents[0] != head || parents[1] != topicid {
+		t.Errorf("Unexpected merge parents: got %v want [%v %v]", parents, head, topicid)
+	}
+	if msg, _ := merge.GetCommitMessage(c); msg != "Merge branch 'topic'\n" {
+		t.Errorf("Unexpected merge message: got %q", msg)
+	}
+	if content, _ := ioutil.ReadFile("foo.txt"); string(content) != "A\nb\nc\nd\nE\n" {
+		t.Errorf("Unexpected merged content: got %q", content)
+	}
+	if content, _ := ioutil.ReadFile("baz.txt"); string(content) != "baz\n" {
+		t.Errorf("Unexpected content of file added by merge: got %q", content)
+	}
+	if c.GitDir.File("MERGE_HEAD").Exists() {
+		t.Error("MERGE_HEAD not removed after merge commit")
+	}
+	if orig, err := c.GitDir.File("ORIG_HEAD").ReadFirstLine(); err != nil || orig != head.String() {
+		t.Errorf("Unexpected ORIG_HEAD: got %v (%v) want %v", orig, err, head)
+	}
+	if err := Merge(c, MergeOptions{NoEdit: true}, []Commitish{topic}); err != AlreadyUpToDate {
+		t.Errorf("Unexpected error merging again: %v", err)
+	}
+}
+
+func TestMergeConflict(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo.txt": "foo\n"},
+		map[string]string{"foo.txt": "ours\n"},
+		map[string]string{"foo.txt": "theirs\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic, err := RevParseCommitish(c, &RevParseOptions{}, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Merge(c, MergeOptions{NoEdit: true}, []Commitish{topic}); err == nil {
+		t.Fatal("Expected conflicting merge to fail")
+	}
+	if !c.GitDir.File("MERGE_HEAD").Exists() {
+		t.Fatal("MERGE_HEAD not written for conflicting merge")
+	}
+	idx, err := c.GitDir.ReadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.GetUnmerged()) != 1 {
+		t.Errorf("Unexpected unmerged entries: %v", idx.GetUnmerged())
+	}
+	want := "<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> topic\n"
+	if content, _ := ioutil.ReadFile("foo.txt"); string(content) != want {
+		t.Errorf("Unexpected conflict markers: got %q want %q", content, want)
+	}
+	if _, err := Commit(c, CommitOptions{}, "Merge", nil); err == nil {
+		t.Error("Expected commit with unmerged files to fail")
+	}
+
+	// Aborting should go back to HEAD.
+	if err := MergeAbort(c, MergeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := ioutil.ReadFile("foo.txt"); string(content) != "ours\n" {
+		t.Errorf("Unexpected content after abort: got %q", content)
+	}
+	if c.GitDir.File("MERGE_HEAD").Exists() {
+		t.Error("MERGE_HEAD not removed by abort")
+	}
+	if err := MergeAbort(c, MergeOptions{}); err == nil {
+		t.Error("Expected abort without a merge in progress to fail")
+	}
+
+	// Resolve the conflict and continue.
+	if err := Merge(c, MergeOptions{NoEdit: true}, []Commitish{topic}); err == nil {
+		t.Fatal("Expected conflicting merge to fail")
+	}
+	if err := ioutil.WriteFile("foo.txt", []byte("resolved\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Add(c, AddOptions{}, []File{"foo.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	merge, err := MergeContinue(c, MergeOptions{NoEdit: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parents, err := merge.Parents(c); err != nil || len(parents) != 2 || parents[0] != head {
+		t.Errorf("Unexpected merge parents: %v (%v)", parents, err)
+	}
+	if msg, _ := merge.GetCommitMessage(c); msg != "Merge branch 'topic'\n" {
+		t.Errorf("Unexpected merge message: got %q", msg)
+	}
+	if c.GitDir.File("MERGE_HEAD").Exists() || c.GitDir.File("MERGE_MSG").Exists() {
+		t.Error("Merge state not removed after continuing")
+	}
+}
+
+func TestMergeOctopusConflict(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo.txt": "foo\n", "bar.txt": "bar\n"},
+		map[string]string{"foo.txt": "ours\n"},
+		map[string]string{"foo.txt": "theirs\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parents, err := head.Parents(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Add a branch which merges cleanly with both of the others.
+	if err := c.CreateBranch("clean", parents[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := Checkout(c, CheckoutOptions{}, "clean", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("bar.txt", []byte("clean\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Add(c, AddOptions{}, []File{"bar.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Commit(c, CommitOptions{}, "clean", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := Checkout(c, CheckoutOptions{}, "master", nil); err != nil {
+		t.Fatal(err)
+	}
+	var others []Commitish
+	for _, name := range []string{"topic", "clean"} {
+		cmt, err := RevParseCommitish(c, &RevParseOptions{}, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		others = append(others, cmt)
+	}
+
+	// A conflict before the last head leaves everything as it was
+	// before the merge.
+	if err := Merge(c, MergeOptions{NoEdit: true}, others); err == nil {
+		t.Fatal("Expected conflicting octopus merge to fail")
+	}
+	if cmt, err := c.GetHeadCommit(); err != nil || cmt != head {
+		t.Errorf("HEAD changed by failed octopus merge: got %v (%v)", cmt, err)
+	}
+	for _, name := range []File{"MERGE_HEAD", "MERGE_MSG", "MERGE_MODE"} {
+		if c.GitDir.File(name).Exists() {
+			t.Errorf("%v written by failed octopus merge", name)
+		}
+	}
+	idx, err := c.GitDir.ReadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.GetUnmerged()) != 0 {
+		t.Errorf("Unexpected unmerged entries: %v", idx.GetUnmerged())
+	}
+	for name, want := range map[string]string{"foo.txt": "ours\n", "bar.txt": "bar\n"} {
+		if content, _ := ioutil.ReadFile(name); string(content) != want {
+			t.Errorf("Unexpected %v after failed octopus merge: got %q want %q", name, content, want)
+		}
+	}
+
+	// A conflict in the last head is left to be resolved, with the
+	// name it was given in the conflict markers.
+	if err := Merge(c, MergeOptions{NoEdit: true}, []Commitish{others[1], others[0]}); err == nil {
+		t.Fatal("Expected conflicting octopus merge to fail")
+	}
+	if !c.GitDir.File("MERGE_HEAD").Exists() {
+		t.Fatal("MERGE_HEAD not written for conflict in the last head")
+	}
+	want := "<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> topic\n"
+	if content, _ := ioutil.ReadFile("foo.txt"); string(content) != want {
+		t.Errorf("Unexpected conflict markers: got %q want %q", content, want)
+	}
+	if content, _ := ioutil.ReadFile("bar.txt"); string(content) != "clean\n" {
+		t.Errorf("Clean head not merged: got %q", content)
+	}
+}
+
+func TestMergeNoCommitSquash(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo.txt": "foo\n"},
+		map[string]string{"bar.txt": "bar\n"},
+		map[string]string{"baz.txt": "baz\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic, err := RevParseCommitish(c, &RevParseOptions{}, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Merge(c, MergeOptions{Squash: true}, []Commitish{topic}); err != nil {
+		t.Fatal(err)
+	}
+	if cur, _ := c.GetHeadCommit(); cur != head {
+		t.Errorf("Squash merge updated HEAD")
+	}
+	if c.GitDir.File("MERGE_HEAD").Exists() || !c.GitDir.File("SQUASH_MSG").Exists() {
+		t.Error("Unexpected merge state for squash merge")
+	}
+	if !File("baz.txt").Exists() {
+		t.Error("Squash merge did not update work tree")
+	}
+	// The commits aren't decorated with topic, which points to them.
+	topicID, err := topic.CommitID(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	squashMsg, err := ioutil.ReadFile(c.GitDir.File("SQUASH_MSG").String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("Squashed commit of the following:\n\ncommit %v\nAuthor: ", topicID); !strings.HasPrefix(string(squashMsg), want) {
+		t.Errorf("Unexpected SQUASH_MSG %q", squashMsg)
+	}
+	if err := ResetMode(c, ResetOptions{Hard: true}, head); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.removeMergeState(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Merge(c, MergeOptions{NoCommit: true, Message: "Custom"}, []Commitish{topic}); err != nil {
+		t.Fatal(err)
+	}
+	if cur, _ := c.GetHeadCommit(); cur != head {
+		t.Errorf("Merge with NoCommit updated HEAD")
+	}
+	if msg, _ := c.GitDir.File("MERGE_MSG").ReadAll(); msg != "Custom\n" {
+		t.Errorf("Unexpected MERGE_MSG: got %q", msg)
+	}
+	merge, err := MergeContinue(c, MergeOptions{NoEdit: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parents, _ := merge.Parents(c); len(parents) != 2 {
+		t.Errorf("Unexpected merge parents: %v", parents)
+	}
+}
+
+func TestMergeStrategyOptions(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo.txt": "foo\n"},
+		map[string]string{"foo.txt": "ours\n"},
+		map[string]string{"foo.txt": "theirs\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	topic, err := RevParseCommitish(c, &RevParseOptions{}, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Merge(c, MergeOptions{NoEdit: true, StrategyOptions: []string{"bogus"}}, []Commitish{topic}); err == nil {
+		t.Error("Expected unknown strategy option to fail")
+	}
+	if err := Merge(c, MergeOptions{NoEdit: true, StrategyOptions: []string{"theirs"}}, []Commitish{topic}); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := ioutil.ReadFile("foo.txt"); string(content) != "theirs\n" {
+		t.Errorf("Unexpected content with -X theirs: got %q", content)
+	}
+}
+
+func TestMergeRenames(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo.txt": "a\nb\nc\nd\ne\nf\n"},
+		map[string]string{"foo.txt": "A\nb\nc\nd\ne\nf\n"},
+		map[string]string{"foo.txt": "a\nb\nc\nd\ne\nF\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	// Rename the file on topic, so that the change from master needs to
+	// follow it.
+	if err := Checkout(c, CheckoutOptions{}, "topic", nil); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile("foo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("bar.txt", content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Add(c, AddOptions{}, []File{"bar.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Rm(c, RmOptions{}, []File{"foo.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Commit(c, CommitOptions{}, "rename", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := Checkout(c, CheckoutOptions{}, "master", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	topic, err := RevParseCommitish(c, &RevParseOptions{}, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Merge(c, MergeOptions{NoEdit: true}, []Commitish{topic}); err != nil {
+		t.Fatal(err)
+	}
+	if File("foo.txt").Exists() {
+		t.Error("Renamed file still exists after merge")
+	}
+	if content, _ := ioutil.ReadFile("bar.txt"); string(content) != "A\nb\nc\nd\ne\nF\n" {
+		t.Errorf("Unexpected content of renamed file: got %q", content)
+	}
+}
+
+func TestMergeOursStrategy(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo.txt": "foo\n"},
+		map[string]string{"foo.txt": "ours\n"},
+		map[string]string{"foo.txt": "theirs\n", "bar.txt": "bar\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic, err := RevParseCommitish(c, &RevParseOptions{}, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Merge(c, MergeOptions{NoEdit: true, Strategy: MergeOurs}, []Commitish{topic}); err != nil {
+		t.Fatal(err)
+	}
+	merge, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parents, _ := merge.Parents(c); len(parents) != 2 {
+		t.Errorf("Unexpected merge parents: %v", parents)
+	}
+	want, _ := head.TreeID(c)
+	if got, _ := merge.TreeID(c); got != want {
+		t.Errorf("Unexpected tree for ours strategy: got %v want %v", got, want)
+	}
+	if File("bar.txt").Exists() {
+		t.Error("Ours strategy added file from other branch")
+	}
+}
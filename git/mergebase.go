@@ -2,6 +2,7 @@ package git
 
 import (
 	"fmt"
+	"sort"
 )
 
 type MergeBaseOptions struct {
@@ -110,3 +111,64 @@ func MergeBaseOctopus(c *Client, options MergeBaseOptions, commits []Commitish)
 	}
 	return bestSoFar.CommitID(c)
 }
+
+// MergeBaseAll returns all of the best common ancestors of a and b, as
+// "git merge-base --all" would. There may be more than one in the case
+// of criss-cross merges.
+func MergeBaseAll(c *Client, a, b Commitish) ([]CommitID, error) {
+	acmt, err := a.CommitID(c)
+	if err != nil {
+		return nil, err
+	}
+	bcmt, err := b.CommitID(c)
+	if err != nil {
+		return nil, err
+	}
+	aAncestors, err := acmt.AncestorMap(c)
+	if err != nil {
+		return nil, err
+	}
+	bAncestors, err := bcmt.AncestorMap(c)
+	if err != nil {
+		return nil, err
+	}
+	var common []CommitID
+	for cmt := range aAncestors {
+		if _, ok := bAncestors[cmt]; ok {
+			common = append(common, cmt)
+		}
+	}
+
+	// A common ancestor is only one of the best if it's not reachable
+	// from any other common ancestor, so mark everything reachable from
+	// the parents of each.
+	redundant := make(map[CommitID]struct{})
+	for _, cmt := range common {
+		parents, err := cmt.Parents(c)
+		if err != nil {
+			return nil, err
+		}
+		queue := parents
+		for len(queue) > 0 {
+			next := queue[0]
+			queue = queue[1:]
+			if _, ok := redundant[next]; ok {
+				continue
+			}
+			redundant[next] = struct{}{}
+			grandparents, err := next.Parents(c)
+			if err != nil {
+				return nil, err
+			}
+			queue = append(queue, grandparents...)
+		}
+	}
+	var bases []CommitID
+	for _, cmt := range common {
+		if _, ok := redundant[cmt]; !ok {
+			bases = append(bases, cmt)
+		}
+	}
+	sort.Slice(bases, func(i, j int) bool { return bases[i].String() < bases[j].String() })
+	return bases, nil
+}
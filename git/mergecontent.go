@@ -0,0 +1,178 @@
+package git
+
+import (
+	"strings"
+)
+
+// contentMergeOptions are the options that affect a three-way merge of
+// the content of a file.
+type contentMergeOptions struct {
+	// The labels to use for each side in conflict markers.
+	OursLabel, BaseLabel, TheirsLabel string
+
+	// How to resolve conflicting hunks instead of adding conflict
+	// markers. May be "", "ours", "theirs" or "union".
+	Favor string
+
+	IgnoreSpaceChange bool
+	IgnoreAllSpace    bool
+
+	// Include the base version in conflict markers, like git's
+	// "diff3" conflict style.
+	Diff3 bool
+}
+
+// mergeContent does a line based three-way merge of the changes from
+// base to ours and base to theirs. It returns the merged content, and the
+// number of conflicts that were marked with conflict markers.
+func mergeContent(base, ours, theirs []byte, opts contentMergeOptions) ([]byte, int) {
+	b, o, t := splitLines(base), splitLines(ours), splitLines(theirs)
+	key := lineKey(opts.IgnoreSpaceChange, opts.IgnoreAllSpace)
+	eq := lineEqual(key)
+	hO := xdiffLines(b, o, key, false)
+	hT := xdiffLines(b, t, key, false)
+
+	var out []string
+	conflicts := 0
+
+	// pos is the position in base up to which output has been
+	// generated, and offO/offT are the offsets between base line
+	// numbers and ours/theirs line numbers at pos.
+	pos, offO, offT := 0, 0, 0
+	i, j := 0, 0
+	for i < len(hO) || j < len(hT) {
+		// Find the group of hunks from either side which overlap or
+		// touch each other.
+		var lo int
+		switch {
+		case i >= len(hO):
+			lo = hT[j].AStart
+		case j >= len(hT):
+			lo = hO[i].AStart
+		case hO[i].AStart < hT[j].AStart:
+			lo = hO[i].AStart
+		default:
+			lo = hT[j].AStart
+		}
+		hi := lo
+		firstO, firstT := i, j
+		for {
+			if i < len(hO) && hO[i].AStart <= hi {
+				if hO[i].AEnd > hi {
+					hi = hO[i].AEnd
+				}
+				i++
+				continue
+			}
+			if j < len(hT) && hT[j].AStart <= hi {
+				if hT[j].AEnd > hi {
+					hi = hT[j].AEnd
+				}
+				j++
+				continue
+			}
+			break
+		}
+
+		// Unchanged lines before the group. Use our version of them,
+		// since they may only be equal to base modulo whitespace.
+		out = append(out, o[pos+offO:lo+offO]...)
+
+		oLo, oHi := lo+offO, hi+offO
+		if i > firstO {
+			oLo = hO[firstO].BStart - (hO[firstO].AStart - lo)
+			oHi = hO[i-1].BEnd + (hi - hO[i-1].AEnd)
+			offO = hO[i-1].BEnd - hO[i-1].AEnd
+		}
+		tLo, tHi := lo+offT, hi+offT
+		if j > firstT {
+			tLo = hT[firstT].BStart - (hT[firstT].AStart - lo)
+			tHi = hT[j-1].BEnd + (hi - hT[j-1].AEnd)
+			offT = hT[j-1].BEnd - hT[j-1].AEnd
+		}
+		oSeg, tSeg := o[oLo:oHi], t[tLo:tHi]
+
+		switch {
+		case j == firstT:
+			out = append(out, oSeg...)
+		case i == firstO:
+			out = append(out, tSeg...)
+		case linesEqual(oSeg, tSeg, eq):
+			out = append(out, oSeg...)
+		default:
+			switch opts.Favor {
+			case "ours":
+				out = append(out, oSeg...)
+			case "theirs":
+				out = append(out, tSeg...)
+			case "union":
+				out = appendTerminated(out, oSeg)
+				out = append(out, tSeg...)
+			default:
+				out = appendConflict(out, oSeg, b[lo:hi], tSeg, opts)
+				conflicts++
+			}
+		}
+		pos = hi
+	}
+	out = append(out, o[pos+offO:]...)
+	return []byte(strings.Join(out, "")), conflicts
+}
+
+func linesEqual(a, b []string, eq func(x, y string) bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !eq(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// appendTerminated appends lines to out, making sure that the last line
+// ends in a newline so that whatever comes next starts on its own line.
+func appendTerminated(out, lines []string) []string {
+	out = append(out, lines...)
+	if l := len(out); l > 0 && !strings.HasSuffix(out[l-1], "\n") {
+		out[l-1] += "\n"
+	}
+	return out
+}
+
+// appendConflict appends a conflict between ours and theirs to out,
+// surrounded by conflict markers. Lines at the start or end that are
+// the same in both are moved outside of the markers.
+func appendConflict(out, ours, base, theirs []string, opts contentMergeOptions) []string {
+	if !opts.Diff3 {
+		for len(ours) > 0 && len(theirs) > 0 && ours[0] == theirs[0] {
+			out = append(out, ours[0])
+			ours, theirs = ours[1:], theirs[1:]
+		}
+	}
+	var suffix []string
+	if !opts.Diff3 {
+		for len(ours) > 0 && len(theirs) > 0 && ours[len(ours)-1] == theirs[len(theirs)-1] {
+			suffix = append([]string{ours[len(ours)-1]}, suffix...)
+			ours, theirs = ours[:len(ours)-1], theirs[:len(theirs)-1]
+		}
+	}
+	marker := func(m, label string) string {
+		if label == "" {
+			return m + "\n"
+		}
+		return m + " " + label + "\n"
+	}
+	out = appendTerminated(out, nil)
+	out = append(out, marker("<<<<<<<", opts.OursLabel))
+	out = appendTerminated(out, ours)
+	if opts.Diff3 {
+		out = append(out, marker("|||||||", opts.BaseLabel))
+		out = appendTerminated(out, base)
+	}
+	out = append(out, "=======\n")
+	out = appendTerminated(out, theirs)
+	out = append(out, marker(">>>>>>>", opts.TheirsLabel))
+	return append(out, suffix...)
+}
@@ -0,0 +1,88 @@
+package git
+
+import (
+	"testing"
+)
+
+func TestMergeContent(t *testing.T) {
+	tests := []struct {
+		base, ours, theirs string
+		opts               contentMergeOptions
+		want               string
+		conflicts          int
+	}{
+		// Changes to different lines merge cleanly.
+		{
+			"a\nb\nc\nd\n", "A\nb\nc\nd\n", "a\nb\nc\nD\n",
+			contentMergeOptions{},
+			"A\nb\nc\nD\n", 0,
+		},
+		// The same change on both sides.
+		{
+			"a\nb\n", "a\nB\n", "a\nB\n",
+			contentMergeOptions{},
+			"a\nB\n", 0,
+		},
+		// Conflicting changes, with common lines moved out of the
+		// conflict markers.
+		{
+			"a\nb\nc\n", "a\nx\ny\n", "a\nz\ny\n",
+			contentMergeOptions{OursLabel: "ours", TheirsLabel: "theirs"},
+			"a\n<<<<<<< ours\nx\n=======\nz\n>>>>>>> theirs\ny\n", 1,
+		},
+		{
+			"a\nb\nc\n", "a\nx\nc\n", "a\ny\nc\n",
+			contentMergeOptions{OursLabel: "ours", BaseLabel: "base", TheirsLabel: "theirs", Diff3: true},
+			"a\n<<<<<<< ours\nx\n||||||| base\nb\n=======\ny\n>>>>>>> theirs\nc\n", 1,
+		},
+		{
+			"a\nb\nc\n", "a\nx\nc\n", "a\ny\nc\n",
+			contentMergeOptions{Favor: "ours"},
+			"a\nx\nc\n", 0,
+		},
+		{
+			"a\nb\nc\n", "a\nx\nc\n", "a\ny\nc\n",
+			contentMergeOptions{Favor: "theirs"},
+			"a\ny\nc\n", 0,
+		},
+		{
+			"a\nb\nc\n", "a\nx\nc\n", "a\ny\nc\n",
+			contentMergeOptions{Favor: "union"},
+			"a\nx\ny\nc\n", 0,
+		},
+		// A whitespace-only change on one side doesn't conflict with
+		// a real change on the other when ignoring space changes.
+		{
+			"a\nb c\n", "a\nb  c\n", "a\nB c\n",
+			contentMergeOptions{IgnoreSpaceChange: true},
+			"a\nB c\n", 0,
+		},
+		// A missing newline at the end of the file.
+		{
+			"a\nb", "a\nb\nc", "z\na\nb",
+			contentMergeOptions{},
+			"z\na\nb\nc", 0,
+		},
+	}
+	for i, tc := range tests {
+		got, conflicts := mergeContent([]byte(tc.base), []byte(tc.ours), []byte(tc.theirs), tc.opts)
+		if string(got) != tc.want || conflicts != tc.conflicts {
+			t.Errorf("Test %d: got %q (%d conflicts) want %q (%d conflicts)", i, got, conflicts, tc.want, tc.conflicts)
+		}
+	}
+}
+
+func TestXdiffLines(t *testing.T) {
+	a := splitLines([]byte("a\nb\nc\nd\ne\n"))
+	b := splitLines([]byte("a\nc\nd\nx\ne\nf\n"))
+	got := xdiffLines(a, b, nil, false)
+	want := []diffHunk{{1, 2, 1, 1}, {4, 4, 3, 4}, {5, 5, 5, 6}}
+	if len(got) != len(want) {
+		t.Fatalf("Unexpected hunks: got %v want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Hunk %d: got %v want %v", i, got[i], want[i])
+		}
+	}
+}
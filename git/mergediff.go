@@ -0,0 +1,219 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// WriteMergeDiff writes the changes made by the merge commit cmt to w in
+// the formats selected by opts, which are shown as selected by
+// opts.DiffMerges. Only the files which match paths are compared, or every
+// file if there are none.
+//
+// header is called to write the commit's header before its changes. It's
+// called with the parent that they're against for "separate" diffs, which
+// show the changes against each parent in turn, and with nil otherwise.
+// Except for combined diffs, which always show the header like git, it
+// isn't called if there are no changes to show, which is returned.
+func WriteMergeDiff(c *Client, opts DiffCommonOptions, cmt CommitID, paths []string, w io.Writer, header func(from *CommitID) error) (bool, error) {
+	parents, err := cmt.Parents(c)
+	if err != nil {
+		return false, err
+	}
+	if len(parents) < 2 {
+		return false, fmt.Errorf("%v is not a merge commit", cmt)
+	}
+	treeOpts := &DiffTreeOptions{DiffCommonOptions: opts, Recurse: true}
+
+	// Each part is written to a buffer first, so that the header is
+	// only written if there's something to show.
+	shown := false
+	var buf bytes.Buffer
+	flush := func(from *CommitID) error {
+		if buf.Len() == 0 {
+			return nil
+		}
+		shown = true
+		if err := header(from); err != nil {
+			return err
+		}
+		_, err := buf.WriteTo(w)
+		return err
+	}
+
+	switch opts.DiffMerges {
+	case "", "off":
+		return false, nil
+	case "first-parent":
+		diffs, err := DiffTree(c, treeOpts, parents[0], cmt, paths)
+		if err != nil {
+			return false, err
+		}
+		if err := GeneratePatch(c, opts, diffs, &buf); err != nil {
+			return false, err
+		}
+		return shown, flush(nil)
+	case "separate":
+		for i := range parents {
+			diffs, err := DiffTree(c, treeOpts, parents[i], cmt, paths)
+			if err != nil {
+				return false, err
+			}
+			if err := GeneratePatch(c, opts, diffs, &buf); err != nil {
+				return false, err
+			}
+			if err := flush(&parents[i]); err != nil {
+				return false, err
+			}
+		}
+		return shown, nil
+	case "combined", "dense-combined":
+		diffs, err := DiffCombined(c, cmt, paths)
+		if err != nil {
+			return false, err
+		}
+		var stats []HashDiff
+		if opts.Stat || opts.NumStat || opts.ShortStat || opts.DirStat {
+			if stats, err = DiffTree(c, treeOpts, parents[0], cmt, paths); err != nil {
+				return false, err
+			}
+		}
+		if err := GenerateCombinedDiff(c, opts, diffs, stats, &buf); err != nil {
+			return false, err
+		}
+		if err := header(nil); err != nil {
+			return false, err
+		}
+		_, err = buf.WriteTo(w)
+		return true, err
+	case "remerge":
+		if len(parents) != 2 {
+			fmt.Fprintf(os.Stderr, "diff: warning: Skipping remerge-diff for octopus merges.\n")
+			return false, nil
+		}
+		diffs, err := remergeDiff(c, opts, cmt, parents[0], parents[1], paths)
+		if err != nil {
+			return false, err
+		}
+		if err := GeneratePatch(c, opts, diffs, &buf); err != nil {
+			return false, err
+		}
+		return shown, flush(nil)
+	default:
+		return false, fmt.Errorf("unknown value for --diff-merges: %v", opts.DiffMerges)
+	}
+}
+
+// remergeDiff merges ours and theirs, the parents of cmt, again and returns
+// the changes from the result, with the conflict markers left in it, to
+// cmt. The messages about the conflicts in each file are added to its
+// patch header, including the files which have the same contents as cmt.
+func remergeDiff(c *Client, opts DiffCommonOptions, cmt, ours, theirs CommitID, paths []string) ([]HashDiff, error) {
+	label := func(cmt CommitID) (string, error) {
+		msg, err := cmt.GetCommitMessage(c)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%v (%v)", Sha1(cmt).Abbrev(c, 7), msg.Subject()), nil
+	}
+	oursLabel, err := label(ours)
+	if err != nil {
+		return nil, err
+	}
+	theirsLabel, err := label(theirs)
+	if err != nil {
+		return nil, err
+	}
+	result, err := mergeCommits(c, mergeTreeOptions{
+		contentMergeOptions: contentMergeOptions{
+			OursLabel:   oursLabel,
+			BaseLabel:   "merged common ancestors",
+			TheirsLabel: theirsLabel,
+			Diff3:       c.GetConfig("merge.conflictstyle") == "diff3",
+		},
+	}, ours, theirs)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := result.writeTreeWithConflicts(c)
+	if err != nil {
+		return nil, err
+	}
+	diffs, err := DiffTree(c, &DiffTreeOptions{DiffCommonOptions: opts, Recurse: true}, tree, cmt, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	// Messages which only say that a file was merged aren't shown.
+	var messages []string
+	for _, msg := range result.Messages {
+		if !strings.HasPrefix(msg, "Auto-merging ") {
+			messages = append(messages, msg)
+		}
+	}
+	if len(messages) == 0 {
+		return diffs, nil
+	}
+	files := make([]File, len(paths))
+	for i, p := range paths {
+		files[i] = File(p)
+	}
+	spec, err := newPathspec(c, files)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := GetIndexMap(c, cmt)
+	if err != nil {
+		return nil, err
+	}
+	indexes := make(map[IndexPath]int)
+	for i, d := range diffs {
+		indexes[d.Name] = i
+	}
+	for _, p := range result.Conflicts {
+		if !spec.Matches(p, false) {
+			continue
+		}
+		var headers []string
+		for _, msg := range messages {
+			if mentionsPath(msg, p) {
+				headers = append(headers, "remerge "+msg)
+			}
+		}
+		if len(headers) == 0 {
+			continue
+		}
+		if i, ok := indexes[p]; ok {
+			diffs[i].ExtraHeaders = headers
+			continue
+		}
+		// The conflict was resolved the same way as it was
+		// re-merged, so only the messages are shown.
+		e, ok := objects[p]
+		if !ok {
+			continue
+		}
+		entry := TreeEntry{e.Sha1, e.Mode}
+		diffs = append(diffs, HashDiff{Name: p, Src: entry, Dst: entry, ExtraHeaders: headers})
+	}
+	sort.Sort(ByName(diffs))
+	return diffs, nil
+}
+
+// mentionsPath returns whether the merge message msg is about the file p.
+func mentionsPath(msg string, p IndexPath) bool {
+	for rest := msg; ; {
+		i := strings.Index(rest, " "+p.String())
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+1+len(p):]
+		if rest == "" || rest[0] == ' ' || rest[0] == '.' || rest[0] == ',' {
+			return true
+		}
+	}
+}
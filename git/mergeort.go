@@ -0,0 +1,634 @@
+package git
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// mergeTreeOptions are the options that affect how mergeTrees merges
+// trees.
+type mergeTreeOptions struct {
+	// Options for merging the content of files. The labels are also
+	// used in conflict messages.
+	contentMergeOptions
+
+	// Do not detect renames between the base and each side.
+	NoRenames bool
+
+	// The similarity threshold for renames as a percentage. The
+	// default is used if 0.
+	RenameThreshold int
+
+	// Shift their tree (and the merge base) to line up with a
+	// subdirectory of ours, for the subtree strategy. If subtreePrefix
+	// is empty, the subdirectory is guessed from the content.
+	subtree       bool
+	subtreePrefix IndexPath
+
+	// Set when merging merge bases into a virtual merge base. Conflicts
+	// are resolved at stage 0, with conflict markers in the content.
+	virtual bool
+}
+
+// treeMergeResult is the result of merging two trees.
+type treeMergeResult struct {
+	// An index of the result of the merge. Conflicts are recorded in
+	// stages 1 to 3.
+	Index *Index
+
+	// The content that should be written to the work tree for
+	// conflicted paths, if it's not simply one of the stages (ie. if it
+	// contains conflict markers.)
+	Worktree map[IndexPath][]byte
+
+	// The paths which have conflicts, in order.
+	Conflicts []IndexPath
+
+	// Informational messages about the merge, such as the files that
+	// were merged and the conflicts.
+	Messages []string
+}
+
+// Clean returns true if the merge did not have any conflicts.
+func (r *treeMergeResult) Clean() bool {
+	return len(r.Conflicts) == 0
+}
+
+// WriteTree writes the result of a clean merge to the object database.
+func (r *treeMergeResult) WriteTree(c *Client) (TreeID, error) {
+	if !r.Clean() {
+		return TreeID{}, fmt.Errorf("Can not write tree with unmerged entries")
+	}
+	return WriteTreeFromIndex(c, r.Index, WriteTreeOptions{})
+}
+
+// writeTreeWithConflicts writes the result of the merge to the object
+// database, including conflicts. Conflicted files are written the way
+// that they would be checked out into the work tree, with conflict
+// markers if the content was merged.
+func (r *treeMergeResult) writeTreeWithConflicts(c *Client) (TreeID, error) {
+	idx := NewIndex()
+	seen := make(map[IndexPath]bool)
+	for _, e := range r.Index.Objects {
+		if e.Stage() == Stage0 {
+			idx.Objects = append(idx.Objects, e)
+			continue
+		}
+		if seen[e.PathName] {
+			continue
+		}
+		seen[e.PathName] = true
+		var ours, theirs *IndexEntry
+		for _, s := range r.Index.Objects {
+			if s.PathName != e.PathName {
+				continue
+			}
+			switch s.Stage() {
+			case Stage2:
+				ours = s
+			case Stage3:
+				theirs = s
+			}
+		}
+		if content, ok := r.Worktree[e.PathName]; ok {
+			sha, err := c.WriteObject("blob", content)
+			if err != nil {
+				return TreeID{}, err
+			}
+			mode := ModeBlob
+			if ours != nil {
+				mode = ours.Mode
+			}
+			idx.Objects = append(idx.Objects, newMergeIndexEntry(e.PathName, &IndexEntry{FixedIndexEntry: FixedIndexEntry{Mode: mode, Sha1: sha, Fsize: uint32(len(content))}}, Stage0))
+		} else if ours != nil {
+			idx.Objects = append(idx.Objects, newMergeIndexEntry(e.PathName, ours, Stage0))
+		} else if theirs != nil {
+			idx.Objects = append(idx.Objects, newMergeIndexEntry(e.PathName, theirs, Stage0))
+		}
+	}
+	idx.NumberIndexEntries = uint32(len(idx.Objects))
+	return WriteTreeFromIndex(c, idx, WriteTreeOptions{})
+}
+
+// mergeItem is a path with the versions of it from each side of the
+// merge, after taking renames into account.
+type mergeItem struct {
+	base, ours, theirs *IndexEntry
+
+	// Set for conflicts which are detected before looking at the
+	// content, such as rename/delete.
+	conflicted bool
+}
+
+func sameEntry(a, b *IndexEntry) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Sha1 == b.Sha1 && a.Mode == b.Mode
+}
+
+// newMergeIndexEntry creates an index entry with no stat information for
+// the result of a merge.
+func newMergeIndexEntry(path IndexPath, e *IndexEntry, stage Stage) *IndexEntry {
+	flags := uint16(stage) << 12
+	if len(path) >= 0x0FFF {
+		flags |= 0x0FFF
+	} else {
+		flags |= uint16(len(path)) & 0x0FFF
+	}
+	return &IndexEntry{
+		FixedIndexEntry: FixedIndexEntry{
+			Mode:  e.Mode,
+			Fsize: e.Fsize,
+			Sha1:  e.Sha1,
+			Flags: flags,
+		},
+		V3IndexExtensions: &V3IndexExtensions{},
+		PathName:          path,
+	}
+}
+
+// mergeTreeMaps does a three-way merge of the trees ours and theirs, with
+// base as the common ancestor. Files changed on both sides are merged
+// line by line, and renames between base and either side are detected
+// and followed unless opts.NoRenames is set.
+//
+// The result is only computed in memory (other than writing new blobs to
+// the object database), the index and work tree are not touched.
+func mergeTreeMaps(c *Client, opts mergeTreeOptions, base, ours, theirs IndexMap) (*treeMergeResult, error) {
+	result := &treeMergeResult{Worktree: make(map[IndexPath][]byte)}
+	items := make(map[IndexPath]*mergeItem)
+	get := func(path IndexPath) *mergeItem {
+		it, ok := items[path]
+		if !ok {
+			it = &mergeItem{}
+			items[path] = it
+		}
+		return it
+	}
+	for path, e := range base {
+		get(path).base = e
+	}
+	for path, e := range ours {
+		get(path).ours = e
+	}
+	for path, e := range theirs {
+		get(path).theirs = e
+	}
+	conflictMsg := func(format string, args ...interface{}) {
+		if !opts.virtual {
+			result.Messages = append(result.Messages, fmt.Sprintf("CONFLICT "+format, args...))
+		}
+	}
+
+	if !opts.NoRenames {
+		oursRenames, err := sideRenames(c, opts.RenameThreshold, base, ours)
+		if err != nil {
+			return nil, err
+		}
+		theirsRenames, err := sideRenames(c, opts.RenameThreshold, base, theirs)
+		if err != nil {
+			return nil, err
+		}
+		var sources []IndexPath
+		for src := range oursRenames {
+			sources = append(sources, src)
+		}
+		for src := range theirsRenames {
+			if _, ok := oursRenames[src]; !ok {
+				sources = append(sources, src)
+			}
+		}
+		sort.Slice(sources, func(i, j int) bool { return sources[i] < sources[j] })
+
+		for _, src := range sources {
+			dstO, okO := oursRenames[src]
+			dstT, okT := theirsRenames[src]
+			switch {
+			case okO && okT && dstO == dstT:
+				// Both sides did the same rename.
+				items[dstO].base = base[src]
+				delete(items, src)
+			case okO && okT:
+				conflictMsg("(rename/rename): %v renamed to %v in %v and to %v in %v.", src, dstO, opts.OursLabel, dstT, opts.TheirsLabel)
+				for _, dst := range []IndexPath{dstO, dstT} {
+					items[dst].base = base[src]
+					items[dst].conflicted = true
+				}
+				delete(items, src)
+			case okO:
+				it := items[dstO]
+				if it.theirs != nil || it.base != nil {
+					// Something else is in the way of the
+					// rename, so treat them as separate files.
+					continue
+				}
+				it.base = base[src]
+				if t := items[src].theirs; t != nil {
+					it.theirs = t
+				} else {
+					conflictMsg("(rename/delete): %v renamed to %v in %v, but deleted in %v.", src, dstO, opts.OursLabel, opts.TheirsLabel)
+					it.conflicted = true
+				}
+				delete(items, src)
+			case okT:
+				it := items[dstT]
+				if it.ours != nil || it.base != nil {
+					continue
+				}
+				it.base = base[src]
+				if o := items[src].ours; o != nil {
+					it.ours = o
+				} else {
+					conflictMsg("(rename/delete): %v renamed to %v in %v, but deleted in %v.", src, dstT, opts.TheirsLabel, opts.OursLabel)
+					it.conflicted = true
+				}
+				delete(items, src)
+			}
+		}
+	}
+
+	// Look for files on one side that are in the way of a directory on
+	// the other, and move them out of the way.
+	oursDirs := make(map[IndexPath]bool)
+	theirsDirs := make(map[IndexPath]bool)
+	for path, it := range items {
+		for dir := parentDir(path); dir != ""; dir = parentDir(dir) {
+			if it.ours != nil {
+				oursDirs[dir] = true
+			}
+			if it.theirs != nil {
+				theirsDirs[dir] = true
+			}
+		}
+	}
+	var dfPaths []IndexPath
+	for path, it := range items {
+		if (it.theirs != nil && oursDirs[path]) || (it.ours != nil && theirsDirs[path]) {
+			dfPaths = append(dfPaths, path)
+		}
+	}
+	sort.Slice(dfPaths, func(i, j int) bool { return dfPaths[i] < dfPaths[j] })
+	for _, path := range dfPaths {
+		it := items[path]
+		label, moved := opts.OursLabel, &mergeItem{ours: it.ours, conflicted: true}
+		if it.theirs != nil && oursDirs[path] {
+			if sameEntry(it.base, it.theirs) {
+				// Unmodified, so it can be deleted to make
+				// room for the directory.
+				delete(items, path)
+				continue
+			}
+			label, moved = opts.TheirsLabel, &mergeItem{theirs: it.theirs, conflicted: true}
+		} else if sameEntry(it.base, it.ours) {
+			delete(items, path)
+			continue
+		}
+		newpath := IndexPath(fmt.Sprintf("%v~%v", path, strings.Replace(label, "/", "_", -1)))
+		for items[newpath] != nil {
+			newpath += "_"
+		}
+		conflictMsg("(file/directory): directory in the way of %v from %v; moving it to %v instead.", path, label, newpath)
+		items[newpath] = moved
+		delete(items, path)
+	}
+
+	paths := make([]IndexPath, 0, len(items))
+	for path := range items {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool { return paths[i] < paths[j] })
+
+	idx := NewIndex()
+	stage0 := func(path IndexPath, e *IndexEntry) {
+		idx.Objects = append(idx.Objects, newMergeIndexEntry(path, e, Stage0))
+	}
+	conflict := func(path IndexPath, it *mergeItem) {
+		for i, e := range []*IndexEntry{it.base, it.ours, it.theirs} {
+			if e != nil {
+				idx.Objects = append(idx.Objects, newMergeIndexEntry(path, e, Stage(i+1)))
+			}
+		}
+		result.Conflicts = append(result.Conflicts, path)
+	}
+
+	for _, path := range paths {
+		it := items[path]
+		b, o, t := it.base, it.ours, it.theirs
+		if it.conflicted {
+			if opts.virtual {
+				if o != nil {
+					stage0(path, o)
+				} else if t != nil {
+					stage0(path, t)
+				}
+				continue
+			}
+			conflict(path, it)
+			continue
+		}
+		switch {
+		case sameEntry(o, t):
+			if o != nil {
+				stage0(path, o)
+			}
+			continue
+		case sameEntry(b, o):
+			if t != nil {
+				stage0(path, t)
+			}
+			continue
+		case sameEntry(b, t):
+			if o != nil {
+				stage0(path, o)
+			}
+			continue
+		case o == nil || t == nil:
+			if opts.virtual {
+				if o != nil {
+					stage0(path, o)
+				} else {
+					stage0(path, t)
+				}
+				continue
+			}
+			if o == nil {
+				conflictMsg("(modify/delete): %v deleted in %v and modified in %v. Version %v of %v left in tree.", path, opts.OursLabel, opts.TheirsLabel, opts.TheirsLabel, path)
+			} else {
+				conflictMsg("(modify/delete): %v deleted in %v and modified in %v. Version %v of %v left in tree.", path, opts.TheirsLabel, opts.OursLabel, opts.OursLabel, path)
+			}
+			conflict(path, it)
+			continue
+		}
+
+		// Both sides changed the file in different ways, so try
+		// merging the content.
+		if !opts.virtual {
+			result.Messages = append(result.Messages, fmt.Sprintf("Auto-merging %v", path))
+		}
+		merged, ok, err := mergeItemContent(c, opts, path, it)
+		if err != nil {
+			return nil, err
+		}
+		if !ok && opts.virtual && merged.mode == 0 {
+			// Submodules and files of different types can't be
+			// merged, so the virtual merge base keeps our side of
+			// them, as it does for binary files.
+			stage0(path, o)
+			continue
+		}
+		if ok || opts.virtual {
+			sha, err := c.WriteObject("blob", merged.content)
+			if err != nil {
+				return nil, err
+			}
+			stage0(path, &IndexEntry{FixedIndexEntry: FixedIndexEntry{Mode: merged.mode, Sha1: sha, Fsize: uint32(len(merged.content))}})
+			continue
+		}
+		switch {
+		case merged.reason != "":
+			conflictMsg("%v", merged.reason)
+		case b == nil:
+			conflictMsg("(add/add): Merge conflict in %v", path)
+		default:
+			conflictMsg("(content): Merge conflict in %v", path)
+		}
+		if merged.content != nil {
+			result.Worktree[path] = merged.content
+		}
+		conflict(path, it)
+	}
+	sort.Sort(ByPath(idx.Objects))
+	idx.NumberIndexEntries = uint32(len(idx.Objects))
+	result.Index = idx
+	return result, nil
+}
+
+// mergedContent is the result of merging the contents of a file.
+type mergedContent struct {
+	content []byte
+	mode    EntryMode
+
+	// The reason for a conflict if it isn't a normal content conflict.
+	reason string
+}
+
+// mergeItemContent merges the content of a file which was changed on
+// both sides. It returns the merged content and true if the merge was
+// clean.
+func mergeItemContent(c *Client, opts mergeTreeOptions, path IndexPath, it *mergeItem) (mergedContent, bool, error) {
+	b, o, t := it.base, it.ours, it.theirs
+
+	// Use our mode unless only they changed it.
+	mode := o.Mode
+	if b != nil && o.Mode == b.Mode {
+		mode = t.Mode
+	}
+	if o.Mode == ModeCommit || t.Mode == ModeCommit {
+		return mergedContent{reason: fmt.Sprintf("(submodule): Merge conflict in %v", path)}, false, nil
+	}
+	if o.Mode.TreeType() != t.Mode.TreeType() || (o.Mode == ModeSymlink) != (t.Mode == ModeSymlink) {
+		return mergedContent{reason: fmt.Sprintf("(distinct types): %v had different types on each side", path)}, false, nil
+	}
+
+	load := func(e *IndexEntry) ([]byte, error) {
+		if e == nil || e.Mode.TreeType() != "blob" {
+			return nil, nil
+		}
+		obj, err := c.GetObject(e.Sha1)
+		if err != nil {
+			return nil, err
+		}
+		return obj.GetContent(), nil
+	}
+	base, err := load(b)
+	if err != nil {
+		return mergedContent{}, false, err
+	}
+	ours, err := load(o)
+	if err != nil {
+		return mergedContent{}, false, err
+	}
+	theirs, err := load(t)
+	if err != nil {
+		return mergedContent{}, false, err
+	}
+
+	if o.Mode == ModeSymlink || isBinary(base) || isBinary(ours) || isBinary(theirs) {
+		// These can't be merged line by line, so pick a side.
+		switch opts.Favor {
+		case "ours":
+			return mergedContent{content: ours, mode: o.Mode}, true, nil
+		case "theirs":
+			return mergedContent{content: theirs, mode: t.Mode}, true, nil
+		}
+		if opts.virtual {
+			return mergedContent{content: ours, mode: o.Mode}, false, nil
+		}
+		return mergedContent{reason: fmt.Sprintf("(content): Merge conflict in %v (binary files can not be merged)", path)}, false, nil
+	}
+
+	content, conflicts := mergeContent(base, ours, theirs, opts.contentMergeOptions)
+	return mergedContent{content: content, mode: mode}, conflicts == 0, nil
+}
+
+// sideRenames detects the renames from base to side, and returns a map
+// of the original path to the new path.
+func sideRenames(c *Client, threshold int, base, side IndexMap) (map[IndexPath]IndexPath, error) {
+	var removed, added []*IndexEntry
+	for path, e := range base {
+		if _, ok := side[path]; !ok {
+			removed = append(removed, e)
+		}
+	}
+	for path, e := range side {
+		if _, ok := base[path]; !ok {
+			added = append(added, e)
+		}
+	}
+	sort.Sort(ByPath(removed))
+	sort.Sort(ByPath(added))
+	pairs, err := detectRenames(c, removed, added, threshold)
+	if err != nil {
+		return nil, err
+	}
+	renames := make(map[IndexPath]IndexPath)
+	for _, p := range pairs {
+		renames[p.From.PathName] = p.To.PathName
+	}
+	return renames, nil
+}
+
+// parentDir returns the directory containing path, or "" if it's at
+// the top level.
+func parentDir(path IndexPath) IndexPath {
+	idx := strings.LastIndexByte(string(path), '/')
+	if idx < 0 {
+		return ""
+	}
+	return path[:idx]
+}
+
+// mergeCommits merges the commits ours and theirs using the ort strategy.
+// If there is more than one merge base, they're first merged into a
+// virtual merge base recursively.
+func mergeCommits(c *Client, opts mergeTreeOptions, ours, theirs CommitID) (*treeMergeResult, error) {
+	bases, err := MergeBaseAll(c, ours, theirs)
+	if err != nil {
+		return nil, err
+	}
+	return mergeCommitsWithBases(c, opts, bases, ours, theirs)
+}
+
+// mergeCommitsWithBases merges ours and theirs using bases as the merge
+// bases, instead of calculating them. If bases is empty, the merge is done
+// as if the common ancestor was an empty tree.
+func mergeCommitsWithBases(c *Client, opts mergeTreeOptions, bases []CommitID, ours, theirs Treeish) (*treeMergeResult, error) {
+	var base IndexMap
+	if len(bases) > 0 {
+		virtual, err := mergeBases(c, opts, bases)
+		if err != nil {
+			return nil, err
+		}
+		if base, err = GetIndexMap(c, virtual); err != nil {
+			return nil, err
+		}
+	}
+	oursMap, err := GetIndexMap(c, ours)
+	if err != nil {
+		return nil, err
+	}
+	theirsMap, err := GetIndexMap(c, theirs)
+	if err != nil {
+		return nil, err
+	}
+	if opts.subtree {
+		prefix := opts.subtreePrefix
+		if prefix == "" {
+			prefix = guessSubtree(oursMap, theirsMap)
+		}
+		theirsMap = shiftIndexMap(theirsMap, prefix)
+		base = shiftIndexMap(base, prefix)
+	}
+	return mergeTreeMaps(c, opts, base, oursMap, theirsMap)
+}
+
+// guessSubtree returns the directory in ours which best matches the top
+// level of theirs, or "" if the top level of ours is
+// the best match.
+func guessSubtree(ours, theirs IndexMap) IndexPath {
+	dirs := map[IndexPath]bool{"": true}
+	for path := range ours {
+		for dir := parentDir(path); dir != ""; dir = parentDir(dir) {
+			dirs[dir] = true
+		}
+	}
+	var best IndexPath
+	bestScore := -1
+	for dir := range dirs {
+		score := 0
+		for path, e := range theirs {
+			// Identical files count for more than files which
+			// only have the same name.
+			if o, ok := ours[shiftPath(path, dir)]; ok {
+				score++
+				if o.Sha1 == e.Sha1 {
+					score++
+				}
+			}
+		}
+		if score > bestScore || (score == bestScore && dir < best) {
+			best, bestScore = dir, score
+		}
+	}
+	return best
+}
+
+func shiftPath(path, prefix IndexPath) IndexPath {
+	if prefix == "" {
+		return path
+	}
+	return prefix + "/" + path
+}
+
+// shiftIndexMap returns a copy of m with every path moved under prefix.
+func shiftIndexMap(m IndexMap, prefix IndexPath) IndexMap {
+	if prefix == "" || m == nil {
+		return m
+	}
+	shifted := make(IndexMap, len(m))
+	for path, e := range m {
+		newpath := shiftPath(path, prefix)
+		shifted[newpath] = newMergeIndexEntry(newpath, e, Stage0)
+	}
+	return shifted
+}
+
+// mergeBases merges bases into a single virtual merge base. A commit
+// is created for the virtual merge base, so that merge bases between it
+// and other commits can be found, but it is not referenced by anything.
+func mergeBases(c *Client, opts mergeTreeOptions, bases []CommitID) (CommitID, error) {
+	virtual := bases[0]
+	for _, next := range bases[1:] {
+		inner := opts
+		inner.virtual = true
+		inner.subtree = false
+		inner.Favor = ""
+		inner.OursLabel, inner.TheirsLabel = "Temporary merge branch 1", "Temporary merge branch 2"
+		result, err := mergeCommits(c, inner, virtual, next)
+		if err != nil {
+			return CommitID{}, err
+		}
+		tree, err := result.WriteTree(c)
+		if err != nil {
+			return CommitID{}, err
+		}
+		cmt, err := CommitTree(c, CommitTreeOptions{}, tree, []CommitID{virtual, next}, "merged common ancestors\n")
+		if err != nil && err != NoGlobalConfig {
+			return CommitID{}, err
+		}
+		virtual = cmt
+	}
+	return virtual, nil
+}
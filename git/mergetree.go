@@ -0,0 +1,131 @@
+package git
+
+import (
+	"fmt"
+)
+
+// MergeTreeOptions are the options that may be passed to MergeTree.
+type MergeTreeOptions struct {
+	// Use this commit as the merge base, instead of calculating the
+	// merge base(s) of the two commits.
+	MergeBase Commitish
+
+	// Allow merging commits which have no common ancestor, as if
+	// the merge base was an empty tree.
+	AllowUnrelatedHistories bool
+
+	// Options for the merge strategy, the same as
+	// MergeOptions.StrategyOptions.
+	StrategyOptions []string
+}
+
+// MergeTreeConflict is a stage of a conflicted path in the result of
+// MergeTree.
+type MergeTreeConflict struct {
+	Mode  EntryMode
+	Sha1  Sha1
+	Stage Stage
+	Path  IndexPath
+}
+
+// String returns the conflict in the same format as ls-files --stage.
+func (m MergeTreeConflict) String() string {
+	return fmt.Sprintf("%o %v %v\t%v", m.Mode, m.Sha1, m.Stage, m.Path)
+}
+
+// MergeTreeResult is the result of merging two commits with MergeTree.
+type MergeTreeResult struct {
+	// The tree for the result of the merge. Files with conflicts
+	// contain conflict markers.
+	Tree TreeID
+
+	// The stages for each path with conflicts, sorted by path and
+	// stage. This is empty if the merge was clean.
+	Conflicts []MergeTreeConflict
+
+	// Informational messages about the merge, such as the files that
+	// needed to be merged and the reason for conflicts.
+	Messages []string
+}
+
+// Clean returns true if the merge did not have any conflicts.
+func (m MergeTreeResult) Clean() bool {
+	return len(m.Conflicts) == 0
+}
+
+// MergeTree merges branch1 and branch2 using the ort strategy, without
+// touching the index or work tree. The resulting tree is written to the
+// object database, but no commit is created and no refs are updated.
+// A merge with conflicts is not an error; the conflicts are returned in
+// the result.
+func MergeTree(c *Client, opts MergeTreeOptions, branch1, branch2 Commitish) (MergeTreeResult, error) {
+	ours, err := branch1.CommitID(c)
+	if err != nil {
+		return MergeTreeResult{}, err
+	}
+	theirs, err := branch2.CommitID(c)
+	if err != nil {
+		return MergeTreeResult{}, err
+	}
+
+	label := func(cmt Commitish, id CommitID) string {
+		if name := commitishName(cmt); name != "" {
+			return name
+		}
+		return id.String()
+	}
+	treeOpts := mergeTreeOptions{
+		contentMergeOptions: contentMergeOptions{
+			OursLabel:   label(branch1, ours),
+			BaseLabel:   "merged common ancestors",
+			TheirsLabel: label(branch2, theirs),
+			Diff3:       c.GetConfig("merge.conflictstyle") == "diff3",
+		},
+	}
+	if err := treeOpts.parseStrategyOptions(opts.StrategyOptions); err != nil {
+		return MergeTreeResult{}, err
+	}
+
+	var bases []CommitID
+	if opts.MergeBase != nil {
+		base, err := opts.MergeBase.CommitID(c)
+		if err != nil {
+			return MergeTreeResult{}, err
+		}
+		bases = []CommitID{base}
+	} else {
+		bases, err = MergeBaseAll(c, ours, theirs)
+		if err != nil {
+			return MergeTreeResult{}, err
+		}
+		if len(bases) == 0 && !opts.AllowUnrelatedHistories {
+			return MergeTreeResult{}, fmt.Errorf("refusing to merge unrelated histories")
+		}
+	}
+
+	result, err := mergeCommitsWithBases(c, treeOpts, bases, ours, theirs)
+	if err != nil {
+		return MergeTreeResult{}, err
+	}
+	tree, err := result.writeTreeWithConflicts(c)
+	if err != nil {
+		return MergeTreeResult{}, err
+	}
+	mresult := MergeTreeResult{Tree: tree, Messages: result.Messages}
+	if !result.Clean() {
+		// The index is sorted by path and stage, so the conflicts
+		// are too.
+		for _, e := range result.Index.Objects {
+			if e.Stage() == Stage0 {
+				continue
+			}
+			mresult.Conflicts = append(mresult.Conflicts, MergeTreeConflict{
+				Mode:  e.Mode,
+				Sha1:  e.Sha1,
+				Stage: e.Stage(),
+				Path:  e.PathName,
+			})
+		}
+	}
+	return mresult, nil
+}
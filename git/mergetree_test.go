@@ -0,0 +1,158 @@
+package git
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMergeTree(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo.txt": "foo\n", "bar.txt": "a\nb\nc\n"},
+		map[string]string{"foo.txt": "ours\n", "bar.txt": "A\nb\nc\n"},
+		map[string]string{"foo.txt": "theirs\n", "bar.txt": "a\nb\nC\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := c.GitDir.ReadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic, err := RevParseCommitish(c, &RevParseOptions{}, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := MergeTree(c, MergeTreeOptions{}, head, topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Clean() || len(result.Conflicts) != 3 {
+		t.Fatalf("Unexpected conflicts: %v", result.Conflicts)
+	}
+	for i, conflict := range result.Conflicts {
+		if conflict.Path != "foo.txt" || conflict.Stage != Stage(i+1) {
+			t.Errorf("Unexpected conflict %d: %v", i, conflict)
+		}
+	}
+
+	// The tree should have the conflict markers and the clean merge.
+	files, err := GetIndexMap(c, result.Tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[IndexPath]string{
+		"foo.txt": "<<<<<<< " + head.String() + "\nours\n=======\ntheirs\n>>>>>>> topic\n",
+		"bar.txt": "A\nb\nC\n",
+	}
+	for path, content := range want {
+		e, ok := files[path]
+		if !ok {
+			t.Errorf("%v missing from merged tree", path)
+			continue
+		}
+		obj, err := c.GetObject(e.Sha1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(obj.GetContent()); got != content {
+			t.Errorf("Unexpected content for %v: got %q want %q", path, got, content)
+		}
+	}
+
+	// Nothing in the repository should have changed.
+	if cur, _ := c.GetHeadCommit(); cur != head {
+		t.Error("MergeTree updated HEAD")
+	}
+	newidx, err := c.GitDir.ReadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(newidx.Objects) != len(idx.Objects) || len(newidx.GetUnmerged()) != 0 {
+		t.Error("MergeTree modified the index")
+	}
+
+	// With -X theirs the merge is clean.
+	result, err = MergeTree(c, MergeTreeOptions{StrategyOptions: []string{"theirs"}}, head, topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Clean() {
+		t.Errorf("Unexpected conflicts with -X theirs: %v", result.Conflicts)
+	}
+}
+
+// A testFile is a blob in a tree created by testTreeCommit.
+type testFile struct {
+	mode    EntryMode
+	content string
+}
+
+// testTree creates a tree with the files in files.
+func testTree(t *testing.T, c *Client, files map[IndexPath]testFile) TreeID {
+	t.Helper()
+	idx := NewIndex()
+	for path, f := range files {
+		sha, err := c.WriteObject("blob", []byte(f.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := idx.AddStage(c, path, f.mode, sha, Stage0, uint32(len(f.content)), 0, UpdateIndexOptions{Add: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tree, err := WriteTreeFromIndex(c, idx, WriteTreeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+// testTreeCommit creates a commit with parents whose tree has the files
+// in files.
+func testTreeCommit(t *testing.T, c *Client, parents []CommitID, files map[IndexPath]testFile) CommitID {
+	t.Helper()
+	cmt, err := CommitTree(c, CommitTreeOptions{}, testTree(t, c, files), parents, "commit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cmt
+}
+
+func TestMergeTreeCrissCrossTypeConflict(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo": "a\n"},
+		map[string]string{"foo": "b\n"},
+		map[string]string{"bar": "c\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	base := testTreeCommit(t, c, nil, map[IndexPath]testFile{"f": {ModeBlob, "a\n"}})
+	// One side turns f into a symlink, and the other edits it, so the
+	// merge bases of the criss-cross merges have a type conflict.
+	link := testTreeCommit(t, c, []CommitID{base}, map[IndexPath]testFile{"f": {ModeSymlink, "target"}})
+	edit := testTreeCommit(t, c, []CommitID{base}, map[IndexPath]testFile{"f": {ModeBlob, "a\nb\n"}})
+	ours := testTreeCommit(t, c, []CommitID{link, edit}, map[IndexPath]testFile{"f": {ModeSymlink, "target"}, "g": {ModeBlob, "ours\n"}})
+	theirs := testTreeCommit(t, c, []CommitID{edit, link}, map[IndexPath]testFile{"f": {ModeBlob, "a\nb\n"}, "h": {ModeBlob, "theirs\n"}})
+
+	result, err := MergeTree(c, MergeTreeOptions{}, ours, theirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := GetIndexMap(c, result.Tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []IndexPath{"g", "h"} {
+		if _, ok := files[path]; !ok {
+			t.Errorf("%v missing from merged tree", path)
+		}
+	}
+	for path, e := range files {
+		if e.Mode == 0 {
+			t.Errorf("%v has no mode in merged tree", path)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// NameRevOptions are the options that may be passed to NameRev.
+type NameRevOptions struct {
+	// Only use tags to name commits.
+	Tags bool
+
+	// Only use refs matching one of the Refs glob patterns, and
+	// not matching any of the Exclude patterns.
+	Refs, Exclude []string
+
+	// Only print the name, not the sha1.
+	NameOnly bool
+
+	// Show an abbreviated commit instead of "undefined" for commits
+	// that can not be named.
+	Always bool
+
+	// Return an error instead of "undefined" for commits that can
+	// not be named.
+	NoUndefined bool
+}
+
+// The weight added to the distance when traversing into a merged parent,
+// so that names which only follow first parents are preferred.
+const nameRevMergeWeight = 65535
+
+type revName struct {
+	tip   string
+	deref bool
+
+	generation, distance int
+
+	fromTag bool
+	date    int64
+}
+
+func (n revName) String() string {
+	if n.generation > 0 {
+		return fmt.Sprintf("%s~%d", n.tip, n.generation)
+	}
+	if n.deref {
+		return n.tip + "^0"
+	}
+	return n.tip
+}
+
+// betterThan returns whether n is a better name for a commit than old.
+// Names based on older tags are preferred, followed by names from any
+// tag, followed by names which are fewer hops away.
+func (n revName) betterThan(old revName) bool {
+	if n.fromTag && old.fromTag {
+		return old.date > n.date || (old.date == n.date && old.distance > n.distance)
+	}
+	if n.fromTag != old.fromTag {
+		return n.fromTag
+	}
+	if old.distance != n.distance {
+		return old.distance > n.distance
+	}
+	return old.date > n.date
+}
+
+// nameRevNames calculates the names of all commits reachable from the
+// refs allowed by opts.
+func nameRevNames(c *Client, opts NameRevOptions) (map[CommitID]revName, error) {
+	refs, err := ShowRef(c, ShowRefOptions{}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[CommitID]revName)
+	for _, ref := range refs {
+		if opts.Tags && !strings.HasPrefix(ref.Name, "refs/tags/") {
+			continue
+		}
+		if !refMatchesPatterns(ref.Name, opts.Refs, opts.Exclude) {
+			continue
+		}
+		cid, err := RefSpec(ref.Name).CommitID(c)
+		if err != nil {
+			continue
+		}
+
+		tip := revName{fromTag: strings.HasPrefix(ref.Name, "refs/tags/")}
+		switch {
+		case opts.Tags && opts.NameOnly:
+			tip.tip = strings.TrimPrefix(ref.Name, "refs/tags/")
+		case strings.HasPrefix(ref.Name, "refs/heads/"):
+			tip.tip = strings.TrimPrefix(ref.Name, "refs/heads/")
+		default:
+			tip.tip = strings.TrimPrefix(ref.Name, "refs/")
+		}
+		if ref.Value.Type(c) == "tag" {
+			tip.deref = true
+			tip.date = tagDate(c, ref.Value)
+		} else if d, err := cid.GetCommitterDate(c); err == nil {
+			tip.date = d.Unix()
+		}
+
+		type nameRevEntry struct {
+			cmt  CommitID
+			name revName
+		}
+		stack := []nameRevEntry{{cid, tip}}
+		for len(stack) > 0 {
+			e := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if old, ok := names[e.cmt]; ok && !e.name.betterThan(old) {
+				continue
+			}
+			names[e.cmt] = e.name
+
+			parents, err := e.cmt.Parents(c)
+			if err != nil {
+				return nil, err
+			}
+			// Push in reverse order so that the first parent is
+			// named first.
+			for i := len(parents) - 1; i >= 0; i-- {
+				pname := e.name
+				pname.deref = false
+				if i == 0 {
+					pname.generation++
+					pname.distance++
+				} else {
+					if e.name.generation > 0 {
+						pname.tip = fmt.Sprintf("%s~%d^%d", e.name.tip, e.name.generation, i+1)
+					} else {
+						pname.tip = fmt.Sprintf("%s^%d", e.name.tip, i+1)
+					}
+					pname.generation = 0
+					pname.distance += nameRevMergeWeight
+				}
+				stack = append(stack, nameRevEntry{parents[i], pname})
+			}
+		}
+	}
+	return names, nil
+}
+
+func nameRevLookup(c *Client, opts NameRevOptions, names map[CommitID]revName, cmt CommitID) (string, error) {
+	if n, ok := names[cmt]; ok {
+		return n.String(), nil
+	}
+	if opts.Always {
+		return Sha1(cmt).Abbrev(c, 7), nil
+	}
+	if opts.NoUndefined {
+		return "", fmt.Errorf("cannot describe '%v'", cmt)
+	}
+	return "undefined", nil
+}
+
+// NameRev finds symbolic names for the commits given, relative to the
+// refs in the repository.
+func NameRev(c *Client, opts NameRevOptions, commits []Commitish) ([]string, error) {
+	names, err := nameRevNames(c, opts)
+	if err != nil {
+		return nil, err
+	}
+	var vals []string
+	for _, cmt := range commits {
+		cid, err := cmt.CommitID(c)
+		if err != nil {
+			return nil, err
+		}
+		name, err := nameRevLookup(c, opts, names, cid)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, name)
+	}
+	return vals, nil
+}
+
+// NameRevAll returns every commit which can be named, sorted by commit
+// id. Unless NameOnly is set, each name is prefixed by the commit it names.
+func NameRevAll(c *Client, opts NameRevOptions) ([]string, error) {
+	names, err := nameRevNames(c, opts)
+	if err != nil {
+		return nil, err
+	}
+	var vals []string
+	for cmt, name := range names {
+		if opts.NameOnly {
+			vals = append(vals, name.String())
+		} else {
+			vals = append(vals, fmt.Sprintf("%v %v", cmt, name))
+		}
+	}
+	sort.Strings(vals)
+	return vals, nil
+}
+
+// NameRevStdin copies r to w, annotating any full commit ids in the text
+// with their symbolic names. If NameOnly is set, the ids are replaced by
+// the name instead of annotated.
+func NameRevStdin(c *Client, opts NameRevOptions, r io.Reader, w io.Writer) error {
+	names, err := nameRevNames(c, opts)
+	if err != nil {
+		return err
+	}
+	isHex := func(b byte) bool {
+		return (b >= '0' && b <= '9') || (b >= 'a' && b <= 'f')
+	}
+
+	reader := bufio.NewReader(r)
+	for {
+		line, rerr := reader.ReadString('\n')
+		var out strings.Builder
+		for i := 0; i < len(line); {
+			if !isHex(line[i]) {
+				out.WriteByte(line[i])
+				i++
+				continue
+			}
+			j := i
+			for j < len(line) && isHex(line[j]) {
+				j++
+			}
+			word := line[i:j]
+			i = j
+			if len(word) != 40 {
+				out.WriteString(word)
+				continue
+			}
+			sha, err := Sha1FromString(word)
+			if err != nil || sha.Type(c) != "commit" {
+				out.WriteString(word)
+				continue
+			}
+			n, ok := names[CommitID(sha)]
+			switch {
+			case !ok:
+				out.WriteString(word)
+			case opts.NameOnly:
+				out.WriteString(n.String())
+			default:
+				fmt.Fprintf(&out, "%s (%s)", word, n)
+			}
+		}
+		if _, err := io.WriteString(w, out.String()); err != nil {
+			return err
+		}
+		if rerr == io.EOF {
+			return nil
+		} else if rerr != nil {
+			return rerr
+		}
+	}
+}
@@ -0,0 +1,1017 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Notes are kept in a commit whose tree has a blob for each object that
+// has a note, named after the object's hash, the same as git's notes.
+// Like git, the names may be split into directories of two hex digits
+// ("fanout") when there are a lot of notes, so that no tree gets too big.
+
+// The notes ref used if no other ref is configured.
+const defaultNotesRef = "refs/notes/commits"
+
+// NotesOptions are the options common to all notes subcommands.
+type NotesOptions struct {
+	// The notes ref to use. If empty, the default notes ref is used.
+	Ref string
+}
+
+// NotesAddOptions are the options for adding to or replacing a note.
+type NotesAddOptions struct {
+	NotesOptions
+
+	// Replace an existing note.
+	Force bool
+
+	// Keep the note even if it's empty, instead of removing it.
+	AllowEmpty bool
+
+	// The note is made of a paragraph for each message and file. If
+	// there are none, the editor is opened.
+	Messages []string
+	Files    []File
+
+	// Use the content of the given blob as the note, and optionally
+	// open the editor to change it.
+	ReuseMessage  string
+	ReeditMessage string
+}
+
+// NotesRemoveOptions are the options for removing notes.
+type NotesRemoveOptions struct {
+	NotesOptions
+
+	// Don't consider it an error if an object has no note.
+	IgnoreMissing bool
+}
+
+// NotesCopyOptions are the options for copying a note between objects.
+type NotesCopyOptions struct {
+	NotesOptions
+
+	// Replace any existing note on the destination.
+	Force bool
+}
+
+// NotesMergeOptions are the options for merging notes refs.
+type NotesMergeOptions struct {
+	NotesOptions
+
+	// How to resolve notes which were changed on both sides. May be
+	// "manual" (the default), "ours", "theirs", "union" or
+	// "cat_sort_uniq".
+	Strategy string
+
+	Quiet bool
+}
+
+// NotesPruneOptions are the options for removing notes for objects that
+// no longer exist.
+type NotesPruneOptions struct {
+	NotesOptions
+
+	DryRun, Verbose bool
+}
+
+// A Note is the blob with the note for an object.
+type Note struct {
+	Object, Blob Sha1
+}
+
+// notesMap is the blob of the note for each annotated object.
+type notesMap map[Sha1]Sha1
+
+// notesCache caches the notes in each notes tree, since it's read for
+// every commit when showing notes in the log.
+var notesCache map[TreeID]notesMap
+
+// DefaultNotesRef returns the notes ref to use when one isn't given, from
+// $GIT_NOTES_REF or core.notesRef, or refs/notes/commits.
+func DefaultNotesRef(c *Client) string {
+	if ref := os.Getenv("GIT_NOTES_REF"); ref != "" {
+		return ExpandNotesRef(ref)
+	}
+	if ref := c.GetConfig("core.notesref"); ref != "" {
+		return ExpandNotesRef(ref)
+	}
+	return defaultNotesRef
+}
+
+// ExpandNotesRef expands a notes ref given on the command line to a full
+// ref name. "foo" and "notes/foo" both refer to refs/notes/foo.
+func ExpandNotesRef(ref string) string {
+	switch {
+	case strings.HasPrefix(ref, "refs/"):
+		return ref
+	case strings.HasPrefix(ref, "notes/"):
+		return "refs/" + ref
+	default:
+		return "refs/notes/" + ref
+	}
+}
+
+// notesRef returns the notes ref to use for opts.
+func (opts NotesOptions) notesRef(c *Client) string {
+	if opts.Ref != "" {
+		return ExpandNotesRef(opts.Ref)
+	}
+	return DefaultNotesRef(c)
+}
+
+// notesCommit returns the commit that ref points to, or nil if there are
+// no notes yet.
+func notesCommit(c *Client, ref string) (*CommitID, error) {
+	val, err := c.Refs().ReadRef(ref)
+	if err != nil || val == "" {
+		return nil, nil
+	}
+	cmt, err := CommitIDFromString(val)
+	if err != nil {
+		return nil, err
+	}
+	return &cmt, nil
+}
+
+// readNotes returns the notes in the commit cmt, which may be nil.
+func readNotes(c *Client, cmt *CommitID) (notesMap, error) {
+	if cmt == nil {
+		return notesMap{}, nil
+	}
+	tree, err := cmt.TreeID(c)
+	if err != nil {
+		return nil, err
+	}
+	if notes, ok := notesCache[tree]; ok {
+		return notes, nil
+	}
+	entries, err := tree.GetAllObjects(c, "", true, true)
+	if err != nil {
+		return nil, err
+	}
+	notes := make(notesMap)
+	for name, e := range entries {
+		if e.FileMode.TreeType() != "blob" {
+			continue
+		}
+		// Anything which isn't named after an object isn't a note.
+		obj, err := Sha1FromString(strings.Replace(string(name), "/", "", -1))
+		if err != nil {
+			continue
+		}
+		notes[obj] = e.Sha1
+	}
+	if notesCache == nil {
+		notesCache = make(map[TreeID]notesMap)
+	}
+	notesCache[tree] = notes
+	return notes, nil
+}
+
+// loadNotes returns the notes for ref along with the commit that they're
+// in, which is nil if the ref doesn't exist yet.
+func loadNotes(c *Client, ref string) (notesMap, *CommitID, error) {
+	cmt, err := notesCommit(c, ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	notes, err := readNotes(c, cmt)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Return a copy so that callers can modify it without breaking the
+	// cache.
+	cp := make(notesMap, len(notes))
+	for k, v := range notes {
+		cp[k] = v
+	}
+	return cp, cmt, nil
+}
+
+// writeNotesTree writes a tree for notes, with the same fanout that git
+// would use.
+func writeNotesTree(c *Client, notes notesMap) (TreeID, error) {
+	keys := make([]string, 0, len(notes))
+	for obj := range notes {
+		keys = append(keys, obj.String())
+	}
+	sort.Strings(keys)
+	return writeNotesSubtree(c, notes, keys, 0)
+}
+
+// writeNotesSubtree writes the tree for keys, which all start with the
+// same n hex digits. Like git, a level of fanout is added when every
+// possible next hex digit is shared by at least two of the notes.
+func writeNotesSubtree(c *Client, notes notesMap, keys []string, n int) (TreeID, error) {
+	var counts [16]int
+	for _, k := range keys {
+		counts[strings.IndexByte("0123456789abcdef", k[n])]++
+	}
+	fanout := n+2 < 40
+	for _, count := range counts {
+		if count < 2 {
+			fanout = false
+		}
+	}
+
+	content := bytes.NewBuffer(nil)
+	if !fanout {
+		for _, k := range keys {
+			obj, err := Sha1FromString(k)
+			if err != nil {
+				return TreeID{}, err
+			}
+			blob := notes[obj]
+			fmt.Fprintf(content, "%o %s\x00", ModeBlob, k[n:])
+			content.Write(blob[:])
+		}
+	} else {
+		for i := 0; i < len(keys); {
+			j := i
+			for j < len(keys) && keys[j][n:n+2] == keys[i][n:n+2] {
+				j++
+			}
+			sub, err := writeNotesSubtree(c, notes, keys[i:j], n+2)
+			if err != nil {
+				return TreeID{}, err
+			}
+			fmt.Fprintf(content, "%o %s\x00", ModeTree, keys[i][n:n+2])
+			content.Write(sub[:])
+			i = j
+		}
+	}
+	sha, err := c.WriteObject("tree", content.Bytes())
+	return TreeID(sha), err
+}
+
+// commitNotes writes notes to a new commit on top of parents and updates
+// ref to point to it.
+func commitNotes(c *Client, ref string, notes notesMap, parents []CommitID, message string) error {
+	tree, err := writeNotesTree(c, notes)
+	if err != nil {
+		return err
+	}
+	cmt, err := CommitTree(c, CommitTreeOptions{}, tree, parents, message+"\n")
+	if err != nil {
+		return err
+	}
+	opts := UpdateRefOptions{CreateReflog: true}
+	if len(parents) > 0 {
+		opts.OldValue = parents[0]
+	}
+	return UpdateRef(c, opts, ref, cmt, "notes: "+message)
+}
+
+// updateNotes commits notes on top of the existing notes commit for ref.
+func updateNotes(c *Client, ref string, notes notesMap, parent *CommitID, message string) error {
+	var parents []CommitID
+	if parent != nil {
+		parents = []CommitID{*parent}
+	}
+	return commitNotes(c, ref, notes, parents, message)
+}
+
+// notesObject resolves an object given on the command line, which
+// defaults to HEAD.
+func notesObject(c *Client, object string) (Sha1, error) {
+	if object == "" {
+		object = "HEAD"
+	}
+	revs, err := RevParse(c, RevParseOptions{}, []string{object})
+	if err != nil || len(revs) != 1 {
+		return Sha1{}, fmt.Errorf("failed to resolve '%v' as a valid ref.", object)
+	}
+	return revs[0].Id, nil
+}
+
+// readBlob returns the content of the blob with the given hash.
+func readBlob(c *Client, sha Sha1) ([]byte, error) {
+	obj, err := c.GetObject(sha)
+	if err != nil {
+		return nil, err
+	}
+	return obj.GetContent(), nil
+}
+
+// cleanupNote tidies up the whitespace in a note, the same way as a
+// commit message.
+func cleanupNote(note string, stripComments bool) string {
+	if strings.TrimSpace(note) == "" {
+		return ""
+	}
+	if stripComments {
+		return CommitMessage(note).strip()
+	}
+	return CommitMessage(note).whitespace()
+}
+
+// noteMessage builds the content of a note from the options, opening
+// the editor with initial as the starting content if there were no
+// messages given or a message is to be re-edited.
+func noteMessage(c *Client, opts NotesAddOptions, object Sha1, initial string) (string, error) {
+	var paragraphs []string
+	for _, m := range opts.Messages {
+		paragraphs = append(paragraphs, m)
+	}
+	for _, f := range opts.Files {
+		var content []byte
+		var err error
+		if f == "-" {
+			content, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			content, err = ioutil.ReadFile(f.String())
+		}
+		if err != nil {
+			return "", fmt.Errorf("could not read '%v': %v", f, err)
+		}
+		paragraphs = append(paragraphs, string(content))
+	}
+	edit := len(paragraphs) == 0 && opts.ReuseMessage == ""
+	for _, rev := range []string{opts.ReuseMessage, opts.ReeditMessage} {
+		if rev == "" {
+			continue
+		}
+		sha, err := notesObject(c, rev)
+		if err != nil {
+			return "", err
+		}
+		if t := sha.Type(c); t != "blob" {
+			return "", fmt.Errorf("cannot read note data from non-blob object '%v'.", rev)
+		}
+		content, err := readBlob(c, sha)
+		if err != nil {
+			return "", err
+		}
+		paragraphs = append(paragraphs, string(content))
+		if rev == opts.ReeditMessage {
+			edit = true
+		}
+	}
+	var note string
+	for _, p := range paragraphs {
+		if note != "" {
+			note += "\n"
+		}
+		note = cleanupNote(note+p, false)
+	}
+	if !edit {
+		return note, nil
+	}
+
+	if note == "" {
+		note = initial
+	}
+	f := c.GitDir.File("NOTES_EDITMSG")
+	template := fmt.Sprintf("%v\n#\n# Write/edit the notes for the following object:\n#\n# %v\n#\n", note, object)
+	if err := ioutil.WriteFile(f.String(), []byte(template), 0644); err != nil {
+		return "", err
+	}
+	if err := c.ExecEditor(f); err != nil {
+		return "", err
+	}
+	content, err := ioutil.ReadFile(f.String())
+	if err != nil {
+		return "", err
+	}
+	os.Remove(f.String())
+	return cleanupNote(string(content), true), nil
+}
+
+// setNote sets the note for object in notes to content, or removes it
+// if content is empty and allowEmpty isn't set.
+func setNote(c *Client, notes notesMap, object Sha1, content string, allowEmpty bool) error {
+	if content == "" && !allowEmpty {
+		fmt.Fprintf(os.Stderr, "Removing note for object %v\n", object)
+		delete(notes, object)
+		return nil
+	}
+	blob, err := c.WriteObject("blob", []byte(content))
+	if err != nil {
+		return err
+	}
+	notes[object] = blob
+	return nil
+}
+
+// NotesAdd adds a note to an object, which defaults to HEAD.
+func NotesAdd(c *Client, opts NotesAddOptions, object string) error {
+	return notesAddOrEdit(c, opts, object, "add")
+}
+
+// NotesEdit edits the note for an object in the editor, or replaces it
+// with the messages given.
+func NotesEdit(c *Client, opts NotesAddOptions, object string) error {
+	opts.Force = true
+	return notesAddOrEdit(c, opts, object, "edit")
+}
+
+func notesAddOrEdit(c *Client, opts NotesAddOptions, object, subcommand string) error {
+	ref := opts.notesRef(c)
+	obj, err := notesObject(c, object)
+	if err != nil {
+		return err
+	}
+	notes, parent, err := loadNotes(c, ref)
+	if err != nil {
+		return err
+	}
+	var existing string
+	if blob, ok := notes[obj]; ok {
+		if !opts.Force {
+			return fmt.Errorf("Cannot add notes. Found existing notes for object %v. Use '-f' to overwrite existing notes", obj)
+		}
+		if subcommand == "add" {
+			fmt.Fprintf(os.Stderr, "Overwriting existing notes for object %v\n", obj)
+		}
+		content, err := readBlob(c, blob)
+		if err != nil {
+			return err
+		}
+		existing = string(content)
+	}
+	note, err := noteMessage(c, opts, obj, existing)
+	if err != nil {
+		return err
+	}
+	if err := setNote(c, notes, obj, note, opts.AllowEmpty); err != nil {
+		return err
+	}
+	return updateNotes(c, ref, notes, parent, fmt.Sprintf("Notes added by 'git notes %v'", subcommand))
+}
+
+// NotesAppend appends a new paragraph to the note for an object, or
+// adds a new note if there isn't one.
+func NotesAppend(c *Client, opts NotesAddOptions, object string) error {
+	ref := opts.notesRef(c)
+	obj, err := notesObject(c, object)
+	if err != nil {
+		return err
+	}
+	notes, parent, err := loadNotes(c, ref)
+	if err != nil {
+		return err
+	}
+	note, err := noteMessage(c, opts, obj, "")
+	if err != nil {
+		return err
+	}
+	if blob, ok := notes[obj]; ok {
+		existing, err := readBlob(c, blob)
+		if err != nil {
+			return err
+		}
+		if note != "" && len(existing) > 0 {
+			note = "\n" + note
+		}
+		note = string(existing) + note
+	}
+	if err := setNote(c, notes, obj, note, opts.AllowEmpty); err != nil {
+		return err
+	}
+	return updateNotes(c, ref, notes, parent, "Notes added by 'git notes append'")
+}
+
+// NotesShow returns the note for an object, which defaults to HEAD.
+func NotesShow(c *Client, opts NotesOptions, object string) ([]byte, error) {
+	obj, err := notesObject(c, object)
+	if err != nil {
+		return nil, err
+	}
+	notes, _, err := loadNotes(c, opts.notesRef(c))
+	if err != nil {
+		return nil, err
+	}
+	blob, ok := notes[obj]
+	if !ok {
+		return nil, fmt.Errorf("no note found for object %v.", obj)
+	}
+	return readBlob(c, blob)
+}
+
+// NotesList returns the notes for every object, sorted by object, or
+// only the note for object if it's not empty.
+func NotesList(c *Client, opts NotesOptions, object string) ([]Note, error) {
+	notes, _, err := loadNotes(c, opts.notesRef(c))
+	if err != nil {
+		return nil, err
+	}
+	if object != "" {
+		obj, err := notesObject(c, object)
+		if err != nil {
+			return nil, err
+		}
+		blob, ok := notes[obj]
+		if !ok {
+			return nil, fmt.Errorf("no note found for object %v.", obj)
+		}
+		return []Note{{obj, blob}}, nil
+	}
+	list := make([]Note, 0, len(notes))
+	for obj, blob := range notes {
+		list = append(list, Note{obj, blob})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return bytes.Compare(list[i].Object[:], list[j].Object[:]) < 0
+	})
+	return list, nil
+}
+
+// NotesRemove removes the notes for objects, which defaults to HEAD.
+func NotesRemove(c *Client, opts NotesRemoveOptions, objects []string) error {
+	ref := opts.notesRef(c)
+	notes, parent, err := loadNotes(c, ref)
+	if err != nil {
+		return err
+	}
+	if len(objects) == 0 {
+		objects = []string{"HEAD"}
+	}
+	removed := false
+	for _, object := range objects {
+		obj, err := notesObject(c, object)
+		if err != nil {
+			return err
+		}
+		if _, ok := notes[obj]; !ok {
+			if opts.IgnoreMissing {
+				continue
+			}
+			return fmt.Errorf("Object %v has no note", obj)
+		}
+		fmt.Fprintf(os.Stderr, "Removing note for object %v\n", obj)
+		delete(notes, obj)
+		removed = true
+	}
+	if !removed {
+		return nil
+	}
+	return updateNotes(c, ref, notes, parent, "Notes removed by 'git notes remove'")
+}
+
+// NotesCopy copies the note from one object to another.
+func NotesCopy(c *Client, opts NotesCopyOptions, from, to string) error {
+	ref := opts.notesRef(c)
+	src, err := notesObject(c, from)
+	if err != nil {
+		return err
+	}
+	dst, err := notesObject(c, to)
+	if err != nil {
+		return err
+	}
+	notes, parent, err := loadNotes(c, ref)
+	if err != nil {
+		return err
+	}
+	blob, ok := notes[src]
+	if !ok {
+		return fmt.Errorf("missing notes on source object %v. Cannot copy.", src)
+	}
+	if _, ok := notes[dst]; ok {
+		if !opts.Force {
+			return fmt.Errorf("Cannot copy notes. Found existing notes for object %v. Use '-f' to overwrite existing notes", dst)
+		}
+		fmt.Fprintf(os.Stderr, "Overwriting existing notes for object %v\n", dst)
+	}
+	notes[dst] = blob
+	return updateNotes(c, ref, notes, parent, "Notes added by 'git notes copy'")
+}
+
+// NotesPrune removes the notes for objects which don't exist, and
+// returns the objects whose notes were removed.
+func NotesPrune(c *Client, opts NotesPruneOptions) ([]Sha1, error) {
+	ref := opts.notesRef(c)
+	notes, parent, err := loadNotes(c, ref)
+	if err != nil {
+		return nil, err
+	}
+	var pruned []Sha1
+	for obj := range notes {
+		have, _, err := c.HaveObject(obj)
+		if err != nil {
+			return nil, err
+		}
+		if !have {
+			pruned = append(pruned, obj)
+		}
+	}
+	sort.Slice(pruned, func(i, j int) bool {
+		return bytes.Compare(pruned[i][:], pruned[j][:]) < 0
+	})
+	if len(pruned) == 0 || opts.DryRun {
+		return pruned, nil
+	}
+	for _, obj := range pruned {
+		delete(notes, obj)
+	}
+	return pruned, updateNotes(c, ref, notes, parent, "Notes removed by 'git notes prune'")
+}
+
+// NotesGetRef returns the notes ref that would be used for opts.
+func NotesGetRef(c *Client, opts NotesOptions) string {
+	return opts.notesRef(c)
+}
+
+// The files used to keep track of a notes merge with conflicts.
+const (
+	notesMergePartial  = "NOTES_MERGE_PARTIAL"
+	notesMergeRef      = "NOTES_MERGE_REF"
+	notesMergeWorktree = "NOTES_MERGE_WORKTREE"
+)
+
+// NotesMerge merges the notes from remote into the notes ref. With the
+// manual strategy, conflicting notes are written to
+// .git/NOTES_MERGE_WORKTREE to be resolved and committed with
+// NotesMergeCommit.
+func NotesMerge(c *Client, opts NotesMergeOptions, remote string) error {
+	ref := opts.notesRef(c)
+	remoteRef := ExpandNotesRef(remote)
+	strategy := opts.Strategy
+	if strategy == "" {
+		strategy = c.GetConfig("notes." + strings.TrimPrefix(ref, "refs/notes/") + ".mergestrategy")
+	}
+	if strategy == "" {
+		strategy = c.GetConfig("notes.mergestrategy")
+	}
+	switch strategy {
+	case "":
+		strategy = "manual"
+	case "manual", "ours", "theirs", "union", "cat_sort_uniq":
+	default:
+		return fmt.Errorf("unknown notes merge strategy %v", strategy)
+	}
+	if strategy == "manual" && c.GitDir.File(notesMergePartial).Exists() {
+		return fmt.Errorf("You have not concluded your previous notes merge (.git/NOTES_MERGE_* exists).\n" +
+			"Please, use 'git notes merge --commit' or 'git notes merge --abort' to commit/abort the previous merge before you start a new notes merge.")
+	}
+
+	local, err := notesCommit(c, ref)
+	if err != nil {
+		return err
+	}
+	theirs, err := notesCommit(c, remoteRef)
+	if err != nil {
+		return err
+	}
+	if theirs == nil {
+		return fmt.Errorf("failed to resolve remote notes ref '%v'", remote)
+	}
+	message := fmt.Sprintf("Merged notes from %v into %v", remoteRef, ref)
+	switch {
+	case local == nil:
+		// There are no local notes, so fast-forward to the remote.
+		return UpdateRef(c, UpdateRefOptions{CreateReflog: true}, ref, *theirs, "notes: "+message)
+	case theirs.IsAncestor(c, *local):
+		if !opts.Quiet {
+			fmt.Println("Already up to date.")
+		}
+		return nil
+	case local.IsAncestor(c, *theirs):
+		return UpdateRef(c, UpdateRefOptions{CreateReflog: true, OldValue: *local}, ref, *theirs, "notes: "+message)
+	}
+
+	var base *CommitID
+	if mb, err := MergeBase(c, MergeBaseOptions{}, []Commitish{*local, *theirs}); err == nil {
+		base = &mb
+	}
+	baseNotes, err := readNotes(c, base)
+	if err != nil {
+		return err
+	}
+	ourNotes, _, err := loadNotes(c, ref)
+	if err != nil {
+		return err
+	}
+	theirNotes, err := readNotes(c, theirs)
+	if err != nil {
+		return err
+	}
+
+	objects := make(map[Sha1]bool)
+	for _, m := range []notesMap{baseNotes, ourNotes, theirNotes} {
+		for obj := range m {
+			objects[obj] = true
+		}
+	}
+	sorted := make([]Sha1, 0, len(objects))
+	for obj := range objects {
+		sorted = append(sorted, obj)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i][:], sorted[j][:]) < 0 })
+
+	conflicts := make(map[Sha1][]byte)
+	for _, obj := range sorted {
+		b, hasBase := baseNotes[obj]
+		o, hasOurs := ourNotes[obj]
+		t, hasTheirs := theirNotes[obj]
+		switch {
+		case hasOurs == hasTheirs && o == t:
+			continue
+		case hasOurs == hasBase && o == b:
+			if hasTheirs {
+				ourNotes[obj] = t
+			} else {
+				delete(ourNotes, obj)
+			}
+			continue
+		case hasTheirs == hasBase && t == b:
+			continue
+		}
+
+		// Both sides changed the note.
+		switch strategy {
+		case "ours":
+			if !opts.Quiet {
+				fmt.Printf("Using local notes for %v\n", obj)
+			}
+		case "theirs":
+			if !opts.Quiet {
+				fmt.Printf("Using remote notes for %v\n", obj)
+			}
+			if hasTheirs {
+				ourNotes[obj] = t
+			} else {
+				delete(ourNotes, obj)
+			}
+		case "union", "cat_sort_uniq":
+			switch {
+			case opts.Quiet:
+			case strategy == "union":
+				fmt.Printf("Concatenating local and remote notes for %v\n", obj)
+			default:
+				fmt.Printf("Concatenating unique lines in local and remote notes for %v\n", obj)
+			}
+			var ours, theirs []byte
+			if hasOurs {
+				if ours, err = readBlob(c, o); err != nil {
+					return err
+				}
+			}
+			if hasTheirs {
+				if theirs, err = readBlob(c, t); err != nil {
+					return err
+				}
+			}
+			merged := concatNotes(ours, theirs)
+			if strategy == "cat_sort_uniq" {
+				merged = sortUniqNotes(merged)
+			}
+			blob, err := c.WriteObject("blob", merged)
+			if err != nil {
+				return err
+			}
+			ourNotes[obj] = blob
+		default:
+			var bc, oc, tc []byte
+			for _, side := range []struct {
+				has  bool
+				sha  Sha1
+				dest *[]byte
+			}{{hasBase, b, &bc}, {hasOurs, o, &oc}, {hasTheirs, t, &tc}} {
+				if !side.has {
+					continue
+				}
+				if *side.dest, err = readBlob(c, side.sha); err != nil {
+					return err
+				}
+			}
+			kind := "content"
+			switch {
+			case !hasBase:
+				kind = "add/add"
+			case !hasOurs:
+				kind = "delete/modify"
+			case !hasTheirs:
+				kind = "modify/delete"
+			}
+			var merged []byte
+			if hasOurs && hasTheirs {
+				fmt.Printf("Auto-merging notes for %v\n", obj)
+				var n int
+				merged, n = mergeContent(bc, oc, tc, contentMergeOptions{OursLabel: ref, TheirsLabel: remoteRef})
+				if n == 0 {
+					blob, err := c.WriteObject("blob", merged)
+					if err != nil {
+						return err
+					}
+					ourNotes[obj] = blob
+					continue
+				}
+			} else if hasOurs {
+				merged = oc
+			} else {
+				merged = tc
+			}
+			fmt.Printf("CONFLICT (%v): Merge conflict in notes for object %v\n", kind, obj)
+			conflicts[obj] = merged
+		}
+	}
+
+	parents := []CommitID{*local, *theirs}
+	if len(conflicts) == 0 {
+		return commitNotes(c, ref, ourNotes, parents, message)
+	}
+
+	// Record the automatically merged notes, and leave the conflicts in
+	// the work tree for the user to fix.
+	tree, err := writeNotesTree(c, ourNotes)
+	if err != nil {
+		return err
+	}
+	partial, err := CommitTree(c, CommitTreeOptions{}, tree, parents, message+"\n")
+	if err != nil {
+		return err
+	}
+	dir := c.GitDir.File(notesMergeWorktree)
+	if err := os.MkdirAll(dir.String(), 0755); err != nil {
+		return err
+	}
+	for obj, content := range conflicts {
+		if err := ioutil.WriteFile(dir.String()+"/"+obj.String(), content, 0644); err != nil {
+			return err
+		}
+	}
+	if err := c.GitDir.WriteFile(notesMergePartial, []byte(partial.String()+"\n"), 0644); err != nil {
+		return err
+	}
+	if err := c.GitDir.WriteFile(notesMergeRef, []byte("ref: "+ref+"\n"), 0644); err != nil {
+		return err
+	}
+	return fmt.Errorf("Automatic notes merge failed. Fix conflicts in .git/%v and commit the result with 'git notes merge --commit', or abort the merge with 'git notes merge --abort'.", notesMergeWorktree)
+}
+
+// concatNotes concatenates two notes, with a blank line between them.
+func concatNotes(a, b []byte) []byte {
+	switch {
+	case len(a) == 0:
+		return b
+	case len(b) == 0:
+		return a
+	}
+	merged := append([]byte{}, a...)
+	if merged[len(merged)-1] != '\n' {
+		merged = append(merged, '\n')
+	}
+	merged = append(merged, '\n')
+	return append(merged, b...)
+}
+
+// sortUniqNotes sorts the lines of a note and removes duplicates.
+func sortUniqNotes(note []byte) []byte {
+	lines := strings.Split(strings.TrimRight(string(note), "\n"), "\n")
+	sort.Strings(lines)
+	var out []string
+	for i, l := range lines {
+		if l == "" || (i > 0 && l == lines[i-1]) {
+			continue
+		}
+		out = append(out, l)
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(out, "\n") + "\n")
+}
+
+// notesMergeState returns the partial merge commit and the ref being
+// merged into for a notes merge with conflicts.
+func notesMergeState(c *Client) (CommitID, string, error) {
+	partial, err := c.GitDir.ReadFile(notesMergePartial)
+	if err != nil {
+		return CommitID{}, "", fmt.Errorf("There is no notes merge in progress (missing .git/%v)", notesMergePartial)
+	}
+	cmt, err := CommitIDFromString(strings.TrimSpace(string(partial)))
+	if err != nil {
+		return CommitID{}, "", err
+	}
+	ref, err := c.GitDir.ReadFile(notesMergeRef)
+	if err != nil {
+		return CommitID{}, "", fmt.Errorf("There is no notes merge in progress (missing .git/%v)", notesMergeRef)
+	}
+	return cmt, strings.TrimPrefix(strings.TrimSpace(string(ref)), "ref: "), nil
+}
+
+// NotesMergeCommit finishes a notes merge with conflicts, using the
+// resolved notes in .git/NOTES_MERGE_WORKTREE.
+func NotesMergeCommit(c *Client) error {
+	partial, ref, err := notesMergeState(c)
+	if err != nil {
+		return err
+	}
+	notes, err := readNotes(c, &partial)
+	if err != nil {
+		return err
+	}
+	resolved := make(notesMap, len(notes))
+	for k, v := range notes {
+		resolved[k] = v
+	}
+	dir := c.GitDir.File(notesMergeWorktree)
+	files, err := ioutil.ReadDir(dir.String())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, fi := range files {
+		obj, err := Sha1FromString(fi.Name())
+		if err != nil {
+			continue
+		}
+		content, err := ioutil.ReadFile(dir.String() + "/" + fi.Name())
+		if err != nil {
+			return err
+		}
+		if err := setNote(c, resolved, obj, string(content), false); err != nil {
+			return err
+		}
+	}
+	parents, err := partial.Parents(c)
+	if err != nil {
+		return err
+	}
+	msg, err := partial.GetCommitMessage(c)
+	if err != nil {
+		return err
+	}
+	if err := commitNotes(c, ref, resolved, parents, strings.TrimSpace(msg.String())); err != nil {
+		return err
+	}
+	return NotesMergeAbort(c)
+}
+
+// NotesMergeAbort abandons a notes merge with conflicts.
+func NotesMergeAbort(c *Client) error {
+	if err := os.RemoveAll(c.GitDir.File(notesMergeWorktree).String()); err != nil {
+		return err
+	}
+	for _, f := range []File{notesMergePartial, notesMergeRef} {
+		if err := os.Remove(c.GitDir.File(f).String()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// FormatNotes returns the notes for obj from each of refs, the way that
+// they're shown in the log, with a blank line before each.
+func FormatNotes(c *Client, refs []string, obj Sha1) (string, error) {
+	return formatNotes(c, refs, obj, false)
+}
+
+// formatNotes returns the notes for obj from each of refs. Unless raw is
+// set, they're indented under a "Notes:" header, the way that they're
+// shown in the log. Raw notes are shown as they are, for %N in a pretty
+// format.
+func formatNotes(c *Client, refs []string, obj Sha1, raw bool) (string, error) {
+	var output string
+	for _, ref := range refs {
+		cmt, err := notesCommit(c, ref)
+		if err != nil {
+			return "", err
+		}
+		notes, err := readNotes(c, cmt)
+		if err != nil {
+			return "", err
+		}
+		blob, ok := notes[obj]
+		if !ok {
+			continue
+		}
+		content, err := readBlob(c, blob)
+		if err != nil {
+			return "", err
+		}
+		indent := "    "
+		switch {
+		case raw:
+			indent = ""
+		case ref == defaultNotesRef:
+			output += "\nNotes:\n"
+		default:
+			output += fmt.Sprintf("\nNotes (%v):\n", strings.TrimPrefix(ref, "refs/notes/"))
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+			output += indent + line + "\n"
+		}
+	}
+	return output, nil
+}
+
+// FormatMediumWithNotes is like FormatMedium, but also shows the notes
+// for the commit from each of notesRefs, like git log.
+func (c CommitID) FormatMediumWithNotes(cl *Client, notesRefs []string) (string, error) {
+	output, err := c.FormatMedium(cl)
+	if err != nil {
+		return "", err
+	}
+	notes, err := FormatNotes(cl, notesRefs, Sha1(c))
+	if err != nil || notes == "" {
+		return output, err
+	}
+	return strings.TrimSuffix(output, "\n") + notes + "\n", nil
+}
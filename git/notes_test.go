@@ -0,0 +1,292 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestNotes(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo.txt": "foo\n"},
+		map[string]string{"foo.txt": "ours\n"},
+		map[string]string{"bar.txt": "bar\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parents, err := head.Parents(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := parents[0].String()
+
+	checkNote := func(name, object, want string) {
+		t.Helper()
+		note, err := NotesShow(c, NotesOptions{}, object)
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		if string(note) != want {
+			t.Errorf("%v: unexpected note: got %q want %q", name, note, want)
+		}
+	}
+
+	if err := NotesAdd(c, NotesAddOptions{Messages: []string{"first", "second  "}}, ""); err != nil {
+		t.Fatal(err)
+	}
+	checkNote("add", "HEAD", "first\n\nsecond\n")
+	if err := NotesAdd(c, NotesAddOptions{Messages: []string{"again"}}, "HEAD"); err == nil {
+		t.Error("Expected adding a note to an object with a note to fail without -f")
+	}
+	if err := NotesAppend(c, NotesAddOptions{Messages: []string{"third"}}, "HEAD"); err != nil {
+		t.Fatal(err)
+	}
+	checkNote("append", "HEAD", "first\n\nsecond\n\nthird\n")
+
+	if err := NotesCopy(c, NotesCopyOptions{}, "HEAD", base); err != nil {
+		t.Fatal(err)
+	}
+	checkNote("copy", base, "first\n\nsecond\n\nthird\n")
+	if err := NotesCopy(c, NotesCopyOptions{}, "HEAD", base); err == nil {
+		t.Error("Expected copying over an existing note to fail without -f")
+	}
+
+	notes, err := NotesList(c, NotesOptions{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 2 || notes[0].Blob != notes[1].Blob {
+		t.Errorf("Unexpected notes list: %v", notes)
+	}
+
+	if err := NotesRemove(c, NotesRemoveOptions{}, []string{base}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NotesShow(c, NotesOptions{}, base); err == nil {
+		t.Error("Expected removed note to be gone")
+	}
+	if err := NotesRemove(c, NotesRemoveOptions{}, []string{base}); err == nil {
+		t.Error("Expected removing a missing note to fail")
+	}
+	if err := NotesRemove(c, NotesRemoveOptions{IgnoreMissing: true}, []string{base}); err != nil {
+		t.Error(err)
+	}
+
+	// Each change is a commit on top of the last one.
+	cmt, err := notesCommit(c, defaultNotesRef)
+	if err != nil || cmt == nil {
+		t.Fatalf("Could not read notes commit: %v", err)
+	}
+	msg, err := cmt.GetCommitMessage(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.String() != "Notes removed by 'git notes remove'\n" {
+		t.Errorf("Unexpected notes commit message: %q", msg)
+	}
+
+	formatted, err := FormatNotes(c, []string{defaultNotesRef, "refs/notes/missing"}, Sha1(head))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\nNotes:\n    first\n    \n    second\n    \n    third\n"; formatted != want {
+		t.Errorf("Unexpected formatted notes: got %q want %q", formatted, want)
+	}
+
+	// Notes for objects which don't exist are pruned.
+	missing := "1111111111111111111111111111111111111111"
+	if err := NotesAdd(c, NotesAddOptions{Messages: []string{"gone"}}, missing); err != nil {
+		t.Fatal(err)
+	}
+	pruned, err := NotesPrune(c, NotesPruneOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 1 || pruned[0].String() != missing {
+		t.Errorf("Unexpected pruned notes: %v", pruned)
+	}
+	if _, err := NotesShow(c, NotesOptions{}, missing); err == nil {
+		t.Error("Expected pruned note to be gone")
+	}
+}
+
+func TestNotesFanout(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo.txt": "foo\n"},
+		map[string]string{"foo.txt": "ours\n"},
+		map[string]string{"bar.txt": "bar\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	blob, err := c.WriteObject("blob", []byte("note\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A handful of notes are stored in a flat tree.
+	notes := make(notesMap)
+	for i := 0; i < 16; i++ {
+		obj, err := Sha1FromString(fmt.Sprintf("%x%039d", i, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		notes[obj] = blob
+	}
+	tree, err := writeNotesTree(c, notes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := tree.GetAllObjects(c, "", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 16 {
+		t.Errorf("Unexpected number of entries in flat notes tree: got %v want 16", len(entries))
+	}
+
+	// Once every first hex digit has two notes, they're split into
+	// directories.
+	for i := 0; i < 16; i++ {
+		obj, err := Sha1FromString(fmt.Sprintf("%x%039d", i, 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		notes[obj] = blob
+	}
+	tree, err = writeNotesTree(c, notes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err = tree.GetAllObjects(c, "", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 16 {
+		t.Errorf("Unexpected number of entries in notes fanout tree: got %v want 16", len(entries))
+	}
+	for name, e := range entries {
+		if len(name) != 2 || e.FileMode != ModeTree {
+			t.Errorf("Unexpected entry in notes fanout tree: %v %v", name, e.FileMode)
+		}
+	}
+
+	// Reading the tree finds the notes under the fanout directories.
+	if err := commitNotes(c, defaultNotesRef, notes, nil, "fanout"); err != nil {
+		t.Fatal(err)
+	}
+	read, _, err := loadNotes(c, defaultNotesRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != len(notes) {
+		t.Errorf("Unexpected number of notes read: got %v want %v", len(read), len(notes))
+	}
+}
+
+func TestNotesMerge(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo.txt": "foo\n"},
+		map[string]string{"foo.txt": "ours\n"},
+		map[string]string{"bar.txt": "bar\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parents, err := head.Parents(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := parents[0].String()
+
+	add := func(ref, object, msg string) {
+		t.Helper()
+		if err := NotesAdd(c, NotesAddOptions{NotesOptions: NotesOptions{ref}, Force: true, Messages: []string{msg}}, object); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("ours", base, "base")
+	baseNotes, err := c.Refs().ReadRef("refs/notes/ours")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Refs().WriteRef("refs/notes/theirs", baseNotes, nil); err != nil {
+		t.Fatal(err)
+	}
+	add("ours", "HEAD", "ours")
+	add("theirs", "HEAD", "theirs")
+	add("theirs", base, "changed")
+	oursNotes, err := c.Refs().ReadRef("refs/notes/ours")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	show := func(ref, object string) string {
+		t.Helper()
+		note, err := NotesShow(c, NotesOptions{ref}, object)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(note)
+	}
+
+	// The note only changed on one side is taken from that side, and
+	// union concatenates the ones changed on both.
+	if err := NotesMerge(c, NotesMergeOptions{NotesOptions: NotesOptions{"ours"}, Strategy: "union", Quiet: true}, "theirs"); err != nil {
+		t.Fatal(err)
+	}
+	if got := show("ours", "HEAD"); got != "ours\n\ntheirs\n" {
+		t.Errorf("Unexpected union merge: %q", got)
+	}
+	if got := show("ours", base); got != "changed\n" {
+		t.Errorf("Unexpected merge of note changed on one side: %q", got)
+	}
+	cmt, err := notesCommit(c, "refs/notes/ours")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mparents, err := cmt.Parents(c); err != nil || len(mparents) != 2 {
+		t.Errorf("Expected notes merge commit to have 2 parents: %v %v", mparents, err)
+	}
+
+	// The manual strategy leaves conflicts in the work tree.
+	if err := c.Refs().WriteRef("refs/notes/ours", oursNotes, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := NotesMerge(c, NotesMergeOptions{NotesOptions: NotesOptions{"ours"}}, "theirs"); err == nil {
+		t.Fatal("Expected conflicting notes merge to fail")
+	}
+	if err := NotesMerge(c, NotesMergeOptions{NotesOptions: NotesOptions{"ours"}}, "theirs"); err == nil {
+		t.Error("Expected notes merge to fail with a merge in progress")
+	}
+	conflict := c.GitDir.File(File(notesMergeWorktree + "/" + head.String()))
+	content, err := ioutil.ReadFile(conflict.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<<<<<<< refs/notes/ours\nours\n=======\ntheirs\n>>>>>>> refs/notes/theirs\n"; string(content) != want {
+		t.Errorf("Unexpected conflict: got %q want %q", content, want)
+	}
+	if err := ioutil.WriteFile(conflict.String(), []byte("resolved\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := NotesMergeCommit(c); err != nil {
+		t.Fatal(err)
+	}
+	if got := show("ours", "HEAD"); got != "resolved\n" {
+		t.Errorf("Unexpected resolved note: %q", got)
+	}
+	if got := show("ours", base); got != "changed\n" {
+		t.Errorf("Unexpected merge of note changed on one side: %q", got)
+	}
+	if c.GitDir.File(notesMergePartial).Exists() {
+		t.Error("Expected notes merge state to be removed after committing")
+	}
+}
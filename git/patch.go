@@ -0,0 +1,673 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// A patchLine is a single line of a hunk in a patch.
+type patchLine struct {
+	// ' ' for a context line, '-' for a removed line or '+' for an
+	// added line.
+	Op byte
+
+	// The line, which always ends with a newline. NoEOL is set if the
+	// file didn't have one.
+	Text  string
+	NoEOL bool
+
+	// How the line was coloured by --color-moved.
+	Moved movedFlags
+
+	// Whether the line is a blank line added to the end of the file,
+	// which is a whitespace error with blank-at-eof.
+	BlankAtEOF bool
+}
+
+type movedFlags uint8
+
+const (
+	movedLine movedFlags = 1 << iota
+	movedAlternative
+	movedDimmed
+)
+
+// A unifiedHunk is a hunk of a unified diff. It replaces ALen lines from
+// AStart in the old file with BLen lines from BStart in the new file,
+// where the starts are 0 based.
+type unifiedHunk struct {
+	AStart, ALen int
+	BStart, BLen int
+
+	// The function the hunk is in, which is shown in its header.
+	Func string
+
+	Lines []patchLine
+}
+
+// header returns the "@@ -a,b +c,d @@" header of h, without the function
+// name. Like git, a count of 1 is left out and the start of an empty
+// range is the line before it.
+func (h unifiedHunk) header() string {
+	rng := func(start, n int) string {
+		switch n {
+		case 0:
+			return fmt.Sprintf("%d,0", start)
+		case 1:
+			return fmt.Sprintf("%d", start+1)
+		default:
+			return fmt.Sprintf("%d,%d", start+1, n)
+		}
+	}
+	return fmt.Sprintf("@@ -%s +%s @@", rng(h.AStart, h.ALen), rng(h.BStart, h.BLen))
+}
+
+// A filePatch is the patch for a single file in a diff.
+type filePatch struct {
+	// The lines that describe the change, starting with the "diff --git"
+	// line.
+	Header []string
+
+	// The names of the two sides, or /dev/null if there's no file.
+	SrcLabel, DstLabel string
+
+	// Binary is set if either side is binary, in which case there are
+	// no hunks. BinaryPatch is the body of the "GIT binary patch" which
+	// is shown with --binary, and is otherwise nil.
+	Binary      bool
+	BinaryPatch []byte
+	Hunks       []unifiedHunk
+}
+
+// newFilePatch builds the patch for d as configured in opts. attrs decides
+// which files are binary, and ws is used to find blank lines added at the
+// end of the file.
+func newFilePatch(c *Client, attrs *gitAttributes, d HashDiff, opts DiffCommonOptions, ws wsRule) (*filePatch, error) {
+	indentHeuristic := c.GetConfig("diff.indentHeuristic") != "false"
+	src, err := diffContent(c, d.SrcPath(), d.Src)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := diffContent(c, d.Name, d.Dst)
+	if err != nil {
+		return nil, err
+	}
+	srcSha, dstSha := d.Src.Sha1, d.Dst.Sha1
+	if dstSha == (Sha1{}) && d.Dst.FileMode != 0 {
+		// It's in the work tree, so it needs to be hashed to be
+		// compared.
+		if dstSha, _, err = HashSlice("blob", dst); err != nil {
+			return nil, err
+		}
+	}
+
+	added := d.Src.FileMode == 0 && d.Src.Sha1 == (Sha1{})
+	deleted := d.Dst.FileMode == 0 && d.Dst.Sha1 == (Sha1{})
+	p := &filePatch{
+		Header:   []string{fmt.Sprintf("diff --git a/%v b/%v", d.SrcPath(), d.Name)},
+		SrcLabel: "a/" + d.SrcPath().String(),
+		DstLabel: "b/" + d.Name.String(),
+	}
+	switch {
+	case added:
+		p.SrcLabel = "/dev/null"
+		p.Header = append(p.Header, fmt.Sprintf("new file mode %06o", d.Dst.FileMode))
+	case deleted:
+		p.DstLabel = "/dev/null"
+		p.Header = append(p.Header, fmt.Sprintf("deleted file mode %06o", d.Src.FileMode))
+	case d.Src.FileMode != d.Dst.FileMode:
+		p.Header = append(p.Header, fmt.Sprintf("old mode %06o", d.Src.FileMode), fmt.Sprintf("new mode %06o", d.Dst.FileMode))
+	}
+	p.Header = append(p.Header, d.ExtraHeaders...)
+	switch d.Status {
+	case 'R':
+		p.Header = append(p.Header, fmt.Sprintf("similarity index %d%%", d.Score), "rename from "+d.SrcName.String(), "rename to "+d.Name.String())
+	case 'C':
+		p.Header = append(p.Header, fmt.Sprintf("similarity index %d%%", d.Score), "copy from "+d.SrcName.String(), "copy to "+d.Name.String())
+	case 'M':
+		if d.Score > 0 {
+			p.Header = append(p.Header, fmt.Sprintf("dissimilarity index %d%%", d.Score))
+		}
+	}
+	if srcSha == dstSha {
+		if len(p.Header) == 1 {
+			// Nothing changed.
+			return nil, nil
+		}
+		return p, nil
+	}
+	binary, err := attrs.isBinaryDiff(d.Name, src, dst)
+	if err != nil {
+		return nil, err
+	}
+	index := fmt.Sprintf("index %v..%v", srcSha.Abbrev(c, 7), dstSha.Abbrev(c, 7))
+	if opts.FullIndex || (opts.Binary && binary) {
+		// A binary patch can only be applied to the exact object
+		// that it was made from.
+		index = fmt.Sprintf("index %v..%v", srcSha, dstSha)
+	}
+	if d.Src.FileMode == d.Dst.FileMode {
+		index += fmt.Sprintf(" %06o", d.Src.FileMode)
+	}
+	p.Header = append(p.Header, index)
+
+	if binary {
+		p.Binary = true
+		if opts.Binary {
+			// Like git, the patch can be applied in either
+			// direction.
+			var buf bytes.Buffer
+			if err := writeBinaryHunk(&buf, src, dst); err != nil {
+				return nil, err
+			}
+			if err := writeBinaryHunk(&buf, dst, src); err != nil {
+				return nil, err
+			}
+			p.BinaryPatch = buf.Bytes()
+		}
+		return p, nil
+	}
+	a, b := splitLines(src), splitLines(dst)
+	if d.Status == 'M' && d.Score > 0 {
+		// A rewrite removes everything and adds it all back.
+		p.Hunks = []unifiedHunk{newUnifiedHunk(a, b, []diffHunk{{0, len(a), 0, len(b)}}, 0, len(a), 0)}
+	} else {
+		p.Hunks = unifiedHunks(a, b, opts.NumContextLines, indentHeuristic)
+	}
+	if ws&wsBlankAtEOF != 0 {
+		markBlankAtEOF(p.Hunks, a, b)
+	}
+	return p, nil
+}
+
+// unifiedHunks returns the hunks of a unified diff from a to b, with
+// context lines of context around each change and the function that each
+// hunk is in. The changes are placed the same way as git's, using its
+// indent heuristic if indentHeuristic is set.
+func unifiedHunks(a, b []string, context int, indentHeuristic bool) []unifiedHunk {
+	changes := xdiffLines(a, b, nil, indentHeuristic)
+	var hunks []unifiedHunk
+	funcStart := 0
+	var funcName string
+	for i := 0; i < len(changes); {
+		// Changes which are close enough together for their context
+		// to touch are in the same hunk.
+		j := i + 1
+		for j < len(changes) && changes[j].AStart-changes[j-1].AEnd <= 2*context {
+			j++
+		}
+		aStart := changes[i].AStart - context
+		if aStart < 0 {
+			aStart = 0
+		}
+		aEnd := changes[j-1].AEnd + context
+		if aEnd > len(a) {
+			aEnd = len(a)
+		}
+		bStart := changes[i].BStart - (changes[i].AStart - aStart)
+		h := newUnifiedHunk(a, b, changes[i:j], aStart, aEnd, bStart)
+
+		// Like git, the function is the last line before the hunk
+		// which starts with a letter, _ or $, searching back to the
+		// start of the last hunk and otherwise keeping its function.
+		for l := aStart - 1; l >= funcStart; l-- {
+			if name, ok := funcLine(a[l]); ok {
+				funcName = name
+				break
+			}
+		}
+		funcStart = aStart
+		h.Func = funcName
+		hunks = append(hunks, h)
+		i = j
+	}
+	return hunks
+}
+
+// newUnifiedHunk returns the hunk covering a[aStart:aEnd] which makes the
+// changes between a and b, starting at bStart in b. The lines between the
+// changes are context.
+func newUnifiedHunk(a, b []string, changes []diffHunk, aStart, aEnd, bStart int) unifiedHunk {
+	h := unifiedHunk{AStart: aStart, BStart: bStart}
+	line := func(op byte, text string) {
+		l := patchLine{Op: op, Text: text}
+		if !strings.HasSuffix(text, "\n") {
+			l.Text += "\n"
+			l.NoEOL = true
+		}
+		h.Lines = append(h.Lines, l)
+	}
+	ai, bi := aStart, bStart
+	for _, ch := range changes {
+		for ; ai < ch.AStart; ai, bi = ai+1, bi+1 {
+			line(' ', a[ai])
+		}
+		for ; ai < ch.AEnd; ai++ {
+			line('-', a[ai])
+		}
+		for ; bi < ch.BEnd; bi++ {
+			line('+', b[bi])
+		}
+	}
+	for ; ai < aEnd; ai, bi = ai+1, bi+1 {
+		line(' ', a[ai])
+	}
+	h.ALen, h.BLen = ai-aStart, bi-bStart
+	return h
+}
+
+// funcLine returns the function name of line if it's the start of a
+// function, using git's default rule of a line starting with a letter, _
+// or $, truncated to 80 bytes.
+func funcLine(line string) (string, bool) {
+	if line == "" {
+		return "", false
+	}
+	if ch := line[0]; !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch == '_' || ch == '$') {
+		return "", false
+	}
+	if len(line) > 80 {
+		line = line[:80]
+	}
+	return strings.TrimRightFunc(line, func(r rune) bool { return r < 0x80 && isSpace(byte(r)) }), true
+}
+
+// markBlankAtEOF marks the lines added in hunks which are new blank lines
+// at the end of b, the same as git.
+func markBlankAtEOF(hunks []unifiedHunk, a, b []string) {
+	preBlank, postBlank := countTrailingBlank(a), countTrailingBlank(b)
+	if postBlank <= preBlank {
+		return
+	}
+	preAt, postAt := len(a)-preBlank+1, len(b)-postBlank+1
+	for i := range hunks {
+		// git counts from the numbers in the hunk header, and
+		// increments them before checking each line.
+		pre, post := hunks[i].AStart+1, hunks[i].BStart+1
+		if hunks[i].ALen == 0 {
+			pre--
+		}
+		if hunks[i].BLen == 0 {
+			post--
+		}
+		for j := range hunks[i].Lines {
+			l := &hunks[i].Lines[j]
+			switch l.Op {
+			case '+':
+				post++
+				l.BlankAtEOF = preAt <= pre && postAt <= post && isBlankLine(l.Text)
+			case '-':
+				pre++
+			default:
+				pre++
+				post++
+			}
+		}
+	}
+}
+
+// patchWriter writes the patches of a diff.
+type patchWriter struct {
+	w      io.Writer
+	opts   DiffCommonOptions
+	colors diffColors
+	ws     wsRule
+
+	// The kinds of lines whose whitespace errors are highlighted.
+	highlightOld, highlightNew, highlightContext bool
+}
+
+// writePatches writes the patches for diffs to w as configured in opts.
+func writePatches(c *Client, opts DiffCommonOptions, diffs []HashDiff, w io.Writer) error {
+	colors, err := loadDiffColors(c, opts.Color)
+	if err != nil {
+		return err
+	}
+	pw := &patchWriter{
+		w:      w,
+		opts:   opts,
+		colors: colors,
+		ws:     parseWhitespaceRule(c.GetConfig("core.whitespace")),
+	}
+	if opts.WhitespaceErrorHighlight == nil {
+		pw.highlightNew = true
+	}
+	for _, kind := range opts.WhitespaceErrorHighlight {
+		switch kind {
+		case "old":
+			pw.highlightOld = true
+		case "new", "default":
+			pw.highlightNew = true
+		case "context":
+			pw.highlightContext = true
+		case "all":
+			pw.highlightOld, pw.highlightNew, pw.highlightContext = true, true, true
+		case "none":
+			pw.highlightOld, pw.highlightNew, pw.highlightContext = false, false, false
+		default:
+			return fmt.Errorf("unknown value after ws-error-highlight=%v", kind)
+		}
+	}
+
+	attrs, err := loadAttributes(c)
+	if err != nil {
+		return err
+	}
+	var patches []*filePatch
+	for _, d := range diffs {
+		p, err := newFilePatch(c, attrs, d, opts, pw.ws)
+		if err != nil {
+			return err
+		}
+		if p != nil {
+			patches = append(patches, p)
+		}
+	}
+	if opts.Color && !pw.wordDiff() {
+		if err := markMovedLines(patches, opts.ColorMoved); err != nil {
+			return err
+		}
+	}
+	for _, p := range patches {
+		pw.writeFile(p)
+	}
+	return nil
+}
+
+func (pw *patchWriter) wordDiff() bool {
+	return pw.opts.WordDiff != "" && pw.opts.WordDiff != "none"
+}
+
+func (pw *patchWriter) meta(line string) {
+	fmt.Fprintf(pw.w, "%s%s%s\n", pw.colors.Meta, line, pw.colors.Reset)
+}
+
+func (pw *patchWriter) writeFile(p *filePatch) {
+	for _, line := range p.Header {
+		pw.meta(line)
+	}
+	if p.BinaryPatch != nil {
+		io.WriteString(pw.w, "GIT binary patch\n")
+		pw.w.Write(p.BinaryPatch)
+		return
+	} else if p.Binary {
+		fmt.Fprintf(pw.w, "Binary files %s and %s differ\n", p.SrcLabel, p.DstLabel)
+		return
+	}
+	if len(p.Hunks) == 0 {
+		return
+	}
+	// Like git, names with spaces are followed by a tab so that they
+	// can be found by patch.
+	for _, label := range []string{"--- " + p.SrcLabel, "+++ " + p.DstLabel} {
+		tab := ""
+		if strings.Contains(label[4:], " ") {
+			tab = "\t"
+		}
+		fmt.Fprintf(pw.w, "%s%s%s%s\n", pw.colors.Meta, label, pw.colors.Reset, tab)
+	}
+	for _, h := range p.Hunks {
+		pw.writeHunk(h)
+	}
+}
+
+func (pw *patchWriter) writeHunk(h unifiedHunk) {
+	c := pw.colors
+	io.WriteString(pw.w, c.Frag+h.header()+c.Reset)
+	if h.Func != "" {
+		io.WriteString(pw.w, c.Context+" "+c.Reset+c.Func+h.Func+c.Reset)
+	}
+	io.WriteString(pw.w, "\n")
+	if pw.wordDiff() {
+		pw.writeWordDiffLines(h.Lines)
+		return
+	}
+	for _, l := range h.Lines {
+		pw.writeLine(l)
+	}
+}
+
+// splitEOL splits the newline, and carriage return before it, off of
+// line.
+func splitEOL(line string) (string, string) {
+	eol := ""
+	if strings.HasSuffix(line, "\n") {
+		line, eol = line[:len(line)-1], "\n"
+	}
+	if strings.HasSuffix(line, "\r") {
+		line, eol = line[:len(line)-1], "\r"+eol
+	}
+	return line, eol
+}
+
+// lineColor returns the colour of l, which depends on whether it was
+// moved.
+func (pw *patchWriter) lineColor(l patchLine) string {
+	c := pw.colors
+	type colors struct{ normal, moved, alt, dim, altDim string }
+	set := colors{c.Context, c.Context, c.Context, c.Context, c.Context}
+	switch l.Op {
+	case '+':
+		set = colors{c.New, c.NewMoved, c.NewMovedAlternative, c.NewMovedDimmed, c.NewMovedAlternativeDimmed}
+	case '-':
+		set = colors{c.Old, c.OldMoved, c.OldMovedAlternative, c.OldMovedDimmed, c.OldMovedAlternativeDimmed}
+	}
+	switch l.Moved {
+	case movedLine | movedAlternative | movedDimmed:
+		return set.altDim
+	case movedLine | movedAlternative:
+		return set.alt
+	case movedLine | movedDimmed:
+		return set.dim
+	case movedLine:
+		return set.moved
+	default:
+		return set.normal
+	}
+}
+
+// writeLine writes a line of a hunk, highlighting any whitespace errors
+// in it.
+func (pw *patchWriter) writeLine(l patchLine) {
+	c := pw.colors
+	set := pw.lineColor(l)
+	highlight := pw.highlightContext
+	switch l.Op {
+	case '+':
+		highlight = pw.highlightNew
+	case '-':
+		highlight = pw.highlightOld
+	}
+	ws := ""
+	if highlight {
+		ws = c.Whitespace
+	}
+	switch {
+	case ws == "":
+		line, eol := splitEOL(l.Text)
+		io.WriteString(pw.w, set+string(l.Op)+line+c.Reset+eol)
+	case l.BlankAtEOF:
+		line, eol := splitEOL(l.Text)
+		io.WriteString(pw.w, ws+string(l.Op)+line+c.Reset+eol)
+	default:
+		io.WriteString(pw.w, set+string(l.Op)+c.Reset)
+		pw.ws.writeChecked(pw.w, l.Text, set, c.Reset, ws)
+	}
+	if l.NoEOL {
+		io.WriteString(pw.w, c.Context+"\\ No newline at end of file"+c.Reset+"\n")
+	}
+}
+
+// A wordStyle is how the words of one kind are shown in a word diff.
+type wordStyle struct {
+	color, prefix, suffix string
+}
+
+// writeWordDiffLines writes the lines of a hunk as a word diff. Each run
+// of removed and added lines is compared word by word.
+func (pw *patchWriter) writeWordDiffLines(lines []patchLine) {
+	c := pw.colors
+	var minus, plus strings.Builder
+	flush := func() {
+		if minus.Len() > 0 || plus.Len() > 0 {
+			pw.writeWords(minus.String(), plus.String())
+		}
+		minus.Reset()
+		plus.Reset()
+	}
+	for _, l := range lines {
+		switch l.Op {
+		case '-':
+			minus.WriteString(l.Text)
+		case '+':
+			plus.WriteString(l.Text)
+		default:
+			flush()
+			if pw.opts.WordDiff == "porcelain" {
+				line, eol := splitEOL(" " + l.Text)
+				io.WriteString(pw.w, c.Context+line+c.Reset+eol+"~\n")
+			} else if line, eol := splitEOL(l.Text); line == "" {
+				io.WriteString(pw.w, eol)
+			} else {
+				io.WriteString(pw.w, c.Context+line+c.Reset+eol)
+			}
+		}
+	}
+	flush()
+}
+
+// writeWords writes the word diff between the removed text minus and the
+// added text plus, following git's diff_words_show.
+func (pw *patchWriter) writeWords(minus, plus string) {
+	var oldStyle, newStyle, ctxStyle wordStyle
+	newline := "\n"
+	switch pw.opts.WordDiff {
+	case "porcelain":
+		oldStyle, newStyle, ctxStyle = wordStyle{"", "-", "\n"}, wordStyle{"", "+", "\n"}, wordStyle{"", " ", "\n"}
+		newline = "~\n"
+	case "plain":
+		oldStyle, newStyle = wordStyle{"", "[-", "-]"}, wordStyle{"", "{+", "+}"}
+	}
+	if pw.opts.Color {
+		oldStyle.color, newStyle.color, ctxStyle.color = pw.colors.Old, pw.colors.New, pw.colors.Context
+	}
+
+	if plus == "" {
+		pw.writeWordSegment(oldStyle, newline, minus)
+		return
+	}
+	minusWords := splitWords(minus, pw.opts.WordDiffRegex)
+	plusWords := splitWords(plus, pw.opts.WordDiffRegex)
+	words := func(text string, pos [][2]int) []string {
+		w := make([]string, len(pos))
+		for i, p := range pos {
+			w[i] = text[p[0]:p[1]]
+		}
+		return w
+	}
+	// span returns the part of text covered by the words from start to
+	// end, or the empty position after the word before start.
+	span := func(pos [][2]int, start, end int) (int, int) {
+		switch {
+		case end > start:
+			return pos[start][0], pos[end-1][1]
+		case start > 0:
+			return pos[start-1][1], pos[start-1][1]
+		default:
+			return 0, 0
+		}
+	}
+
+	current := 0
+	for _, h := range xdiffLines(words(minus, minusWords), words(plus, plusWords), nil, false) {
+		minusBegin, minusEnd := span(minusWords, h.AStart, h.AEnd)
+		plusBegin, plusEnd := span(plusWords, h.BStart, h.BEnd)
+		if current != plusBegin {
+			pw.writeWordSegment(ctxStyle, newline, plus[current:plusBegin])
+		}
+		if minusBegin != minusEnd {
+			pw.writeWordSegment(oldStyle, newline, minus[minusBegin:minusEnd])
+		}
+		if plusBegin != plusEnd {
+			pw.writeWordSegment(newStyle, newline, plus[plusBegin:plusEnd])
+		}
+		current = plusEnd
+	}
+	if current != len(plus) {
+		pw.writeWordSegment(ctxStyle, newline, plus[current:])
+	}
+}
+
+// writeWordSegment writes text in the style st, with each newline in it
+// replaced by newline.
+func (pw *patchWriter) writeWordSegment(st wordStyle, newline, text string) {
+	for text != "" {
+		seg := text
+		nl := strings.IndexByte(text, '\n')
+		if nl >= 0 {
+			seg = text[:nl]
+		}
+		if seg != "" {
+			if st.color != "" {
+				io.WriteString(pw.w, st.color+st.prefix+seg+st.suffix+colorReset)
+			} else {
+				io.WriteString(pw.w, st.prefix+seg+st.suffix)
+			}
+		}
+		if nl < 0 {
+			return
+		}
+		io.WriteString(pw.w, newline)
+		text = text[nl+1:]
+	}
+}
+
+// splitWords returns the start and end of each word in text. Words are
+// matched by re, or are separated by whitespace if it's nil. A word never
+// includes a newline.
+func splitWords(text string, re *regexp.Regexp) [][2]int {
+	var words [][2]int
+	for i := 0; i < len(text); i++ {
+		begin, end, ok := nextWord(text, re, i)
+		if !ok {
+			break
+		}
+		words = append(words, [2]int{begin, end})
+		i = end - 1
+	}
+	return words
+}
+
+// nextWord finds the next word in text at or after begin, following git's
+// find_word_boundaries.
+func nextWord(text string, re *regexp.Regexp, begin int) (int, int, bool) {
+	for re != nil && begin < len(text) {
+		loc := re.FindStringIndex(text[begin:])
+		if loc == nil {
+			return 0, 0, false
+		}
+		end := begin + loc[1]
+		if nl := strings.IndexByte(text[begin+loc[0]:end], '\n'); nl >= 0 {
+			end = begin + loc[0] + nl
+		}
+		begin += loc[0]
+		if begin != end {
+			return begin, end, begin < end
+		}
+		begin++
+	}
+	for begin < len(text) && isSpace(text[begin]) {
+		begin++
+	}
+	if begin >= len(text) {
+		return 0, 0, false
+	}
+	end := begin + 1
+	for end < len(text) && !isSpace(text[end]) {
+		end++
+	}
+	return begin, end, true
+}
@@ -0,0 +1,118 @@
+package git
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"testing"
+)
+
+func TestUnifiedHunks(t *testing.T) {
+	a := "package x\n\nfunc a() {\n\treturn\n}\n\nfunc c() {\n\treturn\n}\nend"
+	b := "package x\n\nfunc a() {\n\treturn\n}\n\nfunc b() {\n\treturn\n}\n\nfunc c() {\n\treturn  \n}\nend\n"
+
+	tests := []struct {
+		opts DiffCommonOptions
+		want string
+	}{
+		{
+			DiffCommonOptions{NumContextLines: 1},
+			"@@ -6,5 +6,9 @@ func a() {\n \n-func c() {\n+func b() {\n \treturn\n }\n-end\n\\ No newline at end of file\n+\n+func c() {\n+\treturn  \n+}\n+end\n",
+		},
+		{
+			DiffCommonOptions{NumContextLines: 3, WordDiff: "plain"},
+			"@@ -4,7 +4,11 @@ func a() {\n\treturn\n}\n\nfunc [-c()-]{+b()+} {\n\treturn\n}\n\n{+func c() {+}\n{+\treturn  +}\n{+}+}\nend\n",
+		},
+		{
+			DiffCommonOptions{NumContextLines: 0},
+			"@@ -7 +7 @@ func a() {\n-func c() {\n+func b() {\n@@ -10 +10,5 @@ func c() {\n-end\n\\ No newline at end of file\n+\n+func c() {\n+\treturn  \n+}\n+end\n",
+		},
+	}
+	for i, tc := range tests {
+		var buf bytes.Buffer
+		pw := &patchWriter{w: &buf, opts: tc.opts, ws: wsDefaultRule}
+		for _, h := range unifiedHunks(splitLines([]byte(a)), splitLines([]byte(b)), tc.opts.NumContextLines, true) {
+			pw.writeHunk(h)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("Test %d: unexpected hunks: got %q want %q", i, got, tc.want)
+		}
+	}
+}
+
+func TestWordDiff(t *testing.T) {
+	tests := []struct {
+		mode, regex string
+		minus, plus string
+		want        string
+	}{
+		{"plain", "", "foo bar\n", "foo baz\n", "foo [-bar-]{+baz+}\n"},
+		{"plain", "", "gone\n", "", "[-gone-]\n"},
+		{"porcelain", "[a-z]+", "foo(bar, baz)\n", "foo(bar, qux)\n", " foo(bar, \n-baz\n+qux\n )\n~\n"},
+		{"plain", ".", "cat\n", "cut\n", "c[-a-]{+u+}t\n"},
+	}
+	for i, tc := range tests {
+		var buf bytes.Buffer
+		pw := &patchWriter{w: &buf, opts: DiffCommonOptions{WordDiff: tc.mode}}
+		if tc.regex != "" {
+			pw.opts.WordDiffRegex = regexp.MustCompile("(?m)" + tc.regex)
+		}
+		pw.writeWords(tc.minus, tc.plus)
+		if got := buf.String(); got != tc.want {
+			t.Errorf("Test %d: unexpected word diff: got %q want %q", i, got, tc.want)
+		}
+	}
+}
+
+func TestColoredPatch(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"m": "first line of the block\nsecond line of the block\nc1\nc2\nc3\nc4\nc5\n"},
+		map[string]string{"m": "c1\nc2\nc3\nfirst line of the block\nsecond line of the block\nc4\nc5 \n"},
+		map[string]string{"other": "other\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	diffs, err := Diff(c, DiffOptions{Revisions: []string{"topic...master"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := "\x1b[1mdiff --git a/m b/m\x1b[m\n\x1b[1mindex ddf142e..363edc8 100644\x1b[m\n\x1b[1m--- a/m\x1b[m\n\x1b[1m+++ b/m\x1b[m\n\x1b[36m@@ -1,7 +1,7 @@\x1b[m\n"
+	tests := []struct {
+		moved string
+		want  string
+	}{
+		{
+			"",
+			"\x1b[31m-first line of the block\x1b[m\n\x1b[31m-second line of the block\x1b[m\n c1\x1b[m\n c2\x1b[m\n c3\x1b[m\n" +
+				"\x1b[32m+\x1b[m\x1b[32mfirst line of the block\x1b[m\n\x1b[32m+\x1b[m\x1b[32msecond line of the block\x1b[m\n c4\x1b[m\n" +
+				"\x1b[31m-c5\x1b[m\n\x1b[32m+\x1b[m\x1b[32mc5\x1b[m\x1b[41m \x1b[m\n",
+		},
+		{
+			"zebra",
+			"\x1b[1;35m-first line of the block\x1b[m\n\x1b[1;35m-second line of the block\x1b[m\n c1\x1b[m\n c2\x1b[m\n c3\x1b[m\n" +
+				"\x1b[1;36m+\x1b[m\x1b[1;36mfirst line of the block\x1b[m\n\x1b[1;36m+\x1b[m\x1b[1;36msecond line of the block\x1b[m\n c4\x1b[m\n" +
+				"\x1b[31m-c5\x1b[m\n\x1b[32m+\x1b[m\x1b[32mc5\x1b[m\x1b[41m \x1b[m\n",
+		},
+		{
+			"dimmed-zebra",
+			"\x1b[2m-first line of the block\x1b[m\n\x1b[2m-second line of the block\x1b[m\n c1\x1b[m\n c2\x1b[m\n c3\x1b[m\n" +
+				"\x1b[2m+\x1b[m\x1b[2mfirst line of the block\x1b[m\n\x1b[2m+\x1b[m\x1b[2msecond line of the block\x1b[m\n c4\x1b[m\n" +
+				"\x1b[31m-c5\x1b[m\n\x1b[32m+\x1b[m\x1b[32mc5\x1b[m\x1b[41m \x1b[m\n",
+		},
+	}
+	for i, tc := range tests {
+		var buf bytes.Buffer
+		opts := DiffCommonOptions{Patch: true, NumContextLines: 3, Color: true, ColorMoved: tc.moved}
+		if err := GeneratePatch(c, opts, diffs, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != header+tc.want {
+			t.Errorf("Test %d: unexpected patch: got %q want %q", i, got, header+tc.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := GeneratePatch(c, DiffCommonOptions{Patch: true, Color: true, ColorMoved: "bogus"}, diffs, &buf); err == nil {
+		t.Error("Expected an invalid --color-moved mode to fail")
+	}
+}
@@ -0,0 +1,55 @@
+package git
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// A pathspec limits a command to the files which are either the same as,
+// inside of, or matched as a glob by one of its paths. The paths are
+// relative to the top of the work tree, and an empty pathspec matches
+// every file.
+type pathspec []IndexPath
+
+// newPathspec converts the files given on the command line, which are
+// relative to the current directory, into a pathspec.
+func newPathspec(c *Client, files []File) (pathspec, error) {
+	var spec pathspec
+	for _, f := range files {
+		abs, err := filepath.Abs(f.String())
+		if err != nil {
+			return nil, err
+		}
+		if abs == c.WorkDir.String() {
+			// The top of the work tree matches everything.
+			return nil, nil
+		}
+		p, err := f.IndexPath(c)
+		if err != nil {
+			return nil, err
+		}
+		spec = append(spec, p)
+	}
+	return spec, nil
+}
+
+// Matches returns whether name is matched by p. A directory also matches
+// if there's a path inside of it, so that it can be recursed into.
+func (p pathspec) Matches(name IndexPath, isDir bool) bool {
+	if len(p) == 0 {
+		return true
+	}
+	for _, spec := range p {
+		if name == spec || strings.HasPrefix(string(name), string(spec)+"/") {
+			return true
+		}
+		if isDir && strings.HasPrefix(string(spec), string(name)+"/") {
+			return true
+		}
+		if m, _ := path.Match(string(spec), string(name)); m {
+			return true
+		}
+	}
+	return false
+}
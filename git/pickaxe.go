@@ -0,0 +1,97 @@
+package git
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// diffPickaxe filters diffs to the changes selected by the -S or -G
+// options in opts, like git's diffcore-pickaxe. With PickaxeAll, either
+// all of diffs or none of them are returned.
+func diffPickaxe(c *Client, opts DiffCommonOptions, diffs []HashDiff) ([]HashDiff, error) {
+	if !opts.HasPickaxe() {
+		return diffs, nil
+	}
+	if opts.PickaxeString != "" && opts.PickaxeGrep != "" {
+		return nil, fmt.Errorf("-G and -S are mutually exclusive")
+	}
+	var pattern string
+	switch {
+	case opts.PickaxeGrep != "":
+		pattern = opts.PickaxeGrep
+	case opts.PickaxeRegex:
+		// Like git, ^ and $ match at the ends of lines.
+		pattern = "(?m)" + opts.PickaxeString
+	default:
+		pattern = regexp.QuoteMeta(opts.PickaxeString)
+	}
+	if opts.PickaxeIgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []HashDiff
+	for _, d := range diffs {
+		src, err := pickaxeContent(c, d.SrcPath(), d.Src)
+		if err != nil {
+			return nil, err
+		}
+		dst, err := pickaxeContent(c, d.Name, d.Dst)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if opts.PickaxeGrep != "" {
+			ok = pickaxeGrep(re, src, dst)
+		} else {
+			ok = len(re.FindAllIndex(src, -1)) != len(re.FindAllIndex(dst, -1))
+		}
+		if !ok {
+			continue
+		}
+		if opts.PickaxeAll {
+			return diffs, nil
+		}
+		matched = append(matched, d)
+	}
+	if opts.PickaxeAll {
+		return nil, nil
+	}
+	return matched, nil
+}
+
+// pickaxeContent returns the content of one side of a diff for the
+// pickaxe, which is empty if it's not a file.
+func pickaxeContent(c *Client, name IndexPath, e TreeEntry) ([]byte, error) {
+	if e.FileMode == 0 || e.FileMode.TreeType() != "blob" {
+		return nil, nil
+	}
+	return diffContent(c, name, e)
+}
+
+// pickaxeGrep returns whether any of the lines added or removed between
+// src and dst match re. Binary files never match.
+func pickaxeGrep(re *regexp.Regexp, src, dst []byte) bool {
+	if isBinary(src) || isBinary(dst) {
+		return false
+	}
+	a, b := splitLines(src), splitLines(dst)
+	matches := func(lines []string) bool {
+		for _, l := range lines {
+			if re.MatchString(strings.TrimSuffix(l, "\n")) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, h := range xdiffLines(a, b, nil, false) {
+		if matches(a[h.AStart:h.AEnd]) || matches(b[h.BStart:h.BEnd]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestDiffPickaxe(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo": "a\nb\n", "bar": "x y\n"},
+		map[string]string{"foo": "a\nc\n", "bar": "x\ny\n"},
+		map[string]string{"baz": "z\n"},
+	)
+	defer os.RemoveAll(dir)
+	base, err := RevParseCommit(c, &RevParseOptions{}, "master^")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ours, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		label string
+		opts  DiffCommonOptions
+		want  []IndexPath
+	}{
+		{"string", DiffCommonOptions{PickaxeString: "c"}, []IndexPath{"foo"}},
+		// The number of x's in bar is the same, even though the lines
+		// changed.
+		{"same count", DiffCommonOptions{PickaxeString: "x"}, nil},
+		{"ignore case", DiffCommonOptions{PickaxeString: "B", PickaxeIgnoreCase: true}, []IndexPath{"foo"}},
+		{"literal", DiffCommonOptions{PickaxeString: "[bc]"}, nil},
+		{"regex", DiffCommonOptions{PickaxeString: "[bc]", PickaxeRegex: true}, nil},
+		{"regex count", DiffCommonOptions{PickaxeString: "^[a-z]$", PickaxeRegex: true}, []IndexPath{"bar"}},
+		{"grep", DiffCommonOptions{PickaxeGrep: "^x"}, []IndexPath{"bar"}},
+		{"grep removed", DiffCommonOptions{PickaxeGrep: "b"}, []IndexPath{"foo"}},
+		{"all", DiffCommonOptions{PickaxeString: "c", PickaxeAll: true}, []IndexPath{"bar", "foo"}},
+		{"none", DiffCommonOptions{PickaxeString: "a", PickaxeAll: true}, nil},
+	}
+	for _, tc := range tests {
+		diffs, err := DiffTree(c, &DiffTreeOptions{DiffCommonOptions: tc.opts, Recurse: true}, base, ours, nil)
+		if err != nil {
+			t.Errorf("%v: %v", tc.label, err)
+			continue
+		}
+		if len(diffs) != len(tc.want) {
+			t.Errorf("%v: got %v want %v", tc.label, diffs, tc.want)
+			continue
+		}
+		for i := range diffs {
+			if diffs[i].Name != tc.want[i] {
+				t.Errorf("%v: got %v want %v", tc.label, diffs, tc.want)
+				break
+			}
+		}
+	}
+
+	if _, err := DiffTree(c, &DiffTreeOptions{DiffCommonOptions: DiffCommonOptions{PickaxeString: "a", PickaxeGrep: "a"}}, base, ours, nil); err == nil {
+		t.Error("Expected an error for both -S and -G")
+	}
+}
+
+func TestDiffPickaxeRename(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"a.txt": "20\n21\n22\n"},
+		map[string]string{"other": "ours\n"},
+		map[string]string{"other": "theirs\n"},
+	)
+	defer os.RemoveAll(dir)
+	base, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Rm(c, RmOptions{Quiet: true}, []File{"a.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("b.txt", []byte("20\n21\n22\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Add(c, AddOptions{}, []File{"b.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Commit(c, CommitOptions{}, CommitMessage("rename"), nil); err != nil {
+		t.Fatal(err)
+	}
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without rename detection, the lines are removed from a.txt and
+	// added to b.txt, but a pure rename doesn't change any lines.
+	tests := []struct {
+		opts DiffCommonOptions
+		want int
+	}{
+		{DiffCommonOptions{PickaxeGrep: "2[0-2]"}, 2},
+		{DiffCommonOptions{PickaxeGrep: "2[0-2]", DetectRenames: true}, 0},
+		{DiffCommonOptions{PickaxeString: "21", DetectRenames: true}, 0},
+	}
+	for i, tc := range tests {
+		diffs, err := DiffTree(c, &DiffTreeOptions{DiffCommonOptions: tc.opts}, base, head, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(diffs) != tc.want {
+			t.Errorf("Test %d: got %v want %d diffs", i, diffs, tc.want)
+		}
+	}
+}
@@ -0,0 +1,508 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// PrettyOptions select the format that log, show and rev-list show the
+// commits in.
+type PrettyOptions struct {
+	// One of the named formats "oneline", "short", "medium", "full",
+	// "fuller", "reference", "email", "mboxrd" or "raw", or an alias
+	// for one from the pretty.<name> config, or a user format. The names
+	// can be abbreviated. A user format is "format:<string>", which
+	// separates the commits, or "tformat:<string>", which terminates
+	// each of them. A format with a % in it is a tformat. An empty
+	// Format is medium.
+	Format string
+
+	// The format of the dates, as described by FormatDate, or an empty
+	// string for the default of the format.
+	DateMode string
+
+	// Show the abbreviated commit ids in the headers of the commits.
+	AbbrevCommit bool
+
+	// The notes refs to show the notes for each commit from.
+	NotesRefs []string
+
+	// The refs to decorate the commits with after their headers, or
+	// nil if they aren't decorated. %d and %D use the default
+	// decorations if it's nil.
+	Decorations *Decorations
+}
+
+// UsesNotes returns whether the format selected by o is a user format
+// which shows the notes of commits with %N.
+func (o PrettyOptions) UsesNotes(c *Client) bool {
+	f, err := parsePrettyFormat(c, o.Format)
+	if err != nil || !f.isUser() {
+		return false
+	}
+	for s := f.user; ; {
+		i := strings.IndexByte(s, '%')
+		if i < 0 || i == len(s)-1 {
+			return false
+		}
+		s = s[i+1:]
+		if s[0] == '%' {
+			s = s[1:]
+			continue
+		}
+		if strings.IndexByte("+- ", s[0]) >= 0 {
+			s = s[1:]
+		}
+		if strings.HasPrefix(s, "N") {
+			return true
+		}
+	}
+}
+
+// A prettyFormat is one of git's named formats for showing commits, or a
+// user format.
+type prettyFormat struct {
+	name string
+
+	// The format string of a user format, or of reference, which is
+	// built on one.
+	user string
+
+	// Whether each commit is terminated by a newline, rather than
+	// separated from the next one by one.
+	terminator bool
+
+	// Whether the tabs in the message are expanded.
+	expandTabs bool
+
+	// The date mode used unless another one is selected.
+	dateMode string
+}
+
+var prettyFormats = []prettyFormat{
+	{name: "raw"},
+	{name: "medium", expandTabs: true},
+	{name: "short"},
+	{name: "email"},
+	{name: "mboxrd"},
+	{name: "fuller", expandTabs: true},
+	{name: "full", expandTabs: true},
+	{name: "oneline", terminator: true},
+	{name: "reference", user: "%C(auto)%h (%s, %ad)", terminator: true, dateMode: "short"},
+}
+
+// isUser returns whether f is expanded from a format string, rather than
+// being shown after a "commit" header.
+func (f prettyFormat) isUser() bool {
+	return f.name == "format" || f.name == "reference"
+}
+
+// isMail returns whether f shows the commits as emails.
+func (f prettyFormat) isMail() bool {
+	return f.name == "email" || f.name == "mboxrd"
+}
+
+// isEmpty returns whether f is a user format which is always empty.
+func (f prettyFormat) isEmpty() bool {
+	return f.name == "format" && f.user == ""
+}
+
+// parsePrettyFormat returns the format selected by the format string s, as
+// described by PrettyOptions.
+func parsePrettyFormat(c *Client, s string) (prettyFormat, error) {
+	if s == "" {
+		s = "medium"
+	}
+	original := s
+	for aliases := 0; aliases <= len(prettyFormats); aliases++ {
+		switch {
+		case strings.HasPrefix(s, "format:"):
+			return prettyFormat{name: "format", user: s[7:]}, nil
+		case s == "" || strings.HasPrefix(s, "tformat:") || strings.Contains(s, "%"):
+			return prettyFormat{name: "format", user: strings.TrimPrefix(s, "tformat:"), terminator: true}, nil
+		}
+		// Like git, an abbreviation is the shortest name it's a
+		// prefix of.
+		var found *prettyFormat
+		for i, f := range prettyFormats {
+			if strings.HasPrefix(f.name, strings.ToLower(s)) && (found == nil || len(f.name) < len(found.name)) {
+				found = &prettyFormats[i]
+			}
+		}
+		if found != nil {
+			return *found, nil
+		}
+		if s = c.GetConfig("pretty." + s); s == "" {
+			break
+		}
+	}
+	return prettyFormat{}, fmt.Errorf("invalid --pretty format: %v", original)
+}
+
+// A PrettyPrinter formats commits in one of git's pretty formats, for log,
+// show and rev-list. It's git's pretty_print_commit.
+type PrettyPrinter struct {
+	c      *Client
+	opts   PrettyOptions
+	format prettyFormat
+	color  bool
+
+	// Set for rev-list, which doesn't expand the tabs in messages or
+	// show the titles of emails in a Subject header.
+	revList bool
+
+	commitColor string
+}
+
+// NewPrettyPrinter returns a PrettyPrinter for the format selected by
+// opts. If color is set, the commits are coloured by %C in user formats.
+func NewPrettyPrinter(c *Client, opts PrettyOptions, color bool) (*PrettyPrinter, error) {
+	format, err := parsePrettyFormat(c, opts.Format)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DateMode == "" {
+		opts.DateMode = format.dateMode
+	}
+	if _, err := FormatDate(time.Time{}, opts.DateMode); err != nil {
+		return nil, err
+	}
+	p := &PrettyPrinter{c: c, opts: opts, format: format, color: color}
+	if color {
+		colors, err := loadDiffColors(c, true)
+		if err != nil {
+			return nil, err
+		}
+		p.commitColor = colors.Commit
+	}
+	return p, nil
+}
+
+// A prettyCommit is the content of a commit object, split into the lines
+// of its headers and its message.
+type prettyCommit struct {
+	headers []string
+	message string
+}
+
+// header returns the value of the first header called name, or an empty
+// string if there isn't one.
+func (pc prettyCommit) header(name string) string {
+	for _, h := range pc.headers {
+		if strings.HasPrefix(h, name+" ") {
+			return h[len(name)+1:]
+		}
+	}
+	return ""
+}
+
+// person returns the person in the first header called name, and whether
+// it could be parsed.
+func (pc prettyCommit) person(name string) (Person, bool) {
+	p, err := parsePerson(pc.header(name))
+	return p, err == nil
+}
+
+// Message returns cmt formatted the way it's shown after the header line
+// with its id on it, which isn't part of user formats. Unless it's a user
+// format, the notes are shown after the message.
+func (p *PrettyPrinter) Message(cmt CommitID) (string, error) {
+	obj, err := p.c.GetCommitObject(cmt)
+	if err != nil {
+		return "", err
+	}
+	var pc prettyCommit
+	content := string(obj.GetContent())
+	if i := strings.Index(content, "\n\n"); i >= 0 {
+		content, pc.message = content[:i], content[i+2:]
+	}
+	pc.headers = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+
+	if p.format.isUser() {
+		return p.expand(cmt, pc, p.format.user)
+	}
+	msg, err := p.builtin(cmt, pc)
+	if err != nil {
+		return "", err
+	}
+	notes, err := formatNotes(p.c, p.opts.NotesRefs, Sha1(cmt), false)
+	if err != nil || notes == "" {
+		return msg, err
+	}
+	if p.format.isMail() {
+		msg += "---\n"
+	}
+	return msg + notes, nil
+}
+
+// date formats t in mode, which has already been checked to be valid.
+func (p *PrettyPrinter) date(t *time.Time, mode string) string {
+	if t == nil {
+		return ""
+	}
+	s, _ := FormatDate(*t, mode)
+	return s
+}
+
+// builtin returns cmt formatted in one of the named formats which isn't
+// built on a user format.
+func (p *PrettyPrinter) builtin(cmt CommitID, pc prettyCommit) (string, error) {
+	name := p.format.name
+	mail := p.format.isMail()
+	var sb strings.Builder
+	switch {
+	case name == "raw":
+		for _, h := range pc.headers {
+			sb.WriteString(h + "\n")
+		}
+	case name != "oneline":
+		if !mail {
+			merge, err := cmt.mergeHeader(p.c)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(merge)
+		}
+		if author, ok := pc.person("author"); ok {
+			p.writePerson(&sb, "Author", author)
+		}
+		if committer, ok := pc.person("committer"); ok && (name == "full" || name == "fuller") {
+			p.writePerson(&sb, "Commit", committer)
+		}
+	}
+	if name != "oneline" && (!mail || p.revList) {
+		sb.WriteString("\n")
+	}
+
+	msg := skipBlankLines(pc.message)
+	if name == "oneline" || mail {
+		var title string
+		title, msg = messageSubject(msg, " ")
+		switch {
+		case mail && p.revList:
+			sb.WriteString(title + "\n")
+		case mail:
+			subject := "Subject: [PATCH] "
+			if needsRFC2047(title) {
+				sb.WriteString(subject + encodeRFC2047(title, len(subject), false))
+			} else {
+				sb.WriteString(subject + wrapText(title, -len(subject), 1, 78))
+			}
+			sb.WriteString("\n")
+		default:
+			sb.WriteString(title)
+		}
+		if mail {
+			if strings.IndexFunc(msg, func(r rune) bool { return r >= utf8.RuneSelf }) >= 0 {
+				sb.WriteString("MIME-Version: 1.0\nContent-Type: text/plain; charset=UTF-8\nContent-Transfer-Encoding: 8bit\n")
+			}
+			sb.WriteString("\n")
+		}
+	}
+	beginningOfBody := sb.Len()
+	if name != "oneline" {
+		indent := "    "
+		if mail {
+			indent = ""
+		}
+		p.writeRemainder(&sb, msg, indent)
+	}
+	out := strings.TrimRight(sb.String(), " \t\n\r\v\f")
+	if name != "oneline" {
+		out += "\n"
+	}
+	// The blank line between the headers and body of an email is kept
+	// even if the body is empty.
+	if mail && len(out) <= beginningOfBody {
+		out += "\n"
+	}
+	return out, nil
+}
+
+// writePerson writes the lines for the author or committer of a commit in
+// the header of a named format. what is "Author" or "Commit".
+func (p *PrettyPrinter) writePerson(sb *strings.Builder, what string, person Person) {
+	switch p.format.name {
+	case "email", "mboxrd":
+		// Like git, the name is quoted if it needs to be, and wrapped
+		// to fit in an email header.
+		from, width := "From: ", 78
+		switch {
+		case needsRFC2047(person.Name):
+			from += encodeRFC2047(person.Name, len(from), true)
+			width = 76
+		case strings.ContainsAny(person.Name, "()<>[]:;@,.\"\\"):
+			quoted := `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(person.Name) + `"`
+			from += wrapText(quoted, -len(from), 1, width)
+		default:
+			from += wrapText(person.Name, -len(from), 1, width)
+		}
+		sb.WriteString(from)
+		lastLine := from[strings.LastIndexByte(from, '\n')+1:]
+		if width < len(lastLine)+len(person.Email)+3 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(sb, " <%v>\n", person.Email)
+		fmt.Fprintf(sb, "Date: %v\n", p.date(person.Time, "rfc2822"))
+	case "fuller":
+		fmt.Fprintf(sb, "%v:     %v <%v>\n", what, person.Name, person.Email)
+		fmt.Fprintf(sb, "%vDate: %v\n", what, p.date(person.Time, p.opts.DateMode))
+	case "medium":
+		fmt.Fprintf(sb, "%v: %v <%v>\n", what, person.Name, person.Email)
+		fmt.Fprintf(sb, "Date:   %v\n", p.date(person.Time, p.opts.DateMode))
+	default:
+		fmt.Fprintf(sb, "%v: %v <%v>\n", what, person.Name, person.Email)
+	}
+}
+
+// writeRemainder writes the lines of msg after its leading blank lines,
+// with their trailing whitespace removed, after indent. The short format
+// stops at the end of the first paragraph.
+func (p *PrettyPrinter) writeRemainder(sb *strings.Builder, msg, indent string) {
+	first := true
+	for _, line := range strings.SplitAfter(msg, "\n") {
+		if line == "" {
+			break
+		}
+		line = strings.TrimRight(line, " \t\n\r\v\f")
+		if line == "" {
+			if first {
+				continue
+			}
+			if p.format.name == "short" {
+				break
+			}
+		}
+		first = false
+		sb.WriteString(indent)
+		switch {
+		case p.format.expandTabs && !p.revList:
+			line = expandTabs(line, 8)
+		case p.format.name == "mboxrd" && strings.HasPrefix(strings.TrimLeft(line, ">"), "From "):
+			line = ">" + line
+		}
+		sb.WriteString(line + "\n")
+	}
+}
+
+// skipBlankLines returns s after any lines at the start of it which only
+// have whitespace on them.
+func skipBlankLines(s string) string {
+	for s != "" {
+		line := s
+		if i := strings.IndexByte(s, '\n'); i >= 0 {
+			line = s[:i+1]
+		}
+		if strings.TrimSpace(line) != "" {
+			break
+		}
+		s = s[len(line):]
+	}
+	return s
+}
+
+// messageSubject returns the first paragraph of msg, with its lines joined
+// by separator and their trailing whitespace removed, and the rest of msg
+// after the blank line which ends it.
+func messageSubject(msg, separator string) (subject, rest string) {
+	var lines []string
+	for msg != "" {
+		line := msg
+		if i := strings.IndexByte(msg, '\n'); i >= 0 {
+			line = msg[:i+1]
+		}
+		msg = msg[len(line):]
+		line = strings.TrimRight(line, " \t\n\r\v\f")
+		if line == "" {
+			break
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, separator), msg
+}
+
+// expandTabs replaces the tabs in line with spaces up to the next multiple
+// of width columns.
+func expandTabs(line string, width int) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var sb strings.Builder
+	col := 0
+	for _, r := range line {
+		if r == '\t' {
+			n := width - col%width
+			sb.WriteString(strings.Repeat(" ", n))
+			col += n
+			continue
+		}
+		sb.WriteRune(r)
+		col++
+	}
+	return sb.String()
+}
+
+// needsRFC2047 returns whether s needs to be encoded to go in an email
+// header.
+func needsRFC2047(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf || s[i] == '\n' {
+			return true
+		}
+	}
+	return strings.Contains(s, "=?")
+}
+
+// encodeRFC2047 returns s as RFC 2047 "Q" encoded words, broken across
+// lines to fit in 76 columns, when it goes after used columns of a header
+// line. If address is set, it's the name in an address, which limits the
+// characters that can be left as they are.
+func encodeRFC2047(s string, used int, address bool) string {
+	const maxLength = 76
+	var sb strings.Builder
+	sb.WriteString("=?UTF-8?q?")
+	lineLen := used + len("=?UTF-8?q?")
+	for _, r := range s {
+		var buf [utf8.UTFMax]byte
+		enc := buf[:utf8.EncodeRune(buf[:], r)]
+		special := len(enc) > 1 || isRFC2047Special(enc[0], address)
+		encodedLen := 1
+		if special {
+			encodedLen = 3 * len(enc)
+		}
+		if lineLen+encodedLen+2 > maxLength {
+			// It won't fit with the trailing "?=", so the line
+			// is broken.
+			sb.WriteString("?=\n =?UTF-8?q?")
+			lineLen = len(" =?UTF-8?q?")
+		}
+		for _, b := range enc {
+			if special {
+				fmt.Fprintf(&sb, "=%02X", b)
+			} else {
+				sb.WriteByte(b)
+			}
+		}
+		lineLen += encodedLen
+	}
+	sb.WriteString("?=")
+	return sb.String()
+}
+
+// isRFC2047Special returns whether ch needs to be encoded in an RFC 2047
+// encoded word.
+func isRFC2047Special(ch byte, address bool) bool {
+	if ch >= utf8.RuneSelf || ch < ' ' || ch == 0x7f {
+		return true
+	}
+	if ch == ' ' || ch == '=' || ch == '?' || ch == '_' {
+		return true
+	}
+	if !address {
+		return false
+	}
+	isAlnum := (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+	return !isAlnum && !strings.ContainsRune("!*+-/", rune(ch))
+}
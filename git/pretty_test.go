@@ -0,0 +1,175 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFormatDate(t *testing.T) {
+	date := time.Date(2019, 6, 15, 8, 0, 0, 0, time.UTC)
+	defer func(orig func() time.Time) { now = orig }(now)
+	now = func() time.Time { return date.Add(3 * 24 * time.Hour) }
+
+	tests := []struct {
+		mode, want string
+	}{
+		{"", "Sat Jun 15 08:00:00 2019 +0000"},
+		{"default", "Sat Jun 15 08:00:00 2019 +0000"},
+		{"iso", "2019-06-15 08:00:00 +0000"},
+		{"iso-strict", "2019-06-15T08:00:00+00:00"},
+		{"rfc", "Sat, 15 Jun 2019 08:00:00 +0000"},
+		{"short", "2019-06-15"},
+		{"raw", "1560585600 +0000"},
+		{"unix", "1560585600"},
+		{"relative", "3 days ago"},
+		{"format:%Y-%m-%d %H:%M %a %s%%", "2019-06-15 08:00 Sat 1560585600%"},
+	}
+	for _, tc := range tests {
+		got, err := FormatDate(date, tc.mode)
+		if err != nil {
+			t.Errorf("%q: %v", tc.mode, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%q: got %q want %q", tc.mode, got, tc.want)
+		}
+	}
+	if _, err := FormatDate(date, "bogus"); err == nil {
+		t.Error("Expected an error for an unknown date format")
+	}
+
+	// The human format leaves out the time of dates in other years.
+	now = func() time.Time { return date.AddDate(1, 0, 0) }
+	if got, _ := FormatDate(date, "human"); got != "Jun 15 2019" {
+		t.Errorf("human: got %q want %q", got, "Jun 15 2019")
+	}
+
+	relative := []struct {
+		ago  time.Duration
+		want string
+	}{
+		{30 * time.Second, "30 seconds ago"},
+		{5 * time.Minute, "5 minutes ago"},
+		{89 * time.Minute, "89 minutes ago"},
+		{90 * time.Minute, "2 hours ago"},
+		{5 * time.Hour, "5 hours ago"},
+		{20 * 24 * time.Hour, "3 weeks ago"},
+		{100 * 24 * time.Hour, "3 months ago"},
+		{400 * 24 * time.Hour, "1 year, 1 month ago"},
+		{3000 * 24 * time.Hour, "8 years ago"},
+	}
+	for _, tc := range relative {
+		if got := relativeDate(date, date.Add(tc.ago)); got != tc.want {
+			t.Errorf("relative %v: got %q want %q", tc.ago, got, tc.want)
+		}
+	}
+}
+
+func TestPrettyFormats(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo": "a\n"},
+		map[string]string{"foo": "b\n"},
+		map[string]string{"bar": "c\n"},
+	)
+	defer os.RemoveAll(dir)
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := head.TreeID(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := fmt.Sprintf("tree %v\nparent %v\n", tree, head) +
+		"author Ann Author <ann@example.com> 1577869200 +0100\n" +
+		"committer Carl Committer <carl@example.org> 1577982600 -0500\n\n" +
+		"Add b: the\nsecond file\n\nA body paragraph\n\twith a tab.\n\n" +
+		"Signed-off-by: Ann Author <ann@example.com>\nReviewed-by: Rev One <rev@x>\n  continued\n"
+	id, err := c.WriteObject("commit", []byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmt := CommitID(id)
+	config, err := LoadLocalConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.SetConfig("pretty.mine", "tformat:%an")
+	if err := config.WriteConfig(); err != nil {
+		t.Fatal(err)
+	}
+	c.localConfig, c.configCache = nil, nil
+	abbrev := id.Abbrev(c, 7)
+
+	tests := []struct {
+		format string
+		color  bool
+		want   string
+	}{
+		{"oneline", false, "Add b: the second file"},
+		{"onel", false, "Add b: the second file"},
+		{"short", false, "Author: Ann Author <ann@example.com>\n\n    Add b: the\n    second file\n"},
+		{"medium", false, "Author: Ann Author <ann@example.com>\nDate:   Wed Jan 1 10:00:00 2020 +0100\n\n" +
+			"    Add b: the\n    second file\n    \n    A body paragraph\n            with a tab.\n    \n" +
+			"    Signed-off-by: Ann Author <ann@example.com>\n    Reviewed-by: Rev One <rev@x>\n      continued\n"},
+		{"fuller", false, "Author:     Ann Author <ann@example.com>\nAuthorDate: Wed Jan 1 10:00:00 2020 +0100\n" +
+			"Commit:     Carl Committer <carl@example.org>\nCommitDate: Thu Jan 2 11:30:00 2020 -0500\n\n" +
+			"    Add b: the\n    second file\n    \n    A body paragraph\n            with a tab.\n    \n" +
+			"    Signed-off-by: Ann Author <ann@example.com>\n    Reviewed-by: Rev One <rev@x>\n      continued\n"},
+		{"email", false, "From: Ann Author <ann@example.com>\nDate: Wed, 1 Jan 2020 10:00:00 +0100\n" +
+			"Subject: [PATCH] Add b: the second file\n\nA body paragraph\n\twith a tab.\n\n" +
+			"Signed-off-by: Ann Author <ann@example.com>\nReviewed-by: Rev One <rev@x>\n  continued\n"},
+		{"reference", false, abbrev + " (Add b: the second file, 2020-01-01)"},
+		{"mine", false, "Ann Author"},
+		{"format:%h %an <%ae> %ad|%cn %cI", false, abbrev + " Ann Author <ann@example.com> Wed Jan 1 10:00:00 2020 +0100|Carl Committer 2020-01-02T11:30:00-05:00"},
+		{"%H|%P|%T", false, fmt.Sprintf("%v|%v|%v", id, head, tree)},
+		{"%s|%f|%al|%at|%%|%q|%x41", false, "Add b: the second file|Add-b-the|ann|1577869200|%|%q|A"},
+		{"%b", false, "A body paragraph\n\twith a tab.\n\nSigned-off-by: Ann Author <ann@example.com>\nReviewed-by: Rev One <rev@x>\n  continued\n"},
+		{"%G?|%N", false, "N|%N"},
+		{"%(trailers)", false, "Signed-off-by: Ann Author <ann@example.com>\nReviewed-by: Rev One <rev@x>\n  continued\n"},
+		{"%(trailers:key=Reviewed-by,unfold,valueonly)", false, "Rev One <rev@x> continued\n"},
+		{"%(trailers:keyonly,separator=%x2C )", false, "Signed-off-by, Reviewed-by"},
+		{"%(trailers:bogus)", false, "%(trailers:bogus)"},
+		{"%<(6,trunc)%s|%>(12)%an|%<(5)%al|", false, "Add ..|  Ann Author|ann  |"},
+		{"%w(12,0,2)%s", false, "Add b: the\n  second\n  file"},
+		{"%an%-b|%+s", false, "Ann AuthorA body paragraph\n\twith a tab.\n\nSigned-off-by: Ann Author <ann@example.com>\nReviewed-by: Rev One <rev@x>\n  continued\n|\nAdd b: the second file"},
+		// Like git, %N isn't expanded if the notes weren't loaded.
+		{"%an%n%-N|%+N", false, "Ann AuthorN|N"},
+		{"%Cred%al%Creset", false, "ann"},
+		{"%Cred%al%Creset%C(always,blue)x", true, "\x1b[31mann\x1b[m\x1b[34mx"},
+	}
+	for _, tc := range tests {
+		p, err := NewPrettyPrinter(c, PrettyOptions{Format: tc.format}, tc.color)
+		if err != nil {
+			t.Errorf("%q: %v", tc.format, err)
+			continue
+		}
+		got, err := p.Message(cmt)
+		if err != nil {
+			t.Errorf("%q: %v", tc.format, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%q: got %q want %q", tc.format, got, tc.want)
+		}
+	}
+
+	for format, want := range map[string]bool{"%N": true, "%s%-N": true, "%%N": false, "medium": false, "mine": false} {
+		if got := (PrettyOptions{Format: format}).UsesNotes(c); got != want {
+			t.Errorf("%q: got UsesNotes %v want %v", format, got, want)
+		}
+	}
+	if _, err := NewPrettyPrinter(c, PrettyOptions{Format: "nope"}, false); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+	for format, terminator := range map[string]bool{"format:%s": false, "tformat:%s": true, "%s": true, "medium": false, "oneline": true} {
+		f, err := parsePrettyFormat(c, format)
+		if err != nil {
+			t.Errorf("%q: %v", format, err)
+		} else if f.terminator != terminator {
+			t.Errorf("%q: got terminator %v want %v", format, f.terminator, terminator)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package git
 import (
 	"fmt"
 	"os"
+	"strings"
 )
 
 type PushOptions struct {
@@ -39,6 +40,39 @@ func Push(c *Client, opts PushOptions, r Remote, refs []Refname) error {
 		}
 	}
 	for _, ref := range refs {
+		// A leading "+" forces the update of this ref only, so it's
+		// kept on the refs sent for SendPack to check.
+		var force Refname
+		if strings.HasPrefix(ref.String(), "+") {
+			force, ref = "+", ref[1:]
+		}
+		if ref == "" {
+			return fmt.Errorf("invalid refspec '%v'", force)
+		}
+		if strings.HasSuffix(ref.LocalName().String(), "/*") {
+			// A glob such as refs/notes/*:refs/notes/* pushes
+			// every matching local ref.
+			locals, err := ShowRef(c, ShowRefOptions{}, nil)
+			if err != nil {
+				return err
+			}
+			for _, l := range locals {
+				if match, dst := l.MatchesRefSpecSrc(RefSpec(ref)); match {
+					sendrefs = append(sendrefs, force+Refname(l.Name)+":"+dst)
+				}
+			}
+			continue
+		}
+		if !opts.SetUpstream && (ref.LocalName() != ref.RemoteName() || strings.HasPrefix(ref.String(), "refs/")) {
+			// An explicit destination or full refname, such as
+			// refs/notes/commits, is pushed as given.
+			dst := ref.RemoteName()
+			if !strings.HasPrefix(dst.String(), "refs/") {
+				dst = "refs/heads/" + dst
+			}
+			sendrefs = append(sendrefs, force+ref.LocalName()+":"+dst)
+			continue
+		}
 		// Convert from the name given on the command line
 		// to the remote ref in the config
 		// Use the part after the ':' if specified
@@ -64,7 +98,7 @@ func Push(c *Client, opts PushOptions, r Remote, refs []Refname) error {
 					name, os.Args[0], name)
 			}
 		}
-		sendrefs = append(sendrefs, ref.LocalName()+":"+Refname(merge))
+		sendrefs = append(sendrefs, force+ref.LocalName()+":"+Refname(merge))
 	}
 
 	if opts.SetUpstream {
@@ -0,0 +1,1149 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// A rebase replays commits on top of a new base one at a time, using the
+// same machinery as cherry-pick. Its state is kept in .git/rebase-merge,
+// in the same format as git, so that it can be stopped to resolve
+// conflicts or edit a commit and then continued:
+//
+//	head-name        the branch being rebased, or "detached HEAD"
+//	onto             the commit the branch is being rebased onto
+//	orig-head        the commit the branch pointed to before starting
+//	interactive      exists if the rebase is interactive
+//	autostash        the stash of local changes to apply at the end
+//	git-rebase-todo  the commands which have not been run yet
+//	done             the commands which have been run, the last of
+//	                 which is the one which stopped
+//	stopped-sha      the commit being applied when the rebase stopped
+//	message          the message to use when committing the resolution
+//	amend            the commit HEAD pointed to when stopped by "edit"
+//	current-fixups   the squash and fixup commands that are being
+//	                 combined into HEAD
+//	message-squash   the combined message for them
+
+// RebaseOptions are the options that may be passed to Rebase.
+type RebaseOptions struct {
+	// The commit to replay the commits on top of, instead of the
+	// upstream.
+	Onto Commitish
+
+	// Let the user edit the list of commands before starting.
+	Interactive bool
+
+	// Move commits whose subject starts with "fixup! " or "squash! "
+	// after the commit whose subject matches the rest of it, and
+	// change their command to fixup or squash.
+	Autosquash bool
+
+	// Stash any local changes before starting, and apply them again
+	// afterwards.
+	Autostash bool
+
+	// Keep commits which don't change anything, instead of dropping
+	// them.
+	KeepEmpty bool
+
+	// Options for the merge strategy, the same as
+	// MergeOptions.StrategyOptions.
+	StrategyOptions []string
+
+	// Continue, skip the current commit of, abort or forget about a
+	// rebase that was stopped.
+	Continue, Skip, Abort, Quit bool
+}
+
+// rebaseState is the state of a rebase which is in progress, other than
+// the todo list.
+type rebaseState struct {
+	HeadName       string
+	Onto, OrigHead CommitID
+	Interactive    bool
+	KeepEmpty      bool
+
+	// The zero value if there was nothing to stash.
+	Autostash CommitID
+
+	StrategyOptions []string
+}
+
+// rebaseStep is a line in the rebase todo list.
+type rebaseStep struct {
+	// One of pick, reword, edit, squash, fixup, drop, exec or break.
+	Action string
+	Commit CommitID
+
+	// The rest of the line. For exec this is the command to run, for
+	// commands that take a commit it's the commit's subject.
+	Arg string
+}
+
+var rebaseCommands = map[string]string{
+	"p": "pick", "pick": "pick",
+	"r": "reword", "reword": "reword",
+	"e": "edit", "edit": "edit",
+	"s": "squash", "squash": "squash",
+	"f": "fixup", "fixup": "fixup",
+	"d": "drop", "drop": "drop",
+	"x": "exec", "exec": "exec",
+	"b": "break", "break": "break",
+}
+
+// takesCommit returns true if the step's action applies to a commit.
+func (s rebaseStep) takesCommit() bool {
+	return s.Action != "exec" && s.Action != "break"
+}
+
+// isFixup returns true if the step melds its commit into the previous
+// one.
+func (s rebaseStep) isFixup() bool {
+	return s.Action == "squash" || s.Action == "fixup"
+}
+
+// format returns the step as a line of a todo list, with the commit
+// abbreviated if abbrev is set.
+func (s rebaseStep) format(abbrev bool) string {
+	switch {
+	case s.Action == "break":
+		return s.Action
+	case !s.takesCommit():
+		return s.Action + " " + s.Arg
+	}
+	sha := s.Commit.String()
+	if abbrev {
+		sha = sha[:7]
+	}
+	if s.Arg == "" {
+		return s.Action + " " + sha
+	}
+	return s.Action + " " + sha + " " + s.Arg
+}
+
+func (c *Client) rebaseFile(name string) File {
+	return c.GitDir.File(File(filepath.Join("rebase-merge", name)))
+}
+
+func (c *Client) writeRebaseFile(name, content string) error {
+	return c.GitDir.WriteFile(File(filepath.Join("rebase-merge", name)), []byte(content), 0644)
+}
+
+// rebaseInProgress returns true if there's a rebase that was stopped.
+func (c *Client) rebaseInProgress() bool {
+	return c.GitDir.File("rebase-merge").Exists()
+}
+
+// parseRebaseTodo parses the lines of a todo list, skipping comments and
+// blank lines.
+func parseRebaseTodo(c *Client, content string) ([]rebaseStep, error) {
+	var todo []rebaseStep
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 3)
+		action, ok := rebaseCommands[fields[0]]
+		if !ok {
+			return nil, fmt.Errorf("invalid line %d: %v", i+1, line)
+		}
+		step := rebaseStep{Action: action}
+		switch {
+		case action == "break":
+		case action == "exec":
+			step.Arg = strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+			if step.Arg == "" {
+				return nil, fmt.Errorf("missing command on line %d: %v", i+1, line)
+			}
+		case len(fields) < 2:
+			return nil, fmt.Errorf("missing commit on line %d: %v", i+1, line)
+		default:
+			cmt, err := RevParseCommitish(c, &RevParseOptions{}, fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid commit on line %d: %v", i+1, line)
+			}
+			if step.Commit, err = cmt.CommitID(c); err != nil {
+				return nil, err
+			}
+			if len(fields) > 2 {
+				step.Arg = fields[2]
+			}
+		}
+		todo = append(todo, step)
+	}
+	return todo, nil
+}
+
+// readRebaseTodo reads the todo list, or the list of steps which were
+// done, from the rebase state.
+func (c *Client) readRebaseTodo(name string) ([]rebaseStep, error) {
+	content, err := c.rebaseFile(name).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	return parseRebaseTodo(c, content)
+}
+
+func writeRebaseTodo(c *Client, todo []rebaseStep) error {
+	var content string
+	for _, step := range todo {
+		content += step.format(false) + "\n"
+	}
+	return c.writeRebaseFile("git-rebase-todo", content)
+}
+
+// startRebase saves the initial state of a rebase.
+func startRebase(c *Client, state rebaseState, todo []rebaseStep) error {
+	if err := os.MkdirAll(c.GitDir.File("rebase-merge").String(), 0755); err != nil {
+		return err
+	}
+	files := map[string]string{
+		"head-name": state.HeadName,
+		"onto":      state.Onto.String(),
+		"orig-head": state.OrigHead.String(),
+		"done":      "",
+	}
+	if state.Interactive {
+		files["interactive"] = ""
+	}
+	if state.KeepEmpty {
+		files["keep-empty"] = ""
+	}
+	if state.Autostash != (CommitID{}) {
+		files["autostash"] = state.Autostash.String()
+	}
+	if len(state.StrategyOptions) > 0 {
+		files["strategy_opts"] = strings.Join(state.StrategyOptions, " ")
+	}
+	for name, content := range files {
+		if content != "" {
+			content += "\n"
+		}
+		if err := c.writeRebaseFile(name, content); err != nil {
+			return err
+		}
+	}
+	return writeRebaseTodo(c, todo)
+}
+
+// loadRebase reads the state of a rebase that was stopped.
+func loadRebase(c *Client) (rebaseState, error) {
+	if !c.rebaseInProgress() {
+		return rebaseState{}, fmt.Errorf("No rebase in progress?")
+	}
+	var state rebaseState
+	var err error
+	if state.HeadName, err = c.rebaseFile("head-name").ReadFirstLine(); err != nil {
+		return rebaseState{}, err
+	}
+	for name, cmt := range map[string]*CommitID{"onto": &state.Onto, "orig-head": &state.OrigHead} {
+		line, err := c.rebaseFile(name).ReadFirstLine()
+		if err != nil {
+			return rebaseState{}, err
+		}
+		if *cmt, err = CommitIDFromString(line); err != nil {
+			return rebaseState{}, err
+		}
+	}
+	if line, err := c.rebaseFile("autostash").ReadFirstLine(); err == nil {
+		if state.Autostash, err = CommitIDFromString(line); err != nil {
+			return rebaseState{}, err
+		}
+	}
+	if line, err := c.rebaseFile("strategy_opts").ReadFirstLine(); err == nil {
+		state.StrategyOptions = strings.Fields(line)
+	}
+	state.Interactive = c.rebaseFile("interactive").Exists()
+	state.KeepEmpty = c.rebaseFile("keep-empty").Exists()
+	return state, nil
+}
+
+// removeRebaseState removes the state of the rebase in progress and of
+// the step that it was stopped at.
+func (c *Client) removeRebaseState() error {
+	if err := os.RemoveAll(c.GitDir.File("rebase-merge").String()); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(c.GitDir.File("REBASE_HEAD").String()); err != nil {
+		return err
+	}
+	return c.removeMergeState()
+}
+
+// removeRebaseStop removes the state of the step which the rebase was
+// stopped at.
+func (c *Client) removeRebaseStop() error {
+	for _, name := range []string{"stopped-sha", "message", "amend"} {
+		if err := os.RemoveAll(c.rebaseFile(name).String()); err != nil {
+			return err
+		}
+	}
+	if err := os.RemoveAll(c.GitDir.File("REBASE_HEAD").String()); err != nil {
+		return err
+	}
+	return c.removeMergeState()
+}
+
+// removeSquashState forgets about the fixups being combined into HEAD.
+func (c *Client) removeSquashState() error {
+	for _, name := range []string{"current-fixups", "message-squash"} {
+		if err := os.RemoveAll(c.rebaseFile(name).String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rebase replays the commits of the current branch which aren't in
+// upstream on top of upstream, or opts.Onto, and then moves the branch to
+// the result. If branch is not nil, it's checked out first. If upstream is
+// nil, the branch's upstream is used.
+//
+// If the rebase is stopped, because of a conflict or a command in the todo
+// list, the state is saved so that it can be resumed with opts.Continue.
+func Rebase(c *Client, opts RebaseOptions, upstream, branch Commitish) error {
+	switch {
+	case opts.Continue:
+		return rebaseContinue(c)
+	case opts.Skip:
+		return rebaseSkip(c)
+	case opts.Abort:
+		return rebaseAbort(c)
+	case opts.Quit:
+		return rebaseQuit(c)
+	}
+	if c.rebaseInProgress() {
+		return fmt.Errorf("It seems that there is already a rebase-merge directory, and\nI wonder if you are in the middle of another rebase.  If that is the\ncase, please try\n\tdgit rebase (--continue | --abort | --skip)\nIf that is not the case, please\n\trm -fr \"%v\"\nand run me again.  I am stopping in case you still have something\nvaluable there.", c.GitDir.File("rebase-merge"))
+	}
+	if c.GitDir.File("MERGE_HEAD").Exists() || c.sequencerInProgress() {
+		return fmt.Errorf("cannot rebase: a merge, cherry-pick or revert is in progress.")
+	}
+
+	if branch != nil {
+		if err := CheckoutCommit(c, CheckoutOptions{}, branch); err != nil {
+			return err
+		}
+	}
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		return err
+	}
+	state := rebaseState{
+		HeadName:        "detached HEAD",
+		OrigHead:        head,
+		Interactive:     opts.Interactive,
+		KeepEmpty:       opts.KeepEmpty,
+		StrategyOptions: opts.StrategyOptions,
+	}
+	if b := c.GetHeadBranch(); b != "" {
+		state.HeadName = b.String()
+	}
+	if upstream == nil {
+		b, err := c.GetHeadBranch().Upstream(c)
+		if err != nil {
+			return err
+		}
+		if b == "" {
+			return fmt.Errorf("There is no tracking information for the current branch.\nPlease specify which branch you want to rebase against.")
+		}
+		upstream = b
+	}
+	upstreamID, err := upstream.CommitID(c)
+	if err != nil {
+		return err
+	}
+	state.Onto = upstreamID
+	if opts.Onto != nil {
+		if state.Onto, err = opts.Onto.CommitID(c); err != nil {
+			return err
+		}
+	}
+
+	if err := checkCleanWorkTree(c, head, "rebase"); err != nil {
+		if !opts.Autostash {
+			return err
+		}
+		if state.Autostash, err = createStash(c, StashPushOptions{}, nil); err != nil {
+			return err
+		}
+		fmt.Printf("Created autostash: %v\n", state.Autostash.String()[:7])
+		if err := ResetMode(c, ResetOptions{Hard: true}, head); err != nil {
+			return err
+		}
+	}
+	// Once the changes are stashed, they need to be restored if the
+	// rebase doesn't start.
+	abandon := func(err error) error {
+		c.removeRebaseState()
+		if state.Autostash != (CommitID{}) {
+			if aerr := applyAutostash(c, state.Autostash); aerr != nil {
+				return aerr
+			}
+		}
+		return err
+	}
+
+	// If the commits are already on top of onto, there's nothing to
+	// do unless the user wants to change them.
+	if !opts.Interactive && state.Onto.IsAncestor(c, head) {
+		if base, err := MergeBase(c, MergeBaseOptions{}, []Commitish{upstreamID, head}); err == nil && base == state.Onto {
+			fmt.Printf("Current branch %v is up to date.\n", Branch(state.HeadName).BranchName())
+			return abandon(nil)
+		}
+	}
+
+	revs, err := RevList(c, RevListOptions{Quiet: true}, nil, []Commitish{head}, []Commitish{upstreamID})
+	if err != nil {
+		return abandon(err)
+	}
+	var todo []rebaseStep
+	for i := len(revs) - 1; i >= 0; i-- {
+		cmt := CommitID(revs[i])
+		parents, err := cmt.Parents(c)
+		if err != nil {
+			return abandon(err)
+		}
+		if len(parents) > 1 {
+			// Merges are linearized.
+			continue
+		}
+		if !opts.KeepEmpty {
+			if empty, err := isEmptyCommit(c, cmt); err != nil {
+				return abandon(err)
+			} else if empty {
+				continue
+			}
+		}
+		msg, err := cmt.GetCommitMessage(c)
+		if err != nil {
+			return abandon(err)
+		}
+		todo = append(todo, rebaseStep{Action: "pick", Commit: cmt, Arg: msg.Subject()})
+	}
+	if opts.Autosquash {
+		todo = rebaseAutosquash(todo)
+	}
+
+	if err := startRebase(c, state, todo); err != nil {
+		return abandon(err)
+	}
+	if opts.Interactive {
+		if todo, err = editRebaseTodo(c, todo, upstreamID, head, state.Onto); err != nil {
+			return abandon(err)
+		}
+		if len(todo) == 0 {
+			return abandon(fmt.Errorf("Nothing to do"))
+		}
+		if err := writeRebaseTodo(c, todo); err != nil {
+			return abandon(err)
+		}
+	}
+
+	if err := rebaseCheckout(c, state.Onto, fmt.Sprintf("rebase (start): checkout %v", state.Onto)); err != nil {
+		return abandon(err)
+	}
+	return runRebase(c, state)
+}
+
+// checkCleanWorkTree returns an error if there are any changes to
+// tracked files in the index or work tree relative to head, which would
+// prevent action.
+func checkCleanWorkTree(c *Client, head CommitID, action string) error {
+	idx, err := c.GitDir.ReadIndex()
+	if err != nil {
+		return err
+	}
+	if len(idx.GetUnmerged()) > 0 {
+		return fmt.Errorf("cannot %v: You have unmerged files.", action)
+	}
+	unstaged, err := DiffFiles(c, DiffFilesOptions{}, nil)
+	if err != nil {
+		return err
+	}
+	if len(unstaged) > 0 {
+		return fmt.Errorf("cannot %v: You have unstaged changes.\nPlease commit or stash them.", action)
+	}
+	staged, err := DiffIndex(c, DiffIndexOptions{Cached: true}, idx, head, nil)
+	if err != nil {
+		return err
+	}
+	if len(staged) > 0 {
+		return fmt.Errorf("cannot %v: Your index contains uncommitted changes.\nPlease commit or stash them.", action)
+	}
+	return nil
+}
+
+// isEmptyCommit returns true if cmt doesn't change anything relative to
+// its first parent.
+func isEmptyCommit(c *Client, cmt CommitID) (bool, error) {
+	tree, err := cmt.TreeID(c)
+	if err != nil {
+		return false, err
+	}
+	parents, err := cmt.Parents(c)
+	if err != nil {
+		return false, err
+	}
+	if len(parents) == 0 {
+		empty, err := WriteTreeFromIndex(c, NewIndex(), WriteTreeOptions{})
+		return tree == empty, err
+	}
+	parentTree, err := parents[0].TreeID(c)
+	return tree == parentTree, err
+}
+
+// rebaseAutosquash moves the commits in todo which are marked as fixups
+// of another commit by their subject to after that commit, and changes
+// their command to match.
+func rebaseAutosquash(todo []rebaseStep) []rebaseStep {
+	// The index of the step that each fixup is moved after, and the
+	// fixups that are moved after each step.
+	target := make(map[int]int)
+	fixups := make(map[int][]int)
+	for i, step := range todo {
+		// The first prefix decides the action, but there may be more
+		// than one for fixups of fixups.
+		subject, action := step.Arg, ""
+	prefixes:
+		for {
+			var prefix string
+			switch {
+			case strings.HasPrefix(subject, "fixup! "):
+				prefix = "fixup"
+			case strings.HasPrefix(subject, "squash! "):
+				prefix = "squash"
+			default:
+				break prefixes
+			}
+			if action == "" {
+				action = prefix
+			}
+			subject = subject[len(prefix)+2:]
+		}
+		if action == "" {
+			continue
+		}
+		// Prefer an exact match of the subject, then a commit id,
+		// then a prefix of the subject.
+		found := -1
+		for j := 0; j < i && found < 0; j++ {
+			if todo[j].Arg == subject {
+				found = j
+			}
+		}
+		for j := 0; j < i && found < 0; j++ {
+			if len(subject) >= 4 && strings.HasPrefix(todo[j].Commit.String(), subject) {
+				found = j
+			}
+		}
+		for j := 0; j < i && found < 0; j++ {
+			if strings.HasPrefix(todo[j].Arg, subject) {
+				found = j
+			}
+		}
+		if found < 0 {
+			continue
+		}
+		// Fixups of fixups go after the original commit.
+		if t, ok := target[found]; ok {
+			found = t
+		}
+		todo[i].Action = action
+		target[i] = found
+		fixups[found] = append(fixups[found], i)
+	}
+
+	sorted := make([]rebaseStep, 0, len(todo))
+	for i, step := range todo {
+		if _, ok := target[i]; ok {
+			continue
+		}
+		sorted = append(sorted, step)
+		for _, j := range fixups[i] {
+			sorted = append(sorted, todo[j])
+		}
+	}
+	return sorted
+}
+
+const rebaseTodoHelp = `
+# Rebase %v..%v onto %v (%d %v)
+#
+# Commands:
+# p, pick <commit> = use commit
+# r, reword <commit> = use commit, but edit the commit message
+# e, edit <commit> = use commit, but stop for amending
+# s, squash <commit> = use commit, but meld into previous commit
+# f, fixup <commit> = like "squash" but keep only the previous
+#                    commit's log message
+# x, exec <command> = run command (the rest of the line) using shell
+# b, break = stop here (continue rebase later with 'dgit rebase --continue')
+# d, drop <commit> = remove commit
+#
+# These lines can be re-ordered; they are executed from top to bottom.
+#
+# If you remove a line here THAT COMMIT WILL BE LOST.
+#
+# However, if you remove everything, the rebase will be aborted.
+#
+`
+
+// editRebaseTodo lets the user edit the todo list with the sequence
+// editor, and returns the edited list.
+func editRebaseTodo(c *Client, todo []rebaseStep, upstream, head, onto CommitID) ([]rebaseStep, error) {
+	var content string
+	for _, step := range todo {
+		content += step.format(true) + "\n"
+	}
+	commands := "commands"
+	if len(todo) == 1 {
+		commands = "command"
+	}
+	content += fmt.Sprintf(rebaseTodoHelp, upstream.String()[:7], head.String()[:7], onto.String()[:7], len(todo), commands)
+	if err := c.writeRebaseFile("git-rebase-todo", content); err != nil {
+		return nil, err
+	}
+	if err := c.execSequenceEditor(c.rebaseFile("git-rebase-todo")); err != nil {
+		return nil, err
+	}
+	edited, err := c.readRebaseTodo("git-rebase-todo")
+	if err != nil {
+		return nil, err
+	}
+	for _, step := range edited {
+		if !step.takesCommit() {
+			continue
+		}
+		if step.isFixup() {
+			return nil, fmt.Errorf("cannot '%v' without a previous commit", step.Action)
+		}
+		break
+	}
+	return edited, nil
+}
+
+// execSequenceEditor invokes the editor for the rebase todo list, which
+// is GIT_SEQUENCE_EDITOR or sequence.editor if set, and otherwise the
+// normal editor.
+func (c *Client) execSequenceEditor(f File) error {
+	editor := os.Getenv("GIT_SEQUENCE_EDITOR")
+	if editor == "" {
+		editor = c.GetConfig("sequence.editor")
+	}
+	if editor == "" {
+		return c.ExecEditor(f)
+	}
+	// The editor is a shell command which may have arguments of its
+	// own, so let the shell parse it.
+	cmd := exec.Command(posixShell, "-c", editor+` "$@"`, editor, f.String())
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// rebaseCheckout detaches HEAD at cmt and resets the index and work tree
+// to it.
+func rebaseCheckout(c *Client, cmt CommitID, reason string) error {
+	if err := UpdateRef(c, UpdateRefOptions{NoDeref: true}, "HEAD", cmt, reason); err != nil {
+		return err
+	}
+	idx, err := ReadTree(c, ReadTreeOptions{Reset: true, Update: true}, cmt)
+	if err != nil {
+		return err
+	}
+	return CheckoutIndexUncommited(c, idx, CheckoutIndexOptions{All: true, Force: true, UpdateStat: true}, nil)
+}
+
+// runRebase runs the commands in the todo list until it's empty, and
+// then finishes the rebase. If a command stops the rebase, it returns
+// with the rest of the commands still in the todo list.
+func runRebase(c *Client, state rebaseState) error {
+	for {
+		todo, err := c.readRebaseTodo("git-rebase-todo")
+		if err != nil {
+			return err
+		}
+		if len(todo) == 0 {
+			return finishRebase(c, state)
+		}
+		step := todo[0]
+		if err := writeRebaseTodo(c, todo[1:]); err != nil {
+			return err
+		}
+		if err := c.rebaseFile("done").Append(step.format(false) + "\n"); err != nil {
+			return err
+		}
+		final := len(todo) == 1 || !todo[1].isFixup()
+		stopped, err := rebaseApply(c, state, step, final)
+		if err != nil || stopped {
+			return err
+		}
+	}
+}
+
+// rebaseApply runs a single step of the rebase. It returns true if the
+// step stopped the rebase without an error, as for edit and break. final
+// is whether the step is the last one in a chain of fixups.
+func rebaseApply(c *Client, state rebaseState, step rebaseStep, final bool) (bool, error) {
+	switch step.Action {
+	case "drop":
+		return false, nil
+	case "break":
+		return true, nil
+	case "exec":
+		fmt.Fprintf(os.Stderr, "Executing: %v\n", step.Arg)
+		cmd := exec.Command(posixShell, "-c", step.Arg)
+		cmd.Dir = c.WorkDir.String()
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return true, fmt.Errorf("Execution failed: %v\nYou can fix the problem, and then run\n\n  dgit rebase --continue\n", step.Arg)
+		}
+		return false, nil
+	}
+
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		return false, err
+	}
+	msg, err := step.Commit.GetCommitMessage(c)
+	if err != nil {
+		return false, err
+	}
+	if step.isFixup() {
+		if err := addToSquashMessage(c, step, head); err != nil {
+			return false, err
+		}
+	}
+
+	// Commits which are already on top of HEAD don't need to be
+	// rewritten.
+	parents, err := step.Commit.Parents(c)
+	if err != nil {
+		return false, err
+	}
+	if (step.Action == "pick" || step.Action == "edit") && len(parents) == 1 && parents[0] == head {
+		if _, err := ReadTreeFastForward(c, ReadTreeOptions{Merge: true, Update: true}, head, step.Commit); err != nil {
+			return false, err
+		}
+		if err := UpdateRef(c, UpdateRefOptions{OldValue: head}, "HEAD", step.Commit, "rebase: fast-forward"); err != nil {
+			return false, err
+		}
+		if step.Action == "edit" {
+			return true, rebaseStopForEdit(c, step)
+		}
+		return false, nil
+	}
+
+	result, _, _, err := sequencerMerge(c, sequencerOptions{StrategyOptions: state.StrategyOptions}, sequencerStep{"pick", step.Commit}, head)
+	if err != nil {
+		return false, err
+	}
+	if !result.Clean() {
+		return false, rebaseConflict(c, step, string(msg), result)
+	}
+	if err := rebaseCommitStep(c, state, step, string(msg), final); err != nil {
+		return false, err
+	}
+	if step.Action == "edit" {
+		return true, rebaseStopForEdit(c, step)
+	}
+	return false, nil
+}
+
+// rebaseCommitStep commits the index as the result of step, whose
+// message is msg.
+func rebaseCommitStep(c *Client, state rebaseState, step rebaseStep, msg string, final bool) error {
+	if step.isFixup() {
+		return rebaseCommitFixup(c, step, final)
+	}
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		return err
+	}
+	idx, err := c.GitDir.ReadIndex()
+	if err != nil {
+		return err
+	}
+	tree, err := WriteTreeFromIndex(c, idx, WriteTreeOptions{})
+	if err != nil {
+		return err
+	}
+	headTree, err := head.TreeID(c)
+	if err != nil {
+		return err
+	}
+	if tree == headTree {
+		// Commits which became empty are dropped, but commits which
+		// were empty to begin with are only here if they're being
+		// kept.
+		empty, err := isEmptyCommit(c, step.Commit)
+		if err != nil {
+			return err
+		}
+		if !empty || !state.KeepEmpty {
+			fmt.Printf("dropping %v %v -- patch contents already upstream\n", step.Commit, step.Arg)
+			return nil
+		}
+	}
+	return rebaseCommit(c, step, msg, "default", step.Action == "reword", false)
+}
+
+// rebaseCommit commits the index with message, cleaned up with
+// cleanupMode. The commit replaces HEAD if amend is set, and otherwise
+// is added on top of it with the author of step's commit. If edit is set,
+// the user can edit the message first.
+func rebaseCommit(c *Client, step rebaseStep, message, cleanupMode string, edit, amend bool) error {
+	idx, err := c.GitDir.ReadIndex()
+	if err != nil {
+		return err
+	}
+	tree, err := WriteTreeFromIndex(c, idx, WriteTreeOptions{})
+	if err != nil {
+		return err
+	}
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		return err
+	}
+	parents, author := []CommitID{head}, step.Commit
+	if amend {
+		if parents, err = head.Parents(c); err != nil {
+			return err
+		}
+		author = head
+	}
+
+	if edit {
+		if err := c.GitDir.WriteFile("COMMIT_EDITMSG", []byte(message), 0644); err != nil {
+			return err
+		}
+		if err := c.ExecEditor(c.GitDir.File("COMMIT_EDITMSG")); err != nil {
+			return err
+		}
+		edited, err := c.GitDir.File("COMMIT_EDITMSG").ReadAll()
+		if err != nil {
+			return err
+		}
+		message = edited
+	}
+	cleaned, err := CommitMessage(message).Cleanup(cleanupMode, edit)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(cleaned) == "" {
+		return fmt.Errorf("Aborting commit due to empty commit message.")
+	}
+
+	restore, err := useAuthorOf(c, author)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	cid, err := CommitTree(c, CommitTreeOptions{}, tree, parents, cleaned)
+	if err != nil && err != NoGlobalConfig {
+		return err
+	}
+	refmsg := fmt.Sprintf("rebase (%v): %v", step.Action, CommitMessage(cleaned).Subject())
+	return UpdateRef(c, UpdateRefOptions{OldValue: head}, "HEAD", cid, refmsg)
+}
+
+// addToSquashMessage adds the message of step's commit to the combined
+// message of the commits being melded into head.
+func addToSquashMessage(c *Client, step rebaseStep, head CommitID) error {
+	fixups, _ := c.rebaseFile("current-fixups").ReadAll()
+	var text string
+	if fixups == "" {
+		msg, err := head.GetCommitMessage(c)
+		if err != nil {
+			return err
+		}
+		text = "# This is a combination of 2 commits.\n# This is the 1st commit message:\n\n" + strings.TrimRight(string(msg), "\n") + "\n"
+	} else {
+		var err error
+		if text, err = c.rebaseFile("message-squash").ReadAll(); err != nil {
+			return err
+		}
+	}
+	n := strings.Count(fixups, "\n") + 2
+	if nl := strings.Index(text, "\n"); nl >= 0 {
+		text = fmt.Sprintf("# This is a combination of %d commits.", n) + text[nl:]
+	}
+
+	msg, err := step.Commit.GetCommitMessage(c)
+	if err != nil {
+		return err
+	}
+	if step.Action == "squash" {
+		text += fmt.Sprintf("\n# This is the commit message #%d:\n\n%v\n", n, strings.TrimRight(string(msg), "\n"))
+	} else {
+		var commented []string
+		for _, line := range strings.Split(strings.TrimRight(string(msg), "\n"), "\n") {
+			if line == "" {
+				commented = append(commented, "#")
+			} else {
+				commented = append(commented, "# "+line)
+			}
+		}
+		text += fmt.Sprintf("\n# The commit message #%d will be skipped:\n\n%v\n", n, strings.Join(commented, "\n"))
+	}
+	if err := c.writeRebaseFile("message-squash", text); err != nil {
+		return err
+	}
+	return c.writeRebaseFile("current-fixups", fixups+step.Action+" "+step.Commit.String()+"\n")
+}
+
+// rebaseCommitFixup melds the index into HEAD for a squash or fixup step.
+// When the step is the last one of a chain of fixups which included a
+// squash, the user edits the combined message.
+func rebaseCommitFixup(c *Client, step rebaseStep, final bool) error {
+	text, err := c.rebaseFile("message-squash").ReadAll()
+	if err != nil {
+		return err
+	}
+	edit := false
+	if final {
+		fixups, err := c.rebaseFile("current-fixups").ReadAll()
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(fixups, "\n") {
+			if strings.HasPrefix(line, "squash ") {
+				edit = true
+			}
+		}
+	}
+	if err := rebaseCommit(c, step, text, "strip", edit, true); err != nil {
+		return err
+	}
+	if final {
+		return c.removeSquashState()
+	}
+	return nil
+}
+
+// rebaseConflict saves the state for a step which couldn't be applied
+// cleanly, and returns an error telling the user how to continue.
+func rebaseConflict(c *Client, step rebaseStep, msg string, result *treeMergeResult) error {
+	if err := c.writeRebaseFile("stopped-sha", step.Commit.String()+"\n"); err != nil {
+		return err
+	}
+	if err := c.writeRebaseFile("message", msg); err != nil {
+		return err
+	}
+	if err := c.GitDir.WriteFile("REBASE_HEAD", []byte(step.Commit.String()+"\n"), 0644); err != nil {
+		return err
+	}
+	mergeMsg := msg + "\n# Conflicts:\n"
+	for _, path := range result.Conflicts {
+		mergeMsg += "#\t" + path.String() + "\n"
+	}
+	if err := c.GitDir.WriteFile("MERGE_MSG", []byte(mergeMsg), 0644); err != nil {
+		return err
+	}
+	return fmt.Errorf("could not apply %v... %v\nhint: Resolve all conflicts manually, mark them as resolved with\nhint: \"dgit add/rm <conflicted_files>\", then run \"dgit rebase --continue\".\nhint: You can instead skip this commit: run \"dgit rebase --skip\".\nhint: To abort and get back to the state before \"dgit rebase\", run \"dgit rebase --abort\".", step.Commit.String()[:7], CommitMessage(msg).Subject())
+}
+
+// rebaseStopForEdit stops the rebase after step was applied, so that the
+// user can amend it.
+func rebaseStopForEdit(c *Client, step rebaseStep) error {
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		return err
+	}
+	if err := c.writeRebaseFile("stopped-sha", step.Commit.String()+"\n"); err != nil {
+		return err
+	}
+	if err := c.writeRebaseFile("amend", head.String()+"\n"); err != nil {
+		return err
+	}
+	if err := c.GitDir.WriteFile("REBASE_HEAD", []byte(step.Commit.String()+"\n"), 0644); err != nil {
+		return err
+	}
+	msg, err := head.GetCommitMessage(c)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Stopped at %v...  %v\nYou can amend the commit now, with\n\n  dgit commit --amend \n\nOnce you are satisfied with your changes, run\n\n  dgit rebase --continue\n", step.Commit.String()[:7], msg.Subject())
+	return nil
+}
+
+// rebaseContinue commits the changes for the step that the rebase was
+// stopped at, if needed, and then runs the rest of the todo list.
+func rebaseContinue(c *Client) error {
+	state, err := loadRebase(c)
+	if err != nil {
+		return err
+	}
+	idx, err := c.GitDir.ReadIndex()
+	if err != nil {
+		return err
+	}
+	if len(idx.GetUnmerged()) > 0 {
+		return fmt.Errorf("You must edit all merge conflicts and then\nmark them as resolved using dgit add")
+	}
+	tree, err := WriteTreeFromIndex(c, idx, WriteTreeOptions{})
+	if err != nil {
+		return err
+	}
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		return err
+	}
+	headTree, err := head.TreeID(c)
+	if err != nil {
+		return err
+	}
+	done, err := c.readRebaseTodo("done")
+	if err != nil {
+		return err
+	}
+
+	if amend, err := c.rebaseFile("amend").ReadFirstLine(); err == nil {
+		// Stopped by an edit command. Staged changes are amended
+		// into the commit, unless the user already committed.
+		if tree != headTree {
+			if amend != head.String() {
+				return fmt.Errorf("You have uncommitted changes in your working tree. Please, commit them\nfirst and then run 'dgit rebase --continue' again.")
+			}
+			msg, err := head.GetCommitMessage(c)
+			if err != nil {
+				return err
+			}
+			if err := rebaseCommit(c, rebaseStep{Action: "edit", Commit: head}, string(msg), "default", false, true); err != nil {
+				return err
+			}
+		}
+	} else if c.rebaseFile("stopped-sha").Exists() && len(done) > 0 {
+		// Stopped because of conflicts, which have now been resolved.
+		step := done[len(done)-1]
+		msg, err := c.rebaseFile("message").ReadAll()
+		if err != nil {
+			return err
+		}
+		if tree != headTree || step.isFixup() {
+			todo, err := c.readRebaseTodo("git-rebase-todo")
+			if err != nil {
+				return err
+			}
+			final := len(todo) == 0 || !todo[0].isFixup()
+			if err := rebaseCommitStep(c, state, step, msg, final); err != nil {
+				return err
+			}
+		}
+		if step.Action == "edit" {
+			if err := c.removeRebaseStop(); err != nil {
+				return err
+			}
+			return rebaseStopForEdit(c, step)
+		}
+	}
+	if err := c.removeRebaseStop(); err != nil {
+		return err
+	}
+	return runRebase(c, state)
+}
+
+// rebaseSkip discards the changes from the step that the rebase was
+// stopped at, and runs the rest of the todo list.
+func rebaseSkip(c *Client) error {
+	state, err := loadRebase(c)
+	if err != nil {
+		return err
+	}
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		return err
+	}
+	if err := ResetMode(c, ResetOptions{Hard: true}, head); err != nil {
+		return err
+	}
+	if err := c.removeRebaseStop(); err != nil {
+		return err
+	}
+	// If the skipped step ended a chain of fixups, HEAD already has
+	// the rest of the chain.
+	todo, err := c.readRebaseTodo("git-rebase-todo")
+	if err != nil {
+		return err
+	}
+	if len(todo) == 0 || !todo[0].isFixup() {
+		if err := c.removeSquashState(); err != nil {
+			return err
+		}
+	}
+	return runRebase(c, state)
+}
+
+// rebaseAbort goes back to the branch and commit that were checked out
+// before the rebase started.
+func rebaseAbort(c *Client) error {
+	state, err := loadRebase(c)
+	if err != nil {
+		return err
+	}
+	if err := ResetMode(c, ResetOptions{Hard: true}, state.OrigHead); err != nil {
+		return err
+	}
+	if state.HeadName != "detached HEAD" {
+		if err := SymbolicRefUpdate(c, SymbolicRefOptions{}, "HEAD", RefSpec(state.HeadName), "rebase (abort): returning to "+state.HeadName); err != nil {
+			return err
+		}
+	}
+	if err := c.removeRebaseState(); err != nil {
+		return err
+	}
+	if state.Autostash != (CommitID{}) {
+		return applyAutostash(c, state.Autostash)
+	}
+	return nil
+}
+
+// rebaseQuit forgets about the rebase in progress without changing HEAD.
+// Any autostash is saved in the stash list.
+func rebaseQuit(c *Client) error {
+	state, err := loadRebase(c)
+	if err != nil {
+		return err
+	}
+	if state.Autostash != (CommitID{}) {
+		if err := storeStash(c, state.Autostash, "autostash"); err != nil {
+			return err
+		}
+	}
+	return c.removeRebaseState()
+}
+
+// finishRebase moves the branch being rebased to HEAD and checks it out
+// again.
+func finishRebase(c *Client, state rebaseState) error {
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		return err
+	}
+	if state.HeadName != "detached HEAD" {
+		if err := UpdateRef(c, UpdateRefOptions{OldValue: state.OrigHead, CreateReflog: true}, state.HeadName, head, fmt.Sprintf("rebase (finish): %v onto %v", state.HeadName, state.Onto)); err != nil {
+			return err
+		}
+		if err := SymbolicRefUpdate(c, SymbolicRefOptions{}, "HEAD", RefSpec(state.HeadName), "rebase (finish): returning to "+state.HeadName); err != nil {
+			return err
+		}
+	}
+	if err := c.removeRebaseState(); err != nil {
+		return err
+	}
+	if state.Autostash != (CommitID{}) {
+		if err := applyAutostash(c, state.Autostash); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Successfully rebased and updated %v.\n", state.HeadName)
+	return nil
+}
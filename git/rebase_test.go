@@ -0,0 +1,163 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestRebase(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo.txt": "a\nb\nc\nd\ne\n"},
+		map[string]string{"foo.txt": "A\nb\nc\nd\ne\n"},
+		map[string]string{"foo.txt": "a\nb\nc\nd\nE\n", "bar.txt": "bar\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	master, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Checkout(c, CheckoutOptions{}, "topic", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := Rebase(c, RebaseOptions{}, Branch("refs/heads/master"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if b := c.GetHeadBranch(); b != "refs/heads/topic" {
+		t.Errorf("Unexpected branch after rebase: got %v", b)
+	}
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parents, _ := head.Parents(c); len(parents) != 1 || parents[0] != master {
+		t.Errorf("Unexpected parents of rebased commit: %v", parents)
+	}
+	if author, _ := head.GetAuthor(c); author.Name != "John Smith" {
+		t.Errorf("Unexpected author of rebased commit: %v", author)
+	}
+	if content, _ := ioutil.ReadFile("foo.txt"); string(content) != "A\nb\nc\nd\nE\n" {
+		t.Errorf("Unexpected content after rebase: got %q", content)
+	}
+	if c.rebaseInProgress() {
+		t.Error("Rebase state left behind after rebase")
+	}
+
+	// Rebasing again doesn't do anything.
+	if err := Rebase(c, RebaseOptions{}, Branch("refs/heads/master"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if cur, _ := c.GetHeadCommit(); cur != head {
+		t.Errorf("Rebase of up to date branch changed HEAD")
+	}
+}
+
+func TestRebaseConflict(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo.txt": "foo\n"},
+		map[string]string{"foo.txt": "ours\n"},
+		map[string]string{"foo.txt": "theirs\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	master, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Checkout(c, CheckoutOptions{}, "topic", nil); err != nil {
+		t.Fatal(err)
+	}
+	topic, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Rebase(c, RebaseOptions{}, master, nil); err == nil {
+		t.Fatal("Expected conflicting rebase to fail")
+	}
+	if !c.rebaseInProgress() || !c.GitDir.File("REBASE_HEAD").Exists() {
+		t.Fatal("Rebase state not saved after conflict")
+	}
+	if err := Rebase(c, RebaseOptions{}, master, nil); err == nil {
+		t.Error("Expected rebase while one is in progress to fail")
+	}
+	if err := Rebase(c, RebaseOptions{Continue: true}, nil, nil); err == nil {
+		t.Error("Expected continue with unresolved conflicts to fail")
+	}
+
+	// Abort and try again, then resolve the conflict.
+	if err := Rebase(c, RebaseOptions{Abort: true}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if b := c.GetHeadBranch(); b != "refs/heads/topic" {
+		t.Errorf("Unexpected branch after abort: got %v", b)
+	}
+	if cur, _ := c.GetHeadCommit(); cur != topic {
+		t.Errorf("Unexpected HEAD after abort: got %v want %v", cur, topic)
+	}
+	if content, _ := ioutil.ReadFile("foo.txt"); string(content) != "theirs\n" {
+		t.Errorf("Unexpected content after abort: got %q", content)
+	}
+	if c.rebaseInProgress() || c.GitDir.File("REBASE_HEAD").Exists() {
+		t.Error("Rebase state not removed by abort")
+	}
+
+	if err := Rebase(c, RebaseOptions{}, master, nil); err == nil {
+		t.Fatal("Expected conflicting rebase to fail")
+	}
+	if err := ioutil.WriteFile("foo.txt", []byte("resolved\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Add(c, AddOptions{}, []File{"foo.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Rebase(c, RebaseOptions{Continue: true}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parents, _ := head.Parents(c); len(parents) != 1 || parents[0] != master {
+		t.Errorf("Unexpected parents of rebased commit: %v", parents)
+	}
+	if msg, _ := head.GetCommitMessage(c); string(msg) != "theirs\n" {
+		t.Errorf("Unexpected message: got %q", msg)
+	}
+	if c.rebaseInProgress() {
+		t.Error("Rebase state left behind after continue")
+	}
+}
+
+func TestRebaseAutosquash(t *testing.T) {
+	cmt := func(n byte) CommitID {
+		var id CommitID
+		id[0] = n
+		return id
+	}
+	todo := []rebaseStep{
+		{"pick", cmt(1), "first"},
+		{"pick", cmt(2), "second"},
+		{"pick", cmt(3), "fixup! first"},
+		{"pick", cmt(4), "squash! fixup! first"},
+		{"pick", cmt(5), "squash! sec"},
+		{"pick", cmt(6), "fixup! nothing"},
+	}
+	want := []rebaseStep{
+		{"pick", cmt(1), "first"},
+		{"fixup", cmt(3), "fixup! first"},
+		{"squash", cmt(4), "squash! fixup! first"},
+		{"pick", cmt(2), "second"},
+		{"squash", cmt(5), "squash! sec"},
+		{"pick", cmt(6), "fixup! nothing"},
+	}
+	got := rebaseAutosquash(todo)
+	if len(got) != len(want) {
+		t.Fatalf("Unexpected autosquash result: got %v want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Unexpected step %d: got %v want %v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A RefBackend is the storage used for the refs and reflogs of a
+// repository.
+//
+// Ref values are stored as strings. A symbolic ref has the value
+// "ref: <target>", while other refs have the hex encoded sha1 that
+// they point to as their value.
+type RefBackend interface {
+	// ReadRef returns the raw value of the ref name, or an error
+	// for which os.IsNotExist is true if it doesn't exist.
+	ReadRef(name string) (string, error)
+
+	// WriteRef sets the ref name to value. If entry is not nil, it
+	// is added to the reflog for name.
+	WriteRef(name, value string, entry *ReflogEntry) error
+
+	// DeleteRef deletes the ref name and its reflog.
+	DeleteRef(name string) error
+
+	// ListRefs returns the sorted names of all refs under refs/
+	// which start with prefix.
+	ListRefs(prefix string) ([]string, error)
+
+	// ReflogExists returns true if there is a reflog for name.
+	ReflogExists(name string) bool
+
+	// ReadReflog returns the entries of the reflog for name,
+	// oldest first.
+	ReadReflog(name string) ([]ReflogEntry, error)
+
+	// AppendReflog adds entry to the reflog for name, creating the
+	// reflog if necessary.
+	AppendReflog(name string, entry ReflogEntry) error
+
+	// WriteReflog replaces the reflog for name with entries.
+	WriteReflog(name string, entries []ReflogEntry) error
+}
+
+// Refs returns the RefBackend that should be used to access refs in c,
+// based on the extensions.refStorage config.
+func (c *Client) Refs() RefBackend {
+	if c.refs != nil && c.refsGitDir == c.GitDir {
+		return c.refs
+	}
+	format := c.GetConfig("extensions.refStorage")
+	if format == "" {
+		format = c.GetConfig("extensions.refstorage")
+	}
+	switch format {
+	case "reftable":
+		c.refs = newReftableBackend(c.GitDir)
+	default:
+		c.refs = filesRefBackend(c.GitDir)
+	}
+	c.refsGitDir = c.GitDir
+	return c.refs
+}
+
+// A ReflogEntry represents a single change to a ref in a reflog.
+type ReflogEntry struct {
+	Old, New  Sha1
+	Committer Person
+	Message   string
+}
+
+func (e ReflogEntry) String() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s %s %s", e.Old, e.New, e.Committer)
+	}
+	return fmt.Sprintf("%s %s %s\t%s", e.Old, e.New, e.Committer, e.Message)
+}
+
+// parseReflogEntry parses a line of a reflog file into a ReflogEntry
+func parseReflogEntry(line string) (ReflogEntry, error) {
+	line = strings.TrimSuffix(line, "\n")
+	if len(line) < 83 || line[40] != ' ' || line[81] != ' ' {
+		return ReflogEntry{}, fmt.Errorf("Invalid reflog line: %v", line)
+	}
+	old, err := Sha1FromString(line[:40])
+	if err != nil {
+		return ReflogEntry{}, err
+	}
+	new, err := Sha1FromString(line[41:81])
+	if err != nil {
+		return ReflogEntry{}, err
+	}
+	person, msg := line[82:], ""
+	if tab := strings.IndexByte(person, '\t'); tab >= 0 {
+		person, msg = person[:tab], person[tab+1:]
+	}
+	committer, err := parsePerson(person)
+	if err != nil {
+		return ReflogEntry{}, err
+	}
+	return ReflogEntry{old, new, committer, msg}, nil
+}
+
+// filesRefBackend is the traditional ref storage, where every ref is
+// stored in a file of the same name in the GitDir and reflogs are
+// stored under logs/
+type filesRefBackend GitDir
+
+func (f filesRefBackend) ReadRef(name string) (string, error) {
+	val, err := GitDir(f).ReadFile(File(name))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(val)), nil
+}
+
+func (f filesRefBackend) WriteRef(name, value string, entry *ReflogEntry) error {
+	if entry != nil {
+		if err := f.AppendReflog(name, *entry); err != nil {
+			return err
+		}
+	}
+	file, err := GitDir(f).Create(File(name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if !strings.HasPrefix(name, "refs/") {
+		// Pseudo refs such as HEAD have always been written
+		// without a trailing newline.
+		_, err = fmt.Fprint(file, value)
+		return err
+	}
+	_, err = fmt.Fprintf(file, "%s\n", value)
+	return err
+}
+
+func (f filesRefBackend) DeleteRef(name string) error {
+	if err := GitDir(f).File(File(name)).Remove(); err != nil {
+		return err
+	}
+	if log := GitDir(f).File(File("logs/" + name)); log.Exists() {
+		return log.Remove()
+	}
+	return nil
+}
+
+func (f filesRefBackend) ListRefs(prefix string) ([]string, error) {
+	var refs []string
+	err := filepath.Walk(
+		GitDir(f).File("refs").String(),
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			refname := strings.TrimPrefix(path, GitDir(f).String()+"/")
+			if strings.HasPrefix(refname, prefix) {
+				refs = append(refs, refname)
+			}
+			return nil
+		},
+	)
+	sort.Strings(refs)
+	return refs, err
+}
+
+func (f filesRefBackend) ReflogExists(name string) bool {
+	return GitDir(f).File(File("logs/" + name)).Exists()
+}
+
+func (f filesRefBackend) ReadReflog(name string) ([]ReflogEntry, error) {
+	file, err := GitDir(f).Open(File("logs/" + name))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []ReflogEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+		e, err := parseReflogEntry(scanner.Text())
+		if err != nil {
+			// Older versions of dgit could write messages which
+			// spanned multiple lines, so treat lines which aren't
+			// valid as a continuation of the previous message.
+			if len(entries) == 0 {
+				return nil, err
+			}
+			last := &entries[len(entries)-1]
+			last.Message = strings.TrimSpace(last.Message + " " + strings.TrimSpace(scanner.Text()))
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+func (f filesRefBackend) AppendReflog(name string, entry ReflogEntry) error {
+	file := GitDir(f).File(File("logs/" + name))
+	if !file.Exists() {
+		fi, err := file.Create()
+		if err != nil {
+			return err
+		}
+		fi.Close()
+	}
+	return file.Append(entry.String() + "\n")
+}
+
+func (f filesRefBackend) WriteReflog(name string, entries []ReflogEntry) error {
+	file, err := GitDir(f).Create(File("logs/" + name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	for _, e := range entries {
+		if _, err := fmt.Fprintln(file, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package git
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FormatRef expands the %(fieldname) placeholders in format for ref, as
+// described in git-for-each-ref(1). "%%" expands to a single "%" and
+// "%xx" expands to the byte with the hex value xx.
+func FormatRef(c *Client, ref Ref, format string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i == len(format)-1 {
+			sb.WriteByte(format[i])
+			continue
+		}
+		switch next := format[i+1]; {
+		case next == '%':
+			sb.WriteByte('%')
+			i++
+		case next == '(':
+			end := strings.IndexByte(format[i:], ')')
+			if end < 0 {
+				return "", fmt.Errorf("malformed format string %v", format[i:])
+			}
+			val, err := refField(c, ref, format[i+2:i+end])
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(val)
+			i += end
+		case i+2 < len(format) && isHexByte(format[i+1]) && isHexByte(format[i+2]):
+			b, _ := strconv.ParseUint(format[i+1:i+3], 16, 8)
+			sb.WriteByte(byte(b))
+			i += 2
+		default:
+			sb.WriteByte('%')
+		}
+	}
+	return sb.String(), nil
+}
+
+func isHexByte(b byte) bool {
+	return (b >= '0' && b <= '9') || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F')
+}
+
+// refObject is the parsed content of a commit or tag object that a ref
+// points to, used for expanding format fields.
+type refObject struct {
+	typ     string
+	headers map[string]string
+	message string
+}
+
+func loadRefObject(c *Client, s Sha1) (refObject, error) {
+	obj, err := c.GetObject(s)
+	if err != nil {
+		return refObject{}, err
+	}
+	ro := refObject{typ: obj.GetType(), headers: make(map[string]string)}
+	if ro.typ != "commit" && ro.typ != "tag" {
+		return ro, nil
+	}
+	content := string(obj.GetContent())
+	headers, message := content, ""
+	if idx := strings.Index(content, "\n\n"); idx >= 0 {
+		headers, message = content[:idx], content[idx+2:]
+	}
+	for _, line := range strings.Split(headers, "\n") {
+		if sp := strings.IndexByte(line, ' '); sp > 0 {
+			if _, ok := ro.headers[line[:sp]]; !ok {
+				ro.headers[line[:sp]] = line[sp+1:]
+			}
+		}
+	}
+	// Don't include the signature of signed tags in the message.
+	if idx := strings.Index(message, "-----BEGIN PGP SIGNATURE-----"); idx >= 0 {
+		message = message[:idx]
+	}
+	ro.message = message
+	return ro, nil
+}
+
+// subject returns the first paragraph of the message, joined into a
+// single line.
+func (o refObject) subject() string {
+	para := strings.SplitN(strings.TrimLeft(o.message, "\n"), "\n\n", 2)[0]
+	return strings.Join(strings.Fields(strings.Replace(para, "\n", " ", -1)), " ")
+}
+
+// body returns everything in the message after the subject.
+func (o refObject) body() string {
+	pieces := strings.SplitN(strings.TrimLeft(o.message, "\n"), "\n\n", 2)
+	if len(pieces) < 2 {
+		return ""
+	}
+	return strings.TrimLeft(pieces[1], "\n")
+}
+
+func refField(c *Client, ref Ref, field string) (string, error) {
+	name, modifier := field, ""
+	if idx := strings.IndexByte(field, ':'); idx >= 0 {
+		name, modifier = field[:idx], field[idx+1:]
+	}
+
+	switch name {
+	case "refname":
+		switch modifier {
+		case "":
+			return ref.Name, nil
+		case "short":
+			for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/", "refs/"} {
+				if strings.HasPrefix(ref.Name, prefix) {
+					return strings.TrimPrefix(ref.Name, prefix), nil
+				}
+			}
+			return ref.Name, nil
+		}
+		return "", fmt.Errorf("unrecognized %%(refname) argument: %v", modifier)
+	case "HEAD":
+		if c.GetHeadBranch().String() == ref.Name {
+			return "*", nil
+		}
+		return " ", nil
+	}
+
+	s := ref.Value
+	if strings.HasPrefix(name, "*") {
+		// Fields prefixed with * refer to the object that a tag
+		// points to. They are empty for other refs.
+		name = name[1:]
+		obj, err := loadRefObject(c, s)
+		if err != nil || obj.typ != "tag" {
+			return "", err
+		}
+		s, err = Sha1FromString(obj.headers["object"])
+		if err != nil {
+			return "", err
+		}
+	}
+	switch name {
+	case "objectname":
+		switch modifier {
+		case "":
+			return s.String(), nil
+		case "short":
+			return s.Abbrev(c, 7), nil
+		}
+		if strings.HasPrefix(modifier, "short=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(modifier, "short="))
+			if err != nil {
+				return "", err
+			}
+			return s.Abbrev(c, n), nil
+		}
+		return "", fmt.Errorf("unrecognized %%(objectname) argument: %v", modifier)
+	case "objecttype":
+		return s.Type(c), nil
+	case "objectsize":
+		return strconv.FormatUint(s.UncompressedSize(c), 10), nil
+	}
+
+	obj, err := loadRefObject(c, s)
+	if err != nil {
+		return "", err
+	}
+	switch name {
+	case "type", "object", "tag", "tree", "parent":
+		return obj.headers[name], nil
+	case "subject":
+		return obj.subject(), nil
+	case "body":
+		return obj.body(), nil
+	case "contents":
+		switch modifier {
+		case "":
+			return obj.message, nil
+		case "subject":
+			return obj.subject(), nil
+		case "body":
+			return obj.body(), nil
+		}
+		if strings.HasPrefix(modifier, "lines=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(modifier, "lines="))
+			if err != nil {
+				return "", err
+			}
+			return strings.Join(messageLines(obj.message, n), "\n"), nil
+		}
+		return "", fmt.Errorf("unrecognized %%(contents) argument: %v", modifier)
+	}
+
+	// Everything else is a person (author, committer, tagger or
+	// creator) and an optional suffix.
+	var who, suffix string
+	for _, p := range []string{"author", "committer", "tagger", "creator"} {
+		if strings.HasPrefix(name, p) {
+			who, suffix = p, strings.TrimPrefix(name, p)
+		}
+	}
+	if who == "" {
+		return "", fmt.Errorf("unknown field name: %v", field)
+	}
+	if who == "creator" {
+		who = "committer"
+		if obj.typ == "tag" {
+			who = "tagger"
+		}
+	}
+	line, ok := obj.headers[who]
+	if !ok {
+		return "", nil
+	}
+	person, err := parsePerson(line)
+	if err != nil {
+		return "", err
+	}
+	switch suffix {
+	case "":
+		return line, nil
+	case "name":
+		return person.Name, nil
+	case "email":
+		return "<" + person.Email + ">", nil
+	case "date":
+		if person.Time == nil {
+			return "", nil
+		}
+		return FormatDate(*person.Time, modifier)
+	}
+	return "", fmt.Errorf("unknown field name: %v", field)
+}
+
+// messageLines returns the first n lines of message, not including any
+// trailing blank lines.
+func messageLines(message string, n int) []string {
+	lines := strings.Split(strings.TrimRight(message, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[:n]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -70,9 +70,13 @@ func (r RefSpec) File(c *Client) File {
 // Returns the value of RefSpec in Client's GitDir, or the empty string
 // if it doesn't exist.
 func (r RefSpec) Value(c *Client) (string, error) {
-	f := r.File(c)
-	val, err := f.ReadAll()
-	return strings.TrimSpace(val), err
+	return c.Refs().ReadRef(r.String())
+}
+
+// Returns true if the ref r exists in the Client's GitDir.
+func (r RefSpec) Exists(c *Client) bool {
+	_, err := r.Value(c)
+	return err == nil
 }
 
 func (r RefSpec) Sha1(c *Client) (Sha1, error) {
@@ -152,17 +156,47 @@ func GetBranch(c *Client, branchname string) (Branch, error) {
 
 // Returns true if the branch exists under c's GitDir
 func (b Branch) Exists(c *Client) bool {
-	return c.GitDir.File(File(b)).Exists()
+	return RefSpec(b).Exists(c)
 }
 
-// Implements Commitish interface on Branch.
+// Implements Commitish interface on Branch. Symbolic refs, such as
+// refs/remotes/origin/HEAD, are resolved to the commit of the branch
+// that they point to.
 func (b Branch) CommitID(c *Client) (CommitID, error) {
+	// Like git, give up on symbolic refs which are nested too deeply,
+	// so that a loop doesn't recurse forever.
+	for i := 0; i < 5; i++ {
+		val, err := RefSpec(b).Value(c)
+		if err != nil {
+			return CommitID{}, err
+		}
+		if target, ok := parseSymref(val); ok {
+			b = target
+			continue
+		}
+		sha, err := Sha1FromString(val)
+		return CommitID(sha), err
+	}
+	return CommitID{}, fmt.Errorf("symbolic ref %v is nested too deeply", b)
+}
+
+// symrefTarget returns the branch that b points to if it's a symbolic
+// ref, and false if it isn't one.
+func (b Branch) symrefTarget(c *Client) (Branch, bool) {
 	val, err := RefSpec(b).Value(c)
 	if err != nil {
-		return CommitID{}, err
+		return "", false
 	}
-	sha, err := Sha1FromString(val)
-	return CommitID(sha), err
+	return parseSymref(val)
+}
+
+// parseSymref returns the branch that the value of a symbolic ref points
+// to, and false if val isn't one.
+func parseSymref(val string) (Branch, bool) {
+	if !strings.HasPrefix(val, "ref: ") {
+		return "", false
+	}
+	return Branch(strings.TrimSpace(strings.TrimPrefix(val, "ref: "))), true
 }
 
 // Implements Treeish on Branch.
@@ -185,10 +219,5 @@ func (b Branch) BranchName() string {
 
 // Delete a branch
 func (b Branch) DeleteBranch(c *Client) error {
-	location := c.GitDir.File(File(b))
-	err := location.Remove()
-	if err != nil {
-		return err
-	}
-	return nil
+	return c.Refs().DeleteRef(b.String())
 }
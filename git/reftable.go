@@ -0,0 +1,1086 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/driusan/dgit/zlib"
+)
+
+// This file implements the reftable ref storage format, as described in
+// Documentation/technical/reftable.txt of the reference git.
+//
+// Refs and reflogs are stored in a stack of immutable tables under
+// $GIT_DIR/reftable. The names of the tables, oldest first, are listed in
+// $GIT_DIR/reftable/tables.list. Every write adds a new table to the top of
+// the stack, and tables are periodically compacted together so that the
+// stack stays small.
+
+const (
+	reftableMagic           = "REFT"
+	reftableBlockSize       = 4096
+	reftableRestartInterval = 16
+)
+
+const (
+	reftableBlockRef      = 'r'
+	reftableBlockLog      = 'g'
+	reftableBlockIndex    = 'i'
+	reftableBlockObj      = 'o'
+	reftableValueDeletion = 0
+	reftableValueVal1     = 1
+	reftableValueVal2     = 2
+	reftableValueSymref   = 3
+)
+
+// A reftableRef is a ref record in a reftable.
+type reftableRef struct {
+	name        string
+	updateIndex uint64
+	valueType   byte
+	value       Sha1
+	peeled      Sha1
+	target      string
+}
+
+// A reftableLog is a log record in a reftable.
+type reftableLog struct {
+	name        string
+	updateIndex uint64
+	deleted     bool
+	entry       ReflogEntry
+}
+
+// key returns the key used to sort the log record in a table, which
+// sorts by refname and then by newest entry first.
+func (l reftableLog) key() []byte {
+	key := make([]byte, len(l.name)+9)
+	copy(key, l.name)
+	binary.BigEndian.PutUint64(key[len(l.name)+1:], ^l.updateIndex)
+	return key
+}
+
+// A reftableTable is a single parsed table of the stack.
+type reftableTable struct {
+	minUpdateIndex, maxUpdateIndex uint64
+
+	// Sorted by name
+	refs []reftableRef
+	// Sorted by key
+	logs []reftableLog
+}
+
+// putReftableVarint appends val to buf using the variable length integer
+// encoding of reftables, which is the same as the encoding used for
+// offsets in OFS_DELTA pack objects.
+func putReftableVarint(buf []byte, val uint64) []byte {
+	var tmp [10]byte
+	i := len(tmp) - 1
+	tmp[i] = byte(val & 0x7f)
+	for val >>= 7; val != 0; val >>= 7 {
+		val--
+		i--
+		tmp[i] = 0x80 | byte(val&0x7f)
+	}
+	return append(buf, tmp[i:]...)
+}
+
+// getReftableVarint decodes a varint from the start of buf and returns it
+// along with the number of bytes consumed.
+func getReftableVarint(buf []byte) (uint64, int, error) {
+	if len(buf) == 0 {
+		return 0, 0, fmt.Errorf("Unexpected end of reftable varint")
+	}
+	val := uint64(buf[0] & 0x7f)
+	n := 1
+	for buf[n-1]&0x80 != 0 {
+		if n >= len(buf) {
+			return 0, 0, fmt.Errorf("Unexpected end of reftable varint")
+		}
+		val = ((val + 1) << 7) | uint64(buf[n]&0x7f)
+		n++
+	}
+	return val, n, nil
+}
+
+func putUint24(buf []byte, val uint32) {
+	buf[0] = byte(val >> 16)
+	buf[1] = byte(val >> 8)
+	buf[2] = byte(val)
+}
+
+func getUint24(buf []byte) uint32 {
+	return uint32(buf[0])<<16 | uint32(buf[1])<<8 | uint32(buf[2])
+}
+
+// reftableBlockWriter builds a single block of a reftable.
+type reftableBlockWriter struct {
+	// The contents of the block, including the file header if it's the
+	// first block in the file.
+	buf      []byte
+	restarts []uint32
+	lastKey  []byte
+	nrecords int
+}
+
+func newReftableBlockWriter(typ byte, header []byte) *reftableBlockWriter {
+	buf := append([]byte{}, header...)
+	buf = append(buf, typ, 0, 0, 0)
+	return &reftableBlockWriter{buf: buf}
+}
+
+// add adds a record with the given key and value to the block. It returns
+// false if the record would not fit in a block of size limit.
+func (w *reftableBlockWriter) add(key []byte, valueType byte, value []byte, limit int) bool {
+	restart := w.nrecords%reftableRestartInterval == 0
+	prefix := 0
+	if !restart {
+		for prefix < len(key) && prefix < len(w.lastKey) && key[prefix] == w.lastKey[prefix] {
+			prefix++
+		}
+	}
+	var rec []byte
+	rec = putReftableVarint(rec, uint64(prefix))
+	rec = putReftableVarint(rec, uint64(len(key)-prefix)<<3|uint64(valueType))
+	rec = append(rec, key[prefix:]...)
+	rec = append(rec, value...)
+
+	nrestarts := len(w.restarts)
+	if restart {
+		nrestarts++
+	}
+	if w.nrecords > 0 && len(w.buf)+len(rec)+3*nrestarts+2 > limit {
+		return false
+	}
+	if restart {
+		w.restarts = append(w.restarts, uint32(len(w.buf)))
+	}
+	w.buf = append(w.buf, rec...)
+	w.lastKey = append(w.lastKey[:0], key...)
+	w.nrecords++
+	return true
+}
+
+// finish returns the uncompressed contents of the block, with the restart
+// table and length filled in. headerLen is the size of the file header
+// at the start of the block, if any.
+func (w *reftableBlockWriter) finish(headerLen int) []byte {
+	var tmp [3]byte
+	for _, r := range w.restarts {
+		putUint24(tmp[:], r)
+		w.buf = append(w.buf, tmp[:]...)
+	}
+	w.buf = append(w.buf, byte(len(w.restarts)>>8), byte(len(w.restarts)))
+	putUint24(w.buf[headerLen+1:], uint32(len(w.buf)))
+	return w.buf
+}
+
+func (t *reftableTable) header() []byte {
+	header := make([]byte, 24)
+	copy(header, reftableMagic)
+	header[4] = 1
+	putUint24(header[5:], reftableBlockSize)
+	binary.BigEndian.PutUint64(header[8:], t.minUpdateIndex)
+	binary.BigEndian.PutUint64(header[16:], t.maxUpdateIndex)
+	return header
+}
+
+// encode serializes t in the reftable file format.
+func (t *reftableTable) encode() ([]byte, error) {
+	header := t.header()
+	var out []byte
+	// Returns the file header if the next block is the first one in
+	// the file.
+	blockHeader := func() []byte {
+		if len(out) == 0 {
+			return header
+		}
+		return nil
+	}
+
+	// Ref blocks are padded to the block size.
+	var w *reftableBlockWriter
+	var hlen int
+	flushRefs := func() {
+		block := w.finish(hlen)
+		out = append(out, block...)
+		out = append(out, make([]byte, reftableBlockSize-len(block))...)
+		w = nil
+	}
+	for _, r := range t.refs {
+		var val []byte
+		val = putReftableVarint(val, r.updateIndex-t.minUpdateIndex)
+		switch r.valueType {
+		case reftableValueVal1:
+			val = append(val, r.value[:]...)
+		case reftableValueVal2:
+			val = append(val, r.value[:]...)
+			val = append(val, r.peeled[:]...)
+		case reftableValueSymref:
+			val = putReftableVarint(val, uint64(len(r.target)))
+			val = append(val, r.target...)
+		}
+		for {
+			if w == nil {
+				h := blockHeader()
+				hlen = len(h)
+				w = newReftableBlockWriter(reftableBlockRef, h)
+			}
+			if w.add([]byte(r.name), r.valueType, val, reftableBlockSize) {
+				break
+			}
+			flushRefs()
+		}
+		if len(w.buf) > reftableBlockSize {
+			return nil, fmt.Errorf("Ref %v too large for reftable block", r.name)
+		}
+	}
+	if w != nil {
+		flushRefs()
+	}
+
+	// Log blocks are compressed and not padded.
+	var logPosition uint64
+	flushLogs := func() error {
+		block := w.finish(hlen)
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		if _, err := zw.Write(block[hlen+4:]); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		out = append(out, block[:hlen+4]...)
+		out = append(out, compressed.Bytes()...)
+		w = nil
+		return nil
+	}
+	if len(t.logs) > 0 {
+		logPosition = uint64(len(out))
+	}
+	for _, l := range t.logs {
+		var val []byte
+		var valueType byte = 1
+		if l.deleted {
+			valueType = 0
+		} else {
+			e := l.entry
+			val = append(val, e.Old[:]...)
+			val = append(val, e.New[:]...)
+			val = putReftableVarint(val, uint64(len(e.Committer.Name)))
+			val = append(val, e.Committer.Name...)
+			val = putReftableVarint(val, uint64(len(e.Committer.Email)))
+			val = append(val, e.Committer.Email...)
+			var unix int64
+			var tz int16
+			if e.Committer.Time != nil {
+				unix = e.Committer.Time.Unix()
+				_, off := e.Committer.Time.Zone()
+				tz = int16(off / 60)
+			}
+			val = putReftableVarint(val, uint64(unix))
+			val = append(val, byte(uint16(tz)>>8), byte(tz))
+			msg := e.Message
+			if msg != "" && !strings.HasSuffix(msg, "\n") {
+				msg += "\n"
+			}
+			val = putReftableVarint(val, uint64(len(msg)))
+			val = append(val, msg...)
+		}
+		for {
+			if w == nil {
+				h := blockHeader()
+				hlen = len(h)
+				w = newReftableBlockWriter(reftableBlockLog, h)
+			}
+			if w.add(l.key(), valueType, val, reftableBlockSize) {
+				break
+			}
+			if err := flushLogs(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if w != nil {
+		if err := flushLogs(); err != nil {
+			return nil, err
+		}
+	}
+	if len(out) == 0 {
+		// An empty table is just a header and footer.
+		out = append(out, header...)
+	}
+
+	footer := append([]byte{}, header...)
+	var tmp [8]byte
+	for _, pos := range []uint64{0, 0, 0, logPosition, 0} {
+		binary.BigEndian.PutUint64(tmp[:], pos)
+		footer = append(footer, tmp[:]...)
+	}
+	crc := crc32.ChecksumIEEE(footer)
+	footer = append(footer, byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc))
+	return append(out, footer...), nil
+}
+
+// parseReftable parses the contents of a reftable file.
+func parseReftable(data []byte) (*reftableTable, error) {
+	if len(data) < 24 || string(data[:4]) != reftableMagic {
+		return nil, fmt.Errorf("Invalid reftable header")
+	}
+	var headerLen, footerLen, hashLen int
+	switch data[4] {
+	case 1:
+		headerLen, footerLen = 24, 68
+	case 2:
+		headerLen, footerLen = 28, 72
+		if string(data[24:28]) != "sha1" {
+			return nil, fmt.Errorf("Unsupported reftable hash %q", data[24:28])
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported reftable version %d", data[4])
+	}
+	hashLen = 20
+	if len(data) < headerLen+footerLen {
+		return nil, fmt.Errorf("Reftable too short")
+	}
+	blockSize := int(getUint24(data[5:]))
+	t := &reftableTable{
+		minUpdateIndex: binary.BigEndian.Uint64(data[8:]),
+		maxUpdateIndex: binary.BigEndian.Uint64(data[16:]),
+	}
+
+	footer := data[len(data)-footerLen:]
+	if !bytes.Equal(footer[:headerLen], data[:headerLen]) {
+		return nil, fmt.Errorf("Reftable footer does not match header")
+	}
+	if crc := crc32.ChecksumIEEE(footer[:footerLen-4]); crc != binary.BigEndian.Uint32(footer[footerLen-4:]) {
+		return nil, fmt.Errorf("Invalid reftable footer checksum")
+	}
+
+	end := len(data) - footerLen
+	for off := 0; off < end; {
+		hlen := 0
+		if off == 0 {
+			hlen = headerLen
+		}
+		if off+hlen+4 > end {
+			return nil, fmt.Errorf("Truncated reftable block at %d", off)
+		}
+		typ := data[off+hlen]
+		blockLen := int(getUint24(data[off+hlen+1:]))
+		if blockLen < hlen+4 {
+			return nil, fmt.Errorf("Invalid reftable block length at %d", off)
+		}
+
+		var block []byte
+		next := off + blockLen
+		if typ == reftableBlockLog {
+			r := bytes.NewReader(data[off+hlen+4 : end])
+			zr, err := zlib.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			inflated, err := ioutil.ReadAll(zr)
+			if err != nil {
+				return nil, err
+			}
+			if len(inflated) != blockLen-hlen-4 {
+				return nil, fmt.Errorf("Invalid reftable log block length at %d", off)
+			}
+			block = append(append([]byte{}, data[off:off+hlen+4]...), inflated...)
+			next = end - r.Len()
+		} else {
+			if next > end {
+				return nil, fmt.Errorf("Truncated reftable block at %d", off)
+			}
+			block = data[off:next]
+			// If the block is padded, the next block starts at the
+			// next block boundary.
+			if blockSize > 0 && blockLen < blockSize && off+blockSize <= end && data[next] == 0 {
+				next = off + blockSize
+			}
+		}
+
+		switch typ {
+		case reftableBlockRef, reftableBlockLog:
+			if err := t.parseBlock(typ, block, hlen, hashLen); err != nil {
+				return nil, err
+			}
+		case reftableBlockIndex, reftableBlockObj:
+			// We don't use the indexes, we just read everything.
+		default:
+			return nil, fmt.Errorf("Unknown reftable block type %q at %d", typ, off)
+		}
+		off = next
+	}
+	return t, nil
+}
+
+// parseBlock parses the records in a single uncompressed block and adds
+// them to t.
+func (t *reftableTable) parseBlock(typ byte, block []byte, hlen, hashLen int) error {
+	if len(block) < hlen+6 {
+		return fmt.Errorf("Reftable block too short")
+	}
+	nrestarts := int(binary.BigEndian.Uint16(block[len(block)-2:]))
+	recordsEnd := len(block) - 2 - 3*nrestarts
+	if recordsEnd < hlen+4 {
+		return fmt.Errorf("Invalid reftable restart count")
+	}
+
+	buf := block[hlen+4 : recordsEnd]
+	var lastKey []byte
+	varint := func() (uint64, error) {
+		v, n, err := getReftableVarint(buf)
+		buf = buf[n:]
+		return v, err
+	}
+	bytesN := func(n int) ([]byte, error) {
+		if n > len(buf) {
+			return nil, fmt.Errorf("Truncated reftable record")
+		}
+		v := buf[:n]
+		buf = buf[n:]
+		return v, nil
+	}
+	for len(buf) > 0 {
+		prefix, err := varint()
+		if err != nil {
+			return err
+		}
+		suffixType, err := varint()
+		if err != nil {
+			return err
+		}
+		valueType := byte(suffixType & 0x7)
+		suffix, err := bytesN(int(suffixType >> 3))
+		if err != nil {
+			return err
+		}
+		if int(prefix) > len(lastKey) {
+			return fmt.Errorf("Invalid reftable key prefix")
+		}
+		key := append(append([]byte{}, lastKey[:prefix]...), suffix...)
+		lastKey = key
+
+		switch typ {
+		case reftableBlockRef:
+			r := reftableRef{name: string(key), valueType: valueType}
+			delta, err := varint()
+			if err != nil {
+				return err
+			}
+			r.updateIndex = t.minUpdateIndex + delta
+			switch valueType {
+			case reftableValueDeletion:
+			case reftableValueVal1, reftableValueVal2:
+				v, err := bytesN(hashLen)
+				if err != nil {
+					return err
+				}
+				copy(r.value[:], v)
+				if valueType == reftableValueVal2 {
+					v, err := bytesN(hashLen)
+					if err != nil {
+						return err
+					}
+					copy(r.peeled[:], v)
+				}
+			case reftableValueSymref:
+				n, err := varint()
+				if err != nil {
+					return err
+				}
+				v, err := bytesN(int(n))
+				if err != nil {
+					return err
+				}
+				r.target = string(v)
+			default:
+				return fmt.Errorf("Invalid reftable ref value type %d", valueType)
+			}
+			t.refs = append(t.refs, r)
+		case reftableBlockLog:
+			if len(key) < 9 || key[len(key)-9] != 0 {
+				return fmt.Errorf("Invalid reftable log key")
+			}
+			l := reftableLog{
+				name:        string(key[:len(key)-9]),
+				updateIndex: ^binary.BigEndian.Uint64(key[len(key)-8:]),
+			}
+			switch valueType {
+			case 0:
+				l.deleted = true
+			case 1:
+				old, err := bytesN(hashLen)
+				if err != nil {
+					return err
+				}
+				copy(l.entry.Old[:], old)
+				new, err := bytesN(hashLen)
+				if err != nil {
+					return err
+				}
+				copy(l.entry.New[:], new)
+
+				var strs [2]string
+				for i := range strs {
+					n, err := varint()
+					if err != nil {
+						return err
+					}
+					v, err := bytesN(int(n))
+					if err != nil {
+						return err
+					}
+					strs[i] = string(v)
+				}
+				l.entry.Committer.Name, l.entry.Committer.Email = strs[0], strs[1]
+				unix, err := varint()
+				if err != nil {
+					return err
+				}
+				tzb, err := bytesN(2)
+				if err != nil {
+					return err
+				}
+				tz := int(int16(binary.BigEndian.Uint16(tzb)))
+				tzname := fmt.Sprintf("%+03d%02d", tz/60, abs(tz%60))
+				tm := time.Unix(int64(unix), 0).In(time.FixedZone(tzname, tz*60))
+				l.entry.Committer.Time = &tm
+
+				n, err := varint()
+				if err != nil {
+					return err
+				}
+				msg, err := bytesN(int(n))
+				if err != nil {
+					return err
+				}
+				l.entry.Message = strings.TrimSuffix(string(msg), "\n")
+			default:
+				return fmt.Errorf("Invalid reftable log value type %d", valueType)
+			}
+			t.logs = append(t.logs, l)
+		}
+	}
+	return nil
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+// reftableBackend is a RefBackend which stores refs in a stack of
+// reftables.
+type reftableBackend struct {
+	gitdir GitDir
+
+	// Cache of tables that have already been parsed, by name. Tables
+	// are immutable, so they never need to be invalidated.
+	tables map[string]*reftableTable
+}
+
+func newReftableBackend(gitdir GitDir) *reftableBackend {
+	return &reftableBackend{gitdir: gitdir, tables: make(map[string]*reftableTable)}
+}
+
+// isFileRef returns true for pseudo refs which are always stored as
+// files in the GitDir, even when using reftables.
+func (b *reftableBackend) isFileRef(name string) bool {
+	return name == "FETCH_HEAD" || name == "MERGE_HEAD"
+}
+
+func (b *reftableBackend) dir() File {
+	return b.gitdir.File("reftable")
+}
+
+// tableNames returns the names of the tables in the stack, oldest first.
+func (b *reftableBackend) tableNames() ([]string, error) {
+	f, err := os.Open(b.dir().String() + "/tables.list")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if name := strings.TrimSpace(scanner.Text()); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, scanner.Err()
+}
+
+func (b *reftableBackend) table(name string) (*reftableTable, error) {
+	if t, ok := b.tables[name]; ok {
+		return t, nil
+	}
+	data, err := ioutil.ReadFile(b.dir().String() + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	t, err := parseReftable(data)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", name, err)
+	}
+	b.tables[name] = t
+	return t, nil
+}
+
+// stack returns the tables of the stack, oldest first.
+func (b *reftableBackend) stack() ([]*reftableTable, error) {
+	names, err := b.tableNames()
+	if err != nil {
+		return nil, err
+	}
+	tables := make([]*reftableTable, 0, len(names))
+	for _, name := range names {
+		t, err := b.table(name)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	return tables, nil
+}
+
+// mergeRefs merges the ref records of tables (oldest first) so that newer
+// records take precedence. If keepDeletions is false, deleted refs are
+// removed from the result.
+func mergeReftableRefs(tables []*reftableTable, keepDeletions bool) []reftableRef {
+	seen := make(map[string]struct{})
+	var refs []reftableRef
+	for i := len(tables) - 1; i >= 0; i-- {
+		for _, r := range tables[i].refs {
+			if _, ok := seen[r.name]; ok {
+				continue
+			}
+			seen[r.name] = struct{}{}
+			if r.valueType == reftableValueDeletion && !keepDeletions {
+				continue
+			}
+			refs = append(refs, r)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].name < refs[j].name })
+	return refs
+}
+
+// mergeReftableLogs is the same as mergeReftableRefs, but for log records.
+func mergeReftableLogs(tables []*reftableTable, keepDeletions bool) []reftableLog {
+	type logKey struct {
+		name string
+		idx  uint64
+	}
+	seen := make(map[logKey]struct{})
+	var logs []reftableLog
+	for i := len(tables) - 1; i >= 0; i-- {
+		for _, l := range tables[i].logs {
+			k := logKey{l.name, l.updateIndex}
+			if _, ok := seen[k]; ok {
+				continue
+			}
+			seen[k] = struct{}{}
+			if l.deleted && !keepDeletions {
+				continue
+			}
+			logs = append(logs, l)
+		}
+	}
+	sort.Slice(logs, func(i, j int) bool {
+		return bytes.Compare(logs[i].key(), logs[j].key()) < 0
+	})
+	return logs
+}
+
+func (b *reftableBackend) lookup(name string) (reftableRef, bool, error) {
+	tables, err := b.stack()
+	if err != nil {
+		return reftableRef{}, false, err
+	}
+	for i := len(tables) - 1; i >= 0; i-- {
+		refs := tables[i].refs
+		j := sort.Search(len(refs), func(j int) bool { return refs[j].name >= name })
+		if j < len(refs) && refs[j].name == name {
+			if refs[j].valueType == reftableValueDeletion {
+				return reftableRef{}, false, nil
+			}
+			return refs[j], true, nil
+		}
+	}
+	return reftableRef{}, false, nil
+}
+
+func (b *reftableBackend) ReadRef(name string) (string, error) {
+	if b.isFileRef(name) {
+		return filesRefBackend(b.gitdir).ReadRef(name)
+	}
+	r, ok, err := b.lookup(name)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", &os.PathError{Op: "read", Path: name, Err: os.ErrNotExist}
+	}
+	if r.valueType == reftableValueSymref {
+		return "ref: " + r.target, nil
+	}
+	return r.value.String(), nil
+}
+
+func (b *reftableBackend) WriteRef(name, value string, entry *ReflogEntry) error {
+	if b.isFileRef(name) {
+		return filesRefBackend(b.gitdir).WriteRef(name, value, entry)
+	}
+	r := reftableRef{name: name}
+	if strings.HasPrefix(value, "ref: ") {
+		r.valueType = reftableValueSymref
+		r.target = strings.TrimSpace(strings.TrimPrefix(value, "ref: "))
+	} else {
+		sha, err := Sha1FromString(value)
+		if err != nil {
+			return err
+		}
+		r.valueType = reftableValueVal1
+		r.value = sha
+	}
+	return b.addTable(func(t *reftableTable, _ []*reftableTable) {
+		r.updateIndex = t.minUpdateIndex
+		t.refs = []reftableRef{r}
+		if entry != nil {
+			t.logs = []reftableLog{{name: name, updateIndex: t.minUpdateIndex, entry: *entry}}
+		}
+	})
+}
+
+func (b *reftableBackend) DeleteRef(name string) error {
+	if b.isFileRef(name) {
+		return filesRefBackend(b.gitdir).DeleteRef(name)
+	}
+	if _, ok, err := b.lookup(name); err != nil {
+		return err
+	} else if !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	return b.addTable(func(t *reftableTable, stack []*reftableTable) {
+		t.refs = []reftableRef{{name: name, updateIndex: t.minUpdateIndex}}
+		t.logs = reftableLogDeletions(stack, name)
+	})
+}
+
+// reftableLogDeletions returns deletion records for all existing reflog
+// entries of name.
+func reftableLogDeletions(stack []*reftableTable, name string) []reftableLog {
+	var logs []reftableLog
+	for _, l := range mergeReftableLogs(stack, false) {
+		if l.name == name {
+			logs = append(logs, reftableLog{name: name, updateIndex: l.updateIndex, deleted: true})
+		}
+	}
+	return logs
+}
+
+func (b *reftableBackend) ListRefs(prefix string) ([]string, error) {
+	tables, err := b.stack()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, r := range mergeReftableRefs(tables, false) {
+		if strings.HasPrefix(r.name, "refs/") && strings.HasPrefix(r.name, prefix) {
+			names = append(names, r.name)
+		}
+	}
+	return names, nil
+}
+
+func (b *reftableBackend) ReflogExists(name string) bool {
+	if b.isFileRef(name) {
+		return filesRefBackend(b.gitdir).ReflogExists(name)
+	}
+	entries, err := b.ReadReflog(name)
+	return err == nil && len(entries) > 0
+}
+
+func (b *reftableBackend) ReadReflog(name string) ([]ReflogEntry, error) {
+	if b.isFileRef(name) {
+		return filesRefBackend(b.gitdir).ReadReflog(name)
+	}
+	tables, err := b.stack()
+	if err != nil {
+		return nil, err
+	}
+	var entries []ReflogEntry
+	for _, l := range mergeReftableLogs(tables, false) {
+		if l.name == name {
+			entries = append(entries, l.entry)
+		}
+	}
+	// Logs are sorted newest first in the table, but reflogs are
+	// returned oldest first.
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+func (b *reftableBackend) AppendReflog(name string, entry ReflogEntry) error {
+	if b.isFileRef(name) {
+		return filesRefBackend(b.gitdir).AppendReflog(name, entry)
+	}
+	return b.addTable(func(t *reftableTable, _ []*reftableTable) {
+		t.logs = []reftableLog{{name: name, updateIndex: t.minUpdateIndex, entry: entry}}
+	})
+}
+
+func (b *reftableBackend) WriteReflog(name string, entries []ReflogEntry) error {
+	if b.isFileRef(name) {
+		return filesRefBackend(b.gitdir).WriteReflog(name, entries)
+	}
+	return b.addTable(func(t *reftableTable, stack []*reftableTable) {
+		t.logs = reftableLogDeletions(stack, name)
+		for i, e := range entries {
+			t.logs = append(t.logs, reftableLog{name: name, updateIndex: t.minUpdateIndex + uint64(i), entry: e})
+		}
+		if len(entries) > 1 {
+			t.maxUpdateIndex = t.minUpdateIndex + uint64(len(entries)-1)
+		}
+		sort.Slice(t.logs, func(i, j int) bool {
+			return bytes.Compare(t.logs[i].key(), t.logs[j].key()) < 0
+		})
+	})
+}
+
+// lock locks the stack of tables by creating tables.list.lock. The
+// caller must remove the lock file when done.
+func (b *reftableBackend) lock() (*os.File, error) {
+	if err := os.MkdirAll(b.dir().String(), 0755); err != nil {
+		return nil, err
+	}
+	var f *os.File
+	var err error
+	for i := 0; i < 100; i++ {
+		f, err = os.OpenFile(b.dir().String()+"/tables.list.lock", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			return f, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil, fmt.Errorf("Unable to lock reftable stack: %v", err)
+}
+
+// writeTable writes t to a new file in the reftable directory and
+// returns its name.
+func (b *reftableBackend) writeTable(t *reftableTable) (string, error) {
+	data, err := t.encode()
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("0x%012x-0x%012x-%08x.ref", t.minUpdateIndex, t.maxUpdateIndex, rand.Uint32())
+	tmp := b.dir().String() + "/" + name + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, b.dir().String()+"/"+name); err != nil {
+		return "", err
+	}
+	b.tables[name] = t
+	return name, nil
+}
+
+// commitStack replaces tables.list with names, using the lock file
+// lock, which is closed.
+func (b *reftableBackend) commitStack(lock *os.File, names []string) error {
+	for _, name := range names {
+		if _, err := fmt.Fprintln(lock, name); err != nil {
+			lock.Close()
+			return err
+		}
+	}
+	if err := lock.Close(); err != nil {
+		return err
+	}
+	return os.Rename(lock.Name(), b.dir().String()+"/tables.list")
+}
+
+// addTable adds a new table to the top of the stack. fill is called with
+// the new table, which has its update indexes already set, and the
+// current stack so that it can add records to the table.
+func (b *reftableBackend) addTable(fill func(t *reftableTable, stack []*reftableTable)) error {
+	lock, err := b.lock()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(lock.Name())
+
+	names, err := b.tableNames()
+	if err != nil {
+		lock.Close()
+		return err
+	}
+	stack, err := b.stack()
+	if err != nil {
+		lock.Close()
+		return err
+	}
+	next := uint64(1)
+	if len(stack) > 0 {
+		next = stack[len(stack)-1].maxUpdateIndex + 1
+	}
+	t := &reftableTable{minUpdateIndex: next, maxUpdateIndex: next}
+	fill(t, stack)
+
+	name, err := b.writeTable(t)
+	if err != nil {
+		lock.Close()
+		return err
+	}
+	names = append(names, name)
+	stack = append(stack, t)
+
+	names, obsolete, err := b.autoCompact(names, stack)
+	if err != nil {
+		lock.Close()
+		return err
+	}
+	if err := b.commitStack(lock, names); err != nil {
+		return err
+	}
+	for _, old := range obsolete {
+		os.Remove(b.dir().String() + "/" + old)
+		delete(b.tables, old)
+	}
+	return nil
+}
+
+// autoCompact compacts the top of the stack so that every table is at
+// least twice as large as the sum of the tables above it. It returns
+// the new list of table names, and the names of the tables that are no
+// longer used.
+func (b *reftableBackend) autoCompact(names []string, stack []*reftableTable) ([]string, []string, error) {
+	sizes := make([]int64, len(names))
+	for i, name := range names {
+		fi, err := os.Stat(b.dir().String() + "/" + name)
+		if err != nil {
+			return nil, nil, err
+		}
+		sizes[i] = fi.Size()
+	}
+	start := len(names) - 1
+	total := sizes[start]
+	for i := start - 1; i >= 0; i-- {
+		if sizes[i] >= 2*total {
+			break
+		}
+		total += sizes[i]
+		start = i
+	}
+	if start == len(names)-1 {
+		return names, nil, nil
+	}
+	return b.compact(names, stack, start)
+}
+
+// compact merges the tables from start to the top of the stack into a
+// single table.
+func (b *reftableBackend) compact(names []string, stack []*reftableTable, start int) ([]string, []string, error) {
+	segment := stack[start:]
+	// Deletions only need to be kept if there are older tables that
+	// they might be shadowing.
+	keepDeletions := start > 0
+	t := &reftableTable{
+		minUpdateIndex: segment[0].minUpdateIndex,
+		maxUpdateIndex: segment[len(segment)-1].maxUpdateIndex,
+		refs:           mergeReftableRefs(segment, keepDeletions),
+		logs:           mergeReftableLogs(segment, keepDeletions),
+	}
+	name, err := b.writeTable(t)
+	if err != nil {
+		return nil, nil, err
+	}
+	newNames := append(append([]string{}, names[:start]...), name)
+	return newNames, names[start:], nil
+}
+
+// Compact compacts the entire stack of tables into a single table.
+func (b *reftableBackend) Compact() error {
+	lock, err := b.lock()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(lock.Name())
+	names, err := b.tableNames()
+	if err != nil {
+		lock.Close()
+		return err
+	}
+	stack, err := b.stack()
+	if err != nil {
+		lock.Close()
+		return err
+	}
+	if len(stack) <= 1 {
+		lock.Close()
+		return nil
+	}
+	names, obsolete, err := b.compact(names, stack, 0)
+	if err != nil {
+		lock.Close()
+		return err
+	}
+	if err := b.commitStack(lock, names); err != nil {
+		return err
+	}
+	for _, old := range obsolete {
+		os.Remove(b.dir().String() + "/" + old)
+		delete(b.tables, old)
+	}
+	return nil
+}
+
+// initReftable sets up an empty reftable stack in gitdir, with HEAD
+// pointing to head.
+func initReftable(gitdir GitDir, head string) error {
+	if err := os.MkdirAll(gitdir.File("reftable").String(), 0755); err != nil {
+		return err
+	}
+	b := newReftableBackend(gitdir)
+	if _, err := b.ReadRef("HEAD"); err == nil {
+		// Already initialized.
+		return nil
+	}
+	if err := b.WriteRef("HEAD", "ref: "+head, nil); err != nil {
+		return err
+	}
+	// Older versions of git which don't understand reftables need to
+	// see a HEAD that they'll recognize as invalid, and a refs/heads
+	// which is not a directory.
+	if err := gitdir.WriteFile("HEAD", []byte("ref: refs/heads/.invalid\n"), 0644); err != nil {
+		return err
+	}
+	os.RemoveAll(gitdir.File("refs/heads").String())
+	if err := gitdir.WriteFile("refs/heads", []byte("this repository uses the reftable format\n"), 0644); err != nil {
+		return err
+	}
+	return nil
+}
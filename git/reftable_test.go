@@ -0,0 +1,152 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReftableVarint(t *testing.T) {
+	for _, val := range []uint64{0, 1, 127, 128, 255, 16383, 16384, 1 << 32, 1<<63 + 5} {
+		buf := putReftableVarint(nil, val)
+		got, n, err := getReftableVarint(buf)
+		if err != nil {
+			t.Errorf("%d: %v", val, err)
+			continue
+		}
+		if got != val || n != len(buf) {
+			t.Errorf("Unexpected varint round trip: got %d (%d bytes) want %d (%d bytes)", got, n, val, len(buf))
+		}
+	}
+}
+
+func TestReftableEncode(t *testing.T) {
+	sha, err := Sha1FromString("c9f3c0d8eeae0ad3e9ec00fd3f0b8a02ce6f9ed1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	committer := Person{Name: "John Smith", Email: "test@example.com"}
+	table := &reftableTable{minUpdateIndex: 1, maxUpdateIndex: 3}
+	table.refs = []reftableRef{
+		{name: "HEAD", updateIndex: 1, valueType: reftableValueSymref, target: "refs/heads/master"},
+		{name: "refs/heads/master", updateIndex: 2, valueType: reftableValueVal1, value: sha},
+		{name: "refs/tags/deleted", updateIndex: 3, valueType: reftableValueDeletion},
+	}
+	table.logs = []reftableLog{
+		{name: "refs/heads/master", updateIndex: 3, entry: ReflogEntry{sha, sha, committer, "second"}},
+		{name: "refs/heads/master", updateIndex: 2, entry: ReflogEntry{Sha1{}, sha, committer, "first"}},
+	}
+
+	data, err := table.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data[:4]) != "REFT" {
+		t.Errorf("Missing reftable magic: %q", data[:4])
+	}
+	got, err := parseReftable(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.minUpdateIndex != 1 || got.maxUpdateIndex != 3 {
+		t.Errorf("Unexpected update indexes: got %d-%d", got.minUpdateIndex, got.maxUpdateIndex)
+	}
+	if !reflect.DeepEqual(got.refs, table.refs) {
+		t.Errorf("Unexpected refs: got %v want %v", got.refs, table.refs)
+	}
+	if len(got.logs) != 2 || got.logs[0].entry.Message != "second" || got.logs[1].entry.Message != "first" {
+		t.Errorf("Unexpected logs: got %v", got.logs)
+	}
+}
+
+func TestReftableBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitreftable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := Init(nil, InitOptions{Quiet: true, RefFormat: "reftable"}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs := c.Refs()
+	if _, ok := refs.(*reftableBackend); !ok {
+		t.Fatalf("Unexpected ref backend %T", refs)
+	}
+	if head, err := refs.ReadRef("HEAD"); err != nil || head != "ref: refs/heads/master" {
+		t.Errorf("Unexpected HEAD: got %q (%v)", head, err)
+	}
+
+	shas := []string{
+		"c9f3c0d8eeae0ad3e9ec00fd3f0b8a02ce6f9ed1",
+		"2a7b3ea5b8e1cc7c8a3a7e5a6ee0d63a3a3f4f3e",
+	}
+	committer := Person{Name: "John Smith", Email: "test@example.com"}
+	for i, s := range shas {
+		sha, _ := Sha1FromString(s)
+		entry := &ReflogEntry{New: sha, Committer: committer, Message: "update"}
+		if err := refs.WriteRef("refs/heads/master", s, entry); err != nil {
+			t.Fatal(err)
+		}
+		if err := refs.WriteRef("refs/tags/t"+string('a'+rune(i)), s, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if val, err := refs.ReadRef("refs/heads/master"); err != nil || val != shas[1] {
+		t.Errorf("Unexpected master: got %q (%v)", val, err)
+	}
+	names, err := refs.ListRefs("refs/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "refs/heads/master,refs/tags/ta,refs/tags/tb"; strings.Join(names, ",") != want {
+		t.Errorf("Unexpected refs: got %v want %v", names, want)
+	}
+	log, err := refs.ReadReflog("refs/heads/master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 2 || log[0].New.String() != shas[0] || log[1].New.String() != shas[1] {
+		t.Errorf("Unexpected reflog: %v", log)
+	}
+
+	if err := refs.DeleteRef("refs/tags/ta"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := refs.ReadRef("refs/tags/ta"); !os.IsNotExist(err) {
+		t.Errorf("Expected deleted ref to not exist, got %v", err)
+	}
+	if refs.ReflogExists("refs/tags/ta") {
+		t.Error("Unexpected reflog for deleted ref")
+	}
+	if err := refs.WriteReflog("refs/heads/master", nil); err != nil {
+		t.Fatal(err)
+	}
+	if refs.ReflogExists("refs/heads/master") {
+		t.Error("Unexpected reflog after truncating")
+	}
+
+	// Auto-compaction should keep the stack small.
+	b := refs.(*reftableBackend)
+	tables, err := b.tableNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) > 3 {
+		t.Errorf("Reftable stack not compacted: %v", tables)
+	}
+	if err := b.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if tables, err := b.tableNames(); err != nil || len(tables) != 1 {
+		t.Errorf("Unexpected stack after compaction: %v (%v)", tables, err)
+	}
+	// A fresh backend must be able to read the tables from disk.
+	names, err = newReftableBackend(c.GitDir).ListRefs("refs/tags/")
+	if err != nil || strings.Join(names, ",") != "refs/tags/tb" {
+		t.Errorf("Unexpected refs after compaction: %v (%v)", names, err)
+	}
+}
@@ -286,6 +286,9 @@ func RemoteAdd(c *Client, opts RemoteAddOptions, name, url string) error {
 	if url == "" {
 		return fmt.Errorf("Missing remote URL")
 	}
+	if err := checkRefName("refs/remotes/"+name+"/test", false, false); err != nil {
+		return fmt.Errorf("'%v' is not a valid remote name", name)
+	}
 
 	configname := fmt.Sprintf("remote.%v.url", name)
 	if c.GetConfig(configname) != "" {
@@ -0,0 +1,198 @@
+package git
+
+import (
+	"path"
+	"sort"
+)
+
+// The default minimum similarity, as a percentage, for a deleted and an
+// added file to be considered a rename.
+const defaultRenameThreshold = 50
+
+// The maximum number of sources and destinations to compare when looking
+// for inexact renames, like git's diff.renameLimit.
+const renameLimit = 1000
+
+// renamePair is a path that was removed and a path that was added, which
+// were detected to be the same file.
+type renamePair struct {
+	From, To *IndexEntry
+
+	// The similarity of the two files as a percentage.
+	Score int
+}
+
+// similarityIndex returns a percentage of how similar src and dst are,
+// based on how much of the content of the larger file is made up of lines
+// from the other.
+func similarityIndex(src, dst []byte) int {
+	if len(src) == 0 && len(dst) == 0 {
+		return 100
+	}
+	max := len(src)
+	if len(dst) > max {
+		max = len(dst)
+	}
+	return sharedBytes(src, dst) * 100 / max
+}
+
+// sharedBytes returns the number of bytes of src which were copied to dst.
+func sharedBytes(src, dst []byte) int {
+	copied, _ := countChanges(src, dst)
+	return copied
+}
+
+// The modulus of the span hashes, the same as git's HASHBASE.
+const spanHashBase = 107927
+
+// spanHashes splits content into spans the same way as git's hash_chars,
+// ending each one at a newline or after 64 bytes, and returns the number
+// of bytes in the spans with each hash. In text, the carriage returns of
+// CRLF line endings are ignored.
+func spanHashes(content []byte) map[uint32]int {
+	text := !isBinary(content)
+	spans := make(map[uint32]int)
+	var accum1, accum2 uint32
+	n := 0
+	for i, c := range content {
+		if text && c == '\r' && i+1 < len(content) && content[i+1] == '\n' {
+			continue
+		}
+		old := accum1
+		accum1 = (accum1 << 7) ^ (accum2 >> 25)
+		accum2 = (accum2 << 7) ^ (old >> 25)
+		accum1 += uint32(c)
+		if n++; n < 64 && c != '\n' {
+			continue
+		}
+		spans[(accum1+accum2*0x61)%spanHashBase] += n
+		n, accum1, accum2 = 0, 0, 0
+	}
+	if n > 0 {
+		spans[(accum1+accum2*0x61)%spanHashBase] += n
+	}
+	return spans
+}
+
+// countChanges returns how many bytes of src were copied to dst, and how
+// many bytes of dst were added, like git's diffcore_count_changes.
+func countChanges(src, dst []byte) (copied, added int) {
+	srcSpans := spanHashes(src)
+	for h, dcnt := range spanHashes(dst) {
+		scnt := srcSpans[h]
+		if scnt < dcnt {
+			copied += scnt
+			added += dcnt - scnt
+		} else {
+			copied += dcnt
+		}
+	}
+	return copied, added
+}
+
+// detectRenames pairs up removed and added files which are renames of
+// each other. Files with identical content are paired first (preferring
+// ones with the same basename), then the remaining files are compared by
+// content and paired if they're at least threshold percent similar.
+func detectRenames(c *Client, removed, added []*IndexEntry, threshold int) ([]renamePair, error) {
+	if threshold <= 0 {
+		threshold = defaultRenameThreshold
+	}
+	var pairs []renamePair
+	usedSrc := make(map[IndexPath]bool)
+	usedDst := make(map[IndexPath]bool)
+
+	bySha := make(map[Sha1][]*IndexEntry)
+	for _, src := range removed {
+		if src.Mode.TreeType() == "blob" {
+			bySha[src.Sha1] = append(bySha[src.Sha1], src)
+		}
+	}
+	for _, dst := range added {
+		candidates := bySha[dst.Sha1]
+		var best *IndexEntry
+		for _, src := range candidates {
+			if usedSrc[src.PathName] {
+				continue
+			}
+			if best == nil || path.Base(string(src.PathName)) == path.Base(string(dst.PathName)) {
+				best = src
+			}
+		}
+		if best != nil {
+			pairs = append(pairs, renamePair{best, dst, 100})
+			usedSrc[best.PathName] = true
+			usedDst[dst.PathName] = true
+		}
+	}
+
+	var srcs, dsts []*IndexEntry
+	for _, src := range removed {
+		if !usedSrc[src.PathName] && src.Mode.TreeType() == "blob" {
+			srcs = append(srcs, src)
+		}
+	}
+	for _, dst := range added {
+		if !usedDst[dst.PathName] && dst.Mode.TreeType() == "blob" {
+			dsts = append(dsts, dst)
+		}
+	}
+	if len(srcs) == 0 || len(dsts) == 0 || len(srcs)*len(dsts) > renameLimit*renameLimit {
+		return pairs, nil
+	}
+
+	load := func(e *IndexEntry) ([]byte, error) {
+		obj, err := c.GetObject(e.Sha1)
+		if err != nil {
+			return nil, err
+		}
+		return obj.GetContent(), nil
+	}
+	srcContent := make([][]byte, len(srcs))
+	for i, src := range srcs {
+		content, err := load(src)
+		if err != nil {
+			return nil, err
+		}
+		srcContent[i] = content
+	}
+	var candidates []renamePair
+	for _, dst := range dsts {
+		content, err := load(dst)
+		if err != nil {
+			return nil, err
+		}
+		for i, src := range srcs {
+			// Skip pairs where the size difference alone makes it
+			// impossible to reach the threshold.
+			small, large := len(srcContent[i]), len(content)
+			if small > large {
+				small, large = large, small
+			}
+			if large > 0 && small*100/large < threshold {
+				continue
+			}
+			if score := similarityIndex(srcContent[i], content); score >= threshold {
+				candidates = append(candidates, renamePair{src, dst, score})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		if candidates[i].To.PathName != candidates[j].To.PathName {
+			return candidates[i].To.PathName < candidates[j].To.PathName
+		}
+		return candidates[i].From.PathName < candidates[j].From.PathName
+	})
+	for _, cand := range candidates {
+		if usedSrc[cand.From.PathName] || usedDst[cand.To.PathName] {
+			continue
+		}
+		pairs = append(pairs, cand)
+		usedSrc[cand.From.PathName] = true
+		usedDst[cand.To.PathName] = true
+	}
+	return pairs, nil
+}
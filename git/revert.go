@@ -2,90 +2,70 @@ package git
 
 import (
 	"fmt"
-	"io/ioutil"
 )
 
 type RevertOptions struct {
+	// Invoke an editor to edit the commit message before committing.
 	Edit bool
 
+	// Which parent of a merge commit to revert relative to, 1 indexed.
 	MergeParent int
 
+	// Apply the changes to the index and work tree without committing.
 	NoCommit bool
 	SignOff  bool
 
-	MergeStrategy       string
-	MergeStrategyOption string
+	// Only the default strategy is supported.
+	MergeStrategy string
 
-	Continue, Quit, Abort bool
+	// Options for the merge strategy, the same as
+	// MergeOptions.StrategyOptions.
+	StrategyOptions []string
+
+	// Sequencer subcommands. These continue, skip the current commit
+	// of, forget about or abort a revert that was stopped because of
+	// conflicts.
+	Continue, Skip, Quit, Abort bool
 }
 
-// Reverts the given commits from the HEAD.  Revert doesn't actually create the
-// new commit, it returns the new tree and leaves it up to the caller (who has
-// a better chance of knowing the appropriate commit message..)
+// Reverts the given commits from the HEAD, in order, creating a new
+// commit for each one unless NoCommit is set. If a commit can not be
+// reverted cleanly, Revert stops and returns an error so that the
+// conflicts can be resolved and the revert continued with opts.Continue.
 func Revert(c *Client, opts RevertOptions, commits []Commitish) error {
 	switch {
+	case opts.Continue:
+		return sequencerContinue(c)
+	case opts.Skip:
+		return sequencerSkip(c)
+	case opts.Abort:
+		return sequencerAbort(c)
+	case opts.Quit:
+		return c.removeSequencer()
 	case len(commits) == 0:
 		return fmt.Errorf("Must provide commit to revert")
-	case len(commits) > 1:
-		return fmt.Errorf("Only 1 revert at a time currently supported. Sequencer not implemented")
-	}
-
-	// Ensure that the tree is clean before doing anything.
-	worktree, err := DiffFiles(c, DiffFilesOptions{}, nil)
-	if err != nil {
-		return err
-	}
-	if len(worktree) > 0 {
-		return fmt.Errorf("Untracked changes to files would be modified. Aborting")
 	}
-	head, err := c.GetHeadCommit()
-	if err != nil {
-		return err
+	if opts.MergeStrategy != "" && MergeStrategy(opts.MergeStrategy) != MergeRecursive && MergeStrategy(opts.MergeStrategy) != MergeOrt {
+		return fmt.Errorf("Unsupported merge strategy %v", opts.MergeStrategy)
 	}
 
-	if err := UpdateRef(c, UpdateRefOptions{NoDeref: true}, "REVERT_HEAD", head, ""); err != nil {
-		return err
-	}
-
-	cmt, err := commits[0].CommitID(c)
-	if err != nil {
-		return err
-	}
-	parents, err := cmt.Parents(c)
-	if err != nil {
-		return err
-	}
-	var diff []HashDiff
-	if len(parents) == 0 {
-		// FIXME: This shouldn't be the case, but needs to be handled
-		// as a special case.
-		return fmt.Errorf("Can not revert initial commit.")
-	} else if len(parents) == 1 {
-		diffs, err := DiffTree(c, &DiffTreeOptions{}, parents[0], cmt, nil)
-		if err != nil {
-			return err
-		}
-		diff = diffs
-	} else if opts.MergeParent <= 0 {
-		return fmt.Errorf("Must specify merge parent to revert a merge commit.")
-	} else {
-		// the merge parent is 1 indexed.
-		diffs, err := DiffTree(c, &DiffTreeOptions{}, parents[opts.MergeParent-1], cmt, nil)
+	todo := make([]sequencerStep, 0, len(commits))
+	for _, cmt := range commits {
+		cid, err := cmt.CommitID(c)
 		if err != nil {
 			return err
 		}
-		diff = diffs
+		todo = append(todo, sequencerStep{Action: "revert", Commit: cid})
 	}
-
-	patch, err := ioutil.TempFile("", "gitrevertpatch")
-	if err != nil {
-		return err
-	}
-	if err := GeneratePatch(c, DiffCommonOptions{Patch: true}, diff, patch); err != nil {
-		return err
+	seqOpts := sequencerOptions{
+		Edit:            opts.Edit,
+		NoCommit:        opts.NoCommit,
+		SignOff:         opts.SignOff,
+		Mainline:        opts.MergeParent,
+		StrategyOptions: opts.StrategyOptions,
 	}
-	if err := Apply(c, ApplyOptions{ThreeWay: true, Reverse: true, Index: true}, []File{File(patch.Name())}); err != nil {
+	if err := startSequencer(c, seqOpts, todo); err != nil {
 		return err
 	}
-	return nil
+	return runSequencer(c, seqOpts, todo)
 }
@@ -78,3 +78,117 @@ func TestRevert(t *testing.T) {
 		t.Errorf("Unexpected content of foo.txt after revert. got %v want %v", string(content), "foo\nbar\n")
 	}
 }
+
+func TestRevertMultiple(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo.txt": "a\nb\nc\nd\ne\n"},
+		map[string]string{"foo.txt": "A\nb\nc\nd\ne\n"},
+		map[string]string{"foo.txt": "a\nb\nc\nd\nE\n", "bar.txt": "bar\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	topic, err := RevParseCommitish(c, &RevParseOptions{}, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	topicid, err := topic.CommitID(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Merge(c, MergeOptions{NoEdit: true}, []Commitish{topic}); err != nil {
+		t.Fatal(err)
+	}
+	merge, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parents, err := merge.Parents(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reverting a merge needs a mainline.
+	if err := Revert(c, RevertOptions{}, []Commitish{merge}); err == nil {
+		t.Error("Expected revert of merge without mainline to fail")
+	}
+	if c.sequencerInProgress() {
+		t.Error("Sequencer state left behind after failing to start")
+	}
+	if err := Revert(c, RevertOptions{MergeParent: 1}, []Commitish{merge}); err != nil {
+		t.Fatal(err)
+	}
+	reverted, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Revert \"Merge branch 'topic'\"\n\nThis reverts commit " + merge.String() + ", reversing\nchanges made to " + parents[0].String() + ".\n"
+	if msg, _ := reverted.GetCommitMessage(c); string(msg) != want {
+		t.Errorf("Unexpected message: got %q want %q", msg, want)
+	}
+	if content, _ := ioutil.ReadFile("foo.txt"); string(content) != "A\nb\nc\nd\ne\n" {
+		t.Errorf("Unexpected content after reverting merge: got %q", content)
+	}
+	if File("bar.txt").Exists() {
+		t.Error("File added by merge not removed by revert")
+	}
+
+	// Revert the revert and the topic commit without committing, which
+	// should accumulate the changes in the index.
+	if err := Revert(c, RevertOptions{NoCommit: true}, []Commitish{reverted, topicid}); err != nil {
+		t.Fatal(err)
+	}
+	if cur, _ := c.GetHeadCommit(); cur != reverted {
+		t.Error("Revert with NoCommit updated HEAD")
+	}
+	if content, _ := ioutil.ReadFile("foo.txt"); string(content) != "A\nb\nc\nd\ne\n" {
+		t.Errorf("Unexpected content after accumulated reverts: got %q", content)
+	}
+	if File("bar.txt").Exists() {
+		t.Error("Unexpected bar.txt after accumulated reverts")
+	}
+}
+
+func TestRevertConflict(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo.txt": "foo\n"},
+		map[string]string{"foo.txt": "ours\n"},
+		map[string]string{"bar.txt": "bar\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	// Reverting the base deletes foo.txt, which conflicts with the
+	// change to it on master.
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parents, err := head.Parents(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Revert(c, RevertOptions{}, []Commitish{parents[0]}); err == nil {
+		t.Fatal("Expected conflicting revert to fail")
+	}
+	if rev, _ := c.GitDir.File("REVERT_HEAD").ReadFirstLine(); rev != parents[0].String() {
+		t.Errorf("Unexpected REVERT_HEAD: got %v want %v", rev, parents[0])
+	}
+	if err := ioutil.WriteFile("foo.txt", []byte("resolved\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Add(c, AddOptions{}, []File{"foo.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Revert(c, RevertOptions{Continue: true}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if c.sequencerInProgress() || c.GitDir.File("REVERT_HEAD").Exists() {
+		t.Error("Revert state not removed after continuing")
+	}
+	cur, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg, _ := cur.GetCommitMessage(c); msg != CommitMessage("Revert \"base\"\n\nThis reverts commit "+parents[0].String()+".\n") {
+		t.Errorf("Unexpected message: got %q", msg)
+	}
+}
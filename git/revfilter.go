@@ -0,0 +1,219 @@
+package git
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// A commitFilter selects the commits to list from the ones walked by
+// their author, committer, message, date and number of parents.
+type commitFilter struct {
+	authors, committers, grep []*regexp.Regexp
+	allMatch, invert          bool
+
+	until      time.Time
+	minParents uint
+	maxParents *uint
+}
+
+// newCommitFilter compiles the patterns in opt into a commitFilter. It
+// returns nil if opt doesn't filter the commits.
+func newCommitFilter(opt RevListOptions) (*commitFilter, error) {
+	if len(opt.Authors) == 0 && len(opt.Committers) == 0 && len(opt.Grep) == 0 && opt.Until.IsZero() && opt.MinParents == 0 && opt.MaxParents == nil {
+		return nil, nil
+	}
+	f := &commitFilter{
+		allMatch:   opt.AllMatch,
+		invert:     opt.InvertGrep,
+		until:      opt.Until,
+		minParents: opt.MinParents,
+		maxParents: opt.MaxParents,
+	}
+	compile := func(patterns []string) ([]*regexp.Regexp, error) {
+		var res []*regexp.Regexp
+		for _, p := range patterns {
+			re, err := compileGrepPattern(p, opt.RegexpIgnoreCase, opt.ExtendedRegexp, opt.FixedStrings)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, re)
+		}
+		return res, nil
+	}
+	var err error
+	if f.authors, err = compile(opt.Authors); err != nil {
+		return nil, err
+	}
+	if f.committers, err = compile(opt.Committers); err != nil {
+		return nil, err
+	}
+	if f.grep, err = compile(opt.Grep); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// matches returns whether cmt is selected by the filter. Like git, the
+// authors and committers are matched against the name and email in the
+// header and the patterns for each of them are ORed together, while the
+// message needs to match one of the grep patterns, or all of them with
+// allMatch. Only the message match is inverted by invert.
+func (f *commitFilter) matches(c *Client, cmt CommitID) (bool, error) {
+	if f == nil {
+		return true, nil
+	}
+	if !f.until.IsZero() {
+		date, err := cmt.GetCommitterDate(c)
+		if err != nil {
+			return false, err
+		}
+		if date.After(f.until) {
+			return false, nil
+		}
+	}
+	if f.minParents > 0 || f.maxParents != nil {
+		parents, err := cmt.Parents(c)
+		if err != nil {
+			return false, err
+		}
+		if n := uint(len(parents)); n < f.minParents || (f.maxParents != nil && n > *f.maxParents) {
+			return false, nil
+		}
+	}
+	if len(f.authors) == 0 && len(f.committers) == 0 && len(f.grep) == 0 {
+		return true, nil
+	}
+
+	obj, err := c.GetCommitObject(cmt)
+	if err != nil {
+		return false, err
+	}
+	if !matchesPerson(obj.GetHeader("author"), f.authors) || !matchesPerson(obj.GetHeader("committer"), f.committers) {
+		return false, nil
+	}
+	if len(f.grep) == 0 {
+		return true, nil
+	}
+	msg, err := cmt.GetCommitMessage(c)
+	if err != nil {
+		return false, err
+	}
+	lines := strings.Split(strings.TrimSuffix(string(msg), "\n"), "\n")
+	matched := f.allMatch
+	for _, re := range f.grep {
+		found := false
+		for _, l := range lines {
+			if re.MatchString(l) {
+				found = true
+				break
+			}
+		}
+		if f.allMatch && !found {
+			matched = false
+			break
+		} else if !f.allMatch && found {
+			matched = true
+			break
+		}
+	}
+	return matched != f.invert, nil
+}
+
+// matchesPerson returns whether the name and email in the author or
+// committer header hdr match one of patterns, or if there aren't any.
+func matchesPerson(hdr string, patterns []*regexp.Regexp) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	// Strip the timestamp and time zone after the email.
+	if i := strings.LastIndexByte(hdr, '>'); i >= 0 {
+		hdr = hdr[:i+1]
+	}
+	for _, re := range patterns {
+		if re.MatchString(hdr) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileGrepPattern compiles pattern the way git grep and git log
+// --grep interpret it, which is as a basic regular expression unless
+// extended or fixed is set.
+func compileGrepPattern(pattern string, ignoreCase, extended, fixed bool) (*regexp.Regexp, error) {
+	switch {
+	case fixed:
+		pattern = regexp.QuoteMeta(pattern)
+	case !extended:
+		pattern = breToERE(pattern)
+	}
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// breToERE converts a POSIX basic regular expression to the equivalent
+// extended one understood by the regexp package. In a BRE, the grouping,
+// alternation and repetition operators other than * need to be escaped
+// with a \, and are literal characters otherwise, which is the other way
+// around from an ERE.
+func breToERE(pattern string) string {
+	var ere strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '\\':
+			if i+1 == len(pattern) {
+				ere.WriteString(`\\`)
+				break
+			}
+			i++
+			if strings.IndexByte("(){}|+?", pattern[i]) >= 0 {
+				ere.WriteByte(pattern[i])
+			} else {
+				ere.WriteByte('\\')
+				ere.WriteByte(pattern[i])
+			}
+		case '(', ')', '{', '}', '|', '+', '?':
+			ere.WriteByte('\\')
+			ere.WriteByte(c)
+		case '*':
+			// A * at the start of the pattern or a group has
+			// nothing to repeat, so it's literal.
+			if s := ere.String(); s == "" || s == "^" || strings.HasSuffix(s, "(") {
+				ere.WriteString(`\*`)
+			} else {
+				ere.WriteByte(c)
+			}
+		case '[':
+			// Bracket expressions are the same in both, and may
+			// contain a ] right after the [ or [^.
+			j := i + 1
+			if j < len(pattern) && pattern[j] == '^' {
+				j++
+			}
+			if j < len(pattern) && pattern[j] == ']' {
+				j++
+			}
+			for j < len(pattern) && pattern[j] != ']' {
+				if pattern[j] == '[' && j+1 < len(pattern) && strings.IndexByte(":.=", pattern[j+1]) >= 0 {
+					if end := strings.Index(pattern[j+2:], string(pattern[j+1])+"]"); end >= 0 {
+						j += end + 4
+						continue
+					}
+				}
+				j++
+			}
+			if j >= len(pattern) {
+				ere.WriteString(`\[`)
+				break
+			}
+			ere.WriteString(strings.Replace(pattern[i:j+1], `\`, `\\`, -1))
+			i = j
+		default:
+			ere.WriteByte(c)
+		}
+	}
+	return ere.String()
+}
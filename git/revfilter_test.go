@@ -0,0 +1,101 @@
+package git
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRevListFilters(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo": "a\n", "other": "x\n"},
+		map[string]string{"other": "z\n"},
+		map[string]string{"foo": "b\n"},
+	)
+	defer os.RemoveAll(dir)
+	base, err := RevParseCommit(c, &RevParseOptions{}, "master^")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ours, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	theirs, err := RevParseCommit(c, &RevParseOptions{}, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Merge(c, MergeOptions{NoEdit: true}, []Commitish{theirs}); err != nil {
+		t.Fatal(err)
+	}
+	merge, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	zero, none := uint(0), []CommitID(nil)
+
+	tests := []struct {
+		label string
+		opts  RevListOptions
+		want  []CommitID
+	}{
+		{"grep", RevListOptions{Grep: []string{"ours"}}, []CommitID{ours}},
+		{"basic regexp", RevListOptions{Grep: []string{`^\(our\|their\)s+$`}}, none},
+		{"basic regexp group", RevListOptions{Grep: []string{`^\(our\|their\)s$`}}, []CommitID{ours, theirs}},
+		{"extended regexp", RevListOptions{Grep: []string{`^(our|their)s+$`}, ExtendedRegexp: true}, []CommitID{ours, theirs}},
+		{"fixed strings", RevListOptions{Grep: []string{`our.`}, FixedStrings: true}, none},
+		{"ignore case", RevListOptions{Grep: []string{"OURS"}, RegexpIgnoreCase: true}, []CommitID{ours}},
+		{"any match", RevListOptions{Grep: []string{"ours", "theirs"}}, []CommitID{ours, theirs}},
+		{"all match", RevListOptions{Grep: []string{"ours", "theirs"}, AllMatch: true}, none},
+		{"invert grep", RevListOptions{Grep: []string{"ours"}, InvertGrep: true}, []CommitID{merge, theirs, base}},
+		{"author", RevListOptions{Authors: []string{"Smith <test@"}}, []CommitID{merge, ours, theirs, base}},
+		{"authors", RevListOptions{Authors: []string{"nobody", "^John"}}, []CommitID{merge, ours, theirs, base}},
+		// The header patterns need to match as well as the message.
+		{"committer and grep", RevListOptions{Committers: []string{"nobody"}, Grep: []string{"ours"}, InvertGrep: true}, none},
+		{"merges", RevListOptions{MinParents: 2}, []CommitID{merge}},
+		{"roots", RevListOptions{MaxParents: &zero}, []CommitID{base}},
+		{"since", RevListOptions{Since: time.Now().Add(time.Hour)}, none},
+		{"until", RevListOptions{Until: time.Unix(1, 0)}, none},
+		{"paths and grep", RevListOptions{Paths: []File{"foo"}, Grep: []string{"base"}}, []CommitID{base}},
+	}
+	for _, tc := range tests {
+		opts := tc.opts
+		opts.Quiet = true
+		revs, err := RevList(c, opts, nil, []Commitish{merge}, nil)
+		if err != nil {
+			t.Errorf("%v: %v", tc.label, err)
+			continue
+		}
+		if len(revs) != len(tc.want) {
+			t.Errorf("%v: got %v want %v", tc.label, revs, tc.want)
+			continue
+		}
+		for i := range revs {
+			if CommitID(revs[i]) != tc.want[i] {
+				t.Errorf("%v: got %v want %v", tc.label, revs, tc.want)
+				break
+			}
+		}
+	}
+}
+
+func TestBreToERE(t *testing.T) {
+	tests := []struct {
+		bre, want string
+	}{
+		{`a+b?`, `a\+b\?`},
+		{`\(a\|b\)\{2\}`, `(a|b){2}`},
+		{`*a*`, `\*a*`},
+		{`^*a`, `^\*a`},
+		{`[]a(]`, `[]a(]`},
+		{`[\]x`, `[\\]x`},
+		{`[[:alpha:]]+`, `[[:alpha:]]\+`},
+		{`a\.b`, `a\.b`},
+		{`a[b`, `a\[b`},
+	}
+	for _, tc := range tests {
+		if got := breToERE(tc.bre); got != tc.want {
+			t.Errorf("%q: got %q want %q", tc.bre, got, tc.want)
+		}
+	}
+}
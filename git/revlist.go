@@ -1,9 +1,11 @@
 package git
 
 import (
+	"container/heap"
 	"fmt"
 	"io"
 	"os"
+	"time"
 )
 
 // List of command line options that may be passed to RevList
@@ -12,16 +14,76 @@ type RevListOptions struct {
 	MaxCount       *uint
 	VerifyObjects  bool
 	All            bool
+
+	// Only list the commits which change one of Paths. Unless
+	// FullHistory is set, the history is simplified by only following
+	// the parent of a merge that the paths came from, if there is one.
+	// SimplifyMerges keeps the merges that are needed to tie the
+	// listed commits together instead.
+	Paths                       []File
+	FullHistory, SimplifyMerges bool
+
+	// Only list the commits which are descendants of one of the
+	// excluded commits.
+	AncestryPath bool
+
+	// Only follow the first parent of merges.
+	FirstParent bool
+
+	// Only list the commits whose author matches one of Authors, whose
+	// committer matches one of Committers, and whose message matches
+	// one of Grep, or all of them with AllMatch. InvertGrep lists the
+	// commits whose message doesn't match instead. The patterns are
+	// basic regular expressions unless ExtendedRegexp or FixedStrings
+	// is set.
+	Authors, Committers, Grep                      []string
+	AllMatch, InvertGrep                           bool
+	RegexpIgnoreCase, ExtendedRegexp, FixedStrings bool
+
+	// Only list the commits committed after Since and before Until
+	// when they're set. The history older than Since isn't walked.
+	Since, Until time.Time
+
+	// Only list the commits with at least MinParents parents, and at
+	// most MaxParents if it's set.
+	MinParents uint
+	MaxParents *uint
+
+	// List the commits in topological order, so that no parent comes
+	// before all of its children, rather than by commit date. With
+	// DateOrder, the commits are otherwise in commit date order rather
+	// than keeping the commits on each line of history together.
+	TopoOrder, DateOrder bool
+
+	// Show each commit in this format after its id, if it's set.
+	// NoCommitHeader leaves out the "commit" line with the id for user
+	// formats.
+	Pretty         *PrettyOptions
+	NoCommitHeader bool
 }
 
 var maxCountError = fmt.Errorf("Maximum number of objects has been reached")
 
 func RevList(c *Client, opt RevListOptions, w io.Writer, includes, excludes []Commitish) ([]Sha1, error) {
 	var vals []Sha1
+	var pretty *PrettyPrinter
+	if opt.Pretty != nil {
+		var err error
+		if pretty, err = NewPrettyPrinter(c, *opt.Pretty, false); err != nil {
+			return nil, err
+		}
+		pretty.revList = true
+	}
 	err := RevListCallback(c, opt, includes, excludes, func(s Sha1) error {
 		vals = append(vals, s)
 		if !opt.Quiet {
-			fmt.Fprintf(w, "%v\n", s)
+			if pretty != nil && s.Type(c) == "commit" {
+				if err := revListPretty(c, opt, pretty, w, CommitID(s)); err != nil {
+					return err
+				}
+			} else {
+				fmt.Fprintf(w, "%v\n", s)
+			}
 		}
 		if opt.VerifyObjects {
 			switch t := s.Type(c); t {
@@ -56,7 +118,59 @@ func RevList(c *Client, opt RevListOptions, w io.Writer, includes, excludes []Co
 	return vals, nil
 }
 
+// revListPretty writes cmt in the format selected by opt.Pretty. Unlike
+// log, every format is shown after a "commit" line with its id, and
+// followed by an empty line, except for oneline.
+func revListPretty(c *Client, opt RevListOptions, pretty *PrettyPrinter, w io.Writer, cmt CommitID) error {
+	msg, err := pretty.Message(cmt)
+	if err != nil {
+		return err
+	}
+	id := cmt.String()
+	if opt.Pretty.AbbrevCommit {
+		id = Sha1(cmt).Abbrev(c, 7)
+	}
+	switch {
+	case pretty.format.name == "oneline":
+		fmt.Fprintf(w, "%v %v\n", id, msg)
+		return nil
+	case !opt.NoCommitHeader || !pretty.format.isUser():
+		fmt.Fprintf(w, "commit %v\n", id)
+	}
+	if msg != "" {
+		fmt.Fprintf(w, "%v\n", msg)
+	}
+	return nil
+}
+
 func RevListCallback(c *Client, opt RevListOptions, includes, excludes []Commitish, callback func(Sha1) error) error {
+	return revList(c, opt, includes, excludes, false, func(s Sha1, _ []CommitID) error {
+		return callback(s)
+	})
+}
+
+// RevListParentsCallback calls callback with the commits selected by opt,
+// like RevListCallback, along with the parents of each of them which are
+// listed. Like git's --parents with --graph, each parent is rewritten to
+// the nearest of its ancestors which is listed if the history is limited
+// to paths. The commits are in topological order, and Objects is ignored.
+func RevListParentsCallback(c *Client, opt RevListOptions, includes, excludes []Commitish, callback func(CommitID, []CommitID) error) error {
+	if !opt.DateOrder {
+		opt.TopoOrder = true
+	}
+	opt.Objects = false
+	return revList(c, opt, includes, excludes, true, func(s Sha1, parents []CommitID) error {
+		return callback(CommitID(s), parents)
+	})
+}
+
+// revList calls callback with the commits selected by opt, and the
+// listed parents of each of them if parents is set.
+func revList(c *Client, opt RevListOptions, includes, excludes []Commitish, parents bool, callback func(Sha1, []CommitID) error) error {
+	filter, err := newCommitFilter(opt)
+	if err != nil {
+		return err
+	}
 	excludeList := make(map[Sha1]struct{})
 	buildExcludeList := func(s Sha1) error {
 		if _, ok := excludeList[s]; ok {
@@ -82,11 +196,23 @@ func RevListCallback(c *Client, opt RevListOptions, includes, excludes []Commiti
 			}
 			cIDs = append(cIDs, cmt)
 		}
-		if err := revListCallback(c, opt, cIDs, excludeList, buildExcludeList); err != nil {
+		// Everything reachable from an excluded commit is excluded,
+		// even with FirstParent or Since.
+		exclOpt := opt
+		exclOpt.FirstParent = false
+		exclOpt.Since = time.Time{}
+		if err := revListCallback(c, exclOpt, cIDs, excludeList, nil, buildExcludeList); err != nil {
 			return err
 		}
 	}
 
+	if opt.All {
+		all, err := allRefCommits(c)
+		if err != nil {
+			return err
+		}
+		includes = append(includes, all...)
+	}
 	cIDs := make([]CommitID, 0, len(includes))
 	for _, i := range includes {
 		cmt, err := i.CommitID(c)
@@ -97,31 +223,85 @@ func RevListCallback(c *Client, opt RevListOptions, includes, excludes []Commiti
 	}
 
 	callbackCount := uint(0)
-	callbackCountWrapper := func(s Sha1) error {
+	callbackCountWrapper := func(s Sha1, parents []CommitID) error {
 		callbackCount++
 		if opt.MaxCount != nil && callbackCount > *opt.MaxCount {
 			return maxCountError
 		}
 
-		return callback(s)
+		return callback(s, parents)
 	}
 
-	err := revListCallback(c, opt, cIDs, excludeList, callbackCountWrapper)
+	if opt.needsLimiting() {
+		err = limitedRevListCallback(c, opt, cIDs, excludes, excludeList, filter, parents, callbackCountWrapper)
+	} else {
+		err = revListCallback(c, opt, cIDs, excludeList, filter, func(s Sha1) error {
+			return callbackCountWrapper(s, nil)
+		})
+	}
 	if err == maxCountError {
 		return nil
 	}
 	return err
 }
 
-func revListCallback(c *Client, opt RevListOptions, commits []CommitID, excludeList map[Sha1]struct{}, callback func(Sha1) error) error {
-	for _, cmt := range commits {
-		if _, ok := excludeList[Sha1(cmt)]; ok {
+// allRefCommits returns the commits that each of the refs and HEAD point
+// to, for All. Refs which don't point to commits are left out.
+func allRefCommits(c *Client) ([]Commitish, error) {
+	refs, err := ShowRef(c, ShowRefOptions{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var commits []Commitish
+	for _, ref := range refs {
+		cmt, err := RevParseCommitish(c, &RevParseOptions{}, ref.Name)
+		if err != nil {
 			continue
 		}
+		commits = append(commits, cmt)
+	}
+	if head, err := c.GetHeadCommit(); err == nil {
+		commits = append(commits, head)
+	}
+	return commits, nil
+}
 
-		if err := callback(Sha1(cmt)); err != nil {
+// revListCallback calls callback with commits and their ancestors which
+// aren't in excludeList and are selected by filter, newest first by commit
+// date like git, and adds them to excludeList.
+func revListCallback(c *Client, opt RevListOptions, commits []CommitID, excludeList map[Sha1]struct{}, filter *commitFilter, callback func(Sha1) error) error {
+	var q commitQueue
+	queued := make(map[CommitID]bool)
+	push := func(cmt CommitID) error {
+		if _, ok := excludeList[Sha1(cmt)]; ok || queued[cmt] {
+			return nil
+		}
+		queued[cmt] = true
+		date, err := cmt.GetCommitterDate(c)
+		if err != nil {
+			return err
+		}
+		heap.Push(&q, datedCommit{cmt, date, len(queued)})
+		return nil
+	}
+	for _, cmt := range commits {
+		if err := push(cmt); err != nil {
 			return err
 		}
+	}
+	for q.Len() > 0 {
+		next := heap.Pop(&q).(datedCommit)
+		cmt := next.ID
+		if !opt.Since.IsZero() && next.Date.Before(opt.Since) {
+			continue
+		}
+		if ok, err := filter.matches(c, cmt); err != nil {
+			return err
+		} else if ok {
+			if err := callback(Sha1(cmt)); err != nil {
+				return err
+			}
+		}
 		excludeList[Sha1(cmt)] = struct{}{}
 
 		if opt.Objects {
@@ -140,9 +320,77 @@ func revListCallback(c *Client, opt RevListOptions, commits []CommitID, excludeL
 		if err != nil {
 			return err
 		}
-		if err := revListCallback(c, opt, parents, excludeList, callback); err != nil {
+		if opt.FirstParent && len(parents) > 1 {
+			parents = parents[:1]
+		}
+		for _, p := range parents {
+			if err := push(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// limitedRevListCallback walks the whole of the history from commits
+// before calling callback with the commits that are selected by opt,
+// newest first unless they're sorted. If parents is set, callback is also
+// passed the listed parents of each commit.
+func limitedRevListCallback(c *Client, opt RevListOptions, commits []CommitID, excludes []Commitish, excludeList map[Sha1]struct{}, filter *commitFilter, parents bool, callback func(Sha1, []CommitID) error) error {
+	bottoms := make([]CommitID, 0, len(excludes))
+	for _, e := range excludes {
+		cmt, err := e.CommitID(c)
+		if err != nil {
+			return err
+		}
+		bottoms = append(bottoms, cmt)
+	}
+	// The walk needs the commits that were excluded, and excludeList
+	// also gets the objects that are listed.
+	excluded := make(map[Sha1]struct{}, len(excludeList))
+	for s := range excludeList {
+		excluded[s] = struct{}{}
+	}
+	w, err := newRevWalk(c, opt, excluded, bottoms)
+	if err != nil {
+		return err
+	}
+	// Like git, the merges which tie the listed history together are
+	// shown when the parents are.
+	w.ancestry = parents
+	if err := w.walk(commits); err != nil {
+		return err
+	}
+	for _, cmt := range w.commits {
+		if !w.shown(cmt) {
+			continue
+		}
+		if ok, err := filter.matches(c, cmt); err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+		var listed []CommitID
+		if parents {
+			if listed, err = w.listedParents(cmt, filter); err != nil {
+				return err
+			}
+		}
+		if err := callback(Sha1(cmt), listed); err != nil {
 			return err
 		}
+		if opt.Objects {
+			objs, err := cmt.GetAllObjectsExcept(c, excludeList)
+			if err != nil {
+				return err
+			}
+			for _, o := range objs {
+				excludeList[o] = struct{}{}
+				if err := callback(o, nil); err != nil {
+					return err
+				}
+			}
+		}
 	}
 	return nil
 }
@@ -265,12 +265,12 @@ func RevParseCommitish(c *Client, opt *RevParseOptions, arg string) (cmt Commiti
 		}
 	}
 	if strings.HasPrefix(cmtbase, "refs/") {
-		if rs := c.GitDir.File(File(cmtbase)); rs.Exists() {
-			return RefSpec(cmtbase), nil
+		if rs := RefSpec(cmtbase); rs.Exists(c) {
+			return rs, nil
 		}
 	}
-	if rs := c.GitDir.File("refs/tags/" + File(cmtbase)); rs.Exists() {
-		return RefSpec("refs/tags/" + cmtbase), nil
+	if rs := RefSpec("refs/tags/" + cmtbase); rs.Exists(c) {
+		return rs, nil
 	}
 
 	// arg was not a Sha or a symbolic ref, it might still be a branch.
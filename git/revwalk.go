@@ -0,0 +1,686 @@
+package git
+
+import (
+	"container/heap"
+	"fmt"
+	"time"
+)
+
+// needsLimiting returns whether the commits selected by opt can only be
+// known after walking all of the history, rather than one at a time.
+func (opt RevListOptions) needsLimiting() bool {
+	return len(opt.Paths) > 0 || opt.AncestryPath || opt.SimplifyMerges || opt.TopoOrder || opt.DateOrder
+}
+
+// A revWalk lists the commits selected by RevListOptions which need the
+// whole of the history to be walked before any of it can be shown. It's
+// a port of git's limit_list and the history simplification in
+// revision.c.
+type revWalk struct {
+	c   *Client
+	opt RevListOptions
+
+	// Commits are pruned to those which change the files in spec if
+	// there are any paths.
+	prune bool
+	spec  pathspec
+
+	// excluded is every commit reachable from bottoms, the excluded
+	// commits given to the walk. outside are the commits which were
+	// walked but aren't on the ancestry path.
+	excluded map[Sha1]struct{}
+	bottoms  []CommitID
+	outside  map[CommitID]bool
+
+	// The commits walked, newest first, with their parents after
+	// simplification and whether they're TREESAME to each of them.
+	// same is set for the commits which are TREESAME, which don't
+	// change the paths.
+	commits  []CommitID
+	parents  map[CommitID][]CommitID
+	treesame map[CommitID][]bool
+	same     map[CommitID]bool
+
+	// What each commit simplifies to with SimplifyMerges.
+	simplified map[CommitID]CommitID
+
+	// The commit dates, for sorting them with DateOrder.
+	dates map[CommitID]time.Time
+
+	// ancestry keeps the merges which tie the listed commits together
+	// when the parents of the commits are listed.
+	ancestry bool
+}
+
+func newRevWalk(c *Client, opt RevListOptions, excluded map[Sha1]struct{}, bottoms []CommitID) (*revWalk, error) {
+	spec, err := newPathspec(c, opt.Paths)
+	if err != nil {
+		return nil, err
+	}
+	if opt.AncestryPath && len(bottoms) == 0 {
+		return nil, fmt.Errorf("--ancestry-path given but there are no bottom commits")
+	}
+	return &revWalk{
+		c:          c,
+		opt:        opt,
+		prune:      len(opt.Paths) > 0,
+		spec:       spec,
+		excluded:   excluded,
+		bottoms:    bottoms,
+		outside:    make(map[CommitID]bool),
+		parents:    make(map[CommitID][]CommitID),
+		treesame:   make(map[CommitID][]bool),
+		same:       make(map[CommitID]bool),
+		simplified: make(map[CommitID]CommitID),
+		dates:      make(map[CommitID]time.Time),
+	}, nil
+}
+
+// relevant returns whether cmt is one of the commits being listed, which
+// are the only ones that history is simplified towards.
+func (w *revWalk) relevant(cmt CommitID) bool {
+	if _, ok := w.excluded[Sha1(cmt)]; ok {
+		return false
+	}
+	return !w.outside[cmt]
+}
+
+// datedCommit is a commit in a commitQueue. seq is the order it was
+// added in, so that commits with the same date come out in that order.
+type datedCommit struct {
+	ID   CommitID
+	Date time.Time
+	seq  int
+}
+
+// commitQueue is a priority queue of commits, newest first.
+type commitQueue []datedCommit
+
+func (q commitQueue) Len() int { return len(q) }
+func (q commitQueue) Less(i, j int) bool {
+	if q[i].Date.Equal(q[j].Date) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].Date.After(q[j].Date)
+}
+func (q commitQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *commitQueue) Push(x interface{}) { *q = append(*q, x.(datedCommit)) }
+func (q *commitQueue) Pop() interface{} {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
+}
+
+// walk walks the history from tips in commit date order, simplifying
+// each commit as it goes, and then limits it to the ancestry path and
+// simplifies merges if requested.
+func (w *revWalk) walk(tips []CommitID) error {
+	var q commitQueue
+	seen := make(map[CommitID]bool)
+	push := func(cmt CommitID) error {
+		if _, ok := w.excluded[Sha1(cmt)]; ok || seen[cmt] {
+			return nil
+		}
+		seen[cmt] = true
+		date, err := cmt.GetCommitterDate(w.c)
+		if err != nil {
+			return err
+		}
+		heap.Push(&q, datedCommit{cmt, date, len(seen)})
+		return nil
+	}
+	for _, tip := range tips {
+		if err := push(tip); err != nil {
+			return err
+		}
+	}
+	for q.Len() > 0 {
+		next := heap.Pop(&q).(datedCommit)
+		cmt := next.ID
+		if !w.opt.Since.IsZero() && next.Date.Before(w.opt.Since) {
+			// Like git, the history older than Since is treated
+			// as if it had been excluded.
+			w.excluded[Sha1(cmt)] = struct{}{}
+			continue
+		}
+		w.commits = append(w.commits, cmt)
+		w.dates[cmt] = next.Date
+		if err := w.simplifyCommit(cmt); err != nil {
+			return err
+		}
+		for _, p := range w.parents[cmt] {
+			if err := push(p); err != nil {
+				return err
+			}
+		}
+	}
+
+	if w.opt.AncestryPath {
+		w.limitToAncestry()
+	}
+	// Like git, simplifying the merges also shows the commits in
+	// topological order. They're sorted by their original parents, and
+	// the simplified ones are only what's shown as their parents.
+	if w.opt.TopoOrder || w.opt.DateOrder || w.opt.SimplifyMerges {
+		w.commits = w.topoSort(w.commits)
+	}
+	if w.opt.SimplifyMerges {
+		if err := w.simplifyMerges(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// simplifyCommit works out whether cmt is TREESAME to each of its
+// parents. Unless the full history was requested, a commit that's
+// TREESAME to one of its parents is assumed to have come from it, and
+// the other parents aren't walked.
+func (w *revWalk) simplifyCommit(cmt CommitID) error {
+	parents, err := cmt.Parents(w.c)
+	if err != nil {
+		return err
+	}
+	if w.opt.FirstParent && len(parents) > 1 {
+		parents = parents[:1]
+	}
+	w.parents[cmt] = parents
+	if !w.prune {
+		return nil
+	}
+	tree, err := cmt.TreeID(w.c)
+	if err != nil {
+		return err
+	}
+	if len(parents) == 0 {
+		same, err := w.treeSame(TreeID{}, tree, "")
+		w.same[cmt] = same
+		return err
+	}
+
+	simplify := !w.opt.FullHistory && !w.opt.SimplifyMerges && !w.opt.AncestryPath
+	treesame := make([]bool, len(parents))
+	for i, p := range parents {
+		ptree, err := p.TreeID(w.c)
+		if err != nil {
+			return err
+		}
+		same, err := w.treeSame(ptree, tree, "")
+		if err != nil {
+			return err
+		}
+		if same && simplify && w.relevant(p) {
+			w.parents[cmt] = []CommitID{p}
+			w.treesame[cmt] = []bool{true}
+			w.same[cmt] = true
+			return nil
+		}
+		treesame[i] = same
+	}
+	w.treesame[cmt] = treesame
+	w.updateTreesame(cmt)
+	return nil
+}
+
+// updateTreesame sets whether cmt is TREESAME from whether it's TREESAME
+// to each of its parents. A merge is TREESAME if it's TREESAME to all of
+// its relevant parents, so that merges from outside of the history being
+// listed don't make it interesting.
+func (w *revWalk) updateTreesame(cmt CommitID) {
+	relevant := 0
+	relevantChange, irrelevantChange := false, false
+	for i, p := range w.parents[cmt] {
+		if w.relevant(p) {
+			relevant++
+			relevantChange = relevantChange || !w.treesame[cmt][i]
+		} else {
+			irrelevantChange = irrelevantChange || !w.treesame[cmt][i]
+		}
+	}
+	if relevant > 0 {
+		w.same[cmt] = !relevantChange
+	} else {
+		w.same[cmt] = !irrelevantChange
+	}
+}
+
+// treeSame returns whether the files matched by the pathspec are the same
+// in the trees a and b, which are in the directory prefix. The zero TreeID
+// is an empty tree.
+func (w *revWalk) treeSame(a, b TreeID, prefix IndexPath) (bool, error) {
+	if a == b {
+		return true, nil
+	}
+	entries := func(t TreeID) (map[IndexPath]TreeEntry, error) {
+		if t == (TreeID{}) {
+			return nil, nil
+		}
+		return t.GetAllObjects(w.c, "", false, false)
+	}
+	aEntries, err := entries(a)
+	if err != nil {
+		return false, err
+	}
+	bEntries, err := entries(b)
+	if err != nil {
+		return false, err
+	}
+	// Compares a single entry which is different in the trees.
+	changed := func(name IndexPath, ea, eb TreeEntry) (bool, error) {
+		if prefix != "" {
+			name = prefix + "/" + name
+		}
+		if ea.FileMode == ModeTree && eb.FileMode == ModeTree {
+			if !w.spec.Matches(name, true) {
+				return false, nil
+			}
+			same, err := w.treeSame(TreeID(ea.Sha1), TreeID(eb.Sha1), name)
+			return !same, err
+		}
+		for _, e := range []TreeEntry{ea, eb} {
+			switch {
+			case e.Sha1 == (Sha1{}):
+			case e.FileMode == ModeTree:
+				if !w.spec.Matches(name, true) {
+					continue
+				}
+				if same, err := w.treeSame(TreeID(e.Sha1), TreeID{}, name); err != nil || !same {
+					return true, err
+				}
+			case w.spec.Matches(name, false):
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	for name, ea := range aEntries {
+		if eb := bEntries[name]; ea != eb {
+			if c, err := changed(name, ea, eb); err != nil || c {
+				return false, err
+			}
+		}
+	}
+	for name, eb := range bEntries {
+		if _, ok := aEntries[name]; !ok {
+			if c, err := changed(name, TreeEntry{}, eb); err != nil || c {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// limitToAncestry leaves out the commits which aren't descendants of one
+// of the bottoms.
+func (w *revWalk) limitToAncestry() {
+	marked := make(map[CommitID]bool)
+	for _, b := range w.bottoms {
+		marked[b] = true
+	}
+	// The commits are walked oldest first, so that parents are
+	// usually marked before their children.
+	for progress := true; progress; {
+		progress = false
+		for i := len(w.commits) - 1; i >= 0; i-- {
+			cmt := w.commits[i]
+			if marked[cmt] {
+				continue
+			}
+			for _, p := range w.parents[cmt] {
+				if marked[p] {
+					marked[cmt] = true
+					progress = true
+					break
+				}
+			}
+		}
+	}
+	for _, cmt := range w.commits {
+		if !marked[cmt] {
+			w.outside[cmt] = true
+		}
+	}
+
+	// Merges can become TREESAME by their other parents no longer being
+	// relevant, unless they were already simplified to one parent.
+	if !w.prune || w.opt.FirstParent {
+		return
+	}
+	for _, cmt := range w.commits {
+		if !w.outside[cmt] && !w.same[cmt] && len(w.parents[cmt]) > 1 {
+			w.updateTreesame(cmt)
+		}
+	}
+}
+
+// topoSort sorts commits so that no parent comes before its children,
+// keeping the commits on each line of history together, or in commit date
+// order otherwise with DateOrder. It's git's sort_in_topological_order.
+func (w *revWalk) topoSort(commits []CommitID) []CommitID {
+	children := make(map[CommitID]int, len(commits))
+	for _, cmt := range commits {
+		children[cmt] = 0
+	}
+	for _, cmt := range commits {
+		for _, p := range w.parents[cmt] {
+			if n, ok := children[p]; ok {
+				children[p] = n + 1
+			}
+		}
+	}
+	// The commits which are ready to be shown come out newest first
+	// with DateOrder, and otherwise the parents of each commit are
+	// visited before going on to the next tip.
+	var stack []CommitID
+	var q commitQueue
+	seq := 0
+	put := func(cmt CommitID) {
+		if w.opt.DateOrder {
+			seq++
+			heap.Push(&q, datedCommit{cmt, w.dates[cmt], seq})
+		} else {
+			stack = append(stack, cmt)
+		}
+	}
+	get := func() (CommitID, bool) {
+		if w.opt.DateOrder {
+			if q.Len() == 0 {
+				return CommitID{}, false
+			}
+			return heap.Pop(&q).(datedCommit).ID, true
+		}
+		if len(stack) == 0 {
+			return CommitID{}, false
+		}
+		cmt := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return cmt, true
+	}
+	// The tips are taken in their original order.
+	if w.opt.DateOrder {
+		for _, cmt := range commits {
+			if children[cmt] == 0 {
+				put(cmt)
+			}
+		}
+	} else {
+		for i := len(commits) - 1; i >= 0; i-- {
+			if children[commits[i]] == 0 {
+				put(commits[i])
+			}
+		}
+	}
+	sorted := make([]CommitID, 0, len(commits))
+	for cmt, ok := get(); ok; cmt, ok = get() {
+		sorted = append(sorted, cmt)
+		for _, p := range w.parents[cmt] {
+			n, ok := children[p]
+			if !ok {
+				continue
+			}
+			if children[p] = n - 1; n == 1 {
+				put(p)
+			}
+		}
+	}
+	return sorted
+}
+
+// simplifiedTo returns what cmt simplifies to with SimplifyMerges, and
+// whether it's known yet. Commits which aren't relevant simplify to
+// themselves.
+func (w *revWalk) simplifiedTo(cmt CommitID) (CommitID, bool) {
+	if !w.relevant(cmt) {
+		return cmt, true
+	}
+	s, ok := w.simplified[cmt]
+	return s, ok
+}
+
+// simplifyMerges rewrites the parents of each commit to what they
+// simplify to, removing the parents of merges which are redundant, and
+// leaves out the commits which simplify to one of their parents.
+func (w *revWalk) simplifyMerges() error {
+	// Parents need to be simplified before their children, so start
+	// with the oldest commits.
+	todo := make([]CommitID, 0, len(w.commits))
+	for i := len(w.commits) - 1; i >= 0; i-- {
+		todo = append(todo, w.commits[i])
+	}
+	for len(todo) > 0 {
+		var next []CommitID
+		for _, cmt := range todo {
+			pending, err := w.simplifyOne(cmt)
+			if err != nil {
+				return err
+			}
+			next = append(next, pending...)
+		}
+		todo = next
+	}
+	return nil
+}
+
+// simplifyOne simplifies cmt if all of its parents have been, and
+// otherwise returns the commits to try again, parents first.
+func (w *revWalk) simplifyOne(cmt CommitID) ([]CommitID, error) {
+	if _, ok := w.simplifiedTo(cmt); ok {
+		return nil, nil
+	}
+	parents := w.parents[cmt]
+	if len(parents) == 0 {
+		w.simplified[cmt] = cmt
+		return nil, nil
+	}
+	var pending []CommitID
+	for _, p := range parents {
+		if _, ok := w.simplifiedTo(p); !ok {
+			pending = append(pending, p)
+		}
+	}
+	if len(pending) > 0 {
+		return append(pending, cmt), nil
+	}
+
+	// A commit is always TREESAME to what its parents simplify to, so
+	// rewriting them doesn't change treesame.
+	rewritten := make([]CommitID, 0, len(parents))
+	var treesame []bool
+	if len(w.treesame[cmt]) > 0 {
+		treesame = make([]bool, 0, len(parents))
+	}
+	seen := make(map[CommitID]bool)
+	for i, p := range parents {
+		s, _ := w.simplifiedTo(p)
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		rewritten = append(rewritten, s)
+		if treesame != nil {
+			treesame = append(treesame, w.treesame[cmt][i])
+		}
+	}
+	w.setParents(cmt, rewritten, treesame)
+
+	// A parent which is an ancestor of another parent, or a root that
+	// doesn't have any of the paths, only leads back into the history
+	// of the others, unless it's the parent that cmt took the paths
+	// from.
+	if len(rewritten) > 1 {
+		remove := make([]bool, len(rewritten))
+		marked := 0
+		for i, p := range rewritten {
+			for j, other := range rewritten {
+				if i != j && p.IsAncestor(w.c, other) {
+					remove[i] = true
+					break
+				}
+			}
+			if !remove[i] && w.prune && w.same[p] {
+				if pp, err := p.Parents(w.c); err != nil {
+					return nil, err
+				} else if len(pp) == 0 {
+					remove[i] = true
+				}
+			}
+			if remove[i] {
+				marked++
+			}
+		}
+		if marked > 0 && treesame != nil {
+			first := -1
+			for i := range rewritten {
+				if treesame[i] {
+					if !remove[i] {
+						first = -1
+						break
+					}
+					if first < 0 {
+						first = i
+					}
+				}
+			}
+			if first >= 0 {
+				remove[first] = false
+				marked--
+			}
+		}
+		if marked > 0 {
+			var kept []CommitID
+			var keptSame []bool
+			for i, p := range rewritten {
+				if !remove[i] {
+					kept = append(kept, p)
+					if treesame != nil {
+						keptSame = append(keptSame, treesame[i])
+					}
+				}
+			}
+			wasSame := w.same[cmt]
+			w.setParents(cmt, kept, keptSame)
+			if len(kept) > 1 && !wasSame {
+				w.updateTreesame(cmt)
+			}
+			rewritten = kept
+		}
+	}
+
+	// A commit simplifies to itself if it changes the paths or is a
+	// merge of more than one relevant commit, and otherwise to what
+	// its parent simplifies to.
+	var parent *CommitID
+	if len(rewritten) == 1 {
+		parent = &rewritten[0]
+	} else {
+		for i, p := range rewritten {
+			if !w.relevant(p) {
+				continue
+			}
+			if parent != nil {
+				parent = nil
+				break
+			}
+			parent = &rewritten[i]
+		}
+	}
+	if !w.prune || !w.same[cmt] || parent == nil {
+		w.simplified[cmt] = cmt
+	} else {
+		s, _ := w.simplifiedTo(*parent)
+		w.simplified[cmt] = s
+	}
+	return nil, nil
+}
+
+// setParents replaces the parents of cmt after they were simplified. If
+// it's no longer a merge, it's TREESAME if it's TREESAME to the parent.
+func (w *revWalk) setParents(cmt CommitID, parents []CommitID, treesame []bool) {
+	w.parents[cmt] = parents
+	w.treesame[cmt] = treesame
+	if len(parents) == 1 && treesame != nil {
+		w.same[cmt] = treesame[0]
+	}
+}
+
+// shown returns whether cmt should be listed after the history was
+// walked and simplified.
+func (w *revWalk) shown(cmt CommitID) bool {
+	if w.outside[cmt] {
+		return false
+	}
+	if w.opt.SimplifyMerges && w.simplified[cmt] != cmt {
+		return false
+	}
+	if !w.prune || !w.same[cmt] {
+		return true
+	}
+	// Merges of more than one relevant commit are kept when merges
+	// are simplified or the parents are listed, since they tie the
+	// history together.
+	if !w.opt.SimplifyMerges && !w.ancestry {
+		return false
+	}
+	relevant := 0
+	for _, p := range w.parents[cmt] {
+		if w.relevant(p) {
+			relevant++
+		}
+	}
+	return relevant >= 2
+}
+
+// listedParents returns the parents of cmt which are listed. Like git's
+// rewrite_parents, each parent which doesn't change the paths is rewritten
+// to the nearest of its ancestors which does, so that the listed history
+// stays connected.
+func (w *revWalk) listedParents(cmt CommitID, filter *commitFilter) ([]CommitID, error) {
+	var parents []CommitID
+	seen := make(map[CommitID]bool)
+	for _, p := range w.parents[cmt] {
+		p, ok := w.rewriteParent(p)
+		if !ok || seen[p] {
+			continue
+		}
+		seen[p] = true
+		if !w.relevant(p) || !w.shown(p) {
+			continue
+		}
+		if ok, err := filter.matches(w.c, p); err != nil {
+			return nil, err
+		} else if ok {
+			parents = append(parents, p)
+		}
+	}
+	return parents, nil
+}
+
+// rewriteParent follows p back through the commits which don't change the
+// paths, to the first one that does. It returns false if that ends at a
+// root commit that doesn't change them either.
+func (w *revWalk) rewriteParent(p CommitID) (CommitID, bool) {
+	for w.prune && w.relevant(p) && w.same[p] {
+		parents := w.parents[p]
+		if len(parents) == 0 {
+			return p, false
+		}
+		// Like git, it can only be followed through a merge if only
+		// one of its parents is relevant.
+		next := parents[0]
+		if len(parents) > 1 {
+			relevant := 0
+			for _, pp := range parents {
+				if w.relevant(pp) {
+					next = pp
+					relevant++
+				}
+			}
+			if relevant != 1 {
+				return p, true
+			}
+		}
+		p = next
+	}
+	return p, true
+}
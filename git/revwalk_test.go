@@ -0,0 +1,211 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestRevListPaths(t *testing.T) {
+	// foo is changed on topic and other on master, so the merge takes
+	// foo from topic and other from master.
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo": "a\n", "other": "x\n"},
+		map[string]string{"other": "z\n"},
+		map[string]string{"foo": "b\n"},
+	)
+	defer os.RemoveAll(dir)
+	base, err := RevParseCommit(c, &RevParseOptions{}, "master^")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ours, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	theirs, err := RevParseCommit(c, &RevParseOptions{}, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Merge(c, MergeOptions{NoEdit: true}, []Commitish{theirs}); err != nil {
+		t.Fatal(err)
+	}
+	merge, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		label    string
+		opts     RevListOptions
+		excludes []Commitish
+		want     []CommitID
+	}{
+		{"no paths", RevListOptions{}, nil, []CommitID{merge, ours, theirs, base}},
+		// The merge came from topic as far as foo is concerned, so
+		// master isn't walked.
+		{"foo", RevListOptions{Paths: []File{"foo"}}, nil, []CommitID{theirs, base}},
+		{"other", RevListOptions{Paths: []File{"other"}}, nil, []CommitID{ours, base}},
+		{"full history", RevListOptions{Paths: []File{"foo"}, FullHistory: true}, nil, []CommitID{merge, theirs, base}},
+		// The merge only brought in topic's foo, so it simplifies to
+		// topic.
+		{"simplify merges", RevListOptions{Paths: []File{"foo"}, SimplifyMerges: true}, nil, []CommitID{theirs, base}},
+		{"unchanged", RevListOptions{Paths: []File{"missing"}}, nil, nil},
+		{"first parent", RevListOptions{FirstParent: true}, nil, []CommitID{merge, ours, base}},
+		{"first parent foo", RevListOptions{FirstParent: true, Paths: []File{"foo"}}, nil, []CommitID{merge, base}},
+		{"ancestry path", RevListOptions{AncestryPath: true}, []Commitish{theirs}, []CommitID{merge}},
+		// The second parent's history comes first in topological
+		// order, and the commits have the same date.
+		{"topo order", RevListOptions{TopoOrder: true}, nil, []CommitID{merge, theirs, ours, base}},
+		{"date order", RevListOptions{DateOrder: true}, nil, []CommitID{merge, ours, theirs, base}},
+	}
+	for _, tc := range tests {
+		opts := tc.opts
+		opts.Quiet = true
+		revs, err := RevList(c, opts, nil, []Commitish{merge}, tc.excludes)
+		if err != nil {
+			t.Errorf("%v: %v", tc.label, err)
+			continue
+		}
+		if len(revs) != len(tc.want) {
+			t.Errorf("%v: got %v want %v", tc.label, revs, tc.want)
+			continue
+		}
+		for i := range revs {
+			if CommitID(revs[i]) != tc.want[i] {
+				t.Errorf("%v: got %v want %v", tc.label, revs, tc.want)
+				break
+			}
+		}
+	}
+
+	if _, err := RevList(c, RevListOptions{Quiet: true, AncestryPath: true}, nil, []Commitish{merge}, nil); err == nil {
+		t.Error("Expected an error for --ancestry-path without a bottom commit")
+	}
+
+	// ours doesn't change foo, so the merge's parent is rewritten to
+	// base when the parents are listed.
+	parents := make(map[CommitID][]CommitID)
+	err = RevListParentsCallback(c, RevListOptions{Paths: []File{"foo"}, FullHistory: true}, []Commitish{merge}, nil, func(cmt CommitID, p []CommitID) error {
+		parents[cmt] = p
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := parents[merge]; len(parents) != 3 || len(p) != 2 || p[0] != base || p[1] != theirs {
+		t.Errorf("Unexpected parents %v", parents)
+	}
+}
+
+func TestRevListSimplifyMergesOrder(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo": "a\n"},
+		map[string]string{"foo": "b\n"},
+		map[string]string{"bar": "c\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	// The commits on the two sides of the merge alternate in date
+	// order, and the second side's last commit doesn't change f, so it's
+	// simplified away.
+	date := 1600000000
+	commit := func(parents []CommitID, f, g, o string) CommitID {
+		t.Helper()
+		files := map[IndexPath]testFile{"f": {ModeBlob, f}, "o": {ModeBlob, o}}
+		if g != "" {
+			files["g"] = testFile{ModeBlob, g}
+		}
+		content := fmt.Sprintf("tree %v\n", testTree(t, c, files))
+		for _, p := range parents {
+			content += fmt.Sprintf("parent %v\n", p)
+		}
+		date += 100
+		content += fmt.Sprintf("author A <a@x> %d +0000\ncommitter A <a@x> %d +0000\n\ncommit\n", date, date)
+		id, err := c.WriteObject("commit", []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return CommitID(id)
+	}
+	base := commit(nil, "b\n", "", "o\n")
+	a1 := commit([]CommitID{base}, "b\na1\n", "", "o\n")
+	c1 := commit([]CommitID{base}, "b\nc1\n", "c1\n", "o\n")
+	a2 := commit([]CommitID{a1}, "b\na1\n", "", "o\na2\n")
+	c2 := commit([]CommitID{c1}, "b\nc1\nc2\n", "c1\n", "o\n")
+	a3 := commit([]CommitID{a2}, "b\na1\na3\n", "", "o\na2\n")
+	c3 := commit([]CommitID{c2}, "b\nc1\nc2\n", "c1\nc3\n", "o\n")
+	merge := commit([]CommitID{a3, c3}, "b\na1\na3\n", "c1\nc3\n", "o\na2\n")
+	tip := commit([]CommitID{merge}, "b\na1\na3\na4\n", "c1\nc3\n", "o\na2\n")
+
+	// Like git, the commits are in the topological order of the
+	// original history, with each parent's commits kept together, but
+	// the merge's parents are the simplified ones.
+	want := []CommitID{tip, merge, c2, c1, a3, a1, base}
+	var got []CommitID
+	parents := make(map[CommitID][]CommitID)
+	err := RevListParentsCallback(c, RevListOptions{Paths: []File{"f"}, SimplifyMerges: true}, []Commitish{tip}, nil, func(cmt CommitID, p []CommitID) error {
+		got = append(got, cmt)
+		parents[cmt] = p
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+	if p := parents[merge]; len(p) != 2 || p[0] != a3 || p[1] != c2 {
+		t.Errorf("Unexpected parents of merge %v", p)
+	}
+}
+
+func TestFollowDiff(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo": "foo\ncontent\nwhich\nis\nrenamed\n"},
+		map[string]string{"ours": "ours\n"},
+		map[string]string{"theirs": "theirs\n"},
+	)
+	defer os.RemoveAll(dir)
+	ours, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := RevParseCommit(c, &RevParseOptions{}, "master^")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Rm(c, RmOptions{}, []File{"foo"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("bar", []byte("foo\ncontent\nwhich\nis\nrenamed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Add(c, AddOptions{}, []File{"bar"}); err != nil {
+		t.Fatal(err)
+	}
+	rename, err := Commit(c, CommitOptions{}, "rename", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffs, path, err := FollowDiff(c, DiffCommonOptions{}, rename, "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "foo" || len(diffs) != 1 || diffs[0].Status != 'R' || diffs[0].SrcName != "foo" {
+		t.Errorf("Unexpected rename of bar: %v %v", path, diffs)
+	}
+
+	// The older commit doesn't change foo, the root commit added it.
+	for _, cmt := range []CommitID{ours, base} {
+		diffs, path, err := FollowDiff(c, DiffCommonOptions{}, cmt, "foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := cmt == base; path != "foo" || (len(diffs) == 1) != want {
+			t.Errorf("%v: unexpected diff of foo: %v %v", cmt, path, diffs)
+		}
+	}
+}
@@ -36,6 +36,16 @@ func SendPack(c *Client, opts SendPackOptions, r Remote, refs []Refname) error {
 	defer remoteConn.Close()
 
 	log.Printf("Send Pack Protocol Version %d Capabilities: %v", remoteConn.ProtocolVersion(), remoteConn.Capabilities())
+	// A ref with a leading "+" is updated even if it isn't a
+	// fast-forward, like every ref is with opts.Force.
+	force := make(map[Refname]bool)
+	refs = append([]Refname(nil), refs...)
+	for i, ref := range refs {
+		if strings.HasPrefix(ref.String(), "+") {
+			refs[i] = ref[1:]
+			force[refs[i]] = true
+		}
+	}
 	remoterefs := make(map[Refname]Sha1)
 	localrefs := make(map[Refname]Sha1)
 	var refpatterns []string = make([]string, 0, len(refs))
@@ -53,7 +63,7 @@ func SendPack(c *Client, opts SendPackOptions, r Remote, refs []Refname) error {
 		localrefs[local] = Sha1(localsha)
 	}
 
-	remotes, err := remoteConn.GetRefs(LsRemoteOptions{Heads: true, Tags: true, RefsOnly: true}, refpatterns)
+	remotes, err := remoteConn.GetRefs(LsRemoteOptions{RefsOnly: true}, refpatterns)
 	if err != nil {
 		return err
 	}
@@ -80,7 +90,7 @@ func SendPack(c *Client, opts SendPackOptions, r Remote, refs []Refname) error {
 		}
 
 		isancestor := CommitID(remotesha).IsAncestor(c, CommitID(localsha))
-		if !isancestor && !opts.Force {
+		if !isancestor && !opts.Force && !force[ref] {
 			return fmt.Errorf("Remote %v is not a fast-forward of %v", remotesha, localsha)
 		}
 		// FIXME: Check if any failed and honour opts.Atomic instead of bothering
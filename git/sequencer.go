@@ -0,0 +1,596 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The sequencer applies a list of commits one at a time, for cherry-pick
+// and revert. Its state is kept in .git/sequencer, in the same format
+// as git, so that when a commit can't be applied cleanly the user can
+// resolve the conflicts and continue where it stopped:
+//
+//	head           the commit that HEAD pointed to before starting
+//	todo           the commits which have not been applied yet
+//	opts           the options which were used, in git config format
+//	abort-safety   the commit that HEAD pointed to after the last step
+//
+// While stopped, CHERRY_PICK_HEAD or REVERT_HEAD names the commit being
+// applied.
+
+// sequencerOptions are the options for a cherry-pick or revert which are
+// saved in the sequencer directory, so that they still apply after
+// --continue.
+type sequencerOptions struct {
+	Edit         bool
+	NoCommit     bool
+	SignOff      bool
+	RecordOrigin bool
+	AllowEmpty   bool
+
+	// The parent of merge commits to use as the base, 1 indexed.
+	Mainline int
+
+	StrategyOptions []string
+}
+
+// sequencerStep is a line in the sequencer's todo list.
+type sequencerStep struct {
+	// The action to take, either "pick" or "revert".
+	Action string
+	Commit CommitID
+}
+
+// command returns the name of the command that does the step's action.
+func (s sequencerStep) command() string {
+	if s.Action == "pick" {
+		return "cherry-pick"
+	}
+	return s.Action
+}
+
+// headFile returns the file which records the commit being applied when
+// the step is stopped.
+func (s sequencerStep) headFile() File {
+	if s.Action == "pick" {
+		return "CHERRY_PICK_HEAD"
+	}
+	return "REVERT_HEAD"
+}
+
+func (c *Client) sequencerFile(name string) File {
+	return c.GitDir.File(File(filepath.Join("sequencer", name)))
+}
+
+// sequencerInProgress returns true if there's a sequencer operation
+// that was stopped.
+func (c *Client) sequencerInProgress() bool {
+	return c.sequencerFile("todo").Exists()
+}
+
+// writeSequencerTodo writes the list of steps which still need to be
+// done, and records HEAD as a safe point to abort to.
+func writeSequencerTodo(c *Client, todo []sequencerStep) error {
+	var content string
+	for _, step := range todo {
+		msg, err := step.Commit.GetCommitMessage(c)
+		if err != nil {
+			return err
+		}
+		content += fmt.Sprintf("%v %v %v\n", step.Action, step.Commit, msg.Subject())
+	}
+	if err := c.GitDir.WriteFile(File(filepath.Join("sequencer", "todo")), []byte(content), 0644); err != nil {
+		return err
+	}
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		return err
+	}
+	return c.GitDir.WriteFile(File(filepath.Join("sequencer", "abort-safety")), []byte(head.String()+"\n"), 0644)
+}
+
+// startSequencer saves the initial sequencer state to run todo with
+// opts.
+func startSequencer(c *Client, opts sequencerOptions, todo []sequencerStep) error {
+	if c.sequencerInProgress() {
+		return fmt.Errorf("a cherry-pick or revert is already in progress\nhint: try \"dgit %v (--continue | --skip | --abort | --quit)\"", todo[0].command())
+	}
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.GitDir.File("sequencer").String(), 0755); err != nil {
+		return err
+	}
+	if err := c.GitDir.WriteFile(File(filepath.Join("sequencer", "head")), []byte(head.String()+"\n"), 0644); err != nil {
+		return err
+	}
+
+	var config GitConfig
+	set := func(name string, val bool) {
+		if val {
+			config.SetConfig("options."+name, "true")
+		}
+	}
+	set("edit", opts.Edit)
+	set("no-commit", opts.NoCommit)
+	set("signoff", opts.SignOff)
+	set("record-origin", opts.RecordOrigin)
+	set("allow-empty", opts.AllowEmpty)
+	if opts.Mainline > 0 {
+		config.SetConfig("options.mainline", strconv.Itoa(opts.Mainline))
+	}
+	if len(opts.StrategyOptions) > 0 {
+		config.SetConfig("options.strategy-option", strings.Join(opts.StrategyOptions, " "))
+	}
+	f, err := os.Create(c.sequencerFile("opts").String())
+	if err != nil {
+		return err
+	}
+	config.WriteFile(f)
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return writeSequencerTodo(c, todo)
+}
+
+// loadSequencer reads the state of a sequencer operation that was
+// stopped.
+func loadSequencer(c *Client) (sequencerOptions, []sequencerStep, error) {
+	if !c.sequencerInProgress() {
+		return sequencerOptions{}, nil, fmt.Errorf("no cherry-pick or revert in progress")
+	}
+	f, err := os.Open(c.sequencerFile("opts").String())
+	if err != nil {
+		return sequencerOptions{}, nil, err
+	}
+	config := ParseConfig(f)
+	f.Close()
+	get := func(name string) bool {
+		val, _ := config.GetConfig("options." + name)
+		return val == "true"
+	}
+	opts := sequencerOptions{
+		Edit:         get("edit"),
+		NoCommit:     get("no-commit"),
+		SignOff:      get("signoff"),
+		RecordOrigin: get("record-origin"),
+		AllowEmpty:   get("allow-empty"),
+	}
+	if val, _ := config.GetConfig("options.mainline"); val != "" {
+		if opts.Mainline, err = strconv.Atoi(val); err != nil {
+			return sequencerOptions{}, nil, fmt.Errorf("Invalid mainline in sequencer options: %v", val)
+		}
+	}
+	if val, _ := config.GetConfig("options.strategy-option"); val != "" {
+		opts.StrategyOptions = strings.Fields(val)
+	}
+
+	content, err := c.sequencerFile("todo").ReadAll()
+	if err != nil {
+		return sequencerOptions{}, nil, err
+	}
+	var todo []sequencerStep
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0][0] == '#' {
+			continue
+		}
+		if len(fields) < 2 {
+			return sequencerOptions{}, nil, fmt.Errorf("Invalid line in sequencer todo: %v", line)
+		}
+		sha, err := Sha1FromString(fields[1])
+		if err != nil {
+			return sequencerOptions{}, nil, err
+		}
+		todo = append(todo, sequencerStep{Action: fields[0], Commit: CommitID(sha)})
+	}
+	return opts, todo, nil
+}
+
+// removeSequencer removes the sequencer state, forgetting about the
+// current operation.
+func (c *Client) removeSequencer() error {
+	if err := os.RemoveAll(c.GitDir.File("sequencer").String()); err != nil {
+		return err
+	}
+	return c.removeMergeState()
+}
+
+// runSequencer applies each step in todo. If a step can't be completed,
+// the remaining steps are saved and the error is returned, so that the
+// user can resolve it and continue.
+func runSequencer(c *Client, opts sequencerOptions, todo []sequencerStep) error {
+	for len(todo) > 0 {
+		if err := sequencerApply(c, opts, todo[0]); err != nil {
+			// If nothing was done before failing, there's nothing
+			// to continue or abort, so don't leave the state behind.
+			if !c.GitDir.File("MERGE_MSG").Exists() {
+				orig, _ := c.sequencerFile("head").ReadFirstLine()
+				if head, herr := c.GetHeadCommit(); herr == nil && head.String() == orig {
+					c.removeSequencer()
+				}
+			}
+			return err
+		}
+		todo = todo[1:]
+		if err := writeSequencerTodo(c, todo); err != nil {
+			return err
+		}
+	}
+	return c.removeSequencer()
+}
+
+// sequencerContinue commits the resolution of the step that stopped, if
+// it wasn't already committed by the user, then runs the rest of the
+// steps.
+func sequencerContinue(c *Client) error {
+	opts, todo, err := loadSequencer(c)
+	if err != nil {
+		return err
+	}
+	if len(todo) > 0 {
+		if picked, err := c.GitDir.File(todo[0].headFile()).ReadFirstLine(); err == nil {
+			idx, err := c.GitDir.ReadIndex()
+			if err != nil {
+				return err
+			}
+			if len(idx.GetUnmerged()) > 0 {
+				return fmt.Errorf("Committing is not possible because you have unmerged files.\nhint: Fix them up in the work tree, and then use 'dgit add/rm <file>'\nhint: as appropriate to mark resolution.")
+			}
+			msg, err := c.GitDir.File("MERGE_MSG").ReadAll()
+			if err != nil {
+				return err
+			}
+			sha, err := Sha1FromString(picked)
+			if err != nil {
+				return err
+			}
+			step := sequencerStep{todo[0].Action, CommitID(sha)}
+			// The message may have comments about the conflicts
+			// which need to be stripped.
+			if err := sequencerCommit(c, opts, step, msg, "strip"); err != nil {
+				return err
+			}
+		}
+		todo = todo[1:]
+		if err := writeSequencerTodo(c, todo); err != nil {
+			return err
+		}
+	}
+	return runSequencer(c, opts, todo)
+}
+
+// sequencerSkip discards the changes from the step that stopped, and
+// runs the rest of the steps.
+func sequencerSkip(c *Client) error {
+	opts, todo, err := loadSequencer(c)
+	if err != nil {
+		return err
+	}
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		return err
+	}
+	if err := ResetMode(c, ResetOptions{Hard: true}, head); err != nil {
+		return err
+	}
+	if err := c.removeMergeState(); err != nil {
+		return err
+	}
+	if len(todo) > 0 {
+		todo = todo[1:]
+		if err := writeSequencerTodo(c, todo); err != nil {
+			return err
+		}
+	}
+	return runSequencer(c, opts, todo)
+}
+
+// sequencerAbort goes back to the commit HEAD pointed to before starting
+// and removes the sequencer state. If HEAD was moved by something other
+// than the sequencer in the meantime, it's left alone.
+func sequencerAbort(c *Client) error {
+	if !c.sequencerInProgress() {
+		return fmt.Errorf("no cherry-pick or revert in progress")
+	}
+	orig, err := c.sequencerFile("head").ReadFirstLine()
+	if err != nil {
+		return err
+	}
+	origHead, err := Sha1FromString(orig)
+	if err != nil {
+		return err
+	}
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		return err
+	}
+	if safe, err := c.sequencerFile("abort-safety").ReadFirstLine(); err == nil && safe != head.String() {
+		fmt.Fprintln(os.Stderr, "You seem to have moved HEAD. Not rewinding, check your HEAD!")
+		return c.removeSequencer()
+	}
+	if err := ResetMode(c, ResetOptions{Hard: true}, CommitID(origHead)); err != nil {
+		return err
+	}
+	return c.removeSequencer()
+}
+
+// sequencerApply applies a single step of the sequencer.
+func sequencerApply(c *Client, opts sequencerOptions, step sequencerStep) error {
+	cmt := step.Commit
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		return err
+	}
+	var ours Treeish = head
+	if opts.NoCommit {
+		// The changes are applied on top of the index, which may
+		// already have changes from earlier steps.
+		idx, err := c.GitDir.ReadIndex()
+		if err != nil {
+			return err
+		}
+		if len(idx.GetUnmerged()) > 0 {
+			return fmt.Errorf("Your index file is unmerged.")
+		}
+		if ours, err = WriteTreeFromIndex(c, idx, WriteTreeOptions{}); err != nil {
+			return err
+		}
+	}
+	result, parent, msg, err := sequencerMerge(c, opts, step, ours)
+	if err != nil {
+		return err
+	}
+	label := fmt.Sprintf("%v... %v", cmt.String()[:7], msg.Subject())
+
+	message, err := stepMessage(c, opts, step, msg, parent)
+	if err != nil {
+		return err
+	}
+	if !result.Clean() {
+		message += "\n# Conflicts:\n"
+		for _, path := range result.Conflicts {
+			message += "#\t" + path.String() + "\n"
+		}
+		if err := c.GitDir.WriteFile("MERGE_MSG", []byte(message), 0644); err != nil {
+			return err
+		}
+		if !opts.NoCommit {
+			if err := c.GitDir.WriteFile(step.headFile(), []byte(cmt.String()+"\n"), 0644); err != nil {
+				return err
+			}
+		}
+		verb := "apply"
+		if step.Action == "revert" {
+			verb = "revert"
+		}
+		cmd := step.command()
+		return fmt.Errorf("could not %v %v\nhint: After resolving the conflicts, mark them with\nhint: \"dgit add/rm <pathspec>\", then run\nhint: \"dgit %v --continue\".\nhint: You can instead skip this commit with \"dgit %v --skip\".\nhint: To abort and get back to the state before \"dgit %v\",\nhint: run \"dgit %v --abort\".", verb, label, cmd, cmd, cmd, cmd)
+	}
+	if opts.NoCommit {
+		return nil
+	}
+	return sequencerCommit(c, opts, step, message, "default")
+}
+
+// sequencerMerge merges the changes introduced (or, for a revert,
+// undone) by the commit of step into ours, and updates the index and work
+// tree with the result. It returns the result along with the parent that
+// the changes were taken relative to and the message of the commit.
+func sequencerMerge(c *Client, opts sequencerOptions, step sequencerStep, ours Treeish) (*treeMergeResult, Treeish, CommitMessage, error) {
+	cmt := step.Commit
+	parents, err := cmt.Parents(c)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	var parent Treeish
+	switch {
+	case len(parents) > 1 && opts.Mainline <= 0:
+		return nil, nil, "", fmt.Errorf("commit %v is a merge but no -m option was given.", cmt)
+	case len(parents) > 1 && opts.Mainline > len(parents):
+		return nil, nil, "", fmt.Errorf("commit %v does not have parent %d", cmt, opts.Mainline)
+	case len(parents) > 1:
+		parent = parents[opts.Mainline-1]
+	case opts.Mainline > 0:
+		return nil, nil, "", fmt.Errorf("mainline was specified but commit %v is not a merge.", cmt)
+	case len(parents) == 1:
+		parent = parents[0]
+	}
+
+	msg, err := cmt.GetCommitMessage(c)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	label := fmt.Sprintf("%v... %v", cmt.String()[:7], msg.Subject())
+	treeOpts := mergeTreeOptions{
+		contentMergeOptions: contentMergeOptions{
+			OursLabel: "HEAD",
+			Diff3:     c.GetConfig("merge.conflictstyle") == "diff3",
+		},
+	}
+	if err := treeOpts.parseStrategyOptions(opts.StrategyOptions); err != nil {
+		return nil, nil, "", err
+	}
+
+	// Picking a commit is a merge of it with HEAD, using its parent as
+	// the merge base. Reverting is the same with the commit and its
+	// parent swapped.
+	var bases []CommitID
+	var theirs Treeish
+	switch step.Action {
+	case "pick":
+		if p, ok := parent.(CommitID); ok {
+			bases = []CommitID{p}
+		}
+		theirs = cmt
+		treeOpts.BaseLabel, treeOpts.TheirsLabel = "parent of "+label, label
+	case "revert":
+		bases = []CommitID{cmt}
+		if theirs = parent; theirs == nil {
+			// Reverting the root commit removes everything it
+			// added.
+			if theirs, err = WriteTreeFromIndex(c, NewIndex(), WriteTreeOptions{}); err != nil {
+				return nil, nil, "", err
+			}
+		}
+		treeOpts.BaseLabel, treeOpts.TheirsLabel = label, "parent of "+label
+	default:
+		return nil, nil, "", fmt.Errorf("Unsupported sequencer action %v", step.Action)
+	}
+
+	result, err := mergeCommitsWithBases(c, treeOpts, bases, ours, theirs)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if err := applyMergeResult(c, ours, result, step.command()); err != nil {
+		return nil, nil, "", err
+	}
+	for _, m := range result.Messages {
+		fmt.Println(m)
+	}
+	return result, parent, msg, nil
+}
+
+// stepMessage returns the commit message to use for the step, given the
+// message of the commit being applied and the parent which it's
+// being applied relative to.
+func stepMessage(c *Client, opts sequencerOptions, step sequencerStep, msg CommitMessage, parent Treeish) (string, error) {
+	message := string(msg)
+	switch step.Action {
+	case "pick":
+		if opts.RecordOrigin {
+			message = appendTrailer(message, fmt.Sprintf("(cherry picked from commit %v)", step.Commit))
+		}
+	case "revert":
+		message = fmt.Sprintf("Revert \"%v\"\n\nThis reverts commit %v", msg.Subject(), step.Commit)
+		if p, ok := parent.(CommitID); ok && opts.Mainline > 0 {
+			message += fmt.Sprintf(", reversing\nchanges made to %v", p)
+		}
+		message += ".\n"
+	}
+	if opts.SignOff {
+		committer, err := c.GetCommitter(nil)
+		if err != nil && err != NoGlobalConfig {
+			return "", err
+		}
+		message = appendTrailer(message, "Signed-off-by: "+committer.String())
+	}
+	return message, nil
+}
+
+// appendTrailer adds line to the trailers at the end of msg, starting a
+// new paragraph for it if the last paragraph isn't already trailers. The
+// line isn't added again if it's already the last line.
+func appendTrailer(msg, line string) string {
+	msg = strings.TrimRight(msg, "\n")
+	paragraphs := strings.Split(msg, "\n\n")
+	last := strings.Split(paragraphs[len(paragraphs)-1], "\n")
+	if last[len(last)-1] == line {
+		return msg + "\n"
+	}
+	isTrailer := len(paragraphs) > 1
+	for _, l := range last {
+		colon := strings.Index(l, ": ")
+		if !strings.HasPrefix(l, "(cherry picked from commit ") && (colon <= 0 || strings.ContainsAny(l[:colon], " \t")) {
+			isTrailer = false
+		}
+	}
+	if isTrailer {
+		return msg + "\n" + line + "\n"
+	}
+	return msg + "\n\n" + line + "\n"
+}
+
+// sequencerCommit commits the index as the result of step. The author of
+// picked commits is kept. The message is cleaned up with cleanupMode, as
+// for Commit.
+func sequencerCommit(c *Client, opts sequencerOptions, step sequencerStep, message, cleanupMode string) error {
+	orig := step.Commit
+	idx, err := c.GitDir.ReadIndex()
+	if err != nil {
+		return err
+	}
+	tree, err := WriteTreeFromIndex(c, idx, WriteTreeOptions{})
+	if err != nil {
+		return err
+	}
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		return err
+	}
+	headTree, err := head.TreeID(c)
+	if err != nil {
+		return err
+	}
+	if tree == headTree {
+		// Commits which were empty to begin with are kept with
+		// AllowEmpty, but commits which became empty are not.
+		empty := false
+		if opts.AllowEmpty && step.Action == "pick" {
+			origTree, err := orig.TreeID(c)
+			if err != nil {
+				return err
+			}
+			parents, err := orig.Parents(c)
+			if err != nil {
+				return err
+			}
+			if len(parents) == 0 {
+				empty = len(idx.Objects) == 0
+			} else if parentTree, err := parents[0].TreeID(c); err == nil {
+				empty = parentTree == origTree
+			}
+		}
+		if !empty {
+			if err := c.GitDir.WriteFile("MERGE_MSG", []byte(message), 0644); err != nil {
+				return err
+			}
+			if err := c.GitDir.WriteFile(step.headFile(), []byte(orig.String()+"\n"), 0644); err != nil {
+				return err
+			}
+			return fmt.Errorf("The previous %v is now empty, possibly due to conflict resolution.\nIf you wish to commit it anyway, use:\n\n    dgit commit --allow-empty\n\nOtherwise, please use 'dgit %v --skip'", step.command(), step.command())
+		}
+	}
+
+	if opts.Edit {
+		if err := c.GitDir.WriteFile("MERGE_MSG", []byte(message), 0644); err != nil {
+			return err
+		}
+		if err := c.ExecEditor(c.GitDir.File("MERGE_MSG")); err != nil {
+			return err
+		}
+		edited, err := c.GitDir.File("MERGE_MSG").ReadAll()
+		if err != nil {
+			return err
+		}
+		message = edited
+	}
+	cleaned, err := CommitMessage(message).Cleanup(cleanupMode, opts.Edit)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(cleaned) == "" {
+		return fmt.Errorf("Aborting commit due to empty commit message.")
+	}
+
+	if step.Action == "pick" {
+		restore, err := useAuthorOf(c, orig)
+		if err != nil {
+			return err
+		}
+		defer restore()
+	}
+	cid, err := CommitTree(c, CommitTreeOptions{}, tree, []CommitID{head}, cleaned)
+	if err != nil && err != NoGlobalConfig {
+		return err
+	}
+	refmsg := fmt.Sprintf("%v: %v (dgit)", step.command(), CommitMessage(cleaned).Subject())
+	if err := UpdateRef(c, UpdateRefOptions{OldValue: head, CreateReflog: true}, "HEAD", cid, refmsg); err != nil {
+		return err
+	}
+	return c.removeMergeState()
+}
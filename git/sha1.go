@@ -1,11 +1,15 @@
 package git
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -511,11 +515,10 @@ func (c CommitID) getRefNamesList(cl *Client) (string, error) {
 
 	refsForCommit := ""
 	for _, ref := range refs {
-		if len(refsForCommit) != 0 {
-			refsForCommit = refsForCommit + ", "
-		}
-
 		if ref.Value == Sha1(c) {
+			if len(refsForCommit) != 0 {
+				refsForCommit = refsForCommit + ", "
+			}
 
 			// TODO relate any other top-level refs to their linked ref, not just HEAD
 			if headRefSpec.String() == ref.Name {
@@ -528,87 +531,54 @@ func (c CommitID) getRefNamesList(cl *Client) (string, error) {
 	return refsForCommit, nil
 }
 
-func (c CommitID) FormatMedium(cl *Client) (string, error) {
-	output := ""
-
-	author, err := c.GetAuthor(cl)
-	if err != nil {
+// mergeHeader returns the "Merge:" line of a merge commit's header, with
+// the abbreviated ids of its parents, or an empty string if c isn't a
+// merge.
+func (c CommitID) mergeHeader(cl *Client) (string, error) {
+	parents, err := c.Parents(cl)
+	if err != nil || len(parents) < 2 {
 		return "", err
 	}
-	output = output + fmt.Sprintf("commit %s", c)
+	ids := make([]string, len(parents))
+	for i, p := range parents {
+		ids[i] = Sha1(p).Abbrev(cl, 7)
+	}
+	return "Merge: " + strings.Join(ids, " ") + "\n", nil
+}
+
+func (c CommitID) FormatMedium(cl *Client) (string, error) {
+	output := fmt.Sprintf("commit %s", c)
 	refNameList, _ := c.getRefNamesList(cl)
 	if refNameList != "" {
 		output = output + fmt.Sprintf(" (%s)", refNameList)
 	}
 	output = output + "\n"
-	if parents, err := c.Parents(cl); len(parents) > 1 && err == nil {
-		output = output + "Merge: "
-		for i, p := range parents {
-			output = output + fmt.Sprintf("%s", p)
-			if i != len(parents)-1 {
-				output = output + " "
-			}
-		}
-		output = output + "\n"
-	}
-	date, err := c.GetDate(cl)
+	msg, err := c.formatMediumMessage(cl)
 	if err != nil {
 		return "", err
 	}
-	output = output + fmt.Sprintf("Author: %v\nDate:   %v\n\n", author, date.Format("Mon Jan 2 15:04:05 2006 -0700"))
+	return output + msg + "\n", nil
+}
 
-	msg, err := c.GetCommitMessage(cl)
+// formatMediumMessage returns the part of the medium format of c after the
+// "commit" line, which is its Merge, Author and Date headers followed by
+// its indented message.
+func (c CommitID) formatMediumMessage(cl *Client) (string, error) {
+	p, err := NewPrettyPrinter(cl, PrettyOptions{Format: "medium"}, false)
 	if err != nil {
 		return "", err
 	}
-	lines := strings.Split(strings.TrimSpace(msg.String()), "\n")
-	for _, l := range lines {
-		output = output + fmt.Sprintf("    %v\n", l)
-	}
-	output = output + "\n"
-	return output, nil
+	return p.Message(c)
 }
 
+// Format returns c formatted with the placeholders of a pretty format
+// string, as described in git-log(1).
 func (c CommitID) Format(cl *Client, format string) (string, error) {
-	output := format
-
-	// Newline
-	if strings.Contains(output, "%n") {
-		output = strings.Replace(output, "%n", "\n", -1)
-	}
-
-	// Full commit hash
-	if strings.Contains(output, "%H") {
-		output = strings.Replace(output, "%H", c.String(), -1)
-	}
-
-	// Committer date as unix timestamp
-	if strings.Contains(output, "%ct") {
-		date, err := c.GetCommitterDate(cl)
-		if err != nil {
-			return "", err
-		}
-		output = strings.Replace(output, "%ct", strconv.FormatInt(date.Unix(), 10), -1)
-	}
-
-	// Author date as unix timestamp
-	if strings.Contains(output, "%at") {
-		date, err := c.GetDate(cl)
-		if err != nil {
-			return "", err
-		}
-		output = strings.Replace(output, "%at", strconv.FormatInt(date.Unix(), 10), -1)
-	}
-
-	// Show the non-stylized ref names beside any relevant commit
-	if strings.Contains(output, "%D") {
-		refNameList, _ := c.getRefNamesList(cl)
-		output = strings.Replace(output, "%D", refNameList, -1)
+	p, err := NewPrettyPrinter(cl, PrettyOptions{Format: "format:" + format}, false)
+	if err != nil {
+		return "", err
 	}
-
-	// TODO Add more formatting options (there are many)
-
-	return output, nil
+	return p.Message(c)
 }
 
 // A TreeEntry represents an entry inside of a Treeish.
@@ -760,3 +730,94 @@ func GetIndexMap(c *Client, t Treeish) (IndexMap, error) {
 	idx := &Index{Objects: indexentries}
 	return idx.GetMap(), nil
 }
+
+// Abbrev returns the shortest prefix of s which is at least n characters
+// long and does not ambiguously refer to any other object in the repository.
+func (s Sha1) Abbrev(c *Client, n int) string {
+	full := s.String()
+	if n >= len(full) {
+		return full
+	}
+	if n < 4 {
+		n = 4
+	}
+
+	// Find the longest prefix that s shares with any other object that
+	// lives in the same fanout directory.
+	longest := 0
+	checkCandidate := func(cand string) {
+		if cand == full {
+			return
+		}
+		i := 0
+		for i < len(full) && cand[i] == full[i] {
+			i++
+		}
+		if i > longest {
+			longest = i
+		}
+	}
+	dir := full[:2]
+	if f, err := os.Open(filepath.Join(c.ObjectDir, dir)); err == nil {
+		names, _ := f.Readdirnames(-1)
+		f.Close()
+		for _, name := range names {
+			if cand := dir + name; len(cand) == len(full) {
+				checkCandidate(cand)
+			}
+		}
+	}
+	// The pack indexes are sorted, so only the objects on either side
+	// of s can share a longer prefix with it than any others in the pack.
+	for _, t := range c.packSha1TablesForAbbrev() {
+		for _, obj := range t.neighbours(s) {
+			checkCandidate(obj.String())
+		}
+	}
+	if longest+1 > n {
+		n = longest + 1
+	}
+	if n > len(full) {
+		n = len(full)
+	}
+	return full[:n]
+}
+
+// packSha1TablesForAbbrev returns the Sha1 tables of the repository's pack
+// indexes. They're only read the first time that they're needed.
+func (c *Client) packSha1TablesForAbbrev() []*packSha1Table {
+	f, err := os.Open(filepath.Join(c.ObjectDir, "pack"))
+	if err != nil {
+		return nil
+	}
+	names, _ := f.Readdirnames(-1)
+	f.Close()
+	if c.packSha1Tables == nil {
+		c.packSha1Tables = make(map[string]*packSha1Table)
+	}
+	var tables []*packSha1Table
+	for _, name := range names {
+		if filepath.Ext(name) != ".idx" {
+			continue
+		}
+		t, ok := c.packSha1Tables[name]
+		if !ok {
+			idx, err := os.Open(filepath.Join(c.ObjectDir, "pack", name))
+			if err != nil {
+				continue
+			}
+			t, err = readPackSha1Table(bufio.NewReader(idx))
+			idx.Close()
+			if err != nil {
+				log.Printf("Could not read pack index %v: %v", name, err)
+			}
+			// An unreadable index is cached as nil, so that it isn't
+			// read again for every object.
+			c.packSha1Tables[name] = t
+		}
+		if t != nil {
+			tables = append(tables, t)
+		}
+	}
+	return tables
+}
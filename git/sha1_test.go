@@ -1,6 +1,9 @@
 package git
 
 import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
 	"testing"
 )
 
@@ -31,3 +34,65 @@ func TestSha1Stringer(t *testing.T) {
 		}
 	}
 }
+
+func TestPackSha1Table(t *testing.T) {
+	var sha1s []Sha1
+	for _, s := range []string{
+		"1000000000000000000000000000000000000000",
+		"37ff000000000000000000000000000000000000",
+		"37ff15ce00000000000000000000000000000000",
+		"37ff15ce14338bca67e86a736505c5482d8348aa",
+		"37ff200000000000000000000000000000000000",
+		"3800000000000000000000000000000000000000",
+	} {
+		sha, err := Sha1FromString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sha1s = append(sha1s, sha)
+	}
+	var idx bytes.Buffer
+	idx.Write([]byte{0377, 't', 'O', 'c'})
+	binary.Write(&idx, binary.BigEndian, uint32(2))
+	var fanout PackIndexFanout
+	for _, s := range sha1s {
+		for i := int(s[0]); i < len(fanout); i++ {
+			fanout[i]++
+		}
+	}
+	binary.Write(&idx, binary.BigEndian, fanout)
+	for _, s := range sha1s {
+		idx.Write(s[:])
+	}
+	// The rest of the index isn't needed to look up the objects.
+	table, err := readPackSha1Table(bytes.NewReader(idx.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		obj  string
+		want []Sha1
+	}{
+		// Objects in the table don't neighbour themselves.
+		{"37ff15ce14338bca67e86a736505c5482d8348aa", []Sha1{sha1s[2], sha1s[4]}},
+		{"37ff15ce14338bca67e86a736505c5482d8348ab", []Sha1{sha1s[3], sha1s[4]}},
+		{"3700000000000000000000000000000000000000", []Sha1{sha1s[1]}},
+		// Only objects with the same first byte are neighbours.
+		{"38ff000000000000000000000000000000000000", []Sha1{sha1s[5]}},
+		{"2000000000000000000000000000000000000000", nil},
+	}
+	for _, tc := range tests {
+		obj, err := Sha1FromString(tc.obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := table.neighbours(obj); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v: got %v want %v", tc.obj, got, tc.want)
+		}
+	}
+
+	if _, err := readPackSha1Table(bytes.NewReader(idx.Bytes()[:idx.Len()-1])); err == nil {
+		t.Error("Expected an error for a truncated index")
+	}
+}
@@ -2,34 +2,12 @@ package git
 
 import (
 	"fmt"
-	"strings"
+	"os"
 )
 
-type FormatString string
-
-func (f FormatString) FormatCommit(c *Client, cmt CommitID) (string, error) {
-	if f == "" || f == "medium" {
-		output, err := formatCommitMedium(cmt, c)
-		if err != nil {
-			return "", err
-		}
-		return fmt.Sprintf("%v\n", output), nil
-	}
-	if f == "raw" {
-		output := fmt.Sprintf("commit %v\n", cmt)
-		cmtObject, err := c.GetCommitObject(cmt)
-		if err != nil {
-			return "", err
-		}
-		return fmt.Sprintf("%v%v\n", output, cmtObject), nil
-	}
-
-	return "", fmt.Errorf("Format %s is not supported.\n", f)
-}
-
 type ShowOptions struct {
 	DiffOptions
-	Format FormatString
+	PrettyOptions
 }
 
 // Show implementes the "git show" command.
@@ -50,41 +28,89 @@ func Show(c *Client, opts ShowOptions, objects []string) error {
 		commitIds = append(commitIds, commit)
 	}
 
+	lw, err := NewLogWriter(c, LogOptions{DiffCommonOptions: opts.DiffCommonOptions, PrettyOptions: opts.PrettyOptions}, os.Stdout)
+	if err != nil {
+		return err
+	}
 	for _, commit := range commitIds {
-		output, err := opts.Format.FormatCommit(c, commit)
+		parents, err := commit.Parents(c)
+		if err != nil {
+			return err
+		}
+		if len(parents) > 1 && opts.HasDiffOutput() {
+			diffOpts := opts.DiffCommonOptions
+			if diffOpts.DiffMerges == "" {
+				diffOpts.DiffMerges = "dense-combined"
+			}
+			diffShown, err := WriteMergeDiff(c, diffOpts, commit, nil, lw.DiffWriter(), func(from *CommitID) error {
+				return lw.WriteCommit(commit, from, true)
+			})
+			if err != nil {
+				return err
+			}
+			if !diffShown {
+				if err := lw.WriteCommit(commit, nil, false); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if !opts.HasDiffOutput() {
+			if err := lw.WriteCommit(commit, nil, false); err != nil {
+				return err
+			}
+			continue
+		}
+		diffs, err := CommitDiff(c, opts.DiffCommonOptions, commit, nil)
 		if err != nil {
 			return err
 		}
-		fmt.Printf("%v", output)
+		if err := lw.WriteCommit(commit, nil, len(diffs) > 0); err != nil {
+			return err
+		}
+		if err := GeneratePatch(c, opts.DiffCommonOptions, diffs, lw.DiffWriter()); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func formatCommitMedium(cmt CommitID, c *Client) (string, error) {
-	author, err := cmt.GetAuthor(c)
+// CommitDiff returns the changes made by cmt compared to its first parent,
+// or every file in cmt if it's a root commit. Only the files which match
+// paths are compared, or every file if there are none.
+func CommitDiff(c *Client, opts DiffCommonOptions, cmt CommitID, paths []string) ([]HashDiff, error) {
+	parents, err := cmt.Parents(c)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-
-	date, err := cmt.GetDate(c)
-	if err != nil {
-		return "", err
+	if len(parents) == 0 {
+		return DiffTree(c, &DiffTreeOptions{DiffCommonOptions: opts, Recurse: true, Root: true}, cmt, nil, paths)
 	}
+	return DiffTree(c, &DiffTreeOptions{DiffCommonOptions: opts, Recurse: true}, parents[0], cmt, paths)
+}
 
-	msg, err := cmt.GetCommitMessage(c)
+// FollowDiff returns the changes made to the file path by cmt compared to
+// its first parent, for following the history of the file across renames
+// from the newest commit to the oldest. If cmt created the file by renaming
+// or copying another one, it's shown as a rename or copy, and the name of
+// the other file is returned as the path to follow in the older commits.
+// Otherwise, path is returned.
+func FollowDiff(c *Client, opts DiffCommonOptions, cmt CommitID, path IndexPath) ([]HashDiff, IndexPath, error) {
+	opts.DetectRenames = true
+	diffs, err := CommitDiff(c, opts, cmt, nil)
 	if err != nil {
-		return "", err
+		return nil, "", err
 	}
-
-	// Headers
-	output := fmt.Sprintf("commit %v\nAuthor: %s\nDate: %v\n\n", cmt, author, date.Format("Mon Jan 2 15:04:05 2006 -0700"))
-
-	// Commit message body
-	lines := strings.Split(strings.TrimSpace(msg.String()), "\n")
-	for _, l := range lines {
-		output = fmt.Sprintf("%v    %v\n", output, l)
+	for _, d := range diffs {
+		if d.Name != path {
+			continue
+		}
+		if d.SrcName != "" && (d.Status == 'R' || d.Status == 'C') {
+			path = d.SrcName
+		}
+		return []HashDiff{d}, path, nil
 	}
-
-	return output, nil
+	return nil, path, nil
 }
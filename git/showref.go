@@ -2,9 +2,6 @@ package git
 
 import (
 	"fmt"
-	"io/ioutil"
-	"os"
-	"path/filepath"
 	"strings"
 )
 
@@ -109,7 +106,7 @@ func ShowRef(c *Client, opts ShowRefOptions, patterns []string) ([]Ref, error) {
 	if opts.Verify {
 		// If verify is specified, everything must be an exact match
 		for _, ref := range patterns {
-			if f := c.GitDir.File(File(ref)); !f.Exists() {
+			if _, err := c.Refs().ReadRef(ref); err != nil {
 				return nil, fmt.Errorf("fatal: '%v' - not a valid ref", ref)
 			}
 			r, err := parseRef(c, ref)
@@ -139,99 +136,27 @@ func ShowRef(c *Client, opts ShowRefOptions, patterns []string) ([]Ref, error) {
 		}
 	}
 	// FIXME: Include packed refs
-	if !opts.Heads && !opts.Tags {
-		err := filepath.Walk(c.GitDir.File("refs").String(),
-			func(path string, info os.FileInfo, err error) error {
-				if info.IsDir() {
-					return nil
-				}
-				refname := strings.TrimPrefix(path, c.GitDir.String())
-				ref, err := parseRef(c, refname)
-				if err != nil && err != InvalidCommit {
-					// Invalid commit can just mean we don't
-					// have a local copy of the commit, so
-					// we don't care for the purpose of show-ref
-					return err
-				}
-				if len(patterns) == 0 {
-
-					vals = append(vals, ref)
-					deref, err := getDeref(c, opts, ref)
-					if err != nil {
-						return err
-					}
-					if deref != nil {
-						vals = append(vals, *deref)
-					}
-					return nil
-				}
-				for _, p := range patterns {
-					if ref.Matches(p) {
-						vals = append(vals, ref)
-						deref, err := getDeref(c, opts, ref)
-						if err != nil {
-							return err
-						}
-						if deref != nil {
-							vals = append(vals, *deref)
-						}
-						return nil
-					}
-				}
-				return nil
-			},
-		)
-		if err != nil {
-			return nil, err
-		}
-		return vals, nil
-	}
+	var prefixes []string
 	if opts.Heads {
-		heads, err := ioutil.ReadDir(c.GitDir.File("refs/heads").String())
-		if err != nil {
-			return nil, err
-		}
-		for _, ref := range heads {
-			refname := "refs/heads/" + ref.Name()
-			ref, err := parseRef(c, refname)
-			if err != nil {
-				return nil, err
-			}
-			if len(patterns) == 0 {
-				vals = append(vals, ref)
-				deref, err := getDeref(c, opts, ref)
-				if err != nil {
-					return nil, err
-				}
-				if deref != nil {
-					vals = append(vals, *deref)
-				}
-				continue
-			}
-			for _, p := range patterns {
-				if ref.Matches(p) {
-					vals = append(vals, ref)
-					deref, err := getDeref(c, opts, ref)
-					if err != nil {
-						return nil, err
-					}
-					if deref != nil {
-						vals = append(vals, *deref)
-					}
-					break
-				}
-			}
-		}
+		prefixes = append(prefixes, "refs/heads/")
 	}
 	if opts.Tags {
-		tags, err := ioutil.ReadDir(c.GitDir.File("refs/tags").String())
+		prefixes = append(prefixes, "refs/tags/")
+	}
+	if len(prefixes) == 0 {
+		prefixes = []string{"refs/"}
+	}
+	for _, prefix := range prefixes {
+		refnames, err := c.Refs().ListRefs(prefix)
 		if err != nil {
 			return nil, err
 		}
-		for _, ref := range tags {
-			refname := "refs/tags/" + ref.Name()
+		for _, refname := range refnames {
 			ref, err := parseRef(c, refname)
-			if err != nil {
+			if err != nil && err != InvalidCommit {
+				// Invalid commit can just mean we don't
+				// have a local copy of the commit, so
+				// we don't care for the purpose of show-ref
 				return nil, err
 			}
 			if len(patterns) == 0 {
@@ -260,17 +185,16 @@ func ShowRef(c *Client, opts ShowRefOptions, patterns []string) ([]Ref, error) {
 			}
 		}
 	}
-
 	return vals, nil
 }
 
 func parseRef(c *Client, filename string) (Ref, error) {
 	refname := strings.TrimPrefix(filename, "/")
-	data, err := ioutil.ReadFile(c.GitDir.File(File(refname)).String())
+	data, err := c.Refs().ReadRef(refname)
 	if err != nil {
 		return Ref{}, err
 	}
-	if strings.HasPrefix(string(data), "ref: ") {
+	if strings.HasPrefix(data, "ref: ") {
 		deref, err := SymbolicRefGet(c, SymbolicRefOptions{}, SymbolicRef(refname))
 		if err != nil {
 			return Ref{}, err
@@ -281,7 +205,7 @@ func parseRef(c *Client, filename string) (Ref, error) {
 		}
 		return Ref{refname, sha1}, nil
 	} else {
-		sha1, err := Sha1FromString(string(data))
+		sha1, err := Sha1FromString(data)
 		if err != nil {
 			return Ref{}, err
 		}
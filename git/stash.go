@@ -0,0 +1,810 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// errStashConflict is returned by applyStash when the stash doesn't apply
+// cleanly.
+var errStashConflict = errors.New("Stash had conflicts")
+
+// A stash is a commit whose tree is the state of the tracked files in
+// the work tree, with the HEAD commit that it was based on as its first
+// parent and a commit recording the state of the index as its second
+// parent, the same as git's stash. If untracked files were stashed, a
+// third parent with no parents of its own has a tree of the untracked
+// files. Stashes are kept in the reflog of refs/stash.
+
+// StashOptions are the options common to all stash subcommands.
+type StashOptions struct {
+	Quiet bool
+}
+
+// StashPushOptions are the options for saving changes with "git stash
+// push".
+type StashPushOptions struct {
+	StashOptions
+
+	// The description of the stash. The default is based on the
+	// HEAD commit.
+	Message string
+
+	// Also stash untracked files, and remove them from the work tree.
+	IncludeUntracked bool
+
+	// Leave the changes in the index alone, and only reset the
+	// work tree to match the index.
+	KeepIndex bool
+
+	// Interactively select hunks of the changes in the work tree to
+	// stash.
+	Patch bool
+}
+
+// StashApplyOptions are the options for "git stash apply" and "git stash
+// pop".
+type StashApplyOptions struct {
+	StashOptions
+
+	// Restore the changes in the index as well as the work tree.
+	Index bool
+}
+
+// StashShowOptions are the options for "git stash show".
+type StashShowOptions struct {
+	// Show a patch instead of a diffstat.
+	Patch bool
+
+	// Include the untracked files in the stash.
+	IncludeUntracked bool
+}
+
+// StashPush saves the local changes to the files matching files (or all
+// files if empty) in a new stash and reverts them to HEAD.
+func StashPush(c *Client, opts StashPushOptions, files []File) error {
+	if opts.Patch {
+		return stashPatch(c, opts, files)
+	}
+	stash, err := createStash(c, opts, files)
+	if err != nil {
+		return err
+	}
+	if stash == (CommitID{}) {
+		if !opts.Quiet {
+			fmt.Println("No local changes to save")
+		}
+		return nil
+	}
+	msg, err := stash.GetCommitMessage(c)
+	if err != nil {
+		return err
+	}
+	if err := storeStash(c, stash, msg.Subject()); err != nil {
+		return err
+	}
+	if !opts.Quiet {
+		fmt.Printf("Saved working directory and index state %v\n", msg.Subject())
+	}
+
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		return err
+	}
+	changed, err := stashChangedPaths(c, head, files)
+	if err != nil {
+		return err
+	}
+	if err := stashReset(c, head, changed, !opts.KeepIndex, true); err != nil {
+		return err
+	}
+
+	// Remove the untracked files which were saved, too.
+	parents, err := stash.Parents(c)
+	if err != nil {
+		return err
+	}
+	if len(parents) < 3 {
+		return nil
+	}
+	untracked, err := GetIndexMap(c, parents[2])
+	if err != nil {
+		return err
+	}
+	for path := range untracked {
+		f, err := path.FilePath(c)
+		if err != nil {
+			return err
+		}
+		if err := removeFileClean(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stashPatch implements StashPush with the Patch option. The selected
+// hunks of the changes in the work tree are stashed along with the index,
+// and then removed from the work tree.
+func stashPatch(c *Client, opts StashPushOptions, files []File) error {
+	if err := refreshIndex(c); err != nil {
+		return err
+	}
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		return err
+	}
+	idx, err := c.GitDir.ReadIndex()
+	if err != nil {
+		return err
+	}
+	if len(idx.GetUnmerged()) > 0 {
+		return fmt.Errorf("Cannot save the current index state")
+	}
+	indexTree, err := WriteTreeFromIndex(c, idx, WriteTreeOptions{})
+	if err != nil {
+		return err
+	}
+
+	diffs, err := DiffFiles(c, DiffFilesOptions{}, files)
+	if err != nil {
+		return err
+	}
+	var patchbuf bytes.Buffer
+	if err := GeneratePatch(c, DiffCommonOptions{Patch: true}, diffs, &patchbuf); err != nil {
+		return err
+	}
+	hunks, err := splitPatch(patchbuf.String(), false)
+	if err != nil {
+		return err
+	}
+	hunks, err = filterHunks("stash this hunk", hunks)
+	if err != nil && err != userAborted {
+		return err
+	}
+	if len(hunks) == 0 {
+		return fmt.Errorf("No changes selected")
+	}
+
+	patch, err := ioutil.TempFile("", "stashpatch")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(patch.Name())
+	recombinePatch(patch, hunks)
+	patch.Close()
+
+	// Apply the patch to the index to get the tree to stash, then
+	// put the index back the way it was.
+	origIndex, err := c.GitDir.ReadFile("index")
+	if err != nil {
+		return err
+	}
+	if err := Apply(c, ApplyOptions{Cached: true}, []File{File(patch.Name())}); err != nil {
+		return err
+	}
+	patched, err := c.GitDir.ReadIndex()
+	if err != nil {
+		return err
+	}
+	workTree, err := WriteTreeFromIndex(c, patched, WriteTreeOptions{})
+	if err != nil {
+		return err
+	}
+	if err := c.GitDir.WriteFile("index", origIndex, 0644); err != nil {
+		return err
+	}
+
+	stash, err := writeStash(c, head, opts.Message, indexTree, workTree, TreeID{})
+	if err != nil {
+		return err
+	}
+	msg, err := stash.GetCommitMessage(c)
+	if err != nil {
+		return err
+	}
+	if err := storeStash(c, stash, msg.Subject()); err != nil {
+		return err
+	}
+	if !opts.Quiet {
+		fmt.Printf("Saved working directory and index state %v\n", msg.Subject())
+	}
+	if err := Apply(c, ApplyOptions{Reverse: true}, []File{File(patch.Name())}); err != nil {
+		return err
+	}
+	if opts.KeepIndex {
+		return nil
+	}
+	changed, err := stashChangedPaths(c, head, files)
+	if err != nil {
+		return err
+	}
+	return stashReset(c, head, changed, true, false)
+}
+
+// createStash saves the changes in the index and work tree relative to
+// HEAD for the files matching files as a stash commit, without changing
+// anything. If there are no changes it returns the zero CommitID.
+func createStash(c *Client, opts StashPushOptions, files []File) (CommitID, error) {
+	if err := refreshIndex(c); err != nil {
+		return CommitID{}, err
+	}
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		return CommitID{}, err
+	}
+	idx, err := c.GitDir.ReadIndex()
+	if err != nil {
+		return CommitID{}, err
+	}
+	if len(idx.GetUnmerged()) > 0 {
+		return CommitID{}, fmt.Errorf("Cannot save the current index state")
+	}
+	indexTree, err := WriteTreeFromIndex(c, idx, WriteTreeOptions{})
+	if err != nil {
+		return CommitID{}, err
+	}
+	paths, err := stashChangedPaths(c, head, files)
+	if err != nil {
+		return CommitID{}, err
+	}
+
+	// Update a copy of the index with the files in the work tree to
+	// get the work tree's tree. The real index isn't touched.
+	changed, err := DiffFiles(c, DiffFilesOptions{}, files)
+	if err != nil {
+		return CommitID{}, err
+	}
+	for _, diff := range changed {
+		f, err := diff.Name.FilePath(c)
+		if err != nil {
+			return CommitID{}, err
+		}
+		if !f.Exists() {
+			idx.RemoveFile(diff.Name)
+			continue
+		}
+		if err := idx.AddFile(c, f, UpdateIndexOptions{Add: true}); err != nil {
+			return CommitID{}, err
+		}
+	}
+	workTree, err := WriteTreeFromIndex(c, idx, WriteTreeOptions{})
+	if err != nil {
+		return CommitID{}, err
+	}
+
+	var untrackedTree TreeID
+	if opts.IncludeUntracked {
+		lsfiles := files
+		if len(lsfiles) == 0 {
+			lsfiles = []File{File(c.WorkDir)}
+		}
+		untracked, err := LsFiles(c, LsFilesOptions{Others: true, ExcludeStandard: true}, lsfiles)
+		if err != nil {
+			return CommitID{}, err
+		}
+		if len(untracked) > 0 {
+			uidx := NewIndex()
+			for _, u := range untracked {
+				f, err := u.PathName.FilePath(c)
+				if err != nil {
+					return CommitID{}, err
+				}
+				if err := uidx.AddFile(c, f, UpdateIndexOptions{Add: true}); err != nil {
+					return CommitID{}, err
+				}
+			}
+			if untrackedTree, err = WriteTreeFromIndex(c, uidx, WriteTreeOptions{}); err != nil {
+				return CommitID{}, err
+			}
+		}
+	}
+
+	if len(paths) == 0 && untrackedTree == (TreeID{}) {
+		return CommitID{}, nil
+	}
+	return writeStash(c, head, opts.Message, indexTree, workTree, untrackedTree)
+}
+
+// stashChangedPaths returns the paths matching files which differ between
+// head, the index and the work tree.
+func stashChangedPaths(c *Client, head CommitID, files []File) ([]IndexPath, error) {
+	// DiffIndex doesn't limit the index to files, so compare the
+	// matching entries of the index and tree directly.
+	lsfiles := files
+	if len(lsfiles) == 0 {
+		lsfiles = []File{File(c.WorkDir)}
+	}
+	indexFiles, err := LsFiles(c, LsFilesOptions{Cached: true}, lsfiles)
+	if err != nil {
+		return nil, err
+	}
+	treeFiles, err := LsTree(c, LsTreeOptions{Recurse: true, FullTree: len(files) == 0}, head, files)
+	if err != nil {
+		return nil, err
+	}
+	unstaged, err := DiffFiles(c, DiffFilesOptions{}, files)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := make(map[IndexPath]*IndexEntry)
+	for _, e := range treeFiles {
+		tree[e.PathName] = e
+	}
+	seen := make(map[IndexPath]bool)
+	var paths []IndexPath
+	add := func(path IndexPath) {
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	for _, e := range indexFiles {
+		if !sameEntry(tree[e.PathName], e.IndexEntry) {
+			add(e.PathName)
+		}
+		delete(tree, e.PathName)
+	}
+	for path := range tree {
+		add(path)
+	}
+	for _, d := range unstaged {
+		add(d.Name)
+	}
+	return paths, nil
+}
+
+// writeStash creates the commits for a stash of the trees based on head.
+// If untrackedTree is the zero TreeID, the stash doesn't have untracked
+// files.
+func writeStash(c *Client, head CommitID, message string, indexTree, workTree, untrackedTree TreeID) (CommitID, error) {
+	branch := c.GetHeadBranch().BranchName()
+	if branch == "" {
+		branch = "(no branch)"
+	}
+	msg, err := head.GetCommitMessage(c)
+	if err != nil {
+		return CommitID{}, err
+	}
+	base := fmt.Sprintf("%v: %v %v", branch, head.String()[:7], msg.Subject())
+	if message == "" {
+		message = "WIP on " + base
+	} else {
+		message = fmt.Sprintf("On %v: %v", branch, message)
+	}
+
+	indexCommit, err := CommitTree(c, CommitTreeOptions{}, indexTree, []CommitID{head}, "index on "+base+"\n")
+	if err != nil && err != NoGlobalConfig {
+		return CommitID{}, err
+	}
+	parents := []CommitID{head, indexCommit}
+	if untrackedTree != (TreeID{}) {
+		untracked, err := CommitTree(c, CommitTreeOptions{}, untrackedTree, nil, "untracked files on "+base+"\n")
+		if err != nil && err != NoGlobalConfig {
+			return CommitID{}, err
+		}
+		parents = append(parents, untracked)
+	}
+	stash, err := CommitTree(c, CommitTreeOptions{}, workTree, parents, message+"\n")
+	if err != nil && err != NoGlobalConfig {
+		return CommitID{}, err
+	}
+	return stash, nil
+}
+
+// stashReset reverts paths to head after they've been stashed. If
+// resetIndex is not set, the index is left alone, and if resetWorkTree is
+// set the work tree is reverted to match the index.
+func stashReset(c *Client, head CommitID, paths []IndexPath, resetIndex, resetWorkTree bool) error {
+	headMap, err := GetIndexMap(c, head)
+	if err != nil {
+		return err
+	}
+	idx, err := c.GitDir.ReadIndex()
+	if err != nil {
+		return err
+	}
+	entries := idx.GetMap()
+	for _, path := range paths {
+		if resetIndex {
+			if e, ok := headMap[path]; ok {
+				entries[path] = e
+			} else {
+				delete(entries, path)
+			}
+		}
+		if !resetWorkTree {
+			continue
+		}
+		if e, ok := entries[path]; ok {
+			if err := checkoutFile(c, e, CheckoutIndexOptions{Force: true, UpdateStat: true}); err != nil {
+				return err
+			}
+			continue
+		}
+		f, err := path.FilePath(c)
+		if err != nil {
+			return err
+		}
+		if f.Exists() {
+			if err := removeFileClean(f); err != nil {
+				return err
+			}
+		}
+	}
+	return writeIndexEntries(c, idx, entries)
+}
+
+// writeIndexEntries replaces the entries of idx with entries and writes
+// it to disk.
+func writeIndexEntries(c *Client, idx *Index, entries IndexMap) error {
+	idx.Objects = idx.Objects[:0]
+	for _, e := range entries {
+		idx.Objects = append(idx.Objects, e)
+	}
+	sort.Sort(ByPath(idx.Objects))
+	idx.NumberIndexEntries = uint32(len(idx.Objects))
+	f, err := c.GitDir.Create("index")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return idx.WriteIndex(f)
+}
+
+// storeStash adds stash to the stash list with the given reflog message.
+func storeStash(c *Client, stash CommitID, message string) error {
+	return UpdateRef(c, UpdateRefOptions{CreateReflog: true}, "refs/stash", stash, message)
+}
+
+// stashList returns the entries of the stash list, newest first.
+func stashList(c *Client) ([]ReflogEntry, error) {
+	if !c.Refs().ReflogExists("refs/stash") {
+		return nil, nil
+	}
+	entries, err := c.Refs().ReadReflog("refs/stash")
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// resolveStash returns the commit that ref refers to. ref may be empty
+// for the latest stash, stash@{n}, n, or any commit which looks like a
+// stash. If ref is in the stash list, its position is also returned,
+// otherwise the position is -1.
+func resolveStash(c *Client, ref string) (CommitID, int, error) {
+	n := -1
+	name := strings.TrimPrefix(ref, "refs/")
+	switch {
+	case ref == "", name == "stash":
+		n = 0
+	case strings.HasPrefix(name, "stash@{") && strings.HasSuffix(name, "}"):
+		i, err := strconv.Atoi(name[len("stash@{") : len(name)-1])
+		if err != nil || i < 0 {
+			return CommitID{}, -1, fmt.Errorf("%v is not a valid reference", ref)
+		}
+		n = i
+	default:
+		if i, err := strconv.Atoi(ref); err == nil && i >= 0 {
+			n = i
+		}
+	}
+	if n < 0 {
+		cmt, err := RevParseCommitish(c, &RevParseOptions{}, ref)
+		if err != nil {
+			return CommitID{}, -1, err
+		}
+		id, err := cmt.CommitID(c)
+		return id, -1, err
+	}
+
+	entries, err := stashList(c)
+	if err != nil {
+		return CommitID{}, -1, err
+	}
+	if len(entries) == 0 {
+		return CommitID{}, -1, fmt.Errorf("No stash entries found.")
+	}
+	if n >= len(entries) {
+		return CommitID{}, -1, fmt.Errorf("stash@{%d} is not a valid reference", n)
+	}
+	return CommitID(entries[n].New), n, nil
+}
+
+// stashRefName returns the name to use for the stash at position n in
+// messages, based on how the user referred to it.
+func stashRefName(ref string, n int) string {
+	if ref == "" {
+		return fmt.Sprintf("refs/stash@{%d}", n)
+	}
+	if _, err := strconv.Atoi(ref); err == nil {
+		return fmt.Sprintf("stash@{%d}", n)
+	}
+	return ref
+}
+
+// StashList returns the reflog entries of the stashes, newest first. The
+// entry at position n is stash@{n}.
+func StashList(c *Client) ([]ReflogEntry, error) {
+	return stashList(c)
+}
+
+// StashShow shows the changes recorded in a stash relative to the commit
+// it was based on.
+func StashShow(c *Client, opts StashShowOptions, ref string) error {
+	stash, _, err := resolveStash(c, ref)
+	if err != nil {
+		return err
+	}
+	parents, err := stash.Parents(c)
+	if err != nil {
+		return err
+	}
+	if len(parents) < 2 {
+		return fmt.Errorf("%v is not a stash-like commit", stash)
+	}
+	diffs, err := DiffTree(c, &DiffTreeOptions{Recurse: true}, parents[0], stash, nil)
+	if err != nil {
+		return err
+	}
+	if opts.IncludeUntracked && len(parents) > 2 {
+		untracked, err := DiffTree(c, &DiffTreeOptions{Recurse: true, Root: true}, parents[2], nil, nil)
+		if err != nil {
+			return err
+		}
+		diffs = append(diffs, untracked...)
+		sort.Sort(ByName(diffs))
+	}
+	if opts.Patch {
+		return GeneratePatch(c, DiffCommonOptions{Patch: true, NumContextLines: 3}, diffs, os.Stdout)
+	}
+	stats, err := diffStats(c, diffs)
+	if err != nil {
+		return err
+	}
+	writeDiffStat(os.Stdout, stats, 80, 0, 0, 0)
+	return nil
+}
+
+// StashApply applies the changes in a stash to the work tree.
+func StashApply(c *Client, opts StashApplyOptions, ref string) error {
+	stash, _, err := resolveStash(c, ref)
+	if err != nil {
+		return err
+	}
+	return applyStash(c, stash, opts)
+}
+
+// StashPop applies the changes in a stash to the work tree and removes it
+// from the stash list. If it doesn't apply cleanly, it's kept in the list.
+func StashPop(c *Client, opts StashApplyOptions, ref string) error {
+	stash, n, err := resolveStash(c, ref)
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return fmt.Errorf("%v is not a stash reference", ref)
+	}
+	if err := applyStash(c, stash, opts); err != nil {
+		if err == errStashConflict {
+			return fmt.Errorf("The stash entry is kept in case you need it again.")
+		}
+		return err
+	}
+	if err := dropStash(c, n); err != nil {
+		return err
+	}
+	if !opts.Quiet {
+		fmt.Printf("Dropped %v (%v)\n", stashRefName(ref, n), stash)
+	}
+	return nil
+}
+
+// StashDrop removes a stash from the stash list.
+func StashDrop(c *Client, opts StashOptions, ref string) error {
+	stash, n, err := resolveStash(c, ref)
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return fmt.Errorf("%v is not a stash reference", ref)
+	}
+	if err := dropStash(c, n); err != nil {
+		return err
+	}
+	if !opts.Quiet {
+		fmt.Printf("Dropped %v (%v)\n", stashRefName(ref, n), stash)
+	}
+	return nil
+}
+
+// StashClear removes all the stashes.
+func StashClear(c *Client) error {
+	if _, err := c.Refs().ReadRef("refs/stash"); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return c.Refs().DeleteRef("refs/stash")
+}
+
+// dropStash removes stash@{n} from the reflog of refs/stash, updating the
+// ref if it was the latest one.
+func dropStash(c *Client, n int) error {
+	entries, err := c.Refs().ReadReflog("refs/stash")
+	if err != nil {
+		return err
+	}
+	i := len(entries) - 1 - n
+	if i < 0 || i >= len(entries) {
+		return fmt.Errorf("stash@{%d} is not a valid reference", n)
+	}
+	entries = append(entries[:i], entries[i+1:]...)
+	if len(entries) == 0 {
+		return c.Refs().DeleteRef("refs/stash")
+	}
+	// Keep the reflog consistent, so that each entry's old value is
+	// the previous entry's new value.
+	if i < len(entries) {
+		if i == 0 {
+			entries[i].Old = Sha1{}
+		} else {
+			entries[i].Old = entries[i-1].New
+		}
+	}
+	if err := c.Refs().WriteReflog("refs/stash", entries); err != nil {
+		return err
+	}
+	if n == 0 {
+		return c.Refs().WriteRef("refs/stash", entries[len(entries)-1].New.String(), nil)
+	}
+	return nil
+}
+
+// applyStash merges the changes saved in stash into the work tree, using
+// the current index as our side of the merge. Unless opts.Index is set,
+// files which were modified are left unstaged, while files which were
+// added are added to the index. If the changes conflict, the conflicts
+// are left in the index and work tree and errStashConflict is returned.
+func applyStash(c *Client, stash CommitID, opts StashApplyOptions) error {
+	parents, err := stash.Parents(c)
+	if err != nil {
+		return err
+	}
+	if len(parents) < 2 {
+		return fmt.Errorf("%v is not a stash-like commit", stash)
+	}
+	idx, err := c.GitDir.ReadIndex()
+	if err != nil {
+		return err
+	}
+	if len(idx.GetUnmerged()) > 0 {
+		return fmt.Errorf("Cannot apply a stash in the middle of a merge")
+	}
+	ours, err := WriteTreeFromIndex(c, idx, WriteTreeOptions{})
+	if err != nil {
+		return err
+	}
+
+	var untracked IndexMap
+	if len(parents) > 2 {
+		if untracked, err = GetIndexMap(c, parents[2]); err != nil {
+			return err
+		}
+		for path := range untracked {
+			f, err := path.FilePath(c)
+			if err != nil {
+				return err
+			}
+			if f.Exists() {
+				return fmt.Errorf("%v already exists, no checkout\nCould not restore untracked files from stash", path)
+			}
+		}
+	}
+
+	mopts := mergeTreeOptions{
+		contentMergeOptions: contentMergeOptions{
+			OursLabel:   "Updated upstream",
+			TheirsLabel: "Stashed changes",
+			Diff3:       c.GetConfig("merge.conflictstyle") == "diff3",
+		},
+	}
+	var indexResult *treeMergeResult
+	if opts.Index {
+		baseTree, err := parents[0].TreeID(c)
+		if err != nil {
+			return err
+		}
+		indexTree, err := parents[1].TreeID(c)
+		if err != nil {
+			return err
+		}
+		if baseTree != indexTree {
+			indexResult, err = mergeCommitsWithBases(c, mopts, []CommitID{parents[0]}, ours, parents[1])
+			if err != nil {
+				return err
+			}
+			if !indexResult.Clean() {
+				return fmt.Errorf("Conflicts in index. Try without --index.")
+			}
+		}
+	}
+
+	result, err := mergeCommitsWithBases(c, mopts, []CommitID{parents[0]}, ours, stash)
+	if err != nil {
+		return err
+	}
+	if err := applyMergeResult(c, ours, result, "merge"); err != nil {
+		return err
+	}
+	if !opts.Quiet {
+		for _, m := range result.Messages {
+			fmt.Println(m)
+		}
+	}
+	for _, e := range untracked {
+		if err := checkoutFile(c, e, CheckoutIndexOptions{}); err != nil {
+			return err
+		}
+	}
+	if !result.Clean() {
+		return errStashConflict
+	}
+
+	// applyMergeResult staged everything. Unless the index is being
+	// restored, only new files should stay that way.
+	merged, err := c.GitDir.ReadIndex()
+	if err != nil {
+		return err
+	}
+	current := merged.GetMap()
+	var want IndexMap
+	if indexResult != nil {
+		want = indexResult.Index.GetMap()
+	} else {
+		want = idx.GetMap()
+		for path, e := range current {
+			if _, ok := want[path]; !ok {
+				want[path] = e
+			}
+		}
+	}
+	for path, e := range want {
+		// Keep the stat info of entries that didn't change.
+		if cur, ok := current[path]; ok && sameEntry(cur, e) {
+			want[path] = cur
+		}
+	}
+	return writeIndexEntries(c, merged, want)
+}
+
+// applyAutostash applies the stash that was created for a command's
+// --autostash option. If it can't be applied cleanly, it's saved in the
+// stash list instead so that the changes aren't lost.
+func applyAutostash(c *Client, stash CommitID) error {
+	switch err := applyStash(c, stash, StashApplyOptions{}); err {
+	case nil:
+		fmt.Fprintln(os.Stderr, "Applied autostash.")
+		return nil
+	case errStashConflict:
+		if err := storeStash(c, stash, "autostash"); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "Applying autostash resulted in conflicts.\nYour changes are safe in the stash.\nYou can run \"dgit stash pop\" or \"dgit stash drop\" at any time.")
+		return nil
+	default:
+		return err
+	}
+}
@@ -0,0 +1,171 @@
+package git
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestStash(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo.txt": "foo\n"},
+		map[string]string{"bar.txt": "bar\n"},
+		map[string]string{"baz.txt": "baz\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	head, err := c.GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("foo.txt", []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("new.txt", []byte("new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Add(c, AddOptions{}, []File{"new.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("untracked.txt", []byte("untracked\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := StashPush(c, StashPushOptions{StashOptions: StashOptions{Quiet: true}, IncludeUntracked: true}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := ioutil.ReadFile("foo.txt"); string(content) != "foo\n" {
+		t.Errorf("Unexpected content after stash: got %q", content)
+	}
+	if File("new.txt").Exists() || File("untracked.txt").Exists() {
+		t.Error("Stashed files left in work tree")
+	}
+	entries, err := StashList(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Message != "WIP on master: "+head.String()[:7]+" ours" {
+		t.Fatalf("Unexpected stash list: %v", entries)
+	}
+	stash := CommitID(entries[0].New)
+	if parents, _ := stash.Parents(c); len(parents) != 3 || parents[0] != head {
+		t.Errorf("Unexpected stash parents: %v", parents)
+	}
+
+	if err := StashPop(c, StashApplyOptions{StashOptions: StashOptions{Quiet: true}}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := ioutil.ReadFile("foo.txt"); string(content) != "changed\n" {
+		t.Errorf("Unexpected content after pop: got %q", content)
+	}
+	if content, _ := ioutil.ReadFile("untracked.txt"); string(content) != "untracked\n" {
+		t.Errorf("Unexpected untracked content after pop: got %q", content)
+	}
+	idx, err := c.GitDir.ReadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := idx.GetMap()
+	if _, ok := m["new.txt"]; !ok {
+		t.Error("New file not staged after pop")
+	}
+	if _, ok := m["untracked.txt"]; ok {
+		t.Error("Untracked file staged after pop")
+	}
+	if e := m["foo.txt"]; e == nil || e.PathName.IsClean(c, e.Sha1) {
+		t.Error("Modified file staged after pop")
+	}
+	if entries, _ := StashList(c); len(entries) != 0 {
+		t.Errorf("Stash not dropped by pop: %v", entries)
+	}
+}
+
+func TestStashConflict(t *testing.T) {
+	c, dir := testMergeSetup(t,
+		map[string]string{"foo.txt": "foo\n"},
+		map[string]string{"foo.txt": "ours\n"},
+		map[string]string{"bar.txt": "bar\n"},
+	)
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile("foo.txt", []byte("first\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := StashPush(c, StashPushOptions{StashOptions: StashOptions{Quiet: true}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("foo.txt", []byte("second\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := StashPush(c, StashPushOptions{StashOptions: StashOptions{Quiet: true}, Message: "second"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := StashList(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Message != "On master: second" {
+		t.Fatalf("Unexpected stash list: %v", entries)
+	}
+
+	if err := ioutil.WriteFile("foo.txt", []byte("third\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Add(c, AddOptions{}, []File{"foo.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Commit(c, CommitOptions{}, "third", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := StashPop(c, StashApplyOptions{StashOptions: StashOptions{Quiet: true}}, "stash@{1}"); err == nil {
+		t.Fatal("Expected conflicting pop to fail")
+	}
+	idx, err := c.GitDir.ReadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.GetUnmerged()) == 0 {
+		t.Error("No conflict recorded in index")
+	}
+	if entries, _ := StashList(c); len(entries) != 2 {
+		t.Errorf("Conflicting stash was dropped: %v", entries)
+	}
+
+	if err := StashDrop(c, StashOptions{Quiet: true}, "stash@{1}"); err != nil {
+		t.Fatal(err)
+	}
+	entries, err = StashList(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Message != "On master: second" {
+		t.Errorf("Unexpected stash list after drop: %v", entries)
+	}
+	if err := StashDrop(c, StashOptions{Quiet: true}, "stash@{1}"); err == nil {
+		t.Error("Expected drop of invalid stash to fail")
+	}
+	if err := StashClear(c); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := StashList(c); len(entries) != 0 {
+		t.Errorf("Stash list not cleared: %v", entries)
+	}
+}
+
+func TestWriteDiffStat(t *testing.T) {
+	var buf bytes.Buffer
+	writeDiffStat(&buf, []diffStat{
+		{Name: "dir/bar.txt", Added: 10},
+		{Name: "foo.txt", Added: 2, Deleted: 1},
+		{Name: "image.png", Added: 20, Binary: true},
+	}, 80, 0, 0, 0)
+	want := ` dir/bar.txt |  10 ++++++++++
+ foo.txt     |   3 ++-
+ image.png   | Bin 0 -> 20 bytes
+ 3 files changed, 12 insertions(+), 1 deletion(-)
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Unexpected diffstat: got\n%v\nwant\n%v", got, want)
+	}
+}
@@ -36,9 +36,7 @@ type SymbolicRefOptions struct {
 // Gets a RefSpec for a symbolic ref. Returns "" if symname is not a valid
 // symbolic ref.
 func SymbolicRefGet(c *Client, opts SymbolicRefOptions, symname SymbolicRef) (RefSpec, error) {
-	file := c.GitDir.File(File(symname))
-
-	value, err := file.ReadAll()
+	value, err := c.Refs().ReadRef(symname.String())
 	if err != nil {
 		return "", err
 	}
@@ -53,33 +51,34 @@ func SymbolicRefGet(c *Client, opts SymbolicRefOptions, symname SymbolicRef) (Re
 }
 
 func SymbolicRefDelete(c *Client, opts SymbolicRefOptions, symname SymbolicRef) error {
-	file := c.GitDir.File(File(symname))
-	if !file.Exists() {
+	if _, err := c.Refs().ReadRef(symname.String()); err != nil {
 		return fmt.Errorf("SymbolicRef %s does not exist.", symname)
 	}
-	return file.Remove()
-
+	return c.Refs().DeleteRef(symname.String())
 }
 
 func SymbolicRefUpdate(c *Client, opts SymbolicRefOptions, symname SymbolicRef, refvalue RefSpec, reason string) error {
 	if !strings.HasPrefix(refvalue.String(), "refs/") {
 		return fmt.Errorf("Refusing to point %s outside of refs/", symname)
 	}
+	if err := validateRefName(symname.String()); err != nil {
+		return fmt.Errorf("Refusing to update ref with bad name '%v'", symname)
+	}
+	if err := validateRefName(refvalue.String()); err != nil {
+		return fmt.Errorf("Refusing to set %v to invalid ref '%v'", symname, refvalue)
+	}
 
+	var entry *ReflogEntry
 	if reason != "" {
-		if reflog := c.GitDir.File(File("logs/" + symname.String())); reflog.Exists() {
-			if err := updateReflog(c, false, reflog, symname, refvalue, reason); err != nil {
-				return fmt.Errorf("Error updating reflog: %v", err)
-			}
+		e, err := newReflogEntry(c, false, symname.String(), symname, refvalue, reason)
+		if err != nil {
+			return fmt.Errorf("Error updating reflog: %v", err)
 		}
+		entry = e
 	}
 
-	file, err := c.GitDir.Create(File(symname))
-	if err != nil {
+	if err := c.Refs().WriteRef(symname.String(), "ref: "+refvalue.String(), entry); err != nil {
 		return fmt.Errorf("Error creating SymbolicRef: %v", err)
 	}
-	defer file.Close()
-
-	fmt.Fprintf(file, "ref: %s", refvalue)
 	return nil
 }
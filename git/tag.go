@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -22,46 +23,250 @@ type TagOptions struct {
 
 	// Delete the given tag
 	Delete bool
+
+	// The number of lines of the annotation to print when listing
+	// tags. If 0, only the tag name is printed.
+	Lines int
+
+	// Only list tags which contain all of Contains, and none of
+	// NoContains.
+	Contains, NoContains []Commitish
+
+	// Only list tags which point at one of the objects in PointsAt,
+	// either directly or by an annotated tag.
+	PointsAt []Sha1
+
+	// The key to sort tags by. One of refname, version:refname (or
+	// v:refname), creatordate, taggerdate or objectname, optionally
+	// prefixed with "-" to reverse the order.
+	Sort string
+
+	// A format string to use for listing tags, as for FormatRef.
+	Format string
 }
 
 // List tags, if tagnames is specified only list tags which match one
-// of the patterns provided.
+// of the patterns provided. The lines that should be printed for each
+// tag are returned.
 func TagList(c *Client, opts TagOptions, patterns []string) ([]string, error) {
-	if len(patterns) != 0 {
-		return nil, fmt.Errorf("Tag list with patterns not implemented")
+	refnames, err := c.Refs().ListRefs("refs/tags/")
+	if err != nil {
+		return nil, err
 	}
 
-	files := []string{}
+	var tags []Ref
+	for _, refname := range refnames {
+		name := strings.TrimPrefix(refname, "refs/tags/")
+		if !tagMatches(name, patterns, opts.IgnoreCase) {
+			continue
+		}
+		ref, err := parseRef(c, refname)
+		if err != nil {
+			return nil, err
+		}
+		if ok, err := tagFilter(c, opts, ref); err != nil {
+			return nil, err
+		} else if ok {
+			tags = append(tags, ref)
+		}
+	}
+	if err := sortTags(c, opts, tags); err != nil {
+		return nil, err
+	}
 
-	err := filepath.Walk(filepath.Join(c.GitDir.String(), "refs", "tags"),
-		func(path string, info os.FileInfo, err error) error {
+	var lines []string
+	for _, tag := range tags {
+		name := strings.TrimPrefix(tag.Name, "refs/tags/")
+		switch {
+		case opts.Format != "":
+			line, err := FormatRef(c, tag, opts.Format)
 			if err != nil {
-				return err
+				return nil, err
 			}
-			if !info.IsDir() {
-				files = append(files, path)
+			lines = append(lines, line)
+		case opts.Lines > 0:
+			obj, err := loadRefObject(c, tag.Value)
+			if err != nil {
+				return nil, err
 			}
-			return nil
-		})
-	if err != nil {
-		return nil, err
+			msg := messageLines(obj.message, opts.Lines)
+			line := fmt.Sprintf("%-15s %s", name, strings.Join(msg, "\n    "))
+			lines = append(lines, strings.TrimRight(line, " "))
+		default:
+			lines = append(lines, name)
+		}
+	}
+	return lines, nil
+}
+
+// tagMatches returns whether the tag name matches one of the glob
+// patterns. If there are no patterns, every tag matches.
+func tagMatches(name string, patterns []string, ignoreCase bool) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	if ignoreCase {
+		name = strings.ToLower(name)
 	}
+	for _, p := range patterns {
+		if ignoreCase {
+			p = strings.ToLower(p)
+		}
+		if m, _ := filepath.Match(p, name); m {
+			return true
+		}
+	}
+	return false
+}
 
-	var tags []string
-	for _, f := range files {
-		tags = append(tags, f[len(c.GitDir.String())+len("/refs/tags/"):])
+// tagFilter returns whether the tag ref passes the --contains and
+// --points-at filters of opts.
+func tagFilter(c *Client, opts TagOptions, ref Ref) (bool, error) {
+	if len(opts.PointsAt) > 0 {
+		// An annotated tag points at both the tag object and the
+		// object which was tagged.
+		pointsTo := []Sha1{ref.Value}
+		if ref.Value.Type(c) == "tag" {
+			tag, err := c.GetTagObject(ref.Value)
+			if err != nil {
+				return false, err
+			}
+			if obj, err := Sha1FromString(tag.GetHeader("object")); err == nil {
+				pointsTo = append(pointsTo, obj)
+			}
+		}
+		found := false
+		for _, want := range opts.PointsAt {
+			for _, s := range pointsTo {
+				if s == want {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	if len(opts.Contains) == 0 && len(opts.NoContains) == 0 {
+		return true, nil
+	}
+	tip, err := RefSpec(ref.Name).CommitID(c)
+	if err != nil {
+		// Tags of things other than commits don't contain any
+		// commits.
+		return len(opts.Contains) == 0, nil
 	}
-	sort.Slice(tags, func(i, j int) bool {
+	for _, cmtish := range opts.Contains {
+		cmt, err := cmtish.CommitID(c)
+		if err != nil {
+			return false, err
+		}
+		if !cmt.IsAncestor(c, tip) {
+			return false, nil
+		}
+	}
+	for _, cmtish := range opts.NoContains {
+		cmt, err := cmtish.CommitID(c)
+		if err != nil {
+			return false, err
+		}
+		if cmt.IsAncestor(c, tip) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// sortTags sorts tags in place according to opts.Sort.
+func sortTags(c *Client, opts TagOptions, tags []Ref) error {
+	key := opts.Sort
+	reverse := strings.HasPrefix(key, "-")
+	key = strings.TrimPrefix(key, "-")
+
+	name := func(r Ref) string {
+		n := strings.TrimPrefix(r.Name, "refs/tags/")
 		if opts.IgnoreCase {
-			return strings.ToLower(tags[i]) < strings.ToLower(tags[j])
+			return strings.ToLower(n)
+		}
+		return n
+	}
+	var less func(i, j int) bool
+	switch key {
+	case "", "refname":
+		less = func(i, j int) bool { return name(tags[i]) < name(tags[j]) }
+	case "version:refname", "v:refname":
+		less = func(i, j int) bool { return versionCompare(name(tags[i]), name(tags[j])) < 0 }
+	case "objectname":
+		less = func(i, j int) bool { return tags[i].Value.String() < tags[j].Value.String() }
+	case "creatordate", "taggerdate":
+		dates := make(map[string]int64, len(tags))
+		for _, t := range tags {
+			field := "creatordate:unix"
+			if key == "taggerdate" {
+				field = "taggerdate:unix"
+			}
+			d, err := refField(c, t, field)
+			if err != nil {
+				return err
+			}
+			dates[t.Name], _ = strconv.ParseInt(d, 10, 64)
+		}
+		less = func(i, j int) bool {
+			if dates[tags[i].Name] == dates[tags[j].Name] {
+				return name(tags[i]) < name(tags[j])
+			}
+			return dates[tags[i].Name] < dates[tags[j].Name]
 		}
-		return tags[i] < tags[j]
+	default:
+		return fmt.Errorf("unsupported sort key: %v", key)
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		if reverse {
+			return less(j, i)
+		}
+		return less(i, j)
 	})
-	return tags, nil
+	return nil
+}
+
+// versionCompare compares a and b, treating any runs of digits as
+// numbers so that "v1.10" sorts after "v1.9". It returns a negative
+// number if a < b, 0 if they're equal, or a positive number if a > b.
+func versionCompare(a, b string) int {
+	isDigit := func(ch byte) bool { return ch >= '0' && ch <= '9' }
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			i, j := 0, 0
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			na := strings.TrimLeft(a[:i], "0")
+			nb := strings.TrimLeft(b[:j], "0")
+			if len(na) != len(nb) {
+				return len(na) - len(nb)
+			}
+			if na != nb {
+				return strings.Compare(na, nb)
+			}
+			a, b = a[i:], b[j:]
+			continue
+		}
+		if a[0] != b[0] {
+			return int(a[0]) - int(b[0])
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) - len(b)
 }
 
 func TagCommit(c *Client, opts TagOptions, tagname string, cmt Commitish, msg string) error {
 	refspec := RefSpec("refs/tags/" + tagname)
+	if err := checkRefName("refs/tags/"+tagname, false, false); err != nil {
+		return fmt.Errorf("'%v' is not a valid tag name.", tagname)
+	}
 	var comm CommitID
 	if cmt == nil {
 		cmmt, err := c.GetHeadCommit()
@@ -76,12 +281,22 @@ func TagCommit(c *Client, opts TagOptions, tagname string, cmt Commitish, msg st
 		}
 		comm = cmmt
 	}
-	if refspec.File(c).Exists() && !opts.Force {
+	if refspec.Exists(c) && !opts.Force {
 		return fmt.Errorf("tag '%v' already exists", tagname)
 	}
 	if opts.Annotated {
 		t := time.Now()
+		if date := os.Getenv("GIT_COMMITTER_DATE"); date != "" {
+			d, err := parseDate(date)
+			if err != nil {
+				return err
+			}
+			t = d
+		}
 		tagger, err := c.GetCommitter(&t)
+		if err != nil && err != NoGlobalConfig {
+			return err
+		}
 		tagstdin := fmt.Sprintf(`object %v
 type commit
 tag %v
@@ -122,8 +337,7 @@ func TagDelete(c *Client, opts TagOptions, tagnames []Refname) error {
 		if !strings.HasPrefix(tag.Name, "refs/tags") {
 			return fmt.Errorf("Invalid tag: %v", tag.Name)
 		}
-		file := c.GitDir.File(File(tag.Name))
-		if err := os.Remove(file.String()); err != nil {
+		if err := c.Refs().DeleteRef(tag.Name); err != nil {
 			return err
 		}
 	}
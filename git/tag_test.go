@@ -0,0 +1,101 @@
+package git
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestVersionCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.9", "v1.10", -1},
+		{"v1.10", "v1.9", 1},
+		{"v1.2", "v1.2", 0},
+		{"v1.2", "v1.2.1", -1},
+		{"v2.0", "v10.0", -1},
+		{"a", "b", -1},
+		{"v1.01", "v1.1", 0},
+	}
+	for _, tc := range tests {
+		got := versionCompare(tc.a, tc.b)
+		switch {
+		case tc.want < 0 && got >= 0, tc.want > 0 && got <= 0, tc.want == 0 && got != 0:
+			t.Errorf("versionCompare(%q, %q) = %d, want sign of %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestTagList(t *testing.T) {
+	c, dir, cmts := testDescribeSetup(t)
+	defer os.RemoveAll(dir)
+
+	if err := TagCommit(c, TagOptions{}, "v1.10", cmts[2], ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := TagCommit(c, TagOptions{Annotated: true}, "v1.9", cmts[1], "Release 1.9\n\nWith a body\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		opts     TagOptions
+		patterns []string
+		want     []string
+	}{
+		{TagOptions{}, nil, []string{"light", "v1", "v1.10", "v1.9"}},
+		{TagOptions{Sort: "version:refname"}, []string{"v*"}, []string{"v1", "v1.9", "v1.10"}},
+		{TagOptions{Sort: "-v:refname"}, []string{"v1.*"}, []string{"v1.10", "v1.9"}},
+		{TagOptions{Contains: []Commitish{cmts[1]}}, nil, []string{"light", "v1.10", "v1.9"}},
+		{TagOptions{NoContains: []Commitish{cmts[1]}}, nil, []string{"v1"}},
+		{TagOptions{PointsAt: []Sha1{Sha1(cmts[1])}}, nil, []string{"light", "v1.9"}},
+		{TagOptions{Lines: 1}, []string{"v1.9"}, []string{"v1.9            Release 1.9"}},
+		{TagOptions{Lines: 3}, []string{"v1.9"}, []string{"v1.9            Release 1.9\n    \n    With a body"}},
+		{
+			TagOptions{Format: "%(refname:short) %(objecttype) %(*objectname) %(contents:subject)"},
+			[]string{"v1.9", "light"},
+			[]string{"light commit  bar", "v1.9 tag " + cmts[1].String() + " Release 1.9"},
+		},
+	}
+	for i, tc := range tests {
+		got, err := TagList(c, tc.opts, tc.patterns)
+		if err != nil {
+			t.Errorf("Test %d: %v", i, err)
+			continue
+		}
+		if strings.Join(got, "|") != strings.Join(tc.want, "|") {
+			t.Errorf("Test %d: got %q want %q", i, got, tc.want)
+		}
+	}
+}
+
+func TestTagAnnotated(t *testing.T) {
+	c, dir, _ := testDescribeSetup(t)
+	defer os.RemoveAll(dir)
+
+	if err := TagCommit(c, TagOptions{Annotated: true}, "v2", nil, "Version 2\n"); err != nil {
+		t.Fatal(err)
+	}
+	val, err := RefSpec("refs/tags/v2").Value(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha, err := Sha1FromString(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := c.GetTagObject(sha)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.GetHeader("tag") != "v2" || tag.GetHeader("type") != "commit" {
+		t.Errorf("Unexpected tag object: %v", tag)
+	}
+	if !strings.HasSuffix(tag.String(), "\n\nVersion 2\n") {
+		t.Errorf("Unexpected tag message: %q", tag.String())
+	}
+	if err := TagCommit(c, TagOptions{Annotated: true}, "v2", nil, "Again\n"); err == nil {
+		t.Error("Expected error replacing existing tag without Force")
+	}
+}
@@ -0,0 +1,352 @@
+package git
+
+import (
+	"strconv"
+	"strings"
+)
+
+// The options for showing the trailers of a commit message with
+// %(trailers:<options>).
+type trailerOptions struct {
+	only, unfold, keyOnly, valueOnly bool
+
+	// Only the trailers with one of these keys are shown, if set.
+	keys []string
+
+	// Shown between the trailers, instead of ending each of them with a
+	// newline, if set.
+	separator *string
+
+	// Shown between the key and value of each trailer, instead of ": ",
+	// if set.
+	keyValueSeparator *string
+}
+
+// isSet returns whether any of the options were given.
+func (o trailerOptions) isSet() bool {
+	return o.only || o.unfold || o.keyOnly || o.valueOnly || o.keys != nil || o.separator != nil || o.keyValueSeparator != nil
+}
+
+// trailers expands %(trailers) and %(trailers:<options>) for the trailers
+// of msg.
+func (u *userFormat) trailers(ph, msg string) (int, error) {
+	ph = strings.TrimPrefix(ph, "(trailers")
+	var opts trailerOptions
+	n := len("(trailers")
+	switch {
+	case strings.HasPrefix(ph, ")"):
+		n++
+	case strings.HasPrefix(ph, ":"):
+		end := strings.IndexByte(ph, ')')
+		if end < 0 {
+			return 0, nil
+		}
+		if !parseTrailerOptions(ph[1:end], &opts) {
+			return 0, nil
+		}
+		n += end + 1
+	default:
+		return 0, nil
+	}
+	u.add(formatTrailers(msg, opts))
+	return n, nil
+}
+
+// parseTrailerOptions parses the comma separated options of
+// %(trailers:<options>) into opts, and returns whether they're valid.
+func parseTrailerOptions(s string, opts *trailerOptions) bool {
+	for s != "" {
+		var opt string
+		// The values of separators can have commas in them as %x2c,
+		// so each option ends at the first comma.
+		if i := strings.IndexByte(s, ','); i >= 0 {
+			opt, s = s[:i], s[i+1:]
+		} else {
+			opt, s = s, ""
+		}
+		name, value := opt, ""
+		hasValue := false
+		if i := strings.IndexByte(opt, '='); i >= 0 {
+			name, value, hasValue = opt[:i], opt[i+1:], true
+		}
+		switch name {
+		case "key":
+			if !hasValue {
+				return false
+			}
+			opts.keys = append(opts.keys, strings.TrimSuffix(value, ":"))
+			opts.only = true
+		case "separator":
+			if !hasValue {
+				return false
+			}
+			sep := expandSeparator(value)
+			opts.separator = &sep
+		case "key_value_separator":
+			if !hasValue {
+				return false
+			}
+			sep := expandSeparator(value)
+			opts.keyValueSeparator = &sep
+		case "only", "unfold", "keyonly", "valueonly":
+			b := true
+			if hasValue {
+				var ok bool
+				if b, ok = parseBoolOption(value); !ok {
+					return false
+				}
+			}
+			switch name {
+			case "only":
+				opts.only = b
+			case "unfold":
+				opts.unfold = b
+			case "keyonly":
+				opts.keyOnly = b
+			case "valueonly":
+				opts.valueOnly = b
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// parseBoolOption parses the value of a boolean option the way git parses
+// boolean config values.
+func parseBoolOption(s string) (bool, bool) {
+	switch strings.ToLower(s) {
+	case "true", "yes", "on":
+		return true, true
+	case "false", "no", "off", "":
+		return false, true
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		return n != 0, true
+	}
+	return false, false
+}
+
+// expandSeparator expands the %n and %xNN placeholders in the value of a
+// separator option.
+func expandSeparator(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] != '%':
+			sb.WriteByte(s[i])
+		case strings.HasPrefix(s[i+1:], "n"):
+			sb.WriteByte('\n')
+			i++
+		case strings.HasPrefix(s[i+1:], "x") && i+3 < len(s) && isHexByte(s[i+2]) && isHexByte(s[i+3]):
+			b, _ := strconv.ParseUint(s[i+2:i+4], 16, 8)
+			sb.WriteByte(byte(b))
+			i += 3
+		default:
+			sb.WriteByte('%')
+		}
+	}
+	return sb.String()
+}
+
+// A trailerLine is a line of the trailer block of a commit message, with
+// any continuation lines after it.
+type trailerLine struct {
+	// The whole line, with its continuation lines and newlines.
+	text string
+
+	// The key and value of the trailer, if it is one.
+	key, value string
+	isTrailer  bool
+}
+
+// trailerSeparator returns where the ":" between the key and value of the
+// trailer line is, or -1 if it isn't a trailer.
+func trailerSeparator(line string) int {
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case ch == ':':
+			if i == 0 {
+				return -1
+			}
+			return i
+		case ch == ' ' || ch == '\t':
+			// Spaces are only allowed between the key and
+			// separator.
+			if strings.TrimLeft(line[i:], " \t") == "" || strings.TrimLeft(line[i:], " \t")[0] != ':' {
+				return -1
+			}
+		case (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9') || ch == '-':
+		default:
+			return -1
+		}
+	}
+	return -1
+}
+
+// findTrailers returns the lines of the trailer block at the end of msg,
+// which is the last paragraph if every line in it is a trailer, or if a
+// quarter of it is and one of them was added by git.
+func findTrailers(msg string) []trailerLine {
+	lines := strings.SplitAfter(msg, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	// The subject is never a trailer block.
+	start := 0
+	for start < len(lines) && strings.TrimSpace(lines[start]) == "" {
+		start++
+	}
+	for start < len(lines) && strings.TrimSpace(lines[start]) != "" {
+		start++
+	}
+	// Anything after a "---" line is a patch, and comments and blank
+	// lines at the end aren't part of the trailers.
+	end := len(lines)
+	for i := start; i < end; i++ {
+		if l := strings.TrimRight(lines[i], "\n"); l == "---" || strings.HasPrefix(l, "--- ") {
+			end = i
+		}
+	}
+	for end > start && (strings.TrimSpace(lines[end-1]) == "" || strings.HasPrefix(lines[end-1], "#")) {
+		end--
+	}
+
+	var block []trailerLine
+	trailers, others := 0, 0
+	recognized := false
+	possibleContinuation := 0
+	i := end - 1
+	for ; i >= start; i-- {
+		line := strings.TrimRight(lines[i], "\n")
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			break
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			possibleContinuation++
+			continue
+		}
+		if strings.HasPrefix(line, "(cherry picked from commit ") {
+			recognized = true
+			trailers++
+			trailers += possibleContinuation
+			possibleContinuation = 0
+			continue
+		}
+		if sep := trailerSeparator(line); sep >= 0 {
+			if strings.HasPrefix(line, "Signed-off-by:") {
+				recognized = true
+			}
+			trailers++
+			trailers += possibleContinuation
+			possibleContinuation = 0
+			continue
+		}
+		others++
+		others += possibleContinuation
+		possibleContinuation = 0
+	}
+	others += possibleContinuation
+	if trailers == 0 || (others != 0 && !(recognized && trailers*3 >= others)) {
+		return nil
+	}
+
+	for _, line := range lines[i+1 : end] {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(block) > 0 {
+			last := &block[len(block)-1]
+			last.text += line
+			if last.isTrailer {
+				last.value += "\n" + strings.TrimRight(line, "\n")
+			}
+			continue
+		}
+		t := trailerLine{text: line}
+		if sep := trailerSeparator(line); sep >= 0 {
+			t.isTrailer = true
+			t.key = strings.TrimSpace(line[:sep])
+			t.value = strings.TrimRight(line[sep+1:], "\n")
+		}
+		block = append(block, t)
+	}
+	for j := range block {
+		block[j].value = strings.TrimSpace(block[j].value)
+	}
+	return block
+}
+
+// formatTrailers returns the trailers of msg the way opts selects. They're
+// returned as they are in msg if there aren't any options.
+func formatTrailers(msg string, opts trailerOptions) string {
+	block := findTrailers(msg)
+	if !opts.isSet() {
+		var sb strings.Builder
+		for _, t := range block {
+			sb.WriteString(t.text)
+		}
+		return sb.String()
+	}
+	var sb strings.Builder
+	for _, t := range block {
+		if !t.isTrailer {
+			if opts.only {
+				continue
+			}
+			if opts.separator != nil && sb.Len() > 0 {
+				sb.WriteString(*opts.separator)
+			}
+			if opts.separator != nil {
+				sb.WriteString(strings.TrimRight(t.text, " \t\n"))
+			} else {
+				sb.WriteString(t.text)
+			}
+			continue
+		}
+		if opts.keys != nil {
+			matched := false
+			for _, key := range opts.keys {
+				if strings.EqualFold(key, t.key) {
+					matched = true
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+		value := t.value
+		if opts.unfold {
+			var words []string
+			for _, l := range strings.Split(value, "\n") {
+				words = append(words, strings.TrimSpace(l))
+			}
+			value = strings.Join(words, " ")
+		}
+		if opts.separator != nil && sb.Len() > 0 {
+			sb.WriteString(*opts.separator)
+		}
+		if !opts.valueOnly {
+			sb.WriteString(t.key)
+		}
+		if !opts.keyOnly && !opts.valueOnly {
+			if opts.keyValueSeparator != nil {
+				sb.WriteString(*opts.keyValueSeparator)
+			} else {
+				sb.WriteString(": ")
+			}
+		}
+		if !opts.keyOnly {
+			sb.WriteString(value)
+		}
+		if opts.separator == nil {
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
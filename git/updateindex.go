@@ -226,6 +226,22 @@ func UpdateIndexRefresh(c *Client, idx *Index, opts UpdateIndexOptions) (*Index,
 			// Nothing to refresh
 			continue
 		}
+		if err := entry.CompareStat(f); err == nil {
+			// Already up to date
+			continue
+		}
+		if !f.IsSymlink() {
+			// Only refresh the stat info if the content didn't change,
+			// otherwise the modification would be hidden from anything
+			// that trusts the stat info.
+			hash, _, err := HashFile("blob", f.String())
+			if err != nil {
+				return nil, err
+			}
+			if hash != entry.Sha1 {
+				continue
+			}
+		}
 		if err := entry.RefreshStat(c); err != nil {
 			return nil, err
 		}
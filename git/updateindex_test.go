@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"strings"
+	"time"
 
 	"testing"
 )
@@ -262,3 +263,58 @@ func TestUpdateIndexIndexInfo(t *testing.T) {
 		}
 	}
 }
+
+func TestUpdateIndexRefresh(t *testing.T) {
+	wd, err := ioutil.TempDir("", "gitupdateindextest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(wd)
+	os.Chdir(wd)
+
+	c, err := Init(nil, InitOptions{Quiet: true}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"modified", "touched"} {
+		if err := ioutil.WriteFile(name, []byte("content\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	idx, err := Add(c, AddOptions{}, []File{"modified", "touched"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changing the content must leave the stat info stale, so that the
+	// modification isn't hidden, while a file that was only touched is
+	// refreshed.
+	if err := ioutil.WriteFile("modified", []byte("changed content\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes("touched", later, later); err != nil {
+		t.Fatal(err)
+	}
+	idx, err = UpdateIndexRefresh(c, idx, UpdateIndexOptions{Refresh: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range idx.Objects {
+		f, err := entry.PathName.FilePath(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = entry.CompareStat(f)
+		switch entry.PathName {
+		case "modified":
+			if err == nil {
+				t.Error("Modified file was refreshed")
+			}
+		case "touched":
+			if err != nil {
+				t.Errorf("Touched file was not refreshed: %v", err)
+			}
+		}
+	}
+}
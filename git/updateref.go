@@ -19,53 +19,55 @@ type UpdateRefOptions struct {
 	NullTerminate bool
 }
 
-func updateReflog(c *Client, create bool, file File, oldvalue, newvalue Commitish, reason string) error {
-	if !file.Exists() {
-		if !create {
-			return nil
-		}
-		f, err := file.Create()
-		if err != nil {
-			return err
-		}
-		f.Close()
+// newReflogEntry returns the entry that should be added to the reflog of
+// ref for a change from oldvalue to newvalue, or nil if ref does not have
+// a reflog and create is false.
+func newReflogEntry(c *Client, create bool, ref string, oldvalue, newvalue Commitish, reason string) (*ReflogEntry, error) {
+	if !create && !c.Refs().ReflogExists(ref) {
+		return nil, nil
 	}
 
 	now := time.Now()
-	commiter := c.GetAuthor(&now)
-
-	var toAppend string
-
-	var oldsha, newsha CommitID
-	var err error
+	// Reflog entries are a single line, so collapse any whitespace
+	// in the reason the same way that git does.
+	entry := &ReflogEntry{Committer: c.GetAuthor(&now), Message: strings.Join(strings.Fields(reason), " ")}
 	if oldvalue != nil {
-		oldsha, err = oldvalue.CommitID(c)
+		oldsha, err := oldvalue.CommitID(c)
 		switch err {
 		case DetachedHead, nil:
 		default:
-			return err
+			return nil, err
 		}
+		entry.Old = Sha1(oldsha)
 	}
 	if newvalue != nil {
-		newsha, err = newvalue.CommitID(c)
+		newsha, err := newvalue.CommitID(c)
 		switch err {
 		case DetachedHead, nil:
 		default:
-			return err
+			return nil, err
 		}
-
+		entry.New = Sha1(newsha)
 	}
-	if reason == "" {
-		toAppend = fmt.Sprintf("%s %s %s\n", oldsha, newsha, commiter)
-	} else {
-		toAppend = fmt.Sprintf("%s %s %s\t%s\n", oldsha, newsha, commiter, reason)
+	return entry, nil
+}
+
+// updateReflog adds an entry to the reflog for ref without changing
+// the ref.
+func updateReflog(c *Client, create bool, ref string, oldvalue, newvalue Commitish, reason string) error {
+	entry, err := newReflogEntry(c, create, ref, oldvalue, newvalue, reason)
+	if err != nil || entry == nil {
+		return err
 	}
-	return file.Append(toAppend)
+	return c.Refs().AppendReflog(ref, *entry)
 }
 
 // Safely updates ref to point to cmt under the client c, logging reason in the reflog.
 // If opts.OldValue is set, it will return an error if the current value is not OldValue.
 func UpdateRefSpec(c *Client, opts UpdateRefOptions, ref RefSpec, cmt CommitID, reason string) error {
+	if err := validateRefName(ref.String()); err != nil {
+		return fmt.Errorf("Refusing to update ref with bad name '%v'", ref)
+	}
 	if opts.OldValue != nil {
 		oldval, err := opts.OldValue.CommitID(c)
 		if err != nil {
@@ -84,18 +86,12 @@ func UpdateRefSpec(c *Client, opts UpdateRefOptions, ref RefSpec, cmt CommitID,
 	}
 
 	// The RefSpec Stringer method strips out trailing newlines and junk.
-	filename := File(ref.String())
-	if err := updateReflog(c, opts.CreateReflog, File(c.GitDir)+"/logs/"+filename, opts.OldValue, cmt, reason); err != nil {
-		return err
-	}
-
-	file, err := c.GitDir.Create(filename)
+	refname := ref.String()
+	entry, err := newReflogEntry(c, opts.CreateReflog, refname, opts.OldValue, cmt, reason)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-	fmt.Fprintf(file, "%s\n", cmt)
-	return nil
+	return c.Refs().WriteRef(refname, cmt.String(), entry)
 }
 
 // Handles "git update-ref" command line. ref is what's passed on the command-line
@@ -109,11 +105,10 @@ func UpdateRef(c *Client, opts UpdateRefOptions, ref string, cmt CommitID, reaso
 	if opts.Delete {
 		// FIXME: This is more of a hack to ensure that the fsck passes
 		// than a real implementation.
-		f := c.GitDir.File(File(ref))
-		if !f.Exists() {
+		if _, err := c.Refs().ReadRef(ref); err != nil {
 			return nil
 		}
-		return f.Remove()
+		return c.Refs().DeleteRef(ref)
 	}
 
 	// It's not a symbolic ref, it's a real ref. Just directly call UpdateRefSpec
@@ -150,7 +145,7 @@ func UpdateRef(c *Client, opts UpdateRefOptions, ref string, cmt CommitID, reaso
 
 		// Update the symbolic-ref reflog before doing anything. If it can't
 		// be updated, it's a fatal error and we can't update the refspec.
-		if err := updateReflog(c, true, File(c.GitDir)+"/logs/"+File(ref), opts.OldValue, cmt, reason); err != nil {
+		if err := updateReflog(c, true, ref, opts.OldValue, cmt, reason); err != nil {
 			return err
 		}
 		return UpdateRefSpec(c, opts, refspec, cmt, reason)
@@ -158,15 +153,12 @@ func UpdateRef(c *Client, opts UpdateRefOptions, ref string, cmt CommitID, reaso
 
 noderef:
 	// NoDeref was specified.
-	if err := updateReflog(c, true, File(c.GitDir)+"/logs/"+File(ref), opts.OldValue, cmt, reason); err != nil {
-		return err
+	if err := validateRefName(ref); err != nil {
+		return fmt.Errorf("Refusing to update ref with bad name '%v'", ref)
 	}
-
-	f, err := c.GitDir.Create(File(ref))
+	entry, err := newReflogEntry(c, true, ref, opts.OldValue, cmt, reason)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	fmt.Fprintf(f, "%s", cmt)
-	return nil
+	return c.Refs().WriteRef(ref, cmt.String(), entry)
 }
@@ -0,0 +1,756 @@
+package git
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The ways that %<(N), %>(N) and their variants pad the next placeholder.
+type padFlush int
+
+const (
+	padNone padFlush = iota
+	// %<(N): pad on the right.
+	padRight
+	// %>(N): pad on the left.
+	padLeft
+	// %>>(N): pad on the left, using any spaces on the left first.
+	padLeftSteal
+	// %><(N): pad on both sides.
+	padBoth
+)
+
+// The ways that a padded placeholder which is too wide is truncated.
+type padTruncate int
+
+const (
+	truncNone padTruncate = iota
+	truncLeft
+	truncMiddle
+	truncRight
+)
+
+// A userFormat is the state of expanding a user format for a commit. It's
+// git's format_commit_context.
+type userFormat struct {
+	p   *PrettyPrinter
+	cmt CommitID
+	pc  prettyCommit
+	out []byte
+
+	// Whether %C(auto) turned colours on for the placeholders after it.
+	autoColor bool
+
+	// How the next placeholder is padded by %<(N) and its variants. A
+	// negative padding is the column to pad to.
+	flush    padFlush
+	padding  int
+	truncate padTruncate
+
+	// Where the text wrapped by the last %w starts, and how it's wrapped.
+	wrapStart               int
+	width, indent1, indent2 int
+}
+
+// expand returns format with its placeholders replaced by the parts of
+// cmt, as described in git-log(1).
+func (p *PrettyPrinter) expand(cmt CommitID, pc prettyCommit, format string) (string, error) {
+	u := &userFormat{p: p, cmt: cmt, pc: pc}
+	for {
+		i := strings.IndexByte(format, '%')
+		if i < 0 {
+			u.out = append(u.out, format...)
+			break
+		}
+		u.out = append(u.out, format[:i]...)
+		format = format[i+1:]
+		if strings.HasPrefix(format, "%") {
+			u.out = append(u.out, '%')
+			format = format[1:]
+			continue
+		}
+		// Unknown placeholders are left as they are.
+		n, err := u.item(format)
+		if err != nil {
+			return "", err
+		}
+		if n == 0 {
+			u.out = append(u.out, '%')
+		}
+		format = format[n:]
+	}
+	u.rewrap(0, 0, 0)
+	return string(u.out), nil
+}
+
+// item expands the placeholder at the start of ph, which is after a %,
+// and returns how much of ph it was. A +, - or space before it adds a
+// newline before it if it isn't empty, removes the newlines before it if it
+// is, or adds a space before it if it isn't, respectively.
+func (u *userFormat) item(ph string) (int, error) {
+	var magic byte
+	if ph != "" && strings.IndexByte("+- ", ph[0]) >= 0 {
+		magic, ph = ph[0], ph[1:]
+		if strings.HasPrefix(ph, "w") {
+			return 0, nil
+		}
+	}
+	start := len(u.out)
+	var n int
+	var err error
+	if u.flush != padNone {
+		n, err = u.pad(ph)
+	} else {
+		n, err = u.one(ph)
+	}
+	if err != nil || magic == 0 {
+		return n, err
+	}
+	switch {
+	case len(u.out) == start && magic == '-':
+		for len(u.out) > 0 && u.out[len(u.out)-1] == '\n' {
+			u.out = u.out[:len(u.out)-1]
+		}
+	case len(u.out) != start && magic == '+':
+		u.insert(start, "\n")
+	case len(u.out) != start && magic == ' ':
+		u.insert(start, " ")
+	}
+	return n + 1, nil
+}
+
+// insert inserts s into the output at i.
+func (u *userFormat) insert(i int, s string) {
+	u.out = append(u.out[:i], append([]byte(s), u.out[i:]...)...)
+}
+
+// add adds s to the output.
+func (u *userFormat) add(s string) {
+	u.out = append(u.out, s...)
+}
+
+// one expands the placeholder at the start of ph, and returns how much of
+// ph it was, or 0 if it isn't one. It's git's format_commit_one.
+func (u *userFormat) one(ph string) (int, error) {
+	if ph == "" {
+		return 0, nil
+	}
+	// These don't depend on the commit.
+	switch ph[0] {
+	case 'C':
+		if strings.HasPrefix(ph, "C(auto)") {
+			u.autoColor = u.p.color
+			if u.autoColor && len(u.out) > 0 {
+				u.add(colorReset)
+			}
+			return 7, nil
+		}
+		n, err := u.color(ph)
+		if n > 0 {
+			u.autoColor = false
+		}
+		return n, err
+	case 'n':
+		u.add("\n")
+		return 1, nil
+	case 'x':
+		if len(ph) < 3 || !isHexByte(ph[1]) || !isHexByte(ph[2]) {
+			return 0, nil
+		}
+		b, _ := strconv.ParseUint(ph[1:3], 16, 8)
+		u.out = append(u.out, byte(b))
+		return 3, nil
+	case 'w':
+		return u.parseWrap(ph), nil
+	case '<', '>':
+		return u.parsePadding(ph), nil
+	}
+
+	switch ph[0] {
+	case 'H':
+		u.addCommitColored(u.cmt.String())
+		return 1, nil
+	case 'h':
+		u.addCommitColored(Sha1(u.cmt).Abbrev(u.p.c, 7))
+		return 1, nil
+	case 'T', 't':
+		tree := u.pc.header("tree")
+		if ph[0] == 't' {
+			if s, err := Sha1FromString(tree); err == nil {
+				tree = s.Abbrev(u.p.c, 7)
+			}
+		}
+		u.add(tree)
+		return 1, nil
+	case 'P', 'p':
+		var parents []string
+		for _, h := range u.pc.headers {
+			if !strings.HasPrefix(h, "parent ") {
+				continue
+			}
+			parent := h[7:]
+			if ph[0] == 'p' {
+				if s, err := Sha1FromString(parent); err == nil {
+					parent = s.Abbrev(u.p.c, 7)
+				}
+			}
+			parents = append(parents, parent)
+		}
+		u.add(strings.Join(parents, " "))
+		return 1, nil
+	case 'm':
+		u.add(">")
+		return 1, nil
+	case 'd', 'D':
+		d := u.p.opts.Decorations
+		if d == nil {
+			var err error
+			if d, err = LoadDecorations(u.p.c, DecorateOptions{}); err != nil {
+				return 0, err
+			}
+			u.p.opts.Decorations = d
+		}
+		if ph[0] == 'd' {
+			u.add(d.Format(u.cmt, " (", ", ", ")", u.autoColor))
+		} else {
+			u.add(d.Format(u.cmt, "", ", ", "", u.autoColor))
+		}
+		return 1, nil
+	case 'g':
+		// There aren't any reflog selectors or messages, since the
+		// reflogs aren't walked.
+		if len(ph) > 1 && strings.IndexByte("dDsnNeE", ph[1]) >= 0 {
+			return 2, nil
+		}
+		return 0, nil
+	case 'N':
+		if u.p.opts.NotesRefs == nil {
+			return 0, nil
+		}
+		notes, err := formatNotes(u.p.c, u.p.opts.NotesRefs, Sha1(u.cmt), true)
+		if err != nil {
+			return 0, err
+		}
+		u.add(notes)
+		return 1, nil
+	case 'G':
+		return u.signature(ph), nil
+	case 'a', 'c':
+		who := "author"
+		if ph[0] == 'c' {
+			who = "committer"
+		}
+		return u.person(ph, who), nil
+	case 'e':
+		u.add(u.pc.header("encoding"))
+		return 1, nil
+	case 'B':
+		u.add(u.pc.message)
+		return 1, nil
+	}
+
+	msg := skipBlankLines(u.pc.message)
+	subject, body := messageSubject(msg, " ")
+	switch ph[0] {
+	case 's':
+		u.add(subject)
+		return 1, nil
+	case 'f':
+		line := msg
+		if i := strings.IndexByte(msg, '\n'); i >= 0 {
+			line = msg[:i]
+		}
+		u.add(sanitizedSubject(line))
+		return 1, nil
+	case 'b':
+		u.add(skipBlankLines(body))
+		return 1, nil
+	}
+	if strings.HasPrefix(ph, "(trailers") {
+		return u.trailers(ph, msg)
+	}
+	return 0, nil
+}
+
+// addCommitColored adds s in the colour of commit ids if %C(auto) turned
+// colours on.
+func (u *userFormat) addCommitColored(s string) {
+	if u.autoColor {
+		s = u.p.commitColor + s + colorReset
+	}
+	u.add(s)
+}
+
+// color expands %C(<color>), %Cred, %Cgreen, %Cblue and %Creset. The
+// colours are only added if the commits are coloured, unless the colour
+// starts with "always,".
+func (u *userFormat) color(ph string) (int, error) {
+	if strings.HasPrefix(ph, "C(") {
+		end := strings.IndexByte(ph, ')')
+		if end < 0 {
+			return 0, nil
+		}
+		spec, want := ph[2:end], u.p.color
+		if strings.HasPrefix(spec, "auto,") {
+			spec = spec[5:]
+		} else if strings.HasPrefix(spec, "always,") {
+			spec, want = spec[7:], true
+		}
+		if !want {
+			return end + 1, nil
+		}
+		color, err := parseColor(spec)
+		if err != nil {
+			return 0, fmt.Errorf("unable to parse --pretty format")
+		}
+		u.add(color)
+		return end + 1, nil
+	}
+	for _, basic := range []struct{ name, color string }{
+		{"red", "\x1b[31m"},
+		{"green", "\x1b[32m"},
+		{"blue", "\x1b[34m"},
+		{"reset", colorReset},
+	} {
+		if strings.HasPrefix(ph[1:], basic.name) {
+			if u.p.color {
+				u.add(basic.color)
+			}
+			return 1 + len(basic.name), nil
+		}
+	}
+	return 0, nil
+}
+
+// person expands %a<part> and %c<part> for the author or committer.
+func (u *userFormat) person(ph, who string) int {
+	if len(ph) < 2 {
+		return 0
+	}
+	// There's no mailmap, so the parts which use it are the same as
+	// the ones which don't.
+	part := ph[1]
+	p, ok := u.pc.person(who)
+	if !ok || p.Time == nil && strings.IndexByte("nNeElL", part) < 0 {
+		if strings.IndexByte("netdDri", part) >= 0 {
+			return 2
+		}
+		return 0
+	}
+	mode := ""
+	switch part {
+	case 'n', 'N':
+		u.add(p.Name)
+		return 2
+	case 'e', 'E':
+		u.add(p.Email)
+		return 2
+	case 'l', 'L':
+		local := p.Email
+		if i := strings.IndexByte(local, '@'); i >= 0 {
+			local = local[:i]
+		}
+		u.add(local)
+		return 2
+	case 't':
+		mode = "unix"
+	case 'd':
+		mode = u.p.opts.DateMode
+	case 'D':
+		mode = "rfc2822"
+	case 'r':
+		mode = "relative"
+	case 'i':
+		mode = "iso"
+	case 'I':
+		mode = "iso-strict"
+	case 'h':
+		mode = "human"
+	case 's':
+		mode = "short"
+	default:
+		return 0
+	}
+	u.add(u.p.date(p.Time, mode))
+	return 2
+}
+
+// signature expands the %G placeholders for the commit's signature. The
+// signatures aren't verified, so %G? is "N" if the commit isn't signed or
+// "E" if it can't be checked, and the other details of signatures are
+// empty.
+func (u *userFormat) signature(ph string) int {
+	if len(ph) < 2 {
+		return 0
+	}
+	switch ph[1] {
+	case '?':
+		status := "N"
+		if u.pc.header("gpgsig") != "" || u.pc.header("gpgsig-sha256") != "" {
+			status = "E"
+		}
+		u.add(status)
+	case 'T':
+		u.add("undefined")
+	case 'G', 'S', 'K', 'F', 'P':
+	default:
+		return 0
+	}
+	return 2
+}
+
+// sanitizedSubject returns subject with the runs of characters which
+// aren't letters, digits, dots or underscores replaced by a "-", for %f.
+func sanitizedSubject(subject string) string {
+	var sb []byte
+	space := 2
+	for i := 0; i < len(subject); i++ {
+		ch := subject[i]
+		isTitle := (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9') || ch == '.' || ch == '_'
+		if !isTitle {
+			space |= 1
+			continue
+		}
+		if space == 1 {
+			sb = append(sb, '-')
+		}
+		space = 0
+		sb = append(sb, ch)
+		if ch == '.' {
+			for i+1 < len(subject) && subject[i+1] == '.' {
+				i++
+			}
+		}
+	}
+	return strings.TrimRight(string(sb), ".-")
+}
+
+// parseWrap parses %w(<width>,<indent1>,<indent2>), which wraps the text
+// after it until the next %w, and returns its length.
+func (u *userFormat) parseWrap(ph string) int {
+	if !strings.HasPrefix(ph, "w(") {
+		return 0
+	}
+	end := strings.IndexByte(ph, ')')
+	if end < 0 {
+		return 0
+	}
+	var params [3]int
+	if end > 2 {
+		args := strings.Split(ph[2:end], ",")
+		if len(args) > 3 {
+			return 0
+		}
+		for i, arg := range args {
+			if arg == "" {
+				continue
+			}
+			n, err := strconv.ParseUint(arg, 10, 16)
+			if err != nil {
+				return 0
+			}
+			params[i] = int(n)
+		}
+	}
+	u.rewrap(params[0], params[1], params[2])
+	return end + 1
+}
+
+// rewrap wraps the output since the last %w the way it selected, and
+// starts wrapping the output after it with width and indents.
+func (u *userFormat) rewrap(width, indent1, indent2 int) {
+	if u.width == width && u.indent1 == indent1 && u.indent2 == indent2 {
+		return
+	}
+	if u.wrapStart < len(u.out) {
+		tail := string(u.out[u.wrapStart:])
+		u.out = append(u.out[:u.wrapStart], wrapText(tail, u.indent1, u.indent2, u.width)...)
+	}
+	u.wrapStart = len(u.out)
+	u.width, u.indent1, u.indent2 = width, indent1, indent2
+}
+
+// parsePadding parses %<(N), %<|(N), %>(N), %>|(N), %>>(N), %>>|(N),
+// %><(N) and %><|(N), each optionally with ",trunc", ",ltrunc" or
+// ",mtrunc" after N, which pad the next placeholder to N columns, or to
+// column N with a |, and returns its length.
+func (u *userFormat) parsePadding(ph string) int {
+	i := 1
+	var flush padFlush
+	switch {
+	case ph[0] == '<':
+		flush = padRight
+	case strings.HasPrefix(ph, "><"):
+		flush, i = padBoth, 2
+	case strings.HasPrefix(ph, ">>"):
+		flush, i = padLeftSteal, 2
+	default:
+		flush = padLeft
+	}
+	toColumn := false
+	if strings.HasPrefix(ph[i:], "|") {
+		toColumn = true
+		i++
+	}
+	if !strings.HasPrefix(ph[i:], "(") {
+		return 0
+	}
+	end := strings.IndexByte(ph[i:], ')')
+	if end < 0 {
+		return 0
+	}
+	end += i
+	args := strings.SplitN(ph[i+1:end], ",", 2)
+	width, err := strconv.Atoi(args[0])
+	if err != nil || width <= 0 || width > 16384 {
+		return 0
+	}
+	truncate := truncNone
+	if len(args) == 2 {
+		switch args[1] {
+		case "trunc":
+			truncate = truncRight
+		case "ltrunc":
+			truncate = truncLeft
+		case "mtrunc":
+			truncate = truncMiddle
+		default:
+			return 0
+		}
+	}
+	u.flush, u.truncate, u.padding = flush, truncate, width
+	if toColumn {
+		u.padding = -width
+	}
+	return end + 1
+}
+
+// pad expands the placeholder at the start of ph, and any colours before
+// it, padded or truncated as selected by the last padding placeholder.
+func (u *userFormat) pad(ph string) (int, error) {
+	padding := u.padding
+	if padding < 0 {
+		line := u.out[lastLineStart(u.out):]
+		padding = -padding - displayWidth(string(line))
+	}
+	start := len(u.out)
+	total := 0
+	for {
+		modifier := strings.HasPrefix(ph, "C")
+		n, err := u.one(ph)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+		if !modifier || n == 0 {
+			break
+		}
+		ph = ph[n:]
+		if !strings.HasPrefix(ph, "%") {
+			break
+		}
+		ph = ph[1:]
+		total++
+	}
+	local := string(u.out[start:])
+	u.out = u.out[:start]
+	width := displayWidth(local)
+
+	if u.flush == padLeftSteal {
+		// Use the spaces before the placeholder for it first.
+		for width > padding && len(u.out) > 1 && u.out[len(u.out)-1] == ' ' {
+			u.out = u.out[:len(u.out)-1]
+			padding++
+		}
+		u.flush = padLeft
+	}
+	if width > padding {
+		cut := width - (padding - 2)
+		switch u.truncate {
+		case truncLeft:
+			local = replaceColumns(local, 0, cut, "..")
+		case truncMiddle:
+			local = replaceColumns(local, padding/2-1, cut, "..")
+		case truncRight:
+			local = replaceColumns(local, padding-2, cut, "..")
+		}
+		u.add(local)
+	} else {
+		offset := 0
+		switch u.flush {
+		case padLeft:
+			offset = padding - width
+		case padBoth:
+			offset = (padding - width) / 2
+		}
+		u.add(strings.Repeat(" ", offset) + local + strings.Repeat(" ", padding-width-offset))
+	}
+	u.flush = padNone
+	return total, nil
+}
+
+// lastLineStart returns where the last line of b starts.
+func lastLineStart(b []byte) int {
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] == '\n' {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// ansiEscapeLen returns the length of the ANSI colour escape sequence at
+// the start of s, or 0 if there isn't one.
+func ansiEscapeLen(s string) int {
+	if !strings.HasPrefix(s, "\x1b[") {
+		return 0
+	}
+	for i := 2; i < len(s); i++ {
+		switch ch := s[i]; {
+		case ch == 'm':
+			return i + 1
+		case (ch < '0' || ch > '9') && ch != ';':
+			return 0
+		}
+	}
+	return 0
+}
+
+// displayWidth returns the number of columns that s takes up, not counting
+// any colours or control characters.
+func displayWidth(s string) int {
+	width := 0
+	for i := 0; i < len(s); {
+		if n := ansiEscapeLen(s[i:]); n > 0 {
+			i += n
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r >= ' ' && r != 0x7f {
+			width++
+		}
+		i += size
+	}
+	return width
+}
+
+// replaceColumns replaces n columns of s starting at column pos with repl.
+func replaceColumns(s string, pos, n int, repl string) string {
+	runes := []rune(s)
+	if pos < 0 {
+		pos = 0
+	}
+	if pos > len(runes) {
+		pos = len(runes)
+	}
+	end := pos + n
+	if end > len(runes) {
+		end = len(runes)
+	}
+	return string(runes[:pos]) + repl + string(runes[end:])
+}
+
+// wrapText wraps text to width columns, indenting the first line by
+// indent1 and the others by indent2. A negative indent1 is the number of
+// columns already used on the first line. If width isn't positive, the
+// lines are only indented. It's git's strbuf_add_wrapped_text.
+func wrapText(text string, indent1, indent2, width int) string {
+	var sb strings.Builder
+	if width <= 0 {
+		if indent1 < 0 {
+			indent1 = 0
+		}
+		for _, line := range strings.SplitAfter(text, "\n") {
+			if line == "" {
+				break
+			}
+			sb.WriteString(strings.Repeat(" ", indent1) + line)
+			indent1 = indent2
+		}
+		return sb.String()
+	}
+
+	isSpace := func(ch byte) bool {
+		return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' || ch == '\v' || ch == '\f'
+	}
+	isAlnum := func(ch byte) bool {
+		return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+	}
+	at := func(i int) byte {
+		if i < len(text) {
+			return text[i]
+		}
+		return 0
+	}
+
+	// bol is the start of the line, and space is the whitespace before
+	// the word being added to it, or -1 before the first word.
+	pos, bol, space := 0, 0, -1
+	w, indent := indent1, indent1
+	if indent < 0 {
+		w, space = -indent, 0
+	}
+	newLine := func() {
+		sb.WriteByte('\n')
+		pos = space
+		if isSpace(at(pos)) {
+			pos++
+		}
+		bol, space = pos, -1
+		w, indent = indent2, indent2
+	}
+	for {
+		for pos < len(text) {
+			n := ansiEscapeLen(text[pos:])
+			if n == 0 {
+				break
+			}
+			pos += n
+		}
+		c := at(pos)
+		if c != 0 && !isSpace(c) {
+			_, size := utf8.DecodeRuneInString(text[pos:])
+			w++
+			pos += size
+			continue
+		}
+		if w > width && space >= 0 {
+			newLine()
+			continue
+		}
+		start := bol
+		if c == 0 && pos == start {
+			break
+		}
+		if space >= 0 {
+			start = space
+		} else {
+			sb.WriteString(strings.Repeat(" ", indent))
+		}
+		sb.WriteString(text[start:pos])
+		if c == 0 {
+			break
+		}
+		space = pos
+		switch c {
+		case '\t':
+			w |= 7
+		case '\n':
+			space++
+			if at(space) == '\n' {
+				sb.WriteByte('\n')
+				newLine()
+				continue
+			} else if !isAlnum(at(space)) {
+				newLine()
+				continue
+			}
+			sb.WriteByte(' ')
+		}
+		w++
+		pos++
+	}
+	return sb.String()
+}
@@ -0,0 +1,152 @@
+package git
+
+import (
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A wsRule is the set of whitespace errors that are checked for, as
+// configured by core.whitespace.
+type wsRule uint
+
+const (
+	wsBlankAtEOL wsRule = 1 << (iota + 6)
+	wsSpaceBeforeTab
+	wsIndentWithNonTab
+	wsCRAtEOL
+	wsBlankAtEOF
+	wsTabInIndent
+
+	// The low bits are the width of a tab.
+	wsTabWidthMask wsRule = 0x3f
+
+	wsTrailingSpace = wsBlankAtEOL | wsBlankAtEOF
+	wsDefaultRule   = wsTrailingSpace | wsSpaceBeforeTab | 8
+)
+
+var wsRuleNames = map[string]wsRule{
+	"trailing-space":      wsTrailingSpace,
+	"space-before-tab":    wsSpaceBeforeTab,
+	"indent-with-non-tab": wsIndentWithNonTab,
+	"cr-at-eol":           wsCRAtEOL,
+	"blank-at-eol":        wsBlankAtEOL,
+	"blank-at-eof":        wsBlankAtEOF,
+	"tab-in-indent":       wsTabInIndent,
+}
+
+// parseWhitespaceRule parses a comma separated list of whitespace errors,
+// such as the value of core.whitespace, on top of the default rule. An
+// error prefixed with a "-" is no longer checked.
+func parseWhitespaceRule(config string) wsRule {
+	rule := wsDefaultRule
+	for _, name := range strings.Split(config, ",") {
+		name = strings.TrimSpace(name)
+		if strings.HasPrefix(name, "tabwidth=") {
+			if width, err := strconv.Atoi(name[len("tabwidth="):]); err == nil && width > 0 && width <= int(wsTabWidthMask) {
+				rule = rule&^wsTabWidthMask | wsRule(width)
+			}
+			continue
+		}
+		negate := strings.HasPrefix(name, "-")
+		bits, ok := wsRuleNames[strings.TrimPrefix(name, "-")]
+		if !ok {
+			continue
+		}
+		if negate {
+			rule &^= bits
+		} else {
+			rule |= bits
+		}
+	}
+	// tab-in-indent and indent-with-non-tab contradict each other.
+	if rule&wsTabInIndent != 0 && rule&wsIndentWithNonTab != 0 {
+		rule &^= wsIndentWithNonTab
+	}
+	return rule
+}
+
+func (r wsRule) tabWidth() int {
+	return int(r & wsTabWidthMask)
+}
+
+// isSpace is C's isspace, which git uses to find whitespace.
+func isSpace(b byte) bool {
+	switch b {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
+	}
+	return false
+}
+
+// isBlankLine returns whether line only contains whitespace.
+func isBlankLine(line string) bool {
+	for i := 0; i < len(line); i++ {
+		if !isSpace(line[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// countTrailingBlank returns the number of blank lines at the end of
+// lines. Like git, the first line is never counted.
+func countTrailingBlank(lines []string) int {
+	n := 0
+	for i := len(lines) - 1; i > 0 && isBlankLine(lines[i]); i-- {
+		n++
+	}
+	return n
+}
+
+// writeChecked writes line, highlighting the whitespace errors in it with
+// the ws colour and the rest of it with set. It follows git's
+// ws_check_emit.
+func (r wsRule) writeChecked(w io.Writer, line, set, reset, ws string) {
+	var eol string
+	if strings.HasSuffix(line, "\n") {
+		line, eol = line[:len(line)-1], "\n"
+	}
+	if r&wsCRAtEOL != 0 && strings.HasSuffix(line, "\r") {
+		line, eol = line[:len(line)-1], "\r"+eol
+	}
+
+	trailing := len(line)
+	if r&wsBlankAtEOL != 0 {
+		for trailing > 0 && isSpace(line[trailing-1]) {
+			trailing--
+		}
+	}
+
+	written := 0
+	i := 0
+	for ; i < trailing; i++ {
+		if line[i] == ' ' {
+			continue
+		}
+		if line[i] != '\t' {
+			break
+		}
+		switch {
+		case r&wsSpaceBeforeTab != 0 && written < i:
+			io.WriteString(w, ws+line[written:i]+reset+line[i:i+1])
+		case r&wsTabInIndent != 0:
+			io.WriteString(w, line[written:i]+ws+line[i:i+1]+reset)
+		default:
+			io.WriteString(w, line[written:i+1])
+		}
+		written = i + 1
+	}
+	if r&wsIndentWithNonTab != 0 && i-written >= r.tabWidth() {
+		io.WriteString(w, ws+line[written:i]+reset)
+		written = i
+	}
+
+	if trailing > written {
+		io.WriteString(w, set+line[written:trailing]+reset)
+	}
+	if trailing != len(line) {
+		io.WriteString(w, ws+line[trailing:]+reset)
+	}
+	io.WriteString(w, eol)
+}
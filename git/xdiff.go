@@ -0,0 +1,407 @@
+package git
+
+import (
+	"math"
+)
+
+// The tuning constants of git's xdiff.
+const (
+	xdlKeepDiscardedRun = 4
+	xdlMaxEqualLimit    = 1024
+	xdlSimilarScan      = 100
+	xdlMaxCostMin       = 256
+	xdlHeuristicMinCost = 256
+	xdlSnakeCount       = 20
+	xdlHeuristicFactor  = 4
+)
+
+// xdiffSide is one side of a diff being computed by xdiffLines.
+type xdiffSide struct {
+	// The class of each line, where equal lines have the same class.
+	classes []int
+
+	// The lines between start and end which weren't discarded, as
+	// their class and index in classes.
+	ha, index []int
+
+	// The lines which were changed.
+	changed []bool
+
+	start, end int
+}
+
+// xdiffLines returns the hunks which transform a into b, found the same
+// way as git's xdiff so that patches, stats, blames and merges match
+// git's. Lines are equal if they have the same key, or are identical if
+// key is nil. Lines which can't match are discarded before finding the
+// shortest edit with the Myers algorithm, and the changes are then slid
+// through equal lines by compactChanges.
+func xdiffLines(a, b []string, key func(string) string, indentHeuristic bool) []diffHunk {
+	ids := make(map[string]int)
+	var count1, count2 []int
+	classify := func(lines []string, counts *[]int) *xdiffSide {
+		s := &xdiffSide{classes: make([]int, len(lines)), changed: make([]bool, len(lines))}
+		for i, l := range lines {
+			if key != nil {
+				l = key(l)
+			}
+			id, ok := ids[l]
+			if !ok {
+				id = len(ids)
+				ids[l] = id
+				count1 = append(count1, 0)
+				count2 = append(count2, 0)
+			}
+			(*counts)[id]++
+			s.classes[i] = id
+		}
+		return s
+	}
+	x1 := classify(a, &count1)
+	x2 := classify(b, &count2)
+
+	// Trim the common lines from the start and end.
+	i, lim := 0, len(a)
+	if len(b) < lim {
+		lim = len(b)
+	}
+	for i < lim && x1.classes[i] == x2.classes[i] {
+		i++
+	}
+	x1.start, x2.start = i, i
+	j := 0
+	for lim -= i; j < lim && x1.classes[len(a)-1-j] == x2.classes[len(b)-1-j]; j++ {
+	}
+	x1.end, x2.end = len(a)-j-1, len(b)-j-1
+
+	xdiffCleanup(x1, count2)
+	xdiffCleanup(x2, count1)
+
+	ndiags := len(x1.ha) + len(x2.ha) + 3
+	kvdf := make([]int, ndiags)
+	kvdb := make([]int, ndiags)
+	d := &xdiffer{
+		x1:       x1,
+		x2:       x2,
+		kvdf:     kvdf,
+		kvdb:     kvdb,
+		kvOffset: len(x2.ha) + 1,
+		maxCost:  xdlMaxCostMin,
+	}
+	if cost := bogoSqrt(ndiags); cost > d.maxCost {
+		d.maxCost = cost
+	}
+	d.compare(0, len(x1.ha), 0, len(x2.ha), false)
+
+	eq := lineEqual(key)
+	compactChanges(a, x1.changed, x2.changed, eq, indentHeuristic)
+	compactChanges(b, x2.changed, x1.changed, eq, indentHeuristic)
+	return changedHunks(x1.changed, x2.changed)
+}
+
+// bogoSqrt is xdiff's approximation of the square root of n.
+func bogoSqrt(n int) int {
+	i := 1
+	for ; n > 0; n >>= 2 {
+		i <<= 1
+	}
+	return i
+}
+
+// xdiffCleanup discards the lines of s which don't appear on the other
+// side, whose counts of each class are otherCounts, and the lines which
+// appear there too often in the middle of discarded lines. Discarded lines
+// are marked as changed.
+func xdiffCleanup(s *xdiffSide, otherCounts []int) {
+	if s.start > s.end {
+		return
+	}
+	limit := bogoSqrt(len(s.classes))
+	if limit > xdlMaxEqualLimit {
+		limit = xdlMaxEqualLimit
+	}
+	// 0 if a line has no match, 1 if it has some and 2 if it has too
+	// many.
+	dis := make([]byte, len(s.classes))
+	for i := s.start; i <= s.end; i++ {
+		switch n := otherCounts[s.classes[i]]; {
+		case n == 0:
+			dis[i] = 0
+		case n >= limit:
+			dis[i] = 2
+		default:
+			dis[i] = 1
+		}
+	}
+	for i := s.start; i <= s.end; i++ {
+		if dis[i] == 1 || (dis[i] == 2 && !xdiffCleanMultiMatch(dis, i, s.start, s.end)) {
+			s.index = append(s.index, i)
+			s.ha = append(s.ha, s.classes[i])
+		} else {
+			s.changed[i] = true
+		}
+	}
+}
+
+// xdiffCleanMultiMatch returns whether the line at i, which has too many
+// matches, is in the middle of enough lines without a match for it to be
+// discarded too.
+func xdiffCleanMultiMatch(dis []byte, i, start, end int) bool {
+	if i-start > xdlSimilarScan {
+		start = i - xdlSimilarScan
+	}
+	if end-i > xdlSimilarScan {
+		end = i + xdlSimilarScan
+	}
+	noMatchBefore, multiBefore := 0, 1
+	for r := 1; i-r >= start; r++ {
+		if dis[i-r] == 0 {
+			noMatchBefore++
+		} else if dis[i-r] == 2 {
+			multiBefore++
+		} else {
+			break
+		}
+	}
+	if noMatchBefore == 0 {
+		return false
+	}
+	noMatchAfter, multiAfter := 0, 1
+	for r := 1; i+r <= end; r++ {
+		if dis[i+r] == 0 {
+			noMatchAfter++
+		} else if dis[i+r] == 2 {
+			multiAfter++
+		} else {
+			break
+		}
+	}
+	if noMatchAfter == 0 {
+		return false
+	}
+	noMatch := noMatchBefore + noMatchAfter
+	multi := multiBefore + multiAfter
+	return multi*xdlKeepDiscardedRun < multi+noMatch
+}
+
+// xdiffer finds the shortest edit between the lines that weren't
+// discarded from x1 and x2, the same way as xdiff's xdl_recs_cmp.
+type xdiffer struct {
+	x1, x2 *xdiffSide
+
+	// The furthest reaching paths forward and backward on each
+	// diagonal, offset by kvOffset.
+	kvdf, kvdb []int
+	kvOffset   int
+
+	maxCost int
+}
+
+func (d *xdiffer) compare(off1, lim1, off2, lim2 int, needMin bool) {
+	ha1, ha2 := d.x1.ha, d.x2.ha
+	for off1 < lim1 && off2 < lim2 && ha1[off1] == ha2[off2] {
+		off1++
+		off2++
+	}
+	for off1 < lim1 && off2 < lim2 && ha1[lim1-1] == ha2[lim2-1] {
+		lim1--
+		lim2--
+	}
+	switch {
+	case off1 == lim1:
+		for ; off2 < lim2; off2++ {
+			d.x2.changed[d.x2.index[off2]] = true
+		}
+	case off2 == lim2:
+		for ; off1 < lim1; off1++ {
+			d.x1.changed[d.x1.index[off1]] = true
+		}
+	default:
+		i1, i2, minLo, minHi := d.split(off1, lim1, off2, lim2, needMin)
+		d.compare(off1, i1, off2, i2, minLo)
+		d.compare(i1, lim1, i2, lim2, minHi)
+	}
+}
+
+// split finds where to divide the edit between ha1[off1:lim1] and
+// ha2[off2:lim2], along with whether each half needs a minimal edit. It
+// gives up on finding the middle snake if it's too expensive, and uses the
+// furthest reaching path instead.
+func (d *xdiffer) split(off1, lim1, off2, lim2 int, needMin bool) (int, int, bool, bool) {
+	ha1, ha2 := d.x1.ha, d.x2.ha
+	kvdf := func(k int) *int { return &d.kvdf[k+d.kvOffset] }
+	kvdb := func(k int) *int { return &d.kvdb[k+d.kvOffset] }
+
+	dmin, dmax := off1-lim2, lim1-off2
+	fmid, bmid := off1-off2, lim1-lim2
+	odd := (fmid-bmid)&1 != 0
+	fmin, fmax := fmid, fmid
+	bmin, bmax := bmid, bmid
+
+	*kvdf(fmid) = off1
+	*kvdb(bmid) = lim1
+
+	for ec := 1; ; ec++ {
+		gotSnake := false
+
+		if fmin > dmin {
+			fmin--
+			*kvdf(fmin - 1) = -1
+		} else {
+			fmin++
+		}
+		if fmax < dmax {
+			fmax++
+			*kvdf(fmax + 1) = -1
+		} else {
+			fmax--
+		}
+		for k := fmax; k >= fmin; k -= 2 {
+			var i1 int
+			if *kvdf(k - 1) >= *kvdf(k + 1) {
+				i1 = *kvdf(k - 1) + 1
+			} else {
+				i1 = *kvdf(k + 1)
+			}
+			prev1 := i1
+			i2 := i1 - k
+			for i1 < lim1 && i2 < lim2 && ha1[i1] == ha2[i2] {
+				i1++
+				i2++
+			}
+			if i1-prev1 > xdlSnakeCount {
+				gotSnake = true
+			}
+			*kvdf(k) = i1
+			if odd && bmin <= k && k <= bmax && *kvdb(k) <= i1 {
+				return i1, i2, true, true
+			}
+		}
+
+		if bmin > dmin {
+			bmin--
+			*kvdb(bmin - 1) = math.MaxInt32
+		} else {
+			bmin++
+		}
+		if bmax < dmax {
+			bmax++
+			*kvdb(bmax + 1) = math.MaxInt32
+		} else {
+			bmax--
+		}
+		for k := bmax; k >= bmin; k -= 2 {
+			var i1 int
+			if *kvdb(k - 1) < *kvdb(k + 1) {
+				i1 = *kvdb(k - 1)
+			} else {
+				i1 = *kvdb(k + 1) - 1
+			}
+			prev1 := i1
+			i2 := i1 - k
+			for i1 > off1 && i2 > off2 && ha1[i1-1] == ha2[i2-1] {
+				i1--
+				i2--
+			}
+			if prev1-i1 > xdlSnakeCount {
+				gotSnake = true
+			}
+			*kvdb(k) = i1
+			if !odd && fmin <= k && k <= fmax && i1 <= *kvdf(k) {
+				return i1, i2, true, true
+			}
+		}
+
+		if needMin {
+			continue
+		}
+
+		// If the cost is getting high, look for a diagonal that has
+		// got far enough along a long enough snake to split there.
+		if gotSnake && ec > xdlHeuristicMinCost {
+			best, s1, s2 := 0, 0, 0
+			for k := fmax; k >= fmin; k -= 2 {
+				dd := k - fmid
+				if dd < 0 {
+					dd = -dd
+				}
+				i1 := *kvdf(k)
+				i2 := i1 - k
+				v := (i1 - off1) + (i2 - off2) - dd
+				if v > xdlHeuristicFactor*ec && v > best &&
+					off1+xdlSnakeCount <= i1 && i1 < lim1 &&
+					off2+xdlSnakeCount <= i2 && i2 < lim2 {
+					for n := 1; ha1[i1-n] == ha2[i2-n]; n++ {
+						if n == xdlSnakeCount {
+							best, s1, s2 = v, i1, i2
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				return s1, s2, true, false
+			}
+
+			best = 0
+			for k := bmax; k >= bmin; k -= 2 {
+				dd := k - bmid
+				if dd < 0 {
+					dd = -dd
+				}
+				i1 := *kvdb(k)
+				i2 := i1 - k
+				v := (lim1 - i1) + (lim2 - i2) - dd
+				if v > xdlHeuristicFactor*ec && v > best &&
+					off1 < i1 && i1 <= lim1-xdlSnakeCount &&
+					off2 < i2 && i2 <= lim2-xdlSnakeCount {
+					for n := 0; ha1[i1+n] == ha2[i2+n]; n++ {
+						if n == xdlSnakeCount-1 {
+							best, s1, s2 = v, i1, i2
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				return s1, s2, false, true
+			}
+		}
+
+		// Enough is enough, so use the furthest reaching path.
+		if ec >= d.maxCost {
+			fbest, fbest1 := -1, -1
+			for k := fmax; k >= fmin; k -= 2 {
+				i1 := *kvdf(k)
+				if i1 > lim1 {
+					i1 = lim1
+				}
+				i2 := i1 - k
+				if lim2 < i2 {
+					i1, i2 = lim2+k, lim2
+				}
+				if fbest < i1+i2 {
+					fbest, fbest1 = i1+i2, i1
+				}
+			}
+			bbest, bbest1 := math.MaxInt32, math.MaxInt32
+			for k := bmax; k >= bmin; k -= 2 {
+				i1 := *kvdb(k)
+				if i1 < off1 {
+					i1 = off1
+				}
+				i2 := i1 - k
+				if i2 < off2 {
+					i1, i2 = off2+k, off2
+				}
+				if i1+i2 < bbest {
+					bbest, bbest1 = i1+i2, i1
+				}
+			}
+			if (lim1+lim2)-bbest < fbest-(off1+off2) {
+				return fbest1, fbest - fbest1, true, false
+			}
+			return bbest1, bbest - bbest1, false, true
+		}
+	}
+}
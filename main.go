@@ -17,7 +17,7 @@ var InvalidArgument error = errors.New("Invalid argument to function")
 
 func requiresGitDir(cmd string) bool {
 	switch cmd {
-	case "init", "clone", "ls-remote":
+	case "init", "clone", "ls-remote", "check-ref-format":
 		return false
 	default:
 		return true
@@ -269,6 +269,58 @@ func main() {
 			}
 			fmt.Printf("%v\n", c)
 		}
+	case "cherry-pick":
+		subcommandUsage = "[options] <commit>..."
+		if err := cmd.CherryPick(c, args); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	case "rebase":
+		subcommandUsage = "[options] [--onto <newbase>] [<upstream> [<branch>]]"
+		if err := cmd.Rebase(c, args); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	case "stash":
+		subcommandUsage = "[push [-p] [-k] [-u] [-q] [-m <message>] [--] [<pathspec>...]] | list | show [-p] [<stash>] | apply [--index] [<stash>] | pop [--index] [<stash>] | drop [<stash>] | clear"
+		if err := cmd.Stash(c, args); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	case "bisect":
+		subcommandUsage = "start [<bad> [<good>...]] [--] [<paths>...] | bad [<rev>] | good [<rev>...] | skip [<rev>...] | reset [<commit>] | log | replay <logfile> | visualize | run <cmd>..."
+		if err := cmd.Bisect(c, args); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	case "blame":
+		subcommandUsage = "[-L <range>] [--porcelain | --line-porcelain] [-w] [-M] [-C] [--reverse] [--ignore-rev <rev>] [--ignore-revs-file <file>] [<rev>] [--] <file>"
+		if err := cmd.Blame(c, args); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	case "annotate":
+		subcommandUsage = "[-L <range>] [-w] [-M] [-C] [<rev>] [--] <file>"
+		if err := cmd.Annotate(c, args); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	case "notes":
+		subcommandUsage = "[--ref <notes-ref>] [list [<object>] | add [-f] [-m <msg> | -F <file>] [<object>] | append [-m <msg> | -F <file>] [<object>] | edit [<object>] | show [<object>] | copy [-f] <from> [<to>] | remove [<object>...] | merge [-s <strategy>] <notes-ref> | merge --commit | merge --abort | prune [-n] [-v] | get-ref]"
+		if err := cmd.Notes(c, args); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	case "merge-tree":
+		subcommandUsage = "[--write-tree] <branch1> <branch2>"
+		switch err := cmd.MergeTree(c, args); err {
+		case nil:
+		case cmd.MergeConflict:
+			os.Exit(1)
+		default:
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(128)
+		}
 	case "rev-parse":
 		subcommandUsage = "<args>..."
 		commits, opts, err := cmd.RevParse(c, args)
@@ -473,6 +525,24 @@ func main() {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
+	case "describe":
+		subcommandUsage = "[<commit-ish>...]"
+		if err := cmd.Describe(c, args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(128)
+		}
+	case "name-rev":
+		subcommandUsage = "[--stdin | --all | <commit-ish>...]"
+		if err := cmd.NameRev(c, args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(128)
+		}
+	case "check-ref-format":
+		subcommandUsage = "[--normalize] [--allow-onelevel] [--refspec-pattern] <refname> | --branch <branchname>"
+		if err := cmd.CheckRefFormat(c, args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(128)
+		}
 	case "help":
 		flag.CommandLine.SetOutput(os.Stdout)
 		flag.Usage()
@@ -498,6 +568,7 @@ func main() {
    merge-file
    merge
    merge-base
+   merge-tree       Perform a merge without touching the index or work tree
    rev-parse
    rev-list
    hash-object
@@ -519,12 +590,22 @@ func main() {
    grep
    apply
    revert
+   cherry-pick      Apply the changes introduced by some existing commits
+   rebase           Reapply commits on top of another base tip
+   stash            Stash the changes in a dirty working directory away
+   bisect           Use binary search to find the commit that introduced a bug
+   blame            Show what revision and author last modified each line of a file
+   annotate         Annotate file lines with commit information
+   notes            Add or inspect object notes
    help
    show             Show various types of objects
    var              Show a Git logical variable
    submodule        Initialize, update or inspect submodules
    showref          List references in a local repository
    archive
+   describe         Give an object a human readable name based on an available ref
+   name-rev         Find symbolic names for given revs
+   check-ref-format Ensures that a reference name is well formed
 `)
 
 		os.Exit(0)